@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	restore := flag.Bool("restore", false, "restore the archive into storage instead of creating one")
+	file := flag.String("file", "-", "archive path, or - for stdin/stdout")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg := config.Load()
+	store, err := storage.NewStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage backend (%s): %v", cfg.StorageBackend, err)
+	}
+
+	if *restore {
+		var in io.Reader = os.Stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				log.Fatalf("Failed to open archive: %v", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		if err := storage.Restore(store, in); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		log.Printf("Restored backup into %s storage", cfg.StorageBackend)
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			log.Fatalf("Failed to create archive: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := storage.Backup(store, out); err != nil {
+		log.Fatalf("Backup failed: %v", err)
+	}
+	log.Printf("Backed up %s storage", cfg.StorageBackend)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	quarantine := flag.Bool("quarantine", false, "move corrupt user records under "+storage.QuarantinePrefix+"/")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg := config.Load()
+	store, err := storage.NewStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage backend (%s): %v", cfg.StorageBackend, err)
+	}
+
+	report, err := storage.Check(context.Background(), store, []string{"home", auth.UserDir}, validateUser, *quarantine)
+	if err != nil {
+		log.Fatalf("Consistency check failed: %v", err)
+	}
+
+	for _, issue := range report.Issues {
+		status := "corrupt"
+		if issue.Quarantined {
+			status = "quarantined"
+		}
+		fmt.Printf("%s: %s: %v\n", status, issue.Path, issue.Err)
+	}
+	fmt.Printf("Scanned %d user records, %d corrupt\n", report.Scanned, len(report.Issues))
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func validateUser(item *models.StorageItem) error {
+	_, err := models.UserFromData(item.Data)
+	return err
+}
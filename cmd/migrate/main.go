@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	from := flag.String("from", "", "source storage as backend:target; defaults to the configured STORAGE_BACKEND")
+	to := flag.String("to", "", "destination storage as backend:target, e.g. mongodb:mongodb://db:27017")
+	workers := flag.Int("workers", 4, "items copied concurrently")
+	dryRun := flag.Bool("dry-run", false, "count what would be copied without writing to the destination")
+	resume := flag.Bool("resume", false, "skip items the destination already holds without comparing them, for a source unchanged since the interrupted run")
+	emailCasing := flag.Bool("email-casing", false, "instead of copying, move user records stored under mixed-case addresses to their lower-case key")
+	flag.Parse()
+
+	if *to == "" && !*emailCasing {
+		log.Fatal("-to is required")
+	}
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	cfg := config.Load()
+	source := cfg.StorageBackend
+	var src storage.Storage
+	var err error
+	if *from != "" {
+		source, _, _ = strings.Cut(*from, ":")
+		src, err = storage.NewStorageFromSpec(cfg, *from)
+	} else {
+		src, err = storage.NewStorage(cfg)
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize storage backend (%s): %v", source, err)
+	}
+	if *emailCasing {
+		migrateEmailCasing(src)
+		return
+	}
+	dst, err := storage.NewStorageFromSpec(cfg, *to)
+	if err != nil {
+		log.Fatalf("Failed to initialize destination storage: %v", err)
+	}
+
+	report, err := storage.Migrate(src, dst, storage.MigrateOptions{
+		Workers:  *workers,
+		DryRun:   *dryRun,
+		Resume:   *resume,
+		Progress: logProgress,
+	})
+	if *dryRun {
+		log.Printf("Dry run of %s storage: %d to copy, %d already present, %d failed",
+			source, report.Copied, report.Skipped, report.Failed)
+	} else {
+		log.Printf("Migrated %s storage: %d copied, %d already present, %d failed",
+			source, report.Copied, report.Skipped, report.Failed)
+	}
+	if err != nil {
+		log.Fatalf("Migration incomplete, re-run to resume:\n%v", err)
+	}
+}
+
+// progressEvery is how many items pass between progress lines
+const progressEvery = 1000
+
+func logProgress(done, total int) {
+	if done%progressEvery == 0 || done == total {
+		log.Printf("%d/%d items", done, total)
+	}
+}
+
+func migrateEmailCasing(s storage.Storage) {
+	report, err := auth.NewService(s).MigrateEmailCasing()
+	for _, email := range report.Renamed {
+		log.Printf("renamed: %s -> %s", email, auth.NormalizeEmail(email))
+	}
+	for _, email := range report.Conflicts {
+		log.Printf("conflict: %s, %s already exists", email, auth.NormalizeEmail(email))
+	}
+	if err != nil {
+		log.Fatalf("Email casing migration incomplete, re-run to resume: %v", err)
+	}
+	log.Printf("Scanned %d users: %d renamed, %d conflicts", report.Scanned, len(report.Renamed), len(report.Conflicts))
+}
@@ -1,17 +1,25 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"math/rand"
+	"syscall"
 	"time"
 
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/lifecycle"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/tlsconfig"
 	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -38,19 +46,84 @@ func main() {
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	router := gin.Default()
+	// Our own Logger and Recovery replace gin's defaults below
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
-	// Apply middleware
-	router.Use(middleware.CORS())
-	router.Use(middleware.Logger())
+	// Apply middleware. Request IDs come first so every response, even a
+	// redirect, carries one.
+	router.Use(middleware.RequestID())
+	if cfg.CanonicalHost != "" {
+		trusted, err := middleware.ParseCIDRs(cfg.TrustedProxies)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+		}
+		router.Use(middleware.CanonicalHost(cfg.CanonicalHost, trusted))
+	}
+	cors := middleware.CORSOptions{AllowedOrigins: cfg.AllowedOrigins}
+	if cfg.RouteOptions {
+		cors.Methods = middleware.RouteMethods(router)
+	}
+	if len(cfg.AllowedOrigins) == 0 {
+		log.Println("WARNING: ALLOWED_ORIGINS is not set; CORS allows credentialed requests from any origin")
+	}
+	router.Use(middleware.CORSWithOptions(cors))
+	switch cfg.LogFormat {
+	case middleware.LogFormatText, middleware.LogFormatJSON:
+	default:
+		log.Fatalf("Invalid LOG_FORMAT %q, want %q or %q", cfg.LogFormat, middleware.LogFormatText, middleware.LogFormatJSON)
+	}
+	router.Use(middleware.LoggerWithOptions(middleware.LoggerOptions{
+		Format: cfg.LogFormat,
+		Fields: cfg.LogContextFields,
+	}))
+	// Outside Recovery so panics are counted as the 500s they become
+	router.Use(middleware.Metrics())
 	router.Use(middleware.Recovery())
+	if cfg.Gzip {
+		router.Use(middleware.GzipWithMinSize(cfg.GzipMinSize))
+	}
+	router.Use(middleware.PrettyJSON(cfg.PrettyJSON && cfg.Environment != "production"))
+	if len(cfg.BlockedUserAgents) > 0 {
+		patterns, err := middleware.ParseUserAgentPatterns(cfg.BlockedUserAgents)
+		if err != nil {
+			log.Fatalf("Invalid BLOCKED_USER_AGENTS: %v", err)
+		}
+		router.Use(middleware.BlockUserAgents(patterns))
+	}
+	if cfg.ServerTiming {
+		router.Use(middleware.ServerTiming(serverTimingAllowed(cfg)))
+	}
 
 	// Initialize handlers
 	handler := handlers.NewHandler(cfg)
+	router.Use(middleware.Tenant(cfg.TenantHosts, handler.Tenants.Known))
+
+	// Sample ahead of the rate limiter so throttled requests show up too
+	if handler.Sampler != nil {
+		router.Use(handler.Sampler.Middleware())
+	}
+	// Ahead of the rate limiter too, so throttled requests count against
+	// the IP's reputation
+	if handler.Reputation != nil {
+		router.Use(handler.Reputation.Middleware())
+	}
+	if handler.Limiter != nil {
+		router.Use(handler.Limiter.Middleware())
+	}
 
 	// Setup routes
 	setupRoutes(router, handler)
 
+	if cfg.WarmupEnabled {
+		warmup(cfg, handler)
+	}
+	if cfg.PDFSelfTest {
+		pdfSelfTest(handler)
+	}
+
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -59,12 +132,79 @@ func main() {
 
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Storage backend: %s", cfg.StorageBackend)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	serveTLS := cfg.TLSCertFile != "" || cfg.TLSKeyFile != ""
+	if serveTLS {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		tlsCfg, err := tlsconfig.New(cfg.TLSMinVersion, cfg.TLSCipherSuites)
+		if err != nil {
+			log.Fatalf("Invalid TLS settings: %v", err)
+		}
+		server.TLSConfig = tlsCfg
+	}
+	drainServer := lifecycle.DrainServer(server)
+	go func() {
+		var err error
+		if serveTLS {
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Reset the storage pool when the database comes back after an outage
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	go storage.WatchConnection(watchCtx, handler.Storage, cfg.ReconnectCheckInterval)
+
+	// On SIGINT/SIGTERM, drain in-flight requests first, then write out
+	// anything still buffered, and only then close storage connections
+	hooks := lifecycle.New()
+	hooks.Register("connection watcher", func(ctx context.Context) error { stopWatching(); return nil })
+	hooks.Register("storage", func(ctx context.Context) error { return storage.Close(ctx, handler.Storage) })
+	hooks.Register("tenant storage", handler.Tenants.Close)
+	hooks.Register("change log", func(ctx context.Context) error { return handler.Changes.Close() })
+	hooks.Register("http server", drainServer)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := hooks.Shutdown(shutdownCtx); err != nil {
+		// Exit non-zero when requests were cut off, so it isn't mistaken
+		// for a clean stop
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Fatalf("Shutdown timed out after %s: %v", cfg.ShutdownTimeout, err)
+		}
+		log.Printf("Shutdown incomplete: %v", err)
 	}
 }
 
 func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
+	// Answer 405 rather than 404 when a path exists for other methods
+	router.HandleMethodNotAllowed = true
+
+	// Bearer API keys authenticate like the session cookie
+	router.Use(middleware.APIKey(handler.Auth.ValidAPIKey))
+	// Keyed on the user, so it follows the API key resolved above
+	router.Use(middleware.PerUserConcurrency(handler.Config.UserConcurrency, handler.Auth.CurrentUser))
+	// Every WebSocket upgrade, on whichever route, counts against the caps
+	router.Use(handler.WebSockets.Middleware())
+	// Bound every request body so no route reads an endless one into
+	// memory; uploads and routes carrying whole sheets get more room with
+	// BodyLimit where they are registered below
+	router.Use(middleware.MaxBodySize(int64(handler.Config.MaxBodySize)))
+	// Give up on requests stuck behind slow storage rather than let them
+	// pile up; anything passed the request's context is cancelled too
+	router.Use(middleware.Timeout(handler.Config.RequestTimeout))
+
 	// Static files with proper paths
 	router.Static("/static", "./web/static")
 	router.StaticFS("/js", http.Dir("./web/static/js"))
@@ -88,25 +228,61 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 		for _, file := range files {
 			log.Printf(" - %s", file)
 		}
-		router.LoadHTMLGlob(templatePattern)
+		if cfg := handler.Config; cfg.StrictTemplates && cfg.Environment != "production" {
+			strict, err := handlers.StrictTemplates(templatePattern, router.FuncMap)
+			if err != nil {
+				log.Fatalf("Failed to parse templates: %v", err)
+			}
+			log.Printf("Strict templates: a missing key fails the page")
+			router.HTMLRender = strict
+		} else {
+			router.LoadHTMLGlob(templatePattern)
+		}
 	}
 
 	// Health check endpoint (define this early)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":           "healthy",
-			"service":          "tornado-nginx-go-backend",
-			"storage":          handler.Config.StorageBackend,
-			"templates_loaded": len(files),
-		})
-	})
+	handler.Health.TemplatesLoaded = len(files)
+	router.GET("/health", handler.Health.HandleHealth)
+	router.GET("/health/live", handler.Health.HandleLive)
+	router.GET("/health/ready", handler.Health.HandleReady)
+
+	// Admin routes, reachable only from trusted networks and only by
+	// signed-in users holding the admin entitlement
+	allow, err := middleware.ParseCIDRs(handler.Config.AdminAllowCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_ALLOW_CIDRS: %v", err)
+	}
+	deny, err := middleware.ParseCIDRs(handler.Config.AdminDenyCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_DENY_CIDRS: %v", err)
+	}
+	admin := router.Group("/admin",
+		middleware.IPFilter(allow, deny),
+		middleware.AuthRequired(handler.Auth.ValidSession),
+		middleware.RequireEntitlement(auth.EntitlementAdmin, handler.Auth.CheckEntitlement))
+	{
+		admin.GET("/settings/:key", handler.Admin.HandleGetSetting)
+		admin.GET("/users/:email/entitlements", handler.Admin.HandleGetEntitlements)
+		admin.PUT("/users/:email/entitlements", handler.Admin.HandleSetEntitlements)
+		admin.POST("/users/purge-unconfirmed", handler.Admin.HandlePurgeUnconfirmed)
+		admin.DELETE("/users/:email", handler.Admin.HandleDeleteUser)
+		admin.POST("/users/:email/restore", handler.Admin.HandleRestoreUser)
+		admin.POST("/trash/purge", handler.Admin.HandlePurgeTrash)
+		admin.GET("/ratelimit", handler.Admin.HandleRateLimitStats)
+		admin.GET("/counters", handler.Admin.HandleCounters)
+		admin.GET("/samples", handler.Admin.HandleRequestSamples)
+		admin.GET("/email/preview", handler.Admin.HandleEmailPreview)
+	}
+
+	// Prometheus scrape endpoint, reachable from the same networks as /admin
+	router.GET("/metrics", middleware.IPFilter(allow, deny), gin.WrapH(metrics.Default))
 
 	// API routes
 	api := router.Group("/")
 	{
 		// Home route - matches Flask behavior exactly
 		api.GET("/", func(c *gin.Context) {
-			user := getCurrentUser(c)
+			user := handler.Auth.CurrentUser(c)
 			if user == "" {
 				c.Redirect(http.StatusFound, "/login")
 			} else {
@@ -114,60 +290,151 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 			}
 		})
 
-		// Authentication routes
-		api.POST("/iauth", handler.Auth.HandleAuth)
+		// Authentication routes, with their own stricter rate limit
+		authLimit := func(c *gin.Context) { c.Next() }
+		if cfg := handler.Config; cfg.AuthRateLimitRPS > 0 {
+			authLimit = middleware.RateLimitWithOptions(cfg.AuthRateLimitRPS, cfg.AuthRateLimitBurst, middleware.RateLimitOptions{
+				TrustForwardedFor: cfg.AuthRateLimitTrustForwardedFor,
+			})
+		}
+		api.POST("/iauth", authLimit, handler.Auth.HandleAuth)
 		api.GET("/login", handler.Auth.HandleLoginGet)
-		api.POST("/login", handler.Auth.HandleLogin)
+		api.POST("/login", authLimit, handler.Auth.HandleLogin)
+		api.GET("/reauth", handler.Auth.HandleReauthGet)
 		api.GET("/register", handler.Auth.HandleRegisterGet)
-		api.POST("/register", handler.Auth.HandleRegister)
+		api.POST("/register", authLimit, handler.Auth.HandleRegister)
 		api.GET("/logout", handler.Auth.HandleLogout)
 		api.POST("/logout", handler.Auth.HandleLogout)
+		api.GET("/confirm", handler.Auth.HandleConfirm)
 		api.GET("/pwreset", handler.Auth.HandlePasswordResetGet)
 		api.POST("/pwreset", handler.Auth.HandlePasswordResetPost)
-		api.GET("/lostpw", handler.Auth.HandleLostPassword)
-		api.POST("/lostpw", handler.Auth.HandleLostPassword)
-
-		// NEW FLASK-COMPATIBLE ROUTES
-		api.GET("/save", handler.WebApp.HandleSave)
-		api.POST("/save", handler.WebApp.HandleSave)
-		api.POST("/usersheet", handler.WebApp.HandleUserSheet)
-		api.GET("/import", handler.WebApp.HandleImportGet)
-		api.POST("/import", handler.WebApp.HandleImportPost)
-		api.POST("/downloadfile", handler.WebApp.HandleDownloadFile)
-		api.GET("/htmltopdf", handler.WebApp.HandleHTMLToPDFGet)
-		api.POST("/htmltopdf", handler.WebApp.HandleHTMLToPDFPost)
+		api.GET("/lostpw", handler.Auth.HandleLostPasswordGet)
+		api.POST("/lostpw", handler.Auth.HandleLostPasswordPost)
+
+		// Profile routes need a current, unrevoked session; recently
+		// expired ones are sent to /reauth first
+		profile := api.Group("/profile",
+			middleware.SessionGrace(handler.Config.SessionGracePeriod, "/reauth"),
+			middleware.AuthRequired(handler.Auth.ValidSession))
+		profile.POST("/mfa/enroll", handler.Auth.HandleMFAEnroll)
+		profile.POST("/mfa/verify", handler.Auth.HandleMFAVerify)
+		profile.POST("/mfa/disable", handler.Auth.HandleMFADisable)
+		profile.POST("/apikeys", handler.Auth.HandleAPIKeyCreate)
+		profile.POST("/apikeys/rotate", handler.Auth.HandleAPIKeysRotate)
+		profile.POST("/delete", handler.Auth.HandleAccountDelete)
+		profile.POST("/login-alerts", handler.Auth.HandleLoginAlerts)
+
+		// NEW FLASK-COMPATIBLE ROUTES. Every route acting as the session's
+		// user is behind signedIn, so revoked sessions are refused everywhere
+		signedIn := middleware.RequireAuth(handler.Auth.ValidSession)
+		uploadBody := middleware.BodyLimit(int64(handler.Config.UploadMaxSize))
+		sheetBody := middleware.BodyLimit(sheetBodyLimit(handler.Config))
+		api.GET("/save", signedIn, handler.WebApp.HandleSaveGet)
+		api.POST("/save", sheetBody, signedIn, handler.WebApp.HandleSavePost)
+		api.POST("/save/validate", sheetBody, signedIn, handler.WebApp.HandleSaveValidate)
+		api.PATCH("/save/:id", sheetBody, signedIn, handler.WebApp.HandleSavePatch)
+		api.GET("/api/me", signedIn, handler.Auth.HandleMe)
+		api.GET("/api/sheets", signedIn, handler.WebApp.HandleSheetsList)
+		api.POST("/api/sheets/delete", signedIn, handler.WebApp.HandleSheetsDelete)
+		api.GET("/api/sheets/:name/collaborators", signedIn, handler.WebApp.HandleCollaboratorsList)
+		api.POST("/api/sheets/:name/collaborators", signedIn, handler.WebApp.HandleCollaboratorAdd)
+		api.GET("/api/sheets/:name/thumbnail", signedIn, handler.WebApp.HandleSheetThumbnail)
+		api.GET("/api/sheets/:name/versions", signedIn, handler.WebApp.HandleVersionsList)
+		api.POST("/api/sheets/:name/versions/:id/restore", signedIn, handler.WebApp.HandleVersionRestore)
+		api.DELETE("/api/sheets/:name/collaborators/:email", signedIn, handler.WebApp.HandleCollaboratorRemove)
+		api.GET("/api/trash", signedIn, handler.WebApp.HandleTrashList)
+		api.POST("/api/trash/:id/restore", signedIn, handler.WebApp.HandleTrashRestore)
+		api.POST("/usersheet", signedIn, handler.WebApp.HandleUserSheet)
+		// Uploads share a concurrency cap so many large bodies can't pile
+		// up in memory at once
+		uploadSlots := middleware.ConcurrencyLimit(handler.Config.UploadConcurrency)
+		api.GET("/import", signedIn, handler.WebApp.HandleImportGet)
+		api.POST("/import", uploadBody, signedIn, uploadSlots, handler.WebApp.HandleImportPost)
+		api.POST("/downloadfile", signedIn, handler.WebApp.HandleDownloadFile)
+		api.GET("/export/csv", signedIn, handler.WebApp.HandleExportCSV)
+		api.GET("/export/xlsx", signedIn, handler.WebApp.HandleExportXLSX)
+		api.POST("/api/downloadlinks", signedIn, handler.WebApp.HandleDownloadLinkCreate)
+		api.GET("/d/:token", handler.WebApp.HandleDownloadLink)
+		api.GET("/htmltopdf", signedIn, handler.WebApp.HandleHTMLToPDFGet)
+		api.POST("/htmltopdf", uploadBody, signedIn, middleware.RequireEntitlement(auth.EntitlementPDFExport, handler.Auth.CheckEntitlement), uploadSlots, handler.WebApp.HandleHTMLToPDFPost)
 
 		// Existing web app routes
-		api.POST("/iwebapp", handler.WebApp.HandleWebApp)
+		api.POST("/iwebapp", sheetBody, signedIn, handler.WebApp.HandleWebApp)
 
 		// Email routes
-		api.POST("/irunasemailer", handler.Email.HandleRunAsEmail)
+		api.POST("/irunasemailer", sheetBody, handler.Email.HandleRunAsEmail)
 
 		// Browser/app routes (existing)
 		api.GET("/browser", handler.App.HandleLanding)
 		api.GET("/browser/:param1/:paramCode/:param2", handler.App.HandleAmazonWebApp)
-		api.GET("/browser/:param1/dropbox", handler.Dropbox.HandleDropboxGet)
-		api.POST("/browser/:param1/dropbox", handler.Dropbox.HandleDropboxPost)
+		dropboxSync := middleware.RequireEntitlement(auth.EntitlementDropboxSync, handler.Auth.CheckEntitlement)
+		api.GET("/browser/:param1/dropbox", signedIn, dropboxSync, handler.Dropbox.HandleDropboxGet)
+		api.POST("/browser/:param1/dropbox", sheetBody, signedIn, dropboxSync, handler.Dropbox.HandleDropboxPost)
 		api.GET("/browser/static/*filepath", handler.App.HandleGoogleVerification)
 	}
 }
 
-// Helper function to get current user from cookie
-func getCurrentUser(c *gin.Context) string {
-	userCookie, err := c.Cookie("user")
+// sheetBodyLimit is the largest body taken by routes that carry a whole
+// sheet: MAX_SHEET_SIZE once form-encoded, which can triple it, with room
+// for the other fields, or MAX_BODY_SIZE if that is larger
+func sheetBodyLimit(cfg *config.Config) int64 {
+	limit := int64(cfg.MaxBodySize)
+	if cfg.MaxSheetSize <= 0 {
+		return limit
+	}
+	if encoded := 3*int64(cfg.MaxSheetSize) + 64<<10; encoded > limit && limit > 0 {
+		return encoded
+	}
+	return limit
+}
+
+// serverTimingAllowed reports timings to everyone outside production, and
+// in production only to clients allowed to reach /admin
+func serverTimingAllowed(cfg *config.Config) func(c *gin.Context) bool {
+	if cfg.Environment != "production" {
+		return func(c *gin.Context) bool { return true }
+	}
+	allow, err := middleware.ParseCIDRs(cfg.AdminAllowCIDRs)
 	if err != nil {
-		return ""
+		log.Fatalf("Invalid ADMIN_ALLOW_CIDRS: %v", err)
 	}
-	// Handle both JSON format and plain text format
-	if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-		// JSON format
-		var user string
-		err = json.Unmarshal([]byte(userCookie), &user)
-		if err != nil {
-			return ""
-		}
-		return user
+	deny, err := middleware.ParseCIDRs(cfg.AdminDenyCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_DENY_CIDRS: %v", err)
+	}
+	return func(c *gin.Context) bool {
+		return middleware.IPAllowed(c, allow, deny)
+	}
+}
+
+// warmup readies storage and templates before the server takes traffic.
+// Failures are logged rather than fatal; requests will retry lazily.
+func warmup(cfg *config.Config, handler *handlers.Handler) {
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := storage.Warmup(ctx, handler.Storage, cfg.WarmupConnections); err != nil {
+		log.Printf("Warm-up: storage not ready: %v", err)
+	}
+
+	// In debug mode gin re-parses templates per request, so parse them once
+	// here to surface errors and prime the OS file cache
+	if _, err := template.ParseGlob(filepath.Join(cfg.TemplatesPath, "*")); err != nil {
+		log.Printf("Warm-up: failed to parse templates: %v", err)
+	}
+
+	log.Printf("Warm-up completed in %s", time.Since(start))
+}
+
+// pdfSelfTest renders a test page so a broken PDF engine shows up in the
+// startup log, and in readiness when PDF_SELF_TEST_REQUIRED is set
+func pdfSelfTest(handler *handlers.Handler) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := handler.CheckPDFEngine(ctx); err != nil {
+		log.Printf("PDF self-test failed: %v", err)
+		return
 	}
-	// Plain text format
-	return userCookie
+	log.Println("PDF self-test passed")
 }
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// apiKeyPrefix marks API keys so they are recognisable in logs and scanners
+const apiKeyPrefix = "tck_"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// IssueAPIKey creates a new API key for the user and returns it. Only its
+// hash is stored, so this is the one time the key can be shown.
+func (s *Service) IssueAPIKey(email string) (string, error) {
+	var key string
+	err := s.updateUser(email, func(user *models.User) (err error) {
+		key, err = addAPIKey(user)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// RotateAPIKeys revokes every API key the user has and, when issue is set,
+// creates a replacement in the same write. It returns the new key, if any,
+// and how many keys were revoked. Keys are checked against the stored user
+// on every request, so revoked keys stop working immediately, and the write
+// goes through updateUser so a concurrent change to the record can't bring
+// them back.
+func (s *Service) RotateAPIKeys(email string, issue bool) (string, int, error) {
+	var key string
+	var revoked int
+	err := s.updateUser(email, func(user *models.User) (err error) {
+		revoked, key = len(user.APIKeys), ""
+		user.APIKeys = nil
+		if issue {
+			key, err = addAPIKey(user)
+		}
+		return err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return key, revoked, nil
+}
+
+// AuthenticateAPIKey returns the user key belongs to, or ErrInvalidAPIKey
+func (s *Service) AuthenticateAPIKey(key string) (string, error) {
+	email, secret, ok := parseAPIKey(key)
+	if !ok {
+		return "", ErrInvalidAPIKey
+	}
+	user, err := s.GetUser(email)
+	if err != nil {
+		return "", ErrInvalidAPIKey
+	}
+
+	hash := hashAPIKeySecret(secret)
+	for _, stored := range user.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hash)) == 1 {
+			return user.Email, nil
+		}
+	}
+	return "", ErrInvalidAPIKey
+}
+
+// addAPIKey generates a key for user and records its hash. The key embeds
+// the owner's email so it can be checked without an index of all keys.
+func addAPIKey(user *models.User) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+
+	user.APIKeys = append(user.APIKeys, models.APIKey{
+		ID:        secret[:8],
+		Hash:      hashAPIKeySecret(secret),
+		CreatedAt: time.Now(),
+	})
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString([]byte(user.Email)) + "." + secret, nil
+}
+
+func parseAPIKey(key string) (email, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	encoded, secret, found := strings.Cut(rest, ".")
+	if !found || secret == "" {
+		return "", "", false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) == 0 {
+		return "", "", false
+	}
+	return string(decoded), secret, true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
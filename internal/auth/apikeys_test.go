@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newAPIKeyService(t *testing.T) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func TestIssueAPIKey(t *testing.T) {
+	service := newAPIKeyService(t)
+
+	key, err := service.IssueAPIKey("test@example.com")
+	if err != nil {
+		t.Fatalf("IssueAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("key %q lacks the %s prefix", key, apiKeyPrefix)
+	}
+	if user, err := service.AuthenticateAPIKey(key); err != nil || user != "test@example.com" {
+		t.Errorf("AuthenticateAPIKey = %q, %v; want test@example.com", user, err)
+	}
+
+	stored, _ := service.GetUser("test@example.com")
+	if len(stored.APIKeys) != 1 || strings.Contains(key, stored.APIKeys[0].Hash) {
+		t.Errorf("expected one hashed key, got %+v", stored.APIKeys)
+	}
+}
+
+func TestAuthenticateAPIKeyRejectsForgeries(t *testing.T) {
+	service := newAPIKeyService(t)
+	key, _ := service.IssueAPIKey("test@example.com")
+	tampered := []byte(key)
+	tampered[len(tampered)-1] ^= 1
+
+	for _, forged := range []string{
+		"",
+		"not-a-key",
+		string(tampered),
+		strings.Replace(key, apiKeyPrefix, "xyz_", 1),
+	} {
+		if _, err := service.AuthenticateAPIKey(forged); err != ErrInvalidAPIKey {
+			t.Errorf("AuthenticateAPIKey(%q) = %v, want ErrInvalidAPIKey", forged, err)
+		}
+	}
+}
+
+func TestRotateAPIKeysRevokesAll(t *testing.T) {
+	service := newAPIKeyService(t)
+	first, _ := service.IssueAPIKey("test@example.com")
+	second, _ := service.IssueAPIKey("test@example.com")
+
+	fresh, revoked, err := service.RotateAPIKeys("test@example.com", true)
+	if err != nil {
+		t.Fatalf("RotateAPIKeys failed: %v", err)
+	}
+	if revoked != 2 {
+		t.Errorf("revoked %d keys, want 2", revoked)
+	}
+	for _, old := range []string{first, second} {
+		if _, err := service.AuthenticateAPIKey(old); err != ErrInvalidAPIKey {
+			t.Errorf("old key still valid after rotation: %v", err)
+		}
+	}
+	if _, err := service.AuthenticateAPIKey(fresh); err != nil {
+		t.Errorf("new key rejected: %v", err)
+	}
+
+	none, revoked, err := service.RotateAPIKeys("test@example.com", false)
+	if err != nil || none != "" || revoked != 1 {
+		t.Errorf("RotateAPIKeys without issue = %q, %d, %v; want no key and 1 revoked", none, revoked, err)
+	}
+}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
@@ -14,22 +16,66 @@ const (
 )
 
 type Service struct {
-	storage storage.Storage
+	storage  storage.Storage
+	ctx      context.Context // for every storage call, see WithContext
+	notifier LoginNotifier
+	mfaKey   string
+
+	revokeOnPasswordChange bool
+	idempotentCreate       bool
+	defaultEntitlements    []string
+	admins                 []string
+	resetTokenTTL          time.Duration
+	lockoutAttempts        int
+	lockoutCooldown        time.Duration
+	softDelete             bool
+	deletionReasonLimit    int
+	requireConfirmation    bool
+	passwordHistory        int
+	confirmTokenTTL        time.Duration
+
+	now func() time.Time
 }
 
 func NewService(storage storage.Storage) *Service {
 	return &Service{
 		storage: storage,
+		ctx:     context.Background(),
+		now:     time.Now,
+
+		lockoutAttempts: DefaultLockoutAttempts,
+		lockoutCooldown: DefaultLockoutCooldown,
+		passwordHistory: models.DefaultPasswordHistory,
 	}
 }
 
+// WithStorage returns a copy of the service, with the same settings, that
+// keeps its users in st. It lets one configured service serve tenants with
+// their own storage backends.
+func (s *Service) WithStorage(st storage.Storage) *Service {
+	clone := *s
+	clone.storage = st
+	return &clone
+}
+
+// WithContext returns a copy of the service whose storage calls are made
+// with ctx, so they give up once it is cancelled or past its deadline.
+// Handlers bind each request's context this way.
+func (s *Service) WithContext(ctx context.Context) *Service {
+	clone := *s
+	clone.ctx = ctx
+	return &clone
+}
+
+// getUserPath is where email's record lives. Every lookup goes through it,
+// so addresses differing only in case resolve to the same user.
 func (s *Service) getUserPath(email string) []string {
-	return []string{"home", UserDir, email}
+	return []string{"home", UserDir, NormalizeEmail(email)}
 }
 
 func (s *Service) UserExists(email string) (bool, error) {
     path := s.getUserPath(email)
-    item, err := s.storage.GetFile(path)
+    item, err := s.storage.GetFile(s.ctx, path)
     if err != nil {
         if err == storage.ErrNotFound {
             return false, nil
@@ -41,7 +87,7 @@ func (s *Service) UserExists(email string) (bool, error) {
 
 func (s *Service) GetUser(email string) (*models.User, error) {
 	path := s.getUserPath(email)
-	item, err := s.storage.GetFile(path)
+	item, err := s.storage.GetFile(s.ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -49,13 +95,8 @@ func (s *Service) GetUser(email string) (*models.User, error) {
 		return nil, fmt.Errorf("user not found")
 	}
 
-	// Convert the data to string and then parse as User
-	dataStr, ok := item.Data.(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid user data format")
-	}
-
-	user, err := models.UserFromJSON(dataStr)
+	// Backends differ in how they hand back the record, so normalize first
+	user, err := models.UserFromData(item.Data)
 	if err != nil {
 		return nil, err
 	}
@@ -64,30 +105,36 @@ func (s *Service) GetUser(email string) (*models.User, error) {
 }
 
 func (s *Service) CreateUser(email, password string) error {
+    email = NormalizeEmail(email)
+
     // First check if user already exists
     exists, err := s.UserExists(email)
     if err != nil {
         return fmt.Errorf("error checking user existence: %w", err)
     }
     if exists {
-        return fmt.Errorf("user already exists")
+        return s.existingUser(email, password)
     }
 
     user, err := models.NewUser(email, password)
     if err != nil {
         return fmt.Errorf("error creating user model: %w", err)
     }
+    if s.requireConfirmation {
+        user.Confirmed = false
+        user.ConfirmBy = s.now().Add(s.confirmationTTL())
+    }
 
     // Ensure the root home directory exists
     homeDir := []string{"home"}
-    err = s.storage.CreateDir(homeDir)
+    err = s.storage.CreateDir(s.ctx, homeDir)
     if err != nil {
         return fmt.Errorf("error creating home directory: %w", err)
     }
 
     // Ensure parent directory exists
     parentPath := []string{"home", UserDir}
-    err = s.storage.CreateDir(parentPath)
+    err = s.storage.CreateDir(s.ctx, parentPath)
     if err != nil {
         return fmt.Errorf("error creating users directory: %w", err)
     }
@@ -98,34 +145,115 @@ func (s *Service) CreateUser(email, password string) error {
         return fmt.Errorf("error serializing user data: %w", err)
     }
 
-    return s.storage.CreateFile(path, userData)
+    if err := s.storage.CreateFile(s.ctx, path, userData); err != nil {
+        // A concurrent attempt at the same registration may have won
+        if exists, _ := s.UserExists(email); exists {
+            return s.existingUser(email, password)
+        }
+        return err
+    }
+    return nil
+}
+
+// ErrUserExists is returned by CreateUser for an email that is already
+// registered
+var ErrUserExists = errors.New("user already exists")
+
+// SetIdempotentCreate controls whether CreateUser succeeds for a user that
+// already exists with the same password, so a registration retried after a
+// lost response doesn't fail. The stored hash is salted, so the password is
+// compared rather than the record.
+func (s *Service) SetIdempotentCreate(enabled bool) {
+	s.idempotentCreate = enabled
+}
+
+// IdempotentCreate reports whether SetIdempotentCreate enabled retries
+func (s *Service) IdempotentCreate() bool {
+	return s.idempotentCreate
+}
+
+// existingUser decides the outcome of creating a user that already exists.
+// The password goes through AuthenticateUser, so guesses made by
+// re-registering count toward the lockout like failed logins do. A right
+// password for an account with TOTP succeeds here too; callers that sign
+// the user in must still ask for the second factor.
+func (s *Service) existingUser(email, password string) error {
+	if !s.idempotentCreate {
+		return ErrUserExists
+	}
+	ok, err := s.AuthenticateUser(email, password)
+	if errors.Is(err, ErrTOTPRequired) {
+		return nil
+	}
+	if errors.Is(err, ErrAccountLocked) {
+		return err
+	}
+	if err != nil || !ok {
+		return fmt.Errorf("%w: %w", ErrUserExists, storage.ErrConflict)
+	}
+	return nil
 }
 
 func (s *Service) AuthenticateUser(email, password string) (bool, error) {
 	user, err := s.GetUser(email)
 	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			LoginOutcomes.Inc(OutcomeUnknownUser)
+		} else {
+			LoginOutcomes.Inc(OutcomeError)
+		}
 		return false, err
 	}
 
 	if !user.GetConfirmed() {
+		LoginOutcomes.Inc(OutcomeUnconfirmed)
 		return false, fmt.Errorf("user not confirmed")
 	}
 
-	return user.Authenticate(password), nil
-}
-
-func (s *Service) UpdatePassword(email, newPassword string) error {
-	user, err := s.GetUser(email)
-	if err != nil {
-		return err
+	if user.LockedUntil.After(s.now()) {
+		LoginOutcomes.Inc(OutcomeLockedOut)
+		return false, ErrAccountLocked
 	}
 
-	err = user.SetPassword(newPassword)
-	if err != nil {
-		return err
+	if !user.Authenticate(password) {
+		LoginOutcomes.Inc(OutcomeWrongPassword)
+		return false, s.recordFailedLogin(email)
+	}
+	// Failed logins are only forgotten once the second factor passes too,
+	// so knowing the password doesn't buy more guesses at the code
+	if user.TOTPEnabled {
+		LoginOutcomes.Inc(OutcomeTOTPRequired)
+		return false, ErrTOTPRequired
+	}
+	LoginOutcomes.Inc(OutcomeSuccess)
+	if err := s.clearFailedLogins(email); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	return s.setUser(user)
+// SetPasswordHistory sets how many recent passwords, the current one
+// included, UpdatePassword refuses to set again; zero disables the check
+func (s *Service) SetPasswordHistory(n int) {
+	s.passwordHistory = n
+}
+
+// UpdatePassword sets email's password, bumping the token version to log
+// out older sessions when that's on. The record is written through
+// updateUser, so a concurrent write such as a failed login can't undo the
+// bump.
+func (s *Service) UpdatePassword(email, newPassword string) error {
+	return s.updateUser(email, func(user *models.User) error {
+		// The password being replaced counts among the recent ones
+		user.RememberPassword(s.passwordHistory)
+		if err := user.SetPassword(newPassword); err != nil {
+			return err
+		}
+		if s.revokeOnPasswordChange {
+			user.TokenVersion++
+		}
+		return nil
+	})
 }
 
 func (s *Service) SetUserDongle(email, dongle string) error {
@@ -157,17 +285,45 @@ func (s *Service) ConfirmUser(email string) error {
 	return s.setUser(user)
 }
 
-func (s *Service) DeleteUser(email string) error {
-	exists, err := s.UserExists(email)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return fmt.Errorf("user does not exist")
-	}
+// maxUserUpdateAttempts bounds how often updateUser rereads a record that
+// keeps changing under it
+const maxUserUpdateAttempts = 5
+
+// errUnchanged is returned by an updateUser callback that found nothing to
+// change, so nothing is written
+var errUnchanged = errors.New("user unchanged")
 
+// updateUser applies update to email's record and writes it back only if
+// no one else wrote the record in between, rereading it and applying update
+// again when they did, so concurrent changes such as failed login counts
+// aren't lost. An error from update is returned without writing anything,
+// except errUnchanged, which just skips the write.
+func (s *Service) updateUser(email string, update func(user *models.User) error) error {
 	path := s.getUserPath(email)
-	return s.storage.DeleteFile(path)
+	for attempt := 1; ; attempt++ {
+		item, version, err := storage.GetFileVersion(s.ctx, s.storage, path)
+		if err != nil {
+			return err
+		}
+		user, err := models.UserFromData(item.Data)
+		if err != nil {
+			return err
+		}
+		if err := update(user); errors.Is(err, errUnchanged) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		userData, err := user.ToJSON()
+		if err != nil {
+			return err
+		}
+		_, err = storage.UpdateFileCAS(s.ctx, s.storage, path, version, userData)
+		if errors.Is(err, storage.ErrVersionConflict) && attempt < maxUserUpdateAttempts {
+			continue
+		}
+		return err
+	}
 }
 
 func (s *Service) setUser(user *models.User) error {
@@ -177,10 +333,5 @@ func (s *Service) setUser(user *models.User) error {
 		return err
 	}
 
-	return s.storage.UpdateFile(path, userData)
+	return s.storage.UpdateFile(s.ctx, path, userData)
 }
-
-// ValidateEmail performs basic email validation
-func ValidateEmail(email string) bool {
-	return strings.Contains(email, "@") && len(email) > 3
-}
\ No newline at end of file
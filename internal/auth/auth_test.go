@@ -1,108 +1,42 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
-// MockStorage implements the Storage interface for testing
-type MockStorage struct {
+// decodedStorage serves files as a driver hands them back, with Data
+// already decoded, which a round trip through MemoryStorage's JSON would
+// flatten
+type decodedStorage struct {
+	*storage.MemoryStorage
 	files map[string]*models.StorageItem
 }
 
-func NewMockStorage() *MockStorage {
-	return &MockStorage{
-		files: make(map[string]*models.StorageItem),
-	}
-}
-
-func (m *MockStorage) pathToString(path []string) string {
-	result := ""
-	for i, part := range path {
-		if i > 0 {
-			result += "/"
-		}
-		result += part
-	}
-	return result
-}
-
-func (m *MockStorage) CreateFile(path []string, data string) error {
-	key := m.pathToString(path)
-	m.files[key] = models.NewStorageItem(path, "file", data)
-	return nil
-}
-
-func (m *MockStorage) GetFile(path []string) (*models.StorageItem, error) {
-	key := m.pathToString(path)
-	item, exists := m.files[key]
-	if !exists {
-		return nil, storage.ErrNotFound
-	}
-	return item, nil
-}
-
-func (m *MockStorage) UpdateFile(path []string, data string) error {
-	key := m.pathToString(path)
-	if _, exists := m.files[key]; !exists {
-		return storage.ErrNotFound
-	}
-	m.files[key] = models.NewStorageItem(path, "file", data)
-	return nil
+func newDecodedStorage() *decodedStorage {
+	return &decodedStorage{storage.NewMemoryStorage(), make(map[string]*models.StorageItem)}
 }
 
-func (m *MockStorage) DeleteFile(path []string) error {
-	key := m.pathToString(path)
-	if _, exists := m.files[key]; !exists {
-		return storage.ErrNotFound
+func (d *decodedStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	if item, ok := d.files[strings.Join(path, "/")]; ok {
+		return item, nil
 	}
-	delete(m.files, key)
-	return nil
-}
-
-func (m *MockStorage) CreateDir(path []string) error {
-	key := m.pathToString(path)
-	m.files[key] = models.NewStorageItem(path, "dir", []string{})
-	return nil
-}
-
-func (m *MockStorage) DeleteDir(path []string) error {
-	key := m.pathToString(path)
-	if _, exists := m.files[key]; !exists {
-		return storage.ErrNotFound
-	}
-	delete(m.files, key)
-	return nil
-}
-
-func (m *MockStorage) PutItem(path string, data string, bucket ...string) error {
-	// Not implemented for mock
-	return nil
-}
-
-func (m *MockStorage) GetItem(path string, bucket ...string) (string, error) {
-	// Not implemented for mock
-	return "", nil
-}
-
-func (m *MockStorage) ExistsItem(path string, bucket ...string) (bool, error) {
-	// Not implemented for mock
-	return false, nil
-}
-
-func (m *MockStorage) DeleteItem(path string, bucket ...string) error {
-	// Not implemented for mock
-	return nil
+	return d.MemoryStorage.GetFile(ctx, path)
 }
 
 func TestCreateUser(t *testing.T) {
-	mockStorage := NewMockStorage()
+	mockStorage := storage.NewMemoryStorage()
 	service := NewService(mockStorage)
 
 	// Create user directory first
-	err := mockStorage.CreateDir([]string{"home", UserDir})
+	err := mockStorage.CreateDir(context.Background(), []string{"home", UserDir})
 	if err != nil {
 		t.Fatalf("Failed to create user directory: %v", err)
 	}
@@ -125,12 +59,34 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestWithContextBindsStorageCalls(t *testing.T) {
+	mockStorage := storage.NewMemoryStorage()
+	service := NewService(mockStorage)
+	if err := mockStorage.CreateDir(context.Background(), []string{"home", UserDir}); err != nil {
+		t.Fatalf("Failed to create user directory: %v", err)
+	}
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := service.WithContext(ctx).GetUser("test@example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetUser with a cancelled context: err = %v, want context.Canceled", err)
+	}
+
+	// The original service keeps its own context
+	if _, err := service.GetUser("test@example.com"); err != nil {
+		t.Errorf("GetUser on the original service failed: %v", err)
+	}
+}
+
 func TestAuthenticateUser(t *testing.T) {
-	mockStorage := NewMockStorage()
+	mockStorage := storage.NewMemoryStorage()
 	service := NewService(mockStorage)
 
 	// Create user directory first
-	err := mockStorage.CreateDir([]string{"home", UserDir})
+	err := mockStorage.CreateDir(context.Background(), []string{"home", UserDir})
 	if err != nil {
 		t.Fatalf("Failed to create user directory: %v", err)
 	}
@@ -170,11 +126,42 @@ func TestValidateEmail(t *testing.T) {
 	}{
 		{"test@example.com", true},
 		{"user@domain.org", true},
+		{"user+tag@example.com", true},
+		{"first.last@example.com", true},
+		{"user@mail.example.co.uk", true},
+		{"user_name-1@sub-domain.example.io", true},
+		{"x@example.museum", true},
+		{"User@EXAMPLE.com ", true}, // domain case and surrounding space ignored
+		{"  user@example.com", true},
+		{"o'brien@example.ie", true},
 		{"invalid.email", false},
 		{"@domain.com", false},
 		{"user@", false},
 		{"", false},
-		{"a@b", true}, // minimal valid email
+		{"   ", false},
+		{"a@b", false}, // no TLD
+		{"@@@x", false},
+		{"user@example", false},
+		{"user@example.c", false},
+		{"user@example.123", false},
+		{"first..last@example.com", false},
+		{".user@example.com", false},
+		{"user.@example.com", false},
+		{"user@example..com", false},
+		{"user@.example.com", false},
+		{"user@-example.com", false},
+		{"user@example-.com", false},
+		{"user @example.com", false},
+		{"user@ example.com", false},
+		{"us er@example.com", false},
+		{"user@exa mple.com", false},
+		{"Bob <bob@example.com>", false},
+		{`"john doe"@example.com`, false},
+		{"user@exam_ple.com", false},
+		{"user@@example.com", false},
+		{strings.Repeat("a", 65) + "@example.com", false},
+		{"user@" + strings.Repeat("a", 64) + ".com", false},
+		{"user@" + strings.Repeat("a.", 125) + "com", false}, // over 254 characters
 	}
 
 	for _, test := range tests {
@@ -186,11 +173,11 @@ func TestValidateEmail(t *testing.T) {
 }
 
 func TestUpdatePassword(t *testing.T) {
-	mockStorage := NewMockStorage()
+	mockStorage := storage.NewMemoryStorage()
 	service := NewService(mockStorage)
 
 	// Create user directory first
-	err := mockStorage.CreateDir([]string{"home", UserDir})
+	err := mockStorage.CreateDir(context.Background(), []string{"home", UserDir})
 	if err != nil {
 		t.Fatalf("Failed to create user directory: %v", err)
 	}
@@ -228,4 +215,193 @@ func TestUpdatePassword(t *testing.T) {
 	if !authenticated {
 		t.Error("Authentication should succeed with new password")
 	}
-}
\ No newline at end of file
+}
+func TestGetUserAcceptsBackendRepresentations(t *testing.T) {
+	email := "test@example.com"
+	user, err := models.NewUser(email, "testpassword")
+	if err != nil {
+		t.Fatalf("NewUser failed: %v", err)
+	}
+	userJSON, err := user.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+
+	var asMap map[string]interface{}
+	if err := json.Unmarshal([]byte(userJSON), &asMap); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	representations := map[string]interface{}{
+		"string": userJSON,
+		"bytes":  []byte(userJSON),
+		"map":    asMap,
+		"bson.M": bson.M(asMap),
+	}
+
+	for name, data := range representations {
+		t.Run(name, func(t *testing.T) {
+			mockStorage := newDecodedStorage()
+			service := NewService(mockStorage)
+			path := []string{"home", UserDir, email}
+			mockStorage.files[strings.Join(path, "/")] = models.NewStorageItem(path, "file", data)
+
+			got, err := service.GetUser(email)
+			if err != nil {
+				t.Fatalf("GetUser failed: %v", err)
+			}
+			if got.Email != email {
+				t.Errorf("GetUser email = %q, want %q", got.Email, email)
+			}
+
+			authenticated, err := service.AuthenticateUser(email, "testpassword")
+			if err != nil {
+				t.Fatalf("AuthenticateUser failed: %v", err)
+			}
+			if !authenticated {
+				t.Error("Authentication should succeed regardless of record representation")
+			}
+		})
+	}
+}
+
+func TestGetUserRejectsUnknownRepresentation(t *testing.T) {
+	mockStorage := newDecodedStorage()
+	service := NewService(mockStorage)
+	path := []string{"home", UserDir, "test@example.com"}
+	mockStorage.files[strings.Join(path, "/")] = models.NewStorageItem(path, "file", 42)
+
+	if _, err := service.GetUser("test@example.com"); err == nil {
+		t.Error("GetUser should fail for a record that is not a user document")
+	}
+}
+
+func TestCreateUserIdempotentRetry(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetIdempotentCreate(true)
+
+	if err := service.CreateUser("retry@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.CreateUser("retry@example.com", "password123"); err != nil {
+		t.Errorf("identical retry should succeed, got %v", err)
+	}
+	if err := service.CreateUser("retry@example.com", "otherpassword"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("create with a different password: err = %v, want ErrConflict", err)
+	}
+
+	ok, err := service.AuthenticateUser("retry@example.com", "password123")
+	if err != nil || !ok {
+		t.Errorf("a conflicting create must not replace the user (ok=%v, err=%v)", ok, err)
+	}
+}
+
+func TestCreateUserNotIdempotentByDefault(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	if err := service.CreateUser("retry@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.CreateUser("retry@example.com", "password123"); err == nil {
+		t.Error("expected an error re-creating an existing user")
+	}
+}
+
+func TestEmailCaseInsensitive(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	if err := service.CreateUser("Foo@Bar.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	ok, err := service.AuthenticateUser("foo@bar.com", "password123")
+	if err != nil || !ok {
+		t.Fatalf("login with different casing: ok=%v, err=%v", ok, err)
+	}
+	user, err := service.GetUser("FOO@BAR.COM")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if user.Email != "foo@bar.com" {
+		t.Errorf("stored email = %q, want it normalized", user.Email)
+	}
+	if err := service.CreateUser("foo@bar.com", "password123"); err == nil {
+		t.Error("registering the same address in another case should fail")
+	}
+
+	if err := service.SetUserDongle("FOO@bar.com", "dongle"); err != nil {
+		t.Fatalf("SetUserDongle failed: %v", err)
+	}
+	if dongle, _ := service.GetUserDongle("foo@BAR.com"); dongle != "dongle" {
+		t.Errorf("dongle = %q, want it shared across casings", dongle)
+	}
+	if err := service.DeleteUser("Foo@Bar.COM", "", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if exists, _ := service.UserExists("foo@bar.com"); exists {
+		t.Error("user should be gone after deleting by another casing")
+	}
+}
+
+func TestMigrateEmailCasing(t *testing.T) {
+	mockStorage := storage.NewMemoryStorage()
+	service := NewService(mockStorage)
+	dir := []string{"home", UserDir}
+
+	// Records from before normalization sit under their original casing
+	seed := func(email string) {
+		user, err := models.NewUser(email, "password123")
+		if err != nil {
+			t.Fatalf("NewUser failed: %v", err)
+		}
+		data, _ := user.ToJSON()
+		mockStorage.CreateFile(context.Background(), append(append([]string{}, dir...), email), data)
+	}
+	seed("Mixed@Example.com")
+	seed("Taken@Example.com")
+	seed("taken@example.com")
+	seed("plain@example.com")
+	seed("Homed@Example.com")
+	ctx := context.Background()
+	mockStorage.CreateFile(ctx, []string{"home", "Mixed@Example.com", "budget"}, "cell:A1:v:1")
+	// Files already under the normalized home can't be merged automatically
+	mockStorage.CreateFile(ctx, []string{"home", "Homed@Example.com", "budget"}, "cell:A1:v:old")
+	mockStorage.CreateFile(ctx, []string{"home", "homed@example.com", "budget"}, "cell:A1:v:new")
+
+	report, err := service.MigrateEmailCasing()
+	if err != nil {
+		t.Fatalf("MigrateEmailCasing failed: %v", err)
+	}
+	if report.Scanned != 5 {
+		t.Errorf("Scanned = %d, want 5", report.Scanned)
+	}
+	if len(report.Renamed) != 1 || report.Renamed[0] != "Mixed@Example.com" {
+		t.Errorf("Renamed = %v, want [Mixed@Example.com]", report.Renamed)
+	}
+	if len(report.Conflicts) != 2 || report.Conflicts[0] != "Taken@Example.com" || report.Conflicts[1] != "Homed@Example.com" {
+		t.Errorf("Conflicts = %v, want [Taken@Example.com Homed@Example.com]", report.Conflicts)
+	}
+
+	if ok, _ := mockStorage.ExistsItem("home/users/Mixed@Example.com"); ok {
+		t.Error("the mixed-case record should have been moved")
+	}
+	user, err := service.GetUser("mixed@example.com")
+	if err != nil {
+		t.Fatalf("migrated user not found: %v", err)
+	}
+	if user.Email != "mixed@example.com" || !user.Authenticate("password123") {
+		t.Errorf("migrated user = %+v, want normalized email and the same password", user)
+	}
+	if ok, _ := mockStorage.ExistsItem("home/users/Taken@Example.com"); !ok {
+		t.Error("a conflicting record must be left in place")
+	}
+	if item, err := mockStorage.GetFile(ctx, []string{"home", "mixed@example.com", "budget"}); err != nil || item.Data != "cell:A1:v:1" {
+		t.Errorf("the migrated user's sheet should move to the normalized home, got %v", err)
+	}
+	if ok, _ := mockStorage.ExistsItem("home/Mixed@Example.com"); ok {
+		t.Error("the mixed-case home directory should be removed")
+	}
+	if ok, _ := mockStorage.ExistsItem("home/users/Homed@Example.com"); !ok {
+		t.Error("a record whose normalized home has files must be left in place")
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// CasingReport summarizes a MigrateEmailCasing run
+type CasingReport struct {
+	Scanned   int
+	Renamed   []string // original addresses whose records were moved
+	Conflicts []string // addresses whose normalized form is already taken
+}
+
+// MigrateEmailCasing moves user records stored under a mixed-case address,
+// from before addresses were normalized, to their normalized key so lookups
+// find them again. A record whose normalized key already belongs to another
+// user, or whose normalized home directory already has files in it, is
+// left in place and reported as a conflict, to be merged by hand. The home
+// directory moves with the record; a failure part way removes the copies
+// again, so the account is never reachable under both keys.
+func (s *Service) MigrateEmailCasing() (*CasingReport, error) {
+	dir := []string{"home", UserDir}
+	item, err := s.storage.GetFile(s.ctx, dir)
+	if errors.Is(err, storage.ErrNotFound) {
+		return &CasingReport{}, nil
+	}
+	if err != nil {
+		return &CasingReport{}, fmt.Errorf("reading users directory: %w", err)
+	}
+
+	var names []string
+	switch entries := item.Data.(type) {
+	case []string:
+		names = entries
+	case []interface{}:
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	report := &CasingReport{}
+	for _, name := range names {
+		report.Scanned++
+		normalized := NormalizeEmail(name)
+		if normalized == name {
+			continue
+		}
+
+		exists, err := s.UserExists(normalized)
+		if err != nil {
+			return report, err
+		}
+		if !exists {
+			if exists, err = s.storage.ExistsItem(strings.Join(homePath(normalized), "/")); err != nil {
+				return report, err
+			}
+		}
+		if exists {
+			report.Conflicts = append(report.Conflicts, name)
+			continue
+		}
+
+		old := append(append([]string{}, dir...), name)
+		record, err := s.storage.GetFile(s.ctx, old)
+		if err != nil {
+			return report, fmt.Errorf("reading user %s: %w", name, err)
+		}
+		user, err := models.UserFromData(record.Data)
+		if err != nil {
+			return report, fmt.Errorf("reading user %s: %w", name, err)
+		}
+		user.Email = normalized
+		userData, err := user.ToJSON()
+		if err != nil {
+			return report, err
+		}
+		if err := s.storage.CreateFile(s.ctx, s.getUserPath(normalized), userData); err != nil {
+			return report, fmt.Errorf("moving user %s: %w", name, err)
+		}
+		movedHome := true
+		if err := storage.CopyTree(s.ctx, s.storage, homePath(name), homePath(normalized)); errors.Is(err, storage.ErrNotFound) {
+			movedHome = false
+		} else if err != nil {
+			s.storage.DeleteFile(s.ctx, s.getUserPath(normalized))
+			return report, fmt.Errorf("moving files of %s: %w", name, err)
+		}
+		if err := s.storage.DeleteFile(s.ctx, old); err != nil {
+			if movedHome {
+				s.storage.DeleteDir(homePath(normalized), true)
+			}
+			s.storage.DeleteFile(s.ctx, s.getUserPath(normalized))
+			return report, fmt.Errorf("moving user %s: %w", name, err)
+		}
+		if movedHome {
+			if err := s.storage.DeleteDir(homePath(name), true); err != nil {
+				return report, fmt.Errorf("moved %s, but removing the old files failed: %w", name, err)
+			}
+		}
+		report.Renamed = append(report.Renamed, name)
+	}
+	return report, nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+var (
+	// ErrInvalidEmail is returned by ChangeEmail for a malformed new address
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrEmailTaken is returned by ChangeEmail when the new address already
+	// has an account
+	ErrEmailTaken = errors.New("email address already in use")
+)
+
+// ChangeEmail moves oldEmail's account to newEmail, for a user who mistyped
+// their address when registering. The record is written under the new
+// address and read back, and the home directory is copied across with
+// everything in it, before the old record is deleted; if that delete
+// fails the copies are removed again, so a failure never leaves the
+// account reachable under both addresses. The old home directory goes
+// last. Sessions issued to the old address are left for the caller.
+func (s *Service) ChangeEmail(oldEmail, newEmail string) error {
+	if !ValidateEmail(newEmail) {
+		return ErrInvalidEmail
+	}
+	oldEmail, newEmail = NormalizeEmail(oldEmail), NormalizeEmail(newEmail)
+	if oldEmail == newEmail {
+		return nil
+	}
+
+	user, err := s.GetUser(oldEmail)
+	if err != nil {
+		return err
+	}
+	exists, err := s.UserExists(newEmail)
+	if err != nil {
+		return fmt.Errorf("error checking user existence: %w", err)
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	user.Email = newEmail
+	userData, err := user.ToJSON()
+	if err != nil {
+		return fmt.Errorf("error serializing user data: %w", err)
+	}
+	if err := s.storage.CreateFile(s.ctx, s.getUserPath(newEmail), userData); err != nil {
+		// Someone may have registered the address since the check above
+		if exists, _ := s.UserExists(newEmail); exists {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("error writing user %s: %w", newEmail, err)
+	}
+
+	written, err := s.GetUser(newEmail)
+	if err != nil || written.Email != newEmail || written.PWHash != user.PWHash {
+		s.storage.DeleteFile(s.ctx, s.getUserPath(newEmail))
+		if err == nil {
+			err = errors.New("record read back does not match")
+		}
+		return fmt.Errorf("error verifying user %s: %w", newEmail, err)
+	}
+
+	oldHome, newHome := homePath(oldEmail), homePath(newEmail)
+	movedHome := true
+	if err := storage.CopyTree(s.ctx, s.storage, oldHome, newHome); errors.Is(err, storage.ErrNotFound) {
+		movedHome = false
+	} else if err != nil {
+		s.storage.DeleteFile(s.ctx, s.getUserPath(newEmail))
+		return fmt.Errorf("error copying files of %s: %w", oldEmail, err)
+	}
+
+	if err := s.storage.DeleteFile(s.ctx, s.getUserPath(oldEmail)); err != nil {
+		if movedHome {
+			s.storage.DeleteDir(newHome, true)
+		}
+		if rollbackErr := s.storage.DeleteFile(s.ctx, s.getUserPath(newEmail)); rollbackErr != nil {
+			return fmt.Errorf("error removing user %s: %w (and removing %s again failed: %v)", oldEmail, err, newEmail, rollbackErr)
+		}
+		return fmt.Errorf("error removing user %s: %w", oldEmail, err)
+	}
+	if movedHome {
+		if err := s.storage.DeleteDir(oldHome, true); err != nil {
+			return fmt.Errorf("moved %s to %s, but removing the old files failed: %w", oldEmail, newEmail, err)
+		}
+	}
+	return nil
+}
+
+// homePath returns the directory holding email's sheets
+func homePath(email string) []string {
+	return []string{"home", email}
+}
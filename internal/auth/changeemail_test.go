@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// undeletableStorage refuses to delete anything under one path
+type undeletableStorage struct {
+	*storage.MemoryStorage
+	path string
+}
+
+func (u undeletableStorage) DeleteFile(ctx context.Context, path []string) error {
+	if strings.Join(path, "/") == u.path {
+		return errors.New("permission denied")
+	}
+	return u.MemoryStorage.DeleteFile(ctx, path)
+}
+
+func newChangeEmailService(t *testing.T, st storage.Storage) *Service {
+	service := NewService(st)
+	if err := service.CreateUser("typo@exmaple.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func TestChangeEmail(t *testing.T) {
+	service := newChangeEmailService(t, storage.NewMemoryStorage())
+
+	if err := service.ChangeEmail("typo@exmaple.com", " Fixed@Example.com "); err != nil {
+		t.Fatalf("ChangeEmail failed: %v", err)
+	}
+	if exists, _ := service.UserExists("typo@exmaple.com"); exists {
+		t.Error("old address should no longer have an account")
+	}
+	user, err := service.GetUser("fixed@example.com")
+	if err != nil {
+		t.Fatalf("GetUser at the new address failed: %v", err)
+	}
+	if user.Email != "fixed@example.com" {
+		t.Errorf("Email = %q, want the normalized new address", user.Email)
+	}
+	if !user.Authenticate("password123") {
+		t.Error("the moved account should keep its password")
+	}
+}
+
+func TestChangeEmailToTakenAddress(t *testing.T) {
+	service := newChangeEmailService(t, storage.NewMemoryStorage())
+	if err := service.CreateUser("someone@example.com", "otherpass456"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	if err := service.ChangeEmail("typo@exmaple.com", "Someone@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("ChangeEmail err = %v, want ErrEmailTaken", err)
+	}
+	if exists, _ := service.UserExists("typo@exmaple.com"); !exists {
+		t.Error("a refused change should leave the old account in place")
+	}
+	other, err := service.GetUser("someone@example.com")
+	if err != nil || !other.Authenticate("otherpass456") {
+		t.Errorf("the existing account should be untouched, got %v", err)
+	}
+}
+
+func TestChangeEmailRejectsInvalidAddress(t *testing.T) {
+	service := newChangeEmailService(t, storage.NewMemoryStorage())
+
+	for _, email := range []string{"", "not-an-email", "Name <fixed@example.com>", "fixed@localhost"} {
+		if err := service.ChangeEmail("typo@exmaple.com", email); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("ChangeEmail(%q) err = %v, want ErrInvalidEmail", email, err)
+		}
+	}
+	if exists, _ := service.UserExists("typo@exmaple.com"); !exists {
+		t.Error("a rejected change should leave the old account in place")
+	}
+}
+
+func TestChangeEmailRollsBackWhenOldRecordStays(t *testing.T) {
+	st := undeletableStorage{storage.NewMemoryStorage(), "home/users/typo@exmaple.com"}
+	service := newChangeEmailService(t, st)
+
+	if err := service.ChangeEmail("typo@exmaple.com", "fixed@example.com"); err == nil {
+		t.Fatal("ChangeEmail should fail when the old record can't be removed")
+	}
+	if exists, _ := service.UserExists("fixed@example.com"); exists {
+		t.Error("the new record should be removed again, not left as a second account")
+	}
+	if exists, _ := service.UserExists("typo@exmaple.com"); !exists {
+		t.Error("the old account should still work after a failed change")
+	}
+}
+
+func TestChangeEmailMovesFiles(t *testing.T) {
+	st := storage.NewMemoryStorage()
+	service := newChangeEmailService(t, st)
+	ctx := context.Background()
+	sheet := []string{"home", "typo@exmaple.com", "budget"}
+	if err := st.CreateFile(ctx, sheet, "cell:A1:v:1"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if err := storage.Grant(st, sheet, "friend@example.com", storage.PermissionRead); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+
+	if err := service.ChangeEmail("typo@exmaple.com", "fixed@example.com"); err != nil {
+		t.Fatalf("ChangeEmail failed: %v", err)
+	}
+	item, err := st.GetFile(ctx, []string{"home", "fixed@example.com", "budget"})
+	if err != nil {
+		t.Fatalf("the sheet should have moved to the new home: %v", err)
+	}
+	if item.Data != "cell:A1:v:1" || strings.Join(item.Path, "/") != "home/fixed@example.com/budget" {
+		t.Errorf("moved sheet = %+v, want the same data at its new path", item)
+	}
+	acl, err := storage.GetACL(st, []string{"home", "fixed@example.com", "budget"})
+	if err != nil || acl["friend@example.com"] != storage.PermissionRead {
+		t.Errorf("the sheet's access list should move with it, got %v (%v)", acl, err)
+	}
+	if exists, _ := st.ExistsItem("home/typo@exmaple.com"); exists {
+		t.Error("the old home directory should be removed")
+	}
+}
+
+func TestChangeEmailRollsBackMovedFiles(t *testing.T) {
+	st := undeletableStorage{storage.NewMemoryStorage(), "home/users/typo@exmaple.com"}
+	service := newChangeEmailService(t, st)
+	if err := st.CreateFile(context.Background(), []string{"home", "typo@exmaple.com", "budget"}, "cell:A1:v:1"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	if err := service.ChangeEmail("typo@exmaple.com", "fixed@example.com"); err == nil {
+		t.Fatal("ChangeEmail should fail when the old record can't be removed")
+	}
+	if exists, _ := st.ExistsItem("home/fixed@example.com"); exists {
+		t.Error("the copied home directory should be removed again")
+	}
+	if exists, _ := st.ExistsItem("home/typo@exmaple.com/budget"); !exists {
+		t.Error("the old files should be left in place")
+	}
+}
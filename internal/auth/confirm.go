@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// confirmTokenDir holds outstanding confirmation tokens, under home/tokens,
+// apart from reset tokens so one can never be spent as the other
+const confirmTokenDir = "confirm"
+
+// DefaultConfirmTokenTTL is how long a confirmation link works unless
+// configured
+const DefaultConfirmTokenTTL = 48 * time.Hour
+
+// AuditReasonUnconfirmed is the deletion reason recorded for accounts
+// purged by PurgeUnconfirmed
+const AuditReasonUnconfirmed = "email address never confirmed"
+
+var (
+	// ErrInvalidConfirmToken is returned for a confirmation token that was
+	// never issued, or whose account has since been replaced
+	ErrInvalidConfirmToken = errors.New("invalid confirmation token")
+
+	// ErrExpiredConfirmToken is returned for a confirmation token past its
+	// expiry
+	ErrExpiredConfirmToken = errors.New("confirmation token has expired")
+)
+
+// confirmToken is the stored record of an issued confirmation token, kept
+// under the token's hash like resetToken. It stays after use, marked Used,
+// so following the link again is harmless.
+type confirmToken struct {
+	Email   string    `json:"email"`
+	Expires time.Time `json:"expires"`
+	Used    bool      `json:"used,omitempty"`
+}
+
+// SetRequireConfirmation makes CreateUser create accounts unconfirmed, so
+// they can't log in until confirmed with a token from
+// GenerateConfirmationToken
+func (s *Service) SetRequireConfirmation(enabled bool) {
+	s.requireConfirmation = enabled
+}
+
+// ConfirmationRequired reports whether new accounts must be confirmed
+func (s *Service) ConfirmationRequired() bool {
+	return s.requireConfirmation
+}
+
+// SetConfirmTokenTTL sets how long confirmation tokens stay valid, and so
+// how long an unconfirmed account is kept; zero or less restores
+// DefaultConfirmTokenTTL
+func (s *Service) SetConfirmTokenTTL(ttl time.Duration) {
+	s.confirmTokenTTL = ttl
+}
+
+func (s *Service) confirmationTTL() time.Duration {
+	if s.confirmTokenTTL <= 0 {
+		return DefaultConfirmTokenTTL
+	}
+	return s.confirmTokenTTL
+}
+
+// GenerateConfirmationToken issues a token that confirms email's account
+// until it expires. An unconfirmed account is kept until then too, so
+// sending a fresh link extends it.
+func (s *Service) GenerateConfirmationToken(email string) (string, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	expires := s.now().Add(s.confirmationTTL())
+	record, err := json.Marshal(confirmToken{Email: user.Email, Expires: expires})
+	if err != nil {
+		return "", err
+	}
+	if err := s.storage.PutItem(confirmTokenPath(token), string(record)); err != nil {
+		return "", err
+	}
+
+	if !user.GetConfirmed() && user.ConfirmBy.Before(expires) {
+		user.ConfirmBy = expires
+		if err := s.setUser(user); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// ConfirmWithToken confirms the account token was issued for. Confirming
+// an already confirmed account, such as by following the link twice, does
+// nothing. An unknown token is ErrInvalidConfirmToken and an expired one
+// ErrExpiredConfirmToken.
+func (s *Service) ConfirmWithToken(token string) error {
+	if token == "" {
+		return ErrInvalidConfirmToken
+	}
+	path := confirmTokenPath(token)
+	data, err := s.storage.GetItem(path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidConfirmToken
+	}
+	if err != nil {
+		return err
+	}
+
+	var record confirmToken
+	if err := json.Unmarshal([]byte(data), &record); err != nil || record.Email == "" {
+		return ErrInvalidConfirmToken
+	}
+	if !s.now().Before(record.Expires) {
+		return ErrExpiredConfirmToken
+	}
+
+	user, err := s.GetUser(record.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidConfirmToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.GetConfirmed() {
+		return nil
+	}
+	// A used token whose account is unconfirmed again belongs to an
+	// account deleted and registered anew, which hasn't proven anything
+	if record.Used {
+		return ErrInvalidConfirmToken
+	}
+
+	user.SetConfirmed()
+	if err := s.setUser(user); err != nil {
+		return err
+	}
+	record.Used = true
+	if used, err := json.Marshal(record); err == nil {
+		s.storage.PutItem(path, string(used))
+	}
+	return nil
+}
+
+// ExpiredUnconfirmed lists the accounts whose confirmation ran out without
+// them being confirmed, which PurgeUnconfirmed would delete
+func (s *Service) ExpiredUnconfirmed() ([]string, error) {
+	names, err := s.storage.List([]string{"home", UserDir})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading users directory: %w", err)
+	}
+
+	now := s.now()
+	var expired []string
+	for _, name := range names {
+		user, err := s.GetUser(name)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, fmt.Errorf("reading user %s: %w", name, err)
+		}
+		if !user.GetConfirmed() && !user.ConfirmBy.IsZero() && !now.Before(user.ConfirmBy) {
+			expired = append(expired, user.Email)
+		}
+	}
+	return expired, nil
+}
+
+// PurgeUnconfirmed deletes every account ExpiredUnconfirmed lists, as
+// DeleteUser does, and returns the addresses it deleted
+func (s *Service) PurgeUnconfirmed() ([]string, error) {
+	expired, err := s.ExpiredUnconfirmed()
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	for _, email := range expired {
+		if err := s.DeleteUser(email, AuditReasonUnconfirmed, false); err != nil {
+			return purged, fmt.Errorf("purging user %s: %w", email, err)
+		}
+		purged = append(purged, email)
+	}
+	return purged, nil
+}
+
+func confirmTokenPath(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return strings.Join([]string{"home", TokenDir, confirmTokenDir, hex.EncodeToString(sum[:])}, "/")
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newConfirmService(t *testing.T, issued time.Time) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetRequireConfirmation(true)
+	service.SetConfirmTokenTTL(24 * time.Hour)
+	service.now = func() time.Time { return issued }
+	if err := service.CreateUser("new@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func TestConfirmWithToken(t *testing.T) {
+	service := newConfirmService(t, time.Now())
+
+	if ok, err := service.AuthenticateUser("new@example.com", "password123"); ok || err == nil {
+		t.Fatalf("unconfirmed login = %v, %v; want refused", ok, err)
+	}
+
+	token, err := service.GenerateConfirmationToken("New@Example.com")
+	if err != nil {
+		t.Fatalf("GenerateConfirmationToken failed: %v", err)
+	}
+	if _, err := service.ValidatePasswordResetToken(token); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("confirmation token as a reset token: err = %v, want ErrInvalidResetToken", err)
+	}
+	if err := service.ConfirmWithToken(token); err != nil {
+		t.Fatalf("ConfirmWithToken failed: %v", err)
+	}
+
+	user, err := service.GetUser("new@example.com")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if !user.GetConfirmed() || !user.ConfirmBy.IsZero() {
+		t.Errorf("confirmed = %v, confirm by %v; want confirmed with no deadline", user.Confirmed, user.ConfirmBy)
+	}
+	if ok, err := service.AuthenticateUser("new@example.com", "password123"); !ok || err != nil {
+		t.Errorf("confirmed login = %v, %v; want success", ok, err)
+	}
+}
+
+func TestConfirmWithExpiredToken(t *testing.T) {
+	issued := time.Now()
+	service := newConfirmService(t, issued)
+
+	token, err := service.GenerateConfirmationToken("new@example.com")
+	if err != nil {
+		t.Fatalf("GenerateConfirmationToken failed: %v", err)
+	}
+	service.now = func() time.Time { return issued.Add(24 * time.Hour) }
+	if err := service.ConfirmWithToken(token); !errors.Is(err, ErrExpiredConfirmToken) {
+		t.Fatalf("expired token: err = %v, want ErrExpiredConfirmToken", err)
+	}
+	if user, _ := service.GetUser("new@example.com"); user.GetConfirmed() {
+		t.Error("an expired token should not confirm the account")
+	}
+	if err := service.ConfirmWithToken("made-up"); !errors.Is(err, ErrInvalidConfirmToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidConfirmToken", err)
+	}
+}
+
+func TestConfirmTwiceIsNoOp(t *testing.T) {
+	service := newConfirmService(t, time.Now())
+
+	token, err := service.GenerateConfirmationToken("new@example.com")
+	if err != nil {
+		t.Fatalf("GenerateConfirmationToken failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := service.ConfirmWithToken(token); err != nil {
+			t.Fatalf("confirmation %d failed: %v", i+1, err)
+		}
+	}
+	if user, _ := service.GetUser("new@example.com"); !user.GetConfirmed() {
+		t.Error("account should stay confirmed")
+	}
+
+	// The used link doesn't confirm a new account registered at the address
+	if err := service.DeleteUser("new@example.com", "", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if err := service.CreateUser("new@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.ConfirmWithToken(token); !errors.Is(err, ErrInvalidConfirmToken) {
+		t.Errorf("used token on a new account: err = %v, want ErrInvalidConfirmToken", err)
+	}
+}
+
+func TestPurgeUnconfirmed(t *testing.T) {
+	issued := time.Now()
+	service := newConfirmService(t, issued)
+	service.SetRequireConfirmation(false)
+	if err := service.CreateUser("old@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	service.now = func() time.Time { return issued.Add(23 * time.Hour) }
+	if expired, err := service.ExpiredUnconfirmed(); err != nil || len(expired) != 0 {
+		t.Fatalf("ExpiredUnconfirmed before the deadline = %v, %v; want none", expired, err)
+	}
+
+	service.now = func() time.Time { return issued.Add(24 * time.Hour) }
+	purged, err := service.PurgeUnconfirmed()
+	if err != nil {
+		t.Fatalf("PurgeUnconfirmed failed: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != "new@example.com" {
+		t.Errorf("purged = %v, want only the unconfirmed account", purged)
+	}
+	if exists, _ := service.UserExists("old@example.com"); !exists {
+		t.Error("confirmed accounts should be kept")
+	}
+	entries, _ := service.AuditLog()
+	if len(entries) != 1 || entries[0].Reason != AuditReasonUnconfirmed {
+		t.Errorf("audit log = %+v, want the purge recorded", entries)
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// DefaultDeletionReasonLength is the longest deletion reason accepted
+// unless configured otherwise
+const DefaultDeletionReasonLength = 500
+
+// DeletedUserDir holds the tombstones soft-deleted accounts leave behind
+const DeletedUserDir = "deletedusers"
+
+// AuditActionDelete is the audit log action recorded for a deleted account
+const AuditActionDelete = "account.delete"
+
+// auditLogPath is the file account events are appended to, one JSON line
+// per event
+var auditLogPath = []string{"system", "audit", "accounts"}
+
+// ErrReasonTooLong is returned by DeleteUser for a reason over the limit
+var ErrReasonTooLong = errors.New("deletion reason is too long")
+
+// AuditEntry is one line of the account audit log
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Email  string    `json:"email"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Tombstone is what a soft-deleted account leaves in place of its record,
+// so support can tell the address once had an account and why it left
+type Tombstone struct {
+	Email     string    `json:"email"`
+	DeletedAt time.Time `json:"deleted_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// SetSoftDelete makes DeleteUser leave a Tombstone behind for each account
+// it deletes
+func (s *Service) SetSoftDelete(enabled bool) {
+	s.softDelete = enabled
+}
+
+// SetDeletionReasonLimit sets the longest reason, in characters, that
+// DeleteUser accepts; zero or less falls back to the default
+func (s *Service) SetDeletionReasonLimit(n int) {
+	s.deletionReasonLimit = n
+}
+
+// AuditActionRestore is the audit log action recorded for a restored
+// account
+const AuditActionRestore = "account.restore"
+
+// DeleteUser removes email's account, recording reason, which may be
+// empty, in the audit log and, with soft delete on, on its tombstone.
+// With trash set the record is moved to the storage trash (see
+// storage.SoftDeleter), where RestoreUser can bring it back until the
+// trash is purged; otherwise it is gone for good.
+func (s *Service) DeleteUser(email, reason string, trash bool) error {
+	reason = strings.TrimSpace(reason)
+	limit := s.deletionReasonLimit
+	if limit <= 0 {
+		limit = DefaultDeletionReasonLength
+	}
+	if utf8.RuneCountInString(reason) > limit {
+		return fmt.Errorf("%w: %d characters at most", ErrReasonTooLong, limit)
+	}
+
+	exists, err := s.UserExists(email)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("user does not exist")
+	}
+
+	email = NormalizeEmail(email)
+	now := s.now().UTC()
+	if s.softDelete {
+		tombstone, err := json.Marshal(Tombstone{Email: email, DeletedAt: now, Reason: reason})
+		if err != nil {
+			return err
+		}
+		if err := s.storage.PutItem(tombstonePath(email), string(tombstone)); err != nil {
+			return fmt.Errorf("failed to write tombstone: %w", err)
+		}
+	}
+
+	if trash {
+		err = storage.NewSoftDeleter(s.storage).SoftDelete(s.ctx, s.getUserPath(email))
+	} else {
+		err = s.storage.DeleteFile(s.ctx, s.getUserPath(email))
+	}
+	if err != nil {
+		return err
+	}
+	return s.audit(AuditEntry{Time: now, Action: AuditActionDelete, Email: email, Reason: reason})
+}
+
+// RestoreUser brings back an account deleted with trash set. It is
+// storage.ErrNotFound when the account isn't in the trash, and
+// storage.ErrRestoreConflict when the address has registered again since.
+func (s *Service) RestoreUser(email string) error {
+	email = NormalizeEmail(email)
+	if err := storage.NewSoftDeleter(s.storage).Restore(s.ctx, s.getUserPath(email)); err != nil {
+		return err
+	}
+	if err := s.storage.DeleteItem(tombstonePath(email)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to remove tombstone: %w", err)
+	}
+	return s.audit(AuditEntry{Time: s.now().UTC(), Action: AuditActionRestore, Email: email})
+}
+
+// GetTombstone returns the tombstone left by soft-deleting email's account
+func (s *Service) GetTombstone(email string) (*Tombstone, error) {
+	data, err := s.storage.GetItem(tombstonePath(NormalizeEmail(email)))
+	if err != nil {
+		return nil, err
+	}
+	var tombstone Tombstone
+	if err := json.Unmarshal([]byte(data), &tombstone); err != nil {
+		return nil, fmt.Errorf("invalid tombstone for %s: %w", email, err)
+	}
+	return &tombstone, nil
+}
+
+// AuditLog returns every entry in the account audit log, oldest first
+func (s *Service) AuditLog() ([]AuditEntry, error) {
+	item, err := s.storage.GetFile(s.ctx, auditLogPath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Service) audit(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.Append(auditLogPath, append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func tombstonePath(email string) string {
+	return strings.Join([]string{"home", DeletedUserDir, email}, "/")
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newDeletionService(t *testing.T, soft bool) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetSoftDelete(soft)
+	if err := service.CreateUser("leaving@example.com", "password123"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func TestDeleteUserRecordsReasonInAuditLog(t *testing.T) {
+	service := newDeletionService(t, false)
+
+	if err := service.DeleteUser("Leaving@Example.com", "  moving to another tool  ", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if exists, _ := service.UserExists("leaving@example.com"); exists {
+		t.Error("user should be gone after DeleteUser")
+	}
+
+	entries, err := service.AuditLog()
+	if err != nil {
+		t.Fatalf("AuditLog failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Action != AuditActionDelete || entry.Email != "leaving@example.com" || entry.Reason != "moving to another tool" {
+		t.Errorf("audit entry = %+v, want the delete with its trimmed reason", entry)
+	}
+	if entry.Time.IsZero() {
+		t.Error("audit entry should be timestamped")
+	}
+
+	// Hard deletes leave nothing of the account behind
+	if _, err := service.GetTombstone("leaving@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetTombstone after a hard delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSoftDeleteRecordsReasonOnTombstone(t *testing.T) {
+	service := newDeletionService(t, true)
+
+	if err := service.DeleteUser("leaving@example.com", "too expensive", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	tombstone, err := service.GetTombstone("leaving@example.com")
+	if err != nil {
+		t.Fatalf("GetTombstone failed: %v", err)
+	}
+	if tombstone.Email != "leaving@example.com" || tombstone.Reason != "too expensive" || tombstone.DeletedAt.IsZero() {
+		t.Errorf("tombstone = %+v, want the address, reason and time", tombstone)
+	}
+	entries, _ := service.AuditLog()
+	if len(entries) != 1 || entries[0].Reason != "too expensive" {
+		t.Errorf("audit log = %+v, want the reason recorded there too", entries)
+	}
+
+	// The address is free to register again
+	if err := service.CreateUser("leaving@example.com", "password123"); err != nil {
+		t.Errorf("re-registering a soft-deleted address failed: %v", err)
+	}
+}
+
+func TestDeleteUserRejectsLongReason(t *testing.T) {
+	service := newDeletionService(t, true)
+	service.SetDeletionReasonLimit(10)
+
+	err := service.DeleteUser("leaving@example.com", strings.Repeat("x", 11), false)
+	if !errors.Is(err, ErrReasonTooLong) {
+		t.Fatalf("err = %v, want ErrReasonTooLong", err)
+	}
+	if exists, _ := service.UserExists("leaving@example.com"); !exists {
+		t.Error("a rejected deletion must leave the account in place")
+	}
+	if entries, _ := service.AuditLog(); len(entries) != 0 {
+		t.Errorf("a rejected deletion must not be audited, got %+v", entries)
+	}
+
+	// The limit counts characters, not bytes
+	if err := service.DeleteUser("leaving@example.com", strings.Repeat("é", 10), false); err != nil {
+		t.Errorf("reason at the limit: %v", err)
+	}
+}
+
+func TestDeleteUserWithoutReason(t *testing.T) {
+	service := newDeletionService(t, false)
+
+	if err := service.DeleteUser("leaving@example.com", "", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	entries, _ := service.AuditLog()
+	if len(entries) != 1 || entries[0].Reason != "" {
+		t.Errorf("audit log = %+v, want one entry without a reason", entries)
+	}
+}
+
+func TestDeleteUserToTrashAndRestore(t *testing.T) {
+	service := newDeletionService(t, true)
+
+	if err := service.DeleteUser("leaving@example.com", "changed my mind later", true); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if exists, _ := service.UserExists("leaving@example.com"); exists {
+		t.Error("user should be gone after DeleteUser")
+	}
+
+	if err := service.RestoreUser("Leaving@Example.com"); err != nil {
+		t.Fatalf("RestoreUser failed: %v", err)
+	}
+	if ok, err := service.AuthenticateUser("leaving@example.com", "password123"); err != nil || !ok {
+		t.Errorf("restored account should log in with its old password, got %v, %v", ok, err)
+	}
+	if _, err := service.GetTombstone("leaving@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetTombstone after restore: err = %v, want ErrNotFound", err)
+	}
+	entries, _ := service.AuditLog()
+	if len(entries) != 2 || entries[1].Action != AuditActionRestore {
+		t.Errorf("audit log = %+v, want the delete then the restore", entries)
+	}
+}
+
+func TestRestoreUserAfterHardDelete(t *testing.T) {
+	service := newDeletionService(t, false)
+
+	if err := service.DeleteUser("leaving@example.com", "", false); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if err := service.RestoreUser("leaving@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("RestoreUser after a hard delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreUserAfterReRegistering(t *testing.T) {
+	service := newDeletionService(t, false)
+
+	if err := service.DeleteUser("leaving@example.com", "", true); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if err := service.CreateUser("leaving@example.com", "newpassword456"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.RestoreUser("leaving@example.com"); !errors.Is(err, storage.ErrRestoreConflict) {
+		t.Errorf("RestoreUser over a new account: err = %v, want ErrRestoreConflict", err)
+	}
+	if ok, _ := service.AuthenticateUser("leaving@example.com", "newpassword456"); !ok {
+		t.Error("the new account should be left as it is")
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/outbound"
+)
+
+// hashPrefixLen is how much of a SHA-1 hash is used to pick a range, as in
+// the Pwned Passwords k-anonymity API
+const hashPrefixLen = 5
+
+// LoadPasswordDenylist opens the breached-password list at source. An
+// http(s) URL is treated as a Pwned Passwords style range endpoint, queried
+// with only the first five characters of the password's SHA-1 hash; anything
+// else is a local file with one SHA-1 hash per line, optionally followed by
+// ":count". An empty source disables the check.
+func LoadPasswordDenylist(source string) (models.PasswordDenylist, error) {
+	return LoadPasswordDenylistWithClient(source, outbound.New(outbound.Options{Timeout: 5 * time.Second}))
+}
+
+// LoadPasswordDenylistWithClient is LoadPasswordDenylist querying a range
+// endpoint with client, normally the server's shared outbound client
+func LoadPasswordDenylistWithClient(source string, client *http.Client) (models.PasswordDenylist, error) {
+	if source == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return &rangeDenylist{
+			baseURL: strings.TrimSuffix(source, "/"),
+			client:  client,
+		}, nil
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("opening password denylist: %w", err)
+	}
+	defer f.Close()
+	return readDenylist(f)
+}
+
+// hashDenylist holds breached hash suffixes grouped by their range prefix
+type hashDenylist map[string]map[string]struct{}
+
+func readDenylist(r io.Reader) (hashDenylist, error) {
+	list := hashDenylist{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("password denylist line %d: not a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("password denylist line %d: not a SHA-1 hash", line)
+		}
+		prefix, suffix := hash[:hashPrefixLen], hash[hashPrefixLen:]
+		if list[prefix] == nil {
+			list[prefix] = map[string]struct{}{}
+		}
+		list[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading password denylist: %w", err)
+	}
+	return list, nil
+}
+
+func (d hashDenylist) Contains(password string) bool {
+	prefix, suffix := passwordHash(password)
+	_, found := d[prefix][suffix]
+	return found
+}
+
+// rangeDenylist asks a remote range endpoint for every hash sharing the
+// password's prefix, so the password itself never leaves the server
+type rangeDenylist struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Contains fails open: if the endpoint can't be reached the password is
+// allowed, rather than blocking every registration during an outage
+func (d *rangeDenylist) Contains(password string) bool {
+	prefix, suffix := passwordHash(password)
+	resp, err := d.client.Get(d.baseURL + "/" + prefix)
+	if err != nil {
+		log.Printf("Password denylist lookup failed: %v", err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Password denylist lookup failed: %s", resp.Status)
+		return false
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordHash splits the upper-case hex SHA-1 of password into its range
+// prefix and the remaining suffix
+func passwordHash(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:hashPrefixLen], hash[hashPrefixLen:]
+}
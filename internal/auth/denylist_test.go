@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/outbound"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func seedDenylist(t *testing.T, passwords ...string) string {
+	t.Helper()
+	var lines []string
+	for _, password := range passwords {
+		prefix, suffix := passwordHash(password)
+		lines = append(lines, prefix+suffix+":42")
+	}
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("# seeded\n"+strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func useDenylist(t *testing.T, source string) {
+	t.Helper()
+	denylist, err := LoadPasswordDenylist(source)
+	if err != nil {
+		t.Fatalf("LoadPasswordDenylist() error = %v", err)
+	}
+	models.SetPasswordDenylist(denylist)
+	t.Cleanup(func() { models.SetPasswordDenylist(nil) })
+}
+
+func TestDenylistRejectsBreachedPassword(t *testing.T) {
+	useDenylist(t, seedDenylist(t, "password123"))
+	service := NewService(storage.NewMemoryStorage())
+
+	err := service.CreateUser("bad@example.com", "password123")
+	if !errors.Is(err, models.ErrCompromisedPassword) {
+		t.Errorf("CreateUser() with breached password error = %v, want ErrCompromisedPassword", err)
+	}
+	if err := service.CreateUser("good@example.com", "correct horse battery staple"); err != nil {
+		t.Errorf("CreateUser() with safe password error = %v", err)
+	}
+	if err := service.UpdatePassword("good@example.com", "password123"); !errors.Is(err, models.ErrCompromisedPassword) {
+		t.Errorf("UpdatePassword() to breached password error = %v, want ErrCompromisedPassword", err)
+	}
+}
+
+func TestDenylistDisabled(t *testing.T) {
+	useDenylist(t, "")
+
+	if _, err := models.NewUser("user@example.com", "password123"); err != nil {
+		t.Errorf("NewUser() with denylist disabled error = %v", err)
+	}
+}
+
+func TestDenylistRejectsMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("not-a-hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPasswordDenylist(path); err == nil {
+		t.Error("LoadPasswordDenylist() accepted a malformed file")
+	}
+}
+
+func TestRangeDenylistSendsOnlyPrefix(t *testing.T) {
+	badPrefix, badSuffix := passwordHash("password123")
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/range/"+badPrefix {
+			fmt.Fprintf(w, "0000000000000000000000000000000000A:1\r\n%s:42\r\n", badSuffix)
+		}
+	}))
+	defer server.Close()
+	useDenylist(t, server.URL+"/range")
+
+	if _, err := models.NewUser("user@example.com", "password123"); !errors.Is(err, models.ErrCompromisedPassword) {
+		t.Errorf("NewUser() with breached password error = %v, want ErrCompromisedPassword", err)
+	}
+	if _, err := models.NewUser("user@example.com", "correct horse battery staple"); err != nil {
+		t.Errorf("NewUser() with safe password error = %v", err)
+	}
+	for _, path := range requested {
+		if len(strings.TrimPrefix(path, "/range/")) != hashPrefixLen {
+			t.Errorf("range request %q sent more than the hash prefix", path)
+		}
+	}
+}
+
+func TestRangeDenylistFailsOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	useDenylist(t, server.URL)
+
+	if _, err := models.NewUser("user@example.com", "password123"); err != nil {
+		t.Errorf("NewUser() during denylist outage error = %v", err)
+	}
+}
+
+func TestRangeDenylistGivesUpOnHungEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := outbound.New(outbound.Options{ResponseTimeout: 100 * time.Millisecond})
+	denylist, err := LoadPasswordDenylistWithClient(server.URL, client)
+	if err != nil {
+		t.Fatalf("LoadPasswordDenylistWithClient() error = %v", err)
+	}
+
+	done := make(chan bool, 1)
+	go func() { done <- denylist.Contains("password123") }()
+	select {
+	case found := <-done:
+		if found {
+			t.Error("a hung endpoint should fail open, not reject the password")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("lookup against a hung endpoint didn't return within the timeout")
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Limits on an address and its local part, from RFC 5321
+const (
+	maxEmailLength     = 254
+	maxLocalPartLength = 64
+	maxDomainLabel     = 63
+)
+
+// ValidateEmail reports whether email is a plain addr-spec such as
+// user+tag@mail.example.com. Surrounding whitespace and case are ignored;
+// display names, quoted local parts, whitespace inside the address and
+// domains without a TLD are not accepted.
+func ValidateEmail(email string) bool {
+	email = NormalizeEmail(email)
+	if email == "" || len(email) > maxEmailLength || strings.ContainsAny(email, " \t\r\n") {
+		return false
+	}
+
+	// ParseAddress enforces the RFC 5322 grammar, including no empty or
+	// consecutive dots in the local part; requiring the parsed address to
+	// be the input rules out "Name <addr>" forms and quoting
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	return local != "" && len(local) <= maxLocalPartLength && validDomain(domain)
+}
+
+// NormalizeEmail returns the form an address is stored and looked up
+// under: trimmed and lower-cased. RFC 5321 lets the local part be
+// case-sensitive, but no mail provider users are likely to have treats it
+// so, and Foo@Bar.com and foo@bar.com being two accounts only ever
+// confuses their owner.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validDomain accepts lower-case host names of at least two labels, each of
+// letters, digits and inner hyphens, ending in an alphabetic TLD
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > maxDomainLabel || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 {
+		return false
+	}
+	for _, r := range tld {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// Feature entitlements checked by middleware.RequireEntitlement
+const (
+	EntitlementPDFExport   = "pdf_export"
+	EntitlementDropboxSync = "dropbox_sync"
+	// EntitlementAdmin grants the /admin routes. It is never among the
+	// defaults: users hold it only when granted it on their record or
+	// named in SetAdmins.
+	EntitlementAdmin = "admin"
+)
+
+// KnownEntitlements lists every entitlement SetEntitlements accepts
+var KnownEntitlements = []string{EntitlementPDFExport, EntitlementDropboxSync, EntitlementAdmin}
+
+// ErrUnknownEntitlement is returned by SetEntitlements for a name outside
+// KnownEntitlements, so a typo isn't stored as a grant of nothing
+var ErrUnknownEntitlement = errors.New("unknown entitlement")
+
+// SetDefaultEntitlements sets what users without entitlements of their own
+// are granted
+func (s *Service) SetDefaultEntitlements(entitlements []string) {
+	s.defaultEntitlements = entitlements
+}
+
+// SetAdmins names users who hold EntitlementAdmin whatever their record
+// says, so a fresh deployment has someone who can grant it
+func (s *Service) SetAdmins(emails []string) {
+	s.admins = make([]string, len(emails))
+	for i, email := range emails {
+		s.admins[i] = NormalizeEmail(email)
+	}
+}
+
+// Entitlements returns the user's effective entitlements
+func (s *Service) Entitlements(email string) ([]string, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Entitlements == nil {
+		return append([]string{}, s.defaultEntitlements...), nil
+	}
+	return user.Entitlements, nil
+}
+
+// HasEntitlement reports whether the user is granted entitlement
+func (s *Service) HasEntitlement(email, entitlement string) (bool, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return false, err
+	}
+	if entitlement == EntitlementAdmin {
+		return slices.Contains(s.admins, NormalizeEmail(email)) || user.HasEntitlement(entitlement, nil), nil
+	}
+	return user.HasEntitlement(entitlement, s.defaultEntitlements), nil
+}
+
+// SetEntitlements replaces the user's entitlements. Nil returns the user to
+// the defaults; an empty list revokes everything.
+func (s *Service) SetEntitlements(email string, entitlements []string) error {
+	for _, name := range entitlements {
+		if !slices.Contains(KnownEntitlements, name) {
+			return fmt.Errorf("%w: %q", ErrUnknownEntitlement, name)
+		}
+	}
+	return s.updateUser(email, func(user *models.User) error {
+		user.Entitlements = entitlements
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newEntitlementService(t *testing.T) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetDefaultEntitlements([]string{EntitlementPDFExport})
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func TestEntitlementsDefaultFromConfig(t *testing.T) {
+	service := newEntitlementService(t)
+
+	if ok, err := service.HasEntitlement("test@example.com", EntitlementPDFExport); err != nil || !ok {
+		t.Errorf("default entitlement not granted: %v, %v", ok, err)
+	}
+	if ok, _ := service.HasEntitlement("test@example.com", EntitlementDropboxSync); ok {
+		t.Error("entitlement outside the defaults was granted")
+	}
+}
+
+func TestSetEntitlements(t *testing.T) {
+	service := newEntitlementService(t)
+
+	if err := service.SetEntitlements("test@example.com", []string{EntitlementDropboxSync}); err != nil {
+		t.Fatalf("SetEntitlements failed: %v", err)
+	}
+	if ok, _ := service.HasEntitlement("test@example.com", EntitlementDropboxSync); !ok {
+		t.Error("granted entitlement not honoured")
+	}
+	if ok, _ := service.HasEntitlement("test@example.com", EntitlementPDFExport); ok {
+		t.Error("explicit entitlements should replace the defaults")
+	}
+
+	if err := service.SetEntitlements("test@example.com", []string{}); err != nil {
+		t.Fatalf("SetEntitlements failed: %v", err)
+	}
+	if got, _ := service.Entitlements("test@example.com"); len(got) != 0 {
+		t.Errorf("empty entitlements = %v, want none", got)
+	}
+
+	if err := service.SetEntitlements("test@example.com", nil); err != nil {
+		t.Fatalf("SetEntitlements failed: %v", err)
+	}
+	if got, _ := service.Entitlements("test@example.com"); !reflect.DeepEqual(got, []string{EntitlementPDFExport}) {
+		t.Errorf("reset entitlements = %v, want the defaults", got)
+	}
+}
+
+func TestAdminEntitlementIsNeverDefault(t *testing.T) {
+	service := newEntitlementService(t)
+	service.SetDefaultEntitlements([]string{EntitlementAdmin})
+
+	if ok, _ := service.HasEntitlement("test@example.com", EntitlementAdmin); ok {
+		t.Error("admin granted through the defaults")
+	}
+
+	service.SetAdmins([]string{"Test@Example.com"})
+	if ok, err := service.HasEntitlement("test@example.com", EntitlementAdmin); err != nil || !ok {
+		t.Errorf("listed admin not granted admin: %v, %v", ok, err)
+	}
+
+	service.SetAdmins(nil)
+	if err := service.SetEntitlements("test@example.com", []string{EntitlementAdmin}); err != nil {
+		t.Fatalf("SetEntitlements failed: %v", err)
+	}
+	if ok, _ := service.HasEntitlement("test@example.com", EntitlementAdmin); !ok {
+		t.Error("granted admin entitlement not honoured")
+	}
+}
+
+func TestSetEntitlementsRejectsUnknownNames(t *testing.T) {
+	service := newEntitlementService(t)
+
+	err := service.SetEntitlements("test@example.com", []string{EntitlementPDFExport, "pdf-export"})
+	if !errors.Is(err, ErrUnknownEntitlement) {
+		t.Fatalf("SetEntitlements with a typo = %v, want ErrUnknownEntitlement", err)
+	}
+	if got, _ := service.Entitlements("test@example.com"); !reflect.DeepEqual(got, []string{EntitlementPDFExport}) {
+		t.Errorf("entitlements after a refused update = %v, want the defaults untouched", got)
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// ListUsers returns up to limit users, skipping the first offset, in order
+// of email address, along with how many users there are in all. The users
+// are for display: password hashes and other credentials are cleared, so
+// they must not be saved back.
+func (s *Service) ListUsers(offset, limit int) ([]*models.User, int, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, 0, fmt.Errorf("invalid page: offset %d, limit %d", offset, limit)
+	}
+
+	names, err := s.storage.List([]string{"home", UserDir})
+	if errors.Is(err, storage.ErrNotFound) {
+		return []*models.User{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading users directory: %w", err)
+	}
+	sort.Strings(names)
+
+	total := len(names)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit < end-offset {
+		end = offset + limit
+	}
+
+	users := make([]*models.User, 0, end-offset)
+	for _, name := range names[offset:end] {
+		record, err := s.storage.GetFile(s.ctx, []string{"home", UserDir, name})
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading user %s: %w", name, err)
+		}
+		user, err := models.UserFromData(record.Data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading user %s: %w", name, err)
+		}
+		users = append(users, redactUser(user))
+	}
+	return users, total, nil
+}
+
+// redactUser clears everything in user that would let someone holding it
+// log in as them
+func redactUser(user *models.User) *models.User {
+	user.PWHash = ""
+	user.PasswordHistory = nil
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+	for i := range user.APIKeys {
+		user.APIKeys[i].Hash = ""
+	}
+	return user
+}
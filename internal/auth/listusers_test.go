@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newListService(t *testing.T, n int) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	// Created out of order, so the listing has to sort them
+	for i := n - 1; i >= 0; i-- {
+		if err := service.CreateUser(fmt.Sprintf("user%02d@example.com", i), "password123"); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	return service
+}
+
+func listedEmails(t *testing.T, service *Service, offset, limit int) ([]string, int) {
+	t.Helper()
+	users, total, err := service.ListUsers(offset, limit)
+	if err != nil {
+		t.Fatalf("ListUsers(%d, %d) failed: %v", offset, limit, err)
+	}
+	emails := make([]string, len(users))
+	for i, user := range users {
+		if user.PWHash != "" {
+			t.Errorf("%s listed with its password hash", user.Email)
+		}
+		emails[i] = user.Email
+	}
+	return emails, total
+}
+
+func TestListUsersEmptyStore(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+
+	users, total, err := service.ListUsers(0, 10)
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(users) != 0 || total != 0 {
+		t.Errorf("ListUsers = %d users of %d, want none", len(users), total)
+	}
+}
+
+func TestListUsersFewerThanPage(t *testing.T) {
+	service := newListService(t, 3)
+
+	emails, total := listedEmails(t, service, 0, 10)
+	want := []string{"user00@example.com", "user01@example.com", "user02@example.com"}
+	if fmt.Sprint(emails) != fmt.Sprint(want) || total != 3 {
+		t.Errorf("ListUsers = %v of %d, want %v of 3", emails, total, want)
+	}
+}
+
+func TestListUsersPages(t *testing.T) {
+	service := newListService(t, 5)
+
+	var all []string
+	for offset := 0; offset < 6; offset += 2 {
+		emails, total := listedEmails(t, service, offset, 2)
+		if total != 5 {
+			t.Errorf("page at %d: total = %d, want 5", offset, total)
+		}
+		all = append(all, emails...)
+	}
+	want := []string{"user00@example.com", "user01@example.com", "user02@example.com", "user03@example.com", "user04@example.com"}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("pages = %v, want every user once in order %v", all, want)
+	}
+
+	if emails, total := listedEmails(t, service, 10, 2); len(emails) != 0 || total != 5 {
+		t.Errorf("page past the end = %v of %d, want none of 5", emails, total)
+	}
+	if _, _, err := service.ListUsers(-1, 2); err == nil {
+		t.Error("ListUsers accepted a negative offset")
+	}
+	if _, _, err := service.ListUsers(0, 0); err == nil {
+		t.Error("ListUsers accepted a zero limit")
+	}
+}
+
+func TestListUsersHidesCredentials(t *testing.T) {
+	service := newListService(t, 1)
+	if _, err := service.IssueAPIKey("user00@example.com"); err != nil {
+		t.Fatalf("IssueAPIKey failed: %v", err)
+	}
+	if err := service.UpdatePassword("user00@example.com", "newpassword456"); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+
+	users, _, err := service.ListUsers(0, 1)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("ListUsers = %v, %v", users, err)
+	}
+	user := users[0]
+	if user.PWHash != "" || user.PasswordHistory != nil || user.TOTPSecret != "" || user.RecoveryCodes != nil {
+		t.Errorf("listed user keeps credentials: %+v", user)
+	}
+	for _, key := range user.APIKeys {
+		if key.Hash != "" {
+			t.Error("listed user keeps API key hashes")
+		}
+	}
+	if stored, _ := service.GetUser("user00@example.com"); !stored.Authenticate("newpassword456") {
+		t.Error("listing should not change the stored record")
+	}
+}
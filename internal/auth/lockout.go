@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// Lockout applied unless configured otherwise
+const (
+	DefaultLockoutAttempts = 5
+	DefaultLockoutCooldown = 15 * time.Minute
+)
+
+// ErrAccountLocked is returned by AuthenticateUser while an account is
+// locked out after too many wrong passwords
+var ErrAccountLocked = errors.New("account temporarily locked after too many failed logins")
+
+// SetLockout locks an account for cooldown once attempts consecutive
+// logins have failed; attempts of zero or less turns lockout off. The
+// lockout is per account, so it holds however many addresses the
+// attempts come from.
+func (s *Service) SetLockout(attempts int, cooldown time.Duration) {
+	s.lockoutAttempts = attempts
+	s.lockoutCooldown = cooldown
+}
+
+// recordFailedLogin counts a wrong password or second factor against
+// email's account. It goes through updateUser, so failures from logins
+// running at the same time all count.
+func (s *Service) recordFailedLogin(email string) error {
+	return s.updateUser(email, func(user *models.User) error {
+		if !s.countFailedLogin(user) {
+			return errUnchanged
+		}
+		return nil
+	})
+}
+
+// clearFailedLogins forgets the failed logins of email's account after a
+// successful one
+func (s *Service) clearFailedLogins(email string) error {
+	return s.updateUser(email, func(user *models.User) error {
+		if !resetFailedLogins(user) {
+			return errUnchanged
+		}
+		return nil
+	})
+}
+
+// countFailedLogin counts a failed login against user, locking the account
+// when it reaches the limit, and reports whether user changed. The count
+// starts over after a lock, so each cooldown is followed by a fresh set of
+// attempts.
+func (s *Service) countFailedLogin(user *models.User) bool {
+	if s.lockoutAttempts <= 0 {
+		return false
+	}
+	user.FailedAttempts++
+	if user.FailedAttempts >= s.lockoutAttempts {
+		user.FailedAttempts = 0
+		user.LockedUntil = s.now().Add(s.lockoutCooldown)
+	}
+	return true
+}
+
+// resetFailedLogins clears user's failed login count and any lock,
+// reporting whether there was anything to clear
+func resetFailedLogins(user *models.User) bool {
+	if user.FailedAttempts == 0 && user.LockedUntil.IsZero() {
+		return false
+	}
+	user.FailedAttempts = 0
+	user.LockedUntil = time.Time{}
+	return true
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newLockoutService(t *testing.T, clock *time.Time) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	service.SetLockout(3, 15*time.Minute)
+	service.now = func() time.Time { return *clock }
+	return service
+}
+
+func TestLockoutTripsAfterConsecutiveFailures(t *testing.T) {
+	clock := time.Now()
+	service := newLockoutService(t, &clock)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := service.AuthenticateUser("test@example.com", "wrong"); ok || err != nil {
+			t.Fatalf("failure %d: ok=%v, err=%v; want a plain rejection", i+1, ok, err)
+		}
+	}
+
+	// Locked, even for the right password
+	clock = clock.Add(14 * time.Minute)
+	if ok, err := service.AuthenticateUser("test@example.com", "testpassword"); ok || !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("during cooldown: ok=%v, err=%v; want ErrAccountLocked", ok, err)
+	}
+
+	// Unlocked once the window has passed
+	clock = clock.Add(time.Minute)
+	if ok, err := service.AuthenticateUser("test@example.com", "testpassword"); !ok || err != nil {
+		t.Errorf("after cooldown: ok=%v, err=%v; want success", ok, err)
+	}
+	user, _ := service.GetUser("test@example.com")
+	if user.FailedAttempts != 0 || !user.LockedUntil.IsZero() {
+		t.Errorf("success should clear the lockout state, got %d attempts, locked until %v", user.FailedAttempts, user.LockedUntil)
+	}
+}
+
+func TestLockoutCountsOnlyConsecutiveFailures(t *testing.T) {
+	clock := time.Now()
+	service := newLockoutService(t, &clock)
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			service.AuthenticateUser("test@example.com", "wrong")
+		}
+		if ok, err := service.AuthenticateUser("test@example.com", "testpassword"); !ok || err != nil {
+			t.Fatalf("round %d: ok=%v, err=%v; a success should reset the count", round, ok, err)
+		}
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	clock := time.Now()
+	service := newLockoutService(t, &clock)
+	service.SetLockout(0, 0)
+
+	for i := 0; i < 10; i++ {
+		service.AuthenticateUser("test@example.com", "wrong")
+	}
+	if ok, err := service.AuthenticateUser("test@example.com", "testpassword"); !ok || err != nil {
+		t.Errorf("with lockout off: ok=%v, err=%v; want success", ok, err)
+	}
+}
+
+func TestLockoutCountsConcurrentFailures(t *testing.T) {
+	clock := time.Now()
+	service := newLockoutService(t, &clock)
+	service.SetLockout(100, 15*time.Minute)
+
+	// Every failure that reports success must be counted; none may be
+	// overwritten by another login writing the record at the same time
+	var wg sync.WaitGroup
+	var counted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.AuthenticateUser("test@example.com", "wrong"); err == nil {
+				counted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	user, _ := service.GetUser("test@example.com")
+	if user.FailedAttempts != int(counted.Load()) || counted.Load() == 0 {
+		t.Errorf("FailedAttempts = %d, want the %d failures that were recorded", user.FailedAttempts, counted.Load())
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+
+// Login outcomes counted by AuthenticateUser
+const (
+	OutcomeSuccess       = "success"
+	OutcomeTOTPRequired  = "totp_required"
+	OutcomeWrongPassword = "wrong_password"
+	OutcomeUnconfirmed   = "unconfirmed"
+	OutcomeLockedOut     = "locked_out"
+	OutcomeUnknownUser   = "unknown_user"
+	OutcomeError         = "error"
+)
+
+// LoginOutcomes counts login attempts by outcome. A spike in unknown_user
+// or wrong_password is the usual sign of credential stuffing. It is
+// deliberately not labelled by email. A right password on an account with
+// TOTP counts as totp_required, not success, since the code is still to come.
+var LoginOutcomes = metrics.NewCounterVec(
+	"touchcalc_login_attempts_total",
+	"Login attempts by outcome.",
+	"outcome",
+	OutcomeSuccess, OutcomeTOTPRequired, OutcomeWrongPassword,
+	OutcomeUnconfirmed, OutcomeLockedOut, OutcomeUnknownUser, OutcomeError,
+)
+
+func init() {
+	metrics.Default.Register(LoginOutcomes)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// brokenStorage fails every read with something other than ErrNotFound
+type brokenStorage struct {
+	*storage.MemoryStorage
+}
+
+func (brokenStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	return nil, errors.New("connection reset")
+}
+
+// countOutcome runs login and reports how much each outcome counter moved
+func countOutcome(t *testing.T, login func()) map[string]uint64 {
+	t.Helper()
+	outcomes := []string{
+		OutcomeSuccess, OutcomeTOTPRequired, OutcomeWrongPassword,
+		OutcomeUnconfirmed, OutcomeLockedOut, OutcomeUnknownUser, OutcomeError,
+	}
+	before := make(map[string]uint64)
+	for _, o := range outcomes {
+		before[o] = LoginOutcomes.Value(o)
+	}
+	login()
+	delta := make(map[string]uint64)
+	for _, o := range outcomes {
+		if d := LoginOutcomes.Value(o) - before[o]; d != 0 {
+			delta[o] = d
+		}
+	}
+	return delta
+}
+
+func TestAuthenticateUserCountsOutcomes(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	for _, email := range []string{"confirmed@example.com", "pending@example.com"} {
+		if err := service.CreateUser(email, "secret"); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	pending, err := service.GetUser("pending@example.com")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	pending.Confirmed = false
+	if err := service.setUser(pending); err != nil {
+		t.Fatalf("setUser failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		service  *Service
+		email    string
+		password string
+		want     string
+	}{
+		{"success", service, "confirmed@example.com", "secret", OutcomeSuccess},
+		{"wrong password", service, "confirmed@example.com", "guess", OutcomeWrongPassword},
+		{"unconfirmed", service, "pending@example.com", "secret", OutcomeUnconfirmed},
+		{"unknown user", service, "nobody@example.com", "secret", OutcomeUnknownUser},
+		{"storage error", NewService(brokenStorage{storage.NewMemoryStorage()}), "confirmed@example.com", "secret", OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := countOutcome(t, func() {
+				tt.service.AuthenticateUser(tt.email, tt.password)
+			})
+			if len(delta) != 1 || delta[tt.want] != 1 {
+				t.Errorf("counter changes = %v, want only %s+1", delta, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUserWithTOTPIsNotYetSuccess(t *testing.T) {
+	service := newMFAService(t)
+	enrollAndConfirm(t, service, "test@example.com")
+
+	delta := countOutcome(t, func() {
+		if _, err := service.AuthenticateUser("test@example.com", "testpassword"); !errors.Is(err, ErrTOTPRequired) {
+			t.Errorf("AuthenticateUser = %v, want ErrTOTPRequired", err)
+		}
+	})
+	if len(delta) != 1 || delta[OutcomeTOTPRequired] != 1 {
+		t.Errorf("counter changes = %v, want only %s+1", delta, OutcomeTOTPRequired)
+	}
+
+	delta = countOutcome(t, func() {
+		service.AuthenticateUser("test@example.com", "guess")
+	})
+	if len(delta) != 1 || delta[OutcomeWrongPassword] != 1 {
+		t.Errorf("counter changes = %v, want only %s+1", delta, OutcomeWrongPassword)
+	}
+}
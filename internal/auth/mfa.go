@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+const (
+	mfaIssuer         = "TouchCalc"
+	recoveryCodeCount = 8
+)
+
+var (
+	ErrMFADisabled       = errors.New("multi-factor authentication is disabled")
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication already enabled")
+	ErrMFANotEnrolled    = errors.New("no pending multi-factor enrollment")
+	ErrInvalidMFACode    = errors.New("invalid verification code")
+
+	// ErrTOTPRequired is returned by AuthenticateUser for a correct
+	// password on an account with TOTP enabled; the login only succeeds
+	// once VerifySecondFactor accepts a code as well
+	ErrTOTPRequired = errors.New("verification code required")
+)
+
+// TOTPEnrollment is handed to the user once when they enroll an authenticator
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URL           string   `json:"otpauth_url"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SetMFAKey turns on TOTP support; secrets are stored sealed under key
+func (s *Service) SetMFAKey(key string) {
+	s.mfaKey = key
+}
+
+// MFAAvailable reports whether this deployment allows TOTP enrollment
+func (s *Service) MFAAvailable() bool {
+	return s.mfaKey != ""
+}
+
+// EnrollTOTP generates a new authenticator secret and recovery codes for the
+// user. The secret stays pending until confirmed with ConfirmTOTP.
+func (s *Service) EnrollTOTP(email string) (*TOTPEnrollment, error) {
+	if !s.MFAAvailable() {
+		return nil, ErrMFADisabled
+	}
+
+	user, err := s.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealSecret(s.mfaKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	user.TOTPSecret = sealed
+	user.RecoveryCodes = hashes
+	if err := s.setUser(user); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:        secret,
+		URL:           totpURL(mfaIssuer, user.Email, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmTOTP enables MFA once the user proves their authenticator works
+func (s *Service) ConfirmTOTP(email, code string) error {
+	if !s.MFAAvailable() {
+		return ErrMFADisabled
+	}
+
+	user, err := s.GetUser(email)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return ErrMFANotEnrolled
+	}
+
+	secret, err := openSecret(s.mfaKey, user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	if !validateTOTP(secret, code, time.Now()) {
+		return ErrInvalidMFACode
+	}
+
+	user.TOTPEnabled = true
+	return s.setUser(user)
+}
+
+// MFARequired reports whether logging in as email needs a second factor
+func (s *Service) MFARequired(email string) (bool, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+// VerifyTOTP reports whether code is the current TOTP code, give or take
+// one 30 second step, of email's authenticator. It is ErrMFANotEnrolled
+// for an account without TOTP enabled.
+func (s *Service) VerifyTOTP(email, code string) (bool, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return false, err
+	}
+	if !user.TOTPEnabled {
+		return false, ErrMFANotEnrolled
+	}
+	return s.checkTOTP(user, code)
+}
+
+// DisableTOTP turns off TOTP for email, forgetting the secret and any
+// recovery codes, so logging in needs only the password again
+func (s *Service) DisableTOTP(email string) error {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" && user.RecoveryCodes == nil {
+		return nil
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+	user.TOTPLastStep = 0
+	return s.setUser(user)
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. Recovery codes are consumed on use. A wrong code counts
+// as a failed login towards the lockout, a locked account is
+// ErrAccountLocked, and a right one clears the failed login count. The
+// record is updated through updateUser, so a recovery code can't be spent
+// twice by logins racing each other, and a code is only accepted once
+// the update is stored. The step of the last accepted TOTP code is kept,
+// so neither that code nor an older one works a second time.
+func (s *Service) VerifySecondFactor(email, code string) (bool, error) {
+	ok := false
+	err := s.updateUser(email, func(user *models.User) error {
+		ok = false
+		if !user.TOTPEnabled {
+			ok = true
+			return errUnchanged
+		}
+		if user.LockedUntil.After(s.now()) {
+			return ErrAccountLocked
+		}
+
+		secret, err := openSecret(s.mfaKey, user.TOTPSecret)
+		if err != nil {
+			return err
+		}
+		step, valid := matchTOTP(secret, code, s.now())
+		valid = valid && step > user.TOTPLastStep
+		consumed := !valid && consumeRecoveryCode(user, code)
+		if !valid && !consumed {
+			if !s.countFailedLogin(user) {
+				return errUnchanged
+			}
+			return nil
+		}
+		ok = true
+		if valid {
+			user.TOTPLastStep = step
+		}
+		resetFailedLogins(user)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// consumeRecoveryCode removes code from user's unused recovery codes,
+// reporting whether it was one of them
+func consumeRecoveryCode(user *models.User, code string) bool {
+	hashed := hashRecoveryCode(code)
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hashed)) == 1 {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i], user.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) checkTOTP(user *models.User, code string) (bool, error) {
+	secret, err := openSecret(s.mfaKey, user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	return validateTOTP(secret, code, s.now()), nil
+}
+
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newMFAService(t *testing.T) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetMFAKey("test-mfa-key")
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+func enrollAndConfirm(t *testing.T, service *Service, email string) *TOTPEnrollment {
+	enrollment, err := service.EnrollTOTP(email)
+	if err != nil {
+		t.Fatalf("EnrollTOTP failed: %v", err)
+	}
+	code, err := totpCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("totpCode failed: %v", err)
+	}
+	if err := service.ConfirmTOTP(email, code); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+	return enrollment
+}
+
+func TestTOTPMatchesRFC6238Vector(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret "12345678901234567890" at T=59s
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	code, err := totpCode(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("totpCode failed: %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("totpCode = %s, want 287082", code)
+	}
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+
+	enrollment, err := service.EnrollTOTP(email)
+	if err != nil {
+		t.Fatalf("EnrollTOTP failed: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URL, "otpauth://totp/") || !strings.Contains(enrollment.URL, enrollment.Secret) {
+		t.Errorf("unexpected provisioning URL %q", enrollment.URL)
+	}
+	if len(enrollment.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(enrollment.RecoveryCodes), recoveryCodeCount)
+	}
+
+	user, _ := service.GetUser(email)
+	if user.TOTPEnabled {
+		t.Error("MFA must stay disabled until the enrollment is confirmed")
+	}
+	if user.TOTPSecret == "" || strings.Contains(user.TOTPSecret, enrollment.Secret) {
+		t.Error("TOTP secret must be stored encrypted")
+	}
+
+	if err := service.ConfirmTOTP(email, "000000"); err != ErrInvalidMFACode {
+		t.Errorf("ConfirmTOTP with a wrong code = %v, want ErrInvalidMFACode", err)
+	}
+
+	code, _ := totpCode(enrollment.Secret, time.Now())
+	if err := service.ConfirmTOTP(email, code); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+	if required, _ := service.MFARequired(email); !required {
+		t.Error("MFA should be required after confirmation")
+	}
+}
+
+func TestEnrollTOTPDisabled(t *testing.T) {
+	service := NewService(storage.NewMemoryStorage())
+	service.CreateUser("test@example.com", "testpassword")
+
+	if _, err := service.EnrollTOTP("test@example.com"); err != ErrMFADisabled {
+		t.Errorf("EnrollTOTP without an MFA key = %v, want ErrMFADisabled", err)
+	}
+}
+
+func TestVerifySecondFactorCodes(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+	enrollment := enrollAndConfirm(t, service, email)
+
+	code, _ := totpCode(enrollment.Secret, time.Now())
+	if ok, err := service.VerifySecondFactor(email, code); err != nil || !ok {
+		t.Errorf("current code rejected: ok=%v err=%v", ok, err)
+	}
+
+	wrong := "000000"
+	if wrong == code {
+		wrong = "111111"
+	}
+	if ok, _ := service.VerifySecondFactor(email, wrong); ok {
+		t.Error("incorrect code should be rejected")
+	}
+
+	stale, _ := totpCode(enrollment.Secret, time.Now().Add(-5*time.Minute))
+	if ok, _ := service.VerifySecondFactor(email, stale); ok && stale != code {
+		t.Error("code from outside the skew window should be rejected")
+	}
+}
+
+func TestVerifySecondFactorRefusesReplayedCode(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+	enrollment := enrollAndConfirm(t, service, email)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	code, _ := totpCode(enrollment.Secret, now)
+	if ok, err := service.VerifySecondFactor(email, code); err != nil || !ok {
+		t.Fatalf("current code rejected: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := service.VerifySecondFactor(email, code); ok {
+		t.Error("an accepted code must not work again")
+	}
+	previous, _ := totpCode(enrollment.Secret, now.Add(-totpPeriod))
+	if ok, _ := service.VerifySecondFactor(email, previous); ok && previous != code {
+		t.Error("a code older than the last accepted one must be refused")
+	}
+
+	next, _ := totpCode(enrollment.Secret, now.Add(totpPeriod))
+	if ok, err := service.VerifySecondFactor(email, next); err != nil || !ok {
+		t.Errorf("code for a later step rejected: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestVerifySecondFactorRecoveryCode(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+	enrollment := enrollAndConfirm(t, service, email)
+
+	recovery := strings.ToUpper(enrollment.RecoveryCodes[0])
+	if ok, err := service.VerifySecondFactor(email, recovery); err != nil || !ok {
+		t.Fatalf("recovery code rejected: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := service.VerifySecondFactor(email, recovery); ok {
+		t.Error("a recovery code must only work once")
+	}
+
+	user, _ := service.GetUser(email)
+	if len(user.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("got %d remaining recovery codes, want %d", len(user.RecoveryCodes), recoveryCodeCount-1)
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+	enrollment := enrollAndConfirm(t, service, email)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	for _, step := range []int{-1, 0, 1} {
+		code, _ := totpCode(enrollment.Secret, now.Add(time.Duration(step)*totpPeriod))
+		if ok, err := service.VerifyTOTP(email, code); err != nil || !ok {
+			t.Errorf("code %d steps away rejected: ok=%v err=%v", step, ok, err)
+		}
+	}
+
+	current, _ := totpCode(enrollment.Secret, now)
+	for _, step := range []int{-3, 3} {
+		code, _ := totpCode(enrollment.Secret, now.Add(time.Duration(step)*totpPeriod))
+		if code == current {
+			continue
+		}
+		if ok, _ := service.VerifyTOTP(email, code); ok {
+			t.Errorf("code %d steps away accepted", step)
+		}
+	}
+	for _, code := range []string{"", "12345", "abcdef"} {
+		if ok, _ := service.VerifyTOTP(email, code); ok {
+			t.Errorf("malformed code %q accepted", code)
+		}
+	}
+
+	// Recovery codes are for logging in, not a TOTP code
+	if ok, _ := service.VerifyTOTP(email, enrollment.RecoveryCodes[0]); ok {
+		t.Error("VerifyTOTP accepted a recovery code")
+	}
+}
+
+func TestVerifyTOTPNotEnrolled(t *testing.T) {
+	service := newMFAService(t)
+
+	if _, err := service.VerifyTOTP("test@example.com", "123456"); err != ErrMFANotEnrolled {
+		t.Errorf("VerifyTOTP without TOTP = %v, want ErrMFANotEnrolled", err)
+	}
+}
+
+func TestAuthenticateUserRequiresTOTP(t *testing.T) {
+	service := newMFAService(t)
+	email := "test@example.com"
+	enrollAndConfirm(t, service, email)
+
+	if ok, err := service.AuthenticateUser(email, "testpassword"); ok || err != ErrTOTPRequired {
+		t.Errorf("correct password with TOTP on = %v, %v; want ErrTOTPRequired", ok, err)
+	}
+	if ok, err := service.AuthenticateUser(email, "wrongpassword"); ok || err == ErrTOTPRequired {
+		t.Errorf("wrong password with TOTP on = %v, %v; want a plain failure", ok, err)
+	}
+
+	if err := service.DisableTOTP(email); err != nil {
+		t.Fatalf("DisableTOTP failed: %v", err)
+	}
+	if ok, err := service.AuthenticateUser(email, "testpassword"); !ok || err != nil {
+		t.Errorf("password after DisableTOTP = %v, %v; want success", ok, err)
+	}
+	user, _ := service.GetUser(email)
+	if user.TOTPSecret != "" || user.RecoveryCodes != nil {
+		t.Error("DisableTOTP should forget the secret and recovery codes")
+	}
+}
+
+func TestSecondFactorFailuresLockTheAccount(t *testing.T) {
+	service := newMFAService(t)
+	service.SetLockout(3, 15*time.Minute)
+	email := "test@example.com"
+	enrollment := enrollAndConfirm(t, service, email)
+	code, _ := totpCode(enrollment.Secret, time.Now())
+	wrong := "000000"
+	if wrong == code {
+		wrong = "111111"
+	}
+
+	for i := 0; i < 3; i++ {
+		// The right password alone must not reset the count
+		if _, err := service.AuthenticateUser(email, "testpassword"); !errors.Is(err, ErrTOTPRequired) {
+			t.Fatalf("attempt %d: AuthenticateUser err = %v, want ErrTOTPRequired", i+1, err)
+		}
+		if ok, err := service.VerifySecondFactor(email, wrong); ok || err != nil {
+			t.Fatalf("attempt %d: ok=%v, err=%v; want a plain rejection", i+1, ok, err)
+		}
+	}
+
+	if ok, err := service.VerifySecondFactor(email, code); ok || !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("locked: ok=%v, err=%v; want ErrAccountLocked even for the right code", ok, err)
+	}
+	if ok, err := service.VerifySecondFactor(email, enrollment.RecoveryCodes[0]); ok || !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("locked: recovery code ok=%v, err=%v; want ErrAccountLocked", ok, err)
+	}
+}
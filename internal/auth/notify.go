@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"log"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// maxKnownIPs bounds how many login addresses are remembered per user
+const maxKnownIPs = 20
+
+// LoginNotifier is told about logins from an address the user hasn't used before
+type LoginNotifier interface {
+	NotifyNewLogin(email, ip string, at time.Time) error
+}
+
+// SetLoginNotifier enables new-login notifications; pass nil to disable them
+func (s *Service) SetLoginNotifier(notifier LoginNotifier) {
+	s.notifier = notifier
+}
+
+// RecordLogin stamps the login time and address on the user record and
+// notifies the user when the address is new to their account. The very
+// first login only establishes a baseline. It reports whether the address
+// was new.
+func (s *Service) RecordLogin(email, ip string) (bool, error) {
+	now := time.Now()
+	var newIP, notify bool
+	address := email
+	err := s.updateUser(email, func(user *models.User) error {
+		address = user.Email
+		newIP = ip != "" && !user.KnowsIP(ip)
+		notify = newIP && len(user.KnownIPs) > 0 && !user.LoginAlertsOff
+
+		user.LastLogin = now
+		user.LastLoginIP = ip
+		if newIP {
+			user.KnownIPs = append(user.KnownIPs, ip)
+			if len(user.KnownIPs) > maxKnownIPs {
+				user.KnownIPs = user.KnownIPs[len(user.KnownIPs)-maxKnownIPs:]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return newIP, err
+	}
+
+	if notify && s.notifier != nil {
+		if err := s.notifier.NotifyNewLogin(address, ip, now); err != nil {
+			log.Printf("Failed to send new login notification to %s: %v", address, err)
+		}
+	}
+
+	return newIP, nil
+}
+
+// SetLoginAlerts records the user's preference for new-login notifications
+func (s *Service) SetLoginAlerts(email string, enabled bool) error {
+	return s.updateUser(email, func(user *models.User) error {
+		if user.LoginAlertsOff == !enabled {
+			return errUnchanged
+		}
+		user.LoginAlertsOff = !enabled
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+type recordingNotifier struct {
+	notices []string
+}
+
+func (n *recordingNotifier) NotifyNewLogin(email, ip string, at time.Time) error {
+	n.notices = append(n.notices, email+" "+ip)
+	return nil
+}
+
+func newNotifyService(t *testing.T) (*Service, *recordingNotifier) {
+	mockStorage := storage.NewMemoryStorage()
+	service := NewService(mockStorage)
+	notifier := &recordingNotifier{}
+	service.SetLoginNotifier(notifier)
+
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service, notifier
+}
+
+func TestRecordLoginNotifiesOnNewIP(t *testing.T) {
+	service, notifier := newNotifyService(t)
+	email := "test@example.com"
+
+	// First login establishes the baseline without a notice
+	if _, err := service.RecordLogin(email, "10.0.0.1"); err != nil {
+		t.Fatalf("RecordLogin failed: %v", err)
+	}
+	if len(notifier.notices) != 0 {
+		t.Fatalf("first login should not notify, got %v", notifier.notices)
+	}
+
+	newIP, err := service.RecordLogin(email, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("RecordLogin failed: %v", err)
+	}
+	if !newIP {
+		t.Error("login from an unseen address should be reported as new")
+	}
+	if len(notifier.notices) != 1 {
+		t.Fatalf("login from a new address should notify once, got %v", notifier.notices)
+	}
+
+	newIP, err = service.RecordLogin(email, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("RecordLogin failed: %v", err)
+	}
+	if newIP {
+		t.Error("repeat login from a known address should not be reported as new")
+	}
+	if len(notifier.notices) != 1 {
+		t.Errorf("repeat login should not notify again, got %v", notifier.notices)
+	}
+
+	user, err := service.GetUser(email)
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if user.LastLoginIP != "203.0.113.7" || user.LastLogin.IsZero() {
+		t.Errorf("login activity not recorded: ip=%q at=%v", user.LastLoginIP, user.LastLogin)
+	}
+}
+
+func TestRecordLoginRespectsUserPreference(t *testing.T) {
+	service, notifier := newNotifyService(t)
+	email := "test@example.com"
+
+	if err := service.SetLoginAlerts(email, false); err != nil {
+		t.Fatalf("SetLoginAlerts failed: %v", err)
+	}
+	service.RecordLogin(email, "10.0.0.1")
+	service.RecordLogin(email, "203.0.113.7")
+
+	if len(notifier.notices) != 0 {
+		t.Errorf("user opted out of login alerts, got %v", notifier.notices)
+	}
+}
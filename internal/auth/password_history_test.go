@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUpdatePasswordRefusesRecentPasswords(t *testing.T) {
+	if err := models.SetPasswordHashCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.SetPasswordHashCost(bcrypt.DefaultCost) })
+
+	service := NewService(storage.NewMemoryStorage())
+	service.SetPasswordHistory(3)
+	if err := service.CreateUser("user@example.com", "password-0"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := service.UpdatePassword("user@example.com", fmt.Sprintf("password-%d", i)); err != nil {
+			t.Fatalf("UpdatePassword(password-%d) failed: %v", i, err)
+		}
+	}
+
+	// password-3 is current and 1 and 2 came before it; 0 has rolled off
+	for i := 1; i <= 3; i++ {
+		err := service.UpdatePassword("user@example.com", fmt.Sprintf("password-%d", i))
+		if !errors.Is(err, models.ErrPasswordReused) {
+			t.Errorf("reusing password-%d: err = %v, want ErrPasswordReused", i, err)
+		}
+	}
+	if ok, _ := service.AuthenticateUser("user@example.com", "password-3"); !ok {
+		t.Fatal("refused changes should leave the current password working")
+	}
+	if err := service.UpdatePassword("user@example.com", "password-0"); err != nil {
+		t.Errorf("reusing the rolled-off password-0: err = %v", err)
+	}
+
+	user, err := service.GetUser("user@example.com")
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if len(user.PasswordHistory) != 3 {
+		t.Errorf("history holds %d hashes, want the cap of 3", len(user.PasswordHistory))
+	}
+}
+
+func TestPasswordHistoryDisabled(t *testing.T) {
+	if err := models.SetPasswordHashCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.SetPasswordHashCost(bcrypt.DefaultCost) })
+
+	service := NewService(storage.NewMemoryStorage())
+	service.SetPasswordHistory(0)
+	if err := service.CreateUser("user@example.com", "password-0"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := service.UpdatePassword("user@example.com", "password-0"); err != nil {
+		t.Errorf("with history off the same password should be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// TokenDir holds outstanding password reset tokens, under home/
+const TokenDir = "tokens"
+
+// DefaultResetTokenTTL is how long a reset link works unless configured
+const DefaultResetTokenTTL = time.Hour
+
+var (
+	// ErrInvalidResetToken is returned for a reset token that was never
+	// issued or has already been used
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+
+	// ErrExpiredResetToken is returned for a reset token past its expiry
+	ErrExpiredResetToken = errors.New("password reset token has expired")
+)
+
+// resetToken is the stored record of an issued token. It is kept under the
+// token's hash, so reading storage doesn't yield working reset links.
+type resetToken struct {
+	Email   string    `json:"email"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetResetTokenTTL sets how long tokens from GeneratePasswordResetToken
+// stay valid; zero or less restores DefaultResetTokenTTL
+func (s *Service) SetResetTokenTTL(ttl time.Duration) {
+	s.resetTokenTTL = ttl
+}
+
+// GeneratePasswordResetToken issues a single-use token that lets whoever
+// holds it set email's password until it expires
+func (s *Service) GeneratePasswordResetToken(email string) (string, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	ttl := s.resetTokenTTL
+	if ttl <= 0 {
+		ttl = DefaultResetTokenTTL
+	}
+	record, err := json.Marshal(resetToken{Email: user.Email, Expires: s.now().Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	if err := s.storage.PutItem(resetTokenPath(token), string(record)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ValidatePasswordResetToken returns the user token was issued for. It is
+// ErrInvalidResetToken for an unknown or used token and ErrExpiredResetToken
+// once it has expired. The token stays valid until invalidated.
+func (s *Service) ValidatePasswordResetToken(token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidResetToken
+	}
+	data, err := s.storage.GetItem(resetTokenPath(token))
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var record resetToken
+	if err := json.Unmarshal([]byte(data), &record); err != nil || record.Email == "" {
+		return "", ErrInvalidResetToken
+	}
+	if !s.now().Before(record.Expires) {
+		return "", ErrExpiredResetToken
+	}
+	return record.Email, nil
+}
+
+// InvalidatePasswordResetToken uses up token, so it can't reset the
+// password again
+func (s *Service) InvalidatePasswordResetToken(token string) error {
+	err := s.storage.DeleteItem(resetTokenPath(token))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func resetTokenPath(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return strings.Join([]string{"home", TokenDir, hex.EncodeToString(sum[:])}, "/")
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+func newResetService(t *testing.T) (*Service, *storage.MemoryStorage) {
+	mockStorage := storage.NewMemoryStorage()
+	service := NewService(mockStorage)
+	if err := service.CreateUser("test@example.com", "testpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service, mockStorage
+}
+
+func TestPasswordResetToken(t *testing.T) {
+	service, mockStorage := newResetService(t)
+
+	token, err := service.GeneratePasswordResetToken("Test@Example.com")
+	if err != nil {
+		t.Fatalf("GeneratePasswordResetToken failed: %v", err)
+	}
+	if email, err := service.ValidatePasswordResetToken(token); err != nil || email != "test@example.com" {
+		t.Errorf("ValidatePasswordResetToken = %q, %v; want test@example.com", email, err)
+	}
+	paths, _ := mockStorage.ListItems("")
+	for _, path := range paths {
+		record, _ := mockStorage.GetItem(path)
+		if strings.Contains(path, token) || strings.Contains(record, token) {
+			t.Errorf("the token itself should not be stored, found it at %s", path)
+		}
+	}
+
+	if err := service.InvalidatePasswordResetToken(token); err != nil {
+		t.Fatalf("InvalidatePasswordResetToken failed: %v", err)
+	}
+	if _, err := service.ValidatePasswordResetToken(token); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reused token: err = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	service, _ := newResetService(t)
+	service.SetResetTokenTTL(30 * time.Minute)
+	issued := time.Now()
+	service.now = func() time.Time { return issued }
+
+	token, err := service.GeneratePasswordResetToken("test@example.com")
+	if err != nil {
+		t.Fatalf("GeneratePasswordResetToken failed: %v", err)
+	}
+
+	service.now = func() time.Time { return issued.Add(29 * time.Minute) }
+	if _, err := service.ValidatePasswordResetToken(token); err != nil {
+		t.Errorf("token within its TTL: err = %v", err)
+	}
+	service.now = func() time.Time { return issued.Add(30 * time.Minute) }
+	if _, err := service.ValidatePasswordResetToken(token); !errors.Is(err, ErrExpiredResetToken) {
+		t.Errorf("expired token: err = %v, want ErrExpiredResetToken", err)
+	}
+}
+
+func TestPasswordResetTokenRejectsUnknown(t *testing.T) {
+	service, _ := newResetService(t)
+
+	for _, token := range []string{"", "not-a-token"} {
+		if _, err := service.ValidatePasswordResetToken(token); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("token %q: err = %v, want ErrInvalidResetToken", token, err)
+		}
+	}
+	if _, err := service.GeneratePasswordResetToken("nobody@example.com"); err == nil {
+		t.Error("expected no token for an unknown user")
+	}
+}
@@ -0,0 +1,26 @@
+package auth
+
+// SetRevokeSessionsOnPasswordChange controls whether UpdatePassword bumps
+// the user's token version, logging out every session issued before it
+func (s *Service) SetRevokeSessionsOnPasswordChange(enabled bool) {
+	s.revokeOnPasswordChange = enabled
+}
+
+// TokenVersion returns the version new sessions for email should carry
+func (s *Service) TokenVersion(email string) (int, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
+
+// ValidSession reports whether a session for email issued at version is
+// still current. Unknown users never have a valid session.
+func (s *Service) ValidSession(email string, version int) bool {
+	current, err := s.TokenVersion(email)
+	if err != nil {
+		return false
+	}
+	return current == version
+}
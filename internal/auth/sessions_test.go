@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func newSessionService(t *testing.T, revoke bool) *Service {
+	service := NewService(storage.NewMemoryStorage())
+	service.SetRevokeSessionsOnPasswordChange(revoke)
+	if err := service.CreateUser("test@example.com", "oldpassword"); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return service
+}
+
+// requestWithSession calls a route guarded by AuthRequired using the
+// cookies a session issued at version would carry
+func requestWithSession(service *Service, version int) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	validate := func(c *gin.Context, user string, version int) bool {
+		return service.ValidSession(user, version)
+	}
+	router.GET("/profile", middleware.AuthRequired(validate), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "test@example.com"})
+	req.AddCookie(&http.Cookie{Name: middleware.SessionVersionCookie, Value: strconv.Itoa(version)})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestPasswordChangeRevokesOldSessions(t *testing.T) {
+	service := newSessionService(t, true)
+
+	oldVersion, err := service.TokenVersion("test@example.com")
+	if err != nil {
+		t.Fatalf("TokenVersion failed: %v", err)
+	}
+	if code := requestWithSession(service, oldVersion); code != http.StatusOK {
+		t.Fatalf("session before password change got %d, want 200", code)
+	}
+
+	if err := service.UpdatePassword("test@example.com", "newpassword"); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+
+	if code := requestWithSession(service, oldVersion); code != http.StatusUnauthorized {
+		t.Errorf("stale session got %d, want 401", code)
+	}
+
+	// The session that changed the password is re-issued at the new version
+	newVersion, err := service.TokenVersion("test@example.com")
+	if err != nil {
+		t.Fatalf("TokenVersion failed: %v", err)
+	}
+	if code := requestWithSession(service, newVersion); code != http.StatusOK {
+		t.Errorf("re-issued session got %d, want 200", code)
+	}
+}
+
+func TestPasswordChangeKeepsSessionsWhenDisabled(t *testing.T) {
+	service := newSessionService(t, false)
+
+	if err := service.UpdatePassword("test@example.com", "newpassword"); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	if code := requestWithSession(service, 0); code != http.StatusOK {
+		t.Errorf("session got %d after password change with revocation off, want 200", code)
+	}
+}
+
+func TestValidSessionUnknownUser(t *testing.T) {
+	service := newSessionService(t, true)
+	if service.ValidSession("nobody@example.com", 0) {
+		t.Error("session for unknown user should be invalid")
+	}
+}
+
+func TestPasswordChangeKeepsConcurrentWrites(t *testing.T) {
+	service := newSessionService(t, true)
+	service.SetLockout(100, 15*time.Minute)
+
+	// Failed logins landing while the password changes are all counted,
+	// and the version bump survives them
+	var wg sync.WaitGroup
+	var counted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.AuthenticateUser("test@example.com", "wrong"); err == nil {
+				counted.Add(1)
+			}
+		}()
+	}
+	if err := service.UpdatePassword("test@example.com", "newpassword"); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	wg.Wait()
+
+	user, _ := service.GetUser("test@example.com")
+	if user.TokenVersion != 1 {
+		t.Errorf("TokenVersion = %d, want 1", user.TokenVersion)
+	}
+	if user.FailedAttempts != int(counted.Load()) {
+		t.Errorf("FailedAttempts = %d, want the %d failures that were recorded", user.FailedAttempts, counted.Load())
+	}
+}
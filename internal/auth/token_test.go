@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTokenSecret turns tokens on for the duration of a test
+func useTokenSecret(t *testing.T, secret string, ttl time.Duration) {
+	t.Helper()
+	SetTokenSecret(secret, ttl)
+	t.Cleanup(func() {
+		SetTokenSecret("", 24*time.Hour)
+		tokenNow = time.Now
+	})
+}
+
+func TestIssueAndParseToken(t *testing.T) {
+	useTokenSecret(t, "secret", time.Hour)
+
+	token, err := IssueToken("alice@example.com", 3)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	if parts := strings.Split(token, "."); len(parts) != 3 {
+		t.Fatalf("token %q is not a three-part JWT", token)
+	}
+	email, version, err := ParseToken(token)
+	if err != nil || email != "alice@example.com" || version != 3 {
+		t.Errorf("ParseToken = %q, %d, %v; want alice@example.com at version 3", email, version, err)
+	}
+}
+
+func TestParseTokenRejectsTampering(t *testing.T) {
+	useTokenSecret(t, "secret", time.Hour)
+	token, err := IssueToken("alice@example.com", 0)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	// Swapping in another subject or version keeps the signature of the
+	// original
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"victim@example.com","iat":0,"exp":9999999999}`))
+	bumped := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice@example.com","iat":0,"exp":9999999999,"ver":7}`))
+	sigBytes, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	sigBytes[0] ^= 0xff
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	cases := map[string]string{
+		"forged claims":  parts[0] + "." + forged + "." + parts[2],
+		"forged version": parts[0] + "." + bumped + "." + parts[2],
+		"bad signature":  parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(sigBytes),
+		"alg none":       unsigned + "." + parts[1] + ".",
+		"truncated":      parts[0] + "." + parts[1],
+		"plain email":    "victim@example.com",
+	}
+	for name, tampered := range cases {
+		if _, _, err := ParseToken(tampered); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// A token signed under another secret is no better than a forgery
+	SetTokenSecret("rotated", time.Hour)
+	if _, _, err := ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("after rotating the secret: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestParseTokenRejectsExpired(t *testing.T) {
+	useTokenSecret(t, "secret", time.Hour)
+	issued := time.Now()
+	tokenNow = func() time.Time { return issued }
+	token, err := IssueToken("alice@example.com", 0)
+	if err != nil {
+		t.Fatalf("IssueToken failed: %v", err)
+	}
+
+	tokenNow = func() time.Time { return issued.Add(59 * time.Minute) }
+	if _, _, err := ParseToken(token); err != nil {
+		t.Errorf("token within its lifetime: err = %v", err)
+	}
+	tokenNow = func() time.Time { return issued.Add(time.Hour) }
+	if _, _, err := ParseToken(token); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expired token: err = %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestTokensNeedASecret(t *testing.T) {
+	if _, err := IssueToken("alice@example.com", 0); !errors.Is(err, ErrTokensDisabled) {
+		t.Errorf("IssueToken without a secret: err = %v, want ErrTokensDisabled", err)
+	}
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -22,12 +25,346 @@ type Config struct {
     MongoURI       string
     MongoDatabase  string
     MySQLDSN       string
+    // Create the MySQL table, or add missing columns, at startup; off,
+    // a schema that doesn't match fails startup instead
+    MySQLAutoMigrate bool
+    // MySQL connection pool: at most MySQLMaxOpenConns connections, of
+    // which MySQLMaxIdleConns are kept idle, each closed after
+    // MySQLConnMaxLifetime; zero leaves database/sql's default
+    MySQLMaxOpenConns    int
+    MySQLMaxIdleConns    int
+    MySQLConnMaxLifetime time.Duration
+    // Redis server for STORAGE_BACKEND=redis, e.g. redis://:password@host:6379/0
+    RedisURI       string
+    // Directory holding items for STORAGE_BACKEND=fs
+    FSRoot         string
 
 	MinIOEndpoint   string
     MinIOAccessKey  string
     MinIOSecretKey  string
     MinIOBucket     string
     MinIOSSL        string
+
+	// Email users when they log in from an address not seen before
+	LoginNotifications bool
+
+	// Directory of operator copies of the email templates, as
+	// <name>.html or <locale>/<name>.html; empty uses the built-ins
+	EmailTemplatesPath string
+
+	// Upper bounds on auth form input; zero disables the check. Passwords
+	// are measured in bytes and can't exceed bcrypt's 72 in any case.
+	MaxEmailLength    int
+	MaxPasswordLength int
+	MaxFieldLength    int
+
+	// Optional TOTP second factor; secrets are sealed with MFAEncryptionKey,
+	// falling back to CookieSecret when unset
+	MFAEnabled       bool
+	MFAEncryptionKey string
+
+	// Where GET /login and /register send users who are already logged
+	// in; empty shows the forms regardless
+	LoginRedirectURL string
+
+	// Absolute URLs logout may send users to with ?next=, matched by
+	// scheme, host and path prefix; local paths are always allowed and
+	// anything else falls back to /login
+	LogoutRedirectAllowlist []string
+
+	// How long a login lasts, and the window after expiry during which
+	// the user is offered a re-auth prompt instead of being logged out
+	SessionLifetime    time.Duration
+	SessionGracePeriod time.Duration
+
+	// Key signing session tokens (JWTs). When set, logins get a signed
+	// token cookie and the plain user cookie is no longer trusted. The
+	// server refuses to start in production without it.
+	JWTSecret string
+
+	// Treat re-creating an existing user with the same password as success,
+	// so retried registrations don't fail
+	IdempotentCreate bool
+
+	// Known-breached passwords rejected at registration and reset: a file
+	// of SHA-1 hashes or a Pwned Passwords style range URL; empty disables
+	PasswordDenylist string
+
+	// bcrypt cost new password hashes are made with, between 4 and 31;
+	// existing hashes keep theirs until the password next changes
+	BcryptCost int
+
+	// How long a password reset link works
+	PasswordResetTTL time.Duration
+
+	// Recent passwords, the current one included, a password reset may
+	// not set again; zero disables the check
+	PasswordHistory int
+
+	// Create accounts unconfirmed and email a confirmation link, valid for
+	// ConfirmTokenTTL, which must be followed before they can log in
+	RequireEmailConfirmation bool
+	ConfirmTokenTTL          time.Duration
+
+	// Consecutive failed logins that lock an account, and for how long;
+	// zero attempts disables lockout
+	LockoutAttempts int
+	LockoutCooldown time.Duration
+
+	// Leave a tombstone with the deletion reason when an account is
+	// deleted, and the longest reason accepted
+	SoftDeleteUsers         bool
+	DeletionReasonMaxLength int
+
+	// Entitlements granted to users who haven't been given their own, e.g.
+	// pdf_export,dropbox_sync
+	DefaultEntitlements []string
+
+	// Invalidate a user's other sessions when their password changes
+	LogoutOnPasswordChange bool
+
+	// /health/ready reports degraded once this share of the storage
+	// connection pool is in use, or local disk free space drops below
+	// HealthMinDiskFreePercent
+	HealthPoolSaturationPercent int
+	HealthMinDiskFreePercent    int
+
+	// Upper bound on each readiness sub-check, so a hung backend reports
+	// unhealthy promptly instead of stalling the probe
+	HealthCheckTimeout time.Duration
+
+	// Limits on calls out to other services (password denylist, Dropbox):
+	// connecting, waiting for response headers, and the whole call, plus
+	// idle keep-alive connections kept per host
+	OutboundDialTimeout     time.Duration
+	OutboundResponseTimeout time.Duration
+	OutboundTimeout         time.Duration
+	OutboundMaxIdlePerHost  int
+
+	// Recovery from a dropped MongoDB/MySQL connection: operations failing
+	// on a dead connection are retried ReconnectRetries times, backing off
+	// from ReconnectBackoff, and storage is pinged every
+	// ReconnectCheckInterval to reset the pool once it is back (0 disables)
+	ReconnectRetries       int
+	ReconnectBackoff       time.Duration
+	ReconnectCheckInterval time.Duration
+
+	// Add Server-Timing headers with handler and storage durations. In
+	// production they are only sent to clients allowed to reach /admin.
+	ServerTiming bool
+
+	// Gzip responses of at least GzipMinSize bytes for clients accepting
+	// it; turn off when a proxy in front already compresses
+	Gzip        bool
+	GzipMinSize int
+
+	// Context fields appended to each access log line, e.g. user,request_id,route
+	LogContextFields []string
+	// Access log format: "text" lines or "json" objects, one per request
+	LogFormat string
+
+	// Fail pages whose template references a key the handler didn't
+	// provide, logging the error, instead of rendering it empty. Ignored
+	// in production, which always stays lenient.
+	StrictTemplates bool
+
+	// Indent JSON responses by default; ?pretty=1 or ?pretty=0 overrides
+	// per request. Ignored in production, which defaults to compact.
+	PrettyJSON bool
+
+	// Answer OPTIONS with the matched route's methods in an Allow header,
+	// rather than a bare 204 for any path
+	RouteOptions bool
+
+	// Optional startup warm-up: ping storage, pre-open WarmupConnections
+	// pooled connections and pre-parse templates before serving
+	WarmupEnabled     bool
+	WarmupConnections int
+
+	// Command line of the HTML-to-PDF renderer, fed HTML on stdin and
+	// writing the PDF to stdout. PDFSelfTest renders a test page at
+	// startup; with PDFSelfTestRequired a failure also fails readiness.
+	PDFEngine           string
+	PDFSelfTest         bool
+	PDFSelfTestRequired bool
+
+	// Revisions kept per sheet; older ones are pruned on save. Zero means
+	// unlimited
+	MaxRevisionsPerSheet int
+
+	// Most sheets POST /api/sheets/delete accepts at once; zero disables
+	// the limit
+	MaxBulkDelete int
+
+	// Allow sheet names differing only in case or spacing, such as
+	// "Budget" and "budget", in one user's space. Off, creating such a
+	// sheet is refused with 409
+	AllowDuplicateSheetNames bool
+
+	// Create a starter sheet for users opening /save for the first time;
+	// either way users with no sheets are flagged for onboarding
+	StarterSheet bool
+
+	// Deleted sheets move to this directory under the user's home and are
+	// emptied after TrashRetention; an empty TrashDir deletes immediately,
+	// a zero retention keeps them until restored
+	TrashDir       string
+	TrashRetention time.Duration
+
+	// Render a small preview image of each sheet in the background when
+	// it is saved, served at /api/sheets/:name/thumbnail and cached by
+	// browsers for ThumbnailMaxAge
+	Thumbnails      bool
+	ThumbnailWidth  int
+	ThumbnailHeight int
+	ThumbnailMaxAge time.Duration
+
+	// Buffer sheet change-log entries and write them ChangeLogBatchSize at
+	// a time or every ChangeLogFlushInterval; a size of 0 or 1 writes each
+	// entry immediately
+	ChangeLogBatchSize     int
+	ChangeLogFlushInterval time.Duration
+
+	// Largest sheet, in bytes, accepted by /save; zero disables the check
+	MaxSheetSize int
+
+	// What /import does with files whose type can't be determined from
+	// their extension or content: "reject" them with 415, or keep them as
+	// opaque "binary" stored as-is
+	ImportUnknownTypes string
+
+	// Largest file, in bytes, /downloadfile sends; zero disables the
+	// check. Larger ones are refused with 413, or with "truncate" sent
+	// cut short as a 206 partial response.
+	MaxDownloadSize    int
+	OversizedDownloads string
+
+	// Signed /d/ download links: the HMAC key, without which links are
+	// disabled, and how long links work
+	DownloadLinkSecret string
+	DownloadLinkTTL    time.Duration
+
+	// Uploads to /import and /htmltopdf handled at once, across both
+	// routes, and the largest body either accepts in bytes; beyond them
+	// uploads get 503 and 413. Zero disables either limit.
+	UploadConcurrency int
+	UploadMaxSize     int
+	// Largest request body, in bytes, for routes without a limit of their
+	// own (uploads have UploadMaxSize, sheet saves room for MaxSheetSize);
+	// beyond it requests get 413. Zero disables it.
+	MaxBodySize int
+
+	// Content type stored items are tagged with, e.g. on S3 objects
+	StorageContentType string
+
+	// Cache files read from storage in memory, up to CacheMaxEntries of
+	// them for CacheTTL each. Writes by this instance invalidate what they
+	// change; with several instances, others' writes show after CacheTTL.
+	EnableCache     bool
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+
+	// Hosts serving a tenant, as host -> tenant, and the tenants with a
+	// storage backend of their own, as tenant -> "backend:target" (see
+	// storage.NewTenantStorage). Other hosts use the shared backend.
+	TenantHosts   map[string]string
+	TenantStorage map[string]string
+
+	// Proxies whose forwarded headers are trusted for the client IP, and
+	// the networks allowed (minus those denied) to reach /admin
+	TrustedProxies  []string
+	AdminAllowCIDRs []string
+	AdminDenyCIDRs  []string
+	// Users who may use /admin even without the admin entitlement on
+	// their record, so the first admin can be set up
+	AdminUsers []string
+
+	// Regular expressions matched against the User-Agent; matching
+	// requests other than health checks get 403. Empty blocks nothing.
+	BlockedUserAgents []string
+
+	// Host every other host name is redirected to, e.g. example.com so
+	// www.example.com doesn't split cookies; empty serves any host. With
+	// PublicScheme it also makes the links in emails.
+	CanonicalHost string
+	PublicScheme  string
+
+	// Origins allowed to make credentialed cross-origin requests, e.g.
+	// https://app.example.com; empty allows any origin
+	AllowedOrigins []string
+
+	// How long a graceful shutdown may take, across every component; the
+	// process exits non-zero when it runs out with requests in flight
+	ShutdownTimeout time.Duration
+
+	// How long a request may run before it gets 503 and its context is
+	// cancelled; zero disables it. WebSocket connections aren't limited.
+	RequestTimeout time.Duration
+
+	// Per-IP rate limit in requests per second, with bursts of up to
+	// RateLimitBurst; zero disables it. Clients idle for RateLimitIdleTTL
+	// are forgotten, and past RateLimitMaxTracked clients their counts
+	// are pooled under one entry in /admin/ratelimit. A slow start initial
+	// fraction above zero starts new clients at that share of the limit,
+	// growing it by the step with each allowed request (see
+	// middleware.SlowStart).
+	RateLimitRPS              int
+	RateLimitBurst            int
+	RateLimitIdleTTL          time.Duration
+	RateLimitMaxTracked       int
+	RateLimitSlowStartInitial float64
+	RateLimitSlowStartStep    float64
+
+	// Stricter per-IP limit on POST /iauth, /login and /register, shared
+	// across the three; zero disables it. With
+	// AuthRateLimitTrustForwardedFor clients are told apart by the address
+	// the proxy in front appended to X-Forwarded-For.
+	AuthRateLimitRPS               float64
+	AuthRateLimitBurst             int
+	AuthRateLimitTrustForwardedFor bool
+
+	// Per-IP reputation: client errors, throttled requests and failed
+	// logins add to an IP's score, which halves every ReputationHalfLife,
+	// and IPs scoring ReputationBlockScore or more are refused with 403;
+	// zero disables it. Scores live in the "shared" storage backend, seen
+	// by every instance, or in "local" memory per instance.
+	ReputationBlockScore float64
+	ReputationHalfLife   time.Duration
+	ReputationStore      string
+
+	// Fraction of requests, 0 to 1, whose anonymized shape (method, route
+	// template, status, timing, redacted parameters) is kept for
+	// /admin/samples; zero disables sampling. The latest
+	// RequestSampleSize samples are kept, and values of parameters named
+	// like any of RequestSampleRedact, or of a built-in list of names such
+	// as password and token when empty, are never recorded.
+	RequestSampleRate   float64
+	RequestSampleSize   int
+	RequestSampleRedact []string
+
+	// Requests each logged-in user may have in flight at once, beyond
+	// which they get 429; zero disables it
+	UserConcurrency int
+
+	// WebSocket connections open at once, server-wide and per user;
+	// upgrades beyond either are closed with code 1013. Zero disables a cap.
+	WebSocketMaxConnections int
+	WebSocketMaxPerUser     int
+
+	// Certificate and key for serving TLS directly; when both are empty
+	// the server speaks plain HTTP, as behind nginx. Handshakes below
+	// TLSMinVersion are refused, and TLSCipherSuites, when set, limits
+	// the suites offered up to TLS 1.2.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSCipherSuites []string
+}
+
+// privateNetworks are the loopback and private ranges
+var privateNetworks = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
 }
 
 func Load() *Config {
@@ -49,12 +386,158 @@ func Load() *Config {
         MongoURI:      getEnv("MONGO_URI", "mongodb://localhost:27017"),
         MongoDatabase: getEnv("MONGO_DATABASE", "touchcalc"),
         MySQLDSN:      getEnv("MYSQL_DSN", "root:password@tcp(localhost:3306)/touchcalc"),
+        MySQLAutoMigrate: getEnvBool("MYSQL_AUTO_MIGRATE", true),
+        MySQLMaxOpenConns:    getEnvInt("MYSQL_MAX_OPEN_CONNS", 25),
+        MySQLMaxIdleConns:    getEnvInt("MYSQL_MAX_IDLE_CONNS", 10),
+        MySQLConnMaxLifetime: getEnvDuration("MYSQL_CONN_MAX_LIFETIME", 5*time.Minute),
+        RedisURI:      getEnv("REDIS_URI", "redis://localhost:6379/0"),
+        FSRoot:        getEnv("FS_ROOT", "./data"),
 
 		MinIOEndpoint:  getEnv("MINIO_ENDPOINT", "localhost:9000"),
         MinIOAccessKey: getEnv("MINIO_ACCESS_KEY", "minioadmin"),
         MinIOSecretKey: getEnv("MINIO_SECRET_KEY", "minioadmin"),
         MinIOBucket:    getEnv("MINIO_BUCKET", "touchcalc-storage"),
         MinIOSSL:       getEnv("MINIO_SSL", "false"),
+
+		LoginNotifications: getEnvBool("LOGIN_NOTIFICATIONS", false),
+		EmailTemplatesPath: getEnv("EMAIL_TEMPLATES_PATH", ""),
+
+		MaxEmailLength:    getEnvInt("MAX_EMAIL_LENGTH", 254),
+		MaxPasswordLength: getEnvInt("MAX_PASSWORD_LENGTH", 72),
+		MaxFieldLength:    getEnvInt("MAX_FIELD_LENGTH", 256),
+
+		MFAEnabled:       getEnvBool("MFA_ENABLED", false),
+		MFAEncryptionKey: getEnv("MFA_ENCRYPTION_KEY", ""),
+
+		LoginRedirectURL:        getEnv("LOGIN_REDIRECT_URL", "/browser"),
+		LogoutRedirectAllowlist: getEnvList("LOGOUT_REDIRECT_ALLOWLIST"),
+
+		SessionLifetime:    getEnvDuration("SESSION_LIFETIME", 24*time.Hour),
+		SessionGracePeriod: getEnvDuration("SESSION_GRACE_PERIOD", 0),
+		JWTSecret:          getEnv("JWT_SECRET", ""),
+
+		IdempotentCreate: getEnvBool("IDEMPOTENT_CREATE", false),
+		PasswordDenylist: getEnv("PASSWORD_DENYLIST", ""),
+		BcryptCost:       getEnvInt("BCRYPT_COST", 10),
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordHistory:  getEnvInt("PASSWORD_HISTORY", 5),
+		LockoutAttempts:  getEnvInt("LOCKOUT_ATTEMPTS", 5),
+		LockoutCooldown:  getEnvDuration("LOCKOUT_COOLDOWN", 15*time.Minute),
+
+		RequireEmailConfirmation: getEnvBool("REQUIRE_EMAIL_CONFIRMATION", false),
+		ConfirmTokenTTL:          getEnvDuration("CONFIRM_TOKEN_TTL", 48*time.Hour),
+
+		SoftDeleteUsers:         getEnvBool("SOFT_DELETE_USERS", false),
+		DeletionReasonMaxLength: getEnvInt("DELETION_REASON_MAX_LENGTH", 500),
+
+		DefaultEntitlements: getEnvListOr("DEFAULT_ENTITLEMENTS", []string{"pdf_export", "dropbox_sync"}),
+
+		LogoutOnPasswordChange: getEnvBool("LOGOUT_ON_PASSWORD_CHANGE", true),
+
+		HealthPoolSaturationPercent: getEnvInt("HEALTH_POOL_SATURATION_PERCENT", 100),
+		HealthMinDiskFreePercent:    getEnvInt("HEALTH_MIN_DISK_FREE_PERCENT", 10),
+		HealthCheckTimeout:          getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+
+		OutboundDialTimeout:     getEnvDuration("OUTBOUND_DIAL_TIMEOUT", 5*time.Second),
+		OutboundResponseTimeout: getEnvDuration("OUTBOUND_RESPONSE_TIMEOUT", 10*time.Second),
+		OutboundTimeout:         getEnvDuration("OUTBOUND_TIMEOUT", 30*time.Second),
+		OutboundMaxIdlePerHost:  getEnvInt("OUTBOUND_MAX_IDLE_PER_HOST", 10),
+
+		ReconnectRetries:       getEnvInt("RECONNECT_RETRIES", 2),
+		ReconnectBackoff:       getEnvDuration("RECONNECT_BACKOFF", 200*time.Millisecond),
+		ReconnectCheckInterval: getEnvDuration("RECONNECT_CHECK_INTERVAL", 5*time.Second),
+
+		LogContextFields: getEnvList("LOG_CONTEXT_FIELDS"),
+		LogFormat:        getEnv("LOG_FORMAT", "text"),
+		ServerTiming:     getEnvBool("SERVER_TIMING", false),
+		Gzip:             getEnvBool("GZIP", true),
+		GzipMinSize:      getEnvInt("GZIP_MIN_SIZE", 1024),
+		RouteOptions:     getEnvBool("ROUTE_OPTIONS", true),
+		StrictTemplates:  getEnvBool("STRICT_TEMPLATES", false),
+		PrettyJSON:       getEnvBool("PRETTY_JSON", false),
+
+		WarmupEnabled:     getEnvBool("WARMUP_ENABLED", false),
+		WarmupConnections: getEnvInt("WARMUP_CONNECTIONS", 4),
+
+		PDFEngine:           getEnv("PDF_ENGINE", ""),
+		PDFSelfTest:         getEnvBool("PDF_SELF_TEST", false),
+		PDFSelfTestRequired: getEnvBool("PDF_SELF_TEST_REQUIRED", false),
+
+		MaxRevisionsPerSheet: getEnvInt("MAX_REVISIONS_PER_SHEET", 20),
+		MaxSheetSize:         getEnvInt("MAX_SHEET_SIZE", 5<<20),
+		ImportUnknownTypes:   getEnv("IMPORT_UNKNOWN_TYPES", "binary"),
+		MaxDownloadSize:      getEnvInt("MAX_DOWNLOAD_SIZE", 0),
+		OversizedDownloads:   getEnv("OVERSIZED_DOWNLOADS", "refuse"),
+		DownloadLinkSecret:   getEnv("DOWNLOAD_LINK_SECRET", ""),
+		DownloadLinkTTL:      getEnvDuration("DOWNLOAD_LINK_TTL", time.Hour),
+		UploadConcurrency:    getEnvInt("UPLOAD_CONCURRENCY", 4),
+		UploadMaxSize:        getEnvInt("UPLOAD_MAX_SIZE", 20<<20),
+		MaxBodySize:          getEnvInt("MAX_BODY_SIZE", 1<<20),
+
+		MaxBulkDelete: getEnvInt("MAX_BULK_DELETE", 100),
+		StarterSheet:  getEnvBool("STARTER_SHEET", true),
+
+		AllowDuplicateSheetNames: getEnvBool("ALLOW_DUPLICATE_SHEET_NAMES", true),
+
+		TrashDir:       getEnv("TRASH_DIR", ".trash"),
+		TrashRetention: getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+
+		Thumbnails:      getEnvBool("THUMBNAILS", false),
+		ThumbnailWidth:  getEnvInt("THUMBNAIL_WIDTH", 240),
+		ThumbnailHeight: getEnvInt("THUMBNAIL_HEIGHT", 160),
+		ThumbnailMaxAge: getEnvDuration("THUMBNAIL_MAX_AGE", 5*time.Minute),
+
+		ChangeLogBatchSize:     getEnvInt("CHANGELOG_BATCH_SIZE", 0),
+		ChangeLogFlushInterval: getEnvDuration("CHANGELOG_FLUSH_INTERVAL", time.Second),
+
+		StorageContentType: getEnv("STORAGE_CONTENT_TYPE", "application/json"),
+
+		EnableCache:     getEnvBool("ENABLE_CACHE", false),
+		CacheTTL:        getEnvDuration("CACHE_TTL", 30*time.Second),
+		CacheMaxEntries: getEnvInt("CACHE_MAX_ENTRIES", 10000),
+
+		TenantHosts:   getEnvMap("TENANT_HOSTS"),
+		TenantStorage: getEnvMap("TENANT_STORAGE"),
+
+		TrustedProxies:  getEnvListOr("TRUSTED_PROXIES", privateNetworks),
+		AdminAllowCIDRs: getEnvListOr("ADMIN_ALLOW_CIDRS", privateNetworks),
+		AdminDenyCIDRs:  getEnvList("ADMIN_DENY_CIDRS"),
+		AdminUsers:      getEnvList("ADMIN_USERS"),
+
+		BlockedUserAgents: getEnvList("BLOCKED_USER_AGENTS"),
+		CanonicalHost:     getEnv("CANONICAL_HOST", ""),
+		PublicScheme:      getEnv("PUBLIC_SCHEME", "https"),
+		AllowedOrigins:    getEnvList("ALLOWED_ORIGINS"),
+		ShutdownTimeout:   getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		RequestTimeout:    getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+
+		RateLimitRPS:              getEnvInt("RATE_LIMIT_RPS", 0),
+		RateLimitBurst:            getEnvInt("RATE_LIMIT_BURST", 20),
+		RateLimitIdleTTL:          getEnvDuration("RATE_LIMIT_IDLE_TTL", 10*time.Minute),
+		RateLimitMaxTracked:       getEnvInt("RATE_LIMIT_MAX_TRACKED", 10000),
+		RateLimitSlowStartInitial: getEnvFloat("RATE_LIMIT_SLOW_START_INITIAL", 0),
+		RateLimitSlowStartStep:    getEnvFloat("RATE_LIMIT_SLOW_START_STEP", 0.1),
+
+		AuthRateLimitRPS:               getEnvFloat("AUTH_RATE_LIMIT_RPS", 1),
+		AuthRateLimitBurst:             getEnvInt("AUTH_RATE_LIMIT_BURST", 10),
+		AuthRateLimitTrustForwardedFor: getEnvBool("AUTH_RATE_LIMIT_TRUST_FORWARDED_FOR", false),
+
+		ReputationBlockScore: getEnvFloat("REPUTATION_BLOCK_SCORE", 0),
+		ReputationHalfLife:   getEnvDuration("REPUTATION_HALF_LIFE", 10*time.Minute),
+		ReputationStore:      getEnv("REPUTATION_STORE", "shared"),
+
+		RequestSampleRate:   getEnvFloat("REQUEST_SAMPLE_RATE", 0),
+		RequestSampleSize:   getEnvInt("REQUEST_SAMPLE_SIZE", 200),
+		RequestSampleRedact: getEnvList("REQUEST_SAMPLE_REDACT"),
+		UserConcurrency:     getEnvInt("USER_CONCURRENCY", 0),
+
+		WebSocketMaxConnections: getEnvInt("WEBSOCKET_MAX_CONNECTIONS", 1000),
+		WebSocketMaxPerUser:     getEnvInt("WEBSOCKET_MAX_PER_USER", 5),
+
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:   getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites: getEnvList("TLS_CIPHER_SUITES"),
 	}
 }
 
@@ -63,4 +546,72 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvListOr is getEnvList with a default for when the variable is unset
+func getEnvListOr(key string, defaultValue []string) []string {
+	if values := getEnvList(key); len(values) > 0 {
+		return values
+	}
+	return append([]string{}, defaultValue...)
+}
+
+// getEnvMap parses a semicolon-separated list of key=value pairs.
+// Semicolons are used because values such as MongoDB URIs contain commas.
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ";") {
+		k, v, ok := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); ok && k != "" {
+			values[k] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadMySQLPool(t *testing.T) {
+	t.Setenv("MYSQL_MAX_OPEN_CONNS", "")
+	t.Setenv("MYSQL_MAX_IDLE_CONNS", "")
+	t.Setenv("MYSQL_CONN_MAX_LIFETIME", "")
+	cfg := Load()
+	if cfg.MySQLMaxOpenConns != 25 || cfg.MySQLMaxIdleConns != 10 || cfg.MySQLConnMaxLifetime != 5*time.Minute {
+		t.Errorf("defaults = %d, %d, %v; want 25, 10, 5m", cfg.MySQLMaxOpenConns, cfg.MySQLMaxIdleConns, cfg.MySQLConnMaxLifetime)
+	}
+
+	t.Setenv("MYSQL_MAX_OPEN_CONNS", "4")
+	t.Setenv("MYSQL_MAX_IDLE_CONNS", "0")
+	t.Setenv("MYSQL_CONN_MAX_LIFETIME", "90s")
+	cfg = Load()
+	if cfg.MySQLMaxOpenConns != 4 || cfg.MySQLMaxIdleConns != 0 || cfg.MySQLConnMaxLifetime != 90*time.Second {
+		t.Errorf("from env = %d, %d, %v; want 4, 0, 1m30s", cfg.MySQLMaxOpenConns, cfg.MySQLMaxIdleConns, cfg.MySQLConnMaxLifetime)
+	}
+}
@@ -0,0 +1,106 @@
+// Package counters keeps named analytics counts in storage, so every
+// instance sharing a backend adds to the same totals.
+package counters
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// Well-known counters
+const (
+	SheetsCreated = "sheets_created"
+	PDFsGenerated = "pdfs_generated"
+)
+
+// Known lists the well-known counters, in the order they are reported
+var Known = []string{SheetsCreated, PDFsGenerated}
+
+// maxAttempts bounds how often Incr retries a swap lost to another writer
+const maxAttempts = 100
+
+// ErrContended is returned when an increment keeps losing to concurrent
+// writers
+var ErrContended = errors.New("counter update contended, try again")
+
+// counterDir is where each counter is kept as a raw decimal item
+const counterDir = "system/counters/"
+
+// Counters reads and updates counters kept in storage
+type Counters struct {
+	storage storage.Storage
+}
+
+func New(s storage.Storage) *Counters {
+	return &Counters{storage: s}
+}
+
+func path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid counter name %q", name)
+	}
+	return counterDir + name, nil
+}
+
+// Get returns the value of the counter name; counters never incremented
+// are zero
+func (c *Counters) Get(name string) (int64, error) {
+	p, err := path(name)
+	if err != nil {
+		return 0, err
+	}
+	_, value, err := c.load(p)
+	return value, err
+}
+
+// Incr adds delta to the counter name and returns its new value. It is a
+// compare-and-swap loop, so concurrent increments from any instance are
+// never lost.
+func (c *Counters) Incr(name string, delta int64) (int64, error) {
+	p, err := path(name)
+	if err != nil {
+		return 0, err
+	}
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		raw, value, err := c.load(p)
+		if err != nil {
+			return 0, err
+		}
+		if delta == 0 {
+			return value, nil
+		}
+		next := value + delta
+		swapped, err := storage.CompareAndSwap(c.storage, p, raw, strconv.FormatInt(next, 10))
+		if err != nil {
+			return 0, fmt.Errorf("failed to update counter %s: %w", name, err)
+		}
+		if swapped {
+			return next, nil
+		}
+		// Back off a little longer each time another writer wins
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	return 0, fmt.Errorf("counter %s: %w", name, ErrContended)
+}
+
+// load returns the stored text of the counter at p, "" when absent, and
+// its value
+func (c *Counters) load(p string) (string, int64, error) {
+	raw, err := c.storage.GetItem(p)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to load counter %s: %w", strings.TrimPrefix(p, counterDir), err)
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid value for counter %s: %w", strings.TrimPrefix(p, counterDir), err)
+	}
+	return raw, value, nil
+}
@@ -0,0 +1,136 @@
+package counters
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// itemStorage keeps raw items in memory; the file operations are unused
+type itemStorage struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+func newItemStorage() *itemStorage {
+	return &itemStorage{items: make(map[string]string)}
+}
+
+func (s *itemStorage) CreateFile(ctx context.Context, path []string, data string) error { return nil }
+func (s *itemStorage) UpdateFile(ctx context.Context, path []string, data string) error { return nil }
+func (s *itemStorage) DeleteFile(ctx context.Context, path []string) error              { return nil }
+func (s *itemStorage) Append(path []string, data []byte) error                          { return nil }
+func (s *itemStorage) CreateDir(ctx context.Context, path []string) error               { return nil }
+func (s *itemStorage) DeleteDir(path []string, recursive bool) error                    { return nil }
+func (s *itemStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	return nil, storage.ErrNotFound
+}
+func (s *itemStorage) List(path []string) ([]string, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (s *itemStorage) PutItem(path string, data string, bucket ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[path] = data
+	return nil
+}
+
+func (s *itemStorage) GetItem(path string, bucket ...string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.items[path]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *itemStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	_, err := s.GetItem(path)
+	return err == nil, nil
+}
+
+func (s *itemStorage) DeleteItem(path string, bucket ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, path)
+	return nil
+}
+
+// swapStorage adds a native compare-and-swap, as the database backends have
+type swapStorage struct {
+	*itemStorage
+}
+
+func (s swapStorage) SwapItem(path, old, data string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current := s.items[path]; current != old {
+		return false, nil
+	}
+	s.items[path] = data
+	return true, nil
+}
+
+func TestConcurrentIncrementsSum(t *testing.T) {
+	for name, s := range map[string]storage.Storage{
+		"fallback": newItemStorage(),
+		"swapper":  swapStorage{newItemStorage()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Separate Counters share only the storage, like two instances
+			a, b := New(s), New(s)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				c := a
+				if i%2 == 1 {
+					c = b
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 25; j++ {
+						if _, err := c.Incr(SheetsCreated, 2); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			got, err := a.Get(SheetsCreated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != 1000 {
+				t.Errorf("%s = %d after 500 increments of 2, want 1000", SheetsCreated, got)
+			}
+		})
+	}
+}
+
+func TestGetUnsetCounterIsZero(t *testing.T) {
+	c := New(newItemStorage())
+
+	if got, err := c.Get(PDFsGenerated); err != nil || got != 0 {
+		t.Errorf("Get(unset) = %d, %v; want 0", got, err)
+	}
+	if got, err := c.Incr(PDFsGenerated, -3); err != nil || got != -3 {
+		t.Errorf("Incr(-3) = %d, %v; want -3", got, err)
+	}
+}
+
+func TestInvalidCounterName(t *testing.T) {
+	c := New(newItemStorage())
+
+	if _, err := c.Incr("../users", 1); err == nil || !strings.Contains(err.Error(), "invalid counter name") {
+		t.Errorf("Incr with a path = %v, want an invalid name error", err)
+	}
+}
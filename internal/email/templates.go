@@ -0,0 +1,132 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Emails users are sent, by template name
+const (
+	TemplateConfirm  = "confirm"
+	TemplateReset    = "reset"
+	TemplateNewLogin = "newlogin"
+)
+
+// TemplateNames lists the known templates
+var TemplateNames = []string{TemplateConfirm, TemplateReset, TemplateNewLogin}
+
+// Errors returned by Render for a name not in TemplateNames, or a locale
+// that isn't one
+var (
+	ErrUnknownTemplate = errors.New("unknown email template")
+	ErrInvalidLocale   = errors.New("invalid locale")
+)
+
+//go:embed templates/*.html
+var builtinTemplates embed.FS
+
+// localePattern matches locale names such as "fr" or "pt-BR", which are
+// also directory names, so nothing else gets near the filesystem
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// TemplateData fills in an email template. Each template uses the fields
+// that make sense for it.
+type TemplateData struct {
+	Email string
+	Link  string
+	IP    string
+	Time  time.Time
+}
+
+// SampleData is placeholder data for previewing templates
+func SampleData() TemplateData {
+	return TemplateData{
+		Email: "user@example.com",
+		Link:  "https://touchcalc.example.com/link?t=sample-token",
+		IP:    "203.0.113.7",
+		Time:  time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
+}
+
+// Templates renders emails from the built-in templates, or from operator
+// copies in a directory: dir/<locale>/<name>.html for a locale, otherwise
+// dir/<name>.html. Each template defines its subject as a "subject" block
+// and the rest is the HTML body. A nil Templates uses the built-ins.
+type Templates struct {
+	dir string
+}
+
+// NewTemplates renders templates overridden in dir; an empty dir uses
+// only the built-ins
+func NewTemplates(dir string) *Templates {
+	return &Templates{dir: dir}
+}
+
+// Render fills in the template name, in locale when it has a translation,
+// and returns the message to send
+func (t *Templates) Render(name, locale string, data TemplateData) (*Message, error) {
+	if !slices.Contains(TemplateNames, name) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	if locale != "" && !localePattern.MatchString(locale) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidLocale, locale)
+	}
+
+	source, err := t.source(name, locale)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+	}
+
+	var subject, body bytes.Buffer
+	if tmpl.Lookup("subject") != nil {
+		if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return nil, fmt.Errorf("failed to render subject of %s: %w", name, err)
+		}
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s: %w", name, err)
+	}
+
+	message := NewMessage()
+	message.Subject = strings.TrimSpace(subject.String())
+	message.BodyHTML = body.String()
+	return message, nil
+}
+
+// source returns the text of the most specific copy of the template name
+func (t *Templates) source(name, locale string) (string, error) {
+	if t != nil && t.dir != "" {
+		candidates := []string{filepath.Join(t.dir, name+".html")}
+		if locale != "" {
+			candidates = append([]string{filepath.Join(t.dir, locale, name+".html")}, candidates...)
+		}
+		for _, candidate := range candidates {
+			data, err := os.ReadFile(candidate)
+			if err == nil {
+				return string(data), nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("failed to read email template %s: %w", candidate, err)
+			}
+		}
+	}
+
+	data, err := builtinTemplates.ReadFile("templates/" + name + ".html")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,65 @@
+package email
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTemplatesRender(t *testing.T) {
+	var templates *Templates
+	for _, name := range TemplateNames {
+		message, err := templates.Render(name, "", SampleData())
+		if err != nil {
+			t.Fatalf("Render(%s) failed: %v", name, err)
+		}
+		if message.Subject == "" || !strings.Contains(message.BodyHTML, "user@example.com") {
+			t.Errorf("%s: subject %q, body %q; want both filled in", name, message.Subject, message.BodyHTML)
+		}
+	}
+}
+
+func TestOperatorTemplatesOverrideByLocale(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "reset.html"), `{{define "subject"}}Custom reset{{end}}<a href="{{.Link}}">reset</a>`)
+	write(filepath.Join(dir, "fr", "reset.html"), `{{define "subject"}}Réinitialiser{{end}}<a href="{{.Link}}">réinitialiser</a>`)
+	templates := NewTemplates(dir)
+
+	for locale, want := range map[string]string{"": "Custom reset", "fr": "Réinitialiser", "de": "Custom reset"} {
+		message, err := templates.Render(TemplateReset, locale, SampleData())
+		if err != nil {
+			t.Fatalf("Render(reset, %q) failed: %v", locale, err)
+		}
+		if message.Subject != want {
+			t.Errorf("locale %q: subject = %q, want %q", locale, message.Subject, want)
+		}
+	}
+
+	// Templates the operator didn't copy fall back to the built-ins
+	message, err := templates.Render(TemplateConfirm, "fr", SampleData())
+	if err != nil || message.Subject != "Confirm your TouchCalc account" {
+		t.Errorf("confirm = %+v, %v; want the built-in", message, err)
+	}
+}
+
+func TestRenderRejectsUnknownNamesAndLocales(t *testing.T) {
+	templates := NewTemplates(t.TempDir())
+
+	if _, err := templates.Render("../secrets", "", SampleData()); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("unknown template: err = %v, want ErrUnknownTemplate", err)
+	}
+	if _, err := templates.Render(TemplateReset, "../..", SampleData()); !errors.Is(err, ErrInvalidLocale) {
+		t.Errorf("path as locale: err = %v, want ErrInvalidLocale", err)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleAccountDelete handles POST /profile/delete, deleting the current
+// user's account once they confirm their password. The optional reason is
+// kept in the audit log for support.
+func (h *AuthHandler) HandleAccountDelete(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password" form:"password"`
+		Reason   string `json:"reason" form:"reason"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Password == "" {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"data":   "password required",
+			"result": "fail",
+		})
+		return
+	}
+
+	service := h.serviceFor(c)
+	ok, err := service.AuthenticateUser(user, req.Password)
+	if errors.Is(err, auth.ErrTOTPRequired) {
+		// The session already passed the second factor; the password
+		// confirms it's still the user at the keyboard
+		ok, err = true, nil
+	}
+	if errors.Is(err, auth.ErrAccountLocked) {
+		respondJSON(c, http.StatusTooManyRequests, gin.H{
+			"data":   "locked",
+			"result": "fail",
+		})
+		return
+	}
+	if err != nil || !ok {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "authfail",
+			"result": "fail",
+		})
+		return
+	}
+
+	err = service.DeleteUser(user, req.Reason, false)
+	if errors.Is(err, auth.ErrReasonTooLong) {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"data":   h.handler.errorDetail("failed to delete account", err),
+			"result": "fail",
+		})
+		return
+	}
+
+	h.clearCurrentUser(c)
+	respondJSON(c, http.StatusOK, gin.H{"result": "ok"})
+}
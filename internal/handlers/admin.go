@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/counters"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/email"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operator endpoints mounted under /admin
+type AdminHandler struct {
+	handler *Handler
+}
+
+func NewAdminHandler(h *Handler) *AdminHandler {
+	return &AdminHandler{
+		handler: h,
+	}
+}
+
+// HandleGetSetting handles GET /admin/settings/:key, returning the stored
+// runtime setting or null when it has never been set
+func (h *AdminHandler) HandleGetSetting(c *gin.Context) {
+	key := c.Param("key")
+
+	var value json.RawMessage
+	found, err := h.handler.Settings.Get(key, &value)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read setting", err),
+		})
+		return
+	}
+	if !found {
+		value = json.RawMessage("null")
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"key":    key,
+		"value":  value,
+	})
+}
+
+// HandleRateLimitStats handles GET /admin/ratelimit, listing the request
+// and throttle counts of every client the rate limiter remembers
+func (h *AdminHandler) HandleRateLimitStats(c *gin.Context) {
+	limiter := h.handler.Limiter
+	if limiter == nil {
+		respondJSON(c, http.StatusOK, gin.H{
+			"result":  "ok",
+			"enabled": false,
+			"clients": []middleware.ClientStats{},
+		})
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"enabled": true,
+		"clients": limiter.Stats(),
+	})
+}
+
+// HandleRequestSamples handles GET /admin/samples, listing the anonymized
+// requests the sampler has kept, newest first
+func (h *AdminHandler) HandleRequestSamples(c *gin.Context) {
+	sampler := h.handler.Sampler
+	if sampler == nil {
+		respondJSON(c, http.StatusOK, gin.H{
+			"result":  "ok",
+			"enabled": false,
+			"samples": []middleware.RequestSample{},
+		})
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"enabled": true,
+		"rate":    sampler.Rate(),
+		"samples": sampler.Samples(),
+	})
+}
+
+// HandleCounters handles GET /admin/counters, reporting the analytics
+// counters shared by every instance
+func (h *AdminHandler) HandleCounters(c *gin.Context) {
+	values := make(map[string]int64, len(counters.Known))
+	for _, name := range counters.Known {
+		value, err := h.handler.Counters.Get(name)
+		if err != nil {
+			respondJSON(c, http.StatusInternalServerError, gin.H{
+				"result": "fail",
+				"data":   h.handler.errorDetail("failed to read counters", err),
+			})
+			return
+		}
+		values[name] = value
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":   "ok",
+		"counters": values,
+	})
+}
+
+// HandleEmailPreview handles GET /admin/email/preview, rendering the email
+// template named by ?template= with sample data, in ?locale= when it has a
+// translation, as the HTML users would receive. Nothing is sent.
+func (h *AdminHandler) HandleEmailPreview(c *gin.Context) {
+	message, err := h.handler.Emails.Render(c.Query("template"), c.Query("locale"), email.SampleData())
+	switch {
+	case errors.Is(err, email.ErrUnknownTemplate):
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result":    "fail",
+			"data":      err.Error(),
+			"templates": email.TemplateNames,
+		})
+		return
+	case errors.Is(err, email.ErrInvalidLocale):
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   err.Error(),
+		})
+		return
+	case err != nil:
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to render email template", err),
+		})
+		return
+	}
+
+	c.Header("X-Email-Subject", message.Subject)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(message.BodyHTML))
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleDeleteUser handles DELETE /admin/users/:email. With ?trash=true
+// the account is moved to the trash, where it can be restored, instead of
+// deleted for good; ?reason= is recorded in the audit log.
+func (h *AdminHandler) HandleDeleteUser(c *gin.Context) {
+	trash, _ := strconv.ParseBool(c.Query("trash"))
+	service := h.handler.Auth.serviceFor(c)
+
+	email := c.Param("email")
+	if exists, err := service.UserExists(email); err == nil && !exists {
+		h.respondUserError(c, storage.ErrNotFound)
+		return
+	}
+	if err := service.DeleteUser(email, c.Query("reason"), trash); err != nil {
+		h.respondUserError(c, err)
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"email":   email,
+		"trashed": trash,
+	})
+}
+
+// HandleRestoreUser handles POST /admin/users/:email/restore, bringing
+// back an account deleted with ?trash=true
+func (h *AdminHandler) HandleRestoreUser(c *gin.Context) {
+	email := c.Param("email")
+	err := h.handler.Auth.serviceFor(c).RestoreUser(email)
+	if errors.Is(err, storage.ErrRestoreConflict) {
+		respondJSON(c, http.StatusConflict, gin.H{
+			"result": "fail",
+			"data":   "the address has an account again",
+		})
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "no such user in the trash",
+		})
+		return
+	}
+	if err != nil {
+		h.respondUserError(c, err)
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"email":  email,
+	})
+}
+
+// HandlePurgeTrash handles POST /admin/trash/purge?older_than=720h,
+// permanently deleting whatever has been in the trash longer than that
+func (h *AdminHandler) HandlePurgeTrash(c *gin.Context) {
+	olderThan, err := time.ParseDuration(c.Query("older_than"))
+	if err != nil || olderThan < 0 {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "expected older_than as a duration, e.g. 720h",
+		})
+		return
+	}
+
+	purged, err := storage.NewSoftDeleter(h.handler.storageFor(c)).PurgeTrash(c.Request.Context(), olderThan)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to purge trash", err),
+			"purged": purged,
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"purged": purged,
+	})
+}
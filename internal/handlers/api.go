@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Responses of the /api routes are built from the DTOs below, whose JSON
+// field names are snake_case, rather than from storage or model types, so
+// clients see the same names whatever a backend keeps internally. The
+// Flask-compatible routes keep their historical shapes.
+
+// userResponse describes the current user
+type userResponse struct {
+	Email        string     `json:"email"`
+	Confirmed    bool       `json:"confirmed"`
+	MFAEnabled   bool       `json:"mfa_enabled"`
+	Entitlements []string   `json:"entitlements"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+}
+
+func newUserResponse(user *models.User, entitlements []string) userResponse {
+	resp := userResponse{
+		Email:        user.Email,
+		Confirmed:    user.Confirmed,
+		MFAEnabled:   user.TOTPEnabled,
+		Entitlements: entitlements,
+		CreatedAt:    user.CreatedOn,
+	}
+	if resp.Entitlements == nil {
+		resp.Entitlements = []string{}
+	}
+	if !user.LastLogin.IsZero() {
+		lastLogin := user.LastLogin
+		resp.LastLoginAt = &lastLogin
+	}
+	return resp
+}
+
+// sheetResponse describes one of the user's sheets
+type sheetResponse struct {
+	Name      string `json:"name"`
+	SizeBytes int    `json:"size_bytes"`
+}
+
+// trashEntryResponse describes a sheet waiting in the trash
+type trashEntryResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// OldDeletedAt repeats DeletedAt under its name before the snake_case
+	// field names, for existing clients
+	OldDeletedAt time.Time `json:"deletedat"`
+}
+
+func newTrashEntryResponse(entry storage.TrashEntry) trashEntryResponse {
+	return trashEntryResponse{ID: entry.ID, Name: entry.Name, DeletedAt: entry.DeletedAt, OldDeletedAt: entry.DeletedAt}
+}
+
+// HandleMe handles GET /api/me, describing the logged-in user
+func (h *AuthHandler) HandleMe(c *gin.Context) {
+	email := h.getCurrentUser(c)
+	if email == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	service := h.serviceFor(c)
+	user, err := service.GetUser(email)
+	if err != nil {
+		h.respondMeError(c, err)
+		return
+	}
+	entitlements, err := service.Entitlements(email)
+	if err != nil {
+		h.respondMeError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   newUserResponse(user, entitlements),
+	})
+}
+
+// respondMeError answers for a user record that couldn't be read; a
+// session whose user no longer exists is treated as logged out
+func (h *AuthHandler) respondMeError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+	respondJSON(c, http.StatusInternalServerError, gin.H{
+		"result": "fail",
+		"data":   h.handler.errorDetail("failed to read user", err),
+	})
+}
+
+// HandleSheetsList handles GET /api/sheets, listing the logged-in user's
+// sheets by name
+func (h *WebAppHandler) HandleSheetsList(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	store := h.handler.storageFor(c)
+	sheets := []sheetResponse{}
+	item, err := store.GetFile(ctx, []string{"home", user})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to list sheets", err),
+		})
+		return
+	}
+	if err == nil {
+		names, _ := item.Data.([]interface{})
+		for _, entry := range names {
+			name, ok := entry.(string)
+			if !ok || !isSheetName(name) {
+				continue
+			}
+			sheet := sheetResponse{Name: name}
+			if info, err := storage.Stat(ctx, store, []string{"home", user, name}); err == nil {
+				sheet.SizeBytes = info.Size
+			}
+			sheets = append(sheets, sheet)
+		}
+	}
+	sort.Slice(sheets, func(i, j int) bool { return sheets[i].Name < sheets[j].Name })
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   sheets,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidAPIKey is a middleware.APIKeyValidator backed by the user store. It
+// reads the user on every call, so a revoked key fails on its next use.
+func (h *AuthHandler) ValidAPIKey(c *gin.Context, key string) (string, bool) {
+	user, err := h.serviceFor(c).AuthenticateAPIKey(key)
+	return user, err == nil
+}
+
+// HandleAPIKeyCreate handles POST /profile/apikeys, issuing a new API key.
+// The key is only ever returned in this response.
+func (h *AuthHandler) HandleAPIKeyCreate(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	key, err := h.serviceFor(c).IssueAPIKey(user)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"data":   h.handler.errorDetail("failed to issue API key", err),
+			"result": "fail",
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"key":    key,
+	})
+}
+
+// HandleAPIKeysRotate handles POST /profile/apikeys/rotate. Every existing
+// key is revoked; with {"issue": true} a replacement is returned once.
+func (h *AuthHandler) HandleAPIKeysRotate(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	var req struct {
+		Issue bool `json:"issue" form:"issue"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			respondJSON(c, http.StatusBadRequest, gin.H{
+				"data":   "invalid request body",
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	key, revoked, err := h.serviceFor(c).RotateAPIKeys(user, req.Issue)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"data":   h.handler.errorDetail("failed to rotate API keys", err),
+			"result": "fail",
+		})
+		return
+	}
+
+	resp := gin.H{
+		"result":  "ok",
+		"revoked": revoked,
+	}
+	if key != "" {
+		resp["key"] = key
+	}
+	respondJSON(c, http.StatusOK, resp)
+}
@@ -87,7 +87,7 @@ func (h *AppHandler) handleWebAppIndex(c *gin.Context, appName, paramCode, sessi
     if user != "" {
         // Try to load existing file from storage
         path := []string{"home", user, "securestore", appName, appName + ".msc"}
-        item, err := h.handler.Storage.GetFile(path)
+        item, err := h.handler.storageFor(c).GetFile(c.Request.Context(), path)
         if err == nil && item != nil {
             if dataStr, ok := item.Data.(string); ok {
                 var fileData map[string]interface{}
@@ -199,7 +199,7 @@ func (h *AppHandler) handleStaticFile(c *gin.Context, filename string) {
     
     // Check if file exists
     if _, err := os.Stat(staticPath); os.IsNotExist(err) {
-        c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+        respondJSON(c, http.StatusNotFound, gin.H{"error": "File not found"})
         return
     }
 
@@ -263,22 +263,5 @@ func (h *AppHandler) generateRandomString(length int) string {
 }
 
 func (h *AppHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
-
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
-        return user
-    }
-    
-    // Plain text format
-    return userCookie
+    return h.handler.Auth.CurrentUser(c)
 }
@@ -1,14 +1,20 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/email"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/reputation"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,25 +35,32 @@ type AuthRequest struct {
 	Action   string `json:"action" form:"action"`
 	Email    string `json:"email" form:"email"`
 	Password string `json:"pwd" form:"pwd"`
+	Code     string `json:"code" form:"code"`
 }
 
 // HandleAuth handles the /iauth endpoint
 func (h *AuthHandler) HandleAuth(c *gin.Context) {
 	var req AuthRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.checkFieldLengths(c, "login.html",
+		h.emailField(req.Email), h.passwordField(req.Password),
+		h.otherField("action", req.Action), h.otherField("code", req.Code)) {
 		return
 	}
 
 	switch req.Action {
 	case "login":
-		h.handleLogin(c, req.Email, req.Password)
+		h.handleLogin(c, req.Email, req.Password, req.Code, "")
 	case "register":
 		h.handleRegister(c, req.Email, req.Password)
 	case "logout":
 		h.HandleLogout(c)
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		respondJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid action"})
 	}
 }
 
@@ -56,14 +69,22 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" form:"email"`
 		Password string `json:"password" form:"password"`
+		Code     string `json:"code" form:"code"`
+		Next     string `json:"next" form:"next"`
 	}
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.checkFieldLengths(c, "login.html",
+		h.emailField(req.Email), h.passwordField(req.Password),
+		h.otherField("code", req.Code), h.otherField("next", req.Next)) {
 		return
 	}
 
-	h.handleLogin(c, req.Email, req.Password)
+	h.handleLogin(c, req.Email, req.Password, req.Code, req.Next)
 }
 
 // HandleRegister handles registration requests
@@ -74,32 +95,81 @@ func (h *AuthHandler) HandleRegister(c *gin.Context) {
 	}
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondJSON(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if !h.checkFieldLengths(c, "register.html", h.emailField(req.Email), h.passwordField(req.Password)) {
 		return
 	}
 
 	h.handleRegister(c, req.Email, req.Password)
 }
 
-// HandleLogout handles logout requests
+// HandleLogout handles logout requests. Form logouts are redirected to
+// next when logoutTarget allows it, or to /login.
 func (h *AuthHandler) HandleLogout(c *gin.Context) {
     fmt.Printf("DEBUG: Logging out user\n")
     h.clearCurrentUser(c)
     
     // Check if it's a JSON request
     if c.GetHeader("Content-Type") == "application/json" {
-        c.JSON(http.StatusOK, gin.H{
+        respondJSON(c, http.StatusOK, gin.H{
             "result": "ok",
         })
     } else {
-        c.Redirect(http.StatusFound, "/browser")
+        next := c.Query("next")
+        if next == "" {
+            next = c.PostForm("next")
+        }
+        c.Redirect(http.StatusFound, h.logoutTarget(next))
+    }
+}
+
+// logoutTarget returns next if it is a local path or falls under an entry
+// of LogoutRedirectAllowlist, so logout can't be used as an open redirect.
+// Anything else, including no target, is /login.
+func (h *AuthHandler) logoutTarget(next string) string {
+    if next == "" {
+        return "/login"
+    }
+    if middleware.SafeRedirect(next) {
+        return next
+    }
+
+    target, err := url.Parse(next)
+    if err != nil || target.User != nil {
+        return "/login"
+    }
+    for _, entry := range h.handler.Config.LogoutRedirectAllowlist {
+        allowed, err := url.Parse(entry)
+        if err != nil || allowed.Host == "" {
+            continue
+        }
+        if strings.EqualFold(target.Scheme, allowed.Scheme) &&
+            strings.EqualFold(target.Host, allowed.Host) &&
+            underPath(target.Path, allowed.Path) {
+            return next
+        }
     }
+    return "/login"
 }
 
-func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
+// underPath reports whether path is prefix or below it, so /bye doesn't
+// also allow /byebye
+func underPath(path, prefix string) bool {
+    prefix = strings.TrimSuffix(prefix, "/")
+    return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// handleLogin signs the user in and, for form logins, redirects to next
+// when it is a local path, or to /browser otherwise
+func (h *AuthHandler) handleLogin(c *gin.Context, email, password, code, next string) {
+    // The session and home directory are keyed by the stored form
+    email = auth.NormalizeEmail(email)
     if !auth.ValidateEmail(email) {
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respondJSON(c, http.StatusBadRequest, gin.H{
                 "data":   "usererror",
                 "result": "fail",
             })
@@ -112,16 +182,25 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
         return
     }
 
-    authenticated, err := h.service.AuthenticateUser(email, password)
+    authenticated, err := h.serviceFor(c).AuthenticateUser(email, password)
+    if errors.Is(err, auth.ErrTOTPRequired) {
+        // The password was right; checkSecondFactor below asks for the code
+        authenticated, err = true, nil
+    }
+    if errors.Is(err, auth.ErrAccountLocked) {
+        respondAccountLocked(c)
+        return
+    }
     if err != nil {
-        exists, _ := h.service.UserExists(email)
+        c.Set(reputation.EventKey, reputation.FailedLogin)
+        exists, _ := h.serviceFor(c).UserExists(email)
         errorMsg := "Authentication failed"
         if !exists {
             errorMsg = "User does not exist"
         }
         
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respondJSON(c, http.StatusUnauthorized, gin.H{
                 "data":   "authfail",
                 "result": "fail",
             })
@@ -135,19 +214,29 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
     }
 
     if authenticated {
+        if !h.checkSecondFactor(c, email, code) {
+            return
+        }
+        if _, err := h.serviceFor(c).RecordLogin(email, c.ClientIP()); err != nil {
+            fmt.Printf("DEBUG: Failed to record login for %s: %v\n", email, err)
+        }
         h.setCurrentUser(c, email)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusOK, gin.H{
+            respondJSON(c, http.StatusOK, gin.H{
                 "data":   "success",
                 "result": "ok",
             })
         } else {
-            // Redirect to landing page instead of /browser
-            c.Redirect(http.StatusFound, "/browser")
+            // Return to the page that asked for re-authentication, if any
+            if !middleware.SafeRedirect(next) {
+                next = "/browser"
+            }
+            c.Redirect(http.StatusFound, next)
         }
     } else {
+        c.Set(reputation.EventKey, reputation.FailedLogin)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respondJSON(c, http.StatusUnauthorized, gin.H{
                 "data":   "authfail",
                 "result": "fail",
             })
@@ -161,12 +250,14 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
 }
 
 func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
+    ctx := c.Request.Context()
+    email = auth.NormalizeEmail(email)
     fmt.Printf("DEBUG: Starting registration for email: %s\n", email)
     
     if !auth.ValidateEmail(email) {
         fmt.Printf("DEBUG: Email validation failed for: %s\n", email)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respondJSON(c, http.StatusBadRequest, gin.H{
                 "data": "usererror",
                 "result": "fail",
                 "message": "Invalid email format",
@@ -181,55 +272,69 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
     }
 
     fmt.Printf("DEBUG: Checking if user exists: %s\n", email)
-    exists, err := h.service.UserExists(email)
+    exists, err := h.serviceFor(c).UserExists(email)
     if err != nil {
         fmt.Printf("DEBUG: Error checking if user exists: %v\n", err)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusInternalServerError, gin.H{
+            respondJSON(c, http.StatusInternalServerError, gin.H{
                 "data": "error",
                 "result": "fail",
-                "message": "Database error: " + err.Error(),
+                "message": h.handler.errorDetail("Database error", err),
             })
         } else {
             c.HTML(http.StatusInternalServerError, "register.html", gin.H{
                 "user": nil,
-                "error": "Database error occurred: " + err.Error(),
+                "error": h.handler.errorDetail("Database error occurred", err),
             })
         }
         return
     }
 
-    if exists {
+    // With idempotent creates, CreateUser decides whether a retry matches
+    if exists && !h.serviceFor(c).IdempotentCreate() {
         fmt.Printf("DEBUG: User already exists: %s\n", email)
+        respondUserExists(c)
+        return
+    }
+
+    fmt.Printf("DEBUG: Creating user: %s\n", email)
+    err = h.serviceFor(c).CreateUser(email, password)
+    if errors.Is(err, models.ErrCompromisedPassword) {
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusConflict, gin.H{
-                "data": "userexists",
+            respondJSON(c, http.StatusBadRequest, gin.H{
+                "data": "compromisedpassword",
                 "result": "fail",
-                "message": "User already exists",
+                "message": err.Error(),
             })
         } else {
-            c.HTML(http.StatusConflict, "register.html", gin.H{
+            c.HTML(http.StatusBadRequest, "register.html", gin.H{
                 "user": nil,
-                "error": "User already exists",
+                "error": err.Error(),
             })
         }
         return
     }
-
-    fmt.Printf("DEBUG: Creating user: %s\n", email)
-    err = h.service.CreateUser(email, password)
+    if errors.Is(err, auth.ErrAccountLocked) {
+        respondAccountLocked(c)
+        return
+    }
+    if errors.Is(err, auth.ErrUserExists) {
+        fmt.Printf("DEBUG: User already exists: %s\n", email)
+        respondUserExists(c)
+        return
+    }
     if err != nil {
         fmt.Printf("DEBUG: Error creating user: %v\n", err)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusInternalServerError, gin.H{
+            respondJSON(c, http.StatusInternalServerError, gin.H{
                 "data": "error",
                 "result": "fail",
-                "message": "Failed to create user: " + err.Error(),
+                "message": h.handler.errorDetail("Failed to create user", err),
             })
         } else {
             c.HTML(http.StatusInternalServerError, "register.html", gin.H{
                 "user": nil,
-                "error": "Failed to create user: " + err.Error(),
+                "error": h.handler.errorDetail("Failed to create user", err),
             })
         }
         return
@@ -238,23 +343,35 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
     fmt.Printf("DEBUG: Creating user directories\n")
     // Create user home directory and required directories
     userHomePath := []string{"home", email}
-    err = h.handler.Storage.CreateDir(userHomePath)
+    err = h.handler.storageFor(c).CreateDir(ctx, userHomePath)
     if err != nil {
         fmt.Printf("DEBUG: Failed to create user home directory (non-fatal): %v\n", err)
     }
 
     // Create user's securestore directory for application data
     secureStorePath := []string{"home", email, "securestore"}
-    err = h.handler.Storage.CreateDir(secureStorePath)
+    err = h.handler.storageFor(c).CreateDir(ctx, secureStorePath)
     if err != nil {
         fmt.Printf("DEBUG: Failed to create securestore directory (non-fatal): %v\n", err)
     }
 
+    // A matching retry found an account that is already confirmed
+    if h.service.ConfirmationRequired() && !exists {
+        h.startConfirmation(c, email)
+        return
+    }
+
+    // A retried registration can land on an account that has since turned
+    // on TOTP, which the password alone mustn't sign in to
+    if !h.checkSecondFactor(c, email, "") {
+        return
+    }
+
     fmt.Printf("DEBUG: Setting current user and completing registration\n")
     h.setCurrentUser(c, email)
     
     if c.GetHeader("Content-Type") == "application/json" {
-        c.JSON(http.StatusOK, gin.H{
+        respondJSON(c, http.StatusOK, gin.H{
             "data": "success",
             "result": "ok",
             "message": "Registration successful",
@@ -266,43 +383,66 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
     fmt.Printf("DEBUG: Registration completed successfully for: %s\n", email)
 }
 
+// respondUserExists refuses to register an email that is already taken
+func respondUserExists(c *gin.Context) {
+    if c.GetHeader("Content-Type") == "application/json" {
+        respondJSON(c, http.StatusConflict, gin.H{
+            "data": "userexists",
+            "result": "fail",
+            "message": "User already exists",
+        })
+    } else {
+        c.HTML(http.StatusConflict, "register.html", gin.H{
+            "user": nil,
+            "error": "User already exists",
+        })
+    }
+}
+
 func (h *AuthHandler) clearCurrentUser(c *gin.Context) {
     fmt.Printf("DEBUG: Clearing user cookies\n")
     c.SetCookie("user", "", -1, "/", "", false, true)
+    c.SetCookie(middleware.SessionTokenCookie, "", -1, "/", "", false, true)
     c.SetCookie("session", "", -1, "/", "", false, true)
+    c.SetCookie(middleware.SessionVersionCookie, "", -1, "/", "", false, true)
+    c.SetCookie(middleware.SessionExpiresCookie, "", -1, "/", "", false, true)
 }
 
-// HandlePasswordResetGet handles GET requests for password reset
-func (h *AuthHandler) HandlePasswordResetGet(c *gin.Context) {
-	user := c.Query("u")
-	dongle := c.Query("d")
+// ValidSession reports whether user's session issued at version is still
+// current; it backs middleware.AuthRequired
+func (h *AuthHandler) ValidSession(c *gin.Context, user string, version int) bool {
+    return h.serviceFor(c).ValidSession(user, version)
+}
 
-	if user == "" || dongle == "" {
-		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
-			"user":    nil,
-			"reguser": user,
-		})
-		return
-	}
+// serviceFor returns the auth service bound to the request's storage, see
+// Handler.storageFor, and to its context, so storage calls stop with the
+// request
+func (h *AuthHandler) serviceFor(c *gin.Context) *auth.Service {
+    return h.service.WithStorage(h.handler.storageFor(c)).WithContext(c.Request.Context())
+}
 
-	userDongle, err := h.service.GetUserDongle(user)
-	if err != nil || userDongle != dongle {
-		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
-			"user":    nil,
-			"reguser": user,
-		})
+// HandlePasswordResetGet shows the new-password form for the reset link's
+// token, t
+func (h *AuthHandler) HandlePasswordResetGet(c *gin.Context) {
+	token := c.Query("t")
+	user, err := h.serviceFor(c).ValidatePasswordResetToken(token)
+	if err != nil {
+		h.invalidResetToken(c, err, "")
 		return
 	}
 
 	c.HTML(http.StatusOK, "pwreset.html", gin.H{
 		"user":    nil,
 		"reguser": user,
+		"token":   token,
 	})
 }
 
-// HandlePasswordResetPost handles POST requests for password reset
+// HandlePasswordResetPost sets a new password for the user a valid reset
+// token was issued to, then uses the token up
 func (h *AuthHandler) HandlePasswordResetPost(c *gin.Context) {
 	var req struct {
+		Token    string `json:"token" form:"token"`
 		Email    string `json:"email" form:"email"`
 		Password string `json:"password" form:"password"`
 	}
@@ -315,39 +455,81 @@ func (h *AuthHandler) HandlePasswordResetPost(c *gin.Context) {
 		return
 	}
 
-	exists, err := h.service.UserExists(req.Email)
-	if err != nil || !exists {
-		c.HTML(http.StatusBadRequest, "lostpassword-baduser.html", gin.H{
+	if !h.checkFieldLengths(c, "pwreset-invalid.html", h.emailField(req.Email), h.passwordField(req.Password)) {
+		return
+	}
+
+	// The token, not the submitted address, decides whose password changes
+	service := h.serviceFor(c)
+	user, err := service.ValidatePasswordResetToken(req.Token)
+	if err != nil {
+		h.invalidResetToken(c, err, req.Email)
+		return
+	}
+
+	err = service.UpdatePassword(user, req.Password)
+	if errors.Is(err, models.ErrCompromisedPassword) || errors.Is(err, models.ErrPasswordReused) {
+		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
 			"user":    nil,
-			"reguser": req.Email,
+			"reguser": user,
+			"error":   err.Error(),
 		})
 		return
 	}
-
-	err = h.service.UpdatePassword(req.Email, req.Password)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "pwreset-invalid.html", gin.H{
 			"user":    nil,
-			"reguser": req.Email,
+			"reguser": user,
 		})
 		return
 	}
+	if err := service.InvalidatePasswordResetToken(req.Token); err != nil {
+		fmt.Printf("DEBUG: Failed to invalidate reset token for %s: %v\n", user, err)
+	}
+
+	// Keep the session that made the change; any others are now stale
+	if h.getCurrentUser(c) == user {
+		h.setCurrentUser(c, user)
+	}
 
 	c.HTML(http.StatusOK, "pwreset-ok.html", gin.H{
 		"user":    nil,
-		"reguser": req.Email,
+		"reguser": user,
 	})
 }
 
-// HandleLostPassword handles lost password requests
-func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
-	if c.Request.Method == "GET" {
-		c.HTML(http.StatusOK, "lostpassword.html", gin.H{
-			"user": nil,
+// invalidResetToken answers a reset attempt whose token was refused: 410
+// for an expired link, so the page can offer a new one, 400 otherwise
+func (h *AuthHandler) invalidResetToken(c *gin.Context, err error, user string) {
+	switch {
+	case errors.Is(err, auth.ErrExpiredResetToken):
+		c.HTML(http.StatusGone, "pwreset-invalid.html", gin.H{
+			"user":    nil,
+			"reguser": user,
+			"error":   "This reset link has expired, please request a new one",
+		})
+	case errors.Is(err, auth.ErrInvalidResetToken):
+		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
+			"user":    nil,
+			"reguser": user,
+		})
+	default:
+		c.HTML(http.StatusInternalServerError, "pwreset-invalid.html", gin.H{
+			"user":    nil,
+			"reguser": user,
 		})
-		return
 	}
+}
 
+// HandleLostPasswordGet handles GET requests to /lostpw
+func (h *AuthHandler) HandleLostPasswordGet(c *gin.Context) {
+	c.HTML(http.StatusOK, "lostpassword.html", gin.H{
+		"user": nil,
+	})
+}
+
+// HandleLostPasswordPost handles POST requests to /lostpw
+func (h *AuthHandler) HandleLostPasswordPost(c *gin.Context) {
 	var req struct {
 		Email string `json:"email" form:"email"`
 	}
@@ -359,7 +541,11 @@ func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
 		return
 	}
 
-	exists, err := h.service.UserExists(req.Email)
+	if !h.checkFieldLengths(c, "lostpassword.html", h.emailField(req.Email)) {
+		return
+	}
+
+	exists, err := h.serviceFor(c).UserExists(req.Email)
 	if err != nil || !exists {
 		c.HTML(http.StatusBadRequest, "lostpassword-baduser.html", gin.H{
 			"user":    nil,
@@ -368,9 +554,7 @@ func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
 		return
 	}
 
-	// Generate dongle and send email
-	dongle := h.generateRandomString(20)
-	err = h.service.SetUserDongle(req.Email, dongle)
+	token, err := h.serviceFor(c).GeneratePasswordResetToken(req.Email)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "lostpassword.html", gin.H{
 			"user": nil,
@@ -379,7 +563,10 @@ func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
 	}
 
 	// Send password reset email
-	err = h.sendLostPasswordEmail(req.Email, dongle, c.Request.Host)
+	base, err := h.handler.publicURL(c)
+	if err == nil {
+		err = h.sendLostPasswordEmail(req.Email, token, base)
+	}
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "lostpassword.html", gin.H{
 			"user": nil,
@@ -396,40 +583,168 @@ func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
 func (h *AuthHandler) setCurrentUser(c *gin.Context, user string) {
     fmt.Printf("DEBUG: Setting current user: '%s'\n", user)
     
-    // Store email directly as cookie value
+    // The cookies outlive the session by the grace period so an expired
+    // session can still be recognised and offered a re-auth prompt
+    lifetime := h.handler.Config.SessionLifetime
+    if lifetime <= 0 {
+        lifetime = 24 * time.Hour
+    }
+    maxAge := int((lifetime + h.handler.Config.SessionGracePeriod).Seconds())
+
+    // Tie the session to the user's token version so a password change
+    // elsewhere can revoke it
+    version, err := h.serviceFor(c).TokenVersion(user)
+    if err != nil {
+        fmt.Printf("DEBUG: Failed to read token version for %s: %v\n", user, err)
+    }
+
+    // With session tokens on, the user and version are named by a signed
+    // token rather than plain cookies anyone could set
     c.SetSameSite(http.SameSiteStrictMode)
-    c.SetCookie("user", user, 3600*24, "/", "", false, true)
+    if auth.TokensEnabled() {
+        token, err := auth.IssueToken(user, version)
+        if err != nil {
+            fmt.Printf("DEBUG: Failed to issue session token for %s: %v\n", user, err)
+            return
+        }
+        c.SetCookie(middleware.SessionTokenCookie, token, maxAge, "/", "", false, true)
+    } else {
+        c.SetCookie("user", user, maxAge, "/", "", false, true)
+    }
+    c.SetCookie(middleware.SessionExpiresCookie, strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10), maxAge, "/", "", false, true)
+    c.Set(middleware.CurrentUserKey, user)
+    c.SetCookie(middleware.SessionVersionCookie, strconv.Itoa(version), maxAge, "/", "", false, true)
     
     fmt.Printf("DEBUG: User cookie set successfully\n")
 }
 
-func (h *AuthHandler) generateRandomString(length int) string {
-	bytes := make([]byte, length)
-	rand.Read(bytes)
-	return base64.URLEncoding.EncodeToString(bytes)[:length]
+// fieldLimit pairs a submitted form value with its configured maximum
+// length, counted in characters or, with bytes set, in bytes
+type fieldLimit struct {
+	name  string
+	value string
+	max   int
+	bytes bool
+}
+
+func (h *AuthHandler) emailField(value string) fieldLimit {
+	return fieldLimit{name: "email", value: value, max: h.handler.Config.MaxEmailLength}
+}
+
+// passwordField is measured in bytes, as bcrypt hashes at most
+// models.MaxPasswordBytes of it; that limit applies even with the
+// configured one off
+func (h *AuthHandler) passwordField(value string) fieldLimit {
+	max := h.handler.Config.MaxPasswordLength
+	if max <= 0 || max > models.MaxPasswordBytes {
+		max = models.MaxPasswordBytes
+	}
+	return fieldLimit{name: "password", value: value, max: max, bytes: true}
 }
 
-func (h *AuthHandler) sendLostPasswordEmail(userEmail, dongle, host string) error {
+func (h *AuthHandler) otherField(name, value string) fieldLimit {
+	return fieldLimit{name: name, value: value, max: h.handler.Config.MaxFieldLength}
+}
+
+// checkFieldLengths rejects the request with a 400 when any field exceeds
+// its limit, and reports whether the request may proceed
+func (h *AuthHandler) checkFieldLengths(c *gin.Context, template string, fields ...fieldLimit) bool {
+	for _, field := range fields {
+		length, unit := utf8.RuneCountInString(field.value), "characters"
+		if field.bytes {
+			length, unit = len(field.value), "bytes"
+		}
+		if field.max <= 0 || length <= field.max {
+			continue
+		}
+
+		message := fmt.Sprintf("%s must be at most %d %s", field.name, field.max, unit)
+		if c.GetHeader("Content-Type") == "application/json" {
+			respondJSON(c, http.StatusBadRequest, gin.H{
+				"data":    "fieldtoolong",
+				"result":  "fail",
+				"field":   field.name,
+				"message": message,
+			})
+		} else {
+			c.HTML(http.StatusBadRequest, template, gin.H{
+				"user":  nil,
+				"error": message,
+			})
+		}
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandler) sendLostPasswordEmail(userEmail, token, base string) error {
 	// This would need the email service to be implemented
 	// For now, we'll return nil
-	link := fmt.Sprintf("http://%s/pwreset?u=%s&d=%s", host, userEmail, dongle)
-	message := email.NewMessage()
-	message.Subject = "Reset Password"
-	message.BodyText = fmt.Sprintf("Please click the following link to reset password for user %s\n%s", userEmail, link)
+	link := fmt.Sprintf("%s/pwreset?t=%s", base, url.QueryEscape(token))
+	_, err := h.handler.Emails.Render(email.TemplateReset, "", email.TemplateData{Email: userEmail, Link: link})
 
 	// Note: This assumes we have access to the email service and from email
 	// We would need to implement this properly with the actual email service
-	return nil
+	return err
+}
+
+// redirectIfLoggedIn sends an already-authenticated user on to the
+// configured landing page instead of showing a login or register form
+func (h *AuthHandler) redirectIfLoggedIn(c *gin.Context) bool {
+    target := h.handler.Config.LoginRedirectURL
+    if target == "" || h.getCurrentUser(c) == "" {
+        return false
+    }
+    c.Redirect(http.StatusFound, target)
+    return true
 }
 
 func (h *AuthHandler) HandleLoginGet(c *gin.Context) {
+    if h.redirectIfLoggedIn(c) {
+        return
+    }
+    next := c.Query("next")
+    if !middleware.SafeRedirect(next) {
+        next = ""
+    }
     c.HTML(http.StatusOK, "login.html", gin.H{
         "user": nil,
+        "next": next,
         "error": "",
     })
 }
 
+// HandleReauthGet shows a sign-in prompt for a user whose session expired
+// within the grace period, carrying the page they were headed to
+func (h *AuthHandler) HandleReauthGet(c *gin.Context) {
+    next := c.Query("next")
+    if !middleware.SafeRedirect(next) {
+        next = ""
+    }
+
+    user := h.getCurrentUser(c)
+    if user == "" {
+        target := "/login"
+        if next != "" {
+            target += "?next=" + url.QueryEscape(next)
+        }
+        c.Redirect(http.StatusFound, target)
+        return
+    }
+
+    c.HTML(http.StatusOK, "login.html", gin.H{
+        "user":   nil,
+        "email":  user,
+        "next":   next,
+        "reauth": true,
+        "error":  "Your session has expired. Please sign in again to continue.",
+    })
+}
+
 func (h *AuthHandler) HandleRegisterGet(c *gin.Context) {
+    if h.redirectIfLoggedIn(c) {
+        return
+    }
     c.HTML(http.StatusOK, "register.html", gin.H{
         "user": nil,
         "error": "",
@@ -437,23 +752,20 @@ func (h *AuthHandler) HandleRegisterGet(c *gin.Context) {
 }
 
 // Update getCurrentUser with debugging
+// CurrentUser is the user the request is made as, by API key or session
+// cookie, or "" when anonymous
+func (h *AuthHandler) CurrentUser(c *gin.Context) string {
+    return h.getCurrentUser(c)
+}
+
 func (h *AuthHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
+    // Set by RequireAuth on protected routes
+    if user, ok := middleware.CurrentUser(c); ok {
+        return user
     }
-
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
+    // A valid API key stands in for the session cookie
+    if user := c.GetString(middleware.APIKeyUserKey); user != "" {
         return user
     }
-    
-    // Plain text format
-    return userCookie
+    return middleware.SessionUser(c)
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/email"
+	"github.com/gin-gonic/gin"
+)
+
+// startConfirmation finishes registering a user whose account must be
+// confirmed: rather than logging them in, it emails them a confirmation
+// link and tells them to look for it
+func (h *AuthHandler) startConfirmation(c *gin.Context, userEmail string) {
+	token, err := h.serviceFor(c).GenerateConfirmationToken(userEmail)
+	var base string
+	if err == nil {
+		base, err = h.handler.publicURL(c)
+	}
+	if err == nil {
+		err = h.sendConfirmationEmail(userEmail, token, base)
+	}
+	if err != nil {
+		// The account exists either way; it can't log in until confirmed,
+		// and is purged if never confirmed
+		fmt.Printf("DEBUG: Failed to send confirmation email to %s: %v\n", userEmail, err)
+	}
+
+	message := "Registration successful, check your email for a link to confirm your account"
+	if c.GetHeader("Content-Type") == "application/json" {
+		respondJSON(c, http.StatusOK, gin.H{
+			"data":    "confirmemail",
+			"result":  "ok",
+			"message": message,
+		})
+		return
+	}
+	c.HTML(http.StatusOK, "login.html", gin.H{
+		"user":   nil,
+		"email":  userEmail,
+		"notice": message,
+		"error":  "",
+	})
+}
+
+func (h *AuthHandler) sendConfirmationEmail(userEmail, token, base string) error {
+	link := fmt.Sprintf("%s/confirm?t=%s", base, url.QueryEscape(token))
+	message, err := h.handler.Emails.Render(email.TemplateConfirm, "", email.TemplateData{Email: userEmail, Link: link})
+	if err != nil {
+		return err
+	}
+	if h.handler.Email == nil || h.handler.Email.service == nil {
+		return errors.New("email service not configured")
+	}
+	return h.handler.Email.service.SendEmail(h.handler.Config.FromEmail, userEmail, message)
+}
+
+// HandleConfirm handles GET /confirm, the link in the confirmation email.
+// Following it again once confirmed just shows the login page.
+func (h *AuthHandler) HandleConfirm(c *gin.Context) {
+	err := h.serviceFor(c).ConfirmWithToken(c.Query("t"))
+	switch {
+	case err == nil:
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"user":   nil,
+			"notice": "Your email address is confirmed, you can now log in",
+			"error":  "",
+		})
+	case errors.Is(err, auth.ErrExpiredConfirmToken):
+		c.HTML(http.StatusGone, "login.html", gin.H{
+			"user":  nil,
+			"error": "This confirmation link has expired, please register again",
+		})
+	case errors.Is(err, auth.ErrInvalidConfirmToken):
+		c.HTML(http.StatusBadRequest, "login.html", gin.H{
+			"user":  nil,
+			"error": "This confirmation link is not valid",
+		})
+	default:
+		c.HTML(http.StatusInternalServerError, "login.html", gin.H{
+			"user":  nil,
+			"error": h.handler.errorDetail("Failed to confirm account", err),
+		})
+	}
+}
+
+// HandlePurgeUnconfirmed handles POST /admin/users/purge-unconfirmed,
+// deleting accounts whose confirmation link expired unused
+func (h *AdminHandler) HandlePurgeUnconfirmed(c *gin.Context) {
+	purged, err := h.handler.Auth.serviceFor(c).PurgeUnconfirmed()
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to purge unconfirmed users", err),
+			"purged": purged,
+		})
+		return
+	}
+	if purged == nil {
+		purged = []string{}
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"purged": purged,
+	})
+}
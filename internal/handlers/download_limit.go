@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policies for downloads larger than MAX_DOWNLOAD_SIZE (OVERSIZED_DOWNLOADS)
+const (
+	OversizedRefuse   = "refuse"
+	OversizedTruncate = "truncate"
+)
+
+// sendDownload writes content, the file stored at path, with the headers
+// already set. Content beyond MaxDownloadSize is refused with 413 or cut
+// short and sent as 206 with a Content-Range showing the full size, so
+// clients can tell the file is incomplete.
+func (h *WebAppHandler) sendDownload(c *gin.Context, path []string, content string) {
+	max := h.handler.Config.MaxDownloadSize
+	if max <= 0 || len(content) <= max {
+		c.String(http.StatusOK, content)
+		return
+	}
+
+	log.Printf("Download of %s is %d bytes, over the %d byte limit", strings.Join(path, "/"), len(content), max)
+	if h.handler.Config.OversizedDownloads != OversizedTruncate {
+		c.Header("Content-Disposition", "")
+		respondJSON(c, http.StatusRequestEntityTooLarge, gin.H{
+			"result": "fail",
+			"data":   fmt.Sprintf("file is %d bytes, download limit is %d", len(content), max),
+		})
+		return
+	}
+
+	c.Header("Content-Range", fmt.Sprintf("bytes 0-%d/%d", max-1, len(content)))
+	c.Header("X-Download-Truncated", "true")
+	c.String(http.StatusPartialContent, content[:max])
+}
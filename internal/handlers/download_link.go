@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/signedurl"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// usedLinkDir records the IDs of one-time download links already used
+const usedLinkDir = "system/downloadlinks/"
+
+// downloadLinkResponse is a freshly signed download link
+type downloadLinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Once      bool      `json:"once"`
+}
+
+// linkSigner signs download links with DownloadLinkSecret. Without one
+// links are disabled: the cookie secret has a public default, so signing
+// with it would let anyone mint links.
+func (h *WebAppHandler) linkSigner() *signedurl.Signer {
+	if h.handler.Config.DownloadLinkSecret == "" {
+		return nil
+	}
+	return signedurl.New(h.handler.Config.DownloadLinkSecret)
+}
+
+// respondLinksDisabled answers a download link request when linkSigner
+// has no secret to sign with
+func respondLinksDisabled(c *gin.Context) {
+	respondJSON(c, http.StatusNotFound, gin.H{
+		"result": "fail",
+		"data":   "download links are disabled",
+	})
+}
+
+// HandleDownloadLinkCreate handles POST /api/downloadlinks, signing a link
+// to one of the current user's files or to one shared with them. The link
+// works without logging in until DownloadLinkTTL has passed, and with once
+// set only a single time.
+func (h *WebAppHandler) HandleDownloadLinkCreate(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+	signer := h.linkSigner()
+	if signer == nil {
+		respondLinksDisabled(c)
+		return
+	}
+
+	var req struct {
+		Fname string `json:"fname" form:"fname"`
+		Owner string `json:"owner" form:"owner"`
+		Once  bool   `json:"once" form:"once"`
+	}
+	if err := c.ShouldBind(&req); err != nil || !isSheetName(req.Fname) || strings.ContainsAny(req.Fname, `/\`) {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "missing or invalid filename",
+		})
+		return
+	}
+	// A collaborator's link downloads the owner's copy
+	owner := req.Owner
+	if owner == "" {
+		owner = user
+	}
+	if !h.authorizeSheet(c, h.handler.storageFor(c), user, owner, req.Fname, storage.PermissionRead) {
+		return
+	}
+	if _, err := h.handler.storageFor(c).GetFile(c.Request.Context(), []string{"home", owner, req.Fname}); err != nil {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return
+	}
+
+	ttl := h.handler.Config.DownloadLinkTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	by := ""
+	if owner != user {
+		by = user
+	}
+	token, claims, err := signer.Sign(owner, req.Fname, by, ttl, req.Once)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to sign link", err),
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, downloadLinkResponse{
+		URL:       "/d/" + token,
+		ExpiresAt: claims.Expires,
+		Once:      claims.Once,
+	})
+}
+
+// HandleDownloadLink handles GET /d/:token, sending the file a signed link
+// grants with no session needed. Forged links, and links to anything but
+// a sheet in an account's home, get 404; expired or used up ones 410. A
+// collaborator's link stops working, with 403, once their access is
+// revoked.
+func (h *WebAppHandler) HandleDownloadLink(c *gin.Context) {
+	signer := h.linkSigner()
+	if signer == nil {
+		respondLinksDisabled(c)
+		return
+	}
+	claims, err := signer.Verify(c.Param("token"))
+	if errors.Is(err, signedurl.ErrExpired) {
+		respondJSON(c, http.StatusGone, gin.H{
+			"result": "fail",
+			"data":   "link has expired",
+		})
+		return
+	}
+	if err != nil {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "link not found",
+		})
+		return
+	}
+
+	// Only links to a sheet of an existing account are ever signed, so
+	// anything else, such as a user record, is refused even if the
+	// signature checks out
+	store := h.handler.storageFor(c)
+	path := []string{"home", claims.User, claims.File}
+	if !isSheetName(claims.File) || strings.ContainsAny(claims.File, `/\`) || !h.accountHome(c, claims.User) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "link not found",
+		})
+		return
+	}
+	if claims.By != "" && !h.authorizeSheet(c, store, claims.By, claims.User, claims.File, storage.PermissionRead) {
+		return
+	}
+	item, err := store.GetFile(c.Request.Context(), path)
+	if err != nil {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return
+	}
+
+	// Claiming the ID atomically means two racing requests can't both
+	// download through a one-time link
+	if claims.Once {
+		claimed, err := storage.CompareAndSwap(store, usedLinkDir+claims.ID, "", claims.Expires.Format(time.RFC3339))
+		if err != nil {
+			respondJSON(c, http.StatusInternalServerError, gin.H{
+				"result": "fail",
+				"data":   h.handler.errorDetail("failed to check link", err),
+			})
+			return
+		}
+		if !claimed {
+			respondJSON(c, http.StatusGone, gin.H{
+				"result": "fail",
+				"data":   "link has already been used",
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", claims.File))
+	h.sendDownload(c, path, downloadContent(item))
+}
+
+// accountHome reports whether user names an existing account, whose home
+// is home/<user>, rather than a directory such as home/users
+func (h *WebAppHandler) accountHome(c *gin.Context, user string) bool {
+	if user == "" || user == auth.UserDir || strings.ContainsAny(user, `/\`) || strings.HasPrefix(user, ".") {
+		return false
+	}
+	exists, err := h.handler.Auth.serviceFor(c).UserExists(user)
+	return err == nil && exists
+}
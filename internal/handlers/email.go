@@ -1,8 +1,8 @@
 package handlers
 
 import (
-    "encoding/json"
     "net/http"
+    "time"
 
     "github.com/c4gt/tornado-nginx-go-backend/internal/email"
     "github.com/gin-gonic/gin"
@@ -31,7 +31,7 @@ type EmailRequest struct {
 func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
     // If email service is not available, return graceful error
     if h.service == nil {
-        c.JSON(http.StatusServiceUnavailable, gin.H{
+        respondJSON(c, http.StatusServiceUnavailable, gin.H{
             "data":   "Email service not configured (AWS SES credentials not provided)",
             "result": "fail",
         })
@@ -40,7 +40,7 @@ func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
 
     var req EmailRequest
     if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "error": "Invalid request",
         })
         return
@@ -72,28 +72,38 @@ func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
 	fromEmail := h.handler.Config.FromEmail
 	err := h.service.SendEmail(fromEmail, req.To, message)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		respondJSON(c, http.StatusInternalServerError, gin.H{
 			"error": "Failed to send email",
 		})
 		return
 	}
 
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "data": req.To,
     })
 }
 
 func (h *EmailHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
+    return h.handler.Auth.CurrentUser(c)
+}
+
 
-    var user string
-    err = json.Unmarshal([]byte(userCookie), &user)
+// emailLoginNotifier tells users about logins from unfamiliar addresses
+type emailLoginNotifier struct {
+    service   *email.SESService
+    templates *email.Templates
+    from      string
+}
+
+func (n *emailLoginNotifier) NotifyNewLogin(userEmail, ip string, at time.Time) error {
+    message, err := n.templates.Render(email.TemplateNewLogin, "", email.TemplateData{
+        Email: userEmail,
+        IP:    ip,
+        Time:  at,
+    })
     if err != nil {
-        return ""
+        return err
     }
 
-    return user
+    return n.service.SendEmail(n.from, userEmail, message)
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// CheckEntitlement is a middleware.EntitlementChecker backed by the user
+// store
+func (h *AuthHandler) CheckEntitlement(c *gin.Context, entitlement string) (bool, bool) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		return false, false
+	}
+	allowed, err := h.serviceFor(c).HasEntitlement(user, entitlement)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to check entitlement %s for %s: %v\n", entitlement, user, err)
+		return true, false
+	}
+	return true, allowed
+}
+
+// HandleGetEntitlements handles GET /admin/users/:email/entitlements,
+// returning the user's effective entitlements
+func (h *AdminHandler) HandleGetEntitlements(c *gin.Context) {
+	email := c.Param("email")
+	entitlements, err := h.handler.Auth.serviceFor(c).Entitlements(email)
+	if err != nil {
+		h.respondUserError(c, err)
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":       "ok",
+		"email":        email,
+		"entitlements": entitlements,
+	})
+}
+
+// HandleSetEntitlements handles PUT /admin/users/:email/entitlements with
+// {"entitlements": [...]}; a null list returns the user to the defaults
+func (h *AdminHandler) HandleSetEntitlements(c *gin.Context) {
+	email := c.Param("email")
+	var req struct {
+		Entitlements []string `json:"entitlements"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "expected {\"entitlements\": [...]}",
+		})
+		return
+	}
+
+	err := h.handler.Auth.serviceFor(c).SetEntitlements(email, req.Entitlements)
+	if errors.Is(err, auth.ErrUnknownEntitlement) {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		h.respondUserError(c, err)
+		return
+	}
+	h.HandleGetEntitlements(c)
+}
+
+func (h *AdminHandler) respondUserError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "no such user",
+		})
+		return
+	}
+	respondJSON(c, http.StatusInternalServerError, gin.H{
+		"result": "fail",
+		"data":   h.handler.errorDetail("failed to update user", err),
+	})
+}
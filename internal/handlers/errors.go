@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// newErrorRef returns a short random ID that ties a client-facing error to
+// the server log entry holding its details
+func newErrorRef() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// errorDetail logs an internal error in full under a fresh reference ID and
+// returns the text to show the client. Outside production that is the
+// detailed message; in production it is a generic message carrying only the
+// reference, so storage errors and internals never reach clients.
+func (h *Handler) errorDetail(message string, err error) string {
+	ref := newErrorRef()
+	log.Printf("ERROR [%s] %s: %v", ref, message, err)
+
+	if h.Config.Environment == "production" {
+		return fmt.Sprintf("internal error (ref %s)", ref)
+	}
+	return fmt.Sprintf("%s: %v (ref %s)", message, err, ref)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/sheet"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// xlsxContentType is the media type of an Excel workbook
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// exportSheet loads the sheet named by ?fname= for an export, returning
+// its name and tabs. It responds and returns false when there's no user,
+// the user may not read the sheet, or the sheet doesn't exist.
+func (h *WebAppHandler) exportSheet(c *gin.Context) (string, []sheet.Tab, bool) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return "", nil, false
+	}
+
+	fname := c.Query("fname")
+	if fname == "" {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "missing filename",
+		})
+		return "", nil, false
+	}
+
+	owner := sheetOwner(c, user)
+	store := h.handler.storageFor(c)
+	if !h.authorizeSheet(c, store, user, owner, fname, storage.PermissionRead) {
+		return "", nil, false
+	}
+	item, err := store.GetFile(c.Request.Context(), []string{"home", owner, fname})
+	if errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return "", nil, false
+	}
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read sheet", err),
+		})
+		return "", nil, false
+	}
+	return fname, sheet.Tabs(downloadContent(item)), true
+}
+
+// respondSheetTooLarge refuses to export a sheet beyond the limits of
+// sheet.ParseGrid
+func respondSheetTooLarge(c *gin.Context) {
+	respondJSON(c, http.StatusRequestEntityTooLarge, gin.H{
+		"result": "fail",
+		"data": fmt.Sprintf("sheet is too large to export, the limit is %d rows, %d columns and %d cells",
+			sheet.MaxRows, sheet.MaxCols, sheet.MaxCells),
+	})
+}
+
+// HandleExportCSV handles GET /export/csv?fname=, sending the cell values
+// of a sheet the user may read as a CSV attachment. CSV has room for one
+// sheet, so only a workbook's first tab is exported.
+func (h *WebAppHandler) HandleExportCSV(c *gin.Context) {
+	fname, tabs, ok := h.exportSheet(c)
+	if !ok {
+		return
+	}
+	grid, err := sheet.ParseGrid(tabs[0].Data)
+	if err != nil {
+		respondSheetTooLarge(c)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".csv"))
+	c.Status(http.StatusOK)
+	// The status is already sent, so a failure here can only be logged
+	if err := sheet.WriteCSV(c.Writer, grid); err != nil {
+		fmt.Printf("DEBUG: CSV export of %s failed: %v\n", fname, err)
+	}
+}
+
+// HandleExportXLSX handles GET /export/xlsx?fname=, sending a sheet the
+// user may read as an Excel workbook with a worksheet for each tab
+func (h *WebAppHandler) HandleExportXLSX(c *gin.Context) {
+	fname, tabs, ok := h.exportSheet(c)
+	if !ok {
+		return
+	}
+	book, err := sheet.NewWorkbook(tabs)
+	if errors.Is(err, sheet.ErrTooLarge) {
+		respondSheetTooLarge(c)
+		return
+	}
+	if err != nil {
+		fmt.Printf("DEBUG: XLSX export of %s failed: %v\n", fname, err)
+		respondJSON(c, http.StatusInternalServerError, gin.H{"result": "fail", "data": h.handler.errorDetail("failed to export sheet", err)})
+		return
+	}
+	defer book.Close()
+
+	c.Header("Content-Type", xlsxContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fname+".xlsx"))
+	c.Status(http.StatusOK)
+	// The status is already sent, so a failure here can only be logged
+	if _, err := book.WriteTo(c.Writer); err != nil {
+		fmt.Printf("DEBUG: XLSX export of %s failed: %v\n", fname, err)
+	}
+}
@@ -1,24 +1,60 @@
 package handlers
 
 import (
+    "context"
+    "errors"
     "log"
+    "net/http"
+    "time"
 
     "github.com/c4gt/tornado-nginx-go-backend/internal/auth"
     "github.com/c4gt/tornado-nginx-go-backend/internal/config"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/counters"
     "github.com/c4gt/tornado-nginx-go-backend/internal/email"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/models"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/outbound"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/pdf"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/reputation"
     "github.com/c4gt/tornado-nginx-go-backend/internal/session"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/settings"
     "github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/thumbnail"
+    "github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+    "github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-    Config  *config.Config
-    Storage storage.Storage
-    Session *session.Manager
-    Auth    *AuthHandler
-    WebApp  *WebAppHandler
-    Email   *EmailHandler
-    App     *AppHandler
-    Dropbox *DropboxHandler
+    Config   *config.Config
+    Storage  storage.Storage
+    Tenants  *storage.TenantResolver
+    Session  *session.Manager
+    Settings *settings.Service
+    Changes  *storage.ChangeLog
+    Counters *counters.Counters
+    Trash    *storage.Trash
+    PDF      pdf.Engine
+    Limiter  *middleware.RateLimiter
+    Sampler  *middleware.Sampler
+    // WebSockets caps open WebSocket connections
+    WebSockets *middleware.WebSocketLimiter
+    Emails   *email.Templates
+    // Thumbnails renders sheet previews on save; nil when disabled
+    Thumbnails *thumbnail.Generator
+    // Reputation blocks IPs with a history of abuse; nil when disabled
+    Reputation *reputation.Tracker
+    // HTTPClient is shared by every call out to another service, such as
+    // the password denylist and Dropbox, with bounded timeouts
+    HTTPClient *http.Client
+    Auth     *AuthHandler
+    WebApp   *WebAppHandler
+    Email    *EmailHandler
+    App      *AppHandler
+    Dropbox  *DropboxHandler
+    Health   *HealthHandler
+    Admin    *AdminHandler
+
+    // Outcome of the PDF engine self-test, once it has run
+    PDFStatus pdf.Status
 }
 
 func NewHandler(cfg *config.Config) *Handler {
@@ -27,6 +63,14 @@ func NewHandler(cfg *config.Config) *Handler {
     if err != nil {
         log.Fatalf("Failed to initialize storage backend (%s): %v", cfg.StorageBackend, err)
     }
+    if cfg.EnableCache {
+        storageBackend = storage.NewCachedStorage(storageBackend, cfg.CacheTTL, cfg.CacheMaxEntries)
+    }
+
+    tenants, err := storage.NewTenantStorage(cfg, storageBackend)
+    if err != nil {
+        log.Fatalf("Failed to initialize tenant storage: %v", err)
+    }
 
     // Initialize session manager
     sessionManager := session.NewManager()
@@ -49,18 +93,204 @@ func NewHandler(cfg *config.Config) *Handler {
         log.Println("AWS credentials not provided or using placeholder values, email functionality disabled")
     }
 
+    emailTemplates := email.NewTemplates(cfg.EmailTemplatesPath)
+
+    if cfg.LoginNotifications {
+        if emailService != nil {
+            authService.SetLoginNotifier(&emailLoginNotifier{service: emailService, templates: emailTemplates, from: cfg.FromEmail})
+        } else {
+            log.Println("Login notifications enabled but email is unavailable, notifications disabled")
+        }
+    }
+
+    if cfg.MFAEnabled {
+        mfaKey := cfg.MFAEncryptionKey
+        if mfaKey == "" {
+            mfaKey = cfg.CookieSecret
+        }
+        authService.SetMFAKey(mfaKey)
+    }
+
+    authService.SetRevokeSessionsOnPasswordChange(cfg.LogoutOnPasswordChange)
+    authService.SetIdempotentCreate(cfg.IdempotentCreate)
+    authService.SetDefaultEntitlements(cfg.DefaultEntitlements)
+    authService.SetAdmins(cfg.AdminUsers)
+    authService.SetResetTokenTTL(cfg.PasswordResetTTL)
+    authService.SetPasswordHistory(cfg.PasswordHistory)
+    authService.SetLockout(cfg.LockoutAttempts, cfg.LockoutCooldown)
+    authService.SetSoftDelete(cfg.SoftDeleteUsers)
+    authService.SetDeletionReasonLimit(cfg.DeletionReasonMaxLength)
+    authService.SetRequireConfirmation(cfg.RequireEmailConfirmation)
+    authService.SetConfirmTokenTTL(cfg.ConfirmTokenTTL)
+
+    httpClient := outbound.New(outbound.Options{
+        DialTimeout:         cfg.OutboundDialTimeout,
+        ResponseTimeout:     cfg.OutboundResponseTimeout,
+        Timeout:             cfg.OutboundTimeout,
+        MaxIdleConnsPerHost: cfg.OutboundMaxIdlePerHost,
+    })
+    denylist, err := auth.LoadPasswordDenylistWithClient(cfg.PasswordDenylist, httpClient)
+    if err != nil {
+        log.Fatalf("Failed to load password denylist: %v", err)
+    }
+    models.SetPasswordDenylist(denylist)
+    if err := models.SetPasswordHashCost(cfg.BcryptCost); err != nil {
+        log.Fatalf("Invalid BCRYPT_COST: %v", err)
+    }
+    if cfg.MaxPasswordLength > models.MaxPasswordBytes {
+        log.Fatalf("Invalid MAX_PASSWORD_LENGTH: bcrypt takes at most %d bytes", models.MaxPasswordBytes)
+    }
+
+    // Session tokens last as long as the session cookies they ride in
+    if cfg.JWTSecret != "" {
+        lifetime := cfg.SessionLifetime
+        if lifetime <= 0 {
+            lifetime = 24 * time.Hour
+        }
+        auth.SetTokenSecret(cfg.JWTSecret, lifetime+cfg.SessionGracePeriod)
+        middleware.UseSessionTokens(auth.ParseToken)
+    } else if cfg.Environment == "production" {
+        // Without a secret anyone can name any user in the plain cookie
+        log.Fatalf("JWT_SECRET must be set in production; sessions would trust an unsigned user cookie")
+    }
+
+    switch cfg.ImportUnknownTypes {
+    case ImportUnknownReject, ImportUnknownBinary:
+    default:
+        log.Fatalf("Invalid IMPORT_UNKNOWN_TYPES %q, want %q or %q", cfg.ImportUnknownTypes, ImportUnknownReject, ImportUnknownBinary)
+    }
+    switch cfg.OversizedDownloads {
+    case OversizedRefuse, OversizedTruncate:
+    default:
+        log.Fatalf("Invalid OVERSIZED_DOWNLOADS %q, want %q or %q", cfg.OversizedDownloads, OversizedRefuse, OversizedTruncate)
+    }
+
     h := &Handler{
-        Config:  cfg,
-        Storage: storageBackend,
-        Session: sessionManager,
+        Config:   cfg,
+        Storage:  storageBackend,
+        Tenants:  tenants,
+        Session:  sessionManager,
+        Settings: settings.NewService(storageBackend),
+        Changes:  storage.NewChangeLog(cfg.ChangeLogBatchSize, cfg.ChangeLogFlushInterval),
+        Counters: counters.New(storageBackend),
+        Emails:   emailTemplates,
+        HTTPClient: httpClient,
+    }
+
+    if engine := pdf.NewCommand(cfg.PDFEngine); engine != nil {
+        h.PDF = engine
+    }
+
+    if cfg.TrashDir != "" {
+        h.Trash = storage.NewTrash(cfg.TrashDir, cfg.TrashRetention)
+    }
+
+    if cfg.Thumbnails {
+        h.Thumbnails = thumbnail.NewGenerator(cfg.ThumbnailWidth, cfg.ThumbnailHeight, thumbnailWorkers, thumbnailQueueSize)
+    }
+
+    if cfg.RateLimitRPS > 0 {
+        h.Limiter = middleware.NewRateLimiter(float64(cfg.RateLimitRPS), cfg.RateLimitBurst)
+        h.Limiter.SetStatsLimits(middleware.StatsLimits{
+            IdleTTL:    cfg.RateLimitIdleTTL,
+            MaxTracked: cfg.RateLimitMaxTracked,
+        })
+        if cfg.RateLimitSlowStartInitial > 0 {
+            h.Limiter.EnableSlowStart(middleware.SlowStart{
+                Initial: cfg.RateLimitSlowStartInitial,
+                Step:    cfg.RateLimitSlowStartStep,
+            })
+        }
+    }
+
+    if cfg.ReputationBlockScore > 0 {
+        scores := storageBackend
+        switch cfg.ReputationStore {
+        case reputation.StoreShared:
+        case reputation.StoreLocal:
+            scores = storage.NewMemoryStorage()
+        default:
+            log.Fatalf("Invalid REPUTATION_STORE %q, want %q or %q", cfg.ReputationStore, reputation.StoreShared, reputation.StoreLocal)
+        }
+        h.Reputation = reputation.New(scores, cfg.ReputationBlockScore, cfg.ReputationHalfLife)
+    }
+
+    if cfg.RequestSampleRate > 0 {
+        h.Sampler = middleware.NewSampler(cfg.RequestSampleRate, cfg.RequestSampleSize, cfg.RequestSampleRedact)
     }
 
     // Initialize sub-handlers
     h.Auth = NewAuthHandler(h, authService)
+    h.WebSockets = middleware.NewWebSocketLimiter(cfg.WebSocketMaxConnections, cfg.WebSocketMaxPerUser, h.Auth.CurrentUser)
     h.WebApp = NewWebAppHandler(h)
     h.Email = NewEmailHandler(h, emailService)
     h.App = NewAppHandler(h)
     h.Dropbox = NewDropboxHandler(h)
+    h.Health = NewHealthHandler(h)
+    h.Admin = NewAdminHandler(h)
 
     return h
 }
+
+// storageFor returns the Storage backing the tenant of the request, set by
+// middleware.Tenant, falling back to the shared backend. Operations are
+// retried across a dropped connection and instrumented, and reported in
+// Server-Timing when the request has it on.
+func (h *Handler) storageFor(c *gin.Context) storage.Storage {
+    var observe storage.Observer
+    if timings := middleware.TimingsFrom(c); timings != nil {
+        observe = func(op string, d time.Duration) { timings.Add("storage", d) }
+    }
+    return h.tenantStorage(c.GetString(middleware.TenantKey), observe)
+}
+
+// tenantStorage is storageFor outside a request, for background work that
+// outlives it
+func (h *Handler) tenantStorage(tenant string, observe storage.Observer) storage.Storage {
+    store := h.Storage
+    if h.Tenants != nil {
+        store = h.Tenants.Resolve(tenant)
+    }
+    store = storage.Reconnect(store, storage.ReconnectPolicy{
+        Retries: h.Config.ReconnectRetries,
+        Backoff: h.Config.ReconnectBackoff,
+    })
+    return storage.Instrument(store, observe)
+}
+
+// publicURL is the base of links sent out of band, such as in emails,
+// which mustn't follow the request's Host header: whoever sends the
+// request picks that, and could have a victim's link lead to them. It is
+// CANONICAL_HOST, or a host serving a tenant; outside production the
+// request's host is taken too, so links work without configuration.
+func (h *Handler) publicURL(c *gin.Context) (string, error) {
+    if host := h.Config.CanonicalHost; host != "" {
+        return h.Config.PublicScheme + "://" + host, nil
+    }
+    if _, ok := h.Config.TenantHosts[c.Request.Host]; ok {
+        return h.Config.PublicScheme + "://" + c.Request.Host, nil
+    }
+    if h.Config.Environment != "production" {
+        return "http://" + c.Request.Host, nil
+    }
+    return "", errors.New("CANONICAL_HOST is not set, so links can't be sent")
+}
+
+// CheckPDFEngine runs the PDF engine self-test and records the outcome,
+// which /health/ready reports
+func (h *Handler) CheckPDFEngine(ctx context.Context) error {
+    err := pdf.SelfTest(ctx, h.PDF)
+    h.PDFStatus.Set(err)
+    return err
+}
+
+// count adds one to the analytics counter name. Counting is best effort and
+// never fails the request being counted.
+func (h *Handler) count(name string) {
+    if h.Counters == nil {
+        return
+    }
+    if _, err := h.Counters.Incr(name, 1); err != nil {
+        log.Printf("Failed to count %s: %v", name, err)
+    }
+}
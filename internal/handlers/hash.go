@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contentHash is the SHA-256 of sheet content, hex encoded. Clients compare
+// it against their local copy to confirm a save arrived intact.
+func contentHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// etag is the strong ETag for sheet content, built on contentHash
+func etag(data string) string {
+	return `"` + contentHash(data) + `"`
+}
+
+// respondVersionConflict refuses a save based on content that has changed
+// since with 409, giving the current content hash when it is known so the
+// client can tell whether it has caught up
+func respondVersionConflict(c *gin.Context, current string) {
+	body := gin.H{
+		"result": "fail",
+		"data":   "versionconflict",
+	}
+	if current != "" {
+		body["hash"] = current
+	}
+	respondJSON(c, http.StatusConflict, body)
+}
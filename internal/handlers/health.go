@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultHealthTimeout applies when no health check timeout is configured
+const defaultHealthTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	handler *Handler
+
+	// TemplatesLoaded is reported by /health for deploy checks
+	TemplatesLoaded int
+}
+
+func NewHealthHandler(h *Handler) *HealthHandler {
+	return &HealthHandler{
+		handler: h,
+	}
+}
+
+// withTimeout runs check in its own goroutine and gives up after timeout,
+// so a backend that ignores its context can't hang the health endpoint
+func withTimeout(ctx context.Context, timeout time.Duration, check func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// timeout returns the configured health check timeout
+func (h *HealthHandler) timeout() time.Duration {
+	if timeout := h.handler.Config.HealthCheckTimeout; timeout > 0 {
+		return timeout
+	}
+	return defaultHealthTimeout
+}
+
+// pingStorage checks the storage backend is reachable, within the health
+// check timeout. Backends that can't be pinged always pass.
+func (h *HealthHandler) pingStorage(ctx context.Context) error {
+	pinger, ok := storage.Unwrap(h.handler.Storage).(storage.Pinger)
+	if !ok {
+		return nil
+	}
+	return withTimeout(ctx, h.timeout(), pinger.Ping)
+}
+
+// HandleLive handles GET /health/live. It answers 200 whenever the process
+// can serve requests at all, without touching dependencies, so a liveness
+// probe never restarts the server over a database outage.
+func (h *HealthHandler) HandleLive(c *gin.Context) {
+	respondJSON(c, http.StatusOK, gin.H{
+		"status": "alive",
+	})
+}
+
+// HandleHealth handles GET /health. It returns 200 while storage answers a
+// ping and 503 naming the failing component when it doesn't, so a load
+// balancer stops routing to an instance whose database is down.
+func (h *HealthHandler) HandleHealth(c *gin.Context) {
+	body := gin.H{
+		"status":           "healthy",
+		"service":          "tornado-nginx-go-backend",
+		"storage":          h.handler.Config.StorageBackend,
+		"templates_loaded": h.TemplatesLoaded,
+	}
+	if err := h.pingStorage(c.Request.Context()); err != nil {
+		body["status"] = "unhealthy"
+		body["component"] = "storage"
+		body["error"] = fmt.Sprintf("storage ping failed: %v", err)
+		respondJSON(c, http.StatusServiceUnavailable, body)
+		return
+	}
+	respondJSON(c, http.StatusOK, body)
+}
+
+// HandleReady handles GET /health/ready. It returns 200 while storage is
+// reachable and has headroom, and 503 with the failing checks when the
+// backend is down, its connection pool is saturated, local disk is low or
+// a required PDF engine self-test failed, so a load balancer can shed
+// traffic. Each check is bounded by the
+// configured health check timeout and counts as failed when it runs over.
+func (h *HealthHandler) HandleReady(c *gin.Context) {
+	cfg := h.handler.Config
+	store := storage.Unwrap(h.handler.Storage)
+	ctx := c.Request.Context()
+	timeout := h.timeout()
+	checks := gin.H{}
+	var problems []string
+
+	if _, ok := store.(storage.Pinger); ok {
+		if err := h.pingStorage(ctx); err != nil {
+			checks["storage"] = "unreachable"
+			problems = append(problems, fmt.Sprintf("storage ping failed: %v", err))
+		} else {
+			checks["storage"] = "ok"
+		}
+	}
+
+	if reporter, ok := store.(storage.PoolReporter); ok {
+		var stats storage.PoolStats
+		err := withTimeout(ctx, timeout, func(context.Context) error {
+			stats = reporter.PoolStats()
+			return nil
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("pool stats unavailable: %v", err))
+		} else {
+			checks["pool"] = gin.H{
+				"in_use":   stats.InUse,
+				"idle":     stats.Idle,
+				"max_open": stats.MaxOpen,
+			}
+			if stats.Saturated(cfg.HealthPoolSaturationPercent) {
+				problems = append(problems, fmt.Sprintf("connection pool saturated: %d/%d in use", stats.InUse, stats.MaxOpen))
+			}
+		}
+	}
+
+	if reporter, ok := store.(storage.DiskReporter); ok {
+		var free, total uint64
+		err := withTimeout(ctx, timeout, func(context.Context) (err error) {
+			free, total, err = reporter.DiskUsage()
+			return err
+		})
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("disk usage unavailable: %v", err))
+		case total > 0:
+			freePercent := int(free * 100 / total)
+			checks["disk"] = gin.H{
+				"free_bytes":   free,
+				"total_bytes":  total,
+				"free_percent": freePercent,
+			}
+			if freePercent < cfg.HealthMinDiskFreePercent {
+				problems = append(problems, fmt.Sprintf("disk space low: %d%% free", freePercent))
+			}
+		}
+	}
+
+	if ran, err := h.handler.PDFStatus.Result(); ran {
+		if err != nil {
+			checks["pdf"] = "failed"
+			if cfg.PDFSelfTestRequired {
+				problems = append(problems, fmt.Sprintf("pdf engine self-test failed: %v", err))
+			}
+		} else {
+			checks["pdf"] = "ok"
+		}
+	}
+
+	if len(problems) > 0 {
+		respondJSON(c, http.StatusServiceUnavailable, gin.H{
+			"status":   "degraded",
+			"checks":   checks,
+			"problems": problems,
+		})
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"status": "ready",
+		"checks": checks,
+	})
+}
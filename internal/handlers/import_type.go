@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of file /import recognises, reported to the client as importtype
+const (
+	importSheet  = "sheet"
+	importText   = "text"
+	importBinary = "binary"
+)
+
+// Policies for files whose type can't be determined (IMPORT_UNKNOWN_TYPES)
+const (
+	ImportUnknownReject = "reject"
+	ImportUnknownBinary = "binary"
+)
+
+// importExtensions maps the extensions /import understands to their kind
+var importExtensions = map[string]string{
+	".msc":  importSheet,
+	".msce": importSheet,
+	".csv":  importText,
+	".tsv":  importText,
+	".txt":  importText,
+}
+
+// classifyImport determines the kind of an uploaded file from its
+// extension, falling back to sniffing its content. It returns "" when
+// neither settles it, leaving the decision to the configured policy.
+func classifyImport(fname string, content []byte) string {
+	if kind, ok := importExtensions[strings.ToLower(filepath.Ext(fname))]; ok {
+		return kind
+	}
+	if strings.HasPrefix(http.DetectContentType(content), "text/") && utf8.Valid(content) {
+		return importText
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleLoginAlerts handles POST /profile/login-alerts, turning the emails
+// about logins from unfamiliar addresses on or off with {"enabled": bool}
+func (h *AuthHandler) HandleLoginAlerts(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled" form:"enabled"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Enabled == nil {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"data":   "expected enabled to be true or false",
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.serviceFor(c).SetLoginAlerts(user, *req.Enabled); err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"data":   h.handler.errorDetail("failed to save login alert preference", err),
+			"result": "fail",
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"enabled": *req.Enabled,
+	})
+}
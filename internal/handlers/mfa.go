@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleMFAEnroll handles POST /profile/mfa/enroll. It starts TOTP
+// enrollment and returns the secret, provisioning URL and recovery codes.
+func (h *AuthHandler) HandleMFAEnroll(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	enrollment, err := h.serviceFor(c).EnrollTOTP(user)
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":         "ok",
+		"secret":         enrollment.Secret,
+		"otpauth_url":    enrollment.URL,
+		"recovery_codes": enrollment.RecoveryCodes,
+	})
+}
+
+// HandleMFAVerify handles POST /profile/mfa/verify, enabling MFA once the
+// user submits a valid code from their authenticator
+func (h *AuthHandler) HandleMFAVerify(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" form:"code"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Code == "" {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"data":   "missing code",
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.serviceFor(c).ConfirmTOTP(user, req.Code); err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   "mfaenabled",
+	})
+}
+
+// HandleMFADisable handles POST /profile/mfa/disable, turning MFA off once
+// the user submits a current code or an unused recovery code
+func (h *AuthHandler) HandleMFADisable(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   "usererror",
+			"result": "fail",
+		})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" form:"code"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.Code == "" {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"data":   "missing code",
+			"result": "fail",
+		})
+		return
+	}
+
+	service := h.serviceFor(c)
+	required, err := service.MFARequired(user)
+	if err == nil && !required {
+		err = auth.ErrMFANotEnrolled
+	}
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+	ok, err := service.VerifySecondFactor(user, req.Code)
+	if err == nil && !ok {
+		err = auth.ErrInvalidMFACode
+	}
+	if err == nil {
+		err = service.DisableTOTP(user)
+	}
+	if err != nil {
+		h.respondMFAError(c, err)
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   "mfadisabled",
+	})
+}
+
+func (h *AuthHandler) respondMFAError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrMFADisabled):
+		status = http.StatusNotFound
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled), errors.Is(err, auth.ErrMFANotEnrolled):
+		status = http.StatusConflict
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		status = http.StatusUnauthorized
+	case errors.Is(err, auth.ErrAccountLocked):
+		status = http.StatusTooManyRequests
+	}
+
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = h.handler.errorDetail("mfa failure", err)
+	}
+	respondJSON(c, status, gin.H{
+		"data":   message,
+		"result": "fail",
+	})
+}
+
+// checkSecondFactor enforces TOTP for accounts that enabled it. It writes
+// the failure response itself and reports whether login may continue.
+func (h *AuthHandler) checkSecondFactor(c *gin.Context, email, code string) bool {
+	required, err := h.serviceFor(c).MFARequired(email)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to check MFA status for %s: %v\n", email, err)
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"data":   "error",
+			"result": "fail",
+		})
+		return false
+	}
+	if !required {
+		return true
+	}
+
+	data, message := "mfarequired", "Enter the code from your authenticator app"
+	if code != "" {
+		ok, err := h.serviceFor(c).VerifySecondFactor(email, code)
+		if errors.Is(err, auth.ErrAccountLocked) {
+			respondAccountLocked(c)
+			return false
+		}
+		if err != nil {
+			// The code may be right, but a recovery code or TOTP step that
+			// couldn't be recorded as used mustn't let the login through
+			fmt.Printf("DEBUG: Second factor check failed for %s: %v\n", email, err)
+			respondJSON(c, http.StatusInternalServerError, gin.H{
+				"data":   "error",
+				"result": "fail",
+			})
+			return false
+		}
+		if ok {
+			return true
+		}
+		data, message = "mfafail", "Invalid verification code"
+	}
+
+	if c.GetHeader("Content-Type") == "application/json" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"data":   data,
+			"result": "fail",
+		})
+	} else {
+		c.HTML(http.StatusUnauthorized, "login.html", gin.H{
+			"user":  nil,
+			"error": message,
+			"mfa":   true,
+		})
+	}
+	return false
+}
+
+// respondAccountLocked refuses a login to an account locked after too many
+// failed attempts
+func respondAccountLocked(c *gin.Context) {
+	if c.GetHeader("Content-Type") == "application/json" {
+		respondJSON(c, http.StatusTooManyRequests, gin.H{
+			"data":   "locked",
+			"result": "fail",
+		})
+	} else {
+		c.HTML(http.StatusTooManyRequests, "login.html", gin.H{
+			"user":  nil,
+			"error": "Too many failed logins, please try again later",
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// respondJSON writes obj as the JSON response, indented when the
+// PrettyJSON middleware asked for it and compact otherwise
+func respondJSON(c *gin.Context, code int, obj interface{}) {
+	if c.GetBool(middleware.PrettyJSONKey) {
+		c.IndentedJSON(code, obj)
+		return
+	}
+	c.JSON(code, obj)
+}
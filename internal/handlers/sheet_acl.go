@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// collaboratorRequest is the body of POST /api/sheets/:name/collaborators
+type collaboratorRequest struct {
+	Email      string             `json:"email" form:"email"`
+	Permission storage.Permission `json:"permission" form:"permission"`
+}
+
+// sheetOwner returns whose sheet a request is for: the owner query or form
+// field when given, otherwise the current user
+func sheetOwner(c *gin.Context, user string) string {
+	if owner := c.Query("owner"); owner != "" {
+		return owner
+	}
+	if owner := c.PostForm("owner"); owner != "" {
+		return owner
+	}
+	return user
+}
+
+// sheetAllowed reports whether user may use owner's sheet fname as need
+// requires. Owners may do anything with their sheets; anyone else only
+// what the sheet's access list grants them.
+func (h *WebAppHandler) sheetAllowed(store storage.Storage, user, owner, fname string, need storage.Permission) (bool, error) {
+	if owner == user {
+		return true, nil
+	}
+	if strings.ContainsAny(owner+fname, `/\`) || fname == "" {
+		return false, nil
+	}
+	acl, err := storage.GetACL(store, []string{"home", owner, fname})
+	if err != nil {
+		return false, err
+	}
+	return acl[user].Allows(need), nil
+}
+
+// authorizeSheet is sheetAllowed for JSON endpoints, responding and
+// returning false when user may not use the sheet
+func (h *WebAppHandler) authorizeSheet(c *gin.Context, store storage.Storage, user, owner, fname string, need storage.Permission) bool {
+	allowed, err := h.sheetAllowed(store, user, owner, fname, need)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read access list", err),
+		})
+		return false
+	}
+	if !allowed {
+		respondJSON(c, http.StatusForbidden, gin.H{
+			"result": "fail",
+			"data":   "forbidden",
+		})
+		return false
+	}
+	return true
+}
+
+// collaboratorSheet returns the path of the current user's sheet named in
+// the URL for the collaborator endpoints, responding and returning nil
+// when there is no user or no such sheet. Only owners manage access.
+func (h *WebAppHandler) collaboratorSheet(c *gin.Context, store storage.Storage) []string {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return nil
+	}
+	fname := c.Param("name")
+	if !isSheetName(fname) || strings.ContainsAny(fname, `/\`) {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "invalid sheet name",
+		})
+		return nil
+	}
+
+	path := []string{"home", user, fname}
+	item, err := store.GetFile(c.Request.Context(), path)
+	if err == storage.ErrNotFound || (err == nil && item.Type == "dir") {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return nil
+	}
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read sheet", err),
+		})
+		return nil
+	}
+	return path
+}
+
+// HandleCollaboratorsList handles GET /api/sheets/:name/collaborators,
+// listing who the current user's sheet is shared with
+func (h *WebAppHandler) HandleCollaboratorsList(c *gin.Context) {
+	store := h.handler.storageFor(c)
+	path := h.collaboratorSheet(c, store)
+	if path == nil {
+		return
+	}
+
+	acl, err := storage.GetACL(store, path)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read access list", err),
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":        "ok",
+		"collaborators": acl,
+	})
+}
+
+// HandleCollaboratorAdd handles POST /api/sheets/:name/collaborators,
+// giving another registered user read or edit access to the current
+// user's sheet. Adding someone already listed changes their permission.
+func (h *WebAppHandler) HandleCollaboratorAdd(c *gin.Context) {
+	store := h.handler.storageFor(c)
+	path := h.collaboratorSheet(c, store)
+	if path == nil {
+		return
+	}
+
+	var req collaboratorRequest
+	if err := c.ShouldBind(&req); err != nil || req.Email == "" || !req.Permission.Valid() {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "expected an email and a permission of read or edit",
+		})
+		return
+	}
+	email := auth.NormalizeEmail(req.Email)
+	if email == path[1] {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "the owner already has full access",
+		})
+		return
+	}
+	exists, err := h.handler.Auth.serviceFor(c).UserExists(email)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to look up user", err),
+		})
+		return
+	}
+	if !exists {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "no such user",
+		})
+		return
+	}
+
+	if err := storage.Grant(store, path, email, req.Permission); err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to update access list", err),
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":     "ok",
+		"email":      email,
+		"permission": req.Permission,
+	})
+}
+
+// HandleCollaboratorRemove handles DELETE
+// /api/sheets/:name/collaborators/:email, taking away a collaborator's
+// access to the current user's sheet
+func (h *WebAppHandler) HandleCollaboratorRemove(c *gin.Context) {
+	store := h.handler.storageFor(c)
+	path := h.collaboratorSheet(c, store)
+	if path == nil {
+		return
+	}
+
+	if err := storage.Revoke(store, path, auth.NormalizeEmail(c.Param("email"))); err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to update access list", err),
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{"result": "ok"})
+}
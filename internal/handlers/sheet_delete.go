@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// sheetDeleteRequest is the body of POST /api/sheets/delete. IDs are sheet
+// names, optionally qualified with their owner as "owner/name".
+type sheetDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// sheetDeleteResult reports what happened to one requested sheet
+type sheetDeleteResult struct {
+	ID      string `json:"id"`
+	Result  string `json:"result"`
+	Error   string `json:"error,omitempty"`
+	TrashID string `json:"trash_id,omitempty"`
+	// OldTrashID repeats TrashID under its name before the snake_case
+	// field names, for existing clients
+	OldTrashID string `json:"trashid,omitempty"`
+}
+
+// Outcomes of deleting a single sheet
+const (
+	sheetDeleted   = "deleted"
+	sheetForbidden = "forbidden"
+	sheetNotFound  = "notfound"
+	sheetInvalid   = "invalid"
+	sheetFailed    = "error"
+)
+
+// HandleSheetsDelete handles POST /api/sheets/delete. Every ID is checked
+// before anything is deleted, so a malformed or foreign ID is reported
+// without affecting the rest of the batch; the owned sheets are then
+// moved to the trash, or deleted along with their history when the trash
+// is off.
+func (h *WebAppHandler) HandleSheetsDelete(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	var req sheetDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "expected a non-empty list of sheet ids",
+		})
+		return
+	}
+	if max := h.handler.Config.MaxBulkDelete; max > 0 && len(req.IDs) > max {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   fmt.Sprintf("too many sheets: %d requested, limit is %d", len(req.IDs), max),
+		})
+		return
+	}
+
+	store := h.handler.storageFor(c)
+	results := make([]sheetDeleteResult, len(req.IDs))
+	paths := make([][]string, len(req.IDs))
+	seen := make(map[string]bool)
+	for i, id := range req.IDs {
+		results[i] = sheetDeleteResult{ID: id}
+		fname, ok := h.ownedSheetName(user, id)
+		if !ok {
+			results[i].Result = sheetForbidden
+			continue
+		}
+		if errs := h.validateSheet(fname, ""); len(errs) > 0 {
+			results[i].Result = sheetInvalid
+			results[i].Error = errs[0].Message
+			continue
+		}
+		if seen[fname] {
+			results[i].Result = sheetInvalid
+			results[i].Error = "duplicate id"
+			continue
+		}
+		seen[fname] = true
+
+		path := []string{"home", user, fname}
+		item, err := store.GetFile(ctx, path)
+		switch {
+		case err == storage.ErrNotFound:
+			results[i].Result = sheetNotFound
+		case err != nil:
+			results[i].Result = sheetFailed
+			results[i].Error = h.handler.errorDetail("failed to read sheet", err)
+		case item.Type == "dir":
+			results[i].Result = sheetInvalid
+			results[i].Error = "not a sheet"
+		default:
+			paths[i] = path
+		}
+	}
+
+	deleted := 0
+	for i, path := range paths {
+		if path == nil {
+			continue
+		}
+		trashID, err := h.removeSheet(ctx, store, user, path[len(path)-1])
+		if err != nil {
+			results[i].Result = sheetFailed
+			results[i].Error = h.handler.errorDetail("failed to delete sheet", err)
+			continue
+		}
+		results[i].Result = sheetDeleted
+		results[i].TrashID = trashID
+		results[i].OldTrashID = trashID
+		deleted++
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"deleted": deleted,
+		"results": results,
+	})
+}
+
+// ownedSheetName resolves id to a sheet name in user's home, reporting
+// false when the id names another user's sheet
+func (h *WebAppHandler) ownedSheetName(user, id string) (string, bool) {
+	owner, fname, qualified := strings.Cut(id, "/")
+	if !qualified {
+		return id, true
+	}
+	return fname, owner == user
+}
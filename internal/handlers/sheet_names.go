@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// sheetNameKey is the form sheet names are compared in when duplicates are
+// refused: names differing only in case or spacing, such as "Budget" and
+// "budget ", are the same sheet to a user
+func sheetNameKey(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// collidingSheet returns the name of an existing sheet of owner that fname
+// would be mistaken for, or "" when there is none or duplicates are
+// allowed. fname itself isn't a collision; saving over it is an update.
+func (h *WebAppHandler) collidingSheet(store storage.Storage, owner, fname string) (string, error) {
+	if h.handler.Config.AllowDuplicateSheetNames {
+		return "", nil
+	}
+	names, err := store.List([]string{"home", owner})
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := sheetNameKey(fname)
+	for _, name := range names {
+		if name != fname && isSheetName(name) && sheetNameKey(name) == key {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// checkSheetName is collidingSheet for JSON endpoints, responding 409 and
+// returning false when fname collides with an existing sheet
+func (h *WebAppHandler) checkSheetName(c *gin.Context, store storage.Storage, owner, fname string) bool {
+	existing, err := h.collidingSheet(store, owner, fname)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to list sheets", err),
+		})
+		return false
+	}
+	if existing != "" {
+		respondJSON(c, http.StatusConflict, gin.H{
+			"result":   "fail",
+			"data":     fmt.Sprintf("a sheet named %s already exists", existing),
+			"existing": existing,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/sheet"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// sheetPatchRequest is the body of PATCH /save/:id. Hash, like an If-Match
+// header, must match the stored sheet's content hash or the patch is
+// rejected, so clients don't overwrite changes they haven't seen.
+type sheetPatchRequest struct {
+	Ops  []sheet.Op `json:"ops"`
+	Hash string     `json:"hash"`
+}
+
+// HandleSavePatch handles PATCH /save/:id, applying cell-level operations
+// to a stored sheet under a lock and recording the result as a new revision
+func (h *WebAppHandler) HandleSavePatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	// Directories such as securestore and bookkeeping entries are no sheets
+	fname := c.Param("id")
+	if !isSheetName(fname) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return
+	}
+	var req sheetPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "invalid patch body",
+		})
+		return
+	}
+	if errs := sheet.Validate(req.Ops); len(errs) > 0 {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   errs[0].Error(),
+			"errors": errs,
+		})
+		return
+	}
+
+	owner := sheetOwner(c, user)
+	store := h.handler.storageFor(c)
+	if !h.authorizeSheet(c, store, user, owner, fname, storage.PermissionEdit) {
+		return
+	}
+	path := []string{"home", owner, fname}
+	unlock := storage.LockPath(path)
+	defer unlock()
+
+	item, err := store.GetFile(ctx, path)
+	if err == storage.ErrNotFound || (err == nil && item.Type == "dir") {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return
+	}
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read sheet", err),
+		})
+		return
+	}
+
+	current := storedSheetData(item.Data)
+	expected := req.Hash
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		expected = strings.Trim(ifMatch, `"`)
+	}
+	if expected != "" && expected != contentHash(current) {
+		respondVersionConflict(c, contentHash(current))
+		return
+	}
+
+	data, err := sheet.Apply(current, req.Ops)
+	if err != nil {
+		respondJSON(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   err.Error(),
+		})
+		return
+	}
+	if errs := h.validateSheet(fname, data); len(errs) > 0 {
+		respondSheetErrors(c, errs)
+		return
+	}
+
+	dataJSON, _ := json.Marshal(map[string]interface{}{
+		"user":      owner,
+		"fname":     fname,
+		"data":      data,
+		"timestamp": time.Now().Unix(),
+	})
+	if err := store.UpdateFile(ctx, path, string(dataJSON)); err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to save file", err),
+		})
+		return
+	}
+
+	entry, _ := json.Marshal(map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+		"ops":       req.Ops,
+		"hash":      contentHash(data),
+	})
+	if err := h.handler.Changes.Record(store, path, string(entry)); err != nil {
+		fmt.Printf("DEBUG: Failed to record change log for %s: %v\n", fname, err)
+	}
+
+	response := gin.H{
+		"result": "ok",
+		"data":   "Done",
+		"hash":   contentHash(data),
+	}
+	version, err := storage.SaveRevision(ctx, store, path, string(dataJSON), h.handler.Config.MaxRevisionsPerSheet)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to record revision for %s: %v\n", fname, err)
+	} else {
+		response["version"] = version
+	}
+	h.queueThumbnail(c, path, data)
+
+	c.Header("ETag", etag(data))
+	respondJSON(c, http.StatusOK, response)
+}
+
+// storedSheetData extracts the sheet content from a file saved by /save,
+// which wraps it with metadata; anything else is taken as the sheet itself
+func storedSheetData(stored interface{}) string {
+	raw, ok := stored.(string)
+	if !ok {
+		return ""
+	}
+	var wrapped struct {
+		Data *string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(raw), &wrapped); err == nil && wrapped.Data != nil {
+		return *wrapped.Data
+	}
+	return raw
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSheetNameLength caps sheet file names
+const maxSheetNameLength = 128
+
+// sheetFieldError describes one problem with a submitted sheet
+type sheetFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validateSheet checks a sheet submitted to /save. It returns every problem
+// found, or nil when the sheet may be saved.
+func (h *WebAppHandler) validateSheet(fname, data string) []sheetFieldError {
+	var errs []sheetFieldError
+
+	switch {
+	case fname == "":
+		errs = append(errs, sheetFieldError{"fname", "missing filename"})
+	case utf8.RuneCountInString(fname) > maxSheetNameLength:
+		errs = append(errs, sheetFieldError{"fname", fmt.Sprintf("filename must be at most %d characters", maxSheetNameLength)})
+	case strings.ContainsAny(fname, `/\`) || strings.HasPrefix(fname, "."):
+		errs = append(errs, sheetFieldError{"fname", "filename must not contain path separators or start with a dot"})
+	case strings.IndexFunc(fname, unicode.IsControl) >= 0:
+		errs = append(errs, sheetFieldError{"fname", "filename must not contain control characters"})
+	case !isSheetName(fname):
+		errs = append(errs, sheetFieldError{"fname", fmt.Sprintf("%s is a reserved name", fname)})
+	}
+
+	if max := h.handler.Config.MaxSheetSize; max > 0 && len(data) > max {
+		errs = append(errs, sheetFieldError{"data", fmt.Sprintf("sheet is %d bytes, limit is %d", len(data), max)})
+	}
+	if !utf8.ValidString(data) {
+		errs = append(errs, sheetFieldError{"data", "sheet data must be valid UTF-8"})
+	}
+
+	return errs
+}
+
+// respondSheetErrors reports validation failures, keeping the first message
+// in "data" for clients that only read that field
+func respondSheetErrors(c *gin.Context, errs []sheetFieldError) {
+	respondJSON(c, http.StatusBadRequest, gin.H{
+		"result": "fail",
+		"data":   errs[0].Message,
+		"errors": errs,
+	})
+}
+
+// HandleSaveValidate handles POST /save/validate. It runs the same checks
+// as HandleSavePost without writing anything.
+func (h *WebAppHandler) HandleSaveValidate(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	fname := c.PostForm("fname")
+	if errs := h.validateSheet(fname, c.PostForm("data")); len(errs) > 0 {
+		respondSheetErrors(c, errs)
+		return
+	}
+	if !h.checkSheetName(c, h.handler.storageFor(c), user, fname) {
+		return
+	}
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   "valid",
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+// StrictTemplates parses the templates matching pattern so that executing
+// one that references a key its data doesn't provide is an error, rather
+// than rendering empty. Such a page is logged and answered with a 500, so
+// a handler and template that disagree show up during development.
+func StrictTemplates(pattern string, funcs template.FuncMap) (render.HTMLRender, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Funcs(funcs).ParseGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return strictHTML{tmpl}, nil
+}
+
+// strictHTML renders like gin's production renderer, but into a buffer so
+// nothing of a page that fails halfway reaches the client
+type strictHTML struct {
+	tmpl *template.Template
+}
+
+func (r strictHTML) Instance(name string, data any) render.Render {
+	return strictPage{tmpl: r.tmpl, name: name, data: data}
+}
+
+type strictPage struct {
+	tmpl *template.Template
+	name string
+	data any
+}
+
+func (p strictPage) Render(w http.ResponseWriter) error {
+	var buf bytes.Buffer
+	if err := p.tmpl.ExecuteTemplate(&buf, p.name, p.data); err != nil {
+		log.Printf("Template %s failed: %v", p.name, err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("template error: " + err.Error()))
+		return err
+	}
+	p.WriteContentType(w)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func (p strictPage) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/thumbnail"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// Background preview rendering: workers rendering at once, and sheets
+// that may wait before saves stop queueing previews
+const (
+	thumbnailWorkers   = 2
+	thumbnailQueueSize = 256
+)
+
+// queueThumbnail renders a preview of the sheet at path in the background,
+// once the save of data has succeeded. It does nothing when thumbnails are
+// off.
+func (h *WebAppHandler) queueThumbnail(c *gin.Context, path []string, data string) {
+	generator := h.handler.Thumbnails
+	if generator == nil {
+		return
+	}
+	tenant := c.GetString(middleware.TenantKey)
+	key := thumbnailKey(tenant, path)
+	store := h.handler.tenantStorage(tenant, nil)
+	queued := generator.Enqueue(key, data, func(image []byte) error {
+		return storage.PutThumbnail(store, path, image)
+	})
+	if !queued {
+		fmt.Printf("DEBUG: Thumbnail queue full, skipped %s\n", key)
+	}
+}
+
+// thumbnailKey identifies a sheet across tenants for the generator
+func thumbnailKey(tenant string, path []string) string {
+	return tenant + ":" + strings.Join(path, "/")
+}
+
+// HandleSheetThumbnail handles GET /api/sheets/:name/thumbnail, serving the
+// sheet's preview image. Until the preview has been rendered a placeholder
+// is served uncached; sheets saved before thumbnails were turned on get
+// theirs queued here.
+func (h *WebAppHandler) HandleSheetThumbnail(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+	generator := h.handler.Thumbnails
+	if generator == nil {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "thumbnails are disabled",
+		})
+		return
+	}
+
+	fname := c.Param("name")
+	owner := sheetOwner(c, user)
+	store := h.handler.storageFor(c)
+	if !h.authorizeSheet(c, store, user, owner, fname, storage.PermissionRead) {
+		return
+	}
+	path := []string{"home", owner, fname}
+
+	image, err := storage.GetThumbnail(store, path)
+	if err == nil {
+		tag := etag(string(image))
+		c.Header("ETag", tag)
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.handler.Config.ThumbnailMaxAge.Seconds())))
+		if c.GetHeader("If-None-Match") == tag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "image/png", image)
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read thumbnail", err),
+		})
+		return
+	}
+
+	if !generator.Pending(thumbnailKey(c.GetString(middleware.TenantKey), path)) {
+		item, err := store.GetFile(c.Request.Context(), path)
+		if errors.Is(err, storage.ErrNotFound) {
+			respondJSON(c, http.StatusNotFound, gin.H{
+				"result": "fail",
+				"data":   "file not found",
+			})
+			return
+		}
+		if err != nil {
+			respondJSON(c, http.StatusInternalServerError, gin.H{
+				"result": "fail",
+				"data":   h.handler.errorDetail("failed to read sheet", err),
+			})
+			return
+		}
+		h.queueThumbnail(c, path, storedSheetData(item.Data))
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Thumbnail-Status", "pending")
+	c.Data(http.StatusOK, "image/png", thumbnail.Placeholder(generator.Size()))
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// removeSheet deletes user's sheet fname. With a trash configured the sheet
+// is moved there and the entry ID returned; otherwise it is deleted along
+// with its history and the ID is empty.
+func (h *WebAppHandler) removeSheet(ctx context.Context, store storage.Storage, user, fname string) (string, error) {
+	path := []string{"home", user, fname}
+	unlock := storage.LockPath(path)
+	defer unlock()
+
+	if trash := h.handler.Trash; trash != nil {
+		// The access list goes into the trash with the sheet
+		entry, err := trash.Move(ctx, store, user, fname)
+		return entry.ID, err
+	}
+	if err := store.DeleteFile(ctx, path); err != nil {
+		return "", err
+	}
+	h.unshare(store, path)
+	if err := storage.DeleteHistory(ctx, store, path); err != nil {
+		fmt.Printf("DEBUG: Failed to delete history of %s: %v\n", strings.Join(path, "/"), err)
+	}
+	if err := storage.DeleteThumbnail(store, path); err != nil {
+		fmt.Printf("DEBUG: Failed to delete thumbnail of %s: %v\n", strings.Join(path, "/"), err)
+	}
+	return "", nil
+}
+
+// unshare drops the access list of a removed sheet, so a new sheet of the
+// same name starts out private
+func (h *WebAppHandler) unshare(store storage.Storage, path []string) {
+	if err := storage.DeleteACL(store, path); err != nil {
+		fmt.Printf("DEBUG: Failed to delete access list of %s: %v\n", strings.Join(path, "/"), err)
+	}
+}
+
+// trashUser returns the logged-in user for a trash endpoint, responding
+// and returning "" when there is none or the trash is off
+func (h *WebAppHandler) trashUser(c *gin.Context) string {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return ""
+	}
+	if h.handler.Trash == nil {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "trash is disabled",
+		})
+		return ""
+	}
+	return user
+}
+
+// HandleTrashList handles GET /api/trash, listing the current user's
+// deleted sheets, most recent first
+func (h *WebAppHandler) HandleTrashList(c *gin.Context) {
+	user := h.trashUser(c)
+	if user == "" {
+		return
+	}
+
+	entries, err := h.handler.Trash.List(c.Request.Context(), h.handler.storageFor(c), user)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read trash", err),
+		})
+		return
+	}
+	resp := make([]trashEntryResponse, len(entries))
+	for i, entry := range entries {
+		resp[i] = newTrashEntryResponse(entry)
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":  "ok",
+		"entries": resp,
+	})
+}
+
+// HandleTrashRestore handles POST /api/trash/:id/restore. Only the current
+// user's trash is searched, so another user's entry is simply not found.
+func (h *WebAppHandler) HandleTrashRestore(c *gin.Context) {
+	user := h.trashUser(c)
+	if user == "" {
+		return
+	}
+
+	entry, err := h.handler.Trash.Restore(c.Request.Context(), h.handler.storageFor(c), user, c.Param("id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   sheetNotFound,
+		})
+	case errors.Is(err, storage.ErrRestoreConflict):
+		respondJSON(c, http.StatusConflict, gin.H{
+			"result": "fail",
+			"data":   fmt.Sprintf("a sheet named %s already exists", entry.Name),
+		})
+	case err != nil:
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to restore sheet", err),
+		})
+	default:
+		respondJSON(c, http.StatusOK, gin.H{
+			"result": "ok",
+			"data":   newTrashEntryResponse(entry),
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// VersionInfo describes one saved version of a sheet
+type VersionInfo struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int       `json:"size"` // bytes of sheet content
+}
+
+// ListVersions returns the versions kept of email's sheet, newest first.
+// Every save records one, so the newest is the sheet as it stands; how
+// many are kept is set by MaxRevisionsPerSheet.
+func (h *WebAppHandler) ListVersions(ctx context.Context, store storage.Storage, email, sheet string) ([]VersionInfo, error) {
+	path := []string{"home", email, sheet}
+	names, err := storage.Revisions(ctx, store, path)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]VersionInfo, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		saved, ok := storage.RevisionTime(names[i])
+		if !ok {
+			continue
+		}
+		data, err := storage.GetRevision(ctx, store, path, names[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version %s: %w", names[i], err)
+		}
+		versions = append(versions, VersionInfo{
+			ID:   names[i],
+			Time: saved,
+			Size: len(storedSheetData(data)),
+		})
+	}
+	return versions, nil
+}
+
+// RestoreVersion makes version versionID of email's sheet its current
+// content. The restore is saved like any other edit, as a new version, so
+// it can itself be undone. It is storage.ErrNotFound when no such version
+// is kept.
+func (h *WebAppHandler) RestoreVersion(ctx context.Context, store storage.Storage, email, sheet, versionID string) error {
+	path := []string{"home", email, sheet}
+	unlock := storage.LockPath(path)
+	defer unlock()
+
+	names, err := storage.Revisions(ctx, store, path)
+	if err != nil {
+		return err
+	}
+	kept := false
+	for _, name := range names {
+		kept = kept || name == versionID
+	}
+	if !kept {
+		return storage.ErrNotFound
+	}
+	data, err := storage.GetRevision(ctx, store, path, versionID)
+	if err != nil {
+		return err
+	}
+
+	dataJSON, _ := json.Marshal(map[string]interface{}{
+		"user":      email,
+		"fname":     sheet,
+		"data":      storedSheetData(data),
+		"timestamp": time.Now().Unix(),
+	})
+	err = store.UpdateFile(ctx, path, string(dataJSON))
+	if errors.Is(err, storage.ErrNotFound) {
+		// The sheet was deleted since; its versions bring it back
+		err = store.CreateFile(ctx, path, string(dataJSON))
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := storage.SaveRevision(ctx, store, path, string(dataJSON), h.handler.Config.MaxRevisionsPerSheet); err != nil {
+		fmt.Printf("DEBUG: Failed to record revision for %s: %v\n", sheet, err)
+	}
+	return nil
+}
+
+// HandleVersionsList handles GET /api/sheets/:name/versions, listing the
+// saved versions of a sheet the user may read
+func (h *WebAppHandler) HandleVersionsList(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	fname := c.Param("name")
+	owner := sheetOwner(c, user)
+	store := h.handler.storageFor(c)
+	if !h.authorizeSheet(c, store, user, owner, fname, storage.PermissionRead) {
+		return
+	}
+
+	versions, err := h.ListVersions(c.Request.Context(), store, owner, fname)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to list versions", err),
+		})
+		return
+	}
+	respondJSON(c, http.StatusOK, gin.H{
+		"result":   "ok",
+		"versions": versions,
+	})
+}
+
+// HandleVersionRestore handles POST /api/sheets/:name/versions/:id/restore,
+// putting an earlier version of a sheet the user may edit back in place
+func (h *WebAppHandler) HandleVersionRestore(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := h.getCurrentUser(c)
+	if user == "" {
+		respondJSON(c, http.StatusUnauthorized, gin.H{
+			"result": "fail",
+			"data":   "usererror",
+		})
+		return
+	}
+
+	fname := c.Param("name")
+	owner := sheetOwner(c, user)
+	store := h.handler.storageFor(c)
+	if !h.authorizeSheet(c, store, user, owner, fname, storage.PermissionEdit) {
+		return
+	}
+
+	err := h.RestoreVersion(ctx, store, owner, fname, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "version not found",
+		})
+		return
+	}
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to restore version", err),
+		})
+		return
+	}
+
+	path := []string{"home", owner, fname}
+	item, err := store.GetFile(ctx, path)
+	if err != nil {
+		respondJSON(c, http.StatusInternalServerError, gin.H{
+			"result": "fail",
+			"data":   h.handler.errorDetail("failed to read sheet", err),
+		})
+		return
+	}
+	data := storedSheetData(item.Data)
+	h.queueThumbnail(c, path, data)
+
+	c.Header("ETag", etag(data))
+	respondJSON(c, http.StatusOK, gin.H{
+		"result": "ok",
+		"data":   "Done",
+		"hash":   contentHash(data),
+	})
+}
@@ -1,13 +1,19 @@
 package handlers
 
 import (
+    "context"
+    "encoding/base64"
     "encoding/json"
+    "errors"
     "fmt"
     mt "math/rand"
     "net/http"
     "strings"
     "time"
 
+    "github.com/c4gt/tornado-nginx-go-backend/internal/counters"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/models"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/storage"
     "github.com/gin-gonic/gin"
 )
 
@@ -32,7 +38,7 @@ type WebAppRequest struct {
 func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
     var req WebAppRequest
     if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "error",
             "result": "fail",
         })
@@ -42,7 +48,7 @@ func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
     // Get current user from cookie
     user := h.getCurrentUser(c)
     if user == "" {
-        c.JSON(http.StatusUnauthorized, gin.H{
+        respondJSON(c, http.StatusUnauthorized, gin.H{
             "data":   "usererror",
             "result": "fail",
         })
@@ -75,7 +81,7 @@ func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
     case "load":
         h.handleSocialCalcLoad(c, user, req)
     default:
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "invalid action: " + req.Action,
             "result": "fail",
         })
@@ -83,8 +89,9 @@ func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
 }
 
 func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
@@ -97,11 +104,11 @@ func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRe
     // dirPath := []string{"home", user, "securestore", req.AppName}
 
     // Ensure entire directory structure exists
-    err := h.ensureDirectoryStructure(user, req.AppName)
+    err := h.ensureDirectoryStructure(ctx, h.handler.storageFor(c), user, req.AppName)
     if err != nil {
         fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to create directory structure: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to create directory structure", err),
             "result": "fail",
         })
         return
@@ -120,7 +127,7 @@ func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRe
     dataJSON, err := json.Marshal(fileData)
     if err != nil {
         fmt.Printf("DEBUG: Error marshaling file data: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        respondJSON(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to encode file data",
             "result": "fail",
         })
@@ -128,28 +135,31 @@ func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRe
     }
 
     // Check if file exists
-    _, err = h.handler.Storage.GetFile(path)
+    _, err = h.handler.storageFor(c).GetFile(ctx, path)
     if err != nil {
         // File doesn't exist, create it
         fmt.Printf("DEBUG: Creating new file: %s\n", req.FName)
-        err = h.handler.Storage.CreateFile(path, string(dataJSON))
+        err = h.handler.storageFor(c).CreateFile(ctx, path, string(dataJSON))
+        if err == nil {
+            h.handler.count(counters.SheetsCreated)
+        }
     } else {
         // File exists, update it
         fmt.Printf("DEBUG: Updating existing file: %s\n", req.FName)
-        err = h.handler.Storage.UpdateFile(path, string(dataJSON))
+        err = h.handler.storageFor(c).UpdateFile(ctx, path, string(dataJSON))
     }
 
     if err != nil {
         fmt.Printf("DEBUG: Error saving file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to save file: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to save file", err),
             "result": "fail",
         })
         return
     }
 
     fmt.Printf("DEBUG: File saved successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "result": "ok",
         "storage_backend": h.handler.Config.StorageBackend,
         "timestamp": getCurrentTimestamp(),
@@ -158,7 +168,7 @@ func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRe
 
 func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
@@ -168,10 +178,10 @@ func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppReq
     fmt.Printf("DEBUG: Getting file %s for user %s in app %s\n", req.FName, user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName, req.FName}
-    item, err := h.handler.Storage.GetFile(path)
+    item, err := h.handler.storageFor(c).GetFile(c.Request.Context(), path)
     if err != nil {
         fmt.Printf("DEBUG: File not found: %s, error: %v\n", req.FName, err)
-        c.JSON(http.StatusNotFound, gin.H{
+        respondJSON(c, http.StatusNotFound, gin.H{
             "data":   "file not found: " + req.FName,
             "result": "fail",
         })
@@ -203,7 +213,7 @@ func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppReq
         dataBytes, err := json.Marshal(item.Data)
         if err != nil {
             fmt.Printf("DEBUG: Error marshaling item data: %v\n", err)
-            c.JSON(http.StatusInternalServerError, gin.H{
+            respondJSON(c, http.StatusInternalServerError, gin.H{
                 "data":   "failed to read file data",
                 "result": "fail",
             })
@@ -213,7 +223,7 @@ func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppReq
     }
 
     fmt.Printf("DEBUG: File retrieved successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "data":   fileContent,
         "result": "ok",
         "storage_backend": h.handler.Config.StorageBackend,
@@ -222,7 +232,7 @@ func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppReq
 
 func (h *WebAppHandler) handleDeleteFile(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
@@ -232,26 +242,27 @@ func (h *WebAppHandler) handleDeleteFile(c *gin.Context, user string, req WebApp
     fmt.Printf("DEBUG: Deleting file %s for user %s in app %s\n", req.FName, user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName, req.FName}
-    err := h.handler.Storage.DeleteFile(path)
+    err := h.handler.storageFor(c).DeleteFile(c.Request.Context(), path)
     if err != nil {
         fmt.Printf("DEBUG: Error deleting file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to delete file: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to delete file", err),
             "result": "fail",
         })
         return
     }
 
     fmt.Printf("DEBUG: File deleted successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "result": "ok",
         "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
 func (h *WebAppHandler) handleListDir(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     if req.AppName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing app name",
             "result": "fail",
         })
@@ -263,19 +274,19 @@ func (h *WebAppHandler) handleListDir(c *gin.Context, user string, req WebAppReq
     path := []string{"home", user, "securestore", req.AppName}
     
     // Ensure directory exists
-    item, err := h.handler.Storage.GetFile(path)
+    item, err := h.handler.storageFor(c).GetFile(ctx, path)
     if err != nil {
         // Directory doesn't exist, create it and return empty list
-        err = h.ensureDirectoryStructure(user, req.AppName)
+        err = h.ensureDirectoryStructure(ctx, h.handler.storageFor(c), user, req.AppName)
         if err != nil {
             fmt.Printf("DEBUG: Error creating directory: %v\n", err)
-            c.JSON(http.StatusInternalServerError, gin.H{
-                "data":   "failed to create directory: " + err.Error(),
+            respondJSON(c, http.StatusInternalServerError, gin.H{
+                "data":   h.handler.errorDetail("failed to create directory", err),
                 "result": "fail",
             })
             return
         }
-        c.JSON(http.StatusOK, gin.H{
+        respondJSON(c, http.StatusOK, gin.H{
             "data":   []string{},
             "result": "ok",
             "storage_backend": h.handler.Config.StorageBackend,
@@ -294,7 +305,7 @@ func (h *WebAppHandler) handleListDir(c *gin.Context, user string, req WebAppReq
     }
 
     fmt.Printf("DEBUG: Directory listing successful, found %d files\n", len(fileNames))
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "data":   fileNames,
         "result": "ok",
         "storage_backend": h.handler.Config.StorageBackend,
@@ -302,8 +313,9 @@ func (h *WebAppHandler) handleListDir(c *gin.Context, user string, req WebAppReq
 }
 
 func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     if req.AppName == "" || req.Content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or content)",
             "result": "fail",
         })
@@ -317,7 +329,7 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
     err := json.Unmarshal([]byte(req.Content), &filesData)
     if err != nil {
         fmt.Printf("DEBUG: Error parsing content JSON: %v\n", err)
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "invalid JSON content: " + err.Error(),
             "result": "fail",
         })
@@ -325,11 +337,11 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
     }
 
     // Ensure directory structure exists
-    err = h.ensureDirectoryStructure(user, req.AppName)
+    err = h.ensureDirectoryStructure(ctx, h.handler.storageFor(c), user, req.AppName)
     if err != nil {
         fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to create directory: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to create directory", err),
             "result": "fail",
         })
         return
@@ -361,19 +373,22 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
         }
 
         // Check if file exists
-        _, err = h.handler.Storage.GetFile(path)
+        _, err = h.handler.storageFor(c).GetFile(ctx, path)
         if err != nil {
             // File doesn't exist, create it
-            err = h.handler.Storage.CreateFile(path, string(contentStr))
+            err = h.handler.storageFor(c).CreateFile(ctx, path, string(contentStr))
+            if err == nil {
+                h.handler.count(counters.SheetsCreated)
+            }
         } else {
             // File exists, update it
-            err = h.handler.Storage.UpdateFile(path, string(contentStr))
+            err = h.handler.storageFor(c).UpdateFile(ctx, path, string(contentStr))
         }
 
         if err != nil {
             fmt.Printf("DEBUG: Error saving file %s: %v\n", filename, err)
-            c.JSON(http.StatusInternalServerError, gin.H{
-                "data":   "failed to save file: " + filename + " - " + err.Error(),
+            respondJSON(c, http.StatusInternalServerError, gin.H{
+                "data":   h.handler.errorDetail("failed to save file: "+filename, err),
                 "result": "fail",
             })
             return
@@ -383,7 +398,7 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
     }
 
     fmt.Printf("DEBUG: Successfully saved %d files\n", len(savedFiles))
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "result": "ok",
         "saved_files": savedFiles,
         "storage_backend": h.handler.Config.StorageBackend,
@@ -392,7 +407,7 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
 
 func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.Content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or content)",
             "result": "fail",
         })
@@ -406,7 +421,7 @@ func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppReq
     err := json.Unmarshal([]byte(req.Content), &filenames)
     if err != nil {
         fmt.Printf("DEBUG: Error parsing filenames JSON: %v\n", err)
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "invalid JSON content: " + err.Error(),
             "result": "fail",
         })
@@ -418,7 +433,7 @@ func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppReq
 
     for _, filename := range filenames {
         path := []string{"home", user, "securestore", req.AppName, filename}
-        item, err := h.handler.Storage.GetFile(path)
+        item, err := h.handler.storageFor(c).GetFile(c.Request.Context(), path)
         if err == nil && item != nil {
             // Handle both old and new format
             if dataStr, ok := item.Data.(string); ok {
@@ -444,7 +459,7 @@ func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppReq
     }
 
     fmt.Printf("DEBUG: Retrieved %d out of %d requested files\n", retrievedCount, len(filenames))
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "data":   data,
         "result": "ok",
         "retrieved_count": retrievedCount,
@@ -453,8 +468,9 @@ func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppReq
 }
 
 func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     if req.AppName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing app name",
             "result": "fail",
         })
@@ -465,9 +481,9 @@ func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequ
 
     // List all files in the app directory
     path := []string{"home", user, "securestore", req.AppName}
-    item, err := h.handler.Storage.GetFile(path)
+    item, err := h.handler.storageFor(c).GetFile(ctx, path)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{
+        respondJSON(c, http.StatusNotFound, gin.H{
             "data":   "app directory not found",
             "result": "fail",
         })
@@ -480,7 +496,7 @@ func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequ
         for _, file := range data {
             if filename, ok := file.(string); ok {
                 filePath := []string{"home", user, "securestore", req.AppName, filename}
-                fileItem, err := h.handler.Storage.GetFile(filePath)
+                fileItem, err := h.handler.storageFor(c).GetFile(ctx, filePath)
                 if err == nil && fileItem != nil {
                     backup[filename] = fileItem.Data
                 }
@@ -494,23 +510,23 @@ func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequ
     
     backupData, err := json.Marshal(backup)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        respondJSON(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to create backup data",
             "result": "fail",
         })
         return
     }
 
-    err = h.handler.Storage.CreateFile(backupPath, string(backupData))
+    err = h.handler.storageFor(c).CreateFile(ctx, backupPath, string(backupData))
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        respondJSON(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to save backup",
             "result": "fail",
         })
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "result": "ok",
         "backup_file": backupFilename,
         "storage_backend": h.handler.Config.StorageBackend,
@@ -518,8 +534,9 @@ func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequ
 }
 
 func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or backup filename)",
             "result": "fail",
         })
@@ -530,9 +547,9 @@ func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppReq
 
     // Get backup file
     backupPath := []string{"home", user, "securestore", req.AppName, req.FName}
-    backupItem, err := h.handler.Storage.GetFile(backupPath)
+    backupItem, err := h.handler.storageFor(c).GetFile(ctx, backupPath)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{
+        respondJSON(c, http.StatusNotFound, gin.H{
             "data":   "backup file not found",
             "result": "fail",
         })
@@ -544,14 +561,14 @@ func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppReq
     if dataStr, ok := backupItem.Data.(string); ok {
         err = json.Unmarshal([]byte(dataStr), &backupData)
         if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respondJSON(c, http.StatusBadRequest, gin.H{
                 "data":   "invalid backup file format",
                 "result": "fail",
             })
             return
         }
     } else {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "invalid backup file data",
             "result": "fail",
         })
@@ -564,25 +581,25 @@ func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppReq
         path := []string{"home", user, "securestore", req.AppName, filename}
         contentStr, _ := json.Marshal(content)
         
-        err = h.handler.Storage.UpdateFile(path, string(contentStr))
+        err = h.handler.storageFor(c).UpdateFile(ctx, path, string(contentStr))
         if err == nil {
             restoredCount++
         }
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "result": "ok",
         "restored_files": restoredCount,
         "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
-func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
+func (h *WebAppHandler) ensureDirectoryStructure(ctx context.Context, store storage.Storage, user, appName string) error {
     // Create home directory
     homeDir := []string{"home"}
-    _, err := h.handler.Storage.GetFile(homeDir)
+    _, err := store.GetFile(ctx, homeDir)
     if err != nil {
-        err = h.handler.Storage.CreateDir(homeDir)
+        err = store.CreateDir(ctx, homeDir)
         if err != nil {
             return fmt.Errorf("failed to create home directory: %w", err)
         }
@@ -590,9 +607,9 @@ func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
 
     // Create user directory
     userDir := []string{"home", user}
-    _, err = h.handler.Storage.GetFile(userDir)
+    _, err = store.GetFile(ctx, userDir)
     if err != nil {
-        err = h.handler.Storage.CreateDir(userDir)
+        err = store.CreateDir(ctx, userDir)
         if err != nil {
             return fmt.Errorf("failed to create user directory: %w", err)
         }
@@ -600,9 +617,9 @@ func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
 
     // Create securestore directory
     secureDir := []string{"home", user, "securestore"}
-    _, err = h.handler.Storage.GetFile(secureDir)
+    _, err = store.GetFile(ctx, secureDir)
     if err != nil {
-        err = h.handler.Storage.CreateDir(secureDir)
+        err = store.CreateDir(ctx, secureDir)
         if err != nil {
             return fmt.Errorf("failed to create securestore directory: %w", err)
         }
@@ -610,9 +627,9 @@ func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
 
     // Create app directory
     appDir := []string{"home", user, "securestore", appName}
-    _, err = h.handler.Storage.GetFile(appDir)
+    _, err = store.GetFile(ctx, appDir)
     if err != nil {
-        err = h.handler.Storage.CreateDir(appDir)
+        err = store.CreateDir(ctx, appDir)
         if err != nil {
             return fmt.Errorf("failed to create app directory: %w", err)
         }
@@ -626,28 +643,12 @@ func getCurrentTimestamp() int64 {
 }
 
 func (h *WebAppHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
-
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
-        return user
-    }
-    
-    // Plain text format
-    return userCookie
+    return h.handler.Auth.CurrentUser(c)
 }
 
 // handleSocialCalcSave handles save requests from SocialCalc spreadsheet
 func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req WebAppRequest) {
+    ctx := c.Request.Context()
     // Get additional parameters that SocialCalc sends
     filename := c.PostForm("filename")
     content := c.PostForm("content")
@@ -665,7 +666,7 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
         filename, user, sessionid)
 
     if filename == "" || content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing filename or content",
             "result": "fail",
         })
@@ -676,7 +677,7 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     if sessionid != "" {
         session, exists := h.handler.Session.Get(sessionid)
         if !exists {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respondJSON(c, http.StatusUnauthorized, gin.H{
                 "data":   "invalid session",
                 "result": "fail",
             })
@@ -686,7 +687,7 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
         // Double check user from session
         sessionUser, _ := session.GetString("user")
         if sessionUser != "" && sessionUser != user {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respondJSON(c, http.StatusUnauthorized, gin.H{
                 "data":   "session user mismatch",
                 "result": "fail",
             })
@@ -698,11 +699,11 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     appName := "touchcalc"
     
     // Ensure directory structure exists
-    err := h.ensureDirectoryStructure(user, appName)
+    err := h.ensureDirectoryStructure(ctx, h.handler.storageFor(c), user, appName)
     if err != nil {
         fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to create directory structure: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to create directory structure", err),
             "result": "fail",
         })
         return
@@ -725,7 +726,7 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     dataJSON, err := json.Marshal(fileData)
     if err != nil {
         fmt.Printf("DEBUG: Error marshaling file data: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        respondJSON(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to encode file data",
             "result": "fail",
         })
@@ -733,21 +734,24 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     }
 
     // Check if file exists and save accordingly
-    _, err = h.handler.Storage.GetFile(path)
+    _, err = h.handler.storageFor(c).GetFile(ctx, path)
     if err != nil {
         // File doesn't exist, create it
         fmt.Printf("DEBUG: Creating new SocialCalc file: %s\n", filename)
-        err = h.handler.Storage.CreateFile(path, string(dataJSON))
+        err = h.handler.storageFor(c).CreateFile(ctx, path, string(dataJSON))
+        if err == nil {
+            h.handler.count(counters.SheetsCreated)
+        }
     } else {
         // File exists, update it
         fmt.Printf("DEBUG: Updating existing SocialCalc file: %s\n", filename)
-        err = h.handler.Storage.UpdateFile(path, string(dataJSON))
+        err = h.handler.storageFor(c).UpdateFile(ctx, path, string(dataJSON))
     }
 
     if err != nil {
         fmt.Printf("DEBUG: Error saving SocialCalc file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to save file: " + err.Error(),
+        respondJSON(c, http.StatusInternalServerError, gin.H{
+            "data":   h.handler.errorDetail("failed to save file", err),
             "result": "fail",
         })
         return
@@ -756,7 +760,7 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     fmt.Printf("DEBUG: SocialCalc file saved successfully: %s\n", filename)
     
     // Return success response in format SocialCalc expects
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "message": "File saved successfully",
         "filename": filename,
         "result": "ok",
@@ -773,7 +777,7 @@ func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req We
     }
     
     if filename == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respondJSON(c, http.StatusBadRequest, gin.H{
             "data":   "missing filename",
             "result": "fail",
         })
@@ -783,10 +787,10 @@ func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req We
     appName := "touchcalc"
     path := []string{"home", user, "securestore", appName, filename + ".msc"}
     
-    item, err := h.handler.Storage.GetFile(path)
+    item, err := h.handler.storageFor(c).GetFile(c.Request.Context(), path)
     if err != nil {
         fmt.Printf("DEBUG: SocialCalc file not found: %s, error: %v\n", filename, err)
-        c.JSON(http.StatusNotFound, gin.H{
+        respondJSON(c, http.StatusNotFound, gin.H{
             "data":   "file not found: " + filename,
             "result": "fail",
         })
@@ -816,7 +820,7 @@ func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req We
     }
 
     fmt.Printf("DEBUG: SocialCalc file loaded successfully: %s\n", filename)
-    c.JSON(http.StatusOK, gin.H{
+    respondJSON(c, http.StatusOK, gin.H{
         "data":   fileContent,
         "filename": filename,
         "result": "ok",
@@ -824,15 +828,9 @@ func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req We
     })
 }
 
-func (h *WebAppHandler) HandleSave(c *gin.Context) {
-	if c.Request.Method == "GET" {
-		h.handleSaveGet(c)
-	} else {
-		h.handleSavePost(c)
-	}
-}
-
-func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
+// HandleSaveGet handles GET requests to /save
+func (h *WebAppHandler) HandleSaveGet(c *gin.Context) {
+	ctx := c.Request.Context()
 	user := h.getCurrentUser(c)
 	if user == "" {
 		c.Redirect(http.StatusFound, "/login")
@@ -843,17 +841,20 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 
 	// Get user's files from storage
 	path := []string{"home", user}
-	item, err := h.handler.Storage.GetFile(path)
+	item, err := h.handler.storageFor(c).GetFile(ctx, path)
 	var entries []map[string]interface{}
+	sheets := 0
+	firstVisit := err != nil || item == nil
 	
-	if err != nil || item == nil {
+	if firstVisit {
 		fmt.Printf("DEBUG: User directory not found, creating structure\n")
 		// Create user directory if it doesn't exist
-		err = h.handler.Storage.CreateDir(path)
+		err = h.handler.storageFor(c).CreateDir(ctx, path)
 		if err != nil {
 			fmt.Printf("DEBUG: Failed to create user directory: %v\n", err)
 		}
-		
+	}
+	if firstVisit && h.handler.Config.StarterSheet {
 		// Create default file
 		defaultPath := []string{"home", user, "default"}
 		defaultData := map[string]interface{}{
@@ -862,12 +863,12 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 			"data":  "A1:Welcome to TouchCalc\nB1:Hello " + user + "\nA2:Start editing here\nB2:Your data auto-saves\n\n",
 		}
 		dataJSON, _ := json.Marshal(defaultData)
-		h.handler.Storage.CreateFile(defaultPath, string(dataJSON))
+		h.handler.storageFor(c).CreateFile(ctx, defaultPath, string(dataJSON))
 		
 		entries = []map[string]interface{}{
 			{"fname": "default"},
 		}
-	} else {
+	} else if !firstVisit {
 		// Extract file names from directory
 		if data, ok := item.Data.([]interface{}); ok {
 			for _, file := range data {
@@ -875,6 +876,9 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 					entries = append(entries, map[string]interface{}{
 						"fname": str,
 					})
+					if isSheetName(str) {
+						sheets++
+					}
 				}
 			}
 		}
@@ -882,16 +886,31 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 
 	fmt.Printf("DEBUG: Found %d files for user %s\n", len(entries), user)
 
+	// A user who had no sheets on arrival gets the getting-started flow,
+	// even when a starter sheet was just created for them
 	c.HTML(http.StatusOK, "allusersheets.html", gin.H{
-		"entries": entries,
-		"user":    user,
+		"entries":    entries,
+		"user":       user,
+		"onboarding": sheets == 0,
 	})
 }
 
-func (h *WebAppHandler) handleSavePost(c *gin.Context) {
+// isSheetName reports whether a home directory entry is a sheet rather
+// than app storage or hidden bookkeeping such as revisions and the trash
+func isSheetName(name string) bool {
+	return name != "" && name != "securestore" && !strings.HasPrefix(name, ".")
+}
+
+// HandleSavePost handles POST requests to /save. A hash form field, or an
+// If-Match header, carrying the content hash the client last loaded or
+// saved makes the save conditional: if the sheet has changed since,
+// whether before or during this request, it is refused with 409 instead
+// of overwriting the other change.
+func (h *WebAppHandler) HandleSavePost(c *gin.Context) {
+	ctx := c.Request.Context()
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		respondJSON(c, http.StatusUnauthorized, gin.H{
 			"result": "fail",
 			"data":   "usererror",
 		})
@@ -900,22 +919,29 @@ func (h *WebAppHandler) handleSavePost(c *gin.Context) {
 
 	fname := c.PostForm("fname")
 	data := c.PostForm("data")
+	expected := c.PostForm("hash")
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		expected = strings.Trim(ifMatch, `"`)
+	}
 	
 	fmt.Printf("DEBUG: Saving file %s for user %s\n", fname, user)
 	
-	if fname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"result": "fail",
-			"data":   "missing filename",
-		})
+	if errs := h.validateSheet(fname, data); len(errs) > 0 {
+		respondSheetErrors(c, errs)
 		return
 	}
 
-	path := []string{"home", user, fname}
+	// Collaborators with edit access save to the owner's copy, which must
+	// already exist
+	owner := sheetOwner(c, user)
+	if !h.authorizeSheet(c, h.handler.storageFor(c), user, owner, fname, storage.PermissionEdit) {
+		return
+	}
+	path := []string{"home", owner, fname}
 	
 	// Create file data with metadata
 	fileData := map[string]interface{}{
-		"user":     user,
+		"user":     owner,
 		"fname":    fname,
 		"data":     data,
 		"timestamp": time.Now().Unix(),
@@ -923,33 +949,76 @@ func (h *WebAppHandler) handleSavePost(c *gin.Context) {
 	dataJSON, _ := json.Marshal(fileData)
 	
 	// Check if file exists
-	_, err := h.handler.Storage.GetFile(path)
+	item, fileVersion, err := storage.GetFileVersion(ctx, h.handler.storageFor(c), path)
+	if err != nil && owner != user {
+		respondJSON(c, http.StatusNotFound, gin.H{
+			"result": "fail",
+			"data":   "file not found",
+		})
+		return
+	}
 	if err != nil {
+		if !h.checkSheetName(c, h.handler.storageFor(c), owner, fname) {
+			return
+		}
 		// Create new file
-		err = h.handler.Storage.CreateFile(path, string(dataJSON))
+		err = h.handler.storageFor(c).CreateFile(ctx, path, string(dataJSON))
+		if err == nil {
+			h.handler.count(counters.SheetsCreated)
+		}
+	} else if expected != "" {
+		if current := contentHash(storedSheetData(item.Data)); current != expected {
+			respondVersionConflict(c, current)
+			return
+		}
+		// Conditional on the version read with the content, so a save
+		// landing in between, on any instance, fails this one
+		_, err = storage.UpdateFileCAS(ctx, h.handler.storageFor(c), path, fileVersion, string(dataJSON))
+		if errors.Is(err, storage.ErrVersionConflict) {
+			current := ""
+			if item, err := h.handler.storageFor(c).GetFile(ctx, path); err == nil {
+				current = contentHash(storedSheetData(item.Data))
+			}
+			respondVersionConflict(c, current)
+			return
+		}
 	} else {
 		// Update existing file
-		err = h.handler.Storage.UpdateFile(path, string(dataJSON))
+		err = h.handler.storageFor(c).UpdateFile(ctx, path, string(dataJSON))
 	}
 
 	if err != nil {
 		fmt.Printf("DEBUG: Error saving file: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		respondJSON(c, http.StatusInternalServerError, gin.H{
 			"result": "fail",
 			"data":   "failed to save file",
 		})
 		return
 	}
 
-	fmt.Printf("DEBUG: File %s saved successfully\n", fname)
-	c.JSON(http.StatusOK, gin.H{
+	// Revision history is best effort; the save itself already succeeded
+	response := gin.H{
 		"result": "ok",
 		"data":   "Done",
-	})
+		"hash":   contentHash(data),
+	}
+	version, err := storage.SaveRevision(ctx, h.handler.storageFor(c), path, string(dataJSON), h.handler.Config.MaxRevisionsPerSheet)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to record revision for %s: %v\n", fname, err)
+	} else {
+		response["version"] = version
+	}
+
+	h.queueThumbnail(c, path, data)
+
+	fmt.Printf("DEBUG: File %s saved successfully\n", fname)
+	c.Header("ETag", etag(data))
+	respondJSON(c, http.StatusOK, response)
 }
 
 // HandleUserSheet handles the /usersheet endpoint
 func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
+	ctx := c.Request.Context()
 	user := h.getCurrentUser(c)
 	if user == "" {
 		c.Redirect(http.StatusFound, "/login")
@@ -966,12 +1035,24 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 		return
 	}
 
-	path := []string{"home", user, fname}
+	// Only the owner may delete; collaborators may open the sheet when
+	// its access list lets them read it
+	owner := sheetOwner(c, user)
+	if deleteFlag == "yes" && owner != user {
+		c.Redirect(http.StatusFound, "/save")
+		return
+	}
+	if allowed, err := h.sheetAllowed(h.handler.storageFor(c), user, owner, fname, storage.PermissionRead); !allowed {
+		fmt.Printf("DEBUG: %s may not open %s/%s: %v\n", user, owner, fname, err)
+		c.Redirect(http.StatusFound, "/save")
+		return
+	}
+	path := []string{"home", owner, fname}
 
 	// Handle delete operation
 	if deleteFlag == "yes" {
 		fmt.Printf("DEBUG: Deleting file %s for user %s\n", fname, user)
-		err := h.handler.Storage.DeleteFile(path)
+		_, err := h.removeSheet(ctx, h.handler.storageFor(c), user, fname)
 		if err != nil {
 			fmt.Printf("DEBUG: Failed to delete file: %v\n", err)
 		}
@@ -980,7 +1061,7 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 	}
 
 	// Get file for editing
-	item, err := h.handler.Storage.GetFile(path)
+	item, err := h.handler.storageFor(c).GetFile(ctx, path)
 	if err != nil {
 		fmt.Printf("DEBUG: File %s not found for user %s\n", fname, user)
 		c.Redirect(http.StatusFound, "/save")
@@ -1020,6 +1101,7 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 	
 	entry := map[string]interface{}{
 		"fname":        fname,
+		"owner":        owner,
 		"sheetstr":     content,
 		"sheetmscestr": "",
 		"session":      sessionID,
@@ -1059,6 +1141,13 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 	fmt.Printf("DEBUG: Import POST request - session: %s, user: %s\n", session, user)
 	
 	file, err := c.FormFile("upload")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.HTML(http.StatusRequestEntityTooLarge, "importerror.html", gin.H{
+			"error": fmt.Sprintf("File too large, limit is %d bytes", tooLarge.Limit),
+		})
+		return
+	}
 	if err != nil {
 		fmt.Printf("DEBUG: No file uploaded: %v\n", err)
 		c.HTML(http.StatusBadRequest, "importerror.html", gin.H{
@@ -1085,14 +1174,22 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 	content := make([]byte, file.Size)
 	src.Read(content)
 	
+	// Files of unknown type are rejected or kept as opaque binary,
+	// depending on IMPORT_UNKNOWN_TYPES
+	kind := classifyImport(fname, content)
+	if kind == "" {
+		if h.handler.Config.ImportUnknownTypes != ImportUnknownBinary {
+			c.HTML(http.StatusUnsupportedMediaType, "importerror.html", gin.H{
+				"error":      "Unsupported file type",
+				"importtype": "rejected",
+			})
+			return
+		}
+		kind = importBinary
+	}
+
 	var wbook string
-	
-	// Handle different file types
-	if strings.HasSuffix(strings.ToLower(fname), ".msc") || strings.HasSuffix(strings.ToLower(fname), ".msce") {
-		wbook = string(content)
-	} else {
-		// For other file types, treat as plain text for now
-		// In a real implementation, you'd convert Excel/CSV files here
+	if kind != importBinary {
 		wbook = string(content)
 	}
 
@@ -1112,8 +1209,17 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 			"imported":  true,
 			"timestamp": time.Now().Unix(),
 		}
+		if kind == importBinary {
+			// Stored as-is; base64 keeps bytes that aren't valid UTF-8
+			// intact through JSON
+			fileData["data"] = base64.StdEncoding.EncodeToString(content)
+			fileData["encoding"] = "base64"
+			fileData["contenttype"] = http.DetectContentType(content)
+		}
 		dataJSON, _ := json.Marshal(fileData)
-		h.handler.Storage.CreateFile(path, string(dataJSON))
+		if h.handler.storageFor(c).CreateFile(c.Request.Context(), path, string(dataJSON)) == nil {
+			h.handler.count(counters.SheetsCreated)
+		}
 		
 		fmt.Printf("DEBUG: Imported file saved as %s for user %s\n", baseName, user)
 	}
@@ -1121,11 +1227,13 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 	c.HTML(http.StatusOK, "importcollabload.html", gin.H{
 		"entry": map[string]interface{}{
 			"fname":        fname,
+			"owner":        user,
 			"sheetmscestr": wbook,
 			"sheetstr":     wbook,
 			"session":      session,
 		},
-		"user": user,
+		"user":       user,
+		"importtype": kind,
 	})
 }
 
@@ -1133,7 +1241,7 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 func (h *WebAppHandler) HandleDownloadFile(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		respondJSON(c, http.StatusUnauthorized, gin.H{
 			"result": "fail",
 			"data":   "usererror",
 		})
@@ -1146,45 +1254,29 @@ func (h *WebAppHandler) HandleDownloadFile(c *gin.Context) {
 	fmt.Printf("DEBUG: Download request - user: %s, file: %s, format: %s\n", user, fname, format)
 	
 	if fname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		respondJSON(c, http.StatusBadRequest, gin.H{
 			"result": "fail",
 			"data":   "missing filename",
 		})
 		return
 	}
 
-	path := []string{"home", user, fname}
-	item, err := h.handler.Storage.GetFile(path)
+	owner := sheetOwner(c, user)
+	if !h.authorizeSheet(c, h.handler.storageFor(c), user, owner, fname, storage.PermissionRead) {
+		return
+	}
+	path := []string{"home", owner, fname}
+	item, err := h.handler.storageFor(c).GetFile(c.Request.Context(), path)
 	if err != nil {
 		fmt.Printf("DEBUG: File not found for download: %s\n", fname)
-		c.JSON(http.StatusNotFound, gin.H{
+		respondJSON(c, http.StatusNotFound, gin.H{
 			"result": "fail",
 			"data":   "file not found",
 		})
 		return
 	}
 
-	// Extract content
-	var content string
-	if dataStr, ok := item.Data.(string); ok {
-		var fileData map[string]interface{}
-		if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-			if dataField, exists := fileData["data"]; exists {
-				if dataFieldStr, ok := dataField.(string); ok {
-					content = dataFieldStr
-				} else {
-					content = dataStr
-				}
-			} else {
-				content = dataStr
-			}
-		} else {
-			content = dataStr
-		}
-	} else {
-		dataBytes, _ := json.Marshal(item.Data)
-		content = string(dataBytes)
-	}
+	content := downloadContent(item)
 
 	// Set appropriate headers based on format
 	switch format {
@@ -1202,7 +1294,24 @@ func (h *WebAppHandler) HandleDownloadFile(c *gin.Context) {
 		c.Header("Content-Disposition", "attachment; filename="+fname)
 	}
 
-	c.String(http.StatusOK, content)
+	h.sendDownload(c, path, content)
+}
+
+// downloadContent extracts what a download of item sends: its data, or
+// the data wrapped inside it by older saves
+func downloadContent(item *models.StorageItem) string {
+	dataStr, ok := item.Data.(string)
+	if !ok {
+		dataBytes, _ := json.Marshal(item.Data)
+		return string(dataBytes)
+	}
+	var fileData map[string]interface{}
+	if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
+		if dataFieldStr, ok := fileData["data"].(string); ok {
+			return dataFieldStr
+		}
+	}
+	return dataStr
 }
 
 // HandleHTMLToPDFGet handles GET requests to /htmltopdf
@@ -1217,7 +1326,7 @@ func (h *WebAppHandler) HandleHTMLToPDFGet(c *gin.Context) {
 func (h *WebAppHandler) HandleHTMLToPDFPost(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		respondJSON(c, http.StatusUnauthorized, gin.H{
 			"result": "fail",
 			"data":   "usererror",
 		})
@@ -1230,7 +1339,7 @@ func (h *WebAppHandler) HandleHTMLToPDFPost(c *gin.Context) {
 	fmt.Printf("DEBUG: PDF conversion request - user: %s, filename: %s\n", user, filename)
 	
 	if htmlContent == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		respondJSON(c, http.StatusBadRequest, gin.H{
 			"result": "fail",
 			"data":   "missing HTML content",
 		})
@@ -1241,7 +1350,22 @@ func (h *WebAppHandler) HandleHTMLToPDFPost(c *gin.Context) {
 		filename = "document"
 	}
 
-	// Placeholder for PDF generation - implement with wkhtmltopdf or similar
+	if h.handler.PDF != nil {
+		out, err := h.handler.PDF.Render(c.Request.Context(), htmlContent)
+		if err != nil {
+			respondJSON(c, http.StatusInternalServerError, gin.H{
+				"result": "fail",
+				"data":   h.handler.errorDetail("PDF conversion failed", err),
+			})
+			return
+		}
+		h.handler.count(counters.PDFsGenerated)
+		c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
+		c.Data(http.StatusOK, "application/pdf", out)
+		return
+	}
+
+	// Placeholder for PDF generation when no engine is configured
 	c.Header("Content-Type", "application/pdf")
 	c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
 	c.String(http.StatusOK, "PDF conversion feature coming soon. HTML content length: %d", len(htmlContent))
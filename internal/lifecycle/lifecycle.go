@@ -0,0 +1,62 @@
+// Package lifecycle runs the shutdown hooks of long-lived components in
+// the reverse of the order they were started.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Hook releases a component's resources, giving up when ctx is done
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// Registry collects shutdown hooks. Register components as they start so
+// that Shutdown stops dependents before what they depend on.
+type Registry struct {
+	mu    sync.Mutex
+	hooks []namedHook
+	done  bool
+}
+
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds the shutdown hook for the component name
+func (r *Registry) Register(name string, fn Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, namedHook{name: name, fn: fn})
+}
+
+// Shutdown runs every hook, last registered first, sharing ctx's deadline.
+// A failing hook is logged and the rest still run; the failures are
+// returned together. Later calls do nothing.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return nil
+	}
+	r.done = true
+	hooks := r.hooks
+	r.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if err := hook.fn(ctx); err != nil {
+			log.Printf("Shutdown of %s failed: %v", hook.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownRunsHooksLastFirst(t *testing.T) {
+	r := New()
+	var order []string
+	for _, name := range []string{"storage", "workers", "server"} {
+		name := name
+		r.Register(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if want := []string{"server", "workers", "storage"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("hooks ran in order %v, want %v", order, want)
+	}
+
+	// A second shutdown is a no-op
+	r.Shutdown(context.Background())
+	if len(order) != 3 {
+		t.Errorf("hooks ran again on a second Shutdown: %v", order)
+	}
+}
+
+func TestFailingHookDoesNotStopOthers(t *testing.T) {
+	r := New()
+	var ran []string
+	r.Register("storage", func(ctx context.Context) error {
+		ran = append(ran, "storage")
+		return nil
+	})
+	r.Register("metrics", func(ctx context.Context) error {
+		ran = append(ran, "metrics")
+		return errors.New("flush failed")
+	})
+	r.Register("server", func(ctx context.Context) error {
+		ran = append(ran, "server")
+		return nil
+	})
+
+	err := r.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "metrics: flush failed") {
+		t.Errorf("Shutdown = %v, want the metrics failure", err)
+	}
+	if want := []string{"server", "metrics", "storage"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("hooks ran %v, want %v", ran, want)
+	}
+}
+
+func TestHooksShareTheDeadline(t *testing.T) {
+	r := New()
+	r.Register("fast", func(ctx context.Context) error { return ctx.Err() })
+	r.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := r.Shutdown(ctx)
+
+	// Once the slow hook uses up the deadline, the next sees it expired
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "fast") {
+		t.Errorf("Shutdown = %v, want both hooks past the deadline", err)
+	}
+}
@@ -0,0 +1,39 @@
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// DrainServer returns the shutdown hook for server: it stops accepting
+// connections, waits for in-flight requests to finish and logs how many
+// connections it drained, or how many were still open when ctx ran out.
+// Call it before the server starts serving so every connection is counted.
+func DrainServer(server *http.Server) Hook {
+	var open atomic.Int64
+	track := server.ConnState
+	server.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateHijacked, http.StateClosed:
+			open.Add(-1)
+		}
+		if track != nil {
+			track(conn, state)
+		}
+	}
+
+	return func(ctx context.Context) error {
+		draining := open.Load()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server: %d of %d connections still open", open.Load(), draining)
+			return err
+		}
+		log.Printf("HTTP server: drained %d connections", draining)
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// slowServer serves /slow, which blocks until release is closed, on an
+// ephemeral port
+func slowServer(t *testing.T) (addr string, drain Hook, entered, release chan struct{}) {
+	entered = make(chan struct{})
+	release = make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		io.WriteString(w, "saved")
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := &http.Server{Handler: mux}
+	drain = DrainServer(server)
+	go server.Serve(ln)
+	return ln.Addr().String(), drain, entered, release
+}
+
+type result struct {
+	body string
+	err  error
+}
+
+func get(url string) result {
+	resp, err := http.Get(url)
+	if err != nil {
+		return result{err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return result{body: string(body), err: err}
+}
+
+// waitRefused waits for the listener to close, failing if it doesn't
+func waitRefused(t *testing.T, addr string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return
+		}
+		conn.Close()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server still accepting connections after shutdown began")
+}
+
+func TestDrainServerFinishesInFlightRequests(t *testing.T) {
+	addr, drain, entered, release := slowServer(t)
+
+	inFlight := make(chan result, 1)
+	go func() { inFlight <- get("http://" + addr + "/slow") }()
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- drain(context.Background()) }()
+
+	// New requests are refused while the slow one is still running
+	waitRefused(t, addr)
+	if r := get("http://" + addr + "/fast"); r.err == nil {
+		t.Error("a request after shutdown began was served")
+	}
+
+	close(release)
+	if r := <-inFlight; r.err != nil || r.body != "saved" {
+		t.Errorf("in-flight request = %q, %v; want it to complete", r.body, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+}
+
+func TestDrainServerTimesOut(t *testing.T) {
+	addr, drain, entered, release := slowServer(t)
+	defer close(release)
+
+	go get("http://" + addr + "/slow")
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown with a stuck request = %v, want DeadlineExceeded", err)
+	}
+}
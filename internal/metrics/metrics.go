@@ -0,0 +1,414 @@
+// Package metrics keeps process-wide counters and exposes them in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Collector is anything that can write its samples in the Prometheus text
+// exposition format
+type Collector interface {
+	Write(w io.Writer) error
+}
+
+// CounterVec is a set of counters sharing a name, split by one label.
+// Label values should come from a small fixed set; never use per-user
+// values such as emails, they make the series count unbounded.
+type CounterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.RWMutex
+	values map[string]*uint64
+}
+
+// NewCounterVec creates a counter split by label. The given label values
+// are exported at zero from the start so dashboards see every series.
+func NewCounterVec(name, help, label string, values ...string) *CounterVec {
+	v := &CounterVec{name: name, help: help, label: label, values: make(map[string]*uint64)}
+	for _, value := range values {
+		v.values[value] = new(uint64)
+	}
+	return v
+}
+
+// Inc adds one to the counter for value
+func (v *CounterVec) Inc(value string) {
+	v.mu.RLock()
+	n, ok := v.values[value]
+	v.mu.RUnlock()
+	if !ok {
+		v.mu.Lock()
+		if n, ok = v.values[value]; !ok {
+			n = new(uint64)
+			v.values[value] = n
+		}
+		v.mu.Unlock()
+	}
+	atomic.AddUint64(n, 1)
+}
+
+// Value returns the current count for value
+func (v *CounterVec) Value(value string) uint64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if n, ok := v.values[value]; ok {
+		return atomic.LoadUint64(n)
+	}
+	return 0
+}
+
+// Write writes the counter family, one sample per label value
+func (v *CounterVec) Write(w io.Writer) error {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s{%s=%q} %d\n", v.name, v.label, key, v.Value(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SummaryVec tracks the count and total of observed values, such as
+// durations in seconds, split by one label
+type SummaryVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.Mutex
+	counts map[string]uint64
+	sums   map[string]float64
+}
+
+// NewSummaryVec creates a summary split by label
+func NewSummaryVec(name, help, label string) *SummaryVec {
+	return &SummaryVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		counts: make(map[string]uint64),
+		sums:   make(map[string]float64),
+	}
+}
+
+// Observe records one value for the label value
+func (v *SummaryVec) Observe(value string, x float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.counts[value]++
+	v.sums[value] += x
+}
+
+// Count returns how many values were observed for value
+func (v *SummaryVec) Count(value string) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.counts[value]
+}
+
+// Write writes the _sum and _count series for every label value
+func (v *SummaryVec) Write(w io.Writer) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.counts))
+	for key := range v.counts {
+		keys = append(keys, key)
+	}
+	counts := make(map[string]uint64, len(keys))
+	sums := make(map[string]float64, len(keys))
+	for _, key := range keys {
+		counts[key], sums[key] = v.counts[key], v.sums[key]
+	}
+	v.mu.Unlock()
+	sort.Strings(keys)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s summary\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s_sum{%s=%q} %g\n%s_count{%s=%q} %d\n",
+			v.name, v.label, key, sums[key], v.name, v.label, key, counts[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a single value that goes up and down, such as open connections
+type Gauge struct {
+	name  string
+	help  string
+	value int64
+}
+
+// NewGauge creates a gauge starting at zero
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+// Add adds delta, which may be negative, to the gauge
+func (g *Gauge) Add(delta int64) {
+	atomic.AddInt64(&g.value, delta)
+}
+
+// Value returns the gauge's current value
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// Write writes the gauge's one sample
+func (g *Gauge) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.Value())
+	return err
+}
+
+// labelKeySep joins label values into map keys; it can't appear in
+// valid UTF-8 so distinct value lists never collide
+const labelKeySep = "\xff"
+
+// formatLabels renders names and values as a Prometheus label set, with
+// any extra name, value pairs after them
+func formatLabels(names, values []string, extra ...string) string {
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelValues pads or trims values to one per label name
+func labelValues(names, values []string) []string {
+	out := make([]string, len(names))
+	copy(out, values)
+	return out
+}
+
+// MultiCounterVec is a CounterVec split by several labels, such as
+// method, route and status. The same advice on label values applies.
+type MultiCounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	values map[string]*uint64
+}
+
+// NewMultiCounterVec creates a counter split by labels
+func NewMultiCounterVec(name, help string, labels ...string) *MultiCounterVec {
+	return &MultiCounterVec{name: name, help: help, labels: labels, values: make(map[string]*uint64)}
+}
+
+// Inc adds one to the counter for the label values, given in label order
+func (v *MultiCounterVec) Inc(values ...string) {
+	key := strings.Join(labelValues(v.labels, values), labelKeySep)
+	v.mu.RLock()
+	n, ok := v.values[key]
+	v.mu.RUnlock()
+	if !ok {
+		v.mu.Lock()
+		if n, ok = v.values[key]; !ok {
+			n = new(uint64)
+			v.values[key] = n
+		}
+		v.mu.Unlock()
+	}
+	atomic.AddUint64(n, 1)
+}
+
+// Value returns the current count for the label values
+func (v *MultiCounterVec) Value(values ...string) uint64 {
+	key := strings.Join(labelValues(v.labels, values), labelKeySep)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if n, ok := v.values[key]; ok {
+		return atomic.LoadUint64(n)
+	}
+	return 0
+}
+
+// Write writes the counter family, one sample per set of label values
+func (v *MultiCounterVec) Write(w io.Writer) error {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.values))
+	counts := make(map[string]uint64, len(v.values))
+	for key, n := range v.values {
+		keys = append(keys, key)
+		counts[key] = atomic.LoadUint64(n)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		labels := formatLabels(v.labels, strings.Split(key, labelKeySep))
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", v.name, labels, counts[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultBuckets are histogram upper bounds, in seconds, suited to HTTP
+// request latencies
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramVec counts observed values, such as durations in seconds, into
+// cumulative buckets, split by several labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewHistogramVec creates a histogram with the given bucket upper bounds,
+// which must be sorted, split by labels
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+}
+
+// Observe records x for the label values, given in label order
+func (v *HistogramVec) Observe(x float64, values ...string) {
+	key := strings.Join(labelValues(v.labels, values), labelKeySep)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.series[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(v.buckets))}
+		v.series[key] = h
+	}
+	for i, bound := range v.buckets {
+		if x <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += x
+}
+
+// Count returns how many values were observed for the label values
+func (v *HistogramVec) Count(values ...string) uint64 {
+	key := strings.Join(labelValues(v.labels, values), labelKeySep)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok := v.series[key]; ok {
+		return h.count
+	}
+	return 0
+}
+
+// Write writes the _bucket, _sum and _count series for every set of label
+// values
+func (v *HistogramVec) Write(w io.Writer) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	series := make(map[string]histogram, len(v.series))
+	for key, h := range v.series {
+		keys = append(keys, key)
+		series[key] = histogram{buckets: append([]uint64{}, h.buckets...), count: h.count, sum: h.sum}
+	}
+	v.mu.Unlock()
+	sort.Strings(keys)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		values := strings.Split(key, labelKeySep)
+		h := series[key]
+		for i, bound := range v.buckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, values, "le", le), h.buckets[i]); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(v.labels, values)
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %g\n%s_count%s %d\n",
+			v.name, formatLabels(v.labels, values, "le", "+Inf"), h.count,
+			v.name, labels, h.sum, v.name, labels, h.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registry is an ordered set of collectors served together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry served at /metrics
+var Default = NewRegistry()
+
+// Register adds c to the registry
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every registered collector in registration order
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the registry in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
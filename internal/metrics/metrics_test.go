@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVecExposition(t *testing.T) {
+	logins := NewCounterVec("logins_total", "Logins by outcome.", "outcome", "success", "failure")
+	logins.Inc("failure")
+	logins.Inc("failure")
+	logins.Inc("other")
+
+	registry := NewRegistry()
+	registry.Register(logins)
+
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := strings.Join([]string{
+		"# HELP logins_total Logins by outcome.",
+		"# TYPE logins_total counter",
+		`logins_total{outcome="failure"} 2`,
+		`logins_total{outcome="other"} 1`,
+		`logins_total{outcome="success"} 0`,
+		"",
+	}, "\n")
+	if got := w.Body.String(); got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestSummaryVecExposition(t *testing.T) {
+	ops := NewSummaryVec("op_seconds", "Time per op.", "op")
+	ops.Observe("get", 0.5)
+	ops.Observe("get", 0.25)
+
+	var b strings.Builder
+	if err := ops.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := "# HELP op_seconds Time per op.\n# TYPE op_seconds summary\n" +
+		"op_seconds_sum{op=\"get\"} 0.75\nop_seconds_count{op=\"get\"} 2\n"
+	if b.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestGaugeExposition(t *testing.T) {
+	open := NewGauge("open_connections", "Open connections.")
+	open.Add(3)
+	open.Add(-1)
+
+	var b strings.Builder
+	if err := open.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := "# HELP open_connections Open connections.\n# TYPE open_connections gauge\nopen_connections 2\n"
+	if b.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestMultiCounterVecExposition(t *testing.T) {
+	requests := NewMultiCounterVec("requests_total", "Requests.", "method", "status")
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Inc("POST", "500")
+
+	if got := requests.Value("GET", "200"); got != 2 {
+		t.Errorf("Value(GET, 200) = %d, want 2", got)
+	}
+	var b strings.Builder
+	if err := requests.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := "# HELP requests_total Requests.\n# TYPE requests_total counter\n" +
+		"requests_total{method=\"GET\",status=\"200\"} 2\nrequests_total{method=\"POST\",status=\"500\"} 1\n"
+	if b.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVecExposition(t *testing.T) {
+	latency := NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	var b strings.Builder
+	if err := latency.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"# HELP latency_seconds Latency.",
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{route="/a",le="0.1"} 1`,
+		`latency_seconds_bucket{route="/a",le="1"} 2`,
+		`latency_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`latency_seconds_sum{route="/a"} 3.55`,
+		`latency_seconds_count{route="/a"} 3`,
+		"",
+	}, "\n")
+	if b.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", b.String(), want)
+	}
+}
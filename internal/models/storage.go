@@ -21,6 +21,11 @@ type StorageItem struct {
 	Path []string    `json:"path"`
 	Type string      `json:"type"` // "file" or "dir"
 	Data interface{} `json:"data"`
+
+	// ContentType of a file's data; empty for items written as plain
+	// strings. Encoding is "base64" when Data holds encoded binary content.
+	ContentType string `json:"contenttype,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
 }
 
 func NewFile(name string, data interface{}) *File {
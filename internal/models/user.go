@@ -2,6 +2,8 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -14,10 +16,105 @@ type User struct {
 	LastLogin   time.Time `json:"lastlogin"`
 	CreatedOn   time.Time `json:"createdon"`
 	Dongle      string    `json:"dongle"`
+
+	// When an unconfirmed account's confirmation link runs out, after
+	// which the account may be purged
+	ConfirmBy time.Time `json:"confirmby,omitempty"`
+
+	// Login activity, used to spot sign-ins from unfamiliar addresses
+	LastLoginIP    string   `json:"lastloginip,omitempty"`
+	KnownIPs       []string `json:"knownips,omitempty"`
+	LoginAlertsOff bool     `json:"loginalertsoff,omitempty"`
+
+	// TOTP second factor; the secret is stored encrypted and recovery codes hashed
+	TOTPSecret    string   `json:"totpsecret,omitempty"`
+	TOTPEnabled   bool     `json:"totpenabled,omitempty"`
+	RecoveryCodes []string `json:"recoverycodes,omitempty"`
+	// Time step of the last TOTP code accepted at login, refused thereafter
+	TOTPLastStep int64 `json:"totplaststep,omitempty"`
+
+	// Hashes of the passwords before the current one, oldest first, which
+	// SetPassword won't accept again
+	PasswordHistory []string `json:"passwordhistory,omitempty"`
+
+	// Bumped to invalidate every session issued before a password change
+	TokenVersion int `json:"tokenversion,omitempty"`
+
+	// Consecutive wrong passwords, and when the lockout they caused ends
+	FailedAttempts int       `json:"failedattempts,omitempty"`
+	LockedUntil    time.Time `json:"lockeduntil,omitempty"`
+
+	// API keys for programmatic access; only hashes are stored
+	APIKeys []APIKey `json:"apikeys,omitempty"`
+
+	// Features the user may use, e.g. pdf_export. Nil means the configured
+	// defaults; an empty list grants nothing.
+	Entitlements []string `json:"entitlements"`
+}
+
+// APIKey is a stored API key. The key itself is shown once when issued.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdat"`
+}
+
+// ErrCompromisedPassword is returned when a password is on the configured
+// denylist of known-breached passwords
+var ErrCompromisedPassword = errors.New("password has appeared in a data breach, please choose another")
+
+// ErrPasswordReused is returned by SetPassword for a password still in the
+// user's PasswordHistory
+var ErrPasswordReused = errors.New("password was used recently, please choose another")
+
+// DefaultPasswordHistory is how many recent passwords are remembered
+// unless configured otherwise
+const DefaultPasswordHistory = 5
+
+// PasswordDenylist reports whether a password is known to be compromised
+type PasswordDenylist interface {
+	Contains(password string) bool
+}
+
+var passwordDenylist PasswordDenylist
+
+// SetPasswordDenylist makes NewUser and SetPassword reject passwords on d;
+// nil turns the check off
+func SetPasswordDenylist(d PasswordDenylist) {
+	passwordDenylist = d
+}
+
+// MaxPasswordBytes is the longest password bcrypt can hash, in bytes
+const MaxPasswordBytes = 72
+
+// passwordHashCost is the bcrypt cost new password hashes are made with.
+// Existing hashes keep the cost they were made with.
+var passwordHashCost = bcrypt.DefaultCost
+
+// SetPasswordHashCost sets the bcrypt cost NewUser and SetPassword hash
+// with, which must lie within bcrypt's MinCost and MaxCost. Each step
+// doubles the work, for both attackers and every login.
+func SetPasswordHashCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost %d out of range %d-%d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	passwordHashCost = cost
+	return nil
+}
+
+func checkPassword(password string) error {
+	if passwordDenylist != nil && passwordDenylist.Contains(password) {
+		return ErrCompromisedPassword
+	}
+	return nil
 }
 
 func NewUser(email, password string) (*User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := checkPassword(password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +135,16 @@ func (u *User) Authenticate(password string) bool {
 }
 
 func (u *User) SetPassword(newPassword string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err := checkPassword(newPassword); err != nil {
+		return err
+	}
+	for _, hash := range u.PasswordHistory {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)) == nil {
+			return ErrPasswordReused
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), passwordHashCost)
 	if err != nil {
 		return err
 	}
@@ -46,6 +152,21 @@ func (u *User) SetPassword(newPassword string) error {
 	return nil
 }
 
+// RememberPassword adds the current password hash to PasswordHistory,
+// keeping only the latest limit; zero or less forgets them all
+func (u *User) RememberPassword(limit int) {
+	if limit <= 0 {
+		u.PasswordHistory = nil
+		return
+	}
+	if u.PWHash != "" {
+		u.PasswordHistory = append(u.PasswordHistory, u.PWHash)
+	}
+	if excess := len(u.PasswordHistory) - limit; excess > 0 {
+		u.PasswordHistory = append([]string(nil), u.PasswordHistory[excess:]...)
+	}
+}
+
 func (u *User) ToJSON() (string, error) {
 	data, err := json.Marshal(u)
 	if err != nil {
@@ -63,8 +184,29 @@ func UserFromJSON(data string) (*User, error) {
 	return &user, nil
 }
 
+// UserFromData decodes a user record regardless of how the storage backend
+// handed it back: a JSON string, raw bytes, or an already-decoded document
+// such as map[string]interface{} or bson.M.
+func UserFromData(data interface{}) (*User, error) {
+	switch v := data.(type) {
+	case string:
+		return UserFromJSON(v)
+	case []byte:
+		return UserFromJSON(string(v))
+	case nil:
+		return nil, fmt.Errorf("invalid user data format: empty record")
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user data format: %w", err)
+		}
+		return UserFromJSON(string(encoded))
+	}
+}
+
 func (u *User) SetConfirmed() {
 	u.Confirmed = true
+	u.ConfirmBy = time.Time{}
 }
 
 func (u *User) GetConfirmed() bool {
@@ -77,4 +219,29 @@ func (u *User) SetDongle(dongle string) {
 
 func (u *User) GetDongle() string {
 	return u.Dongle
-}
\ No newline at end of file
+}
+
+// KnowsIP reports whether the user has previously logged in from ip
+func (u *User) KnowsIP(ip string) bool {
+	for _, known := range u.KnownIPs {
+		if known == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEntitlement reports whether name is among the user's entitlements,
+// using defaults when none have been set for the user
+func (u *User) HasEntitlement(name string, defaults []string) bool {
+	granted := u.Entitlements
+	if granted == nil {
+		granted = defaults
+	}
+	for _, entitlement := range granted {
+		if entitlement == name {
+			return true
+		}
+	}
+	return false
+}
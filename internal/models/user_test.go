@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// withHashCost sets the hash cost for one test, restoring it afterwards
+func withHashCost(tb testing.TB, cost int) {
+	tb.Helper()
+	previous := passwordHashCost
+	if err := SetPasswordHashCost(cost); err != nil {
+		tb.Fatalf("SetPasswordHashCost(%d): %v", cost, err)
+	}
+	tb.Cleanup(func() { passwordHashCost = previous })
+}
+
+func TestPasswordHashCostRoundTrip(t *testing.T) {
+	withHashCost(t, bcrypt.MinCost)
+
+	user, err := NewUser("cost@example.com", "password123")
+	if err != nil {
+		t.Fatalf("NewUser failed: %v", err)
+	}
+	if cost, err := bcrypt.Cost([]byte(user.PWHash)); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("hash cost = %d (err %v), want %d", cost, err, bcrypt.MinCost)
+	}
+	if !user.Authenticate("password123") {
+		t.Error("Authenticate should accept the password")
+	}
+	if user.Authenticate("password124") {
+		t.Error("Authenticate should reject a wrong password")
+	}
+
+	if err := user.SetPassword("newpassword"); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(user.PWHash)); cost != bcrypt.MinCost {
+		t.Errorf("hash cost after SetPassword = %d, want %d", cost, bcrypt.MinCost)
+	}
+	if !user.Authenticate("newpassword") || user.Authenticate("password123") {
+		t.Error("Authenticate should accept only the new password")
+	}
+}
+
+func TestSetPasswordHashCostRejectsOutOfRange(t *testing.T) {
+	withHashCost(t, bcrypt.DefaultCost)
+
+	for _, cost := range []int{0, bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if err := SetPasswordHashCost(cost); err == nil {
+			t.Errorf("SetPasswordHashCost(%d) should fail", cost)
+		}
+	}
+	if passwordHashCost != bcrypt.DefaultCost {
+		t.Errorf("a rejected cost changed the setting to %d", passwordHashCost)
+	}
+}
+
+func BenchmarkNewUser(b *testing.B) {
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.DefaultCost} {
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			withHashCost(b, cost)
+			for i := 0; i < b.N; i++ {
+				if _, err := NewUser("bench@example.com", "password123"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRememberPasswordKeepsLatest(t *testing.T) {
+	user := &User{PasswordHistory: []string{"a", "b"}, PWHash: "c"}
+
+	user.RememberPassword(2)
+	if fmt.Sprint(user.PasswordHistory) != "[b c]" {
+		t.Errorf("PasswordHistory = %v, want the two latest, oldest first", user.PasswordHistory)
+	}
+	user.RememberPassword(0)
+	if user.PasswordHistory != nil {
+		t.Errorf("PasswordHistory = %v, want none with history off", user.PasswordHistory)
+	}
+}
+
+func TestSetPasswordRejectsHistory(t *testing.T) {
+	withHashCost(t, bcrypt.MinCost)
+	user, err := NewUser("user@example.com", "first-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.RememberPassword(DefaultPasswordHistory)
+	if err := user.SetPassword("first-password"); err != ErrPasswordReused {
+		t.Fatalf("SetPassword(previous) = %v, want ErrPasswordReused", err)
+	}
+	if !user.Authenticate("first-password") {
+		t.Error("a refused password should leave the current one in place")
+	}
+	if err := user.SetPassword("second-password"); err != nil {
+		t.Errorf("SetPassword(new) = %v", err)
+	}
+}
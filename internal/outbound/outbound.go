@@ -0,0 +1,76 @@
+// Package outbound builds the HTTP client the server calls other services
+// with, such as the password denylist range endpoint and Dropbox. Every
+// call is bounded, so a remote that accepts a connection and then stalls
+// fails the request instead of pinning its goroutine for good.
+package outbound
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Options bound an outbound client's connections and requests. Zero values
+// fall back to the matching DefaultOptions field.
+type Options struct {
+	// How long connecting, including the TLS handshake, may take
+	DialTimeout time.Duration
+	// How long to wait for response headers once the request is sent
+	ResponseTimeout time.Duration
+	// Upper bound on a whole call, reading the body included
+	Timeout time.Duration
+	// Idle keep-alive connections kept per host, and for how long
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// DefaultOptions are the limits used for anything left unset
+func DefaultOptions() Options {
+	return Options{
+		DialTimeout:         5 * time.Second,
+		ResponseTimeout:     10 * time.Second,
+		Timeout:             30 * time.Second,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = d.DialTimeout
+	}
+	if o.ResponseTimeout <= 0 {
+		o.ResponseTimeout = d.ResponseTimeout
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = d.Timeout
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = d.IdleConnTimeout
+	}
+	return o
+}
+
+// New returns a client with its own connection pool, bounded by opts. One
+// client is meant to be shared by every integration, so connections to the
+// same host are reused across them.
+func New(opts Options) *http.Client {
+	opts = opts.withDefaults()
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.DialTimeout,
+		ResponseHeaderTimeout: opts.ResponseTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          opts.MaxIdleConnsPerHost * 10,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
@@ -0,0 +1,78 @@
+package outbound
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// hungServer accepts requests and never answers them until the test ends
+func hungServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server
+}
+
+func TestHungRemoteFailsWithinResponseTimeout(t *testing.T) {
+	server := hungServer(t)
+	client := New(Options{ResponseTimeout: 100 * time.Millisecond})
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a hung remote succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v to fail, want about the 100ms response timeout", elapsed)
+	}
+}
+
+func TestOverallTimeoutBoundsSlowBody(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	client := New(Options{Timeout: 100 * time.Millisecond})
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err == nil {
+		_, err = resp.Body.Read(make([]byte, 1))
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Fatal("reading a stalled body succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("read took %v to fail, want about the 100ms timeout", elapsed)
+	}
+}
+
+func TestNewFillsDefaults(t *testing.T) {
+	client := New(Options{Timeout: time.Minute})
+	if client.Timeout != time.Minute {
+		t.Errorf("Timeout = %v, want the configured minute", client.Timeout)
+	}
+	transport := client.Transport.(*http.Transport)
+	d := DefaultOptions()
+	if transport.ResponseHeaderTimeout != d.ResponseTimeout || transport.MaxIdleConnsPerHost != d.MaxIdleConnsPerHost {
+		t.Errorf("unset options = %v/%d, want the defaults", transport.ResponseHeaderTimeout, transport.MaxIdleConnsPerHost)
+	}
+}
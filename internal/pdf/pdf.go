@@ -0,0 +1,113 @@
+// Package pdf renders HTML to PDF through an external engine.
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// selfTestHTML is the page rendered by SelfTest
+const selfTestHTML = "<!DOCTYPE html><html><body><p>TouchCalc PDF self-test</p></body></html>"
+
+// ErrNoEngine is returned when no PDF engine is configured
+var ErrNoEngine = errors.New("no PDF engine configured")
+
+// Engine renders an HTML document to PDF
+type Engine interface {
+	Render(ctx context.Context, html string) ([]byte, error)
+}
+
+// Command is an Engine that runs an external renderer, such as
+// "wkhtmltopdf --quiet - -", feeding it HTML on stdin and reading the PDF
+// from stdout. The HTML comes from users, so on Linux the renderer runs in
+// network and user namespaces of its own, with no network to reach; other
+// renderers than wkhtmltopdf must be kept from reading local files by
+// their own flags.
+type Command struct {
+	Args []string
+}
+
+// localFileFlags are the wkhtmltopdf flags deciding whether pages may read
+// local files; NewCommand adds the first unless one is given
+var localFileFlags = []string{"--disable-local-file-access", "--enable-local-file-access"}
+
+// NewCommand parses a whitespace-separated command line into a Command,
+// returning nil for an empty one. A wkhtmltopdf command line without
+// either of localFileFlags is given --disable-local-file-access, so
+// uploaded HTML can't pull in file:///etc/passwd.
+func NewCommand(line string) *Command {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	for i, arg := range args {
+		if filepath.Base(arg) != "wkhtmltopdf" {
+			continue
+		}
+		if !slices.ContainsFunc(args, func(arg string) bool { return slices.Contains(localFileFlags, arg) }) {
+			args = slices.Insert(args, i+1, localFileFlags[0])
+		}
+		break
+	}
+	return &Command{Args: args}
+}
+
+func (c *Command) Render(ctx context.Context, html string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	isolate(cmd)
+	cmd.Stdin = strings.NewReader(html)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", c.Args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", c.Args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// SelfTest renders a tiny page and checks the result is a PDF, so a
+// misconfigured engine is caught at startup instead of at first use
+func SelfTest(ctx context.Context, engine Engine) error {
+	if engine == nil {
+		return ErrNoEngine
+	}
+	out, err := engine.Render(ctx, selfTestHTML)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		return fmt.Errorf("engine output is not a PDF (%d bytes)", len(out))
+	}
+	return nil
+}
+
+// Status holds the outcome of the most recent self-test
+type Status struct {
+	mu  sync.RWMutex
+	ran bool
+	err error
+}
+
+// Set records a self-test outcome
+func (s *Status) Set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ran, s.err = true, err
+}
+
+// Result reports whether a self-test has run and, if so, its error
+func (s *Status) Result() (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ran, s.err
+}
@@ -0,0 +1,78 @@
+package pdf
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewCommandEmpty(t *testing.T) {
+	if cmd := NewCommand("  "); cmd != nil {
+		t.Errorf("NewCommand(blank) = %v, want nil", cmd)
+	}
+}
+
+func TestSelfTestWithCommand(t *testing.T) {
+	ok := &Command{Args: []string{"sh", "-c", "cat >/dev/null; printf '%%PDF-1.4 test'"}}
+	if err := SelfTest(context.Background(), ok); err != nil {
+		t.Errorf("SelfTest with a working engine failed: %v", err)
+	}
+
+	notPDF := &Command{Args: []string{"cat"}}
+	if err := SelfTest(context.Background(), notPDF); err == nil || !strings.Contains(err.Error(), "not a PDF") {
+		t.Errorf("SelfTest with non-PDF output = %v, want a not-a-PDF error", err)
+	}
+
+	failing := &Command{Args: []string{"sh", "-c", "echo renderer crashed >&2; exit 1"}}
+	if err := SelfTest(context.Background(), failing); err == nil || !strings.Contains(err.Error(), "renderer crashed") {
+		t.Errorf("SelfTest with a failing engine = %v, want its stderr", err)
+	}
+}
+
+func TestSelfTestWithoutEngine(t *testing.T) {
+	if err := SelfTest(context.Background(), nil); err != ErrNoEngine {
+		t.Errorf("SelfTest(nil) = %v, want ErrNoEngine", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var s Status
+	if ran, _ := s.Result(); ran {
+		t.Error("new Status reports a self-test ran")
+	}
+	s.Set(ErrNoEngine)
+	if ran, err := s.Result(); !ran || err != ErrNoEngine {
+		t.Errorf("Result = %v, %v; want true, ErrNoEngine", ran, err)
+	}
+}
+
+func TestNewCommandDisablesLocalFiles(t *testing.T) {
+	for line, want := range map[string]string{
+		"wkhtmltopdf --quiet - -":                    "wkhtmltopdf --disable-local-file-access --quiet - -",
+		"/usr/bin/wkhtmltopdf - -":                   "/usr/bin/wkhtmltopdf --disable-local-file-access - -",
+		"wkhtmltopdf --enable-local-file-access - -": "wkhtmltopdf --enable-local-file-access - -",
+		"timeout 20 wkhtmltopdf - -":                 "timeout 20 wkhtmltopdf --disable-local-file-access - -",
+		"weasyprint - -":                             "weasyprint - -",
+	} {
+		if got := strings.Join(NewCommand(line).Args, " "); got != want {
+			t.Errorf("NewCommand(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestCommandHasNoNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the renderer is only isolated on Linux")
+	}
+	// Each network namespace lists its own interfaces
+	out, err := (&Command{Args: []string{"sh", "-c", "cat >/dev/null; cat /proc/net/dev"}}).Render(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n")[2:] {
+		if name, _, _ := strings.Cut(strings.TrimSpace(line), ":"); name != "" && name != "lo" {
+			t.Errorf("renderer sees interface %q, want only lo", name)
+		}
+	}
+}
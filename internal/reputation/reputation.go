@@ -0,0 +1,209 @@
+// Package reputation scores client IPs by their recent misbehaviour, such
+// as client errors, throttled requests and failed logins, and blocks those
+// whose score crosses a threshold. Scores decay over time and are kept in
+// storage, so instances sharing a backend share them too.
+package reputation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Event is something an IP did that counts against it
+type Event string
+
+// Events, from least to most suspicious
+const (
+	ClientError Event = "client_error" // any other 4xx response
+	Throttled   Event = "throttled"    // 429 from the rate limiter or lockout
+	FailedLogin Event = "failed_login" // wrong password or unknown user
+)
+
+// Weights are the points each event adds to an IP's score
+var Weights = map[Event]float64{
+	ClientError: 1,
+	Throttled:   2,
+	FailedLogin: 5,
+}
+
+// Where scores are kept (REPUTATION_STORE)
+const (
+	StoreShared = "shared"
+	StoreLocal  = "local"
+)
+
+// EventKey is the context key a handler sets to an Event to have the
+// request counted as that rather than by its response status
+const EventKey = "reputation_event"
+
+// maxAttempts bounds how often Record retries a swap lost to another writer
+const maxAttempts = 100
+
+// ErrContended is returned when an update keeps losing to concurrent
+// writers
+var ErrContended = errors.New("reputation update contended, try again")
+
+// scoreDir is where each IP's score is kept as a raw JSON item
+const scoreDir = "system/reputation/"
+
+// record is the stored score of one IP as of Updated
+type record struct {
+	Score   float64   `json:"score"`
+	Updated time.Time `json:"updated"`
+}
+
+// Tracker scores IPs and decides which are blocked
+type Tracker struct {
+	storage   storage.Storage
+	threshold float64
+	halfLife  time.Duration
+	now       func() time.Time
+}
+
+// New scores IPs in s, blocking those at or above threshold. Scores halve
+// every halfLife without new events.
+func New(s storage.Storage, threshold float64, halfLife time.Duration) *Tracker {
+	return &Tracker{storage: s, threshold: threshold, halfLife: halfLife, now: time.Now}
+}
+
+func path(ip string) (string, error) {
+	if ip == "" || strings.ContainsAny(ip, `/\`) {
+		return "", fmt.Errorf("invalid IP %q", ip)
+	}
+	return scoreDir + ip, nil
+}
+
+// Score returns ip's current score; IPs never seen score zero
+func (t *Tracker) Score(ip string) (float64, error) {
+	p, err := path(ip)
+	if err != nil {
+		return 0, err
+	}
+	_, rec, err := t.load(p)
+	if err != nil {
+		return 0, err
+	}
+	return t.decayed(rec, t.now()), nil
+}
+
+// Blocked reports whether ip's score has reached the block threshold
+func (t *Tracker) Blocked(ip string) (bool, error) {
+	score, err := t.Score(ip)
+	if err != nil {
+		return false, err
+	}
+	return score >= t.threshold, nil
+}
+
+// Record adds event's weight to ip's score and returns the new score. Like
+// counters.Incr it is a compare-and-swap loop, so events recorded by any
+// instance are never lost.
+func (t *Tracker) Record(ip string, event Event) (float64, error) {
+	weight, ok := Weights[event]
+	if !ok {
+		return 0, fmt.Errorf("unknown reputation event %q", event)
+	}
+	p, err := path(ip)
+	if err != nil {
+		return 0, err
+	}
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		raw, rec, err := t.load(p)
+		if err != nil {
+			return 0, err
+		}
+		now := t.now()
+		next := record{Score: t.decayed(rec, now) + weight, Updated: now.UTC()}
+		data, err := json.Marshal(next)
+		if err != nil {
+			return 0, err
+		}
+		swapped, err := storage.CompareAndSwap(t.storage, p, raw, string(data))
+		if err != nil {
+			return 0, fmt.Errorf("failed to update reputation of %s: %w", ip, err)
+		}
+		if swapped {
+			return next.Score, nil
+		}
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	return 0, fmt.Errorf("reputation of %s: %w", ip, ErrContended)
+}
+
+// decayed is rec's score as of now
+func (t *Tracker) decayed(rec record, now time.Time) float64 {
+	if rec.Score == 0 || t.halfLife <= 0 {
+		return rec.Score
+	}
+	elapsed := now.Sub(rec.Updated)
+	if elapsed <= 0 {
+		return rec.Score
+	}
+	return rec.Score * math.Exp2(-float64(elapsed)/float64(t.halfLife))
+}
+
+// load returns the stored text of the score at p, "" when absent, and the
+// record it holds
+func (t *Tracker) load(p string) (string, record, error) {
+	raw, err := t.storage.GetItem(p)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", record{}, nil
+	}
+	if err != nil {
+		return "", record{}, fmt.Errorf("failed to load reputation of %s: %w", strings.TrimPrefix(p, scoreDir), err)
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		return "", record{}, fmt.Errorf("invalid reputation of %s: %w", strings.TrimPrefix(p, scoreDir), err)
+	}
+	return raw, rec, nil
+}
+
+// Middleware refuses requests from blocked IPs with 403 and scores the
+// rest by outcome: the Event a handler set under EventKey, or else a 429
+// or other 4xx response. It goes ahead of the rate limiter so throttled
+// requests count too. Storage failures are logged and let requests through.
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		blocked, err := t.Blocked(ip)
+		if err != nil {
+			log.Printf("Failed to check reputation of %s: %v", ip, err)
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		var event Event
+		if value, ok := c.Get(EventKey); ok {
+			event, _ = value.(Event)
+		}
+		if event == "" {
+			status := c.Writer.Status()
+			switch {
+			case status == http.StatusTooManyRequests:
+				event = Throttled
+			case status >= 400 && status < 500:
+				event = ClientError
+			default:
+				return
+			}
+		}
+		if _, err := t.Record(ip, event); err != nil {
+			log.Printf("Failed to record %s for %s: %v", event, ip, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package reputation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestTracker blocks at 20 points, halving scores every minute, on a
+// clock the test moves
+func newTestTracker(s storage.Storage) (*Tracker, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	t := New(s, 20, time.Minute)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestFailuresCrossThresholdAndDecay(t *testing.T) {
+	tracker, now := newTestTracker(storage.NewMemoryStorage())
+
+	for i := 0; i < 3; i++ {
+		if _, err := tracker.Record("203.0.113.7", FailedLogin); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if blocked, _ := tracker.Blocked("203.0.113.7"); blocked {
+		t.Fatal("15 points should stay under the threshold of 20")
+	}
+	score, err := tracker.Record("203.0.113.7", FailedLogin)
+	if err != nil || score != 20 {
+		t.Fatalf("fourth failed login: score = %v, %v; want 20", score, err)
+	}
+	if blocked, _ := tracker.Blocked("203.0.113.7"); !blocked {
+		t.Fatal("IP at the threshold should be blocked")
+	}
+	if blocked, _ := tracker.Blocked("203.0.113.8"); blocked {
+		t.Error("other IPs must not be blocked")
+	}
+
+	// One half-life later the score is half what it was
+	*now = now.Add(time.Minute)
+	if score, _ := tracker.Score("203.0.113.7"); score < 9.99 || score > 10.01 {
+		t.Errorf("score after one half-life = %v, want 10", score)
+	}
+	if blocked, _ := tracker.Blocked("203.0.113.7"); blocked {
+		t.Error("IP should recover once its score decays")
+	}
+
+	// New events add to the decayed score
+	if score, _ := tracker.Record("203.0.113.7", ClientError); score < 10.99 || score > 11.01 {
+		t.Errorf("score after a client error = %v, want 11", score)
+	}
+}
+
+func TestScoresAreSharedThroughStorage(t *testing.T) {
+	shared := storage.NewMemoryStorage()
+	a, _ := newTestTracker(shared)
+	b, _ := newTestTracker(shared)
+	b.now = a.now
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		tracker := a
+		if i%2 == 1 {
+			tracker = b
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tracker.Record("198.51.100.1", ClientError); err != nil {
+				t.Errorf("Record failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if score, _ := b.Score("198.51.100.1"); score != 20 {
+		t.Errorf("score = %v, want 20 from both instances", score)
+	}
+	if blocked, _ := a.Blocked("198.51.100.1"); !blocked {
+		t.Error("an IP blocked by one instance should be blocked by the other")
+	}
+}
+
+func TestMiddlewareScoresResponsesAndBlocks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker, now := newTestTracker(storage.NewMemoryStorage())
+
+	router := gin.New()
+	router.Use(tracker.Middleware())
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/throttled", func(c *gin.Context) { c.Status(http.StatusTooManyRequests) })
+	router.POST("/login", func(c *gin.Context) {
+		c.Set(EventKey, FailedLogin)
+		c.Status(http.StatusUnauthorized)
+	})
+	get := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	get(http.MethodGet, "/ok")
+	get(http.MethodGet, "/missing")
+	get(http.MethodGet, "/throttled")
+	if score, _ := tracker.Score("192.0.2.1"); score != 3 {
+		t.Fatalf("score = %v, want 3 from a 404 and a 429", score)
+	}
+
+	// Failed logins count as such, not as the 401 they answer with
+	for i := 0; i < 4; i++ {
+		get(http.MethodPost, "/login")
+	}
+	if code := get(http.MethodGet, "/ok"); code != http.StatusForbidden {
+		t.Fatalf("blocked IP got %d, want 403", code)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if code := get(http.MethodGet, "/ok"); code != http.StatusOK {
+		t.Errorf("after decay got %d, want 200", code)
+	}
+}
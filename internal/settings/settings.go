@@ -0,0 +1,180 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// Well-known runtime flags
+const (
+	MaintenanceMode = "maintenance_mode"
+	ReadOnly        = "read_only"
+)
+
+// settingsDir is where each setting is stored as its own JSON-encoded file
+var settingsDir = []string{"system", "settings"}
+
+// ChangeFunc is called with the setting's key and new raw JSON value
+type ChangeFunc func(key string, value json.RawMessage)
+
+// Service persists runtime settings in storage so they survive restarts
+// and, with a shared backend, are visible to every instance
+type Service struct {
+	storage storage.Storage
+
+	mu       sync.Mutex
+	watchers map[string][]ChangeFunc
+	seen     map[string]string
+}
+
+func NewService(s storage.Storage) *Service {
+	return &Service{
+		storage:  s,
+		watchers: make(map[string][]ChangeFunc),
+		seen:     make(map[string]string),
+	}
+}
+
+func (s *Service) path(key string) []string {
+	return append(append([]string{}, settingsDir...), key)
+}
+
+// Get decodes the stored value for key into v. It reports false, leaving v
+// untouched, when the setting has never been set.
+func (s *Service) Get(key string, v interface{}) (bool, error) {
+	raw, found, err := s.load(key)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return false, fmt.Errorf("invalid value for setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Set stores v under key and notifies local watchers if the value changed
+func (s *Service) Set(key string, v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	raw := string(encoded)
+
+	// Settings change outside any one request, so no request's deadline
+	// applies
+	ctx := context.Background()
+	path := s.path(key)
+	err = s.storage.UpdateFile(ctx, path, raw)
+	if err == storage.ErrNotFound {
+		if err = s.storage.CreateDir(ctx, settingsDir); err == nil {
+			err = s.storage.CreateFile(ctx, path, raw)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+
+	s.observe(key, raw)
+	return nil
+}
+
+// GetBool returns the boolean setting for key, or def when unset
+func (s *Service) GetBool(key string, def bool) (bool, error) {
+	value := def
+	_, err := s.Get(key, &value)
+	return value, err
+}
+
+func (s *Service) SetBool(key string, value bool) error {
+	return s.Set(key, value)
+}
+
+// GetString returns the string setting for key, or def when unset
+func (s *Service) GetString(key string, def string) (string, error) {
+	value := def
+	_, err := s.Get(key, &value)
+	return value, err
+}
+
+func (s *Service) SetString(key string, value string) error {
+	return s.Set(key, value)
+}
+
+// GetInt returns the integer setting for key, or def when unset
+func (s *Service) GetInt(key string, def int) (int, error) {
+	value := def
+	_, err := s.Get(key, &value)
+	return value, err
+}
+
+func (s *Service) SetInt(key string, value int) error {
+	return s.Set(key, value)
+}
+
+// Watch registers fn to be called whenever key changes, either through Set
+// on this instance or when Sync picks up a change made elsewhere
+func (s *Service) Watch(key string, fn ChangeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers[key] = append(s.watchers[key], fn)
+}
+
+// Sync re-reads every watched setting from storage and notifies watchers of
+// values not yet seen by this instance, such as changes made elsewhere or,
+// on the first call, the values persisted before a restart
+func (s *Service) Sync() error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.watchers))
+	for key := range s.watchers {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		raw, found, err := s.load(key)
+		if err != nil {
+			return err
+		}
+		if found {
+			s.observe(key, raw)
+		}
+	}
+	return nil
+}
+
+func (s *Service) load(key string) (string, bool, error) {
+	item, err := s.storage.GetFile(context.Background(), s.path(key))
+	if err == storage.ErrNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to load setting %s: %w", key, err)
+	}
+
+	raw, ok := item.Data.(string)
+	if !ok {
+		return "", false, fmt.Errorf("invalid data format for setting %s", key)
+	}
+	return raw, true, nil
+}
+
+// observe records raw as the latest known value for key and, if it differs
+// from the previous one, calls the key's watchers outside the lock
+func (s *Service) observe(key, raw string) {
+	s.mu.Lock()
+	previous, known := s.seen[key]
+	s.seen[key] = raw
+	watchers := append([]ChangeFunc{}, s.watchers[key]...)
+	s.mu.Unlock()
+
+	if known && previous == raw {
+		return
+	}
+	for _, fn := range watchers {
+		fn(key, json.RawMessage(raw))
+	}
+}
@@ -0,0 +1,189 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// memStorage is a minimal file-level Storage for exercising the service
+type memStorage struct {
+	files map[string]*models.StorageItem
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: make(map[string]*models.StorageItem)}
+}
+
+func (m *memStorage) key(path []string) string { return strings.Join(path, "/") }
+
+func (m *memStorage) CreateDir(ctx context.Context, path []string) error {
+	if _, exists := m.files[m.key(path)]; !exists {
+		m.files[m.key(path)] = models.NewStorageItem(path, "dir", []string{})
+	}
+	return nil
+}
+
+func (m *memStorage) DeleteDir(path []string, recursive bool) error {
+	delete(m.files, m.key(path))
+	return nil
+}
+
+func (m *memStorage) List(path []string) ([]string, error) {
+	if _, exists := m.files[m.key(path)]; !exists {
+		return nil, storage.ErrNotFound
+	}
+	var names []string
+	for key := range m.files {
+		if name, ok := strings.CutPrefix(key, m.key(path)+"/"); ok && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	item, exists := m.files[m.key(path)]
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *memStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	m.files[m.key(path)] = models.NewStorageItem(path, "file", data)
+	return nil
+}
+
+func (m *memStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	if _, exists := m.files[m.key(path)]; !exists {
+		return storage.ErrNotFound
+	}
+	m.files[m.key(path)] = models.NewStorageItem(path, "file", data)
+	return nil
+}
+
+func (m *memStorage) DeleteFile(ctx context.Context, path []string) error {
+	delete(m.files, m.key(path))
+	return nil
+}
+
+func (m *memStorage) Append(path []string, data []byte) error {
+	return nil
+}
+
+func (m *memStorage) PutItem(path string, data string, bucket ...string) error { return nil }
+
+func (m *memStorage) GetItem(path string, bucket ...string) (string, error) { return "", nil }
+
+func (m *memStorage) ExistsItem(path string, bucket ...string) (bool, error) { return false, nil }
+
+func (m *memStorage) DeleteItem(path string, bucket ...string) error { return nil }
+
+func TestSettingPersistsAcrossRestart(t *testing.T) {
+	store := newMemStorage()
+
+	first := NewService(store)
+	if err := first.SetBool(MaintenanceMode, true); err != nil {
+		t.Fatalf("SetBool failed: %v", err)
+	}
+	if err := first.SetInt("max_sheets", 50); err != nil {
+		t.Fatalf("SetInt failed: %v", err)
+	}
+	if err := first.SetString("banner", "Back soon"); err != nil {
+		t.Fatalf("SetString failed: %v", err)
+	}
+
+	// A new service over the same storage stands in for a restarted process
+	restarted := NewService(store)
+
+	maintenance, err := restarted.GetBool(MaintenanceMode, false)
+	if err != nil || !maintenance {
+		t.Errorf("GetBool = %v, %v; want true", maintenance, err)
+	}
+	maxSheets, err := restarted.GetInt("max_sheets", 0)
+	if err != nil || maxSheets != 50 {
+		t.Errorf("GetInt = %v, %v; want 50", maxSheets, err)
+	}
+	banner, err := restarted.GetString("banner", "")
+	if err != nil || banner != "Back soon" {
+		t.Errorf("GetString = %q, %v; want %q", banner, err, "Back soon")
+	}
+
+	if _, err := store.GetFile(context.Background(), []string{"system", "settings", MaintenanceMode}); err != nil {
+		t.Errorf("setting not stored under system/settings: %v", err)
+	}
+}
+
+func TestUnsetSettingReturnsDefault(t *testing.T) {
+	service := NewService(newMemStorage())
+
+	readOnly, err := service.GetBool(ReadOnly, true)
+	if err != nil || !readOnly {
+		t.Errorf("GetBool = %v, %v; want default true", readOnly, err)
+	}
+}
+
+func TestSetOverwritesExistingValue(t *testing.T) {
+	service := NewService(newMemStorage())
+
+	if err := service.SetBool(ReadOnly, true); err != nil {
+		t.Fatalf("SetBool failed: %v", err)
+	}
+	if err := service.SetBool(ReadOnly, false); err != nil {
+		t.Fatalf("SetBool failed: %v", err)
+	}
+
+	readOnly, err := service.GetBool(ReadOnly, true)
+	if err != nil || readOnly {
+		t.Errorf("GetBool = %v, %v; want false", readOnly, err)
+	}
+}
+
+func TestWatchNotifiesOnChange(t *testing.T) {
+	service := NewService(newMemStorage())
+
+	var changes []string
+	service.Watch(MaintenanceMode, func(key string, value json.RawMessage) {
+		changes = append(changes, key+"="+string(value))
+	})
+
+	service.SetBool(MaintenanceMode, true)
+	service.SetBool(MaintenanceMode, true)
+	service.SetBool(MaintenanceMode, false)
+	service.SetBool(ReadOnly, true)
+
+	want := []string{"maintenance_mode=true", "maintenance_mode=false"}
+	if strings.Join(changes, ",") != strings.Join(want, ",") {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestSyncPicksUpChangesFromOtherInstances(t *testing.T) {
+	store := newMemStorage()
+	local := NewService(store)
+	remote := NewService(store)
+
+	var seen []string
+	local.Watch(ReadOnly, func(key string, value json.RawMessage) {
+		seen = append(seen, string(value))
+	})
+
+	remote.SetBool(ReadOnly, true)
+	if err := local.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if err := local.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if len(seen) != 1 || seen[0] != "true" {
+		t.Errorf("watcher saw %v, want a single true", seen)
+	}
+}
@@ -0,0 +1,27 @@
+package sheet
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// WriteCSV writes the cell values of grid, from ParseGrid, to w as RFC
+// 4180 CSV, one record per row. Every row has a field for every column, so
+// the grid keeps its shape and empty cells come out as blank fields.
+// Formula cells export their computed value. Line breaks, including those
+// inside quoted fields, are written as CRLF.
+func WriteCSV(w io.Writer, grid *Grid) error {
+	out := csv.NewWriter(w)
+	out.UseCRLF = true
+	record := make([]string, grid.Cols)
+	for row := 1; row <= grid.Rows; row++ {
+		for col := 1; col <= grid.Cols; col++ {
+			record[col-1] = grid.Get(row, col).Value
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
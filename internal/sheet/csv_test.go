@@ -0,0 +1,92 @@
+package sheet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func toCSV(t *testing.T, data string) string {
+	t.Helper()
+	grid, err := ParseGrid(data)
+	if err != nil {
+		t.Fatalf("ParseGrid failed: %v", err)
+	}
+	var out strings.Builder
+	if err := WriteCSV(&out, grid); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestWriteCSVQuotesTrickyCells(t *testing.T) {
+	data := strings.Join([]string{
+		"version:1.5",
+		`cell:A1:t:plain`,
+		`cell:B1:t:a,b`,
+		`cell:C1:t:say "hi"`,
+		`cell:A2:t:two\nlines`,
+		`cell:B2:t:10\c30 \b path`,
+		`cell:C2:v:3.5`,
+		"sheet:c:3:r:2",
+		"",
+	}, "\n")
+
+	want := "plain,\"a,b\",\"say \"\"hi\"\"\"\r\n" +
+		"\"two\r\nlines\",10:30 \\ path,3.5\r\n"
+	if got := toCSV(t, data); got != want {
+		t.Errorf("WriteCSV =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteCSVKeepsEmptyCells(t *testing.T) {
+	data := "cell:B1:v:1\ncell:A3:t:x\nsheet:c:3:r:4\n"
+
+	want := ",1,\r\n,,\r\nx,,\r\n,,\r\n"
+	if got := toCSV(t, data); got != want {
+		t.Errorf("WriteCSV = %q, want %q", got, want)
+	}
+}
+
+func TestWriteCSVExportsFormulaValues(t *testing.T) {
+	data := "cell:A1:v:2\ncell:A2:vtf:n:4:A1*2\ncell:B1:vtc:nd:45000:1/1/2023\ncell:B2:b:1:1:1:1\n"
+
+	want := "2,45000\r\n4,\r\n"
+	if got := toCSV(t, data); got != want {
+		t.Errorf("WriteCSV = %q, want %q", got, want)
+	}
+}
+
+func TestWriteCSVGrowsPastSheetDimensions(t *testing.T) {
+	data := "cell:AA2:t:far\nsheet:c:1:r:1\n"
+
+	got := toCSV(t, data)
+	lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+	if len(lines) != 2 || lines[1] != strings.Repeat(",", 26)+"far" {
+		t.Errorf("WriteCSV = %q, want two rows reaching column AA", got)
+	}
+}
+
+func TestWriteCSVEmptySheet(t *testing.T) {
+	if got := toCSV(t, "version:1.5\n"); got != "" {
+		t.Errorf("WriteCSV = %q, want nothing", got)
+	}
+}
+
+func TestParseGridRefusesHugeSheets(t *testing.T) {
+	for _, data := range []string{
+		"sheet:c:2000000000:r:1\n",
+		"sheet:c:1:r:1048577\n",
+		"cell:XFE1:t:past the last column\n",
+		"cell:A1048577:t:past the last row\n",
+		"sheet:c:16384:r:1048576\n",
+	} {
+		if _, err := ParseGrid(data); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("ParseGrid(%q): err = %v, want ErrTooLarge", data, err)
+		}
+	}
+
+	if _, err := ParseGrid("cell:XFD1:t:last column\ncell:A100:t:x\n"); err != nil {
+		t.Errorf("ParseGrid within the limits failed: %v", err)
+	}
+}
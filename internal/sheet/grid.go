@@ -0,0 +1,215 @@
+package sheet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The largest grid ParseGrid accepts: Excel's worksheet limits, and a cap
+// on rows times columns, as a CSV export writes every cell of the grid
+const (
+	MaxRows  = 1048576
+	MaxCols  = 16384
+	MaxCells = 10000000
+)
+
+// ErrTooLarge is returned by ParseGrid for a sheet whose size, or any of
+// whose cells, lies beyond MaxRows, MaxCols or MaxCells
+var ErrTooLarge = errors.New("sheet is too large to export")
+
+// Tab is one sheet of a saved workbook
+type Tab struct {
+	Name string
+	Data string // SocialCalc save data
+}
+
+// Cell is the value a cell displays
+type Cell struct {
+	Row, Col int // 1-based
+	Value    string
+	Numeric  bool
+}
+
+// Grid holds the cells of a sheet and its size, which covers every cell
+type Grid struct {
+	Rows, Cols int
+	cells      map[[2]int]Cell
+}
+
+// Get returns the cell at row and col, empty when nothing is there
+func (g *Grid) Get(row, col int) Cell {
+	if cell, ok := g.cells[[2]int{row, col}]; ok {
+		return cell
+	}
+	return Cell{Row: row, Col: col}
+}
+
+// Cells returns the cells with something in them, in row then column order
+func (g *Grid) Cells() []Cell {
+	cells := make([]Cell, 0, len(g.cells))
+	for _, cell := range g.cells {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Row != cells[j].Row {
+			return cells[i].Row < cells[j].Row
+		}
+		return cells[i].Col < cells[j].Col
+	})
+	return cells
+}
+
+// workbookSave is how the workbook control saves several tabs, each with
+// the SocialCalc save data of one sheet
+type workbookSave struct {
+	SheetArr json.RawMessage `json:"sheetArr"`
+}
+
+type workbookTab struct {
+	Name     string `json:"name"`
+	SheetStr struct {
+		SaveStr string `json:"savestr"`
+	} `json:"sheetstr"`
+}
+
+// Tabs splits saved data into its sheets, in the order the workbook lists
+// them. Anything that isn't a workbook save is taken as a single sheet.
+func Tabs(data string) []Tab {
+	var save workbookSave
+	if err := json.Unmarshal([]byte(data), &save); err != nil || len(save.SheetArr) == 0 {
+		return []Tab{{Name: "Sheet1", Data: data}}
+	}
+
+	// Decode tab by tab to keep the workbook's order, which a map loses
+	dec := json.NewDecoder(bytes.NewReader(save.SheetArr))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return []Tab{{Name: "Sheet1", Data: data}}
+	}
+	var tabs []Tab
+	for dec.More() {
+		id, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var tab workbookTab
+		if err := dec.Decode(&tab); err != nil {
+			break
+		}
+		name := tab.Name
+		if name == "" {
+			name, _ = id.(string)
+		}
+		tabs = append(tabs, Tab{Name: name, Data: tab.SheetStr.SaveStr})
+	}
+	if len(tabs) == 0 {
+		return []Tab{{Name: "Sheet1", Data: ""}}
+	}
+	return tabs
+}
+
+// ParseGrid reads the cells out of a sheet's save data. The grid is the
+// sheet's own size, grown to fit any cell outside it. Formula cells hold
+// their computed value. Sizes are saved by the client, so a grid beyond
+// the Max limits is ErrTooLarge rather than something to allocate.
+func ParseGrid(data string) (*Grid, error) {
+	grid := &Grid{cells: make(map[[2]int]Cell)}
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.Split(strings.TrimSuffix(line, "\r"), ":")
+		switch parts[0] {
+		case "cell":
+			if len(parts) < 2 {
+				continue
+			}
+			col, row, ok := parseCoord(parts[1])
+			if !ok {
+				continue
+			}
+			value, numeric := cellValue(parts[2:])
+			grid.cells[[2]int{row, col}] = Cell{Row: row, Col: col, Value: value, Numeric: numeric}
+			grid.Cols, grid.Rows = max(grid.Cols, col), max(grid.Rows, row)
+		case "sheet":
+			for i := 1; i+1 < len(parts); i += 2 {
+				n, err := strconv.Atoi(parts[i+1])
+				if err != nil {
+					continue
+				}
+				switch parts[i] {
+				case "c":
+					grid.Cols = max(grid.Cols, n)
+				case "r":
+					grid.Rows = max(grid.Rows, n)
+				}
+			}
+		}
+		if grid.Rows > MaxRows || grid.Cols > MaxCols {
+			return nil, ErrTooLarge
+		}
+	}
+	if grid.Rows*grid.Cols > MaxCells {
+		return nil, ErrTooLarge
+	}
+	return grid, nil
+}
+
+// cellValue returns the displayed value from the fields of a cell line
+// after its coordinate, and whether it is a number
+func cellValue(fields []string) (string, bool) {
+	if len(fields) < 2 {
+		return "", false
+	}
+	var valueType, value string
+	switch fields[0] {
+	case "v":
+		valueType, value = "n", fields[1]
+	case "t":
+		valueType, value = "t", fields[1]
+	case "vt", "vtf", "vtc":
+		// Value type, then the value, then any formula or constant text
+		if len(fields) < 3 {
+			return "", false
+		}
+		valueType, value = fields[1], fields[2]
+	default:
+		return "", false
+	}
+	value = decodeValue(value)
+	if !strings.HasPrefix(valueType, "n") {
+		return value, false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return value, err == nil
+}
+
+// parseCoord splits a coordinate such as "AB12" into its 1-based column
+// and row
+func parseCoord(coord string) (int, int, bool) {
+	if !coordPattern.MatchString(coord) {
+		return 0, 0, false
+	}
+	split := strings.IndexAny(coord, "123456789")
+	col := 0
+	for _, letter := range coord[:split] {
+		col = col*26 + int(letter-'A') + 1
+	}
+	row, err := strconv.Atoi(coord[split:])
+	return col, row, err == nil
+}
+
+// columnName is the letters naming a 1-based column, the reverse of
+// parseCoord
+func columnName(col int) string {
+	var name []byte
+	for ; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// decodeValue reverses encodeValue
+func decodeValue(value string) string {
+	return strings.NewReplacer(`\c`, ":", `\n`, "\n", `\b`, `\`).Replace(value)
+}
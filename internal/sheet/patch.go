@@ -0,0 +1,150 @@
+// Package sheet reads and edits SocialCalc sheet save data at the cell level.
+package sheet
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Supported patch operations
+const (
+	OpSet   = "set"
+	OpClear = "clear"
+)
+
+// maxCellValueLength caps the value of a single set operation
+const maxCellValueLength = 32 * 1024
+
+var coordPattern = regexp.MustCompile(`^[A-Z]{1,3}[1-9][0-9]{0,6}$`)
+
+// Op is a single cell-level change
+type Op struct {
+	Op    string `json:"op"`
+	Cell  string `json:"cell"`
+	Value string `json:"value,omitempty"`
+}
+
+// OpError reports an invalid operation by its position in the patch
+type OpError struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+func (e OpError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Message)
+}
+
+// Validate checks every operation, returning one error per bad operation
+func Validate(ops []Op) []OpError {
+	var errs []OpError
+	if len(ops) == 0 {
+		return []OpError{{Index: 0, Message: "patch has no operations"}}
+	}
+	for i, op := range ops {
+		switch {
+		case op.Op != OpSet && op.Op != OpClear:
+			errs = append(errs, OpError{i, fmt.Sprintf("unknown op %q", op.Op)})
+		case !coordPattern.MatchString(op.Cell):
+			errs = append(errs, OpError{i, fmt.Sprintf("invalid cell %q", op.Cell)})
+		case op.Op == OpClear && op.Value != "":
+			errs = append(errs, OpError{i, "clear takes no value"})
+		case len(op.Value) > maxCellValueLength:
+			errs = append(errs, OpError{i, fmt.Sprintf("value exceeds %d bytes", maxCellValueLength)})
+		case op.Op == OpSet && !finite(op.Value):
+			errs = append(errs, OpError{i, fmt.Sprintf("value %q is not a finite number", op.Value)})
+		}
+	}
+	return errs
+}
+
+// Apply returns data with ops applied in order. Set replaces the cell's
+// line (or adds one), storing numbers as values and anything else as text;
+// clear removes the cell. Lines for other cells are left untouched.
+func Apply(data string, ops []Op) (string, error) {
+	if errs := Validate(ops); len(errs) > 0 {
+		return "", errs[0]
+	}
+
+	lines := strings.Split(data, "\n")
+	for _, op := range ops {
+		index := findCell(lines, op.Cell)
+		switch op.Op {
+		case OpSet:
+			line := cellLine(op.Cell, op.Value)
+			if index >= 0 {
+				lines[index] = line
+			} else {
+				lines = insertCell(lines, line)
+			}
+		case OpClear:
+			if index >= 0 {
+				lines = append(lines[:index], lines[index+1:]...)
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// findCell returns the index of the line describing cell, or -1
+func findCell(lines []string, cell string) int {
+	prefix := "cell:" + cell + ":"
+	for i, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertCell adds a cell line after the last existing one, or before the
+// sheet attributes when the sheet has no cells yet
+func insertCell(lines []string, line string) []string {
+	at := -1
+	for i, existing := range lines {
+		if strings.HasPrefix(existing, "cell:") {
+			at = i + 1
+		}
+	}
+	if at < 0 {
+		for i, existing := range lines {
+			if strings.HasPrefix(existing, "sheet:") {
+				at = i
+				break
+			}
+		}
+	}
+	if at < 0 {
+		at = len(lines)
+		if at > 0 && lines[at-1] == "" {
+			at--
+		}
+	}
+
+	lines = append(lines, "")
+	copy(lines[at+1:], lines[at:])
+	lines[at] = line
+	return lines
+}
+
+// finite reports whether value, if it reads as a number at all, is a
+// finite one. NaN, Inf and values out of float64 range would otherwise be
+// stored as numbers no spreadsheet can compute with.
+func finite(value string) bool {
+	f, _ := strconv.ParseFloat(value, 64)
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func cellLine(cell, value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "cell:" + cell + ":v:" + value
+	}
+	return "cell:" + cell + ":t:" + encodeValue(value)
+}
+
+// encodeValue applies SocialCalc's save-format escaping
+func encodeValue(value string) string {
+	return strings.NewReplacer(`\`, `\b`, ":", `\c`, "\n", `\n`).Replace(value)
+}
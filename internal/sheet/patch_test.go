@@ -0,0 +1,49 @@
+package sheet
+
+import "testing"
+
+func TestApplyInsertsBeforeSheetAttributes(t *testing.T) {
+	got, err := Apply("version:1.5\nsheet:c:1:r:1\n", []Op{{Op: OpSet, Cell: "A1", Value: "x\\y\nz"}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	want := "version:1.5\ncell:A1:t:x\\by\\nz\nsheet:c:1:r:1\n"
+	if got != want {
+		t.Errorf("Apply = %q, want %q", got, want)
+	}
+}
+
+func TestApplyClearMissingCellIsNoop(t *testing.T) {
+	data := "cell:A1:v:1\n"
+	got, err := Apply(data, []Op{{Op: OpClear, Cell: "B9"}})
+	if err != nil || got != data {
+		t.Errorf("Apply = %q, %v; want unchanged", got, err)
+	}
+}
+
+func TestApplyDoesNotMatchCellPrefix(t *testing.T) {
+	got, err := Apply("cell:A10:v:10\ncell:A1:v:1\n", []Op{{Op: OpSet, Cell: "A1", Value: "2"}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got != "cell:A10:v:10\ncell:A1:v:2\n" {
+		t.Errorf("Apply = %q", got)
+	}
+}
+
+func TestValidateRejectsEmptyPatch(t *testing.T) {
+	if errs := Validate(nil); len(errs) != 1 {
+		t.Errorf("Validate(nil) = %v, want one error", errs)
+	}
+}
+
+func TestValidateRejectsNonFiniteNumbers(t *testing.T) {
+	for _, value := range []string{"NaN", "nan", "Inf", "+Inf", "-Infinity", "1e999"} {
+		if errs := Validate([]Op{{Op: OpSet, Cell: "A1", Value: value}}); len(errs) != 1 {
+			t.Errorf("Validate(%q) = %v, want one error", value, errs)
+		}
+	}
+	if errs := Validate([]Op{{Op: OpSet, Cell: "A1", Value: "1e308"}}); len(errs) != 0 {
+		t.Errorf("Validate(1e308) = %v, want none", errs)
+	}
+}
@@ -0,0 +1,171 @@
+package sheet
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxTabNameLength is the longest worksheet name Excel accepts
+const maxTabNameLength = 31
+
+// WriteXLSX writes tabs to w as an Excel workbook, one worksheet per tab.
+// It is NewWorkbook followed by WriteTo, for callers with nothing to do
+// between building the workbook and sending it.
+func WriteXLSX(w io.Writer, tabs []Tab) error {
+	book, err := NewWorkbook(tabs)
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+	_, err = book.WriteTo(w)
+	return err
+}
+
+// Workbook is an Excel workbook built from a sheet's tabs, ready to write
+type Workbook struct {
+	f *excelize.File
+}
+
+// NewWorkbook builds tabs into an Excel workbook, one worksheet per tab.
+// Numbers are stored as numbers and everything else as text. Worksheets
+// go through excelize's stream writer, which keeps only the cells with
+// something in them and moves large sheets out of memory into temporary
+// files. A tab beyond the limits of ParseGrid is ErrTooLarge, found before
+// anything is built, so the caller can refuse it before sending a thing.
+// The workbook must be closed to remove its temporary files.
+func NewWorkbook(tabs []Tab) (*Workbook, error) {
+	grids := make([]*Grid, len(tabs))
+	for i, tab := range tabs {
+		grid, err := ParseGrid(tab.Data)
+		if err != nil {
+			return nil, err
+		}
+		grids[i] = grid
+	}
+
+	f := excelize.NewFile()
+	names := worksheetNames(tabs)
+	for i, name := range names {
+		var err error
+		if i == 0 {
+			err = f.SetSheetName(f.GetSheetName(0), name)
+		} else {
+			_, err = f.NewSheet(name)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	for i, grid := range grids {
+		if err := writeWorksheet(f, names[i], grid); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &Workbook{f: f}, nil
+}
+
+// WriteTo writes the workbook to w as an .xlsx file
+func (b *Workbook) WriteTo(w io.Writer) (int64, error) {
+	return b.f.WriteTo(w)
+}
+
+// Close removes the workbook's temporary files
+func (b *Workbook) Close() error {
+	return b.f.Close()
+}
+
+// writeWorksheet streams grid's cells into the worksheet name, a row at a
+// time as the stream writer requires
+func writeWorksheet(f *excelize.File, name string, grid *Grid) error {
+	sw, err := f.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+	var row []Cell
+	flush := func() error {
+		if len(row) == 0 {
+			return nil
+		}
+		// Gaps between the row's cells are left nil, which the stream
+		// writer skips
+		first := row[0].Col
+		values := make([]interface{}, row[len(row)-1].Col-first+1)
+		for _, cell := range row {
+			values[cell.Col-first] = xlsxValue(cell)
+		}
+		ref, err := excelize.CoordinatesToCellName(first, row[0].Row)
+		if err != nil {
+			return err
+		}
+		row = row[:0]
+		return sw.SetRow(ref, values)
+	}
+	for _, cell := range grid.Cells() {
+		if cell.Value == "" {
+			continue
+		}
+		if len(row) > 0 && row[0].Row != cell.Row {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		row = append(row, cell)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return sw.Flush()
+}
+
+// xlsxValue is what the stream writer is given for cell: a number for
+// numeric cells, so Excel can calculate with them, and text otherwise
+func xlsxValue(cell Cell) interface{} {
+	if cell.Numeric {
+		// Excel has no NaN or infinity, so those stay text
+		if n, err := strconv.ParseFloat(cell.Value, 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n
+		}
+	}
+	return cell.Value
+}
+
+// worksheetNames makes the tab names acceptable to Excel: no characters
+// it reserves, at most maxTabNameLength long, and no two alike
+func worksheetNames(tabs []Tab) []string {
+	names := make([]string, len(tabs))
+	used := make(map[string]bool)
+	for i, tab := range tabs {
+		base := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, strings.Trim(tab.Name, "'"))
+		if base == "" {
+			base = fmt.Sprintf("Sheet%d", i+1)
+		}
+		name := truncateRunes(base, maxTabNameLength)
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			name = truncateRunes(base, maxTabNameLength-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	return string(runes)
+}
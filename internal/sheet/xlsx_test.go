@@ -0,0 +1,139 @@
+package sheet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxCell is a cell read back from a worksheet
+type xlsxCell struct {
+	Value   string
+	Numeric bool
+}
+
+// readXLSX reopens a workbook with excelize, returning its sheet names and
+// each sheet's cells by reference
+func readXLSX(t *testing.T, data []byte) ([]string, []map[string]xlsxCell) {
+	t.Helper()
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("excelize can't open the workbook: %v", err)
+	}
+	defer f.Close()
+
+	names := f.GetSheetList()
+	var sheets []map[string]xlsxCell
+	for _, name := range names {
+		rows, err := f.GetRows(name, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatalf("reading sheet %s: %v", name, err)
+		}
+		cells := make(map[string]xlsxCell)
+		for r, row := range rows {
+			for c, value := range row {
+				if value == "" {
+					continue
+				}
+				ref, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				cellType, err := f.GetCellType(name, ref)
+				if err != nil {
+					t.Fatalf("reading type of %s!%s: %v", name, ref, err)
+				}
+				cells[ref] = xlsxCell{Value: value, Numeric: cellType == excelize.CellTypeUnset || cellType == excelize.CellTypeNumber}
+			}
+		}
+		sheets = append(sheets, cells)
+	}
+	return names, sheets
+}
+
+func TestWriteXLSXTypesCells(t *testing.T) {
+	data := "cell:A1:t:<total> & \"more\"\ncell:B1:v:3.5\ncell:A2:vtf:n:7:A1+4\ncell:B2:vtc:nd:45000:1/1/2023\ncell:AB3:t:two\\nlines\\c ok\ncell:C3:t:42\n"
+
+	var out bytes.Buffer
+	if err := WriteXLSX(&out, []Tab{{Name: "Budget", Data: data}}); err != nil {
+		t.Fatalf("WriteXLSX failed: %v", err)
+	}
+	names, sheets := readXLSX(t, out.Bytes())
+	if len(names) != 1 || names[0] != "Budget" {
+		t.Fatalf("sheet names = %v, want [Budget]", names)
+	}
+
+	want := map[string]xlsxCell{
+		"A1":  {Value: `<total> & "more"`},
+		"B1":  {Value: "3.5", Numeric: true},
+		"A2":  {Value: "7", Numeric: true},
+		"B2":  {Value: "45000", Numeric: true},
+		"AB3": {Value: "two\nlines: ok"},
+		"C3":  {Value: "42"},
+	}
+	if len(sheets[0]) != len(want) {
+		t.Errorf("got cells %v, want %v", sheets[0], want)
+	}
+	for ref, cell := range want {
+		if got := sheets[0][ref]; got != cell {
+			t.Errorf("%s = %+v, want %+v", ref, got, cell)
+		}
+	}
+}
+
+func TestWriteXLSXOneWorksheetPerTab(t *testing.T) {
+	save, _ := json.Marshal(map[string]interface{}{
+		"numsheets": 3,
+		"sheetArr": map[string]interface{}{
+			"sheet1": map[string]interface{}{"name": "Income", "sheetstr": map[string]string{"savestr": "cell:A1:v:100\n"}},
+			"sheet2": map[string]interface{}{"name": "Costs/2024", "sheetstr": map[string]string{"savestr": "cell:A1:t:rent\n"}},
+			"sheet3": map[string]interface{}{"name": "income", "sheetstr": map[string]string{"savestr": ""}},
+		},
+	})
+	tabs := Tabs(string(save))
+
+	var out bytes.Buffer
+	if err := WriteXLSX(&out, tabs); err != nil {
+		t.Fatalf("WriteXLSX failed: %v", err)
+	}
+	names, sheets := readXLSX(t, out.Bytes())
+	if strings.Join(names, "|") != "Income|Costs_2024|income (2)" {
+		t.Errorf("sheet names = %q, want Excel-safe unique names in order", names)
+	}
+	if sheets[0]["A1"] != (xlsxCell{Value: "100", Numeric: true}) || sheets[1]["A1"] != (xlsxCell{Value: "rent"}) {
+		t.Errorf("cells = %v, want each tab's own data", sheets)
+	}
+	if len(sheets[2]) != 0 {
+		t.Errorf("empty tab has cells %v", sheets[2])
+	}
+}
+
+func TestWriteXLSXRefusesHugeTabs(t *testing.T) {
+	var out bytes.Buffer
+	tabs := []Tab{{Name: "Small", Data: "cell:A1:v:1\n"}, {Name: "Huge", Data: "cell:XFE1:t:past the last column\n"}}
+	if err := WriteXLSX(&out, tabs); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("WriteXLSX: err = %v, want ErrTooLarge", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("WriteXLSX wrote %d bytes before refusing", out.Len())
+	}
+}
+
+func TestTabsOfPlainSheet(t *testing.T) {
+	tabs := Tabs("version:1.5\ncell:A1:v:1\n")
+	if len(tabs) != 1 || tabs[0].Name != "Sheet1" || tabs[0].Data != "version:1.5\ncell:A1:v:1\n" {
+		t.Errorf("Tabs = %+v, want the data as one sheet", tabs)
+	}
+}
+
+func TestWorksheetNamesAreShortened(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	names := worksheetNames([]Tab{{Name: long}, {Name: long}, {Name: ""}})
+	if len([]rune(names[0])) != 31 || len([]rune(names[1])) != 31 || names[0] == names[1] {
+		t.Errorf("names = %q, want distinct names of 31 characters", names)
+	}
+	if names[2] != "Sheet3" {
+		t.Errorf("unnamed tab = %q, want Sheet3", names[2])
+	}
+}
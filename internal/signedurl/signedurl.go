@@ -0,0 +1,101 @@
+// Package signedurl issues and checks tamper-proof, expiring tokens that
+// grant access to one file without a session, for links such as /d/<token>.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalid is returned for a token that is malformed or whose
+	// signature doesn't match
+	ErrInvalid = errors.New("invalid signed URL")
+
+	// ErrExpired is returned for a genuine token past its expiry
+	ErrExpired = errors.New("signed URL has expired")
+)
+
+// Claims is what a token grants. The claims are signed, not encrypted, so
+// anyone holding the token can read them.
+type Claims struct {
+	ID      string    `json:"id"` // unique per token, to track one-time use
+	User    string    `json:"user"`
+	File    string    `json:"file"`
+	Expires time.Time `json:"exp"`
+	Once    bool      `json:"once,omitempty"`
+
+	// By is who the link was signed for when that isn't User, such as a
+	// collaborator, whose access is checked again whenever it's used
+	By string `json:"by,omitempty"`
+}
+
+// Signer signs and verifies tokens with an HMAC-SHA256 key
+type Signer struct {
+	key []byte
+	now func() time.Time
+}
+
+// New returns a Signer keyed by secret. Tokens signed under one secret
+// fail verification under any other, so rotating it revokes them all.
+func New(secret string) *Signer {
+	return &Signer{key: []byte(secret), now: time.Now}
+}
+
+// Sign returns a token for user's file, signed for by, valid for ttl,
+// which once marks as usable a single time. The token is URL-safe.
+func (s *Signer) Sign(user, file, by string, ttl time.Duration, once bool) (string, Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", Claims{}, err
+	}
+	claims := Claims{
+		ID:      hex.EncodeToString(id),
+		User:    user,
+		File:    file,
+		By:      by,
+		Expires: s.now().Add(ttl).UTC().Truncate(time.Second),
+		Once:    once,
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.sign(encoded), claims, nil
+}
+
+// Verify checks token's signature and expiry and returns its claims. A
+// bad signature is ErrInvalid however the claims read; ErrExpired is only
+// reported for tokens this Signer issued.
+func (s *Signer) Verify(token string) (Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return Claims{}, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" || claims.User == "" || claims.File == "" {
+		return Claims{}, ErrInvalid
+	}
+	if !s.now().Before(claims.Expires) {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package signedurl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer := New("secret")
+	token, claims, err := signer.Sign("alice@example.com", "budget", "", time.Hour, true)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if strings.ContainsAny(token, "+/=?&#") {
+		t.Errorf("token %q is not URL-safe", token)
+	}
+
+	got, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if got != claims || got.User != "alice@example.com" || got.File != "budget" || !got.Once {
+		t.Errorf("Verify = %+v, want %+v", got, claims)
+	}
+
+	other, _, _ := signer.Sign("alice@example.com", "budget", "", time.Hour, true)
+	if other == token {
+		t.Error("each token should carry its own ID")
+	}
+}
+
+func TestVerifyRejectsForgeries(t *testing.T) {
+	signer := New("secret")
+	token, _, _ := signer.Sign("alice@example.com", "budget", "", time.Hour, false)
+	payload, signature, _ := strings.Cut(token, ".")
+
+	forged, _, _ := New("guessed").Sign("alice@example.com", "budget", "", time.Hour, false)
+	for name, candidate := range map[string]string{
+		"empty":          "",
+		"no signature":   payload,
+		"other key":      forged,
+		"swapped claims": strings.Split(forged, ".")[0] + "." + signature,
+		"bad signature":  payload + ".AAAA",
+	} {
+		if _, err := signer.Verify(candidate); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: err = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	signer := New("secret")
+	issued := time.Now()
+	signer.now = func() time.Time { return issued }
+	token, _, _ := signer.Sign("alice@example.com", "budget", "", time.Minute, false)
+
+	signer.now = func() time.Time { return issued.Add(time.Minute) }
+	if _, err := signer.Verify(token); !errors.Is(err, ErrExpired) {
+		t.Errorf("err = %v, want ErrExpired", err)
+	}
+}
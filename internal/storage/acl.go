@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ACLDir is the directory, alongside a file, holding its access list
+const ACLDir = ".acl"
+
+// Permission is what an access list lets a collaborator do with a file
+type Permission string
+
+const (
+	PermissionRead Permission = "read"
+	PermissionEdit Permission = "edit"
+)
+
+// Valid reports whether p is a known permission
+func (p Permission) Valid() bool {
+	return p == PermissionRead || p == PermissionEdit
+}
+
+// Allows reports whether holding p is enough for need; edit includes read
+func (p Permission) Allows(need Permission) bool {
+	return p == need || p == PermissionEdit
+}
+
+// ACL maps each collaborator's email to their permission. The owner of a
+// file is never listed; they always have full access.
+type ACL map[string]Permission
+
+// aclPath returns where the access list of the file at path is kept, e.g.
+// home/u/sheet1 -> home/u/.acl/sheet1
+func aclPath(path []string) string {
+	dir := append([]string{}, path[:len(path)-1]...)
+	return strings.Join(append(dir, ACLDir, path[len(path)-1]), "/")
+}
+
+// GetACL returns the access list of the file at path, empty when it has
+// none
+func GetACL(s Storage, path []string) (ACL, error) {
+	data, err := s.GetItem(aclPath(path))
+	if errors.Is(err, ErrNotFound) {
+		return ACL{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	acl := ACL{}
+	if err := json.Unmarshal([]byte(data), &acl); err != nil {
+		return nil, fmt.Errorf("invalid access list for %s: %w", strings.Join(path, "/"), err)
+	}
+	return acl, nil
+}
+
+// Grant gives user perm on the file at path, replacing any permission
+// they already had
+func Grant(s Storage, path []string, user string, perm Permission) error {
+	if !perm.Valid() {
+		return fmt.Errorf("invalid permission %q", perm)
+	}
+	return updateACL(s, path, func(acl ACL) { acl[user] = perm })
+}
+
+// Revoke removes user from the access list of the file at path
+func Revoke(s Storage, path []string, user string) error {
+	return updateACL(s, path, func(acl ACL) { delete(acl, user) })
+}
+
+// DeleteACL removes the access list of the file at path, so a file later
+// created under the same name isn't shared with anyone
+func DeleteACL(s Storage, path []string) error {
+	err := s.DeleteItem(aclPath(path))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// moveACL moves the access list of the file at from, if it has one, to
+// the file at to, replacing any list to already had
+func moveACL(s Storage, from, to []string) error {
+	data, err := s.GetItem(aclPath(from))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.PutItem(aclPath(to), data); err != nil {
+		return err
+	}
+	return DeleteACL(s, from)
+}
+
+func updateACL(s Storage, path []string, update func(ACL)) error {
+	unlock := LockPath([]string{aclPath(path)})
+	defer unlock()
+
+	acl, err := GetACL(s, path)
+	if err != nil {
+		return err
+	}
+	update(acl)
+	if len(acl) == 0 {
+		return DeleteACL(s, path)
+	}
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return err
+	}
+	return s.PutItem(aclPath(path), string(data))
+}
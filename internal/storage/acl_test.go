@@ -0,0 +1,63 @@
+package storage
+
+import "testing"
+
+func TestGrantAndRevoke(t *testing.T) {
+	s, path := newSheetStorage(t)
+
+	acl, err := GetACL(s, path)
+	if err != nil || len(acl) != 0 {
+		t.Fatalf("GetACL of an unshared file = %v, %v; want empty", acl, err)
+	}
+
+	if err := Grant(s, path, "bob@example.com", PermissionRead); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if err := Grant(s, path, "carol@example.com", PermissionEdit); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	// Granting again replaces the earlier permission
+	if err := Grant(s, path, "bob@example.com", PermissionEdit); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	acl, err = GetACL(s, path)
+	if err != nil || acl["bob@example.com"] != PermissionEdit || acl["carol@example.com"] != PermissionEdit {
+		t.Errorf("GetACL = %v, %v; want bob and carol with edit", acl, err)
+	}
+
+	if err := Revoke(s, path, "bob@example.com"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if err := Revoke(s, path, "carol@example.com"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if exists, _ := s.ExistsItem(aclPath(path)); exists {
+		t.Error("an empty access list should not be stored")
+	}
+}
+
+func TestGrantRejectsUnknownPermission(t *testing.T) {
+	s, path := newSheetStorage(t)
+
+	if err := Grant(s, path, "bob@example.com", Permission("owner")); err == nil {
+		t.Error("Grant should reject an unknown permission")
+	}
+}
+
+func TestPermissionAllows(t *testing.T) {
+	cases := []struct {
+		have, need Permission
+		want       bool
+	}{
+		{PermissionRead, PermissionRead, true},
+		{PermissionRead, PermissionEdit, false},
+		{PermissionEdit, PermissionRead, true},
+		{PermissionEdit, PermissionEdit, true},
+		{"", PermissionRead, false},
+	}
+	for _, c := range cases {
+		if got := c.have.Allows(c.need); got != c.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", c.have, c.need, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// pathLocks serializes read-modify-write appends to the same path within
+// this process, for backends without a native append primitive
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+var appendLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+var fileLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+// LockPath takes a process-local lock on path for read-modify-write
+// sequences that span several Storage calls. Call the returned function to
+// release it.
+func LockPath(path []string) func() {
+	return fileLocks.lock(strings.Join(path, "/"))
+}
+
+func (p *pathLocks) lock(key string) func() {
+	p.mu.Lock()
+	l, ok := p.locks[key]
+	if !ok {
+		l = &pathLock{}
+		p.locks[key] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, key)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// appendLocked appends data to the file at path using GetFile/UpdateFile
+// under a per-path lock, creating the file when it doesn't exist yet
+func appendLocked(s Storage, path []string, data []byte) error {
+	unlock := appendLocks.lock(strings.Join(path, "/"))
+	defer unlock()
+
+	// Append takes no context, so neither does the read and rewrite
+	ctx := context.Background()
+	item, err := s.GetFile(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return s.CreateFile(ctx, path, string(data))
+	}
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+
+	existing, _ := item.Data.(string)
+	return s.UpdateFile(ctx, path, existing+string(data))
+}
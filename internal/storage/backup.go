@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Backup streams every item in s as a gzip-compressed tar archive. Each
+// entry is named after the item path and holds the raw serialized item, so
+// the archive can be restored into any backend.
+func Backup(s Storage, w io.Writer) error {
+	lister, ok := s.(ItemLister)
+	if !ok {
+		return fmt.Errorf("storage backend %T does not support listing items", s)
+	}
+
+	paths, err := lister.ListItems("")
+	if err != nil {
+		return fmt.Errorf("failed to list items: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	for _, path := range paths {
+		data, err := s.GetItem(path)
+		if err != nil {
+			return fmt.Errorf("failed to read item %s: %w", path, err)
+		}
+
+		header := &tar.Header{
+			Name:    path,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore reads an archive produced by Backup and writes every item back
+// into s, overwriting items that already exist.
+func Restore(s Storage, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid backup archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read entry %s: %w", header.Name, err)
+		}
+		if err := s.PutItem(header.Name, string(data)); err != nil {
+			return fmt.Errorf("failed to restore item %s: %w", header.Name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newFakeStorage()
+	for _, dir := range [][]string{{"home"}, {"home", "users"}, {"home", "alice@example.com"}} {
+		if err := src.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir failed: %v", err)
+		}
+	}
+	files := map[string]string{
+		"home/users/alice@example.com":   `{"email":"alice@example.com","password":"hash"}`,
+		"home/users/bob@example.com":     `{"email":"bob@example.com","password":"hash"}`,
+		"home/alice@example.com/budget":  "A1,B1\n1,2",
+		"home/alice@example.com/savings": "",
+	}
+	for path, data := range files {
+		if err := src.CreateFile(ctx, strings.Split(path, "/"), data); err != nil {
+			t.Fatalf("CreateFile %s failed: %v", path, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Backup(src, &buf); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	dst := newFakeStorage()
+	if err := Restore(dst, &buf); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if len(dst.items) != len(src.items) {
+		t.Fatalf("restored %d items, want %d", len(dst.items), len(src.items))
+	}
+	for path, want := range src.items {
+		if got, ok := dst.items[path]; !ok || got != want {
+			t.Errorf("item %s = %q, want %q", path, got, want)
+		}
+	}
+
+	item, err := dst.GetFile(ctx, []string{"home", "alice@example.com", "budget"})
+	if err != nil {
+		t.Fatalf("GetFile after restore failed: %v", err)
+	}
+	if item.Data != files["home/alice@example.com/budget"] {
+		t.Errorf("restored sheet data = %v", item.Data)
+	}
+}
+
+func TestRestoreRejectsGarbage(t *testing.T) {
+	if err := Restore(newFakeStorage(), bytes.NewBufferString("not an archive")); err == nil {
+		t.Fatal("expected error restoring a non-gzip stream")
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Appender is the write half of Storage.Append; Storage itself and
+// AppendBatcher both implement it
+type Appender interface {
+	Append(path []string, data []byte) error
+}
+
+// AppendBatcher buffers appends and writes them to the underlying
+// Appender in groups, one write per path, once a path has size pending
+// entries or every interval. Entries for a path are always written in the
+// order they were appended. Close flushes whatever is still buffered.
+type AppendBatcher struct {
+	dst  Appender
+	size int
+
+	mu      sync.Mutex
+	pending map[string]*pendingAppend
+	closed  bool
+
+	// flushMu serializes writes so two flushes of the same path can't
+	// reach the backend out of order
+	flushMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pendingAppend struct {
+	path    []string
+	data    []byte
+	entries int
+}
+
+// NewAppendBatcher starts a batcher in front of dst. A size of one or less
+// flushes every entry straight away; an interval of zero disables the
+// timed flush, leaving only size-triggered flushes and Close.
+func NewAppendBatcher(dst Appender, size int, interval time.Duration) *AppendBatcher {
+	b := &AppendBatcher{
+		dst:     dst,
+		size:    size,
+		pending: make(map[string]*pendingAppend),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run(interval)
+	return b
+}
+
+func (b *AppendBatcher) run(interval time.Duration) {
+	defer close(b.done)
+	if interval <= 0 {
+		<-b.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Append buffers data for path, flushing the path once it has size
+// entries waiting. After Close, appends go straight to the backend.
+func (b *AppendBatcher) Append(path []string, data []byte) error {
+	key := strings.Join(path, "/")
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return b.dst.Append(path, data)
+	}
+	p, ok := b.pending[key]
+	if !ok {
+		p = &pendingAppend{path: append([]string{}, path...)}
+		b.pending[key] = p
+	}
+	p.data = append(p.data, data...)
+	p.entries++
+	full := p.entries >= b.size
+	b.mu.Unlock()
+
+	if full {
+		return b.flushKey(key)
+	}
+	return nil
+}
+
+// Flush writes every buffered entry, returning the first error. Entries
+// that fail to write stay buffered for the next flush.
+func (b *AppendBatcher) Flush() error {
+	b.mu.Lock()
+	keys := make([]string, 0, len(b.pending))
+	for key := range b.pending {
+		keys = append(keys, key)
+	}
+	b.mu.Unlock()
+
+	var firstErr error
+	for _, key := range keys {
+		if err := b.flushKey(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (b *AppendBatcher) flushKey(key string) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	p, ok := b.pending[key]
+	delete(b.pending, key)
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := b.dst.Append(p.path, p.data); err != nil {
+		// Put the batch back ahead of anything appended meanwhile
+		b.mu.Lock()
+		if later, ok := b.pending[key]; ok {
+			p.data = append(p.data, later.data...)
+			p.entries += later.entries
+		}
+		b.pending[key] = p
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the timed flush and writes everything still buffered. It
+// should run on shutdown so no entries are lost.
+func (b *AppendBatcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+	<-b.done
+	return b.Flush()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingAppender keeps every write it receives, in order
+type recordingAppender struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (r *recordingAppender) Append(path []string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, strings.Join(path, "/")+": "+string(data))
+	return nil
+}
+
+func (r *recordingAppender) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.writes...)
+}
+
+func TestAppendBatcherFlushesOnSize(t *testing.T) {
+	dst := &recordingAppender{}
+	b := NewAppendBatcher(dst, 3, 0)
+	defer b.Close()
+
+	path := []string{"home", "alice", "log"}
+	for _, entry := range []string{"a\n", "b\n"} {
+		if err := b.Append(path, []byte(entry)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if writes := dst.snapshot(); len(writes) != 0 {
+		t.Fatalf("flushed before reaching the batch size: %q", writes)
+	}
+
+	b.Append(path, []byte("c\n"))
+	writes := dst.snapshot()
+	if len(writes) != 1 || writes[0] != "home/alice/log: a\nb\nc\n" {
+		t.Errorf("writes = %q, want one batched write in order", writes)
+	}
+}
+
+func TestAppendBatcherFlushesOnInterval(t *testing.T) {
+	dst := &recordingAppender{}
+	b := NewAppendBatcher(dst, 100, 10*time.Millisecond)
+	defer b.Close()
+
+	b.Append([]string{"home", "alice", "log"}, []byte("a\n"))
+	b.Append([]string{"home", "alice", "log"}, []byte("b\n"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(dst.snapshot()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("entries were not flushed on the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if writes := dst.snapshot(); writes[0] != "home/alice/log: a\nb\n" {
+		t.Errorf("writes = %q", writes)
+	}
+}
+
+func TestAppendBatcherFlushesOnClose(t *testing.T) {
+	dst := &recordingAppender{}
+	b := NewAppendBatcher(dst, 100, time.Hour)
+
+	b.Append([]string{"home", "alice", "log"}, []byte("a\n"))
+	b.Append([]string{"home", "bob", "log"}, []byte("b\n"))
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	writes := dst.snapshot()
+	if len(writes) != 2 {
+		t.Fatalf("writes = %q, want both paths flushed on Close", writes)
+	}
+
+	// Appends after Close aren't buffered where nothing would flush them
+	b.Append([]string{"home", "alice", "log"}, []byte("late\n"))
+	if writes := dst.snapshot(); len(writes) != 3 {
+		t.Errorf("append after Close was not written through: %q", writes)
+	}
+}
+
+func TestChangeLogBatchedPreservesOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	if err := s.CreateDir(ctx, []string{"home"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateDir(ctx, []string{"home", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	sheet := []string{"home", "alice", "sheet1"}
+
+	log := NewChangeLog(4, time.Hour)
+	var want []string
+	for i := 0; i < 10; i++ {
+		entry := fmt.Sprintf(`{"n":%d}`, i)
+		want = append(want, entry)
+		if err := log.Record(s, sheet, entry); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got, err := log.Entries(ctx, s, sheet)
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// CachedStorage serves GetFile from an in-memory LRU in front of another
+// Storage, so hot items such as user records aren't read from the backend
+// on every request. Entries live for the TTL and the least recently used
+// is dropped beyond the maximum. Writes through the wrapper invalidate
+// what they change, including the parent directory's listing; writes by
+// other instances sharing the backend are only seen once the TTL expires.
+type CachedStorage struct {
+	s          Storage
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+	// gen counts invalidations, so a read racing a write doesn't cache
+	// what it fetched before the write
+	gen uint64
+}
+
+type cacheEntry struct {
+	key     string
+	item    *models.StorageItem
+	expires time.Time
+}
+
+// NewCachedStorage wraps s with a cache of at most maxEntries files, each
+// kept for ttl
+func NewCachedStorage(s Storage, ttl time.Duration, maxEntries int) *CachedStorage {
+	return &CachedStorage{
+		s:          s,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *CachedStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := strings.Join(path, "/")
+	item, gen, ok := c.lookup(key)
+	if ok {
+		return copyItem(item), nil
+	}
+
+	item, err := c.s.GetFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, copyItem(item), gen)
+	return item, nil
+}
+
+// lookup returns the live entry for key, or the generation a fetch of it
+// must be stored under
+func (c *CachedStorage) lookup(key string) (*models.StorageItem, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, c.gen, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.item, c.gen, true
+}
+
+// store caches item under key unless something was invalidated since gen
+func (c *CachedStorage) store(key string, item *models.StorageItem, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen || c.maxEntries <= 0 {
+		return
+	}
+	entry := &cacheEntry{key: key, item: item, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate drops the entries for keys, and for everything under them
+// when tree is set
+func (c *CachedStorage) invalidate(tree bool, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+		if !tree {
+			continue
+		}
+		for other, elem := range c.entries {
+			if strings.HasPrefix(other, key+"/") {
+				c.lru.Remove(elem)
+				delete(c.entries, other)
+			}
+		}
+	}
+}
+
+// invalidatePath drops path and its parent, whose listing names it
+func (c *CachedStorage) invalidatePath(path []string, tree bool) {
+	keys := []string{strings.Join(path, "/")}
+	if len(path) > 1 {
+		keys = append(keys, strings.Join(path[:len(path)-1], "/"))
+	}
+	c.invalidate(tree, keys...)
+}
+
+func (c *CachedStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	defer c.invalidatePath(path, false)
+	return c.s.CreateFile(ctx, path, data)
+}
+
+func (c *CachedStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	defer c.invalidatePath(path, false)
+	return c.s.UpdateFile(ctx, path, data)
+}
+
+func (c *CachedStorage) DeleteFile(ctx context.Context, path []string) error {
+	defer c.invalidatePath(path, false)
+	return c.s.DeleteFile(ctx, path)
+}
+
+func (c *CachedStorage) Append(path []string, data []byte) error {
+	defer c.invalidatePath(path, false)
+	return c.s.Append(path, data)
+}
+
+func (c *CachedStorage) CreateDir(ctx context.Context, path []string) error {
+	defer c.invalidatePath(path, false)
+	return c.s.CreateDir(ctx, path)
+}
+
+func (c *CachedStorage) DeleteDir(path []string, recursive bool) error {
+	defer c.invalidatePath(path, true)
+	return c.s.DeleteDir(path, recursive)
+}
+
+func (c *CachedStorage) List(path []string) ([]string, error) {
+	return c.s.List(path)
+}
+
+// The item operations write the same keys the file operations read, as
+// every backend joins paths with "/", so their writes invalidate too
+
+func (c *CachedStorage) PutItem(path string, data string, bucket ...string) error {
+	defer c.invalidate(false, path)
+	return c.s.PutItem(path, data, bucket...)
+}
+
+func (c *CachedStorage) GetItem(path string, bucket ...string) (string, error) {
+	return c.s.GetItem(path, bucket...)
+}
+
+func (c *CachedStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	return c.s.ExistsItem(path, bucket...)
+}
+
+func (c *CachedStorage) DeleteItem(path string, bucket ...string) error {
+	defer c.invalidate(false, path)
+	return c.s.DeleteItem(path, bucket...)
+}
+
+// GetFileVersion implements Versioner by reading past the cache, as a
+// cached item may be older than the version the backend would report
+func (c *CachedStorage) GetFileVersion(ctx context.Context, path []string) (*models.StorageItem, string, error) {
+	return GetFileVersion(ctx, c.s, path)
+}
+
+func (c *CachedStorage) UpdateFileCAS(ctx context.Context, path []string, expectedVersion string, data string) (string, error) {
+	defer c.invalidatePath(path, false)
+	return UpdateFileCAS(ctx, c.s, path, expectedVersion, data)
+}
+
+// SwapItem implements Swapper so CompareAndSwap stops here on its way to
+// the backend, dropping the key from the cache once the swap lands
+func (c *CachedStorage) SwapItem(path, old, data string) (bool, error) {
+	swapped, err := CompareAndSwap(c.s, path, old, data)
+	if swapped {
+		c.invalidate(false, path)
+	}
+	return swapped, err
+}
+
+// Unwrap returns the Storage behind the cache
+func (c *CachedStorage) Unwrap() Storage {
+	return c.s
+}
+
+// uncached strips the decorators above s's CachedStorage, if it has one,
+// so writes made outside a request still invalidate the cache
+func uncached(s Storage) Storage {
+	for {
+		if _, ok := s.(*CachedStorage); ok {
+			return s
+		}
+		w, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return s
+		}
+		s = w.Unwrap()
+	}
+}
+
+// copyItem copies item deeply enough that callers changing the copy, its
+// path or a decoded listing don't change the cached item
+func copyItem(item *models.StorageItem) *models.StorageItem {
+	clone := *item
+	clone.Path = append([]string(nil), item.Path...)
+	clone.Data = copyData(item.Data)
+	return &clone
+}
+
+func copyData(data interface{}) interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = copyData(elem)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			out[key] = copyData(elem)
+		}
+		return out
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return data
+	}
+}
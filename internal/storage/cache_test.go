@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// countingStorage counts the GetFile calls that reach the backend
+type countingStorage struct {
+	*MemoryStorage
+	gets int
+}
+
+func (s *countingStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	s.gets++
+	return s.MemoryStorage.GetFile(ctx, path)
+}
+
+func newTestCache(t *testing.T, ttl time.Duration, maxEntries int) (*CachedStorage, *countingStorage) {
+	inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	if err := inner.CreateDir(context.Background(), []string{"home"}); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	return NewCachedStorage(inner, ttl, maxEntries), inner
+}
+
+func TestCachedStorageConformance(t *testing.T) {
+	cached := func() Storage { return NewCachedStorage(NewMemoryStorage(), time.Minute, 100) }
+	t.Run("append", func(t *testing.T) { runAppendConformance(t, cached()) })
+	t.Run("delete dir", func(t *testing.T) { runDeleteDirConformance(t, cached()) })
+	t.Run("list", func(t *testing.T) { runListConformance(t, cached()) })
+	t.Run("cancel", func(t *testing.T) { runCancelConformance(t, cached()) })
+	t.Run("cas", func(t *testing.T) { runCASConformance(t, cached()) })
+}
+
+func TestCachedStorageHit(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestCache(t, time.Minute, 10)
+	path := []string{"home", "alice"}
+	if err := c.CreateFile(ctx, path, "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		item, err := c.GetFile(ctx, path)
+		if err != nil || item.Data != "data" {
+			t.Fatalf("GetFile = %v, %v; want data", item, err)
+		}
+		// Changing what was handed out leaves the cached item alone
+		item.Data = "changed"
+	}
+	if inner.gets != 1 {
+		t.Errorf("backend read %d times, want once", inner.gets)
+	}
+}
+
+func TestCachedStorageExpires(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestCache(t, time.Minute, 10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	path := []string{"home", "alice"}
+	if err := c.CreateFile(ctx, path, "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	c.GetFile(ctx, path)
+	now = now.Add(59 * time.Second)
+	c.GetFile(ctx, path)
+	if inner.gets != 1 {
+		t.Fatalf("backend read %d times within the TTL, want once", inner.gets)
+	}
+
+	// A write straight to the backend shows once the entry expires
+	if err := inner.UpdateFile(ctx, path, "elsewhere"); err != nil {
+		t.Fatalf("UpdateFile failed: %v", err)
+	}
+	now = now.Add(time.Second)
+	item, err := c.GetFile(ctx, path)
+	if err != nil || item.Data != "elsewhere" {
+		t.Errorf("GetFile after the TTL = %v, %v; want the backend's data", item, err)
+	}
+	if inner.gets != 2 {
+		t.Errorf("backend read %d times, want a refetch after the TTL", inner.gets)
+	}
+}
+
+func TestCachedStorageWritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, time.Minute, 10)
+	path := []string{"home", "alice"}
+	if err := c.CreateFile(ctx, path, "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	c.GetFile(ctx, path)
+	c.GetFile(ctx, []string{"home"})
+
+	if err := c.UpdateFile(ctx, path, "updated"); err != nil {
+		t.Fatalf("UpdateFile failed: %v", err)
+	}
+	if item, err := c.GetFile(ctx, path); err != nil || item.Data != "updated" {
+		t.Errorf("GetFile after UpdateFile = %v, %v; want updated", item, err)
+	}
+	_, version, err := GetFileVersion(ctx, c, path)
+	if err != nil {
+		t.Fatalf("GetFileVersion failed: %v", err)
+	}
+	if _, err := UpdateFileCAS(ctx, c, path, version, "swapped"); err != nil {
+		t.Fatalf("UpdateFileCAS failed: %v", err)
+	}
+	if item, err := c.GetFile(ctx, path); err != nil || item.Data != "swapped" {
+		t.Errorf("GetFile after UpdateFileCAS = %v, %v; want swapped", item, err)
+	}
+
+	// Creating a file changes its directory's listing
+	if err := c.CreateFile(ctx, []string{"home", "bob"}, "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	dir, err := c.GetFile(ctx, []string{"home"})
+	if err != nil {
+		t.Fatalf("GetFile of the directory failed: %v", err)
+	}
+	if names, _ := dir.Data.([]interface{}); len(names) != 2 {
+		t.Errorf("listing after CreateFile = %v, want both files", dir.Data)
+	}
+
+	if err := c.DeleteFile(ctx, path); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if _, err := c.GetFile(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile after DeleteFile: err = %v, want ErrNotFound", err)
+	}
+
+	c.GetFile(ctx, []string{"home", "bob"})
+	if err := c.DeleteDir([]string{"home"}, true); err != nil {
+		t.Fatalf("DeleteDir failed: %v", err)
+	}
+	if _, err := c.GetFile(ctx, []string{"home", "bob"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile under a deleted directory: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCachedStorageEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestCache(t, time.Minute, 2)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := c.CreateFile(ctx, []string{"home", name}, name); err != nil {
+			t.Fatalf("CreateFile failed: %v", err)
+		}
+	}
+
+	c.GetFile(ctx, []string{"home", "a"})
+	c.GetFile(ctx, []string{"home", "b"})
+	c.GetFile(ctx, []string{"home", "a"}) // b is now the oldest
+	c.GetFile(ctx, []string{"home", "c"})
+	inner.gets = 0
+
+	c.GetFile(ctx, []string{"home", "a"})
+	c.GetFile(ctx, []string{"home", "c"})
+	if inner.gets != 0 {
+		t.Errorf("backend read %d times for cached files, want none", inner.gets)
+	}
+	c.GetFile(ctx, []string{"home", "b"})
+	if inner.gets != 1 {
+		t.Errorf("backend read %d times for the evicted file, want once", inner.gets)
+	}
+}
+
+func TestCachedStorageSwapInvalidates(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, time.Minute, 10)
+	path := []string{"home", "alice"}
+	if err := c.CreateFile(ctx, path, "before"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if _, err := c.GetFile(ctx, path); err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+
+	old, _ := c.GetItem("home/alice")
+	swapped := models.NewStorageItem(path, "file", "after")
+	data, _ := swapped.ToJSON()
+	if ok, err := CompareAndSwap(c, "home/alice", old, data); !ok || err != nil {
+		t.Fatalf("CompareAndSwap: ok=%v, err=%v", ok, err)
+	}
+	if item, err := c.GetFile(ctx, path); err != nil || item.Data != "after" {
+		t.Errorf("GetFile after a swap = %v, %v; want the swapped data, not the cached item", item, err)
+	}
+}
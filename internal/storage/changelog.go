@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangesDir is the directory, alongside a file, holding its change log
+const ChangesDir = ".changes"
+
+// changeLogPath returns where the change log of the file at path is kept,
+// e.g. home/u/sheet1 -> home/u/.changes/sheet1
+func changeLogPath(path []string) []string {
+	dir := append([]string{}, path[:len(path)-1]...)
+	return append(dir, ChangesDir, path[len(path)-1])
+}
+
+// ChangeLog records one line per change made to a file, in whichever
+// Storage the file lives in. Entries can be batched, in which case Close
+// must be called on shutdown to write out whatever is still buffered.
+type ChangeLog struct {
+	batchSize int
+	interval  time.Duration
+
+	mu       sync.Mutex
+	batchers map[Storage]*AppendBatcher
+}
+
+// NewChangeLog creates a change log. With batchSize above one, entries are
+// buffered and written batchSize at a time or every interval, whichever
+// comes first.
+func NewChangeLog(batchSize int, interval time.Duration) *ChangeLog {
+	return &ChangeLog{
+		batchSize: batchSize,
+		interval:  interval,
+		batchers:  make(map[Storage]*AppendBatcher),
+	}
+}
+
+// Record appends entry as one line to the change log of the file at path
+// in s
+func (l *ChangeLog) Record(s Storage, path []string, entry string) error {
+	line := []byte(strings.TrimRight(entry, "\n") + "\n")
+	return l.writer(s).Append(changeLogPath(path), line)
+}
+
+// writer returns the batcher for s, or s itself when batching is off
+func (l *ChangeLog) writer(s Storage) Appender {
+	if l.batchSize <= 1 {
+		return changeLogWriter{s}
+	}
+	// Key by the backend itself: request-scoped wrappers of the same
+	// backend must share one batcher
+	backend := Unwrap(s)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.batchers[backend]
+	if !ok {
+		b = NewAppendBatcher(changeLogWriter{uncached(s)}, l.batchSize, l.interval)
+		l.batchers[backend] = b
+	}
+	return b
+}
+
+// Entries returns the change log lines of the file at path in s that have
+// been written so far, oldest first
+func (l *ChangeLog) Entries(ctx context.Context, s Storage, path []string) ([]string, error) {
+	item, err := s.GetFile(ctx, changeLogPath(path))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+	if data == "" {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(data, "\n"), "\n"), nil
+}
+
+// Flush writes out buffered entries
+func (l *ChangeLog) Flush() error {
+	return l.each((*AppendBatcher).Flush)
+}
+
+// Close flushes buffered entries and stops the timed flushes
+func (l *ChangeLog) Close() error {
+	return l.each((*AppendBatcher).Close)
+}
+
+func (l *ChangeLog) each(fn func(*AppendBatcher) error) error {
+	l.mu.Lock()
+	batchers := make([]*AppendBatcher, 0, len(l.batchers))
+	for _, b := range l.batchers {
+		batchers = append(batchers, b)
+	}
+	l.mu.Unlock()
+
+	var firstErr error
+	for _, b := range batchers {
+		if err := fn(b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// changeLogWriter appends to a change log, creating the change log
+// directory on first use
+type changeLogWriter struct {
+	s Storage
+}
+
+func (w changeLogWriter) Append(path []string, data []byte) error {
+	if err := ensureDirs(context.Background(), w.s, path[:len(path)-1], len(path)-1); err != nil {
+		return err
+	}
+	return w.s.Append(path, data)
+}
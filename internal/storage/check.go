@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// QuarantinePrefix is the item path prefix corrupt records are moved under
+const QuarantinePrefix = "quarantine"
+
+// CheckIssue describes a single record that failed validation
+type CheckIssue struct {
+	Path        string
+	Err         error
+	Quarantined bool
+}
+
+// CheckReport summarizes a consistency check over a directory
+type CheckReport struct {
+	Scanned int
+	Issues  []CheckIssue
+}
+
+// OK reports whether the check found no corrupt records
+func (r *CheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Check scans every file listed in dir, runs validate over each one and
+// reports the entries that fail. When quarantine is set, corrupt entries
+// are copied verbatim under QuarantinePrefix and removed from dir.
+func Check(ctx context.Context, s Storage, dir []string, validate func(item *models.StorageItem) error, quarantine bool) (*CheckReport, error) {
+	dirItem, err := s.GetFile(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", strings.Join(dir, "/"), err)
+	}
+
+	var names []string
+	if entries, ok := dirItem.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	report := &CheckReport{}
+	for _, name := range names {
+		path := append(append([]string{}, dir...), name)
+		spath := strings.Join(path, "/")
+		report.Scanned++
+
+		item, err := s.GetFile(ctx, path)
+		if err == nil {
+			err = validate(item)
+		}
+		if err == nil {
+			continue
+		}
+
+		issue := CheckIssue{Path: spath, Err: err}
+		if quarantine {
+			if qerr := quarantineItem(ctx, s, path); qerr != nil {
+				issue.Err = fmt.Errorf("%v (quarantine failed: %v)", err, qerr)
+			} else {
+				issue.Quarantined = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return report, nil
+}
+
+func quarantineItem(ctx context.Context, s Storage, path []string) error {
+	spath := strings.Join(path, "/")
+	raw, err := s.GetItem(spath)
+	if err != nil {
+		return err
+	}
+	if err := s.PutItem(QuarantinePrefix+"/"+spath, raw); err != nil {
+		return err
+	}
+
+	// DeleteFile keeps the parent listing in sync; fall back to the raw
+	// item when the record is too broken to be parsed as a file
+	if err := s.DeleteFile(ctx, path); err != nil {
+		return s.DeleteItem(spath)
+	}
+	return nil
+}
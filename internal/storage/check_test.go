@@ -0,0 +1,72 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedUsers(t *testing.T, store storage.Storage) {
+	dir := models.NewStorageItem([]string{"home", "users"}, "dir", []string{"good@example.com", "bad@example.com"})
+	dirJSON, _ := dir.ToJSON()
+	require.NoError(t, store.PutItem("home/users", dirJSON))
+
+	user, err := models.NewUser("good@example.com", "secret")
+	require.NoError(t, err)
+	userJSON, _ := user.ToJSON()
+	good := models.NewStorageItem([]string{"home", "users", "good@example.com"}, "file", userJSON)
+	goodJSON, _ := good.ToJSON()
+	require.NoError(t, store.PutItem("home/users/good@example.com", goodJSON))
+
+	bad := models.NewStorageItem([]string{"home", "users", "bad@example.com"}, "file", `{"email":"bad@example.com",`)
+	badJSON, _ := bad.ToJSON()
+	require.NoError(t, store.PutItem("home/users/bad@example.com", badJSON))
+}
+
+func validateUser(item *models.StorageItem) error {
+	dataStr, ok := item.Data.(string)
+	if !ok {
+		return fmt.Errorf("invalid user data format")
+	}
+	_, err := models.UserFromJSON(dataStr)
+	return err
+}
+
+func TestCheckReportsCorruptUser(t *testing.T) {
+	store := testutils.NewMockStorage()
+	seedUsers(t, store)
+
+	report, err := storage.Check(context.Background(), store, []string{"home", "users"}, validateUser, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Scanned)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, "home/users/bad@example.com", report.Issues[0].Path)
+	assert.False(t, report.Issues[0].Quarantined)
+
+	exists, _ := store.ExistsItem("home/users/bad@example.com")
+	assert.True(t, exists, "check without quarantine must not modify storage")
+}
+
+func TestCheckQuarantinesCorruptUser(t *testing.T) {
+	store := testutils.NewMockStorage()
+	seedUsers(t, store)
+
+	report, err := storage.Check(context.Background(), store, []string{"home", "users"}, validateUser, true)
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	assert.True(t, report.Issues[0].Quarantined)
+
+	exists, _ := store.ExistsItem("home/users/bad@example.com")
+	assert.False(t, exists)
+	exists, _ = store.ExistsItem(storage.QuarantinePrefix + "/home/users/bad@example.com")
+	assert.True(t, exists)
+	exists, _ = store.ExistsItem("home/users/good@example.com")
+	assert.True(t, exists)
+}
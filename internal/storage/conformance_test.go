@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// fakeStorage is a map-backed Storage with the same item semantics as the
+// real backends: every value is a serialized StorageItem and files are
+// listed in their parent directory.
+type fakeStorage struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{items: make(map[string]string)}
+}
+
+func (f *fakeStorage) pathToString(path []string) string {
+	return strings.Join(path, "/")
+}
+
+func (f *fakeStorage) PutItem(path string, data string, bucket ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[path] = data
+	return nil
+}
+
+func (f *fakeStorage) GetItem(path string, bucket ...string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.items[path]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return data, nil
+}
+
+func (f *fakeStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.items[path]
+	return ok, nil
+}
+
+func (f *fakeStorage) DeleteItem(path string, bucket ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, path)
+	return nil
+}
+
+func (f *fakeStorage) CreateDir(ctx context.Context, path []string) error {
+	dirJSON, err := models.NewStorageItem(path, "dir", []string{}).ToJSON()
+	if err != nil {
+		return err
+	}
+	return f.PutItem(f.pathToString(path), dirJSON)
+}
+
+func (f *fakeStorage) DeleteDir(path []string, recursive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prefix := f.pathToString(path)
+	if _, ok := f.items[prefix]; !ok {
+		return ErrNotFound
+	}
+	var contents []string
+	for key := range f.items {
+		if strings.HasPrefix(key, prefix+"/") {
+			contents = append(contents, key)
+		}
+	}
+	if len(contents) > 0 && !recursive {
+		return ErrDirNotEmpty
+	}
+	for _, key := range append(contents, prefix) {
+		delete(f.items, key)
+	}
+	return nil
+}
+
+func (f *fakeStorage) List(path []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dir := f.pathToString(path)
+	if _, ok := f.items[dir]; !ok {
+		return nil, ErrNotFound
+	}
+	var paths []string
+	for key := range f.items {
+		paths = append(paths, key)
+	}
+	return childNames(dir, paths), nil
+}
+
+func (f *fakeStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	data, err := f.GetItem(f.pathToString(path))
+	if err != nil {
+		return nil, err
+	}
+	return models.StorageItemFromJSON(data)
+}
+
+func (f *fakeStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	parentPath := path[:len(path)-1]
+	parent, err := f.GetFile(ctx, parentPath)
+	if err != nil {
+		return fmt.Errorf("parent directory does not exist")
+	}
+	if exists, _ := f.ExistsItem(f.pathToString(path)); exists {
+		return fmt.Errorf("file already exists")
+	}
+
+	fileJSON, err := models.NewStorageItem(path, "file", data).ToJSON()
+	if err != nil {
+		return err
+	}
+	if err := f.PutItem(f.pathToString(path), fileJSON); err != nil {
+		return err
+	}
+
+	var files []string
+	if entries, ok := parent.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				files = append(files, name)
+			}
+		}
+	}
+	parent.Data = append(files, path[len(path)-1])
+	parentJSON, err := parent.ToJSON()
+	if err != nil {
+		return err
+	}
+	return f.PutItem(f.pathToString(parentPath), parentJSON)
+}
+
+func (f *fakeStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	item, err := f.GetFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	item.Data = data
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	return f.PutItem(f.pathToString(path), itemJSON)
+}
+
+func (f *fakeStorage) DeleteFile(ctx context.Context, path []string) error {
+	if _, err := f.GetFile(ctx, path); err != nil {
+		return err
+	}
+	return f.DeleteItem(f.pathToString(path))
+}
+
+func (f *fakeStorage) Append(path []string, data []byte) error {
+	return appendLocked(f, path, data)
+}
+
+func (f *fakeStorage) ListItems(prefix string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for path := range f.items {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// runAppendConformance checks the Append contract against any backend
+func runAppendConformance(t *testing.T, s Storage) {
+	ctx := context.Background()
+	dir := []string{"logs"}
+	if err := s.CreateDir(ctx, dir); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	path := []string{"logs", "changes.log"}
+
+	// Appending to a missing file creates it
+	if err := s.Append(path, []byte("start\n")); err != nil {
+		t.Fatalf("Append to missing file failed: %v", err)
+	}
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := s.Append(path, []byte(fmt.Sprintf("%d:%d\n", w, i))); err != nil {
+					t.Errorf("Append failed: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	item, err := s.GetFile(ctx, path)
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	content, _ := item.Data.(string)
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	if len(lines) != writers*perWriter+1 || lines[0] != "start" {
+		t.Fatalf("expected %d lines starting with the first append, got %d", writers*perWriter+1, len(lines))
+	}
+
+	next := make(map[int]int)
+	for _, line := range lines[1:] {
+		var w, i int
+		if _, err := fmt.Sscanf(line, "%d:%d", &w, &i); err != nil {
+			t.Fatalf("corrupt line %q", line)
+		}
+		if i != next[w] {
+			t.Fatalf("writer %d: got entry %d, want %d", w, i, next[w])
+		}
+		next[w]++
+	}
+}
+
+// runCancelConformance checks that the file operations give up with the
+// context's error once it is cancelled, leaving the stored data alone
+func runCancelConformance(t *testing.T, s Storage) {
+	path := []string{"home", "alice", "sheet"}
+	if err := s.CreateFile(context.Background(), path, "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.CreateDir(ctx, []string{"home", "bob"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateDir: err = %v, want context.Canceled", err)
+	}
+	if err := s.CreateFile(ctx, []string{"home", "alice", "other"}, "data"); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateFile: err = %v, want context.Canceled", err)
+	}
+	if _, err := s.GetFile(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetFile: err = %v, want context.Canceled", err)
+	}
+	if err := s.UpdateFile(ctx, path, "changed"); !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateFile: err = %v, want context.Canceled", err)
+	}
+	if err := s.DeleteFile(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteFile: err = %v, want context.Canceled", err)
+	}
+
+	item, err := s.GetFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("GetFile after the cancelled calls failed: %v", err)
+	}
+	if data, _ := item.Data.(string); data != "data" {
+		t.Errorf("data = %q after the cancelled calls, want it untouched", data)
+	}
+	if _, err := s.GetFile(context.Background(), []string{"home", "alice", "other"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancelled CreateFile left a file behind: err = %v", err)
+	}
+}
+
+// runCASConformance checks UpdateFileCAS against any backend: of writers
+// starting from the same version only one gets through, and the others,
+// holding a stale version, fail without touching the file
+func runCASConformance(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for _, dir := range [][]string{{"home"}, {"home", "alice"}} {
+		if err := s.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir %v failed: %v", dir, err)
+		}
+	}
+	path := []string{"home", "alice", "sheet"}
+	if err := s.CreateFile(ctx, path, "v0"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	_, version, err := GetFileVersion(ctx, s, path)
+	if err != nil {
+		t.Fatalf("GetFileVersion failed: %v", err)
+	}
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	versions := make([]string, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			versions[w], errs[w] = UpdateFileCAS(ctx, s, path, version, fmt.Sprintf("v%d", w+1))
+		}(w)
+	}
+	wg.Wait()
+
+	winner := -1
+	for w, err := range errs {
+		switch {
+		case err == nil && winner >= 0:
+			t.Fatalf("writers %d and %d both updated from the same version", winner, w)
+		case err == nil:
+			winner = w
+		case !errors.Is(err, ErrVersionConflict):
+			t.Errorf("writer %d: err = %v, want ErrVersionConflict", w, err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("no writer got through")
+	}
+
+	item, current, err := GetFileVersion(ctx, s, path)
+	if err != nil {
+		t.Fatalf("GetFileVersion failed: %v", err)
+	}
+	if want := fmt.Sprintf("v%d", winner+1); item.Data != want {
+		t.Errorf("data = %v, want the winner's %s", item.Data, want)
+	}
+	if current != versions[winner] || current == version {
+		t.Errorf("version = %q, want the winner's new version %q", current, versions[winner])
+	}
+
+	// The stale version stays stale, the current one goes through
+	if _, err := UpdateFileCAS(ctx, s, path, version, "late"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale writer: err = %v, want ErrVersionConflict", err)
+	}
+	if _, err := UpdateFileCAS(ctx, s, path, current, "next"); err != nil {
+		t.Errorf("UpdateFileCAS with the current version failed: %v", err)
+	}
+	if _, err := UpdateFileCAS(ctx, s, []string{"home", "alice", "missing"}, current, "data"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing file: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAppendConformanceLockedFallback(t *testing.T) {
+	runAppendConformance(t, newFakeStorage())
+}
+
+// runDeleteDirConformance checks the DeleteDir contract against any backend
+func runDeleteDirConformance(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for _, dir := range [][]string{{"home"}, {"home", "a"}, {"home", "a", "sub"}, {"home", "ab"}, {"home", "empty"}} {
+		if err := s.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir(ctx, %v) failed: %v", dir, err)
+		}
+	}
+	for _, path := range [][]string{{"home", "a", "sheet"}, {"home", "a", "sub", "deep"}, {"home", "ab", "neighbour"}} {
+		if err := s.CreateFile(ctx, path, "data"); err != nil {
+			t.Fatalf("CreateFile(ctx, %v) failed: %v", path, err)
+		}
+	}
+	exists := func(path string) bool {
+		ok, err := s.ExistsItem(path)
+		if err != nil {
+			t.Fatalf("ExistsItem(%s) failed: %v", path, err)
+		}
+		return ok
+	}
+
+	if err := s.DeleteDir([]string{"home", "missing"}, true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a missing directory: err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteDir([]string{"home", "a"}, false); !errors.Is(err, ErrDirNotEmpty) {
+		t.Errorf("non-recursive delete of a non-empty directory: err = %v, want ErrDirNotEmpty", err)
+	}
+	if !exists("home/a") || !exists("home/a/sheet") {
+		t.Error("a refused delete must leave the directory intact")
+	}
+
+	if err := s.DeleteDir([]string{"home", "empty"}, false); err != nil {
+		t.Errorf("non-recursive delete of an empty directory failed: %v", err)
+	}
+	if exists("home/empty") {
+		t.Error("the empty directory should be gone")
+	}
+
+	if err := s.DeleteDir([]string{"home", "a"}, true); err != nil {
+		t.Fatalf("recursive delete failed: %v", err)
+	}
+	for _, path := range []string{"home/a", "home/a/sheet", "home/a/sub", "home/a/sub/deep"} {
+		if exists(path) {
+			t.Errorf("%s should have been deleted", path)
+		}
+	}
+	if !exists("home/ab") || !exists("home/ab/neighbour") {
+		t.Error("a sibling sharing the name as a prefix must be left alone")
+	}
+}
+
+func TestDeleteDirConformance(t *testing.T) {
+	runDeleteDirConformance(t, newFakeStorage())
+}
+
+// runListConformance checks the List contract against any backend
+func runListConformance(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for _, dir := range [][]string{{"home"}, {"home", "empty"}, {"home", "full"}, {"home", "full", "sub"}, {"home", "fullish"}} {
+		if err := s.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir(ctx, %v) failed: %v", dir, err)
+		}
+	}
+	for _, path := range [][]string{{"home", "full", "zeta"}, {"home", "full", "alpha"}, {"home", "full", "mid"}, {"home", "full", "sub", "deep"}, {"home", "fullish", "other"}} {
+		if err := s.CreateFile(ctx, path, "data"); err != nil {
+			t.Fatalf("CreateFile(ctx, %v) failed: %v", path, err)
+		}
+	}
+
+	names, err := s.List([]string{"home", "empty"})
+	if err != nil || len(names) != 0 {
+		t.Errorf("List of an empty directory = %v, %v; want no names", names, err)
+	}
+
+	// Subdirectories are listed but not their contents, nor a sibling
+	// sharing the name as a prefix
+	names, err = s.List([]string{"home", "full"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"alpha", "mid", "sub", "zeta"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", names, want)
+	}
+
+	if _, err := s.List([]string{"home", "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("List of a missing directory: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListConformance(t *testing.T) {
+	runListConformance(t, newFakeStorage())
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotDurable is returned when a backend cannot confirm that a write has
+// been replicated before acknowledging it
+var ErrNotDurable = errors.New("durable writes are not available")
+
+// DurableStorer is implemented by backends that can hold writes until
+// they are acknowledged by their replicas
+type DurableStorer interface {
+	// Durable returns a view of the backend whose writes only return
+	// once the data has been replicated
+	Durable() (Storage, error)
+}
+
+// Durable returns a view of s whose writes wait for replication. Plain
+// reads go through unchanged, so callers can pick per operation whether
+// to write through s or through the durable view.
+func Durable(s Storage) (Storage, error) {
+	storer, ok := s.(DurableStorer)
+	if !ok {
+		return nil, fmt.Errorf("%w: backend %T cannot confirm replication", ErrNotDurable, s)
+	}
+	return storer.Durable()
+}
+
+// CreateFileDurable creates a file and only returns once the write has
+// been replicated
+func CreateFileDurable(ctx context.Context, s Storage, path []string, data string) error {
+	durable, err := Durable(s)
+	if err != nil {
+		return err
+	}
+	return durable.CreateFile(ctx, path, data)
+}
+
+// UpdateFileDurable updates a file and only returns once the write has
+// been replicated
+func UpdateFileDurable(ctx context.Context, s Storage, path []string, data string) error {
+	durable, err := Durable(s)
+	if err != nil {
+		return err
+	}
+	return durable.UpdateFile(ctx, path, data)
+}
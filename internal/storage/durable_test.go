@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoDurableRequestsMajorityWriteConcern(t *testing.T) {
+	// Connect does not dial, so no server is needed to inspect the options
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("mongo.Connect failed: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	store := &MongoStorage{client: client, database: client.Database("touchcalc")}
+	durable, err := store.Durable()
+	if err != nil {
+		t.Fatalf("Durable failed: %v", err)
+	}
+
+	view, ok := durable.(*MongoStorage)
+	if !ok {
+		t.Fatalf("Durable returned %T, want *MongoStorage", durable)
+	}
+	wc := view.database.WriteConcern()
+	if wc == nil || wc.W != "majority" {
+		t.Errorf("durable write concern = %+v, want w=majority", wc)
+	}
+	if view.database.Name() != "touchcalc" {
+		t.Errorf("durable view uses database %q", view.database.Name())
+	}
+	if wc := store.database.WriteConcern(); wc != nil && wc.W == "majority" {
+		t.Error("Durable must not change the write concern of the original store")
+	}
+}
+
+// semiSyncDriver answers the semi-sync status query with a fixed value
+type semiSyncDriver struct {
+	mu     sync.Mutex
+	status string
+}
+
+func (d *semiSyncDriver) set(status string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status = status
+}
+
+func (d *semiSyncDriver) Open(name string) (driver.Conn, error) {
+	return semiSyncConn{d}, nil
+}
+
+type semiSyncConn struct {
+	d *semiSyncDriver
+}
+
+func (c semiSyncConn) Prepare(query string) (driver.Stmt, error) {
+	return semiSyncStmt{c.d}, nil
+}
+
+func (semiSyncConn) Close() error { return nil }
+
+func (semiSyncConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type semiSyncStmt struct {
+	d *semiSyncDriver
+}
+
+func (semiSyncStmt) Close() error  { return nil }
+func (semiSyncStmt) NumInput() int { return -1 }
+
+func (semiSyncStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s semiSyncStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &statusRows{value: s.d.status}, nil
+}
+
+type statusRows struct {
+	value string
+	done  bool
+}
+
+func (r *statusRows) Columns() []string { return []string{"Variable_name", "Value"} }
+func (r *statusRows) Close() error      { return nil }
+
+func (r *statusRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "Rpl_semi_sync_source_status"
+	dest[1] = r.value
+	return nil
+}
+
+var semiSync = &semiSyncDriver{}
+
+func init() {
+	sql.Register("semi-sync-status", semiSync)
+}
+
+func TestMySQLDurableRequiresSemiSync(t *testing.T) {
+	db, err := sql.Open("semi-sync-status", "")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+	store := &MySQLStorage{db: db}
+
+	semiSync.set("OFF")
+	if _, err := Durable(store); !errors.Is(err, ErrNotDurable) {
+		t.Fatalf("Durable with semi-sync off: err = %v, want ErrNotDurable", err)
+	}
+
+	semiSync.set("ON")
+	durable, err := Durable(store)
+	if err != nil {
+		t.Fatalf("Durable with semi-sync on: %v", err)
+	}
+	if err := durable.PutItem("home/alice/sheet", "data"); err != nil {
+		t.Errorf("PutItem with semi-sync on: %v", err)
+	}
+
+	// The source drops to asynchronous replication after a replica timeout
+	semiSync.set("OFF")
+	if err := durable.PutItem("home/alice/sheet", "data"); !errors.Is(err, ErrNotDurable) {
+		t.Errorf("PutItem after semi-sync fallback: err = %v, want ErrNotDurable", err)
+	}
+}
+
+func TestDurableUnsupportedBackend(t *testing.T) {
+	s := newFakeStorage()
+	if err := CreateFileDurable(context.Background(), s, []string{"home", "alice", "sheet"}, "data"); !errors.Is(err, ErrNotDurable) {
+		t.Errorf("CreateFileDurable: err = %v, want ErrNotDurable", err)
+	}
+	if exists, _ := s.ExistsItem("home/alice/sheet"); exists {
+		t.Error("no write should happen when durability cannot be guaranteed")
+	}
+}
@@ -22,13 +22,35 @@ func NewStorage(cfg *config.Config) (Storage, error) {
         
     case "mysql":
         log.Printf("Attempting to connect to MySQL with DSN: %s", cfg.MySQLDSN)
-        storage, err := NewMySQLStorage(cfg.MySQLDSN)
+        storage, err := NewMySQLStorageWithOptions(cfg.MySQLDSN, MySQLOptions{
+            AutoMigrate:     cfg.MySQLAutoMigrate,
+            MaxOpenConns:    cfg.MySQLMaxOpenConns,
+            MaxIdleConns:    cfg.MySQLMaxIdleConns,
+            ConnMaxLifetime: cfg.MySQLConnMaxLifetime,
+        })
         if err != nil {
             return nil, fmt.Errorf("failed to initialize MySQL storage: %w", err)
         }
         log.Printf("Successfully connected to MySQL")
         return storage, nil
         
+    case "redis":
+        log.Printf("Attempting to connect to Redis")
+        storage, err := NewRedisStorage(cfg.RedisURI)
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize Redis storage: %w", err)
+        }
+        log.Printf("Successfully connected to Redis")
+        return storage, nil
+        
+    case "fs":
+        log.Printf("Storing items under directory: %s", cfg.FSRoot)
+        storage, err := NewFSStorage(cfg.FSRoot)
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize filesystem storage: %w", err)
+        }
+        return storage, nil
+        
     case "s3":
         if cfg.AWSAccessKey == "" || cfg.AWSSecretKey == "" {
             return nil, fmt.Errorf("AWS credentials required for S3 storage")
@@ -38,6 +60,9 @@ func NewStorage(cfg *config.Config) (Storage, error) {
         if err != nil {
             return nil, fmt.Errorf("failed to initialize S3 storage: %w", err)
         }
+        if cfg.StorageContentType != "" {
+            storage.contentType = cfg.StorageContentType
+        }
         log.Printf("Successfully connected to AWS S3")
         return storage, nil
         
@@ -51,6 +76,9 @@ func NewStorage(cfg *config.Config) (Storage, error) {
         if err != nil {
             return nil, fmt.Errorf("failed to initialize MinIO storage: %w", err)
         }
+        if cfg.StorageContentType != "" {
+            storage.contentType = cfg.StorageContentType
+        }
         log.Printf("Successfully connected to MinIO")
         return storage, nil
         
@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+const (
+	// fsItemFile holds the item stored at a folder's path. Escaped
+	// segments never start with an underscore, so no child folder can
+	// take its name.
+	fsItemFile = "_item.json"
+	// fsTempPrefix starts the name of a write in progress; escaped
+	// segments never start with a dot either
+	fsTempPrefix = ".tmp-"
+)
+
+// fsRename moves a finished write into place; tests swap it to interrupt
+// a write halfway
+var fsRename = os.Rename
+
+// FSStorage keeps items in files under a root directory, for single-node
+// deployments and local development that shouldn't need a database. Each
+// path segment is a folder, and the item stored at a path is the
+// fsItemFile in its folder, so a directory's own item sits beside its
+// children. Items are stored as the other backends store them: files and
+// directories as serialized StorageItems, with each file listed in its
+// parent directory.
+//
+// Writes go to a temporary file that is renamed over the item, so a crash
+// leaves either the old item or the new one, never a torn write. Every
+// operation holds one mutex throughout, which makes each atomic within the
+// process; only one process may use a root at a time. A context is only
+// checked on the way in, since a write is not abandoned halfway.
+type FSStorage struct {
+	mu   sync.Mutex
+	root string
+}
+
+// NewFSStorage stores items under root, creating it if needed
+func NewFSStorage(root string) (*FSStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("filesystem storage needs a root directory")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage root: %w", err)
+	}
+	return &FSStorage{root: root}, nil
+}
+
+// fsSegment escapes a path segment into a folder name. Leading dots and
+// underscores are escaped as well, so no segment becomes ".", "..",
+// fsItemFile or a temporary file; an empty segment becomes "_".
+func fsSegment(segment string) string {
+	if segment == "" {
+		return "_"
+	}
+	escaped := url.PathEscape(segment)
+	if c := escaped[0]; c == '.' || c == '_' {
+		escaped = fmt.Sprintf("%%%02X", c) + escaped[1:]
+	}
+	return escaped
+}
+
+func fsUnsegment(name string) (string, error) {
+	if name == "_" {
+		return "", nil
+	}
+	return url.PathUnescape(name)
+}
+
+// folder is the directory holding the item at key and everything under it
+func (f *FSStorage) folder(key string) string {
+	parts := []string{f.root}
+	for _, segment := range strings.Split(key, "/") {
+		parts = append(parts, fsSegment(segment))
+	}
+	return filepath.Join(parts...)
+}
+
+func (f *FSStorage) itemFile(key string) string {
+	return filepath.Join(f.folder(key), fsItemFile)
+}
+
+// get reads the item at key; f.mu must be held
+func (f *FSStorage) get(key string) (string, error) {
+	data, err := os.ReadFile(f.itemFile(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (f *FSStorage) exists(key string) (bool, error) {
+	_, err := os.Stat(f.itemFile(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// put writes the item at key through a temporary file renamed into place;
+// f.mu must be held
+func (f *FSStorage) put(key, data string) error {
+	dir := f.folder(key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, fsTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fsRename(tmp.Name(), filepath.Join(dir, fsItemFile))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// remove deletes the item at key, and then any folders left empty on the
+// way up to the root; f.mu must be held
+func (f *FSStorage) remove(key string) error {
+	err := os.Remove(f.itemFile(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	f.prune(f.folder(key))
+	return nil
+}
+
+// prune removes dir and its parents while they are empty
+func (f *FSStorage) prune(dir string) {
+	for dir != f.root && strings.HasPrefix(dir, f.root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// descendants returns the keys of every item below key, not key itself;
+// f.mu must be held
+func (f *FSStorage) descendants(key string) ([]string, error) {
+	base := f.folder(key)
+	var keys []string
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != fsItemFile {
+			return nil
+		}
+		rel, err := filepath.Rel(base, filepath.Dir(path))
+		if err != nil || rel == "." {
+			return err
+		}
+		segments := []string{key}
+		for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+			segment, err := fsUnsegment(name)
+			if err != nil {
+				return fmt.Errorf("unexpected file %s in storage: %w", path, err)
+			}
+			segments = append(segments, segment)
+		}
+		keys = append(keys, strings.Join(segments, "/"))
+		return nil
+	})
+	return keys, err
+}
+
+func (f *FSStorage) PutItem(path string, data string, bucket ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.put(path, data)
+}
+
+func (f *FSStorage) GetItem(path string, bucket ...string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.get(path)
+}
+
+func (f *FSStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.exists(path)
+}
+
+func (f *FSStorage) DeleteItem(path string, bucket ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.remove(path)
+}
+
+// SwapItem implements Swapper; the mutex makes the compare and the write
+// one step
+func (f *FSStorage) SwapItem(path, old, data string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, err := f.get(path)
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+	found := err == nil
+	if (old == "" && found) || (old != "" && current != old) {
+		return false, nil
+	}
+	return true, f.put(path, data)
+}
+
+// CreateDir creates the directory at path and any missing parents. An
+// existing directory is left as it is.
+func (f *FSStorage) CreateDir(ctx context.Context, path []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ensureDirs(path)
+}
+
+// ensureDirs creates every missing directory along path; f.mu must be held
+func (f *FSStorage) ensureDirs(path []string) error {
+	for depth := 1; depth <= len(path); depth++ {
+		key := strings.Join(path[:depth], "/")
+		if ok, err := f.exists(key); err != nil || ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		dirJSON, err := models.NewStorageItem(path[:depth], "dir", []string{}).ToJSON()
+		if err != nil {
+			return err
+		}
+		if err := f.put(key, dirJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSStorage) DeleteDir(path []string, recursive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.Join(path, "/")
+	if ok, err := f.exists(key); err != nil || !ok {
+		if err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+
+	contents, err := f.descendants(key)
+	if err != nil {
+		return err
+	}
+	if len(contents) > 0 && !recursive {
+		return ErrDirNotEmpty
+	}
+	if err := os.RemoveAll(f.folder(key)); err != nil {
+		return err
+	}
+	f.prune(filepath.Dir(f.folder(key)))
+	return nil
+}
+
+func (f *FSStorage) List(path []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.Join(path, "/")
+	if ok, err := f.exists(key); err != nil || !ok {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	keys, err := f.descendants(key)
+	if err != nil {
+		return nil, err
+	}
+	return childNames(key, keys), nil
+}
+
+func (f *FSStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.getFile(path)
+}
+
+// getFile reads the item at path; f.mu must be held
+func (f *FSStorage) getFile(path []string) (*models.StorageItem, error) {
+	data, err := f.get(strings.Join(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return models.StorageItemFromJSON(data)
+}
+
+// putFile writes item at path; f.mu must be held
+func (f *FSStorage) putFile(path []string, item *models.StorageItem) error {
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	return f.put(strings.Join(path, "/"), itemJSON)
+}
+
+// CreateFile writes a new file, creating its parent directories as
+// needed, and lists it in its parent
+func (f *FSStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ok, err := f.exists(strings.Join(path, "/")); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("file already exists")
+	}
+	return f.createFile(path, data)
+}
+
+// createFile writes the new file at path; f.mu must be held
+func (f *FSStorage) createFile(path []string, data string) error {
+	if len(path) > 1 {
+		if err := f.ensureDirs(path[:len(path)-1]); err != nil {
+			return fmt.Errorf("failed to create parent directories: %w", err)
+		}
+	}
+	if err := f.putFile(path, models.NewStorageItem(path, "file", data)); err != nil {
+		return err
+	}
+	if len(path) == 1 {
+		return nil
+	}
+	name := path[len(path)-1]
+	return f.updateListing(path[:len(path)-1], func(names []string) []string {
+		return append(names, name)
+	})
+}
+
+func (f *FSStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, err := f.getFile(path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+	item.Data = data
+	return f.putFile(path, item)
+}
+
+func (f *FSStorage) DeleteFile(ctx context.Context, path []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, err := f.getFile(path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+
+	if len(path) > 1 {
+		name := path[len(path)-1]
+		err := f.updateListing(path[:len(path)-1], func(names []string) []string {
+			kept := names[:0]
+			for _, existing := range names {
+				if existing != name {
+					kept = append(kept, existing)
+				}
+			}
+			return kept
+		})
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return f.remove(strings.Join(path, "/"))
+}
+
+// updateListing rewrites the file list of the directory at dir; f.mu must
+// be held
+func (f *FSStorage) updateListing(dir []string, update func([]string) []string) error {
+	item, err := f.getFile(dir)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	if entries, ok := item.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	item.Data = update(names)
+	return f.putFile(dir, item)
+}
+
+// Append adds data to the end of the file at path, creating it if absent
+func (f *FSStorage) Append(path []string, data []byte) error {
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, err := f.getFile(path)
+	if err == ErrNotFound {
+		return f.createFile(path, string(data))
+	}
+	if err != nil {
+		return err
+	}
+	existing, _ := item.Data.(string)
+	item.Data = existing + string(data)
+	return f.putFile(path, item)
+}
+
+// ListItems returns every item path starting with prefix, sorted
+func (f *FSStorage) ListItems(prefix string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Walk from the deepest folder the prefix names in full
+	base := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		base = prefix[:i]
+	}
+	var keys []string
+	var err error
+	if base == "" {
+		keys, err = f.rootKeys()
+	} else {
+		keys, err = f.descendants(base)
+		if ok, _ := f.exists(base); ok {
+			keys = append(keys, base)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			paths = append(paths, key)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// rootKeys returns the key of every item in the store; f.mu must be held
+func (f *FSStorage) rootKeys() ([]string, error) {
+	entries, err := os.ReadDir(f.root)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		key, err := fsUnsegment(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unexpected folder %s in storage: %w", entry.Name(), err)
+		}
+		if ok, _ := f.exists(key); ok {
+			keys = append(keys, key)
+		}
+		below, err := f.descendants(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, below...)
+	}
+	return keys, nil
+}
@@ -0,0 +1,12 @@
+package storage
+
+import "syscall"
+
+// DiskUsage implements DiskReporter for the filesystem holding the root
+func (f *FSStorage) DiskUsage() (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(f.root, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFSStorage(t *testing.T) *FSStorage {
+	t.Helper()
+	s, err := NewFSStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSStorage failed: %v", err)
+	}
+	return s
+}
+
+func TestFSStorageConformance(t *testing.T) {
+	t.Run("append", func(t *testing.T) { runAppendConformance(t, newTestFSStorage(t)) })
+	t.Run("delete dir", func(t *testing.T) { runDeleteDirConformance(t, newTestFSStorage(t)) })
+	t.Run("list", func(t *testing.T) { runListConformance(t, newTestFSStorage(t)) })
+	t.Run("cancel", func(t *testing.T) { runCancelConformance(t, newTestFSStorage(t)) })
+	t.Run("cas", func(t *testing.T) { runCASConformance(t, newTestFSStorage(t)) })
+}
+
+func TestFSStorageNotFound(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFSStorage(t)
+
+	if _, err := s.GetFile(ctx, []string{"home", "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetItem("home/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetItem: err = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateFile(ctx, []string{"home", "missing"}, "data"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateFile: err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteFile(ctx, []string{"home", "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteFile: err = %v, want ErrNotFound", err)
+	}
+	if exists, err := s.ExistsItem("home/missing"); err != nil || exists {
+		t.Errorf("ExistsItem = %v, %v; want false", exists, err)
+	}
+}
+
+func TestFSStorageCRUD(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFSStorage(t)
+	path := []string{"home", "alice@example.com", "sheets", "budget"}
+
+	if err := s.CreateFile(ctx, path, "v1"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if err := s.CreateFile(ctx, path, "again"); err == nil {
+		t.Error("CreateFile over an existing file should fail")
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil || item.Type != "file" || item.Data != "v1" {
+		t.Fatalf("GetFile = %+v, %v; want file with v1", item, err)
+	}
+	names, err := s.List(path[:3])
+	if err != nil || len(names) != 1 || names[0] != "budget" {
+		t.Errorf("List of the parent = %v, %v; want [budget]", names, err)
+	}
+
+	if err := s.UpdateFile(ctx, path, "v2"); err != nil {
+		t.Fatalf("UpdateFile failed: %v", err)
+	}
+	if item, _ := s.GetFile(ctx, path); item == nil || item.Data != "v2" {
+		t.Errorf("GetFile after update = %+v, want v2", item)
+	}
+
+	if err := s.DeleteFile(ctx, path); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if _, err := s.GetFile(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile after delete: err = %v, want ErrNotFound", err)
+	}
+	if names, _ := s.List(path[:3]); len(names) != 0 {
+		t.Errorf("List after delete = %v, want empty", names)
+	}
+}
+
+func TestFSStorageKeepsAwkwardNamesApart(t *testing.T) {
+	s := newTestFSStorage(t)
+	keys := []string{"a/..", "a/.", "a/_item.json", "a/b%2Fc", "a/b/c", "a//d", "a/.tmp-1"}
+	for _, key := range keys {
+		if err := s.PutItem(key, key); err != nil {
+			t.Fatalf("PutItem(%q) failed: %v", key, err)
+		}
+	}
+	for _, key := range keys {
+		if data, err := s.GetItem(key); err != nil || data != key {
+			t.Errorf("GetItem(%q) = %q, %v", key, data, err)
+		}
+	}
+	listed, err := s.ListItems("a/")
+	if err != nil || len(listed) != len(keys) {
+		t.Errorf("ListItems = %v, %v; want all %d keys", listed, err, len(keys))
+	}
+
+	entries, _ := os.ReadDir(s.root)
+	if len(entries) != 1 || entries[0].Name() != "a" {
+		t.Errorf("nothing should be written outside the item's folder, root holds %v", entries)
+	}
+}
+
+func TestFSStoragePersistsAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	first, err := NewFSStorage(root)
+	if err != nil {
+		t.Fatalf("NewFSStorage failed: %v", err)
+	}
+	if err := first.CreateFile(ctx, []string{"home", "sheet"}, "saved"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	second, err := NewFSStorage(root)
+	if err != nil {
+		t.Fatalf("NewFSStorage failed: %v", err)
+	}
+	if item, err := second.GetFile(ctx, []string{"home", "sheet"}); err != nil || item.Data != "saved" {
+		t.Errorf("GetFile from a new instance = %+v, %v; want saved", item, err)
+	}
+}
+
+func TestFSStorageDeletePrunesFolders(t *testing.T) {
+	s := newTestFSStorage(t)
+	if err := s.PutItem("a/b/c", "data"); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	if err := s.DeleteItem("a/b/c"); err != nil {
+		t.Fatalf("DeleteItem failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(s.root); len(entries) != 0 {
+		t.Errorf("empty folders should be removed, root holds %v", entries)
+	}
+}
+
+func TestFSStorageInterruptedWrite(t *testing.T) {
+	ctx := context.Background()
+	s := newTestFSStorage(t)
+	path := []string{"home", "sheet"}
+	if err := s.CreateFile(ctx, path, "before"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	// Stop the write after the data is on disk but before it is renamed
+	// into place, as a crash would
+	var temp string
+	fsRename = func(from, to string) error {
+		temp = from
+		panic("crash")
+	}
+	defer func() { fsRename = os.Rename }()
+	func() {
+		defer func() { recover() }()
+		s.UpdateFile(ctx, path, "after")
+	}()
+	fsRename = os.Rename
+
+	if data, err := os.ReadFile(temp); err != nil || !strings.Contains(string(data), "after") {
+		t.Fatalf("the interrupted write should have left its temporary file, got %v", err)
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil || item.Data != "before" {
+		t.Errorf("GetFile after an interrupted write = %+v, %v; want the old data", item, err)
+	}
+	if names, _ := s.List(path[:1]); len(names) != 1 || names[0] != "sheet" {
+		t.Errorf("List = %v, the temporary file should not show", names)
+	}
+	if items, _ := s.ListItems(""); len(items) != 2 {
+		t.Errorf("ListItems = %v, want only home and home/sheet", items)
+	}
+
+	if err := s.UpdateFile(ctx, path, "after"); err != nil {
+		t.Fatalf("UpdateFile after recovery failed: %v", err)
+	}
+	if item, _ := s.GetFile(ctx, path); item == nil || item.Data != "after" {
+		t.Errorf("GetFile = %+v, want the new data", item)
+	}
+}
+
+func TestFSStorageFailedRenameCleansUp(t *testing.T) {
+	s := newTestFSStorage(t)
+	if err := s.PutItem("key", "before"); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+
+	fsRename = func(from, to string) error { return errors.New("disk full") }
+	defer func() { fsRename = os.Rename }()
+	if err := s.PutItem("key", "after"); err == nil {
+		t.Fatal("PutItem should report a failed rename")
+	}
+
+	if data, _ := s.GetItem("key"); data != "before" {
+		t.Errorf("GetItem = %q, want the old data", data)
+	}
+	entries, _ := os.ReadDir(filepath.Join(s.root, "key"))
+	if len(entries) != 1 || entries[0].Name() != fsItemFile {
+		t.Errorf("a failed write should remove its temporary file, folder holds %v", entries)
+	}
+}
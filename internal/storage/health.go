@@ -0,0 +1,35 @@
+package storage
+
+import "context"
+
+// Pinger is implemented by backends that can check connectivity
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PoolStats is a snapshot of a backend's connection pool. MaxOpen is zero
+// when the pool is unbounded.
+type PoolStats struct {
+	InUse   int
+	Idle    int
+	MaxOpen int
+}
+
+// Saturated reports whether at least percent of the pool's connections are
+// in use. An unbounded pool is never saturated.
+func (p PoolStats) Saturated(percent int) bool {
+	if p.MaxOpen <= 0 {
+		return false
+	}
+	return p.InUse*100 >= p.MaxOpen*percent
+}
+
+// PoolReporter is implemented by backends with a bounded connection pool
+type PoolReporter interface {
+	PoolStats() PoolStats
+}
+
+// DiskReporter is implemented by backends that keep items on local disk
+type DiskReporter interface {
+	DiskUsage() (free, total uint64, err error)
+}
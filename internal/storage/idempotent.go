@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrConflict is returned by idempotent creates when the item already
+// exists with different content
+var ErrConflict = errors.New("item already exists with different content")
+
+// CreateFileIdempotent creates the file at path like CreateFile, but an
+// existing file with identical content counts as success, so a create
+// retried after a lost response doesn't fail. An existing file with other
+// content is ErrConflict.
+func CreateFileIdempotent(ctx context.Context, s Storage, path []string, data string) error {
+	if same, err := sameFile(ctx, s, path, data); err != nil || same {
+		return err
+	}
+
+	createErr := s.CreateFile(ctx, path, data)
+	if createErr == nil {
+		return nil
+	}
+	// The create may have lost a race with the request it is retrying
+	if same, err := sameFile(ctx, s, path, data); err == nil && same {
+		return nil
+	} else if errors.Is(err, ErrConflict) {
+		return err
+	}
+	return createErr
+}
+
+// sameFile reports whether the file at path exists with content data. It
+// returns ErrConflict if it exists with anything else.
+func sameFile(ctx context.Context, s Storage, path []string, data string) (bool, error) {
+	exists, err := s.ExistsItem(strings.Join(path, "/"))
+	if err != nil || !exists {
+		return false, err
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if existing, ok := item.Data.(string); ok && item.Type == "file" && existing == data {
+		return true, nil
+	}
+	return false, ErrConflict
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCreateFileIdempotentRetry(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	s.CreateDir(ctx, []string{"home"})
+	path := []string{"home", "sheet1"}
+
+	if err := CreateFileIdempotent(ctx, s, path, "A1:1"); err != nil {
+		t.Fatalf("first create failed: %v", err)
+	}
+	if err := CreateFileIdempotent(ctx, s, path, "A1:1"); err != nil {
+		t.Errorf("retry with identical content failed: %v", err)
+	}
+
+	dir, _ := s.GetFile(ctx, []string{"home"})
+	if entries, _ := dir.Data.([]interface{}); len(entries) != 1 {
+		t.Errorf("parent listing = %v, want the file listed once", dir.Data)
+	}
+}
+
+func TestCreateFileIdempotentConflict(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	s.CreateDir(ctx, []string{"home"})
+	path := []string{"home", "sheet1"}
+
+	if err := CreateFileIdempotent(ctx, s, path, "A1:1"); err != nil {
+		t.Fatalf("first create failed: %v", err)
+	}
+	if err := CreateFileIdempotent(ctx, s, path, "A1:2"); !errors.Is(err, ErrConflict) {
+		t.Errorf("create with different content: err = %v, want ErrConflict", err)
+	}
+
+	item, _ := s.GetFile(ctx, path)
+	if item.Data != "A1:1" {
+		t.Errorf("conflicting create changed the file to %v", item.Data)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// OperationDuration records how long storage operations take, by operation
+var OperationDuration = metrics.NewSummaryVec(
+	"touchcalc_storage_operation_seconds",
+	"Time spent in storage operations.",
+	"op",
+)
+
+// OperationErrors counts failed storage operations by operation. Missing
+// items are an answer rather than a failure and aren't counted.
+var OperationErrors = metrics.NewCounterVec(
+	"touchcalc_storage_errors_total",
+	"Failed storage operations.",
+	"op",
+)
+
+func init() {
+	metrics.Default.Register(OperationDuration)
+	metrics.Default.Register(OperationErrors)
+}
+
+// Observer is told the duration of each storage operation
+type Observer func(op string, d time.Duration)
+
+// Instrument wraps s so the duration of every operation is recorded in
+// OperationDuration and, when observe is set, reported to it as well.
+// Failures are counted in OperationErrors. The wrapper only exposes the
+// Storage interface.
+func Instrument(s Storage, observe Observer) Storage {
+	return &instrumented{s: s, observe: observe}
+}
+
+type instrumented struct {
+	s       Storage
+	observe Observer
+}
+
+func (i *instrumented) track(op string, start time.Time, err *error) {
+	d := time.Since(start)
+	if *err != nil && !errors.Is(*err, ErrNotFound) {
+		OperationErrors.Inc(op)
+	}
+	OperationDuration.Observe(op, d.Seconds())
+	if i.observe != nil {
+		i.observe(op, d)
+	}
+}
+
+func (i *instrumented) CreateFile(ctx context.Context, path []string, data string) (err error) {
+	defer i.track("create_file", time.Now(), &err)
+	return i.s.CreateFile(ctx, path, data)
+}
+
+func (i *instrumented) GetFile(ctx context.Context, path []string) (item *models.StorageItem, err error) {
+	defer i.track("get_file", time.Now(), &err)
+	return i.s.GetFile(ctx, path)
+}
+
+func (i *instrumented) UpdateFile(ctx context.Context, path []string, data string) (err error) {
+	defer i.track("update_file", time.Now(), &err)
+	return i.s.UpdateFile(ctx, path, data)
+}
+
+func (i *instrumented) DeleteFile(ctx context.Context, path []string) (err error) {
+	defer i.track("delete_file", time.Now(), &err)
+	return i.s.DeleteFile(ctx, path)
+}
+
+func (i *instrumented) Append(path []string, data []byte) (err error) {
+	defer i.track("append", time.Now(), &err)
+	return i.s.Append(path, data)
+}
+
+func (i *instrumented) CreateDir(ctx context.Context, path []string) (err error) {
+	defer i.track("create_dir", time.Now(), &err)
+	return i.s.CreateDir(ctx, path)
+}
+
+func (i *instrumented) DeleteDir(path []string, recursive bool) (err error) {
+	defer i.track("delete_dir", time.Now(), &err)
+	return i.s.DeleteDir(path, recursive)
+}
+
+func (i *instrumented) List(path []string) (names []string, err error) {
+	defer i.track("list", time.Now(), &err)
+	return i.s.List(path)
+}
+
+func (i *instrumented) PutItem(path string, data string, bucket ...string) (err error) {
+	defer i.track("put_item", time.Now(), &err)
+	return i.s.PutItem(path, data, bucket...)
+}
+
+func (i *instrumented) GetItem(path string, bucket ...string) (data string, err error) {
+	defer i.track("get_item", time.Now(), &err)
+	return i.s.GetItem(path, bucket...)
+}
+
+func (i *instrumented) ExistsItem(path string, bucket ...string) (exists bool, err error) {
+	defer i.track("exists_item", time.Now(), &err)
+	return i.s.ExistsItem(path, bucket...)
+}
+
+func (i *instrumented) DeleteItem(path string, bucket ...string) (err error) {
+	defer i.track("delete_item", time.Now(), &err)
+	return i.s.DeleteItem(path, bucket...)
+}
+
+// Unwrap returns the Storage behind the instrumentation
+func (i *instrumented) Unwrap() Storage {
+	return i.s
+}
+
+// Unwrap strips decorators such as Instrument and CachedStorage, returning
+// the backend that actually holds the data
+func Unwrap(s Storage) Storage {
+	for {
+		w, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return s
+		}
+		s = w.Unwrap()
+	}
+}
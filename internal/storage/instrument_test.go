@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// brokenItems fails every item read except for missing items
+type brokenItems struct {
+	Storage
+}
+
+func (b brokenItems) GetItem(path string, bucket ...string) (string, error) {
+	if path == "missing" {
+		return "", ErrNotFound
+	}
+	return "", errors.New("connection reset")
+}
+
+func TestInstrumentCountsErrors(t *testing.T) {
+	s := Instrument(brokenItems{NewMemoryStorage()}, nil)
+	before := OperationErrors.Value("get_item")
+
+	s.GetItem("sheet")
+	s.GetItem("missing")
+	if err := s.PutItem("sheet", "A1:1"); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+
+	if got := OperationErrors.Value("get_item") - before; got != 1 {
+		t.Errorf("get_item errors counted = %d, want 1 (not found isn't an error)", got)
+	}
+	if got := OperationErrors.Value("put_item"); got != 0 {
+		t.Errorf("put_item errors = %d, want 0", got)
+	}
+}
@@ -1,29 +1,66 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
 )
 
 var (
 	ErrNotFound = errors.New("item not found")
+
+	// ErrDirNotEmpty is returned when deleting a directory that still has
+	// contents without asking for them to go too
+	ErrDirNotEmpty = errors.New("directory not empty")
 )
 
-// Storage defines the interface for storage operations
+// Storage defines the interface for storage operations. The file
+// operations and CreateDir take a context, and give up with its error once
+// it is cancelled or past its deadline.
 type Storage interface {
 	// File operations
-	CreateFile(path []string, data string) error
-	GetFile(path []string) (*models.StorageItem, error)
-	UpdateFile(path []string, data string) error
-	DeleteFile(path []string) error
+	CreateFile(ctx context.Context, path []string, data string) error
+	GetFile(ctx context.Context, path []string) (*models.StorageItem, error)
+	UpdateFile(ctx context.Context, path []string, data string) error
+	DeleteFile(ctx context.Context, path []string) error
+	// Append adds data to the end of a file, creating it if absent
+	Append(path []string, data []byte) error
 	
 	// Directory operations
-	CreateDir(path []string) error
-	DeleteDir(path []string) error
+	CreateDir(ctx context.Context, path []string) error
+	// DeleteDir removes the directory at path, which is ErrNotFound when
+	// missing. With recursive set everything under it goes too, in bulk;
+	// otherwise a directory with any items under it is ErrDirNotEmpty.
+	DeleteDir(path []string, recursive bool) error
+	// List returns the names of the files and directories directly under
+	// the directory at path, sorted, or ErrNotFound when it doesn't exist
+	List(path []string) ([]string, error)
 	
 	// Item operations (low-level)
 	PutItem(path string, data string, bucket ...string) error
 	GetItem(path string, bucket ...string) (string, error)
 	ExistsItem(path string, bucket ...string) (bool, error)
 	DeleteItem(path string, bucket ...string) error
-}
\ No newline at end of file
+}
+
+// ItemLister is implemented by backends that can enumerate raw item paths.
+// It powers whole-store operations such as Backup.
+type ItemLister interface {
+	// ListItems returns every item path starting with prefix, sorted
+	ListItems(prefix string) ([]string, error)
+}
+
+// Closer is implemented by backends holding connections that should be
+// released on shutdown
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Close releases the connections of s, or the backend it wraps, if it
+// holds any
+func Close(ctx context.Context, s Storage) error {
+	if closer, ok := Unwrap(s).(Closer); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// childNames returns the distinct names of dir's immediate children among
+// paths, sorted. Deeper paths contribute the child they sit under, so a
+// subdirectory is named even when only its contents were listed.
+func childNames(dir string, paths []string) []string {
+	prefix := dir + "/"
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, path := range paths {
+		rest, ok := strings.CutPrefix(path, prefix)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
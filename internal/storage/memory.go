@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// MemoryStorage keeps every item in a map, for tests and local runs that
+// shouldn't need a database. Items are stored as the other backends store
+// them: files and directories as serialized StorageItems, with each file
+// listed in its parent directory. Every operation holds one mutex
+// throughout, so each is atomic; a context is only checked on the way in,
+// since nothing here waits.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	items map[string]string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: make(map[string]string)}
+}
+
+func (m *MemoryStorage) pathToString(path []string) string {
+	return strings.Join(path, "/")
+}
+
+func (m *MemoryStorage) PutItem(path string, data string, bucket ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[path] = data
+	return nil
+}
+
+func (m *MemoryStorage) GetItem(path string, bucket ...string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.items[path]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *MemoryStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.items[path]
+	return ok, nil
+}
+
+func (m *MemoryStorage) DeleteItem(path string, bucket ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, path)
+	return nil
+}
+
+// SwapItem implements Swapper; the mutex makes the compare and the write
+// one step
+func (m *MemoryStorage) SwapItem(path, old, data string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.items[path]
+	if (old == "" && ok) || (old != "" && current != old) {
+		return false, nil
+	}
+	m.items[path] = data
+	return true, nil
+}
+
+// CreateDir creates the directory at path and any missing parents. An
+// existing directory is left as it is.
+func (m *MemoryStorage) CreateDir(ctx context.Context, path []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ensureDirs(path)
+}
+
+// ensureDirs creates every missing directory along path; m.mu must be held
+func (m *MemoryStorage) ensureDirs(path []string) error {
+	for depth := 1; depth <= len(path); depth++ {
+		level := path[:depth]
+		if _, ok := m.items[m.pathToString(level)]; ok {
+			continue
+		}
+		dirJSON, err := models.NewStorageItem(level, "dir", []string{}).ToJSON()
+		if err != nil {
+			return err
+		}
+		m.items[m.pathToString(level)] = dirJSON
+	}
+	return nil
+}
+
+func (m *MemoryStorage) DeleteDir(path []string, recursive bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spath := m.pathToString(path)
+	if _, ok := m.items[spath]; !ok {
+		return ErrNotFound
+	}
+
+	var contents []string
+	for key := range m.items {
+		if strings.HasPrefix(key, spath+"/") {
+			contents = append(contents, key)
+		}
+	}
+	if len(contents) > 0 && !recursive {
+		return ErrDirNotEmpty
+	}
+	for _, key := range append(contents, spath) {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) List(path []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spath := m.pathToString(path)
+	if _, ok := m.items[spath]; !ok {
+		return nil, ErrNotFound
+	}
+	var paths []string
+	for key := range m.items {
+		paths = append(paths, key)
+	}
+	return childNames(spath, paths), nil
+}
+
+func (m *MemoryStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getFile(path)
+}
+
+// getFile reads the item at path; m.mu must be held
+func (m *MemoryStorage) getFile(path []string) (*models.StorageItem, error) {
+	data, ok := m.items[m.pathToString(path)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return models.StorageItemFromJSON(data)
+}
+
+// putFile writes item at path; m.mu must be held
+func (m *MemoryStorage) putFile(path []string, item *models.StorageItem) error {
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	m.items[m.pathToString(path)] = itemJSON
+	return nil
+}
+
+// CreateFile writes a new file, creating its parent directories as
+// needed, and lists it in its parent
+func (m *MemoryStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[m.pathToString(path)]; ok {
+		return fmt.Errorf("file already exists")
+	}
+	return m.createFile(path, data)
+}
+
+// createFile writes the new file at path; m.mu must be held
+func (m *MemoryStorage) createFile(path []string, data string) error {
+	if err := m.putFile(path, models.NewStorageItem(path, "file", data)); err != nil {
+		return err
+	}
+	if len(path) == 1 {
+		return nil
+	}
+
+	parentPath := path[:len(path)-1]
+	if err := m.ensureDirs(parentPath); err != nil {
+		return fmt.Errorf("failed to create parent directories: %w", err)
+	}
+	name := path[len(path)-1]
+	return m.updateListing(parentPath, func(names []string) []string {
+		return append(names, name)
+	})
+}
+
+func (m *MemoryStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, err := m.getFile(path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+	item.Data = data
+	return m.putFile(path, item)
+}
+
+func (m *MemoryStorage) DeleteFile(ctx context.Context, path []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, err := m.getFile(path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+
+	if len(path) > 1 {
+		name := path[len(path)-1]
+		err := m.updateListing(path[:len(path)-1], func(names []string) []string {
+			kept := names[:0]
+			for _, existing := range names {
+				if existing != name {
+					kept = append(kept, existing)
+				}
+			}
+			return kept
+		})
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	delete(m.items, m.pathToString(path))
+	return nil
+}
+
+// updateListing rewrites the file list of the directory at dir; m.mu must
+// be held
+func (m *MemoryStorage) updateListing(dir []string, update func([]string) []string) error {
+	item, err := m.getFile(dir)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	if entries, ok := item.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	item.Data = update(names)
+	return m.putFile(dir, item)
+}
+
+// Append adds data to the end of the file at path, creating it if absent
+func (m *MemoryStorage) Append(path []string, data []byte) error {
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, err := m.getFile(path)
+	if err == ErrNotFound {
+		return m.createFile(path, string(data))
+	}
+	if err != nil {
+		return err
+	}
+	existing, _ := item.Data.(string)
+	item.Data = existing + string(data)
+	return m.putFile(path, item)
+}
+
+// ListItems returns every item path starting with prefix, sorted
+func (m *MemoryStorage) ListItems(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []string
+	for path := range m.items {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
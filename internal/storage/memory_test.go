@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStorageConformance(t *testing.T) {
+	t.Run("append", func(t *testing.T) { runAppendConformance(t, NewMemoryStorage()) })
+	t.Run("delete dir", func(t *testing.T) { runDeleteDirConformance(t, NewMemoryStorage()) })
+	t.Run("list", func(t *testing.T) { runListConformance(t, NewMemoryStorage()) })
+	t.Run("cancel", func(t *testing.T) { runCancelConformance(t, NewMemoryStorage()) })
+	t.Run("cas", func(t *testing.T) { runCASConformance(t, NewMemoryStorage()) })
+}
+
+func TestMemoryStorageNotFound(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	if _, err := s.GetFile(ctx, []string{"home", "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFile: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetItem("home/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetItem: err = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateFile(ctx, []string{"home", "missing"}, "data"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateFile: err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteFile(ctx, []string{"home", "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteFile: err = %v, want ErrNotFound", err)
+	}
+	if exists, err := s.ExistsItem("home/missing"); err != nil || exists {
+		t.Errorf("ExistsItem = %v, %v; want false", exists, err)
+	}
+}
+
+func TestMemoryStorageCreateDirIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	dir := []string{"home", "alice"}
+	if err := s.CreateFile(ctx, append(dir, "sheet"), "data"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	// Creating the directory again must keep its listing
+	if err := s.CreateDir(ctx, dir); err != nil {
+		t.Fatalf("CreateDir on an existing directory failed: %v", err)
+	}
+	item, err := s.GetFile(ctx, dir)
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if names, _ := item.Data.([]interface{}); len(names) != 1 || names[0] != "sheet" {
+		t.Errorf("listing after CreateDir = %v, want [sheet]", item.Data)
+	}
+	if err := s.CreateFile(ctx, append(dir, "sheet"), "again"); err == nil {
+		t.Error("creating an existing file should fail")
+	}
+}
+
+func TestMemoryStorageConcurrentCreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	const writers, perWriter = 16, 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				path := []string{"home", "shared", fmt.Sprintf("sheet-%d-%d", w, i)}
+				if err := s.CreateFile(ctx, path, path[2]); err != nil {
+					t.Errorf("CreateFile(ctx, %v) failed: %v", path, err)
+					return
+				}
+				item, err := s.GetFile(ctx, path)
+				if err != nil || item.Data != path[2] {
+					t.Errorf("GetFile(ctx, %v) = %v, %v", path, item, err)
+					return
+				}
+			}
+		}(w)
+		// Readers race the writers over the same directory
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				s.GetFile(ctx, []string{"home", "shared"})
+				s.List([]string{"home", "shared"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// No create lost its entry in the shared directory listing
+	dir, err := s.GetFile(ctx, []string{"home", "shared"})
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if names, _ := dir.Data.([]interface{}); len(names) != writers*perWriter {
+		t.Errorf("directory lists %d files, want %d", len(names), writers*perWriter)
+	}
+	names, err := s.List([]string{"home", "shared"})
+	if err != nil || len(names) != writers*perWriter {
+		t.Errorf("List returned %d names, %v; want %d", len(names), err, writers*perWriter)
+	}
+}
+
+func TestMemoryStorageConcurrentCreateSamePath(t *testing.T) {
+	s := NewMemoryStorage()
+	path := []string{"home", "alice", "sheet"}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.CreateFile(context.Background(), path, "data") == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("%d concurrent creates of one path succeeded, want exactly 1", created)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MigrateOptions tunes Migrate
+type MigrateOptions struct {
+	// Workers is how many items are copied at once; below 1 copies serially
+	Workers int
+	// DryRun reads both sides but writes nothing; Copied then counts the
+	// items that would have been copied
+	DryRun bool
+	// Resume skips every item dst already holds without comparing it to
+	// the source, so rerunning a large interrupted migration only reads
+	// what is missing. Items changed at the source since are left stale.
+	Resume bool
+	// Progress, when set, is told after each item how many are done out
+	// of the total. Calls come from the workers, one at a time.
+	Progress func(done, total int)
+}
+
+// MigrateReport counts what Migrate did with each source item
+type MigrateReport struct {
+	Copied  int
+	Skipped int
+	Failed  int
+}
+
+// Migrate copies every item in src into dst. Items dst already holds with
+// identical content are skipped, so an interrupted migration resumes when
+// run again. A failed item doesn't stop the others; every failure is
+// returned together, in path order.
+func Migrate(src, dst Storage, opts MigrateOptions) (MigrateReport, error) {
+	lister, ok := src.(ItemLister)
+	if !ok {
+		return MigrateReport{}, fmt.Errorf("storage backend %T does not support listing items", src)
+	}
+	paths, err := lister.ListItems("")
+	if err != nil {
+		return MigrateReport{}, fmt.Errorf("failed to list items: %w", err)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	copied := make([]bool, len(paths))
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				copied[i], errs[i] = migrateItem(src, dst, paths[i], opts)
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(done, len(paths))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var report MigrateReport
+	var failures []error
+	for i, err := range errs {
+		switch {
+		case err != nil:
+			report.Failed++
+			failures = append(failures, err)
+		case copied[i]:
+			report.Copied++
+		default:
+			report.Skipped++
+		}
+	}
+	return report, errors.Join(failures...)
+}
+
+// migrateItem copies one item, reporting false when dst already had it
+func migrateItem(src, dst Storage, path string, opts MigrateOptions) (bool, error) {
+	if opts.Resume {
+		exists, err := dst.ExistsItem(path)
+		if err != nil {
+			return false, fmt.Errorf("failed to check item %s: %w", path, err)
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	data, err := src.GetItem(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read item %s: %w", path, err)
+	}
+	existing, err := dst.GetItem(path)
+	if err == nil && existing == data {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, fmt.Errorf("failed to check item %s: %w", path, err)
+	}
+	if opts.DryRun {
+		return true, nil
+	}
+	if err := dst.PutItem(path, data); err != nil {
+		return false, fmt.Errorf("failed to write item %s: %w", path, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+func seedItems(t *testing.T, count int) *fakeStorage {
+	s := newFakeStorage()
+	for i := 0; i < count; i++ {
+		if err := s.PutItem(fmt.Sprintf("home/user%d@example.com/sheet%d", i%7, i), fmt.Sprintf(`{"type":"file","data":"v%d"}`, i)); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+	return s
+}
+
+func snapshot(t *testing.T, s *fakeStorage) map[string]string {
+	paths, err := s.ListItems("")
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	items := make(map[string]string, len(paths))
+	for _, path := range paths {
+		items[path], _ = s.GetItem(path)
+	}
+	return items
+}
+
+func TestMigrateParallelMatchesSerial(t *testing.T) {
+	src := seedItems(t, 500)
+
+	serial := newFakeStorage()
+	if _, err := Migrate(src, serial, MigrateOptions{Workers: 1}); err != nil {
+		t.Fatalf("serial Migrate failed: %v", err)
+	}
+	parallel := newFakeStorage()
+	report, err := Migrate(src, parallel, MigrateOptions{Workers: 8})
+	if err != nil {
+		t.Fatalf("parallel Migrate failed: %v", err)
+	}
+
+	if report.Copied != 500 || report.Skipped != 0 || report.Failed != 0 {
+		t.Errorf("report = %+v, want 500 copied", report)
+	}
+	if !reflect.DeepEqual(snapshot(t, serial), snapshot(t, parallel)) {
+		t.Error("parallel migration differs from the serial one")
+	}
+	if !reflect.DeepEqual(snapshot(t, src), snapshot(t, parallel)) {
+		t.Error("migrated store differs from the source")
+	}
+}
+
+func TestMigrateResumeSkipsCopiedItems(t *testing.T) {
+	src := seedItems(t, 50)
+	dst := newFakeStorage()
+
+	// A partial earlier run: some items copied, one stale
+	paths, _ := src.ListItems("")
+	for _, path := range paths[:20] {
+		data, _ := src.GetItem(path)
+		dst.PutItem(path, data)
+	}
+	dst.PutItem(paths[20], "stale")
+
+	report, err := Migrate(src, dst, MigrateOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if report.Copied != 30 || report.Skipped != 20 {
+		t.Errorf("report = %+v, want 30 copied and 20 skipped", report)
+	}
+	if !reflect.DeepEqual(snapshot(t, src), snapshot(t, dst)) {
+		t.Error("resumed migration differs from the source")
+	}
+}
+
+// failingPuts rejects writes to the listed paths
+type failingPuts struct {
+	*fakeStorage
+	fail map[string]bool
+}
+
+func (f *failingPuts) PutItem(path string, data string, bucket ...string) error {
+	if f.fail[path] {
+		return errors.New("disk full")
+	}
+	return f.fakeStorage.PutItem(path, data, bucket...)
+}
+
+func TestMigrateAggregatesFailures(t *testing.T) {
+	src := seedItems(t, 40)
+	paths, _ := src.ListItems("")
+	dst := &failingPuts{newFakeStorage(), map[string]bool{paths[3]: true, paths[17]: true}}
+
+	report, err := Migrate(src, dst, MigrateOptions{Workers: 6})
+	if err == nil {
+		t.Fatal("Migrate reported no error")
+	}
+	if report.Failed != 2 || report.Copied != 38 {
+		t.Errorf("report = %+v, want 38 copied and 2 failed", report)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, paths[3]) || !strings.Contains(msg, paths[17]) {
+		t.Errorf("error %q doesn't name every failed item", msg)
+	}
+	if strings.Index(msg, paths[3]) > strings.Index(msg, paths[17]) {
+		t.Errorf("failures not in path order: %q", msg)
+	}
+}
+
+// seedTree writes a small tree of users and sheets through the file
+// operations, as the app does
+func seedTree(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for _, dir := range [][]string{{"home"}, {"home", "alice@example.com"}, {"home", "bob@example.com"}} {
+		if err := s.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir %v failed: %v", dir, err)
+		}
+	}
+	for i, path := range [][]string{
+		{"home", "alice@example.com", "budget"},
+		{"home", "alice@example.com", "plans"},
+		{"home", "bob@example.com", "budget"},
+	} {
+		if err := s.CreateFile(ctx, path, fmt.Sprintf("cell:A1:v:%d", i)); err != nil {
+			t.Fatalf("CreateFile %v failed: %v", path, err)
+		}
+	}
+}
+
+// treeOf walks s from path, returning every file and directory under it
+func treeOf(t *testing.T, s Storage, path []string) map[string]*models.StorageItem {
+	tree := map[string]*models.StorageItem{}
+	item, err := s.GetFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("GetFile %v failed: %v", path, err)
+	}
+	tree[strings.Join(path, "/")] = item
+	if item.Type != "dir" {
+		return tree
+	}
+	names, err := s.List(path)
+	if err != nil {
+		t.Fatalf("List %v failed: %v", path, err)
+	}
+	for _, name := range names {
+		for key, child := range treeOf(t, s, append(append([]string(nil), path...), name)) {
+			tree[key] = child
+		}
+	}
+	return tree
+}
+
+func TestMigrateMemoryStorage(t *testing.T) {
+	src := NewMemoryStorage()
+	seedTree(t, src)
+	items, _ := src.ListItems("")
+
+	dst := NewMemoryStorage()
+	var progress []int
+	report, err := Migrate(src, dst, MigrateOptions{DryRun: true, Progress: func(done, total int) {
+		if total != len(items) {
+			t.Errorf("progress total = %d, want %d", total, len(items))
+		}
+		progress = append(progress, done)
+	}})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if report.Copied != len(items) {
+		t.Errorf("dry run report = %+v, want %d to copy", report, len(items))
+	}
+	if len(progress) != len(items) || progress[len(progress)-1] != len(items) {
+		t.Errorf("progress = %v, want one call per item", progress)
+	}
+	if written, _ := dst.ListItems(""); len(written) != 0 {
+		t.Fatalf("dry run wrote %v", written)
+	}
+
+	report, err = Migrate(src, dst, MigrateOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if report.Copied != len(items) || report.Failed != 0 {
+		t.Errorf("report = %+v, want %d copied", report, len(items))
+	}
+	if !reflect.DeepEqual(treeOf(t, src, []string{"home"}), treeOf(t, dst, []string{"home"})) {
+		t.Error("migrated tree differs from the source")
+	}
+}
+
+func TestMigrateResumeSkipsPresentItems(t *testing.T) {
+	src := NewMemoryStorage()
+	seedTree(t, src)
+	dst := NewMemoryStorage()
+	if _, err := Migrate(src, dst, MigrateOptions{}); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	// Resuming leaves what the destination holds alone, even when stale
+	ctx := context.Background()
+	budget := []string{"home", "alice@example.com", "budget"}
+	if err := dst.UpdateFile(ctx, budget, "changed"); err != nil {
+		t.Fatalf("UpdateFile failed: %v", err)
+	}
+	if err := src.CreateFile(ctx, []string{"home", "bob@example.com", "taxes"}, "cell:A1:v:9"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	report, err := Migrate(src, dst, MigrateOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("resumed Migrate failed: %v", err)
+	}
+	// Only the new file; bob's listing was present, so stays as it was
+	if report.Copied != 1 {
+		t.Errorf("report = %+v, want 1 copied", report)
+	}
+	if item, err := dst.GetFile(ctx, budget); err != nil || item.Data != "changed" {
+		t.Errorf("resume overwrote a present item: %v, %v", item, err)
+	}
+	if _, err := dst.GetFile(ctx, []string{"home", "bob@example.com", "taxes"}); err != nil {
+		t.Errorf("resume didn't copy the new file: %v", err)
+	}
+}
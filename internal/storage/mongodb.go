@@ -3,7 +3,10 @@ package storage
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
+    "regexp"
+    "sort"
     "strings"
     "time"
 
@@ -11,6 +14,7 @@ import (
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
+    "go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 type MongoStorage struct {
@@ -23,6 +27,9 @@ type MongoItem struct {
     Path string      `bson:"path"`
     Type string      `bson:"type"`
     Data interface{} `bson:"data"`
+    // Version counts the writes to the item, for UpdateFileCAS; items
+    // written before it was kept have none, which reads as zero
+    Version int64 `bson:"version,omitempty"`
 }
 
 func NewMongoStorage(uri, dbName string) (*MongoStorage, error) {
@@ -47,6 +54,21 @@ func NewMongoStorage(uri, dbName string) (*MongoStorage, error) {
     }, nil
 }
 
+// Durable returns a view of the store whose writes use the majority write
+// concern, so they only return once a majority of the replica set has them
+func (m *MongoStorage) Durable() (Storage, error) {
+    opts := options.Database().SetWriteConcern(writeconcern.Majority())
+    return &MongoStorage{
+        client:   m.client,
+        database: m.client.Database(m.database.Name(), opts),
+    }, nil
+}
+
+// Close disconnects the client, which views from Durable share
+func (m *MongoStorage) Close(ctx context.Context) error {
+    return m.client.Disconnect(ctx)
+}
+
 func (m *MongoStorage) pathToString(path []string) string {
     return strings.Join(path, "/")
 }
@@ -56,23 +78,28 @@ func (m *MongoStorage) getCollection() *mongo.Collection {
 }
 
 func (m *MongoStorage) PutItem(path string, data string, bucket ...string) error {
-    collection := m.getCollection()
-    ctx := context.Background()
+    return m.putItem(context.Background(), path, data)
+}
 
-    item := MongoItem{
-        ID:   path,
-        Path: path,
-        Data: data,
-    }
+// putItem is PutItem giving up when ctx is done, which the file operations
+// use to pass their context on to the driver
+func (m *MongoStorage) putItem(ctx context.Context, path string, data string) error {
+    collection := m.getCollection()
 
-    opts := options.Replace().SetUpsert(true)
-    _, err := collection.ReplaceOne(ctx, bson.M{"_id": path}, item, opts)
+    opts := options.Update().SetUpsert(true)
+    _, err := collection.UpdateOne(ctx, bson.M{"_id": path}, bson.M{
+        "$set": bson.M{"path": path, "type": "", "data": data},
+        "$inc": bson.M{"version": 1},
+    }, opts)
     return err
 }
 
 func (m *MongoStorage) GetItem(path string, bucket ...string) (string, error) {
+    return m.getItem(context.Background(), path)
+}
+
+func (m *MongoStorage) getItem(ctx context.Context, path string) (string, error) {
     collection := m.getCollection()
-    ctx := context.Background()
     
     var item MongoItem
     err := collection.FindOne(ctx, bson.M{"_id": path}).Decode(&item)
@@ -82,7 +109,12 @@ func (m *MongoStorage) GetItem(path string, bucket ...string) (string, error) {
         }
         return "", err
     }
-    
+    return item.dataString()
+}
+
+// dataString returns the item's data as stored, encoding data that isn't
+// a string as JSON
+func (item MongoItem) dataString() (string, error) {
     if dataStr, ok := item.Data.(string); ok {
         return dataStr, nil
     }
@@ -94,10 +126,36 @@ func (m *MongoStorage) GetItem(path string, bucket ...string) (string, error) {
     return string(dataBytes), nil
 }
 
-func (m *MongoStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+// SwapItem implements Swapper with a conditional insert or update, which
+// MongoDB applies atomically per document
+func (m *MongoStorage) SwapItem(path, old, data string) (bool, error) {
     collection := m.getCollection()
     ctx := context.Background()
 
+    if old == "" {
+        _, err := collection.InsertOne(ctx, MongoItem{ID: path, Path: path, Data: data})
+        if mongo.IsDuplicateKeyError(err) {
+            return false, nil
+        }
+        return err == nil, err
+    }
+
+    result, err := collection.UpdateOne(ctx,
+        bson.M{"_id": path, "data": old},
+        bson.M{"$set": bson.M{"data": data}, "$inc": bson.M{"version": 1}})
+    if err != nil {
+        return false, err
+    }
+    return result.MatchedCount == 1, nil
+}
+
+func (m *MongoStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+    return m.existsItem(context.Background(), path)
+}
+
+func (m *MongoStorage) existsItem(ctx context.Context, path string) (bool, error) {
+    collection := m.getCollection()
+
     count, err := collection.CountDocuments(ctx, bson.M{"_id": path})
     if err != nil {
         return false, err
@@ -106,21 +164,24 @@ func (m *MongoStorage) ExistsItem(path string, bucket ...string) (bool, error) {
 }
 
 func (m *MongoStorage) DeleteItem(path string, bucket ...string) error {
+    return m.deleteItem(context.Background(), path)
+}
+
+func (m *MongoStorage) deleteItem(ctx context.Context, path string) error {
     collection := m.getCollection()
-    ctx := context.Background()
 
     _, err := collection.DeleteOne(ctx, bson.M{"_id": path})
     return err
 }
 
-func (m *MongoStorage) ensureParentDirectories(path []string) error {
+func (m *MongoStorage) ensureParentDirectories(ctx context.Context, path []string) error {
     if len(path) == 0 {
         return nil
     }
 
     // Check if directory exists
     spath := m.pathToString(path)
-    exists, err := m.ExistsItem(spath)
+    exists, err := m.existsItem(ctx, spath)
     if err != nil {
         return err
     }
@@ -130,7 +191,7 @@ func (m *MongoStorage) ensureParentDirectories(path []string) error {
 
     // Create parent directories recursively
     if len(path) > 1 {
-        err = m.ensureParentDirectories(path[:len(path)-1])
+        err = m.ensureParentDirectories(ctx, path[:len(path)-1])
         if err != nil {
             return err
         }
@@ -143,16 +204,16 @@ func (m *MongoStorage) ensureParentDirectories(path []string) error {
         return err
     }
 
-    return m.PutItem(spath, dataJSON)
+    return m.putItem(ctx, spath, dataJSON)
 }
 
-func (m *MongoStorage) CreateDir(path []string) error {
+func (m *MongoStorage) CreateDir(ctx context.Context, path []string) error {
     if len(path) == 0 {
         return fmt.Errorf("invalid path: cannot be empty")
     }
 
     spath := m.pathToString(path)
-    exists, err := m.ExistsItem(spath)
+    exists, err := m.existsItem(ctx, spath)
     if err != nil {
         return err
     }
@@ -162,7 +223,7 @@ func (m *MongoStorage) CreateDir(path []string) error {
 
     // Create parent directories recursively
     if len(path) > 1 {
-        err = m.ensureParentDirectories(path[:len(path)-1])
+        err = m.ensureParentDirectories(ctx, path[:len(path)-1])
         if err != nil {
             return err
         }
@@ -174,23 +235,76 @@ func (m *MongoStorage) CreateDir(path []string) error {
         return err
     }
 
-    return m.PutItem(spath, dataJSON)
+    return m.putItem(ctx, spath, dataJSON)
 }
 
-func (m *MongoStorage) DeleteDir(path []string) error {
+func (m *MongoStorage) DeleteDir(path []string, recursive bool) error {
     collection := m.getCollection()
     ctx := context.Background()
 
     spath := m.pathToString(path)
-    _, err := collection.DeleteMany(ctx, bson.M{
-        "path": bson.M{"$regex": "^" + spath},
-    })
+    exists, err := m.ExistsItem(spath)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return ErrNotFound
+    }
+
+    // Match on the separator so deleting home/a leaves home/ab alone
+    contents := bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(spath+"/")}}
+    if !recursive {
+        count, err := collection.CountDocuments(ctx, contents, options.Count().SetLimit(1))
+        if err != nil {
+            return err
+        }
+        if count > 0 {
+            return ErrDirNotEmpty
+        }
+    }
+
+    _, err = collection.DeleteMany(ctx, bson.M{"$or": []bson.M{{"_id": spath}, contents}})
     return err
 }
 
-func (m *MongoStorage) GetFile(path []string) (*models.StorageItem, error) {
+func (m *MongoStorage) List(path []string) ([]string, error) {
+    collection := m.getCollection()
+    ctx := context.Background()
+
+    spath := m.pathToString(path)
+    exists, err := m.ExistsItem(spath)
+    if err != nil {
+        return nil, err
+    }
+    if !exists {
+        return nil, ErrNotFound
+    }
+
+    // Only direct children: nothing but the name may follow the separator
+    filter := bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(spath+"/") + "[^/]+$"}}
+    cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+    if err != nil {
+        return nil, err
+    }
+    defer cursor.Close(ctx)
+
+    var paths []string
+    for cursor.Next(ctx) {
+        var item MongoItem
+        if err := cursor.Decode(&item); err != nil {
+            return nil, err
+        }
+        paths = append(paths, item.ID)
+    }
+    if err := cursor.Err(); err != nil {
+        return nil, err
+    }
+    return childNames(spath, paths), nil
+}
+
+func (m *MongoStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
     spath := m.pathToString(path)
-    data, err := m.GetItem(spath)
+    data, err := m.getItem(ctx, spath)
     if err != nil {
         return nil, err
     }
@@ -198,13 +312,13 @@ func (m *MongoStorage) GetFile(path []string) (*models.StorageItem, error) {
     return models.StorageItemFromJSON(data)
 }
 
-func (m *MongoStorage) CreateFile(path []string, data string) error {
+func (m *MongoStorage) CreateFile(ctx context.Context, path []string, data string) error {
     if len(path) == 0 {
         return fmt.Errorf("invalid path: cannot be empty")
     }
 
     spath := m.pathToString(path)
-    exists, err := m.ExistsItem(spath)
+    exists, err := m.existsItem(ctx, spath)
     if err != nil {
         return err
     }
@@ -214,7 +328,7 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
 
     // Create parent directories recursively if they don't exist
     if len(path) > 1 {
-        err = m.ensureParentDirectories(path[:len(path)-1])
+        err = m.ensureParentDirectories(ctx, path[:len(path)-1])
         if err != nil {
             return fmt.Errorf("failed to create parent directories: %w", err)
         }
@@ -226,17 +340,22 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
         return err
     }
 
-    err = m.PutItem(spath, dataJSON)
+    err = m.putItem(ctx, spath, dataJSON)
     if err != nil {
         return err
     }
 
-    // Update parent directory if it exists
+    return m.addToListing(ctx, path)
+}
+
+// addToListing adds the file at path to its parent directory's listing,
+// if the parent exists
+func (m *MongoStorage) addToListing(ctx context.Context, path []string) error {
     if len(path) > 1 {
         parentPath := path[:len(path)-1]
         fileName := path[len(path)-1]
         
-        parentItem, err := m.GetFile(parentPath)
+        parentItem, err := m.GetFile(ctx, parentPath)
         if err == nil { // Parent exists
             var filesList []string
             if parentData, ok := parentItem.Data.([]interface{}); ok {
@@ -266,7 +385,7 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
             }
 
             parentSPath := m.pathToString(parentPath)
-            err = m.PutItem(parentSPath, parentJSON)
+            err = m.putItem(ctx, parentSPath, parentJSON)
             if err != nil {
                 return err
             }
@@ -276,8 +395,8 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
     return nil
 }
 
-func (m *MongoStorage) UpdateFile(path []string, data string) error {
-    fileItem, err := m.GetFile(path)
+func (m *MongoStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+    fileItem, err := m.GetFile(ctx, path)
     if err != nil {
         return err
     }
@@ -292,11 +411,70 @@ func (m *MongoStorage) UpdateFile(path []string, data string) error {
     }
 
     spath := m.pathToString(path)
-    return m.PutItem(spath, dataJSON)
+    return m.putItem(ctx, spath, dataJSON)
+}
+
+// GetFileVersion implements Versioner, reading the item's write counter
+// together with its data
+func (m *MongoStorage) GetFileVersion(ctx context.Context, path []string) (*models.StorageItem, string, error) {
+    var doc MongoItem
+    err := m.getCollection().FindOne(ctx, bson.M{"_id": m.pathToString(path)}).Decode(&doc)
+    if err == mongo.ErrNoDocuments {
+        return nil, "", ErrNotFound
+    }
+    if err != nil {
+        return nil, "", err
+    }
+    data, err := doc.dataString()
+    if err != nil {
+        return nil, "", err
+    }
+    item, err := models.StorageItemFromJSON(data)
+    if err != nil {
+        return nil, "", err
+    }
+    return item, formatVersion(doc.Version), nil
+}
+
+// UpdateFileCAS implements Versioner with an update filtered on the write
+// counter, which MongoDB applies atomically per document
+func (m *MongoStorage) UpdateFileCAS(ctx context.Context, path []string, expectedVersion string, data string) (string, error) {
+    expected, err := parseVersion(expectedVersion)
+    if err != nil {
+        return "", err
+    }
+    fileItem, err := m.GetFile(ctx, path)
+    if err != nil {
+        return "", err
+    }
+    if fileItem.Type != "file" {
+        return "", fmt.Errorf("path is not a file")
+    }
+
+    fileItem.Data = data
+    dataJSON, err := fileItem.ToJSON()
+    if err != nil {
+        return "", err
+    }
+
+    filter := bson.M{"_id": m.pathToString(path), "version": expected}
+    if expected == 0 {
+        // Items written before versions were kept have no counter
+        filter["version"] = bson.M{"$in": bson.A{0, nil}}
+    }
+    result, err := m.getCollection().UpdateOne(ctx, filter,
+        bson.M{"$set": bson.M{"data": dataJSON}, "$inc": bson.M{"version": 1}})
+    if err != nil {
+        return "", err
+    }
+    if result.MatchedCount == 0 {
+        return "", ErrVersionConflict
+    }
+    return formatVersion(expected + 1), nil
 }
 
-func (m *MongoStorage) DeleteFile(path []string) error {
-    fileItem, err := m.GetFile(path)
+func (m *MongoStorage) DeleteFile(ctx context.Context, path []string) error {
+    fileItem, err := m.GetFile(ctx, path)
     if err != nil {
         return err
     }
@@ -306,7 +484,7 @@ func (m *MongoStorage) DeleteFile(path []string) error {
 
     if len(path) > 1 {
         parentPath := path[:len(path)-1]
-        parentItem, err := m.GetFile(parentPath)
+        parentItem, err := m.GetFile(ctx, parentPath)
         if err != nil {
             return err
         }
@@ -330,12 +508,94 @@ func (m *MongoStorage) DeleteFile(path []string) error {
         }
 
         parentSPath := m.pathToString(parentPath)
-        err = m.PutItem(parentSPath, parentJSON)
+        err = m.putItem(ctx, parentSPath, parentJSON)
         if err != nil {
             return err
         }
     }
 
     spath := m.pathToString(path)
-    return m.DeleteItem(spath)
+    return m.deleteItem(ctx, spath)
+}
+
+
+// Append adds data to the end of the file at path. The item document holds
+// the serialized StorageItem, which an update operator can't reach into,
+// so appends go through UpdateFileCAS and retry whenever another writer
+// got in between; a missing file is created with a conditional insert.
+// Both hold across every instance sharing the database.
+func (m *MongoStorage) Append(path []string, data []byte) error {
+    ctx := context.Background()
+    if len(path) == 0 {
+        return fmt.Errorf("invalid path: cannot be empty")
+    }
+    spath := m.pathToString(path)
+    for {
+        item, version, err := m.GetFileVersion(ctx, path)
+        if errors.Is(err, ErrNotFound) {
+            if len(path) > 1 {
+                if err := m.ensureParentDirectories(ctx, path[:len(path)-1]); err != nil {
+                    return fmt.Errorf("failed to create parent directories: %w", err)
+                }
+            }
+            created, err := models.NewStorageItem(path, "file", string(data)).ToJSON()
+            if err != nil {
+                return err
+            }
+            inserted, err := m.SwapItem(spath, "", created)
+            if err != nil {
+                return err
+            }
+            if inserted {
+                return m.addToListing(ctx, path)
+            }
+            // Another writer created it first; append to theirs
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        if item.Type != "file" {
+            return fmt.Errorf("path is not a file")
+        }
+
+        existing, _ := item.Data.(string)
+        _, err = m.UpdateFileCAS(ctx, path, version, existing+string(data))
+        if !errors.Is(err, ErrVersionConflict) {
+            return err
+        }
+    }
+}
+
+// ListItems returns every item path starting with prefix, sorted
+func (m *MongoStorage) ListItems(prefix string) ([]string, error) {
+    collection := m.getCollection()
+    ctx := context.Background()
+
+    filter := bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+    cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+    if err != nil {
+        return nil, err
+    }
+    defer cursor.Close(ctx)
+
+    var paths []string
+    for cursor.Next(ctx) {
+        var item MongoItem
+        if err := cursor.Decode(&item); err != nil {
+            return nil, err
+        }
+        paths = append(paths, item.ID)
+    }
+    if err := cursor.Err(); err != nil {
+        return nil, err
+    }
+
+    sort.Strings(paths)
+    return paths, nil
+}
+
+// Ping checks the connection to the MongoDB deployment
+func (m *MongoStorage) Ping(ctx context.Context) error {
+    return m.client.Ping(ctx, nil)
 }
@@ -0,0 +1,46 @@
+//go:build mongodb
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestMongo connects to MONGO_URI, by default a local server, using a
+// fresh database dropped after the test. Run with:
+// go test -tags mongodb ./internal/storage
+func newTestMongo(t *testing.T) *MongoStorage {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+	s, err := NewMongoStorage(uri, fmt.Sprintf("touchcalc_test_%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("NewMongoStorage failed: %v", err)
+	}
+	t.Cleanup(func() {
+		s.database.Drop(context.Background())
+		s.Close(context.Background())
+	})
+	return s
+}
+
+func TestMongoAppendConformance(t *testing.T) {
+	runAppendConformance(t, newTestMongo(t))
+}
+
+func TestMongoCASConformance(t *testing.T) {
+	runCASConformance(t, newTestMongo(t))
+}
+
+func TestMongoDeleteDirConformance(t *testing.T) {
+	runDeleteDirConformance(t, newTestMongo(t))
+}
+
+func TestMongoListConformance(t *testing.T) {
+	runListConformance(t, newTestMongo(t))
+}
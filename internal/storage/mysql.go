@@ -1,10 +1,13 @@
 package storage
 
 import (
+    "context"
     "database/sql"
+    "errors"
     // "encoding/json"
     "fmt"
     "strings"
+    "time"
 
     "github.com/c4gt/tornado-nginx-go-backend/internal/models"
     _ "github.com/go-sql-driver/mysql"
@@ -12,39 +15,65 @@ import (
 
 type MySQLStorage struct {
     db *sql.DB
+    // maxIdle is the idle connection limit ResetPool restores; zero means
+    // the database/sql default
+    maxIdle int
 }
 
+// defaultMaxIdleConns is database/sql's idle limit when none is set
+const defaultMaxIdleConns = 2
+
+// MySQLOptions adjusts NewMySQLStorageWithOptions
+type MySQLOptions struct {
+    // Create the table, and add missing columns, when the schema check
+    // finds them absent; otherwise startup fails with ErrSchemaMismatch
+    AutoMigrate bool
+
+    // Connection pool limits; zero leaves database/sql's default, which
+    // is no limit on open connections or their lifetime and two idle
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+}
+
+// NewMySQLStorage connects to dsn, creating the table if needed
 func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
+    return NewMySQLStorageWithOptions(dsn, MySQLOptions{AutoMigrate: true})
+}
+
+// NewMySQLStorageWithOptions connects to dsn and checks the table has the
+// structure the backend needs before anything is stored
+func NewMySQLStorageWithOptions(dsn string, opts MySQLOptions) (*MySQLStorage, error) {
     db, err := sql.Open("mysql", dsn)
     if err != nil {
         return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
     }
+    if opts.MaxOpenConns > 0 {
+        db.SetMaxOpenConns(opts.MaxOpenConns)
+    }
+    if opts.MaxIdleConns > 0 {
+        db.SetMaxIdleConns(opts.MaxIdleConns)
+    }
+    if opts.ConnMaxLifetime > 0 {
+        db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+    }
 
     if err := db.Ping(); err != nil {
         return nil, fmt.Errorf("failed to ping MySQL: %w", err)
     }
 
-    storage := &MySQLStorage{db: db}
-    
-    // Initialize tables
-    if err := storage.initTables(); err != nil {
-        return nil, fmt.Errorf("failed to initialize tables: %w", err)
+    storage := &MySQLStorage{db: db, maxIdle: opts.MaxIdleConns}
+    if err := storage.ensureSchema(context.Background(), opts.AutoMigrate); err != nil {
+        db.Close()
+        return nil, err
     }
 
     return storage, nil
 }
 
-func (m *MySQLStorage) initTables() error {
-    query := `
-    CREATE TABLE IF NOT EXISTS storage_items (
-        path VARCHAR(512) PRIMARY KEY,
-        type VARCHAR(10) NOT NULL,
-        data LONGTEXT
-    ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-    `
-    
-    _, err := m.db.Exec(query)
-    return err
+// Close closes the connection pool
+func (m *MySQLStorage) Close(ctx context.Context) error {
+    return m.db.Close()
 }
 
 func (m *MySQLStorage) pathToString(path []string) string {
@@ -52,21 +81,31 @@ func (m *MySQLStorage) pathToString(path []string) string {
 }
 
 func (m *MySQLStorage) PutItem(path string, data string, bucket ...string) error {
+    return m.putItem(context.Background(), path, data)
+}
+
+// putItem is PutItem giving up when ctx is done, which the file operations
+// use to pass their context on to the driver
+func (m *MySQLStorage) putItem(ctx context.Context, path string, data string) error {
     query := `
     INSERT INTO storage_items (path, type, data) 
     VALUES (?, 'item', ?) 
-    ON DUPLICATE KEY UPDATE data = VALUES(data)
+    ON DUPLICATE KEY UPDATE data = VALUES(data), version = version + 1
     `
     
-    _, err := m.db.Exec(query, path, data)
+    _, err := m.db.ExecContext(ctx, query, path, data)
     return err
 }
 
 func (m *MySQLStorage) GetItem(path string, bucket ...string) (string, error) {
+    return m.getItem(context.Background(), path)
+}
+
+func (m *MySQLStorage) getItem(ctx context.Context, path string) (string, error) {
     query := "SELECT data FROM storage_items WHERE path = ?"
     
     var data string
-    err := m.db.QueryRow(query, path).Scan(&data)
+    err := m.db.QueryRowContext(ctx, query, path).Scan(&data)
     if err != nil {
         if err == sql.ErrNoRows {
             return "", ErrNotFound
@@ -77,11 +116,41 @@ func (m *MySQLStorage) GetItem(path string, bucket ...string) (string, error) {
     return data, nil
 }
 
+// SwapItem implements Swapper with a conditional insert or update, which
+// InnoDB applies atomically per row
+func (m *MySQLStorage) SwapItem(path, old, data string) (bool, error) {
+    var result sql.Result
+    var err error
+    switch {
+    case old == "":
+        result, err = m.db.Exec("INSERT IGNORE INTO storage_items (path, type, data) VALUES (?, 'item', ?)", path, data)
+    case old == data:
+        // MySQL reports an update that changes nothing as no rows affected,
+        // so check the value instead
+        current, err := m.GetItem(path)
+        if err == ErrNotFound {
+            return false, nil
+        }
+        return err == nil && current == old, err
+    default:
+        result, err = m.db.Exec("UPDATE storage_items SET data = ?, version = version + 1 WHERE path = ? AND data = ?", data, path, old)
+    }
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n == 1, err
+}
+
 func (m *MySQLStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+    return m.existsItem(context.Background(), path)
+}
+
+func (m *MySQLStorage) existsItem(ctx context.Context, path string) (bool, error) {
     query := "SELECT COUNT(*) FROM storage_items WHERE path = ?"
     
     var count int
-    err := m.db.QueryRow(query, path).Scan(&count)
+    err := m.db.QueryRowContext(ctx, query, path).Scan(&count)
     if err != nil {
         return false, err
     }
@@ -90,16 +159,20 @@ func (m *MySQLStorage) ExistsItem(path string, bucket ...string) (bool, error) {
 }
 
 func (m *MySQLStorage) DeleteItem(path string, bucket ...string) error {
+    return m.deleteItem(context.Background(), path)
+}
+
+func (m *MySQLStorage) deleteItem(ctx context.Context, path string) error {
     query := "DELETE FROM storage_items WHERE path = ?"
     
-    _, err := m.db.Exec(query, path)
+    _, err := m.db.ExecContext(ctx, query, path)
     return err
 }
 
-func (m *MySQLStorage) CreateDir(path []string) error {
+func (m *MySQLStorage) CreateDir(ctx context.Context, path []string) error {
     spath := m.pathToString(path)
     
-    exists, err := m.ExistsItem(spath)
+    exists, err := m.existsItem(ctx, spath)
     if err != nil {
         return err
     }
@@ -113,20 +186,71 @@ func (m *MySQLStorage) CreateDir(path []string) error {
         return err
     }
 
-    return m.PutItem(spath, dataJSON)
+    return m.putItem(ctx, spath, dataJSON)
 }
 
-func (m *MySQLStorage) DeleteDir(path []string) error {
+func (m *MySQLStorage) DeleteDir(path []string, recursive bool) error {
     spath := m.pathToString(path)
-    query := "DELETE FROM storage_items WHERE path LIKE ?"
-    
-    _, err := m.db.Exec(query, spath+"%")
+    exists, err := m.ExistsItem(spath)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return ErrNotFound
+    }
+
+    // Match on the separator so deleting home/a leaves home/ab alone
+    contents := likeEscaper.Replace(spath+"/") + "%"
+    if !recursive {
+        var found int
+        err := m.db.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM storage_items WHERE path LIKE ? LIMIT 1) t", contents).Scan(&found)
+        if err != nil {
+            return err
+        }
+        if found > 0 {
+            return ErrDirNotEmpty
+        }
+    }
+
+    _, err = m.db.Exec("DELETE FROM storage_items WHERE path = ? OR path LIKE ?", spath, contents)
     return err
 }
 
-func (m *MySQLStorage) GetFile(path []string) (*models.StorageItem, error) {
+func (m *MySQLStorage) List(path []string) ([]string, error) {
     spath := m.pathToString(path)
-    data, err := m.GetItem(spath)
+    exists, err := m.ExistsItem(spath)
+    if err != nil {
+        return nil, err
+    }
+    if !exists {
+        return nil, ErrNotFound
+    }
+
+    // Direct children are under the separator with no separator after it
+    contents := likeEscaper.Replace(spath+"/") + "%"
+    rows, err := m.db.Query("SELECT path FROM storage_items WHERE path LIKE ? AND path NOT LIKE ?", contents, contents+"/%")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var paths []string
+    for rows.Next() {
+        var child string
+        if err := rows.Scan(&child); err != nil {
+            return nil, err
+        }
+        paths = append(paths, child)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    return childNames(spath, paths), nil
+}
+
+func (m *MySQLStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+    spath := m.pathToString(path)
+    data, err := m.getItem(ctx, spath)
     if err != nil {
         return nil, err
     }
@@ -134,19 +258,19 @@ func (m *MySQLStorage) GetFile(path []string) (*models.StorageItem, error) {
     return models.StorageItemFromJSON(data)
 }
 
-func (m *MySQLStorage) CreateFile(path []string, data string) error {
+func (m *MySQLStorage) CreateFile(ctx context.Context, path []string, data string) error {
     if len(path) <= 1 {
         return fmt.Errorf("invalid path: must have parent directory")
     }
 
     parentPath := path[:len(path)-1]
-    parentItem, err := m.GetFile(parentPath)
+    parentItem, err := m.GetFile(ctx, parentPath)
     if err != nil {
         return fmt.Errorf("parent directory does not exist")
     }
 
     spath := m.pathToString(path)
-    exists, err := m.ExistsItem(spath)
+    exists, err := m.existsItem(ctx, spath)
     if err != nil {
         return err
     }
@@ -160,13 +284,16 @@ func (m *MySQLStorage) CreateFile(path []string, data string) error {
         return err
     }
 
-    err = m.PutItem(spath, dataJSON)
+    err = m.putItem(ctx, spath, dataJSON)
     if err != nil {
         return err
     }
+    return m.addToListing(ctx, parentPath, parentItem, path[len(path)-1])
+}
 
-    fileName := path[len(path)-1]
-    
+// addToListing adds fileName to the listing of the directory parentItem
+// read from parentPath
+func (m *MySQLStorage) addToListing(ctx context.Context, parentPath []string, parentItem *models.StorageItem, fileName string) error {
     var filesList []string
     if parentData, ok := parentItem.Data.([]interface{}); ok {
         for _, item := range parentData {
@@ -185,11 +312,11 @@ func (m *MySQLStorage) CreateFile(path []string, data string) error {
     }
 
     parentSPath := m.pathToString(parentPath)
-    return m.PutItem(parentSPath, parentJSON)
+    return m.putItem(ctx, parentSPath, parentJSON)
 }
 
-func (m *MySQLStorage) UpdateFile(path []string, data string) error {
-    fileItem, err := m.GetFile(path)
+func (m *MySQLStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+    fileItem, err := m.GetFile(ctx, path)
     if err != nil {
         return err
     }
@@ -204,11 +331,67 @@ func (m *MySQLStorage) UpdateFile(path []string, data string) error {
     }
 
     spath := m.pathToString(path)
-    return m.PutItem(spath, dataJSON)
+    return m.putItem(ctx, spath, dataJSON)
+}
+
+// GetFileVersion implements Versioner, reading the row's write counter
+// together with its data
+func (m *MySQLStorage) GetFileVersion(ctx context.Context, path []string) (*models.StorageItem, string, error) {
+    var data string
+    var version int64
+    err := m.db.QueryRowContext(ctx, "SELECT data, version FROM storage_items WHERE path = ?", m.pathToString(path)).Scan(&data, &version)
+    if err == sql.ErrNoRows {
+        return nil, "", ErrNotFound
+    }
+    if err != nil {
+        return nil, "", err
+    }
+    item, err := models.StorageItemFromJSON(data)
+    if err != nil {
+        return nil, "", err
+    }
+    return item, formatVersion(version), nil
 }
 
-func (m *MySQLStorage) DeleteFile(path []string) error {
-    fileItem, err := m.GetFile(path)
+// UpdateFileCAS implements Versioner with an update conditioned on the
+// write counter, which InnoDB applies atomically per row
+func (m *MySQLStorage) UpdateFileCAS(ctx context.Context, path []string, expectedVersion string, data string) (string, error) {
+    expected, err := parseVersion(expectedVersion)
+    if err != nil {
+        return "", err
+    }
+    fileItem, err := m.GetFile(ctx, path)
+    if err != nil {
+        return "", err
+    }
+    if fileItem.Type != "file" {
+        return "", fmt.Errorf("path is not a file")
+    }
+
+    fileItem.Data = data
+    dataJSON, err := fileItem.ToJSON()
+    if err != nil {
+        return "", err
+    }
+
+    // The counter always moves, so a matching row is always affected
+    result, err := m.db.ExecContext(ctx, "UPDATE storage_items SET data = ?, version = version + 1 WHERE path = ? AND version = ?",
+        dataJSON, m.pathToString(path), expected)
+    if err != nil {
+        return "", err
+    }
+    n, err := result.RowsAffected()
+    if err != nil {
+        return "", err
+    }
+    if n == 0 {
+        return "", ErrVersionConflict
+    }
+    return formatVersion(expected + 1), nil
+}
+
+func (m *MySQLStorage) DeleteFile(ctx context.Context, path []string) error {
+    fileItem, err := m.GetFile(ctx, path)
     if err != nil {
         return err
     }
@@ -218,7 +401,7 @@ func (m *MySQLStorage) DeleteFile(path []string) error {
 
     if len(path) > 1 {
         parentPath := path[:len(path)-1]
-        parentItem, err := m.GetFile(parentPath)
+        parentItem, err := m.GetFile(ctx, parentPath)
         if err != nil {
             return err
         }
@@ -242,12 +425,245 @@ func (m *MySQLStorage) DeleteFile(path []string) error {
         }
 
         parentSPath := m.pathToString(parentPath)
-        err = m.PutItem(parentSPath, parentJSON)
+        err = m.putItem(ctx, parentSPath, parentJSON)
         if err != nil {
             return err
         }
     }
 
     spath := m.pathToString(path)
-    return m.DeleteItem(spath)
+    return m.deleteItem(ctx, spath)
+}
+
+// mysqlAppend creates a file holding the first argument's item, or, when
+// the row exists, concatenates the second argument onto the data inside
+// its stored JSON. InnoDB applies it atomically per row, so appends from
+// every instance sharing the database land without a read-modify-write.
+const mysqlAppend = `
+    INSERT INTO storage_items (path, type, data)
+    VALUES (?, 'item', ?)
+    ON DUPLICATE KEY UPDATE
+        data = JSON_SET(data, '$.data', CONCAT(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(data, '$.data')), ''), ?)),
+        version = version + 1
+    `
+
+// Append implements Storage with mysqlAppend. Only the append that
+// inserted the row adds the file to its directory's listing.
+func (m *MySQLStorage) Append(path []string, data []byte) error {
+    ctx := context.Background()
+    if len(path) <= 1 {
+        return fmt.Errorf("invalid path: must have parent directory")
+    }
+    spath := m.pathToString(path)
+
+    current, err := m.getItem(ctx, spath)
+    if err == nil {
+        item, err := models.StorageItemFromJSON(current)
+        if err != nil {
+            return err
+        }
+        if item.Type != "file" {
+            return fmt.Errorf("path is not a file")
+        }
+    } else if !errors.Is(err, ErrNotFound) {
+        return err
+    }
+
+    parentPath := path[:len(path)-1]
+    parentItem, err := m.GetFile(ctx, parentPath)
+    if err != nil {
+        return fmt.Errorf("parent directory does not exist")
+    }
+    created, err := models.NewStorageItem(path, "file", string(data)).ToJSON()
+    if err != nil {
+        return err
+    }
+
+    result, err := m.db.ExecContext(ctx, mysqlAppend, spath, created, string(data))
+    if err != nil {
+        return err
+    }
+    // One row affected is an insert, two an update of an existing row
+    if n, err := result.RowsAffected(); err != nil || n != 1 {
+        return err
+    }
+    return m.addToListing(ctx, parentPath, parentItem, path[len(path)-1])
+}
+
+// likeEscaper quotes the LIKE wildcards in a literal path prefix
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListItems returns every item path starting with prefix, sorted
+func (m *MySQLStorage) ListItems(prefix string) ([]string, error) {
+    escaped := likeEscaper.Replace(prefix)
+    rows, err := m.db.Query("SELECT path FROM storage_items WHERE path LIKE ? ORDER BY path", escaped+"%")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var paths []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            return nil, err
+        }
+        paths = append(paths, path)
+    }
+    return paths, rows.Err()
+}
+
+// Ping checks the database connection
+func (m *MySQLStorage) Ping(ctx context.Context) error {
+    return m.db.PingContext(ctx)
+}
+
+// PoolStats reports the state of the sql.DB connection pool
+func (m *MySQLStorage) PoolStats() PoolStats {
+    stats := m.db.Stats()
+    return PoolStats{
+        InUse:   stats.InUse,
+        Idle:    stats.Idle,
+        MaxOpen: stats.MaxOpenConnections,
+    }
+}
+
+// ResetPool closes every idle connection, which may have died with the
+// server, so later operations dial new ones
+func (m *MySQLStorage) ResetPool() {
+    m.db.SetMaxIdleConns(0)
+    m.db.SetMaxIdleConns(m.idleLimit())
+}
+
+// idleLimit is the pool's idle connection limit
+func (m *MySQLStorage) idleLimit() int {
+    if m.maxIdle == 0 {
+        return defaultMaxIdleConns
+    }
+    return m.maxIdle
+}
+
+// Warmup opens conns connections at once and returns them to the pool idle,
+// so the first requests don't pay for dialing. The idle limit is raised to
+// conns if lower, so the warmed connections are kept.
+func (m *MySQLStorage) Warmup(ctx context.Context, conns int) error {
+    if max := m.db.Stats().MaxOpenConnections; max > 0 && conns > max {
+        conns = max
+    }
+    if conns > m.idleLimit() {
+        m.db.SetMaxIdleConns(conns)
+        m.maxIdle = conns
+    }
+
+    held := make([]*sql.Conn, 0, conns)
+    defer func() {
+        for _, conn := range held {
+            conn.Close()
+        }
+    }()
+
+    for i := 0; i < conns; i++ {
+        conn, err := m.db.Conn(ctx)
+        if err != nil {
+            return fmt.Errorf("failed to open pooled connection: %w", err)
+        }
+        held = append(held, conn)
+        if err := conn.PingContext(ctx); err != nil {
+            return fmt.Errorf("failed to ping pooled connection: %w", err)
+        }
+    }
+    return nil
+}
+
+// semiSyncActive reports whether the server is currently waiting for a
+// replica to acknowledge each commit. MySQL 8.0.26 renamed the status
+// variable, so both spellings are checked.
+func (m *MySQLStorage) semiSyncActive() (bool, error) {
+    rows, err := m.db.Query(`SHOW GLOBAL STATUS WHERE Variable_name IN ('Rpl_semi_sync_source_status', 'Rpl_semi_sync_master_status')`)
+    if err != nil {
+        return false, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var name, value string
+        if err := rows.Scan(&name, &value); err != nil {
+            return false, err
+        }
+        if strings.EqualFold(value, "ON") {
+            return true, nil
+        }
+    }
+    return false, rows.Err()
+}
+
+// Durable returns a view of the store that requires semi-synchronous
+// replication. MySQL cannot raise durability per statement, so the view
+// checks after every write that the source is still running semi-sync;
+// if it fell back to asynchronous replication the write is reported as
+// not durable.
+func (m *MySQLStorage) Durable() (Storage, error) {
+    active, err := m.semiSyncActive()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read semi-sync status: %w", err)
+    }
+    if !active {
+        return nil, fmt.Errorf("%w: semi-synchronous replication is not enabled", ErrNotDurable)
+    }
+    return &mysqlDurable{m}, nil
+}
+
+type mysqlDurable struct {
+    *MySQLStorage
+}
+
+func (d *mysqlDurable) verify(err error) error {
+    if err != nil {
+        return err
+    }
+    active, err := d.semiSyncActive()
+    if err != nil {
+        return fmt.Errorf("failed to confirm replication: %w", err)
+    }
+    if !active {
+        return fmt.Errorf("%w: semi-synchronous replication fell back to asynchronous", ErrNotDurable)
+    }
+    return nil
+}
+
+func (d *mysqlDurable) PutItem(path string, data string, bucket ...string) error {
+    return d.verify(d.MySQLStorage.PutItem(path, data, bucket...))
+}
+
+func (d *mysqlDurable) DeleteItem(path string, bucket ...string) error {
+    return d.verify(d.MySQLStorage.DeleteItem(path, bucket...))
+}
+
+func (d *mysqlDurable) CreateDir(ctx context.Context, path []string) error {
+    return d.verify(d.MySQLStorage.CreateDir(ctx, path))
+}
+
+func (d *mysqlDurable) DeleteDir(path []string, recursive bool) error {
+    return d.verify(d.MySQLStorage.DeleteDir(path, recursive))
+}
+
+func (d *mysqlDurable) CreateFile(ctx context.Context, path []string, data string) error {
+    return d.verify(d.MySQLStorage.CreateFile(ctx, path, data))
+}
+
+func (d *mysqlDurable) UpdateFile(ctx context.Context, path []string, data string) error {
+    return d.verify(d.MySQLStorage.UpdateFile(ctx, path, data))
+}
+
+func (d *mysqlDurable) DeleteFile(ctx context.Context, path []string) error {
+    return d.verify(d.MySQLStorage.DeleteFile(ctx, path))
+}
+
+func (d *mysqlDurable) Append(path []string, data []byte) error {
+    return d.verify(d.MySQLStorage.Append(path, data))
+}
+
+func (d *mysqlDurable) UpdateFileCAS(ctx context.Context, path []string, expectedVersion string, data string) (string, error) {
+    version, err := d.MySQLStorage.UpdateFileCAS(ctx, path, expectedVersion, data)
+    return version, d.verify(err)
 }
@@ -0,0 +1,153 @@
+//go:build mysql
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestMySQL connects to MYSQL_DSN, by default a local touchcalc_test
+// database, and empties its table. Run with:
+// go test -tags mysql ./internal/storage
+func newTestMySQL(t *testing.T) *MySQLStorage {
+	s, err := NewMySQLStorage(mysqlTestDSN())
+	if err != nil {
+		t.Fatalf("NewMySQLStorage failed: %v", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM storage_items"); err != nil {
+		t.Fatalf("emptying storage_items failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestMySQLAppendConformance(t *testing.T) {
+	runAppendConformance(t, newTestMySQL(t))
+}
+
+func TestMySQLCASConformance(t *testing.T) {
+	runCASConformance(t, newTestMySQL(t))
+}
+
+func TestMySQLDeleteDirConformance(t *testing.T) {
+	runDeleteDirConformance(t, newTestMySQL(t))
+}
+
+func TestMySQLListConformance(t *testing.T) {
+	runListConformance(t, newTestMySQL(t))
+}
+
+// mysqlTestDSN is the database the tests above use
+func mysqlTestDSN() string {
+	if dsn := os.Getenv("MYSQL_DSN"); dsn != "" {
+		return dsn
+	}
+	return "root:password@tcp(localhost:3306)/touchcalc_test"
+}
+
+func TestMySQLSchemaMissingTable(t *testing.T) {
+	s := newTestMySQL(t)
+	if _, err := s.db.Exec("DROP TABLE storage_items"); err != nil {
+		t.Fatalf("dropping storage_items failed: %v", err)
+	}
+
+	if _, err := NewMySQLStorageWithOptions(mysqlTestDSN(), MySQLOptions{AutoMigrate: false}); !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("without auto-migration: err = %v, want ErrSchemaMismatch", err)
+	}
+
+	migrated, err := NewMySQLStorageWithOptions(mysqlTestDSN(), MySQLOptions{AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("with auto-migration: %v", err)
+	}
+	defer migrated.Close(context.Background())
+	if err := migrated.PutItem("schema/check", "ok"); err != nil {
+		t.Errorf("PutItem on the created table failed: %v", err)
+	}
+}
+
+func TestMySQLSchemaMissingColumn(t *testing.T) {
+	s := newTestMySQL(t)
+	if _, err := s.db.Exec("ALTER TABLE storage_items DROP COLUMN type"); err != nil {
+		t.Fatalf("dropping column failed: %v", err)
+	}
+
+	_, err := NewMySQLStorageWithOptions(mysqlTestDSN(), MySQLOptions{AutoMigrate: false})
+	if !errors.Is(err, ErrSchemaMismatch) || !strings.Contains(err.Error(), "column type is missing") {
+		t.Fatalf("without auto-migration: err = %v, want the missing column reported", err)
+	}
+	migrated, err := NewMySQLStorageWithOptions(mysqlTestDSN(), MySQLOptions{AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("with auto-migration: %v", err)
+	}
+	migrated.Close(context.Background())
+}
+
+func TestMySQLTinyPoolSerializesOperations(t *testing.T) {
+	newTestMySQL(t) // empties the table
+	s, err := NewMySQLStorageWithOptions(mysqlTestDSN(), MySQLOptions{
+		AutoMigrate:     true,
+		MaxOpenConns:    2,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewMySQLStorageWithOptions failed: %v", err)
+	}
+	defer s.Close(context.Background())
+	if max := s.PoolStats().MaxOpen; max != 2 {
+		t.Fatalf("MaxOpen = %d, want 2", max)
+	}
+
+	// Many more writers than connections wait their turn instead of
+	// failing; each has its own directory, as listings aren't updated
+	// atomically
+	const writers, perWriter = 16, 10
+	ctx := context.Background()
+	if err := s.CreateDir(ctx, []string{"pool"}); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	for w := 0; w < writers; w++ {
+		if err := s.CreateDir(ctx, []string{"pool", fmt.Sprint(w)}); err != nil {
+			t.Fatalf("CreateDir failed: %v", err)
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				path := []string{"pool", fmt.Sprint(w), fmt.Sprint(i)}
+				if err := s.CreateFile(ctx, path, "data"); err != nil {
+					t.Errorf("CreateFile %v failed: %v", path, err)
+					return
+				}
+				if _, err := s.GetFile(ctx, path); err != nil {
+					t.Errorf("GetFile %v failed: %v", path, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if stats := s.PoolStats(); stats.InUse+stats.Idle > 2 {
+		t.Errorf("pool holds %d connections, want at most 2", stats.InUse+stats.Idle)
+	}
+	for w := 0; w < writers; w++ {
+		names, err := s.List([]string{"pool", fmt.Sprint(w)})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(names) != perWriter {
+			t.Errorf("writer %d: listed %d files, want %d", w, len(names), perWriter)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSchemaMismatch is returned at startup when the MySQL table doesn't
+// have the structure the backend needs and it can't, or may not, be
+// migrated
+var ErrSchemaMismatch = errors.New("mysql schema mismatch")
+
+// mysqlTable is the table the MySQL backend keeps everything in
+const mysqlTable = "storage_items"
+
+// mysqlColumn is a column of mysqlTable as information_schema describes it
+type mysqlColumn struct {
+	Name      string
+	DataType  string
+	MaxLength int64 // characters, for string types
+	Nullable  bool
+	Key       string
+}
+
+// mysqlColumns is the structure the backend expects, and addColumn the
+// DDL that adds each column to an existing table, or "" when it can't be
+// added after the fact
+var mysqlColumns = []struct {
+	mysqlColumn
+	addColumn string
+}{
+	{mysqlColumn{Name: "path", DataType: "varchar", MaxLength: 512, Key: "PRI"}, ""},
+	{mysqlColumn{Name: "type", DataType: "varchar", MaxLength: 10}, "ADD COLUMN type VARCHAR(10) NOT NULL DEFAULT 'item'"},
+	{mysqlColumn{Name: "data", DataType: "longtext", Nullable: true}, "ADD COLUMN data LONGTEXT"},
+	{mysqlColumn{Name: "version", DataType: "bigint"}, "ADD COLUMN version BIGINT NOT NULL DEFAULT 0"},
+}
+
+const createMySQLTable = `CREATE TABLE IF NOT EXISTS storage_items (
+	path VARCHAR(512) PRIMARY KEY,
+	type VARCHAR(10) NOT NULL,
+	data LONGTEXT,
+	version BIGINT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+
+// ensureSchema checks mysqlTable against mysqlColumns. With autoMigrate
+// set a missing table is created and missing columns are added; columns
+// of the wrong type are never rewritten, as they may hold data. Anything
+// left wrong is an ErrSchemaMismatch listing every problem.
+func (m *MySQLStorage) ensureSchema(ctx context.Context, autoMigrate bool) error {
+	columns, err := m.tableColumns(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema of %s: %w", mysqlTable, err)
+	}
+	if len(columns) == 0 {
+		if !autoMigrate {
+			return fmt.Errorf("%w: table %s does not exist; create it or enable auto-migration", ErrSchemaMismatch, mysqlTable)
+		}
+		if _, err := m.db.ExecContext(ctx, createMySQLTable); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", mysqlTable, err)
+		}
+		return nil
+	}
+
+	missing, problems := schemaProblems(columns)
+	for _, name := range missing {
+		ddl := addColumnDDL(name)
+		if !autoMigrate || ddl == "" {
+			problems = append(problems, fmt.Sprintf("column %s is missing", name))
+			continue
+		}
+		if _, err := m.db.ExecContext(ctx, "ALTER TABLE "+mysqlTable+" "+ddl); err != nil {
+			return fmt.Errorf("failed to add column %s to %s: %w", name, mysqlTable, err)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w in table %s: %s", ErrSchemaMismatch, mysqlTable, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// tableColumns returns the columns of mysqlTable by name, none when the
+// table doesn't exist
+func (m *MySQLStorage) tableColumns(ctx context.Context) (map[string]mysqlColumn, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, IS_NULLABLE, COLUMN_KEY
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, mysqlTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]mysqlColumn)
+	for rows.Next() {
+		var c mysqlColumn
+		var maxLength sql.NullInt64
+		var nullable string
+		if err := rows.Scan(&c.Name, &c.DataType, &maxLength, &nullable, &c.Key); err != nil {
+			return nil, err
+		}
+		c.Name = strings.ToLower(c.Name)
+		c.DataType = strings.ToLower(c.DataType)
+		c.MaxLength = maxLength.Int64
+		c.Nullable = nullable == "YES"
+		columns[c.Name] = c
+	}
+	return columns, rows.Err()
+}
+
+// schemaProblems compares actual columns with mysqlColumns, returning the
+// names of missing columns and a description of each one that exists but
+// can't hold what the backend stores
+func schemaProblems(actual map[string]mysqlColumn) (missing []string, problems []string) {
+	for _, want := range mysqlColumns {
+		got, ok := actual[want.Name]
+		if !ok {
+			missing = append(missing, want.Name)
+			continue
+		}
+		if got.DataType != want.DataType {
+			problems = append(problems, fmt.Sprintf("column %s is %s, want %s", want.Name, got.DataType, want.DataType))
+			continue
+		}
+		if want.MaxLength > 0 && got.MaxLength < want.MaxLength {
+			problems = append(problems, fmt.Sprintf("column %s holds %d characters, want at least %d", want.Name, got.MaxLength, want.MaxLength))
+		}
+		if want.Key != "" && got.Key != want.Key {
+			problems = append(problems, fmt.Sprintf("column %s is not the primary key", want.Name))
+		}
+	}
+	return missing, problems
+}
+
+func addColumnDDL(name string) string {
+	for _, c := range mysqlColumns {
+		if c.Name == name {
+			return c.addColumn
+		}
+	}
+	return ""
+}
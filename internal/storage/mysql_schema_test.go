@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaProblems(t *testing.T) {
+	good := map[string]mysqlColumn{
+		"path":    {Name: "path", DataType: "varchar", MaxLength: 512, Key: "PRI"},
+		"type":    {Name: "type", DataType: "varchar", MaxLength: 10},
+		"data":    {Name: "data", DataType: "longtext", MaxLength: 4294967295, Nullable: true},
+		"version": {Name: "version", DataType: "bigint"},
+	}
+	if missing, problems := schemaProblems(good); missing != nil || problems != nil {
+		t.Fatalf("expected schema: missing %v, problems %v", missing, problems)
+	}
+
+	bad := map[string]mysqlColumn{
+		"path": {Name: "path", DataType: "varchar", MaxLength: 255, Key: "PRI"},
+		"data": {Name: "data", DataType: "blob"},
+	}
+	missing, problems := schemaProblems(bad)
+	if !reflect.DeepEqual(missing, []string{"type", "version"}) {
+		t.Errorf("missing = %v, want [type version]", missing)
+	}
+	want := []string{
+		"column path holds 255 characters, want at least 512",
+		"column data is blob, want longtext",
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
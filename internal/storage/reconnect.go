@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Resetter is implemented by backends whose pool can hold connections that
+// died with the server. ResetPool drops the idle ones so the next operation
+// dials afresh. The MongoDB driver clears its pool itself when its
+// heartbeat sees the server go away, so only MySQL needs this.
+type Resetter interface {
+	ResetPool()
+}
+
+// IsConnError reports whether err means the backend connection failed, as
+// opposed to the operation itself, so repeating it on a new connection may
+// succeed
+func IsConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var selectErr topology.ServerSelectionError
+	switch {
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, mysql.ErrInvalidConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &netErr),
+		errors.As(err, &selectErr),
+		mongo.IsNetworkError(err):
+		return true
+	}
+	return false
+}
+
+// ReconnectPolicy says how often an operation that failed on a dead
+// connection is retried, and how long to wait between attempts
+type ReconnectPolicy struct {
+	Retries int
+	Backoff time.Duration
+}
+
+// Reconnect wraps s so operations that fail with a connection error are
+// retried after resetting the pool, letting requests ride out a failover
+// or restart instead of failing until the process restarts. CreateFile
+// and Append are never retried: the first attempt may have been applied
+// before the connection dropped, and repeating it would not be safe.
+func Reconnect(s Storage, policy ReconnectPolicy) Storage {
+	if policy.Retries <= 0 {
+		return s
+	}
+	return &reconnecting{s: s, policy: policy}
+}
+
+type reconnecting struct {
+	s      Storage
+	policy ReconnectPolicy
+}
+
+func (r *reconnecting) retry(op func() error) error {
+	return r.retryContext(context.Background(), op)
+}
+
+// retryContext runs op again after each connection error until the
+// retries run out, or ctx is done
+func (r *reconnecting) retryContext(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 0; attempt < r.policy.Retries && IsConnError(err); attempt++ {
+		if resetter, ok := Unwrap(r.s).(Resetter); ok {
+			resetter.ResetPool()
+		}
+		select {
+		case <-time.After(r.policy.Backoff << attempt):
+		case <-ctx.Done():
+			return err
+		}
+		err = op()
+	}
+	return err
+}
+
+func (r *reconnecting) CreateFile(ctx context.Context, path []string, data string) error {
+	return r.s.CreateFile(ctx, path, data)
+}
+
+func (r *reconnecting) GetFile(ctx context.Context, path []string) (item *models.StorageItem, err error) {
+	err = r.retryContext(ctx, func() error {
+		item, err = r.s.GetFile(ctx, path)
+		return err
+	})
+	return item, err
+}
+
+func (r *reconnecting) UpdateFile(ctx context.Context, path []string, data string) error {
+	return r.retryContext(ctx, func() error { return r.s.UpdateFile(ctx, path, data) })
+}
+
+func (r *reconnecting) DeleteFile(ctx context.Context, path []string) error {
+	return r.retryContext(ctx, func() error { return r.s.DeleteFile(ctx, path) })
+}
+
+func (r *reconnecting) Append(path []string, data []byte) error {
+	return r.s.Append(path, data)
+}
+
+func (r *reconnecting) CreateDir(ctx context.Context, path []string) error {
+	return r.retryContext(ctx, func() error { return r.s.CreateDir(ctx, path) })
+}
+
+func (r *reconnecting) DeleteDir(path []string, recursive bool) error {
+	return r.retry(func() error { return r.s.DeleteDir(path, recursive) })
+}
+
+func (r *reconnecting) List(path []string) (names []string, err error) {
+	err = r.retry(func() error {
+		names, err = r.s.List(path)
+		return err
+	})
+	return names, err
+}
+
+func (r *reconnecting) PutItem(path string, data string, bucket ...string) error {
+	return r.retry(func() error { return r.s.PutItem(path, data, bucket...) })
+}
+
+func (r *reconnecting) GetItem(path string, bucket ...string) (data string, err error) {
+	err = r.retry(func() error {
+		data, err = r.s.GetItem(path, bucket...)
+		return err
+	})
+	return data, err
+}
+
+func (r *reconnecting) ExistsItem(path string, bucket ...string) (exists bool, err error) {
+	err = r.retry(func() error {
+		exists, err = r.s.ExistsItem(path, bucket...)
+		return err
+	})
+	return exists, err
+}
+
+func (r *reconnecting) DeleteItem(path string, bucket ...string) error {
+	return r.retry(func() error { return r.s.DeleteItem(path, bucket...) })
+}
+
+// Unwrap returns the Storage behind the retries
+func (r *reconnecting) Unwrap() Storage {
+	return r.s
+}
+
+// WatchConnection pings s every interval until ctx is done. A ping failing
+// on a dead connection resets the pool before the backend is reported
+// down, and once a ping succeeds again the pool is reset once more so no
+// request is handed a connection that died during the outage. Backends
+// that can't be pinged aren't watched. A wrapped backend, as behind
+// CachedStorage, is watched itself.
+func WatchConnection(ctx context.Context, s Storage, interval time.Duration) {
+	s = Unwrap(s)
+	if _, ok := s.(Pinger); !ok || interval <= 0 {
+		return
+	}
+	watcher := &connectionWatcher{s: s, timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			watcher.check(ctx)
+		}
+	}
+}
+
+// connectionWatcher remembers whether the last ping failed
+type connectionWatcher struct {
+	s       Storage
+	timeout time.Duration
+	down    bool
+}
+
+func (w *connectionWatcher) check(ctx context.Context) {
+	err := w.ping(ctx)
+	if IsConnError(err) {
+		// A pooled connection that died fails the ping even when the
+		// server is up, so drop them and ask again on a fresh one
+		w.reset()
+		err = w.ping(ctx)
+	}
+	switch {
+	case err != nil && !w.down:
+		w.down = true
+		log.Printf("Storage connection lost: %v", err)
+	case err == nil && w.down:
+		w.down = false
+		w.reset()
+		log.Printf("Storage connection restored")
+	}
+}
+
+func (w *connectionWatcher) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	return w.s.(Pinger).Ping(ctx)
+}
+
+func (w *connectionWatcher) reset() {
+	if resetter, ok := w.s.(Resetter); ok {
+		resetter.ResetPool()
+	}
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// restartableServer is a database/sql driver standing in for a MySQL
+// server that can go down and come back. Connections dialed before a
+// restart stay in the pool but fail like the real driver's do: queries
+// with ErrInvalidConn, pings with ErrBadConn.
+type restartableServer struct {
+	mu         sync.Mutex
+	up         bool
+	generation int
+	items      map[string]string
+}
+
+func (s *restartableServer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.up = false
+}
+
+func (s *restartableServer) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.up = true
+	s.generation++
+}
+
+func (s *restartableServer) Open(name string) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.up {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	return &restartableConn{server: s, generation: s.generation}, nil
+}
+
+type restartableConn struct {
+	server     *restartableServer
+	generation int
+}
+
+func (c *restartableConn) alive() bool {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	return c.server.up && c.server.generation == c.generation
+}
+
+func (c *restartableConn) Ping(ctx context.Context) error {
+	if !c.alive() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *restartableConn) Prepare(query string) (driver.Stmt, error) {
+	if !c.alive() {
+		return nil, mysql.ErrInvalidConn
+	}
+	return restartableStmt{c.server}, nil
+}
+
+func (c *restartableConn) Close() error { return nil }
+
+func (c *restartableConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type restartableStmt struct {
+	server *restartableServer
+}
+
+func (restartableStmt) Close() error  { return nil }
+func (restartableStmt) NumInput() int { return -1 }
+
+// Exec stores an item the way PutItem's insert does, by path and data
+func (s restartableStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	s.server.items[args[0].(string)] = args[1].(string)
+	return driver.RowsAffected(1), nil
+}
+
+// Query answers GetItem's select by path
+func (s restartableStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	return &itemRows{data: s.server.items[args[0].(string)]}, nil
+}
+
+type itemRows struct {
+	data string
+	done bool
+}
+
+func (r *itemRows) Columns() []string { return []string{"data"} }
+func (r *itemRows) Close() error      { return nil }
+
+func (r *itemRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.data
+	return nil
+}
+
+var restartableCount int
+
+// newRestartableStore returns a MySQLStorage on a running server with
+// idle connections pooled, as after serving some traffic
+func newRestartableStore(t *testing.T) (*MySQLStorage, *restartableServer) {
+	server := &restartableServer{up: true, items: make(map[string]string)}
+	restartableCount++
+	name := fmt.Sprintf("restartable-%d", restartableCount)
+	sql.Register(name, server)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := &MySQLStorage{db: db}
+	if err := Warmup(context.Background(), store, 4); err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+	if err := store.PutItem("home/alice/sheet", "data"); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	return store, server
+}
+
+func TestWatchConnectionResetsPoolWhenServerReturns(t *testing.T) {
+	store, server := newRestartableStore(t)
+	watcher := &connectionWatcher{s: store, timeout: time.Second}
+	ctx := context.Background()
+
+	server.stop()
+	watcher.check(ctx)
+	if !watcher.down {
+		t.Fatal("a failed ping should mark the connection down")
+	}
+	if _, err := store.GetItem("home/alice/sheet"); !IsConnError(err) {
+		t.Fatalf("GetItem while down: err = %v, want a connection error", err)
+	}
+
+	// The ping that notices the server is back resets the pool, so no
+	// request is handed a connection from before the restart
+	server.start()
+	watcher.check(ctx)
+	if watcher.down {
+		t.Fatal("a successful ping should mark the connection restored")
+	}
+	for i := 0; i < 4; i++ {
+		if data, err := store.GetItem("home/alice/sheet"); err != nil || data != "data" {
+			t.Fatalf("GetItem after recovery = %q, %v; want data", data, err)
+		}
+	}
+}
+
+func TestReconnectRetriesAcrossRestart(t *testing.T) {
+	store, server := newRestartableStore(t)
+	s := Reconnect(store, ReconnectPolicy{Retries: 2, Backoff: time.Millisecond})
+
+	// A restart nobody noticed leaves the pool full of dead connections
+	server.stop()
+	server.start()
+	if _, err := store.GetItem("home/alice/sheet"); !errors.Is(err, mysql.ErrInvalidConn) {
+		t.Fatalf("GetItem on a stale connection: err = %v, want ErrInvalidConn", err)
+	}
+
+	// The failed attempt resets the pool and the retry dials the server
+	if data, err := s.GetItem("home/alice/sheet"); err != nil || data != "data" {
+		t.Fatalf("GetItem after restart = %q, %v; want data", data, err)
+	}
+	if err := s.PutItem("home/alice/other", "more"); err != nil {
+		t.Errorf("PutItem after restart failed: %v", err)
+	}
+
+	server.stop()
+	if _, err := s.GetItem("home/alice/sheet"); !IsConnError(err) {
+		t.Errorf("GetItem while down: err = %v, want a connection error", err)
+	}
+}
+
+func TestReconnectStopsRetryingWhenContextDone(t *testing.T) {
+	store, server := newRestartableStore(t)
+	s := Reconnect(store, ReconnectPolicy{Retries: 5, Backoff: time.Minute})
+
+	server.stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.GetFile(ctx, []string{"home", "alice", "sheet"}); err == nil {
+		t.Error("GetFile while down succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetFile took %v, want it to give up with the context", elapsed)
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	for _, err := range []error{
+		driver.ErrBadConn,
+		mysql.ErrInvalidConn,
+		fmt.Errorf("query: %w", syscall.ECONNRESET),
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+	} {
+		if !IsConnError(err) {
+			t.Errorf("IsConnError(%v) = false, want true", err)
+		}
+	}
+	for _, err := range []error{nil, ErrNotFound, ErrDirNotEmpty, sql.ErrNoRows} {
+		if IsConnError(err) {
+			t.Errorf("IsConnError(%v) = true, want false", err)
+		}
+	}
+}
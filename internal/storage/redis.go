@@ -0,0 +1,350 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisListingRetries bounds how often a directory listing update is
+// retried after losing to a concurrent writer
+const redisListingRetries = 50
+
+// redisScanCount is the batch size hinted to SCAN and used for deletes
+const redisScanCount = 500
+
+// RedisStorage keeps every item as a string key, the path joined by "/".
+// Directories are items of their own listing their files, as with the
+// other backends.
+type RedisStorage struct {
+	client *redis.Client
+}
+
+// swapScript implements SwapItem atomically on the server. An empty old
+// value means the key must not exist.
+var swapScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if (ARGV[1] == '' and not current) or current == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// NewRedisStorage connects to the Redis server at uri, e.g.
+// redis://:password@localhost:6379/0
+func NewRedisStorage(uri string) (*RedisStorage, error) {
+	opts, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URI: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	return &RedisStorage{client: client}, nil
+}
+
+// Close closes the client's connections
+func (r *RedisStorage) Close(ctx context.Context) error {
+	return r.client.Close()
+}
+
+func (r *RedisStorage) pathToString(path []string) string {
+	return strings.Join(path, "/")
+}
+
+func (r *RedisStorage) PutItem(path string, data string, bucket ...string) error {
+	return r.client.Set(context.Background(), path, data, 0).Err()
+}
+
+func (r *RedisStorage) GetItem(path string, bucket ...string) (string, error) {
+	return r.getItem(context.Background(), path)
+}
+
+// getItem is GetItem giving up when ctx is done, which the file operations
+// use to pass their context on to the client
+func (r *RedisStorage) getItem(ctx context.Context, path string) (string, error) {
+	data, err := r.client.Get(ctx, path).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return data, err
+}
+
+func (r *RedisStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	n, err := r.client.Exists(context.Background(), path).Result()
+	return n > 0, err
+}
+
+func (r *RedisStorage) DeleteItem(path string, bucket ...string) error {
+	return r.client.Del(context.Background(), path).Err()
+}
+
+// SwapItem implements Swapper with a server-side script, which Redis runs
+// atomically
+func (r *RedisStorage) SwapItem(path, old, data string) (bool, error) {
+	swapped, err := swapScript.Run(context.Background(), r.client, []string{path}, old, data).Int()
+	return swapped == 1, err
+}
+
+// CreateDir creates the directory at path and any missing parents. An
+// existing directory is left as it is.
+func (r *RedisStorage) CreateDir(ctx context.Context, path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	for depth := 1; depth <= len(path); depth++ {
+		level := path[:depth]
+		dirJSON, err := models.NewStorageItem(level, "dir", []string{}).ToJSON()
+		if err != nil {
+			return err
+		}
+		// SETNX keeps an existing listing, even when racing another creator
+		if err := r.client.SetNX(ctx, r.pathToString(level), dirJSON, 0).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisStorage) DeleteDir(path []string, recursive bool) error {
+	spath := r.pathToString(path)
+	exists, err := r.ExistsItem(spath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	// Match on the separator so deleting home/a leaves home/ab alone
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, redisGlobEscape(spath+"/")+"*", redisScanCount).Iterator()
+	var batch []string
+	for iter.Next(ctx) {
+		if !recursive {
+			return ErrDirNotEmpty
+		}
+		batch = append(batch, iter.Val())
+		if len(batch) == redisScanCount {
+			if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return r.client.Unlink(ctx, append(batch, spath)...).Err()
+}
+
+// List scans for everything under the directory, since a MATCH pattern
+// can't stop at the next separator, and keeps the direct children
+func (r *RedisStorage) List(path []string) ([]string, error) {
+	spath := r.pathToString(path)
+	exists, err := r.ExistsItem(spath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	paths, err := r.ListItems(spath + "/")
+	if err != nil {
+		return nil, err
+	}
+	return childNames(spath, paths), nil
+}
+
+func (r *RedisStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	data, err := r.getItem(ctx, r.pathToString(path))
+	if err != nil {
+		return nil, err
+	}
+	return models.StorageItemFromJSON(data)
+}
+
+// CreateFile writes a new file, creating its parent directories as
+// needed, and lists it in its parent
+func (r *RedisStorage) CreateFile(ctx context.Context, path []string, data string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("invalid path: cannot be empty")
+	}
+	if len(path) > 1 {
+		if err := r.CreateDir(ctx, path[:len(path)-1]); err != nil {
+			return fmt.Errorf("failed to create parent directories: %w", err)
+		}
+	}
+
+	fileJSON, err := models.NewStorageItem(path, "file", data).ToJSON()
+	if err != nil {
+		return err
+	}
+	created, err := r.client.SetNX(ctx, r.pathToString(path), fileJSON, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("file already exists")
+	}
+
+	if len(path) == 1 {
+		return nil
+	}
+	name := path[len(path)-1]
+	return r.updateListing(ctx, path[:len(path)-1], func(names []string) []string {
+		for _, existing := range names {
+			if existing == name {
+				return names
+			}
+		}
+		return append(names, name)
+	})
+}
+
+func (r *RedisStorage) UpdateFile(ctx context.Context, path []string, data string) error {
+	item, err := r.GetFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+
+	item.Data = data
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.pathToString(path), itemJSON, 0).Err()
+}
+
+func (r *RedisStorage) DeleteFile(ctx context.Context, path []string) error {
+	item, err := r.GetFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return fmt.Errorf("path is not a file")
+	}
+
+	if len(path) > 1 {
+		name := path[len(path)-1]
+		err := r.updateListing(ctx, path[:len(path)-1], func(names []string) []string {
+			kept := names[:0]
+			for _, existing := range names {
+				if existing != name {
+					kept = append(kept, existing)
+				}
+			}
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return r.client.Del(ctx, r.pathToString(path)).Err()
+}
+
+// updateListing rewrites the file list of the directory at dir inside an
+// optimistic transaction, so concurrent creates and deletes in the same
+// directory, from any instance, don't drop each other's entries
+func (r *RedisStorage) updateListing(ctx context.Context, dir []string, update func([]string) []string) error {
+	key := r.pathToString(dir)
+	apply := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		item, err := models.StorageItemFromJSON(data)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		if entries, ok := item.Data.([]interface{}); ok {
+			for _, entry := range entries {
+				if name, ok := entry.(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		names = update(names)
+		if names == nil {
+			names = []string{}
+		}
+		item.Data = names
+		itemJSON, err := item.ToJSON()
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, itemJSON, 0)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < redisListingRetries; attempt++ {
+		err := r.client.Watch(ctx, apply, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("updating listing of %s: too many concurrent writers", key)
+}
+
+// Append adds data to the end of the file at path. The value holds the
+// serialized StorageItem, so appends are done read-modify-write under a
+// per-path lock.
+func (r *RedisStorage) Append(path []string, data []byte) error {
+	return appendLocked(r, path, data)
+}
+
+// ListItems returns every item path starting with prefix, sorted
+func (r *RedisStorage) ListItems(prefix string) ([]string, error) {
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, redisGlobEscape(prefix)+"*", redisScanCount).Iterator()
+	var paths []string
+	for iter.Next(ctx) {
+		paths = append(paths, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Ping checks the connection to the Redis server
+func (r *RedisStorage) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// PoolStats reports the state of the client's connection pool
+func (r *RedisStorage) PoolStats() PoolStats {
+	stats := r.client.PoolStats()
+	return PoolStats{
+		InUse:   int(stats.TotalConns) - int(stats.IdleConns),
+		Idle:    int(stats.IdleConns),
+		MaxOpen: r.client.Options().PoolSize,
+	}
+}
+
+// redisGlobEscape quotes the characters SCAN MATCH treats as wildcards
+var redisGlobEscape = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace
@@ -0,0 +1,100 @@
+//go:build redis
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// newTestRedis connects to REDIS_URI, by default database 15 of a local
+// server, and empties it. Run with: go test -tags redis ./internal/storage
+func newTestRedis(t *testing.T) *RedisStorage {
+	uri := os.Getenv("REDIS_URI")
+	if uri == "" {
+		uri = "redis://localhost:6379/15"
+	}
+	s, err := NewRedisStorage(uri)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	if err := s.client.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatalf("FlushDB failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func TestRedisFiles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestRedis(t)
+	path := []string{"home", "alice", "sheet"}
+
+	if err := s.CreateFile(ctx, path, "v1"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if err := s.CreateFile(ctx, path, "v1"); err == nil {
+		t.Error("creating an existing file should fail")
+	}
+	if err := s.UpdateFile(ctx, path, "v2"); err != nil {
+		t.Fatalf("UpdateFile failed: %v", err)
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil || item.Data != "v2" {
+		t.Fatalf("GetFile = %v, %v; want v2", item, err)
+	}
+
+	dir, err := s.GetFile(ctx, []string{"home", "alice"})
+	if err != nil {
+		t.Fatalf("parent directory was not created: %v", err)
+	}
+	if names, _ := dir.Data.([]interface{}); len(names) != 1 || names[0] != "sheet" {
+		t.Errorf("parent listing = %v, want [sheet]", dir.Data)
+	}
+
+	// Creating the directory again must keep its listing
+	if err := s.CreateDir(ctx, []string{"home", "alice"}); err != nil {
+		t.Fatalf("CreateDir on an existing directory failed: %v", err)
+	}
+	if dir, _ := s.GetFile(ctx, []string{"home", "alice"}); len(dir.Data.([]interface{})) != 1 {
+		t.Errorf("CreateDir reset the listing to %v", dir.Data)
+	}
+
+	if err := s.DeleteFile(ctx, path); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if _, err := s.GetFile(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted file: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisSwapItem(t *testing.T) {
+	s := newTestRedis(t)
+
+	if ok, err := s.SwapItem("lock", "", "a"); err != nil || !ok {
+		t.Fatalf("swap on a missing key = %v, %v; want true", ok, err)
+	}
+	if ok, _ := s.SwapItem("lock", "", "b"); ok {
+		t.Error("swap expecting absence should fail once the key exists")
+	}
+	if ok, _ := s.SwapItem("lock", "a", "c"); !ok {
+		t.Error("swap with the current value should succeed")
+	}
+	if data, _ := s.GetItem("lock"); data != "c" {
+		t.Errorf("GetItem = %q, want c", data)
+	}
+}
+
+func TestRedisAppendConformance(t *testing.T) {
+	runAppendConformance(t, newTestRedis(t))
+}
+
+func TestRedisDeleteDirConformance(t *testing.T) {
+	runDeleteDirConformance(t, newTestRedis(t))
+}
+
+func TestRedisListConformance(t *testing.T) {
+	runListConformance(t, newTestRedis(t))
+}
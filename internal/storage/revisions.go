@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevisionsDir is the directory, alongside a file, holding its revisions
+const RevisionsDir = ".revisions"
+
+var revisionLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+// revisionDir returns where revisions of the file at path are kept, e.g.
+// home/u/sheet1 -> home/u/.revisions/sheet1
+func revisionDir(path []string) []string {
+	dir := append([]string{}, path[:len(path)-1]...)
+	return append(dir, RevisionsDir, path[len(path)-1])
+}
+
+// lastRevision guards against two saves in the same clock tick producing
+// the same revision name
+var lastRevision struct {
+	sync.Mutex
+	n int64
+}
+
+// nextRevisionName returns a name that sorts after every earlier one
+func nextRevisionName() string {
+	lastRevision.Lock()
+	defer lastRevision.Unlock()
+	n := time.Now().UnixNano()
+	if n <= lastRevision.n {
+		n = lastRevision.n + 1
+	}
+	lastRevision.n = n
+	return fmt.Sprintf("%020d", n)
+}
+
+// RevisionTime returns when the revision name was saved; names are the
+// save time in nanoseconds, nudged forward when two saves share a tick
+func RevisionTime(name string) (time.Time, bool) {
+	nanos, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos).UTC(), true
+}
+
+// Revisions returns the revision names of the file at path, oldest first
+func Revisions(ctx context.Context, s Storage, path []string) ([]string, error) {
+	item, err := s.GetFile(ctx, revisionDir(path))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if entries, ok := item.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetRevision returns the content of one revision of the file at path
+func GetRevision(ctx context.Context, s Storage, path []string, name string) (string, error) {
+	item, err := s.GetFile(ctx, append(revisionDir(path), name))
+	if err != nil {
+		return "", err
+	}
+	data, ok := item.Data.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid revision data format")
+	}
+	return data, nil
+}
+
+// SaveRevision records data as the newest revision of the file at path,
+// returning its name, and then prunes the oldest revisions so at most max
+// remain. The revision just written is always kept; max <= 0 keeps every
+// revision.
+func SaveRevision(ctx context.Context, s Storage, path []string, data string, max int) (string, error) {
+	if len(path) == 0 {
+		return "", fmt.Errorf("invalid path: cannot be empty")
+	}
+	dir := revisionDir(path)
+	unlock := revisionLocks.lock(strings.Join(dir, "/"))
+	defer unlock()
+
+	if err := ensureDirs(ctx, s, dir, len(path)); err != nil {
+		return "", err
+	}
+	name := nextRevisionName()
+	if err := s.CreateFile(ctx, append(dir, name), data); err != nil {
+		return "", err
+	}
+	if max <= 0 {
+		return name, nil
+	}
+
+	names, err := Revisions(ctx, s, path)
+	if err != nil || len(names) <= max {
+		return name, err
+	}
+	excess, keep := names[:len(names)-max], names[len(names)-max:]
+	for _, old := range excess {
+		if err := s.DeleteFile(ctx, append(dir, old)); err != nil && err != ErrNotFound {
+			return "", fmt.Errorf("failed to prune revision %s: %w", old, err)
+		}
+	}
+
+	// Not every backend drops deleted files from the listing, so rewrite it
+	dirItem, err := s.GetFile(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	dirItem.Data = keep
+	dirJSON, err := dirItem.ToJSON()
+	if err != nil {
+		return "", err
+	}
+	return name, s.PutItem(strings.Join(dir, "/"), dirJSON)
+}
+
+// ensureDirs creates the levels of dir from depth from downwards that don't
+// exist yet. Backends differ on CreateDir for an existing directory, so
+// levels are checked first rather than created unconditionally.
+func ensureDirs(ctx context.Context, s Storage, dir []string, from int) error {
+	for i := from; i <= len(dir); i++ {
+		level := dir[:i]
+		exists, err := s.ExistsItem(strings.Join(level, "/"))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := s.CreateDir(ctx, level); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteHistory removes the revisions and change log kept for the file at
+// path. Missing history is not an error.
+func DeleteHistory(ctx context.Context, s Storage, path []string) error {
+	log := changeLogPath(path)
+	exists, err := s.ExistsItem(strings.Join(log, "/"))
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := s.DeleteFile(ctx, log); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	if err := s.DeleteDir(revisionDir(path), true); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newSheetStorage(t *testing.T) (*fakeStorage, []string) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	for _, dir := range [][]string{{"home"}, {"home", "alice@example.com"}} {
+		if err := s.CreateDir(ctx, dir); err != nil {
+			t.Fatalf("CreateDir failed: %v", err)
+		}
+	}
+	path := []string{"home", "alice@example.com", "budget"}
+	if err := s.CreateFile(ctx, path, "v0"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	return s, path
+}
+
+func saveRevisions(t *testing.T, s Storage, path []string, count, max int) {
+	for i := 1; i <= count; i++ {
+		if _, err := SaveRevision(context.Background(), s, path, fmt.Sprintf("v%d", i), max); err != nil {
+			t.Fatalf("SaveRevision %d failed: %v", i, err)
+		}
+	}
+}
+
+func TestSaveRevisionPrunesOldest(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+
+	saveRevisions(t, s, path, 3, 3)
+	first, err := Revisions(ctx, s, path)
+	if err != nil || len(first) != 3 {
+		t.Fatalf("Revisions = %v, %v; want 3 revisions", first, err)
+	}
+
+	saveRevisions(t, s, path, 1, 3)
+	names, err := Revisions(ctx, s, path)
+	if err != nil {
+		t.Fatalf("Revisions failed: %v", err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("history has %d revisions, want 3", len(names))
+	}
+	if names[0] != first[1] {
+		t.Errorf("oldest remaining revision = %s, want %s", names[0], first[1])
+	}
+	if _, err := GetRevision(ctx, s, path, first[0]); err != ErrNotFound {
+		t.Errorf("pruned revision still readable: %v", err)
+	}
+
+	latest, err := GetRevision(ctx, s, path, names[2])
+	if err != nil || latest != "v1" {
+		t.Errorf("latest revision = %q, %v; want v1", latest, err)
+	}
+}
+
+func TestSaveRevisionHistoryStaysCapped(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+
+	saveRevisions(t, s, path, 10, 4)
+
+	names, err := Revisions(ctx, s, path)
+	if err != nil {
+		t.Fatalf("Revisions failed: %v", err)
+	}
+	var contents []string
+	for _, name := range names {
+		data, err := GetRevision(ctx, s, path, name)
+		if err != nil {
+			t.Fatalf("GetRevision %s failed: %v", name, err)
+		}
+		contents = append(contents, data)
+	}
+	if fmt.Sprint(contents) != "[v7 v8 v9 v10]" {
+		t.Errorf("history = %v, want the 4 newest revisions", contents)
+	}
+}
+
+func TestSaveRevisionKeepsLatestWithLimitOne(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+
+	saveRevisions(t, s, path, 3, 1)
+
+	names, _ := Revisions(ctx, s, path)
+	if len(names) != 1 {
+		t.Fatalf("history has %d revisions, want 1", len(names))
+	}
+	if data, _ := GetRevision(ctx, s, path, names[0]); data != "v3" {
+		t.Errorf("kept revision = %q, want v3", data)
+	}
+}
+
+func TestSaveRevisionZeroIsUnlimited(t *testing.T) {
+	s, path := newSheetStorage(t)
+
+	saveRevisions(t, s, path, 25, 0)
+
+	names, _ := Revisions(context.Background(), s, path)
+	if len(names) != 25 {
+		t.Errorf("history has %d revisions, want 25", len(names))
+	}
+}
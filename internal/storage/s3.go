@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -19,6 +20,8 @@ import (
 type S3Storage struct {
 	client     *s3.Client
 	bucketName string
+	// contentType tags every stored object, DefaultContentType unless set
+	contentType string
 }
 
 func NewS3Storage(bucketName, endpoint, accessKey, secretKey, region string, useSSL bool) (*S3Storage, error) {
@@ -58,8 +61,9 @@ func NewS3Storage(bucketName, endpoint, accessKey, secretKey, region string, use
     })
 
     storage := &S3Storage{
-        client:     client,
-        bucketName: bucketName,
+        client:      client,
+        bucketName:  bucketName,
+        contentType: DefaultContentType,
     }
 
     err = storage.ensureBucketExists(context.TODO())
@@ -75,27 +79,40 @@ func (s *S3Storage) pathToString(path []string) string {
 }
 
 func (s *S3Storage) PutItem(path string, data string, bucket ...string) error {
+	return s.putItem(context.TODO(), path, data, bucket...)
+}
+
+// putItem is PutItem giving up when ctx is done, which the file operations
+// use to pass their context on to the client
+func (s *S3Storage) putItem(ctx context.Context, path string, data string, bucket ...string) error {
 	bucketName := s.bucketName
 	if len(bucket) > 0 && bucket[0] != "" {
 		bucketName = bucket[0]
 	}
 
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(path),
-		Body:   strings.NewReader(data),
+	// Every item is a serialized StorageItem, so tag it for downloads and
+	// bucket browsers
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(path),
+		Body:        strings.NewReader(data),
+		ContentType: aws.String(s.contentType),
 	})
 
 	return err
 }
 
 func (s *S3Storage) GetItem(path string, bucket ...string) (string, error) {
+    return s.getItem(context.TODO(), path, bucket...)
+}
+
+func (s *S3Storage) getItem(ctx context.Context, path string, bucket ...string) (string, error) {
     bucketName := s.bucketName
     if len(bucket) > 0 && bucket[0] != "" {
         bucketName = bucket[0]
     }
 
-    result, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+    result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
         Bucket: aws.String(bucketName),
         Key:    aws.String(path),
     })
@@ -124,12 +141,16 @@ func (s *S3Storage) GetItem(path string, bucket ...string) (string, error) {
 }
 
 func (s *S3Storage) ExistsItem(path string, bucket ...string) (bool, error) {
+	return s.existsItem(context.TODO(), path, bucket...)
+}
+
+func (s *S3Storage) existsItem(ctx context.Context, path string, bucket ...string) (bool, error) {
 	bucketName := s.bucketName
 	if len(bucket) > 0 && bucket[0] != "" {
 		bucketName = bucket[0]
 	}
 
-	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(path),
 	})
@@ -145,12 +166,16 @@ func (s *S3Storage) ExistsItem(path string, bucket ...string) (bool, error) {
 }
 
 func (s *S3Storage) DeleteItem(path string, bucket ...string) error {
+	return s.deleteItem(context.TODO(), path, bucket...)
+}
+
+func (s *S3Storage) deleteItem(ctx context.Context, path string, bucket ...string) error {
 	bucketName := s.bucketName
 	if len(bucket) > 0 && bucket[0] != "" {
 		bucketName = bucket[0]
 	}
 
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(path),
 	})
@@ -158,10 +183,10 @@ func (s *S3Storage) DeleteItem(path string, bucket ...string) error {
 	return err
 }
 
-func (s *S3Storage) CreateDir(path []string) error {
+func (s *S3Storage) CreateDir(ctx context.Context, path []string) error {
 	spath := s.pathToString(path)
 
-	exists, err := s.ExistsItem(spath)
+	exists, err := s.existsItem(ctx, spath)
 	if err != nil {
 		return err
 	}
@@ -176,18 +201,100 @@ func (s *S3Storage) CreateDir(path []string) error {
 		return err
 	}
 
-	return s.PutItem(spath, dataJSON)
+	return s.putItem(ctx, spath, dataJSON)
 }
 
-func (s *S3Storage) DeleteDir(path []string) error {
-	// TODO: Implement directory deletion
-	// This should recursively delete all files in the directory
-	return fmt.Errorf("delete directory not implemented")
+func (s *S3Storage) DeleteDir(path []string, recursive bool) error {
+	spath := s.pathToString(path)
+	exists, err := s.ExistsItem(spath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	// List on the separator so deleting home/a leaves home/ab alone
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(spath + "/"),
+	}
+	if !recursive {
+		input.MaxKeys = aws.Int32(1)
+		page, err := s.client.ListObjectsV2(context.TODO(), input)
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) > 0 {
+			return ErrDirNotEmpty
+		}
+		return s.DeleteItem(spath)
+	}
+
+	// Pages hold at most 1000 keys, the most one DeleteObjects call takes
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return err
+		}
+		var objects []types.ObjectIdentifier
+		for _, object := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: object.Key})
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		out, err := s.client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("failed to delete %d objects under %s: %s", len(out.Errors), spath, aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return s.DeleteItem(spath)
 }
 
-func (s *S3Storage) GetFile(path []string) (*models.StorageItem, error) {
+func (s *S3Storage) List(path []string) ([]string, error) {
 	spath := s.pathToString(path)
-	data, err := s.GetItem(spath)
+	exists, err := s.ExistsItem(spath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	// With the delimiter, anything deeper is rolled up into the common
+	// prefix of the subdirectory it sits in
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucketName),
+		Prefix:    aws.String(spath + "/"),
+		Delimiter: aws.String("/"),
+	})
+	var paths []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			paths = append(paths, aws.ToString(object.Key))
+		}
+		for _, prefix := range page.CommonPrefixes {
+			paths = append(paths, aws.ToString(prefix.Prefix))
+		}
+	}
+	return childNames(spath, paths), nil
+}
+
+func (s *S3Storage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	spath := s.pathToString(path)
+	data, err := s.getItem(ctx, spath)
 	if err != nil {
 		return nil, err
 	}
@@ -195,21 +302,21 @@ func (s *S3Storage) GetFile(path []string) (*models.StorageItem, error) {
 	return models.StorageItemFromJSON(data)
 }
 
-func (s *S3Storage) CreateFile(path []string, data string) error {
+func (s *S3Storage) CreateFile(ctx context.Context, path []string, data string) error {
 	// Check if parent directory exists
 	if len(path) <= 1 {
 		return fmt.Errorf("invalid path: must have parent directory")
 	}
 
 	parentPath := path[:len(path)-1]
-	parentItem, err := s.GetFile(parentPath)
+	parentItem, err := s.GetFile(ctx, parentPath)
 	if err != nil {
 		return fmt.Errorf("parent directory does not exist")
 	}
 
 	// Check if file already exists
 	spath := s.pathToString(path)
-	exists, err := s.ExistsItem(spath)
+	exists, err := s.existsItem(ctx, spath)
 	if err != nil {
 		return err
 	}
@@ -225,7 +332,7 @@ func (s *S3Storage) CreateFile(path []string, data string) error {
 	}
 
 	// Save the file
-	err = s.PutItem(spath, dataJSON)
+	err = s.putItem(ctx, spath, dataJSON)
 	if err != nil {
 		return err
 	}
@@ -253,12 +360,12 @@ func (s *S3Storage) CreateFile(path []string, data string) error {
 	}
 
 	parentSPath := s.pathToString(parentPath)
-	return s.PutItem(parentSPath, parentJSON)
+	return s.putItem(ctx, parentSPath, parentJSON)
 }
 
-func (s *S3Storage) UpdateFile(path []string, data string) error {
+func (s *S3Storage) UpdateFile(ctx context.Context, path []string, data string) error {
 	// Check if file exists
-	fileItem, err := s.GetFile(path)
+	fileItem, err := s.GetFile(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -274,7 +381,7 @@ func (s *S3Storage) UpdateFile(path []string, data string) error {
 	}
 
 	spath := s.pathToString(path)
-	return s.PutItem(spath, dataJSON)
+	return s.putItem(ctx, spath, dataJSON)
 }
 
 func (s *S3Storage) ensureBucketExists(ctx context.Context) error {
@@ -320,9 +427,9 @@ func (s *S3Storage) ensureBucketExists(ctx context.Context) error {
     return nil
 }
 
-func (s *S3Storage) DeleteFile(path []string) error {
+func (s *S3Storage) DeleteFile(ctx context.Context, path []string) error {
 	// Get file to ensure it exists and is a file
-	fileItem, err := s.GetFile(path)
+	fileItem, err := s.GetFile(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -333,7 +440,7 @@ func (s *S3Storage) DeleteFile(path []string) error {
 	// Update parent directory
 	if len(path) > 1 {
 		parentPath := path[:len(path)-1]
-		parentItem, err := s.GetFile(parentPath)
+		parentItem, err := s.GetFile(ctx, parentPath)
 		if err != nil {
 			return err
 		}
@@ -359,7 +466,7 @@ func (s *S3Storage) DeleteFile(path []string) error {
 		}
 
 		parentSPath := s.pathToString(parentPath)
-		err = s.PutItem(parentSPath, parentJSON)
+		err = s.putItem(ctx, parentSPath, parentJSON)
 		if err != nil {
 			return err
 		}
@@ -367,5 +474,49 @@ func (s *S3Storage) DeleteFile(path []string) error {
 
 	// Delete the file
 	spath := s.pathToString(path)
-	return s.DeleteItem(spath)
+	return s.deleteItem(ctx, spath)
+}
+
+// Append adds data to the end of the file at path. S3 objects are
+// immutable, so appends rewrite the object under a per-path lock.
+func (s *S3Storage) Append(path []string, data []byte) error {
+	return appendLocked(s, path, data)
+}
+
+// ListItems returns every object key starting with prefix, sorted
+func (s *S3Storage) ListItems(prefix string) ([]string, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	var paths []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			if object.Key != nil {
+				paths = append(paths, *object.Key)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Ping checks that the bucket is reachable
+func (s *S3Storage) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucketName),
+	})
+	return err
+}
+
+// Durable returns the store itself: S3 only acknowledges a PUT once the
+// object is stored redundantly, so every write is already durable
+func (s *S3Storage) Durable() (Storage, error) {
+	return s, nil
 }
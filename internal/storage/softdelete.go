@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SoftDeleteDir is where SoftDeleter keeps deleted items, under home
+const SoftDeleteDir = ".trash"
+
+// softDeleted is a trash entry: the deleted file's data and where it lived
+type softDeleted struct {
+	Path      []string  `json:"path"`
+	DeletedAt time.Time `json:"deletedat"`
+	Data      string    `json:"data"`
+}
+
+// SoftDeleter deletes files by moving them into home/.trash, where they
+// stay until restored or purged. Unlike Trash, which keeps each user's
+// deleted sheets in their own home, it takes any file path, so it also
+// covers records outside a home such as user accounts. Each path has at
+// most one entry: deleting a path again replaces the earlier copy.
+type SoftDeleter struct {
+	storage Storage
+
+	now func() time.Time
+}
+
+// NewSoftDeleter soft-deletes files in s
+func NewSoftDeleter(s Storage) *SoftDeleter {
+	return &SoftDeleter{storage: s, now: time.Now}
+}
+
+func (d *SoftDeleter) dir() []string {
+	return []string{"home", SoftDeleteDir}
+}
+
+// entryPath is the trash entry for the file at path, named after the whole
+// path so entries from different directories never collide
+func (d *SoftDeleter) entryPath(path []string) []string {
+	return append(d.dir(), url.PathEscape(strings.Join(path, "/")))
+}
+
+// SoftDelete moves the file at path into the trash
+func (d *SoftDeleter) SoftDelete(ctx context.Context, path []string) error {
+	item, err := d.storage.GetFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if item.Type == "dir" {
+		return fmt.Errorf("%s is a directory", strings.Join(path, "/"))
+	}
+	data, ok := item.Data.(string)
+	if !ok {
+		return fmt.Errorf("invalid file %s", strings.Join(path, "/"))
+	}
+
+	unlock := LockPath(d.dir())
+	defer unlock()
+	if err := ensureDirs(ctx, d.storage, d.dir(), 1); err != nil {
+		return err
+	}
+	entry, err := json.Marshal(softDeleted{Path: path, DeletedAt: d.now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	entryPath := d.entryPath(path)
+	if err := d.storage.DeleteFile(ctx, entryPath); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := d.storage.CreateFile(ctx, entryPath, string(entry)); err != nil {
+		return fmt.Errorf("failed to move %s to the trash: %w", strings.Join(path, "/"), err)
+	}
+	return d.storage.DeleteFile(ctx, path)
+}
+
+// Restore moves the file soft-deleted from path back into place. It is
+// ErrNotFound when nothing from path is in the trash, and
+// ErrRestoreConflict when path has been reused since.
+func (d *SoftDeleter) Restore(ctx context.Context, path []string) error {
+	unlock := LockPath(d.dir())
+	defer unlock()
+	entryPath := d.entryPath(path)
+	entry, err := d.entry(ctx, entryPath)
+	if err != nil {
+		return err
+	}
+
+	exists, err := d.storage.ExistsItem(strings.Join(path, "/"))
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrRestoreConflict
+	}
+	if err := d.storage.CreateFile(ctx, path, entry.Data); err != nil {
+		return err
+	}
+	return d.storage.DeleteFile(ctx, entryPath)
+}
+
+// PurgeTrash permanently deletes entries that have been in the trash
+// longer than olderThan, returning how many went
+func (d *SoftDeleter) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	unlock := LockPath(d.dir())
+	defer unlock()
+	names, err := d.storage.List(d.dir())
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := d.now().Add(-olderThan)
+	purged := 0
+	for _, name := range names {
+		entryPath := append(d.dir(), name)
+		entry, err := d.entry(ctx, entryPath)
+		if err != nil {
+			return purged, err
+		}
+		if entry.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := d.storage.DeleteFile(ctx, entryPath); err != nil && !errors.Is(err, ErrNotFound) {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (d *SoftDeleter) entry(ctx context.Context, entryPath []string) (*softDeleted, error) {
+	item, err := d.storage.GetFile(ctx, entryPath)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+	var entry softDeleted
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return nil, fmt.Errorf("invalid trash entry %s: %w", strings.Join(entryPath, "/"), err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	path := []string{"home", "users", "alice@example.com"}
+	if err := s.CreateFile(ctx, path, `{"email":"alice@example.com"}`); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	deleter := NewSoftDeleter(s)
+
+	if err := deleter.SoftDelete(ctx, path); err != nil {
+		t.Fatalf("SoftDelete failed: %v", err)
+	}
+	if _, err := s.GetFile(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("file still in place after SoftDelete: %v", err)
+	}
+	if names, _ := s.List(path[:2]); len(names) != 0 {
+		t.Errorf("file still listed after SoftDelete: %v", names)
+	}
+
+	if err := deleter.Restore(ctx, path); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil || item.Data != `{"email":"alice@example.com"}` {
+		t.Errorf("restored file = %v, %v; want the original data", item, err)
+	}
+	if err := deleter.Restore(ctx, path); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Restore = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSoftDeleteRestoreConflict(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	path := []string{"home", "users", "alice@example.com"}
+	if err := s.CreateFile(ctx, path, "old"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	deleter := NewSoftDeleter(s)
+	if err := deleter.SoftDelete(ctx, path); err != nil {
+		t.Fatalf("SoftDelete failed: %v", err)
+	}
+	if err := s.CreateFile(ctx, path, "new"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	if err := deleter.Restore(ctx, path); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("Restore over a reused path = %v, want ErrRestoreConflict", err)
+	}
+	if item, _ := s.GetFile(ctx, path); item == nil || item.Data != "new" {
+		t.Errorf("file at the reused path = %v, want it untouched", item)
+	}
+}
+
+func TestSoftDeleteRefusesDirectories(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	if err := s.CreateDir(ctx, []string{"home", "alice@example.com"}); err != nil {
+		t.Fatalf("CreateDir failed: %v", err)
+	}
+	if err := NewSoftDeleter(s).SoftDelete(ctx, []string{"home", "alice@example.com"}); err == nil {
+		t.Error("SoftDelete of a directory should fail")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	deleter := NewSoftDeleter(s)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, name := range []string{"old", "recent"} {
+		path := []string{"home", "users", name}
+		if err := s.CreateFile(ctx, path, name); err != nil {
+			t.Fatalf("CreateFile failed: %v", err)
+		}
+		deleter.now = func() time.Time { return start.Add(time.Duration(i) * 48 * time.Hour) }
+		if err := deleter.SoftDelete(ctx, path); err != nil {
+			t.Fatalf("SoftDelete failed: %v", err)
+		}
+	}
+
+	deleter.now = func() time.Time { return start.Add(72 * time.Hour) }
+	purged, err := deleter.PurgeTrash(ctx, 30*time.Hour)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeTrash = %d, %v; want 1", purged, err)
+	}
+	if err := deleter.Restore(ctx, []string{"home", "users", "old"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore of a purged file = %v, want ErrNotFound", err)
+	}
+	if err := deleter.Restore(ctx, []string{"home", "users", "recent"}); err != nil {
+		t.Errorf("Restore of a file inside the threshold failed: %v", err)
+	}
+}
+
+func TestPurgeTrashWithNothingDeleted(t *testing.T) {
+	purged, err := NewSoftDeleter(NewMemoryStorage()).PurgeTrash(context.Background(), time.Hour)
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeTrash = %d, %v; want 0", purged, err)
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+func TestStatReportsJSONForStringWrites(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	s.CreateDir(ctx, []string{"home"})
+	s.CreateDir(ctx, []string{"home", "users"})
+
+	user, err := models.NewUser("alice@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userJSON, _ := user.ToJSON()
+	path := []string{"home", "users", "alice@example.com"}
+	if err := s.CreateFile(ctx, path, userJSON); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	info, err := Stat(ctx, s, path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.ContentType != "application/json" {
+		t.Errorf("ContentType = %q, want application/json", info.ContentType)
+	}
+	if info.Type != "file" || info.Size != len(userJSON) {
+		t.Errorf("info = %+v, want a file of %d bytes", info, len(userJSON))
+	}
+}
+
+func TestBinaryWriteKeepsItsContentType(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeStorage()
+	s.CreateDir(ctx, []string{"home"})
+	s.CreateDir(ctx, []string{"home", "alice"})
+
+	png := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff}
+	path := []string{"home", "alice", "chart.png"}
+	if err := WriteBinary(ctx, s, path, png, "image/png"); err != nil {
+		t.Fatalf("WriteBinary failed: %v", err)
+	}
+
+	info, err := Stat(ctx, s, path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.ContentType != "image/png" || info.Size != len(png) {
+		t.Errorf("info = %+v, want image/png of %d bytes", info, len(png))
+	}
+
+	data, contentType, err := ReadBinary(ctx, s, path)
+	if err != nil {
+		t.Fatalf("ReadBinary failed: %v", err)
+	}
+	if !bytes.Equal(data, png) || contentType != "image/png" {
+		t.Errorf("ReadBinary = %v %q, want original bytes as image/png", data, contentType)
+	}
+
+	// Overwriting keeps the parent listing to a single entry
+	if err := WriteBinary(ctx, s, path, []byte("GIF89a"), "image/gif"); err != nil {
+		t.Fatalf("WriteBinary overwrite failed: %v", err)
+	}
+	if info, _ := Stat(ctx, s, path); info.ContentType != "image/gif" {
+		t.Errorf("ContentType after overwrite = %q", info.ContentType)
+	}
+	dir, _ := s.GetFile(ctx, []string{"home", "alice"})
+	if entries, _ := dir.Data.([]interface{}); len(entries) != 1 {
+		t.Errorf("parent listing = %v, want one entry", dir.Data)
+	}
+}
@@ -1,6 +1,7 @@
 package storage_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
@@ -9,25 +10,26 @@ import (
 )
 
 func TestCreateGetUpdateDeleteFile(t *testing.T) {
+	ctx := context.Background()
 	store := testutils.NewMockStorage()
 
 	path := []string{"home", "user1", "securestore", "app", "file1.txt"}
 
-	err := store.CreateDir([]string{"home", "user1", "securestore", "app"})
+	err := store.CreateDir(ctx, []string{"home", "user1", "securestore", "app"})
 	assert.NoError(t, err)
 
 	fileData := models.NewStorageItem(path, "file", "test content")
 	dataJSON, _ := fileData.ToJSON()
-	err = store.CreateFile(path, dataJSON)
+	err = store.CreateFile(ctx, path, dataJSON)
 	assert.NoError(t, err)
 
-	item, err := store.GetFile(path)
+	item, err := store.GetFile(ctx, path)
 	assert.NoError(t, err)
 	assert.Equal(t, "test content", item.Data)
 
-	err = store.UpdateFile(path, `{"data":"updated"}`)
+	err = store.UpdateFile(ctx, path, `{"data":"updated"}`)
 	assert.NoError(t, err)
 
-	err = store.DeleteFile(path)
+	err = store.DeleteFile(ctx, path)
 	assert.NoError(t, err)
 }
@@ -0,0 +1,56 @@
+package storage
+
+import "errors"
+
+// Swapper is implemented by backends with an atomic compare-and-swap on raw
+// items, which holds across every instance sharing the backend
+type Swapper interface {
+	// SwapItem writes data at path only if the item currently holds old,
+	// or, when old is empty, only if it doesn't exist. It reports whether
+	// the write happened.
+	SwapItem(path, old, data string) (bool, error)
+}
+
+var swapLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+// CompareAndSwap writes data at path only if the item currently holds old
+// ("" meaning absent), reporting whether it did. The native swap is found
+// behind decorators such as Instrument, as versioner finds UpdateFileCAS.
+// Backends without one are serialized with a process-local lock, so only
+// instances sharing a Swapper backend are safe against each other.
+func CompareAndSwap(s Storage, path, old, data string) (bool, error) {
+	if swapper, ok := swapperOf(s); ok {
+		return swapper.SwapItem(path, old, data)
+	}
+
+	unlock := swapLocks.lock(path)
+	defer unlock()
+
+	current, err := s.GetItem(path)
+	if errors.Is(err, ErrNotFound) {
+		current, err = "", nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current != old {
+		return false, nil
+	}
+	return true, s.PutItem(path, data)
+}
+
+// swapperOf finds the Swapper among s and the decorators it wraps, so
+// decorators that keep state of their own can see the swap on its way
+// through
+func swapperOf(s Storage) (Swapper, bool) {
+	for {
+		if swapper, ok := s.(Swapper); ok {
+			return swapper, true
+		}
+		w, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return nil, false
+		}
+		s = w.Unwrap()
+	}
+}
@@ -0,0 +1,29 @@
+package storage
+
+import "testing"
+
+// countingSwapper counts the native swaps made on a memory store
+type countingSwapper struct {
+	*MemoryStorage
+	swaps int
+}
+
+func (c *countingSwapper) SwapItem(path, old, data string) (bool, error) {
+	c.swaps++
+	return c.MemoryStorage.SwapItem(path, old, data)
+}
+
+func TestCompareAndSwapFindsSwapperBehindDecorators(t *testing.T) {
+	backend := &countingSwapper{MemoryStorage: NewMemoryStorage()}
+	s := Instrument(backend, nil)
+
+	if ok, err := CompareAndSwap(s, "counters/views", "", "1"); !ok || err != nil {
+		t.Fatalf("first swap: ok=%v, err=%v", ok, err)
+	}
+	if ok, err := CompareAndSwap(s, "counters/views", "0", "2"); ok || err != nil {
+		t.Errorf("swap from a stale value: ok=%v, err=%v; want refused", ok, err)
+	}
+	if backend.swaps != 2 {
+		t.Errorf("native swaps = %d, want both swaps to reach the backend's SwapItem", backend.swaps)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+)
+
+// TenantResolver picks the Storage backing each tenant. Tenants without a
+// backend of their own, and requests with no tenant, use the shared one.
+type TenantResolver struct {
+	shared Storage
+
+	mu      sync.RWMutex
+	tenants map[string]Storage
+}
+
+// NewTenantResolver creates a resolver that sends every tenant to shared
+// until they are given a backend with Register
+func NewTenantResolver(shared Storage) *TenantResolver {
+	return &TenantResolver{shared: shared, tenants: make(map[string]Storage)}
+}
+
+// Register backs tenant with s
+func (r *TenantResolver) Register(tenant string, s Storage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenants[tenant] = s
+}
+
+// Known reports whether tenant was given a backend with Register
+func (r *TenantResolver) Known(tenant string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.tenants[tenant]
+	return ok
+}
+
+// Resolve returns the Storage for tenant
+func (r *TenantResolver) Resolve(tenant string) Storage {
+	if tenant != "" {
+		r.mu.RLock()
+		s, ok := r.tenants[tenant]
+		r.mu.RUnlock()
+		if ok {
+			return s
+		}
+	}
+	return r.shared
+}
+
+// Close releases the connections of the tenants' dedicated backends. The
+// shared backend is left to its owner.
+func (r *TenantResolver) Close(ctx context.Context) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var errs []error
+	for tenant, s := range r.tenants {
+		if s == r.shared {
+			continue
+		}
+		if err := Close(ctx, s); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewTenantStorage connects the dedicated backends listed in
+// cfg.TenantStorage. Each value is "backend:target", where target is a
+// MongoDB URI, a MySQL DSN, a Redis URI, an S3 bucket or a directory for
+// the filesystem backend; every other setting is taken from cfg. Tenants
+// served on a host in cfg.TenantHosts without a backend of their own are
+// registered with the shared one.
+func NewTenantStorage(cfg *config.Config, shared Storage) (*TenantResolver, error) {
+	resolver := NewTenantResolver(shared)
+	for tenant, spec := range cfg.TenantStorage {
+		s, err := NewStorageFromSpec(cfg, spec)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		resolver.Register(tenant, s)
+	}
+	for _, tenant := range cfg.TenantHosts {
+		if !resolver.Known(tenant) {
+			resolver.Register(tenant, shared)
+		}
+	}
+	return resolver, nil
+}
+
+// NewStorageFromSpec connects the backend described by spec, in the form
+// "backend:target", taking every other setting from cfg
+func NewStorageFromSpec(cfg *config.Config, spec string) (Storage, error) {
+	backend, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("expected backend:target, got %q", spec)
+	}
+
+	specCfg := *cfg
+	specCfg.StorageBackend = backend
+	switch backend {
+	case "mongodb":
+		specCfg.MongoURI = target
+	case "mysql":
+		specCfg.MySQLDSN = target
+	case "redis":
+		specCfg.RedisURI = target
+	case "s3":
+		specCfg.S3Bucket = target
+	case "fs":
+		specCfg.FSRoot = target
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", backend)
+	}
+	return NewStorage(&specCfg)
+}
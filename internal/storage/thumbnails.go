@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ThumbnailsDir is the directory, alongside a file, holding its preview
+// image
+const ThumbnailsDir = ".thumbnails"
+
+// thumbnailPath returns where the preview of the file at path is kept,
+// e.g. home/u/sheet1 -> home/u/.thumbnails/sheet1
+func thumbnailPath(path []string) string {
+	dir := append([]string{}, path[:len(path)-1]...)
+	return strings.Join(append(dir, ThumbnailsDir, path[len(path)-1]), "/")
+}
+
+// PutThumbnail stores image as the preview of the file at path
+func PutThumbnail(s Storage, path []string, image []byte) error {
+	return s.PutItem(thumbnailPath(path), base64.StdEncoding.EncodeToString(image))
+}
+
+// GetThumbnail returns the preview of the file at path, or ErrNotFound
+// when it has none
+func GetThumbnail(s Storage, path []string) ([]byte, error) {
+	data, err := s.GetItem(thumbnailPath(path))
+	if err != nil {
+		return nil, err
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thumbnail for %s: %w", strings.Join(path, "/"), err)
+	}
+	return image, nil
+}
+
+// DeleteThumbnail removes the preview of the file at path
+func DeleteThumbnail(s Storage, path []string) error {
+	err := s.DeleteItem(thumbnailPath(path))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
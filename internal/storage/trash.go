@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRestoreConflict is returned when restoring a file whose name has been
+// taken since it was deleted
+var ErrRestoreConflict = errors.New("a file with that name already exists")
+
+// TrashEntry is one deleted file waiting in a user's trash
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedat"`
+}
+
+// Trash moves deleted files from a user's home into a per-user directory,
+// home/<user>/<Dir>, where they can be restored until Retention has passed.
+// A file's access list goes with it, so a restored file is shared as before.
+// Expired entries are emptied, along with their history, whenever the
+// user's trash is touched.
+type Trash struct {
+	Dir       string
+	Retention time.Duration // zero keeps entries until restored
+
+	now func() time.Time
+}
+
+// NewTrash returns a Trash kept in dir under each home
+func NewTrash(dir string, retention time.Duration) *Trash {
+	return &Trash{Dir: dir, Retention: retention, now: time.Now}
+}
+
+func (t *Trash) dir(user string) []string {
+	return []string{"home", user, t.Dir}
+}
+
+// trashID names an entry after its deletion time, so IDs sort oldest first
+// and the time survives without separate metadata
+func trashID(name string) string {
+	return nextRevisionName() + "-" + name
+}
+
+func parseTrashID(id string) (TrashEntry, bool) {
+	stamp, name, ok := strings.Cut(id, "-")
+	if !ok || name == "" {
+		return TrashEntry{}, false
+	}
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return TrashEntry{}, false
+	}
+	return TrashEntry{ID: id, Name: name, DeletedAt: time.Unix(0, nanos).UTC()}, true
+}
+
+// Move puts the file name from user's home into their trash
+func (t *Trash) Move(ctx context.Context, s Storage, user, name string) (TrashEntry, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return TrashEntry{}, fmt.Errorf("invalid file name %q", name)
+	}
+	path := []string{"home", user, name}
+	item, err := s.GetFile(ctx, path)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	if item.Type == "dir" {
+		return TrashEntry{}, fmt.Errorf("%s is a directory", name)
+	}
+
+	dir := t.dir(user)
+	unlock := LockPath(dir)
+	defer unlock()
+	if err := ensureDirs(ctx, s, dir, 2); err != nil {
+		return TrashEntry{}, err
+	}
+	if err := t.purge(ctx, s, user); err != nil {
+		return TrashEntry{}, err
+	}
+
+	id := trashID(name)
+	item.Path = append(dir, id)
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	if err := s.PutItem(strings.Join(item.Path, "/"), itemJSON); err != nil {
+		return TrashEntry{}, err
+	}
+	if err := moveACL(s, path, item.Path); err != nil {
+		return TrashEntry{}, err
+	}
+	if err := t.updateListing(ctx, s, user, func(ids []string) []string { return append(ids, id) }); err != nil {
+		return TrashEntry{}, err
+	}
+	if err := s.DeleteFile(ctx, path); err != nil {
+		return TrashEntry{}, err
+	}
+
+	entry, _ := parseTrashID(id)
+	return entry, nil
+}
+
+// List returns the entries in user's trash, most recently deleted first
+func (t *Trash) List(ctx context.Context, s Storage, user string) ([]TrashEntry, error) {
+	unlock := LockPath(t.dir(user))
+	defer unlock()
+	if err := t.purge(ctx, s, user); err != nil {
+		return nil, err
+	}
+
+	ids, err := t.listing(ctx, s, user)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TrashEntry, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		if entry, ok := parseTrashID(ids[i]); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Restore moves the entry id back into user's home under its original name.
+// It is ErrNotFound when the entry doesn't exist or has expired, and
+// ErrRestoreConflict when the name has been reused.
+func (t *Trash) Restore(ctx context.Context, s Storage, user, id string) (TrashEntry, error) {
+	unlock := LockPath(t.dir(user))
+	defer unlock()
+	if err := t.purge(ctx, s, user); err != nil {
+		return TrashEntry{}, err
+	}
+
+	entry, ok := parseTrashID(id)
+	if !ok || !t.contains(ctx, s, user, id) {
+		return TrashEntry{}, ErrNotFound
+	}
+	item, err := s.GetFile(ctx, append(t.dir(user), id))
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	data, ok := item.Data.(string)
+	if !ok {
+		return TrashEntry{}, fmt.Errorf("invalid trash entry %s", id)
+	}
+
+	path := []string{"home", user, entry.Name}
+	exists, err := s.ExistsItem(strings.Join(path, "/"))
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	if exists {
+		return entry, ErrRestoreConflict
+	}
+	if err := s.CreateFile(ctx, path, data); err != nil {
+		return TrashEntry{}, err
+	}
+	if err := moveACL(s, append(t.dir(user), id), path); err != nil {
+		return TrashEntry{}, err
+	}
+	return entry, t.remove(ctx, s, user, []string{id})
+}
+
+// purge empties entries older than Retention. Their history goes too,
+// unless a file of the same name has been created since.
+func (t *Trash) purge(ctx context.Context, s Storage, user string) error {
+	if t.Retention <= 0 {
+		return nil
+	}
+	ids, err := t.listing(ctx, s, user)
+	if err != nil {
+		return err
+	}
+
+	cutoff := t.now().Add(-t.Retention)
+	var expired []string
+	for _, id := range ids {
+		entry, ok := parseTrashID(id)
+		if !ok || entry.DeletedAt.After(cutoff) {
+			continue
+		}
+		expired = append(expired, id)
+
+		path := []string{"home", user, entry.Name}
+		exists, err := s.ExistsItem(strings.Join(path, "/"))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := DeleteHistory(ctx, s, path); err != nil {
+				return err
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return t.remove(ctx, s, user, expired)
+}
+
+// remove deletes entries, with their access lists, and drops them from
+// the trash listing
+func (t *Trash) remove(ctx context.Context, s Storage, user string, ids []string) error {
+	gone := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		path := append(t.dir(user), id)
+		if err := s.DeleteItem(strings.Join(path, "/")); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := DeleteACL(s, path); err != nil {
+			return err
+		}
+		gone[id] = true
+	}
+	return t.updateListing(ctx, s, user, func(current []string) []string {
+		keep := current[:0]
+		for _, id := range current {
+			if !gone[id] {
+				keep = append(keep, id)
+			}
+		}
+		return keep
+	})
+}
+
+func (t *Trash) contains(ctx context.Context, s Storage, user, id string) bool {
+	ids, err := t.listing(ctx, s, user)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// listing returns the entry IDs of user's trash, oldest first. Entries are
+// written as raw items, so the trash keeps its own directory listing
+// rather than relying on the backend to.
+func (t *Trash) listing(ctx context.Context, s Storage, user string) ([]string, error) {
+	item, err := s.GetFile(ctx, t.dir(user))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if entries, ok := item.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if id, ok := entry.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (t *Trash) updateListing(ctx context.Context, s Storage, user string, update func([]string) []string) error {
+	dir := t.dir(user)
+	item, err := s.GetFile(ctx, dir)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ids, err := t.listing(ctx, s, user)
+	if err != nil {
+		return err
+	}
+	ids = update(ids)
+	if ids == nil {
+		ids = []string{}
+	}
+	item.Data = ids
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	return s.PutItem(strings.Join(dir, "/"), itemJSON)
+}
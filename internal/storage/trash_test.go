@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrashMoveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+	trash := NewTrash(".trash", time.Hour)
+
+	entry, err := trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if entry.Name != "budget" {
+		t.Errorf("entry name = %q, want budget", entry.Name)
+	}
+	if _, err := s.GetFile(ctx, path); err != ErrNotFound {
+		t.Errorf("sheet still in home after Move: %v", err)
+	}
+
+	entries, err := trash.List(ctx, s, "alice@example.com")
+	if err != nil || len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("List = %v, %v; want [%s]", entries, err, entry.ID)
+	}
+
+	if _, err := trash.Restore(ctx, s, "alice@example.com", entry.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil || item.Data != "v0" {
+		t.Errorf("restored sheet = %v, %v; want v0", item, err)
+	}
+	if entries, _ := trash.List(ctx, s, "alice@example.com"); len(entries) != 0 {
+		t.Errorf("trash still has %v after restore", entries)
+	}
+}
+
+func TestTrashRestoreConflict(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+	trash := NewTrash(".trash", 0)
+
+	entry, err := trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if err := s.CreateFile(ctx, path, "new"); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+
+	if _, err := trash.Restore(ctx, s, "alice@example.com", entry.ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("Restore over a reused name = %v, want ErrRestoreConflict", err)
+	}
+	if entries, _ := trash.List(ctx, s, "alice@example.com"); len(entries) != 1 {
+		t.Errorf("entry dropped after failed restore: %v", entries)
+	}
+}
+
+func TestTrashIsPerUser(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newSheetStorage(t)
+	trash := NewTrash(".trash", 0)
+
+	entry, err := trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if _, err := trash.Restore(ctx, s, "bob@example.com", entry.ID); err != ErrNotFound {
+		t.Errorf("Restore from another user's trash = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTrashEmptiesAfterRetention(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+	saveRevisions(t, s, path, 2, 0)
+	trash := NewTrash(".trash", 24*time.Hour)
+
+	entry, err := trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	trash.now = func() time.Time { return entry.DeletedAt.Add(23 * time.Hour) }
+	if entries, _ := trash.List(ctx, s, "alice@example.com"); len(entries) != 1 {
+		t.Fatalf("entry emptied before retention: %v", entries)
+	}
+
+	trash.now = func() time.Time { return entry.DeletedAt.Add(25 * time.Hour) }
+	entries, err := trash.List(ctx, s, "alice@example.com")
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("List after retention = %v, %v; want empty", entries, err)
+	}
+	if _, err := trash.Restore(ctx, s, "alice@example.com", entry.ID); err != ErrNotFound {
+		t.Errorf("Restore of an emptied entry = %v, want ErrNotFound", err)
+	}
+	if names, _ := Revisions(ctx, s, path); len(names) != 0 {
+		t.Errorf("history of emptied sheet kept: %v", names)
+	}
+}
+
+func TestTrashKeepsAccessList(t *testing.T) {
+	ctx := context.Background()
+	s, path := newSheetStorage(t)
+	if err := Grant(s, path, "bob@example.com", PermissionEdit); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	trash := NewTrash(".trash", 24*time.Hour)
+
+	entry, err := trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if acl, _ := GetACL(s, path); len(acl) != 0 {
+		t.Errorf("access list left behind in home: %v", acl)
+	}
+	if _, err := trash.Restore(ctx, s, "alice@example.com", entry.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if acl, _ := GetACL(s, path); acl["bob@example.com"] != PermissionEdit {
+		t.Errorf("restored access list = %v, want bob with edit", acl)
+	}
+
+	// An entry emptied from the trash takes its access list with it
+	entry, err = trash.Move(ctx, s, "alice@example.com", "budget")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	trash.now = func() time.Time { return entry.DeletedAt.Add(25 * time.Hour) }
+	if _, err := trash.List(ctx, s, "alice@example.com"); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if acl, _ := GetACL(s, append(trash.dir("alice@example.com"), entry.ID)); len(acl) != 0 {
+		t.Errorf("access list of emptied entry kept: %v", acl)
+	}
+}
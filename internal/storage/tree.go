@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// CopyTree copies the directory at src, with every item under it, to dst.
+// Access lists, thumbnails and other sidecar items aren't in directory
+// listings, so the raw items are enumerated rather than walked through
+// List, and each stored item's own path is rewritten to its new place.
+// A missing src is ErrNotFound and an existing dst is refused. A failed
+// copy is removed again, so dst either holds the whole tree or nothing.
+func CopyTree(ctx context.Context, s Storage, src, dst []string) error {
+	lister, ok := Unwrap(s).(ItemLister)
+	if !ok {
+		return fmt.Errorf("storage backend %T does not support listing items", s)
+	}
+	from, to := strings.Join(src, "/"), strings.Join(dst, "/")
+	exists, err := s.ExistsItem(from)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	if exists, err := s.ExistsItem(to); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%s already exists", to)
+	}
+
+	paths, err := lister.ListItems(from + "/")
+	if err != nil {
+		return fmt.Errorf("failed to list items: %w", err)
+	}
+	// CreateDir puts dst in its parent's listing; the copy of src's own
+	// item then replaces it
+	if err := s.CreateDir(ctx, dst); err != nil {
+		return err
+	}
+	for _, path := range append([]string{from}, paths...) {
+		if err := copyTreeItem(s, path, to+strings.TrimPrefix(path, from), src, dst); err != nil {
+			s.DeleteDir(dst, true)
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTreeItem copies the raw item at path to target, moving a stored
+// item's path from under src to under dst. Items that aren't stored items,
+// such as access lists, are copied as they are.
+func copyTreeItem(s Storage, path, target string, src, dst []string) error {
+	data, err := s.GetItem(path)
+	if err != nil {
+		return fmt.Errorf("failed to read item %s: %w", path, err)
+	}
+	if item, err := models.StorageItemFromJSON(data); err == nil && len(item.Path) >= len(src) && slices.Equal(item.Path[:len(src)], src) {
+		item.Path = append(append([]string{}, dst...), item.Path[len(src):]...)
+		if data, err = item.ToJSON(); err != nil {
+			return err
+		}
+	}
+	if err := s.PutItem(target, data); err != nil {
+		return fmt.Errorf("failed to write item %s: %w", target, err)
+	}
+	return nil
+}
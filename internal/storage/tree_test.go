@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	s.CreateFile(ctx, []string{"home", "a", "sheet1"}, "A1:1")
+	s.CreateFile(ctx, []string{"home", "a", "sub", "sheet2"}, "A1:2")
+	if err := PutThumbnail(s, []string{"home", "a", "sheet1"}, []byte("png")); err != nil {
+		t.Fatalf("PutThumbnail failed: %v", err)
+	}
+
+	if err := CopyTree(ctx, s, []string{"home", "a"}, []string{"home", "b"}); err != nil {
+		t.Fatalf("CopyTree failed: %v", err)
+	}
+	item, err := s.GetFile(ctx, []string{"home", "b", "sub", "sheet2"})
+	if err != nil || item.Data != "A1:2" || len(item.Path) != 4 || item.Path[1] != "b" {
+		t.Errorf("copied sheet = %+v (%v), want the data at its new path", item, err)
+	}
+	if image, err := GetThumbnail(s, []string{"home", "b", "sheet1"}); err != nil || string(image) != "png" {
+		t.Errorf("copied thumbnail = %q (%v), want the unlisted sidecar copied too", image, err)
+	}
+	if names, _ := s.List([]string{"home", "b"}); len(names) < 2 {
+		t.Errorf("List(home/b) = %v, want the copied entries", names)
+	}
+	if _, err := s.GetFile(ctx, []string{"home", "a", "sheet1"}); err != nil {
+		t.Errorf("the source should be left in place: %v", err)
+	}
+
+	if err := CopyTree(ctx, s, []string{"home", "a"}, []string{"home", "b"}); err == nil {
+		t.Error("copying over an existing tree should be refused")
+	}
+	if err := CopyTree(ctx, s, []string{"home", "none"}, []string{"home", "c"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing source: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// ErrVersionConflict is returned by UpdateFileCAS when the file changed
+// since the version the caller read
+var ErrVersionConflict = errors.New("file was changed by another writer")
+
+// Versioner is implemented by backends that keep a version on every file
+// and can update a file only if its version is unchanged, atomically
+// across every instance sharing the backend. Versions are opaque.
+type Versioner interface {
+	// GetFileVersion reads the file at path together with its version
+	GetFileVersion(ctx context.Context, path []string) (*models.StorageItem, string, error)
+	// UpdateFileCAS replaces the file's data like UpdateFile, but only if
+	// its version is still expectedVersion, returning the new version;
+	// otherwise it returns ErrVersionConflict
+	UpdateFileCAS(ctx context.Context, path []string, expectedVersion string, data string) (string, error)
+}
+
+// GetFileVersion reads the file at path in s together with its version,
+// for a later UpdateFileCAS
+func GetFileVersion(ctx context.Context, s Storage, path []string) (*models.StorageItem, string, error) {
+	if v, ok := versioner(s); ok {
+		return v.GetFileVersion(ctx, path)
+	}
+	item, err := s.GetFile(ctx, path)
+	if err != nil {
+		return nil, "", err
+	}
+	version, err := contentVersion(item)
+	if err != nil {
+		return nil, "", err
+	}
+	return item, version, nil
+}
+
+// UpdateFileCAS replaces the data of the file at path in s only if it is
+// still at expectedVersion, from GetFileVersion or an earlier
+// UpdateFileCAS, and returns the new version. A file changed in between
+// is ErrVersionConflict, so concurrent writers can't silently overwrite
+// each other. Backends that aren't Versioners are serialized with a
+// process-local lock and versioned by content, which only protects
+// writers in one process that all go through UpdateFileCAS.
+func UpdateFileCAS(ctx context.Context, s Storage, path []string, expectedVersion string, data string) (string, error) {
+	if v, ok := versioner(s); ok {
+		return v.UpdateFileCAS(ctx, path, expectedVersion, data)
+	}
+
+	unlock := swapLocks.lock(strings.Join(path, "/"))
+	defer unlock()
+
+	_, version, err := GetFileVersion(ctx, s, path)
+	if err != nil {
+		return "", err
+	}
+	if version != expectedVersion {
+		return "", ErrVersionConflict
+	}
+	if err := s.UpdateFile(ctx, path, data); err != nil {
+		return "", err
+	}
+	_, version, err = GetFileVersion(ctx, s, path)
+	return version, err
+}
+
+// versioner finds the Versioner among s and the decorators it wraps, so
+// decorators that keep state of their own, such as CachedStorage, can
+// see the update on its way through
+func versioner(s Storage) (Versioner, bool) {
+	for {
+		if v, ok := s.(Versioner); ok {
+			return v, true
+		}
+		w, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return nil, false
+		}
+		s = w.Unwrap()
+	}
+}
+
+// contentVersion is the version of a file on backends that keep none:
+// the SHA-256 of its serialized form
+func contentVersion(item *models.StorageItem) (string, error) {
+	data, err := item.ToJSON()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// parseVersion reads a counter version written by formatVersion. Anything
+// else can't match a stored version, so it is a conflict.
+func parseVersion(version string) (int64, error) {
+	n, err := strconv.ParseInt(version, 10, 64)
+	if err != nil || n < 0 {
+		return 0, ErrVersionConflict
+	}
+	return n, nil
+}
+
+// formatVersion is the version string of a backend's version counter
+func formatVersion(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "context"
+
+// Warmer is implemented by backends with a connection pool that can be
+// filled ahead of the first request
+type Warmer interface {
+	Warmup(ctx context.Context, conns int) error
+}
+
+// Warmup readies s for traffic: it pre-opens conns pooled connections on
+// backends that support it, and otherwise just pings the backend. A
+// wrapped backend, as behind CachedStorage, is warmed itself.
+func Warmup(ctx context.Context, s Storage, conns int) error {
+	s = Unwrap(s)
+	if warmer, ok := s.(Warmer); ok && conns > 0 {
+		return warmer.Warmup(ctx, conns)
+	}
+	if pinger, ok := s.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
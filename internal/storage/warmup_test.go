@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// countingDriver is a database/sql driver whose connections do nothing but
+// count how many times one was dialed
+type countingDriver struct {
+	opened int32
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	atomic.AddInt32(&d.opened, 1)
+	return countingConn{}, nil
+}
+
+type countingConn struct{}
+
+func (countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (countingConn) Close() error { return nil }
+
+func (countingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+var warmupDriver = &countingDriver{}
+
+func init() {
+	sql.Register("warmup-counting", warmupDriver)
+}
+
+func TestWarmupOpensPoolConnections(t *testing.T) {
+	db, err := sql.Open("warmup-counting", "")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+	atomic.StoreInt32(&warmupDriver.opened, 0)
+
+	store := &MySQLStorage{db: db}
+	if err := Warmup(context.Background(), store, 5); err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+
+	if opened := atomic.LoadInt32(&warmupDriver.opened); opened != 5 {
+		t.Errorf("dialed %d connections, want 5", opened)
+	}
+	stats := db.Stats()
+	if stats.OpenConnections != 5 || stats.Idle != 5 {
+		t.Errorf("pool has %d open, %d idle; want 5 idle connections ready", stats.OpenConnections, stats.Idle)
+	}
+}
+
+func TestWarmupRespectsMaxOpen(t *testing.T) {
+	db, err := sql.Open("warmup-counting", "")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+
+	store := &MySQLStorage{db: db}
+	if err := Warmup(context.Background(), store, 10); err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+	if open := db.Stats().OpenConnections; open != 3 {
+		t.Errorf("pool has %d open connections, want 3", open)
+	}
+}
+
+func TestWarmupFallsBackToPing(t *testing.T) {
+	if err := Warmup(context.Background(), newFakeStorage(), 5); err != nil {
+		t.Errorf("Warmup on a backend without a pool should be a no-op, got %v", err)
+	}
+}
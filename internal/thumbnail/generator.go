@@ -0,0 +1,118 @@
+package thumbnail
+
+import (
+	"log"
+	"sync"
+)
+
+// SaveFunc stores a rendered preview
+type SaveFunc func(png []byte) error
+
+type job struct {
+	data string
+	save SaveFunc
+}
+
+// Generator renders previews in the background so saving a sheet never
+// waits on one. Jobs are keyed by sheet: saving again before the preview
+// is rendered replaces the queued data, so only the latest is rendered.
+type Generator struct {
+	width, height int
+
+	mu        sync.Mutex
+	pending   map[string]job
+	rendering map[string]int
+	queue     chan string
+	wg        sync.WaitGroup
+}
+
+// NewGenerator starts workers rendering width by height previews, with
+// room for queueSize sheets waiting
+func NewGenerator(width, height, workers, queueSize int) *Generator {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	g := &Generator{
+		width:     width,
+		height:    height,
+		pending:   make(map[string]job),
+		rendering: make(map[string]int),
+		queue:     make(chan string, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go g.work()
+	}
+	return g
+}
+
+// Size returns the size of the previews rendered
+func (g *Generator) Size() (int, int) {
+	return size(g.width, g.height)
+}
+
+// Enqueue schedules a preview of data for key, passed to save once
+// rendered. It reports false when the queue is full and the preview was
+// dropped; the next save of the sheet tries again.
+func (g *Generator) Enqueue(key, data string, save SaveFunc) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, queued := g.pending[key]; queued {
+		g.pending[key] = job{data: data, save: save}
+		return true
+	}
+
+	select {
+	case g.queue <- key:
+	default:
+		return false
+	}
+	g.pending[key] = job{data: data, save: save}
+	g.wg.Add(1)
+	return true
+}
+
+// Pending reports whether a preview for key is waiting to be rendered or
+// being rendered now
+func (g *Generator) Pending(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, queued := g.pending[key]
+	return queued || g.rendering[key] > 0
+}
+
+// Wait blocks until every queued preview has been rendered and saved
+func (g *Generator) Wait() {
+	g.wg.Wait()
+}
+
+func (g *Generator) work() {
+	for key := range g.queue {
+		g.mu.Lock()
+		j := g.pending[key]
+		delete(g.pending, key)
+		g.rendering[key]++
+		g.mu.Unlock()
+
+		g.render(key, j)
+
+		g.mu.Lock()
+		if g.rendering[key]--; g.rendering[key] <= 0 {
+			delete(g.rendering, key)
+		}
+		g.mu.Unlock()
+		g.wg.Done()
+	}
+}
+
+func (g *Generator) render(key string, j job) {
+	image, err := Render(j.data, g.width, g.height)
+	if err == nil {
+		err = j.save(image)
+	}
+	if err != nil {
+		log.Printf("Failed to generate thumbnail for %s: %v", key, err)
+	}
+}
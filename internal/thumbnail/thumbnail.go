@@ -0,0 +1,192 @@
+// Package thumbnail renders small preview images of SocialCalc sheets for
+// galleries. Previews show the layout of the top-left corner of the sheet,
+// not legible text: filled cells are drawn as bars sized to their content.
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+)
+
+// Default preview size in pixels
+const (
+	DefaultWidth  = 240
+	DefaultHeight = 160
+)
+
+// Layout of the preview grid, in pixels
+const (
+	headerSize = 8
+	cellWidth  = 40
+	cellHeight = 14
+	barInset   = 3
+	charWidth  = 4
+	// Text spills into the cells to its right, as it does in the editor,
+	// up to this many cells
+	maxSpill = 3
+)
+
+var (
+	backgroundColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	headerColor     = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	gridColor       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	textColor       = color.RGBA{0x55, 0x55, 0x55, 0xff}
+	numberColor     = color.RGBA{0x1f, 0x5f, 0xbf, 0xff}
+	formulaColor    = color.RGBA{0x2e, 0x8b, 0x57, 0xff}
+	placeholderBar  = color.RGBA{0xe4, 0xe4, 0xe4, 0xff}
+)
+
+// cell is a filled cell of the sheet, by 1-based column and row
+type cell struct {
+	col, row int
+	kind     string
+	length   int
+}
+
+// Render draws a width by height PNG preview of the SocialCalc save data.
+// Sizes of zero or less use the defaults.
+func Render(data string, width, height int) ([]byte, error) {
+	width, height = size(width, height)
+	img := grid(width, height)
+	for _, c := range parseCells(data) {
+		x := headerSize + (c.col-1)*cellWidth
+		y := headerSize + (c.row-1)*cellHeight
+		if x >= width || y >= height {
+			continue
+		}
+
+		barWidth := c.length * charWidth
+		if limit := maxSpill*cellWidth - 2*barInset; barWidth > limit {
+			barWidth = limit
+		}
+		if barWidth < charWidth {
+			barWidth = charWidth
+		}
+		bar := image.Rect(x+barInset, y+barInset, x+barInset+barWidth, y+cellHeight-barInset)
+		fill := textColor
+		switch c.kind {
+		case "v":
+			// Numbers are right aligned within their cell
+			if barWidth > cellWidth-2*barInset {
+				barWidth = cellWidth - 2*barInset
+			}
+			bar = image.Rect(x+cellWidth-barInset-barWidth, y+barInset, x+cellWidth-barInset, y+cellHeight-barInset)
+			fill = numberColor
+		case "vtf":
+			fill = formulaColor
+		}
+		draw.Draw(img, bar.Intersect(img.Bounds()), image.NewUniform(fill), image.Point{}, draw.Src)
+	}
+	return encode(img)
+}
+
+// Placeholder draws an empty grid with faint bars, shown while a sheet's
+// preview hasn't been rendered yet
+func Placeholder(width, height int) []byte {
+	width, height = size(width, height)
+	img := grid(width, height)
+	for row := 0; headerSize+row*cellHeight < height; row += 2 {
+		y := headerSize + row*cellHeight
+		bar := image.Rect(headerSize+barInset, y+barInset, width*2/3, y+cellHeight-barInset)
+		draw.Draw(img, bar.Intersect(img.Bounds()), image.NewUniform(placeholderBar), image.Point{}, draw.Src)
+	}
+	data, _ := encode(img)
+	return data
+}
+
+func size(width, height int) (int, int) {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+	return width, height
+}
+
+// grid draws the blank sheet: headers along the top and left, and cell
+// borders
+func grid(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, width, headerSize), image.NewUniform(headerColor), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, headerSize, height), image.NewUniform(headerColor), image.Point{}, draw.Src)
+	for x := headerSize; x < width; x += cellWidth {
+		draw.Draw(img, image.Rect(x, 0, x+1, height), image.NewUniform(gridColor), image.Point{}, draw.Src)
+	}
+	for y := headerSize; y < height; y += cellHeight {
+		draw.Draw(img, image.Rect(0, y, width, y+1), image.NewUniform(gridColor), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseCells returns the cells of the save data that hold a value. Lines
+// look like cell:B2:t:text or cell:C3:vtf:n:42:SUM(A1\cA2), with colons in
+// values escaped, followed by formatting attributes.
+func parseCells(data string) []cell {
+	var cells []cell
+	for _, line := range strings.Split(data, "\n") {
+		if !strings.HasPrefix(line, "cell:") {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(line, "\r"), ":")
+		if len(parts) < 4 {
+			continue
+		}
+		col, row, ok := parseCoord(parts[1])
+		if !ok {
+			continue
+		}
+
+		var kind, value string
+		switch parts[2] {
+		case "v", "t":
+			kind, value = parts[2], parts[3]
+		case "vtf", "vtc":
+			if len(parts) < 5 {
+				continue
+			}
+			kind, value = "vtf", parts[4]
+		default:
+			// Formatting only
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		cells = append(cells, cell{col: col, row: row, kind: kind, length: len([]rune(value))})
+	}
+	return cells
+}
+
+// parseCoord splits a coordinate such as AB12 into its 1-based column and
+// row
+func parseCoord(coord string) (int, int, bool) {
+	col, i := 0, 0
+	for ; i < len(coord) && coord[i] >= 'A' && coord[i] <= 'Z'; i++ {
+		col = col*26 + int(coord[i]-'A'+1)
+	}
+	row := 0
+	for j := i; j < len(coord); j++ {
+		if coord[j] < '0' || coord[j] > '9' || row > 1e7 {
+			return 0, 0, false
+		}
+		row = row*10 + int(coord[j]-'0')
+	}
+	if i == 0 || i > 3 || i == len(coord) || row == 0 {
+		return 0, 0, false
+	}
+	return col, row, true
+}
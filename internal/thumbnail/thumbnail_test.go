@@ -0,0 +1,81 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image/png"
+	"sync"
+	"testing"
+)
+
+func TestRenderDrawsFilledCells(t *testing.T) {
+	data := "version:1.5\ncell:A1:t:Budget\ncell:B2:v:42\ncell:C3:vtf:n:42:B2\ncell:D4:f:1\nsheet:c:4:r:4\n"
+
+	out, err := Render(data, 0, 0)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != DefaultWidth || b.Dy() != DefaultHeight {
+		t.Fatalf("size = %dx%d, want the default %dx%d", b.Dx(), b.Dy(), DefaultWidth, DefaultHeight)
+	}
+
+	// Sample the middle of each cell's bar
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want any
+	}{
+		{"text in A1", headerSize + barInset + 2, headerSize + cellHeight/2, textColor},
+		{"number in B2", headerSize + 2*cellWidth - barInset - 2, headerSize + cellHeight + cellHeight/2, numberColor},
+		{"formula in C3", headerSize + 2*cellWidth + barInset + 2, headerSize + 2*cellHeight + cellHeight/2, formulaColor},
+		{"formatting-only D4", headerSize + 3*cellWidth + barInset + 2, headerSize + 3*cellHeight + cellHeight/2, backgroundColor},
+	} {
+		if got := img.At(tc.x, tc.y); got != tc.want {
+			t.Errorf("%s: pixel = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPlaceholderIsAnImage(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(Placeholder(100, 50)))
+	if err != nil {
+		t.Fatalf("not a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("size = %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+}
+
+func TestGeneratorRendersLatestData(t *testing.T) {
+	g := NewGenerator(60, 40, 1, 4)
+	var mu sync.Mutex
+	saved := map[string][]byte{}
+	save := func(key string) SaveFunc {
+		return func(image []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			saved[key] = image
+			return nil
+		}
+	}
+
+	for _, data := range []string{"cell:A1:v:1", "cell:A1:v:2", "cell:A1:t:three"} {
+		if !g.Enqueue("budget", data, save("budget")) {
+			t.Fatal("Enqueue refused with room in the queue")
+		}
+	}
+	g.Wait()
+
+	if g.Pending("budget") {
+		t.Error("Pending after Wait")
+	}
+	want, _ := Render("cell:A1:t:three", 60, 40)
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(saved["budget"], want) {
+		t.Error("saved preview isn't of the latest data")
+	}
+}
@@ -0,0 +1,70 @@
+// Package tlsconfig builds the TLS settings used when the server terminates
+// TLS itself rather than behind nginx.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion turns a version such as "1.2" (or "TLS1.2") into its
+// crypto/tls constant
+func ParseVersion(version string) (uint16, error) {
+	v := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(version)), "TLS")
+	if id, ok := versions[strings.TrimSpace(v)]; ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, want one of 1.0, 1.1, 1.2, 1.3", version)
+}
+
+// ParseCipherSuites resolves cipher suite names, as listed by
+// tls.CipherSuites, to their IDs. Suites Go considers insecure are refused.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	secure := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := map[string]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := secure[name]
+		switch {
+		case ok:
+			ids = append(ids, id)
+		case insecure[name]:
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		default:
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+	}
+	return ids, nil
+}
+
+// New returns a tls.Config refusing handshakes below minVersion. An empty
+// cipher list keeps Go's defaults; either way the list only applies up to
+// TLS 1.2, as TLS 1.3 suites are not configurable.
+func New(minVersion string, cipherSuites []string) (*tls.Config, error) {
+	min, err := ParseVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: min}
+	if len(cipherSuites) > 0 {
+		if cfg.CipherSuites, err = ParseCipherSuites(cipherSuites); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
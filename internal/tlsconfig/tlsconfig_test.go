@@ -0,0 +1,64 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	for in, want := range map[string]uint16{"1.2": tls.VersionTLS12, "TLS1.3": tls.VersionTLS13, " tls1.0 ": tls.VersionTLS10} {
+		got, err := ParseVersion(in)
+		if err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %x, %v; want %x", in, got, err, want)
+		}
+	}
+	if _, err := ParseVersion("1.4"); err == nil {
+		t.Error("ParseVersion(1.4) succeeded, want an error")
+	}
+}
+
+func TestNewRejectsBadCipherSuites(t *testing.T) {
+	if _, err := New("1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("New accepted an insecure cipher suite")
+	}
+	if _, err := New("1.2", []string{"TLS_MADE_UP"}); err == nil {
+		t.Error("New accepted an unknown cipher suite")
+	}
+	cfg, err := New("1.2", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("New = %+v, %v; want the one suite", cfg, err)
+	}
+}
+
+func TestMinimumVersionRejectsOldHandshake(t *testing.T) {
+	cfg, err := New("1.2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(version uint16) error {
+		client := srv.Client()
+		transport := client.Transport.(*http.Transport)
+		transport.TLSClientConfig.MinVersion = version
+		transport.TLSClientConfig.MaxVersion = version
+		transport.DisableKeepAlives = true
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(tls.VersionTLS10); err == nil {
+		t.Error("TLS 1.0 handshake succeeded with a 1.2 minimum")
+	}
+	if err := get(tls.VersionTLS12); err != nil {
+		t.Errorf("TLS 1.2 handshake failed: %v", err)
+	}
+}
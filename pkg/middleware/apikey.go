@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyUserKey is the context key holding the user an API key belongs to
+const APIKeyUserKey = "apikey_user"
+
+// APIKeyValidator returns the user that owns key, if it is valid
+type APIKeyValidator func(c *gin.Context, key string) (string, bool)
+
+// APIKey authenticates requests carrying "Authorization: Bearer <key>",
+// recording the key's owner under APIKeyUserKey. An invalid key is
+// rejected outright rather than falling back to the session cookie.
+// Requests without a bearer token pass through untouched.
+func APIKey(validate APIKeyValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Next()
+			return
+		}
+
+		user, valid := validate(c, strings.TrimSpace(key))
+		if !valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+		c.Set(APIKeyUserKey, user)
+		c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAPIKeyRouter(keys map[string]string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(APIKey(func(c *gin.Context, key string) (string, bool) {
+		user, ok := keys[key]
+		return user, ok
+	}))
+	router.GET("/whoami", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(APIKeyUserKey))
+	})
+	return router
+}
+
+func requestWithKey(router *gin.Engine, header string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeySetsUser(t *testing.T) {
+	router := newAPIKeyRouter(map[string]string{"good": "alice@example.com"})
+
+	w := requestWithKey(router, "Bearer good")
+	if w.Code != http.StatusOK || w.Body.String() != "alice@example.com" {
+		t.Errorf("valid key = %d %q, want 200 alice@example.com", w.Code, w.Body.String())
+	}
+	if w := requestWithKey(router, "Bearer bad"); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid key = %d, want 401", w.Code)
+	}
+	if w := requestWithKey(router, ""); w.Code != http.StatusOK || w.Body.String() != "" {
+		t.Errorf("no key = %d %q, want 200 with no user", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIKeyRevocationTakesEffectImmediately(t *testing.T) {
+	keys := map[string]string{"old": "alice@example.com"}
+	router := newAPIKeyRouter(keys)
+
+	if w := requestWithKey(router, "Bearer old"); w.Code != http.StatusOK {
+		t.Fatalf("key rejected before rotation: %d", w.Code)
+	}
+	delete(keys, "old")
+	keys["new"] = "alice@example.com"
+
+	if w := requestWithKey(router, "Bearer old"); w.Code != http.StatusUnauthorized {
+		t.Errorf("rotated-out key = %d, want 401", w.Code)
+	}
+	if w := requestWithKey(router, "Bearer new"); w.Code != http.StatusOK {
+		t.Errorf("new key = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentUserKey is the context key holding the authenticated user's email
+const CurrentUserKey = "current_user"
+
+// RequireAuth lets through only requests from a signed-in user, named by a
+// valid API key or session, and records the user under CurrentUserKey.
+// Sessions are checked with validate, as AuthRequired does, so one revoked
+// by a password change elsewhere is cleared and counts as no session.
+// Browsers without a session are sent to /login; other clients get 401.
+func RequireAuth(validate SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.GetString(APIKeyUserKey)
+		if user == "" {
+			var version int
+			user, version = session(c)
+			if user != "" && !validate(c, user, version) {
+				clearSession(c)
+				user = ""
+			}
+		}
+		if user == "" {
+			if browserRequest(c) {
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"data":   "usererror",
+				"result": "fail",
+			})
+			return
+		}
+
+		c.Set(CurrentUserKey, user)
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user recorded by RequireAuth, if any
+func CurrentUser(c *gin.Context) (string, bool) {
+	user := c.GetString(CurrentUserKey)
+	return user, user != ""
+}
+
+// browserRequest reports whether the request is a page load, which is
+// better answered with the login page than an error
+func browserRequest(c *gin.Context) bool {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return !strings.Contains(c.GetHeader("Accept"), "application/json")
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/html")
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRequireAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(APIKey(func(c *gin.Context, key string) (string, bool) {
+		return "bot@example.com", key == "good"
+	}))
+	whoami := func(c *gin.Context) {
+		user, _ := CurrentUser(c)
+		c.String(http.StatusOK, user)
+	}
+	// carol changed her password, revoking sessions issued before it
+	current := map[string]int{"carol@example.com": 2}
+	signedIn := RequireAuth(func(c *gin.Context, user string, version int) bool {
+		return version == current[user]
+	})
+	router.GET("/private", signedIn, whoami)
+	router.POST("/private", signedIn, whoami)
+	return router
+}
+
+func serveRequireAuth(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireAuthSetsCurrentUser(t *testing.T) {
+	router := newRequireAuthRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := serveRequireAuth(router, req)
+	if w.Code != http.StatusOK || w.Body.String() != "alice@example.com" {
+		t.Errorf("session = %d %q, want 200 alice@example.com", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	w = serveRequireAuth(router, req)
+	if w.Code != http.StatusOK || w.Body.String() != "bot@example.com" {
+		t.Errorf("API key = %d %q, want 200 bot@example.com", w.Code, w.Body.String())
+	}
+}
+
+func TestRequireAuthWithoutSession(t *testing.T) {
+	router := newRequireAuthRouter()
+
+	// Page loads go to the login page
+	w := serveRequireAuth(router, httptest.NewRequest(http.MethodGet, "/private", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("anonymous page load = %d to %q, want 302 to /login", w.Code, w.Header().Get("Location"))
+	}
+
+	// API clients get an error they can act on
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	req.Header.Set("Accept", "application/json")
+	if w := serveRequireAuth(router, req); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous JSON GET = %d, want 401", w.Code)
+	}
+	if w := serveRequireAuth(router, httptest.NewRequest(http.MethodPost, "/private", nil)); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST = %d, want 401", w.Code)
+	}
+
+	// A form posted from a page is a browser request too
+	req = httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	if w := serveRequireAuth(router, req); w.Code != http.StatusFound {
+		t.Errorf("anonymous form post = %d, want 302", w.Code)
+	}
+}
+
+func TestRequireAuthRejectsUnverifiedToken(t *testing.T) {
+	UseSessionTokens(func(token string) (string, int, error) {
+		if token != "signed" {
+			return "", 0, http.ErrNoCookie
+		}
+		return "alice@example.com", 0, nil
+	})
+	defer UseSessionTokens(nil)
+	router := newRequireAuthRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: SessionTokenCookie, Value: "forged"})
+	if w := serveRequireAuth(router, req); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged token = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: SessionTokenCookie, Value: "signed"})
+	if w := serveRequireAuth(router, req); w.Code != http.StatusOK || w.Body.String() != "alice@example.com" {
+		t.Errorf("signed token = %d %q, want 200 alice@example.com", w.Code, w.Body.String())
+	}
+}
+
+func TestRequireAuthRejectsRevokedSession(t *testing.T) {
+	router := newRequireAuthRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "carol@example.com"})
+	req.AddCookie(&http.Cookie{Name: SessionVersionCookie, Value: "1"})
+	w := serveRequireAuth(router, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session = %d, want 401", w.Code)
+	}
+	if cleared := w.Header().Values("Set-Cookie"); len(cleared) == 0 {
+		t.Error("a revoked session's cookies should be cleared")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "carol@example.com"})
+	req.AddCookie(&http.Cookie{Name: SessionVersionCookie, Value: "2"})
+	if w := serveRequireAuth(router, req); w.Code != http.StatusOK || w.Body.String() != "carol@example.com" {
+		t.Errorf("current session = %d %q, want 200 carol@example.com", w.Code, w.Body.String())
+	}
+}
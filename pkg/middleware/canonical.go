@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CanonicalHost redirects requests for any other host to host, keeping the
+// path and query. The scheme is https when the connection is TLS, or when
+// a proxy in trusted says so with X-Forwarded-Proto. GET and HEAD get a 301;
+// other methods a 308 so the method and body survive. Health checks are
+// answered on any host so probes by IP keep working.
+func CanonicalHost(host string, trusted []*net.IPNet) gin.HandlerFunc {
+	host = strings.ToLower(host)
+	return func(c *gin.Context) {
+		if strings.ToLower(c.Request.Host) == host || strings.HasPrefix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+
+		status := http.StatusMovedPermanently
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		c.Redirect(status, requestScheme(c, trusted)+"://"+host+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
+
+// requestScheme is the scheme the client used, honoring X-Forwarded-Proto
+// only from the direct peer being a trusted proxy
+func requestScheme(c *gin.Context, trusted []*net.IPNet) string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	peer, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		peer = c.Request.RemoteAddr
+	}
+	if ip := net.ParseIP(peer); ip != nil && containsIP(trusted, ip) {
+		if proto := strings.ToLower(c.GetHeader("X-Forwarded-Proto")); proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	return "http"
+}
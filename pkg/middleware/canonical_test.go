@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanonicalHost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trusted, err := ParseCIDRs([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(CanonicalHost("example.com", trusted))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/save", ok)
+	router.POST("/save", ok)
+	router.GET("/health", ok)
+
+	for _, tc := range []struct {
+		name, method, target, host, remote, proto string
+		wantCode                                  int
+		wantLocation                              string
+	}{
+		{"canonical host", "GET", "/save?x=1", "example.com", "192.0.2.1:1234", "", http.StatusOK, ""},
+		{"host is case-insensitive", "GET", "/save", "Example.COM", "192.0.2.1:1234", "", http.StatusOK, ""},
+		{"www redirected", "GET", "/save?x=1&y=2", "www.example.com", "192.0.2.1:1234", "", http.StatusMovedPermanently, "http://example.com/save?x=1&y=2"},
+		{"scheme from trusted proxy", "GET", "/save", "www.example.com", "10.0.0.1:1234", "https", http.StatusMovedPermanently, "https://example.com/save"},
+		{"scheme from untrusted client ignored", "GET", "/save", "www.example.com", "192.0.2.1:1234", "https", http.StatusMovedPermanently, "http://example.com/save"},
+		{"POST keeps its method", "POST", "/save", "www.example.com", "192.0.2.1:1234", "", http.StatusPermanentRedirect, "http://example.com/save"},
+		{"health check on any host", "GET", "/health", "10.1.2.3:8080", "192.0.2.1:1234", "", http.StatusOK, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			req.Host = tc.host
+			req.RemoteAddr = tc.remote
+			if tc.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tc.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimit lets at most limit requests through the routes it guards
+// at once, answering 503 with a Retry-After to the rest rather than queueing
+// them. Share one instance between routes to cap them together. A limit of
+// zero or less disables it.
+func ConcurrencyLimit(limit int) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	slots := make(chan struct{}, limit)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many concurrent uploads"})
+			c.Abort()
+		}
+	}
+}
+
+// MaxBodySize answers 413 to requests whose body is declared or turns out
+// longer than limit bytes once the handler reads it, in place of whatever
+// the handler makes of the refused body. Installed with router.Use, it
+// bounds every route, and BodyLimit on a route gives it a limit of its
+// own. A limit of zero or less disables it.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limitBody(c, limit)
+	}
+}
+
+// BodyLimit sets the body limit of the route it is registered with, in
+// place of the one MaxBodySize gave every route, so routes that take whole
+// sheets or uploads can have more room and their limit moves with them.
+// Without MaxBodySize ahead of it, it works as MaxBodySize for the route.
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(bodyLimitKey)
+		if !ok {
+			limitBody(c, limit)
+			return
+		}
+		body := value.(*limitedBody)
+		body.limit = limit
+		if limit > 0 && c.Request.ContentLength > limit {
+			respondBodyTooLarge(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// bodyLimitKey holds the *limitedBody MaxBodySize put on the request
+const bodyLimitKey = "body_limit"
+
+var bodyTooLarge = gin.H{"error": "Request body too large"}
+
+// limitBody bounds the request body. A declared length over the limit is
+// only refused when the body is read, as BodyLimit may still raise it.
+func limitBody(c *gin.Context, limit int64) {
+	if limit <= 0 {
+		c.Next()
+		return
+	}
+	body := &limitedBody{body: c.Request.Body, w: c.Writer, limit: limit, declared: c.Request.ContentLength}
+	c.Request.Body = body
+	c.Set(bodyLimitKey, body)
+	w := &bodyLimitWriter{ResponseWriter: c.Writer, body: body}
+	c.Writer = w
+	defer func() { c.Writer = w.ResponseWriter }()
+	c.Next()
+	// The handler gave up on the body without answering
+	if w.overridden() && !w.replaced && !w.ResponseWriter.Written() {
+		w.replace()
+	}
+}
+
+func respondBodyTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, bodyTooLarge)
+}
+
+// limitedBody is http.MaxBytesReader with a limit that can still change
+// until the body is first read, and that remembers being exceeded. A body
+// declared longer than the limit fails its first read without reading any.
+type limitedBody struct {
+	body     io.ReadCloser
+	w        http.ResponseWriter
+	limit    int64
+	declared int64
+	reader   io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.reader == nil {
+		if b.limit > 0 && b.declared > b.limit {
+			b.exceeded = true
+			return 0, &http.MaxBytesError{Limit: b.limit}
+		}
+		b.reader = b.body
+		if b.limit > 0 {
+			b.reader = http.MaxBytesReader(b.w, b.body, b.limit)
+		}
+	}
+	n, err := b.reader.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// bodyLimitWriter answers 413 in place of the handler's response once the
+// body was cut off, whether the handler saw that as a bad request, an
+// empty form or a server error. Handlers that answer 413 themselves keep
+// their own response.
+type bodyLimitWriter struct {
+	gin.ResponseWriter
+	body     *limitedBody
+	replaced bool
+	own      bool // the handler answered 413 itself
+}
+
+func (w *bodyLimitWriter) overridden() bool {
+	return w.body.exceeded && !w.own
+}
+
+func (w *bodyLimitWriter) WriteHeader(code int) {
+	if w.body.exceeded && code == http.StatusRequestEntityTooLarge {
+		w.own = true
+	}
+	if w.overridden() {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyLimitWriter) WriteHeaderNow() {
+	if w.overridden() {
+		w.replace()
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *bodyLimitWriter) Write(data []byte) (int, error) {
+	if w.overridden() {
+		w.replace()
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyLimitWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// replace sends the 413, once, unless the handler's response went out
+// before the body was cut off
+func (w *bodyLimitWriter) replace() {
+	if w.replaced || w.ResponseWriter.Written() {
+		return
+	}
+	w.replaced = true
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+	data, _ := json.Marshal(bodyTooLarge)
+	w.ResponseWriter.Write(data)
+}
+
+// UserIdentity returns the user a request is made as, or "" for anonymous
+// requests
+type UserIdentity func(c *gin.Context) string
+
+// PerUserConcurrency lets each user have at most limit requests in flight
+// at once, answering 429 with a Retry-After to the rest, so one user or a
+// runaway client of theirs can't tie up the server for everyone else.
+// Anonymous requests are left to the per-IP limits. A limit of zero or
+// less disables it.
+func PerUserConcurrency(limit int, identify UserIdentity) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	return func(c *gin.Context) {
+		user := identify(c)
+		if user == "" {
+			c.Next()
+			return
+		}
+
+		mu.Lock()
+		if inFlight[user] >= limit {
+			mu.Unlock()
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many concurrent requests"})
+			c.Abort()
+			return
+		}
+		inFlight[user]++
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			// Idle users don't keep an entry
+			if inFlight[user]--; inFlight[user] == 0 {
+				delete(inFlight, user)
+			}
+			mu.Unlock()
+		}()
+		c.Next()
+	}
+}
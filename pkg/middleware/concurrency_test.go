@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrencyLimitShedsExcess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	uploads := ConcurrencyLimit(2)
+	slow := func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	}
+	router.POST("/import", uploads, slow)
+	router.POST("/htmltopdf", uploads, slow)
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	// Fill both slots, one on each route, since they share the limit
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, path := range []string{"/import", "/htmltopdf"} {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			codes[i] = post(path)
+		}(i, path)
+		<-entered
+	}
+
+	if code := post("/import"); code != http.StatusServiceUnavailable {
+		t.Errorf("upload beyond the cap = %d, want 503", code)
+	}
+
+	close(release)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("upload %d within the cap = %d, want 200", i, code)
+		}
+	}
+
+	// Freed slots are reusable
+	go func() { <-entered }()
+	if code := post("/import"); code != http.StatusOK {
+		t.Errorf("upload after the others finished = %d, want 200", code)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/import", MaxBodySize(8), func(c *gin.Context) {
+		if _, err := c.GetRawData(); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"small", false, http.StatusOK},
+		{"far too large", false, http.StatusRequestEntityTooLarge},
+		{"far too large", true, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(tc.body))
+		if tc.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("body %q (chunked %v) = %d, want %d", tc.body, tc.chunked, w.Code, tc.want)
+		}
+	}
+}
+
+func TestBodyLimitPerRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxBodySize(16))
+	read := func(c *gin.Context) {
+		if _, err := c.GetRawData(); err != nil {
+			// Mistaken for a malformed request; the limit answers 413
+			c.String(http.StatusBadRequest, "bad request")
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.POST("/login", read)
+	router.POST("/import", BodyLimit(64), read)
+	router.POST("/open", BodyLimit(0), read)
+
+	for _, tc := range []struct {
+		path    string
+		size    int
+		chunked bool
+		want    int
+	}{
+		{"/login", 16, false, http.StatusOK},
+		{"/login", 17, false, http.StatusRequestEntityTooLarge},
+		{"/login", 17, true, http.StatusRequestEntityTooLarge},
+		{"/import", 64, false, http.StatusOK},
+		{"/import", 64, true, http.StatusOK},
+		{"/import", 65, false, http.StatusRequestEntityTooLarge},
+		{"/import", 65, true, http.StatusRequestEntityTooLarge},
+		{"/open", 1000, false, http.StatusOK},
+		{"/open", 1000, true, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(strings.Repeat("x", tc.size)))
+		if tc.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s with %d bytes (chunked %v) = %d, want %d", tc.path, tc.size, tc.chunked, w.Code, tc.want)
+		}
+		if tc.want == http.StatusRequestEntityTooLarge && strings.Contains(w.Body.String(), "bad request") {
+			t.Errorf("%s with %d bytes (chunked %v) kept the handler's body %q", tc.path, tc.size, tc.chunked, w.Body.String())
+		}
+	}
+}
+
+func TestPerUserConcurrencyThrottlesOneUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(PerUserConcurrency(2, func(c *gin.Context) string {
+		return c.GetHeader("X-User")
+	}))
+	router.GET("/slow", func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	get := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	inBackground := func(wg *sync.WaitGroup, codes []int, i int, user string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = get(user).Code
+		}()
+		<-entered
+	}
+
+	// alice fills her two slots
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	inBackground(&wg, codes, 0, "alice")
+	inBackground(&wg, codes, 1, "alice")
+
+	w := get("alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("alice's third request = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("throttled response should carry Retry-After")
+	}
+
+	// Others are unaffected, whether logged in or anonymous
+	inBackground(&wg, codes, 2, "bob")
+	inBackground(&wg, codes, 3, "bob")
+	inBackground(&wg, codes, 4, "")
+
+	close(release)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d within the cap = %d, want 200", i, code)
+		}
+	}
+
+	// alice's slots are freed once her requests finish
+	go func() { <-entered }()
+	if code := get("alice").Code; code != http.StatusOK {
+		t.Errorf("alice after her requests finished = %d, want 200", code)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(origins ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSWithOptions(CORSOptions{
+		AllowedOrigins: origins,
+		Methods:        RouteMethods(router),
+	}))
+	router.GET("/save", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/save", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func sendCORS(router *gin.Engine, method, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/save", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSEchoesAllowedOrigin(t *testing.T) {
+	router := newCORSRouter("https://app.example.com/", "https://other.example.com")
+
+	w := sendCORS(router, http.MethodGet, "https://app.example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORSIgnoresDisallowedOrigin(t *testing.T) {
+	router := newCORSRouter("https://app.example.com")
+
+	for _, origin := range []string{"https://evil.example.com", ""} {
+		w := sendCORS(router, http.MethodGet, origin)
+		if w.Code != http.StatusOK {
+			t.Errorf("origin %q: status = %d, want the request served", origin, w.Code)
+		}
+		for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods"} {
+			if got := w.Header().Get(header); got != "" {
+				t.Errorf("origin %q: %s = %q, want none", origin, header, got)
+			}
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter("https://app.example.com")
+
+	w := sendCORS(router, http.MethodOptions, "https://app.example.com")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, OPTIONS" {
+		t.Errorf("Access-Control-Allow-Methods = %q, want the route's methods", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Error("Access-Control-Allow-Headers missing from preflight")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+
+	// Preflights from other origins get no CORS grant
+	w = sendCORS(router, http.MethodOptions, "https://evil.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed preflight = %d with origin %q, want 204 without a grant", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCORSWithoutAllowlistAllowsAnyOrigin(t *testing.T) {
+	router := newCORSRouter()
+
+	w := sendCORS(router, http.MethodGet, "https://anywhere.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EntitlementChecker looks up the request's user, reporting whether anyone
+// is logged in and whether they hold entitlement
+type EntitlementChecker func(c *gin.Context, entitlement string) (authenticated, allowed bool)
+
+// RequireEntitlement lets a request through only when its user holds
+// entitlement. Anonymous requests get 401, users without it 403.
+func RequireEntitlement(entitlement string, check EntitlementChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticated, allowed := check(c, entitlement)
+		switch {
+		case !authenticated:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+		case !allowed:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":       "Feature not included in your plan",
+				"entitlement": entitlement,
+			})
+			c.Abort()
+		default:
+			c.Next()
+		}
+	}
+}
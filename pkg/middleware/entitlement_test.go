@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireEntitlement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	granted := map[string][]string{
+		"paid@example.com": {"pdf_export"},
+		"free@example.com": {},
+	}
+	check := func(c *gin.Context, entitlement string) (bool, bool) {
+		user := c.GetHeader("X-User")
+		entitlements, known := granted[user]
+		if !known {
+			return false, false
+		}
+		for _, e := range entitlements {
+			if e == entitlement {
+				return true, true
+			}
+		}
+		return true, false
+	}
+
+	router := gin.New()
+	router.POST("/htmltopdf", RequireEntitlement("pdf_export", check), func(c *gin.Context) {
+		c.String(http.StatusOK, "pdf")
+	})
+
+	for _, tc := range []struct {
+		user string
+		want int
+	}{
+		{"paid@example.com", http.StatusOK},
+		{"free@example.com", http.StatusForbidden},
+		{"", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/htmltopdf", nil)
+		req.Header.Set("X-User", tc.user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("user %q: status %d, want %d", tc.user, w.Code, tc.want)
+		}
+	}
+}
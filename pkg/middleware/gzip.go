@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipMinSize is the smallest response Gzip compresses; below it
+// the gzip overhead outweighs the saving
+const DefaultGzipMinSize = 1024
+
+// incompressibleTypes are content types already compressed, or nearly so,
+// which gzip would only make bigger
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+}
+
+// Gzip compresses responses of at least DefaultGzipMinSize bytes for
+// clients that accept gzip
+func Gzip() gin.HandlerFunc {
+	return GzipWithMinSize(DefaultGzipMinSize)
+}
+
+// GzipWithMinSize is Gzip compressing responses of at least minSize bytes.
+// Responses that are already encoded, partial, or of a compressed type
+// such as images and PDFs are sent as they are.
+func GzipWithMinSize(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == http.MethodHead ||
+			c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer, minSize: minSize, status: c.Writer.Status()}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds back the response until minSize bytes are written or
+// the handler is done, then sends it compressed or as it is
+type gzipWriter struct {
+	gin.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+	pending bool // the handler has responded, if only with headers
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if !w.decided && code > 0 {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow is held back with the body, since whether to compress
+// changes the headers
+func (w *gzipWriter) WriteHeaderNow() {
+	w.pending = true
+}
+
+func (w *gzipWriter) Status() int {
+	if w.decided {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *gzipWriter) Written() bool {
+	return w.decided || w.pending || w.buf.Len() > 0
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < w.minSize {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what is held back, so streamed responses aren't stalled
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide sends the headers and held back body, compressing them if the
+// response is big enough and worth it
+func (w *gzipWriter) decide() error {
+	w.decided = true
+	if w.compressible() {
+		header := w.ResponseWriter.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+
+	held := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if len(held) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(held)
+	} else {
+		_, err = w.ResponseWriter.Write(held)
+	}
+	return err
+}
+
+func (w *gzipWriter) compressible() bool {
+	if w.buf.Len() < w.minSize || w.status == http.StatusPartialContent {
+		return false
+	}
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf.Bytes())
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	if contentType == "image/svg+xml" {
+		return true
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// finish sends a response that never reached minSize and ends the gzip
+// stream. Nothing is sent for a handler that never responded, leaving
+// that to gin along with any status it set.
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		if !w.Written() {
+			w.ResponseWriter.WriteHeader(w.status)
+			return
+		}
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newGzipRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Gzip())
+	router.GET("/big", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"cells": strings.Repeat("A1:1,", 1000)})
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"result": "ok"})
+	})
+	router.GET("/pdf", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/pdf", []byte(strings.Repeat("%PDF", 1000)))
+	})
+	router.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, "text/plain", []byte(strings.Repeat("x", 2000)))
+	})
+	router.GET("/created", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	return router
+}
+
+func getGzip(router *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGzipCompressesLargeJSON(t *testing.T) {
+	router := newGzipRouter()
+
+	w := getGzip(router, "/big", "gzip, deflate")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Content-Type = %q, want JSON kept", w.Header().Get("Content-Type"))
+	}
+
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(body, &decoded); err != nil || decoded["cells"] != strings.Repeat("A1:1,", 1000) {
+		t.Errorf("decompressed body doesn't round-trip: %v", err)
+	}
+}
+
+func TestGzipLeavesResponseAloneWithoutHeader(t *testing.T) {
+	router := newGzipRouter()
+
+	for _, acceptEncoding := range []string{"", "deflate", "gzip;q=0"} {
+		w := getGzip(router, "/big", acceptEncoding)
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want none", acceptEncoding, got)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Errorf("Accept-Encoding %q: body is not plain JSON", acceptEncoding)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q, want Accept-Encoding", acceptEncoding, got)
+		}
+	}
+}
+
+func TestGzipSkipsSmallAndCompressedResponses(t *testing.T) {
+	router := newGzipRouter()
+
+	w := getGzip(router, "/small", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"result":"ok"}` {
+		t.Errorf("small response = %q encoded %q, want it sent as is", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+
+	w = getGzip(router, "/pdf", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(w.Body.String(), "%PDF") {
+		t.Errorf("PDF was compressed: Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+
+	// Already encoded responses aren't compressed again
+	w = getGzip(router, "/encoded", "gzip")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != strings.Repeat("x", 2000) {
+		t.Errorf("encoded response was altered: Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestGzipKeepsStatusWithoutBody(t *testing.T) {
+	router := newGzipRouter()
+
+	if w := getGzip(router, "/created", "gzip"); w.Code != http.StatusCreated || w.Body.Len() != 0 {
+		t.Errorf("bodyless response = %d with %d bytes, want 201 and none", w.Code, w.Body.Len())
+	}
+	if w := getGzip(router, "/missing", "gzip"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown route = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseCIDRs parses CIDR ranges, accepting bare IPs as single-host ranges
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPFilter middleware only lets through clients whose IP is in allow and
+// not in deny, answering 403 otherwise. The client IP comes from
+// c.ClientIP, so forwarded headers are honored only from the engine's
+// trusted proxies.
+func IPFilter(allow, deny []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IPAllowed(c, allow, deny) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// IPAllowed reports whether the client of c is in allow and not in deny,
+// by the same rules as IPFilter
+func IPAllowed(c *gin.Context, allow, deny []*net.IPNet) bool {
+	ip := net.ParseIP(c.ClientIP())
+	return ip != nil && !containsIP(deny, ip) && containsIP(allow, ip)
+}
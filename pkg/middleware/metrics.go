@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that matched no route, so scanners
+// probing random paths add one series rather than one per path
+const unmatchedRoute = "unmatched"
+
+// HTTP request metrics recorded by Metrics, labelled by method, route
+// template and status code
+var (
+	HTTPRequests = metrics.NewMultiCounterVec(
+		"touchcalc_http_requests_total",
+		"HTTP requests by method, route and status.",
+		"method", "route", "status",
+	)
+	HTTPRequestsInFlight = metrics.NewGauge(
+		"touchcalc_http_requests_in_flight",
+		"HTTP requests being served.",
+	)
+	HTTPRequestDuration = metrics.NewHistogramVec(
+		"touchcalc_http_request_duration_seconds",
+		"HTTP request latency by method, route and status.",
+		metrics.DefaultBuckets,
+		"method", "route", "status",
+	)
+)
+
+func init() {
+	metrics.Default.Register(HTTPRequests)
+	metrics.Default.Register(HTTPRequestsInFlight)
+	metrics.Default.Register(HTTPRequestDuration)
+}
+
+// Metrics records every request in HTTPRequests, HTTPRequestsInFlight and
+// HTTPRequestDuration. Requests are labelled by the route template, such
+// as /browser/:param1/dropbox, never the raw path, and methods outside the
+// standard set are labelled OTHER, so the series count stays bounded.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		HTTPRequestsInFlight.Add(1)
+		defer HTTPRequestsInFlight.Add(-1)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := metricsMethod(c.Request.Method)
+		status := strconv.Itoa(c.Writer.Status())
+		HTTPRequests.Inc(method, route, status)
+		HTTPRequestDuration.Observe(time.Since(start).Seconds(), method, route, status)
+	}
+}
+
+// metricsMethod returns method when it is a standard one, otherwise OTHER
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -1,23 +1,86 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORS middleware handles Cross-Origin Resource Sharing
+// CORS middleware handles Cross-Origin Resource Sharing, allowing any
+// origin
 func CORS() gin.HandlerFunc {
+	return CORSWithOptions(CORSOptions{})
+}
+
+// CORSWithMethods is CORS that also answers OPTIONS from the route table:
+// known paths get 204 with an Allow header, and preflights are told the
+// same methods, while unknown paths get 404. A nil methods answers every
+// OPTIONS request with 204 as CORS does.
+func CORSWithMethods(methods MethodsFunc) gin.HandlerFunc {
+	return CORSWithOptions(CORSOptions{Methods: methods})
+}
+
+// CORSOptions adjusts CORSWithOptions
+type CORSOptions struct {
+	// Origins, such as https://app.example.com, allowed to make
+	// credentialed cross-origin requests. Only they get CORS headers, with
+	// their own origin echoed back. Empty allows any origin with "*".
+	AllowedOrigins []string
+	// Answer OPTIONS from the route table, as CORSWithMethods does
+	Methods MethodsFunc
+}
+
+// CORSWithOptions is CORS with options
+func CORSWithOptions(opts CORSOptions) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		allowed[normalizeOrigin(origin)] = true
+	}
+
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		corsAllowed := true
+		if len(allowed) == 0 {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			// Responses differ by origin, so caches must keep them apart
+			c.Writer.Header().Add("Vary", "Origin")
+			origin := c.GetHeader("Origin")
+			corsAllowed = origin != "" && allowed[normalizeOrigin(origin)]
+			if corsAllowed {
+				c.Header("Access-Control-Allow-Origin", origin)
+			}
+		}
+		if corsAllowed {
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+			c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		}
 
 		if c.Request.Method == "OPTIONS" {
+			if opts.Methods != nil {
+				methods := opts.Methods(c.Request.URL.Path)
+				if len(methods) == 0 {
+					c.AbortWithStatus(http.StatusNotFound)
+					return
+				}
+				allow := strings.Join(methods, ", ")
+				c.Header("Allow", allow)
+				if corsAllowed {
+					c.Header("Access-Control-Allow-Methods", allow)
+				}
+			}
 			c.AbortWithStatus(204)
 			return
 		}
@@ -26,22 +89,141 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
+// normalizeOrigin puts an origin in the form browsers send, for comparison
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+// Access log formats
+const (
+	// LogFormatText writes one Apache-style line per request
+	LogFormatText = "text"
+	// LogFormatJSON writes one JSON object per request, for log aggregators
+	LogFormatJSON = "json"
+)
+
+// LoggerOptions adjusts LoggerWithOptions
+type LoggerOptions struct {
+	// LogFormatText or LogFormatJSON; empty is text
+	Format string
+	// Context fields added to each entry, as LoggerWithFields takes them
+	Fields []string
+	// Where entries go; nil is gin.DefaultWriter
+	Output io.Writer
+}
+
 // Logger middleware logs HTTP requests
 func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		// Custom log format
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
+	return LoggerWithFields()
+}
+
+// LoggerWithFields logs HTTP requests like Logger and appends the named
+// context fields as key="value" pairs. Handlers add fields with c.Set;
+// "user", "request_id" and "route" fall back to the session cookie, the
+// X-Request-ID header and the matched route. Empty fields are omitted.
+func LoggerWithFields(fields ...string) gin.HandlerFunc {
+	return LoggerWithOptions(LoggerOptions{Fields: fields})
+}
+
+// LoggerWithOptions logs HTTP requests in the given format. Either way
+// the ID set by RequestID is included, so entries can be matched with the
+// client's X-Request-ID and with other logs of the request.
+func LoggerWithOptions(opts LoggerOptions) gin.HandlerFunc {
+	out := opts.Output
+	if out == nil {
+		out = gin.DefaultWriter
+	}
+	fields := opts.Fields
+	if !slices.Contains(fields, RequestIDKey) {
+		fields = append(append([]string{}, fields...), RequestIDKey)
+	}
+	var logger *slog.Logger
+	if opts.Format == LogFormatJSON {
+		logger = slog.New(slog.NewJSONHandler(out, nil))
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path = path + "?" + raw
+		}
+		c.Next()
+
+		if logger != nil {
+			logJSON(c, logger, start, path, fields)
+			return
+		}
+
+		line := fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"",
+			c.ClientIP(),
+			time.Now().Format(time.RFC1123),
+			c.Request.Method,
+			path,
+			c.Request.Proto,
+			c.Writer.Status(),
+			time.Since(start),
+			c.Request.UserAgent(),
+			c.Errors.ByType(gin.ErrorTypePrivate).String(),
 		)
-	})
+		for _, field := range fields {
+			if value := logField(c, field); value != "" {
+				line += fmt.Sprintf(" %s=%q", field, value)
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// logJSON writes one request as a JSON object, at warning level for
+// client errors and error level for server errors
+func logJSON(c *gin.Context, logger *slog.Logger, start time.Time, path string, fields []string) {
+	status := c.Writer.Status()
+	attrs := []slog.Attr{
+		slog.String("method", c.Request.Method),
+		slog.String("path", path),
+		slog.Int("status", status),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.String("client_ip", c.ClientIP()),
+		slog.String("user_agent", c.Request.UserAgent()),
+	}
+	if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+		attrs = append(attrs, slog.String("error", errs))
+	}
+	for _, field := range fields {
+		if value := logField(c, field); value != "" {
+			attrs = append(attrs, slog.String(field, value))
+		}
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case status >= http.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+	logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+}
+
+// logField resolves a configured access log field from the request context
+func logField(c *gin.Context, field string) string {
+	if value, ok := c.Get(field); ok {
+		return fmt.Sprint(value)
+	}
+
+	switch field {
+	case "user":
+		if user := c.GetString(CurrentUserKey); user != "" {
+			return user
+		}
+		return SessionUser(c)
+	case RequestIDKey:
+		return c.GetHeader(RequestIDHeader)
+	case "route":
+		return c.FullPath()
+	}
+	return ""
 }
 
 // Recovery middleware recovers from panics
@@ -58,19 +240,216 @@ func Recovery() gin.HandlerFunc {
 func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user from cookie or session
-		user, err := c.Cookie("user")
-		if err != nil || user == "" {
+		user := SessionUser(c)
+		if user == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			c.Abort()
 			return
 		}
 
 		// Set user in context for handlers to use
-		c.Set("current_user", user)
+		c.Set(CurrentUserKey, user)
+		c.Next()
+	}
+}
+
+// SessionTokenCookie carries the signed token identifying the session's
+// user, when session tokens are on
+const SessionTokenCookie = "session_token"
+
+// TokenParser verifies a session token, returning the user it was issued
+// to and the token version it was issued at
+type TokenParser func(token string) (string, int, error)
+
+var sessionTokens TokenParser
+
+// UseSessionTokens makes sessions identified by the token in
+// SessionTokenCookie, checked with parse, instead of the plain user
+// cookie, which anyone can set. A nil parse goes back to the plain cookie.
+func UseSessionTokens(parse TokenParser) {
+	sessionTokens = parse
+}
+
+// SessionUser returns the user the request's session belongs to, or ""
+// when there is no session or its token doesn't verify
+func SessionUser(c *gin.Context) string {
+	user, _ := session(c)
+	return user
+}
+
+// session returns the user the request's session belongs to and the token
+// version it was issued at. With session tokens on both come from the
+// signed token, so neither can be set by the client; the plain version
+// cookie is only read alongside the plain user cookie, which is no safer.
+func session(c *gin.Context) (string, int) {
+	if sessionTokens != nil {
+		token, err := c.Cookie(SessionTokenCookie)
+		if err != nil || token == "" {
+			return "", 0
+		}
+		user, version, err := sessionTokens(token)
+		if err != nil {
+			return "", 0
+		}
+		return user, version
+	}
+
+	user, err := c.Cookie("user")
+	if err != nil {
+		return "", 0
+	}
+	// Older clients store the address JSON-quoted
+	if len(user) > 1 && user[0] == '"' && user[len(user)-1] == '"' {
+		var unquoted string
+		if json.Unmarshal([]byte(user), &unquoted) != nil {
+			return "", 0
+		}
+		user = unquoted
+	}
+	return user, cookieVersion(c)
+}
+
+// SessionVersionCookie carries the token version a session was issued at
+const SessionVersionCookie = "session_version"
+
+// SessionValidator reports whether user's session issued at version is
+// current. It gets the request so it can consult the right tenant.
+type SessionValidator func(c *gin.Context, user string, version int) bool
+
+// AuthRequired middleware is like Authentication but also rejects sessions
+// whose token version is stale, e.g. after a password change elsewhere.
+// The version is the one signed into the session token; plain cookie
+// sessions without a version cookie are treated as version 0.
+func AuthRequired(validate SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, version := session(c)
+		if user == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		if !validate(c, user, version) {
+			clearSession(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			c.Abort()
+			return
+		}
+
+		c.Set(CurrentUserKey, user)
 		c.Next()
 	}
 }
 
+// cookieVersion is the token version in the plain version cookie: 0
+// without one, and -1, matching nothing, for one that doesn't parse
+func cookieVersion(c *gin.Context) int {
+	raw, err := c.Cookie(SessionVersionCookie)
+	if err != nil || raw == "" {
+		return 0
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		return -1
+	}
+	return version
+}
+
+// TenantKey is the context key holding the request's tenant
+const TenantKey = "tenant"
+
+// Tenant records the tenant served on the request's host, as listed in
+// hosts, under TenantKey, where storage resolution and the access log pick
+// it up. Clients can't pick a tenant of their choosing, and browsers keep
+// each host's session cookies apart, so sessions stay with their tenant.
+// Requests to other hosts belong to no tenant. A host listed with a tenant
+// known doesn't recognise is refused rather than served from the shared
+// backend.
+func Tenant(hosts map[string]string, known func(tenant string) bool) gin.HandlerFunc {
+	byHost := make(map[string]string, len(hosts))
+	for host, tenant := range hosts {
+		byHost[strings.ToLower(host)] = tenant
+	}
+	return func(c *gin.Context) {
+		host := c.Request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tenant, ok := byHost[strings.ToLower(host)]; ok {
+			if known != nil && !known(tenant) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Unknown tenant"})
+				return
+			}
+			c.Set(TenantKey, tenant)
+		}
+		c.Next()
+	}
+}
+
+// SessionExpiresCookie carries the Unix time at which a session expires
+const SessionExpiresCookie = "session_expires"
+
+// SessionGrace handles sessions past their expiry. For grace after a
+// session expires, the user is sent to reauthURL with the URL they asked
+// for in "next", so signing in again picks up where they left off; after
+// that the session is cleared. Sessions without an expiry cookie pass.
+func SessionGrace(grace time.Duration, reauthURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, err := c.Cookie(SessionExpiresCookie)
+		if err != nil || raw == "" {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		unix, err := strconv.ParseInt(raw, 10, 64)
+		expires := time.Unix(unix, 0)
+		if err == nil && now.Before(expires) {
+			c.Next()
+			return
+		}
+
+		if err == nil && now.Before(expires.Add(grace)) {
+			target := reauthURL + "?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+			if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+				c.Redirect(http.StatusFound, target)
+			} else {
+				// Forms and API calls can't be replayed through a redirect,
+				// so let the client send the user to the prompt instead
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired", "reauth": target})
+			}
+			c.Abort()
+			return
+		}
+
+		clearSession(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		c.Abort()
+	}
+}
+
+// SafeRedirect reports whether next is a local path that is safe to
+// redirect to after signing in. Browsers drop tabs and newlines from a
+// Location and read a backslash as a slash, so "/\t/evil.example" and
+// "/\\evil.example" leave the site; anything holding either is refused.
+func SafeRedirect(next string) bool {
+	if strings.Contains(next, "\\") || strings.IndexFunc(next, unicode.IsControl) >= 0 {
+		return false
+	}
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		return false
+	}
+	target, err := url.Parse(next)
+	return err == nil && target.Scheme == "" && target.Host == ""
+}
+
+func clearSession(c *gin.Context) {
+	c.SetCookie("user", "", -1, "/", "", false, true)
+	c.SetCookie(SessionTokenCookie, "", -1, "/", "", false, true)
+	c.SetCookie(SessionVersionCookie, "", -1, "/", "", false, true)
+	c.SetCookie(SessionExpiresCookie, "", -1, "/", "", false, true)
+}
+
 // SecureHeaders middleware adds security headers
 func SecureHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// methodOrder is the order methods are listed in Allow headers
+var methodOrder = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// MethodsFunc reports the methods a request path is routed for; none means
+// the path is unknown
+type MethodsFunc func(path string) []string
+
+// RouteMethods answers from the routes registered on router. They are read
+// on each call, so routes added after the middleware is installed count.
+func RouteMethods(router *gin.Engine) MethodsFunc {
+	return func(path string) []string {
+		seen := map[string]bool{}
+		for _, route := range router.Routes() {
+			if routeMatches(route.Path, path) {
+				seen[route.Method] = true
+			}
+		}
+		if len(seen) == 0 {
+			return nil
+		}
+		seen[http.MethodOptions] = true
+
+		var methods []string
+		for _, method := range methodOrder {
+			if seen[method] {
+				methods = append(methods, method)
+			}
+		}
+		return methods
+	}
+}
+
+// routeMatches reports whether path fits a gin route pattern, where
+// ":name" stands for one segment and "*name" for the rest of the path
+func routeMatches(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrettyJSONKey is the context key set when the request's JSON response
+// should be indented
+const PrettyJSONKey = "pretty_json"
+
+// PrettyJSON decides whether JSON responses are indented, recording the
+// choice under PrettyJSONKey: a ?pretty= query parameter asks for it
+// either way, and byDefault applies otherwise.
+func PrettyJSON(byDefault bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pretty := byDefault
+		if raw, ok := c.GetQuery("pretty"); ok {
+			if raw == "" {
+				pretty = true
+			} else if parsed, err := strconv.ParseBool(raw); err == nil {
+				pretty = parsed
+			}
+		}
+		if pretty {
+			c.Set(PrettyJSONKey, true)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrettyJSONQueryOverridesDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		byDefault bool
+		query     string
+		want      bool
+	}{
+		{false, "", false},
+		{false, "?pretty=1", true},
+		{false, "?pretty", true},
+		{false, "?pretty=bogus", false},
+		{true, "", true},
+		{true, "?pretty=0", false},
+		{true, "?pretty=false", false},
+	}
+	for _, tc := range cases {
+		router := gin.New()
+		router.Use(PrettyJSON(tc.byDefault))
+		router.GET("/", func(c *gin.Context) {
+			c.String(http.StatusOK, strconv.FormatBool(c.GetBool(PrettyJSONKey)))
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tc.query, nil))
+		if got := w.Body.String(); got != strconv.FormatBool(tc.want) {
+			t.Errorf("default %v, %q: pretty = %s, want %v", tc.byDefault, tc.query, got, tc.want)
+		}
+	}
+}
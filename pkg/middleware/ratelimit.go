@@ -0,0 +1,329 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitDecisions counts requests seen by every rate limiter by result.
+// Per-client counts are kept by the limiter itself, see Stats.
+var RateLimitDecisions = metrics.NewCounterVec(
+	"touchcalc_ratelimit_requests_total",
+	"Requests seen by the rate limiter by result.",
+	"result",
+	"allowed", "throttled",
+)
+
+func init() {
+	metrics.Default.Register(RateLimitDecisions)
+}
+
+// OverflowKey is the stats entry collecting clients seen once
+// StatsLimits.MaxTracked clients are already tracked
+const OverflowKey = "other"
+
+// StatsLimits bounds the memory the limiter spends on clients. Clients idle
+// for IdleTTL are forgotten, both their bucket and their counts, so a client
+// returning after that starts afresh.
+type StatsLimits struct {
+	IdleTTL    time.Duration // zero keeps clients forever
+	MaxTracked int           // clients counted individually; zero is unlimited
+}
+
+// ClientStats counts one client's requests since it was last forgotten
+type ClientStats struct {
+	Key       string    `json:"key"`
+	Hits      uint64    `json:"hits"`
+	Throttled uint64    `json:"throttled"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// MarshalJSON also emits last_seen under its old name, lastseen, which
+// clients written before the snake_case field names still read
+func (s ClientStats) MarshalJSON() ([]byte, error) {
+	type stats ClientStats
+	return json.Marshal(struct {
+		stats
+		OldLastSeen time.Time `json:"lastseen"`
+	}{stats(s), s.LastSeen})
+}
+
+// SlowStart configures the rate limiter's adaptive mode. A client's
+// allowance is a fraction of the full rate and burst: new clients start at
+// Initial, gain Step with every allowed request up to 1, and fall back to
+// Initial whenever they are throttled.
+type SlowStart struct {
+	Initial float64
+	Step    float64
+}
+
+// RateLimiter is a per-client token bucket
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	slowStart *SlowStart
+	clients   map[string]*clientBucket
+	stats     map[string]*ClientStats
+	limits    StatsLimits
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type clientBucket struct {
+	tokens    float64
+	allowance float64
+	last      time.Time
+}
+
+// NewRateLimiter allows each client rps requests per second on average and
+// bursts of up to burst requests
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rps,
+		burst:   float64(burst),
+		clients: make(map[string]*clientBucket),
+		stats:   make(map[string]*ClientStats),
+		now:     time.Now,
+	}
+}
+
+// EnableSlowStart switches the limiter to adaptive mode
+func (l *RateLimiter) EnableSlowStart(cfg SlowStart) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cfg.Initial = math.Min(math.Max(cfg.Initial, 0), 1)
+	l.slowStart = &cfg
+}
+
+// SetStatsLimits bounds the clients the limiter remembers
+func (l *RateLimiter) SetStatsLimits(limits StatsLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// capacity is the bucket size for a client at the given allowance; it
+// never drops below one request
+func (l *RateLimiter) capacity(allowance float64) float64 {
+	return math.Max(1, l.burst*allowance)
+}
+
+// Allow reports whether the client identified by key may make a request now
+func (l *RateLimiter) Allow(key string) bool {
+	allowed, _ := l.Check(key)
+	return allowed
+}
+
+// Check is Allow also reporting, for a refused request, how long until the
+// client may make another
+func (l *RateLimiter) Check(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.clients[key]
+	if !ok {
+		allowance := 1.0
+		if l.slowStart != nil {
+			allowance = l.slowStart.Initial
+		}
+		b = &clientBucket{allowance: allowance, last: now}
+		b.tokens = l.capacity(allowance)
+		l.clients[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = math.Min(l.capacity(b.allowance), b.tokens+elapsed*l.rate*b.allowance)
+
+	if b.tokens < 1 {
+		if l.slowStart != nil {
+			b.allowance = l.slowStart.Initial
+			b.tokens = math.Min(b.tokens, l.capacity(b.allowance))
+		}
+		l.record(key, false, now)
+		var wait time.Duration
+		if refill := l.rate * b.allowance; refill > 0 {
+			wait = time.Duration((1 - b.tokens) / refill * float64(time.Second))
+		}
+		return false, wait
+	}
+
+	b.tokens--
+	l.record(key, true, now)
+	if l.slowStart != nil && b.allowance < 1 {
+		b.allowance += l.slowStart.Step
+		if b.allowance > 1-1e-9 {
+			// Snap to the full limit so float drift can't leave it a hair short
+			b.allowance = 1
+		}
+	}
+	return true, 0
+}
+
+// record counts a request from key, folding it into OverflowKey when
+// MaxTracked other clients are already counted
+func (l *RateLimiter) record(key string, allowed bool, now time.Time) {
+	st, ok := l.stats[key]
+	if !ok {
+		tracked := len(l.stats)
+		if _, ok := l.stats[OverflowKey]; ok {
+			tracked--
+		}
+		if l.limits.MaxTracked > 0 && tracked >= l.limits.MaxTracked {
+			key = OverflowKey
+			st = l.stats[key]
+		}
+		if st == nil {
+			st = &ClientStats{Key: key}
+			l.stats[key] = st
+		}
+	}
+
+	st.LastSeen = now
+	if allowed {
+		st.Hits++
+		RateLimitDecisions.Inc("allowed")
+	} else {
+		st.Throttled++
+		RateLimitDecisions.Inc("throttled")
+	}
+}
+
+// sweep forgets clients idle for IdleTTL. It walks every client, so it
+// runs at most once per IdleTTL.
+func (l *RateLimiter) sweep(now time.Time) {
+	ttl := l.limits.IdleTTL
+	if ttl <= 0 || now.Sub(l.lastSweep) < ttl {
+		return
+	}
+	l.lastSweep = now
+
+	cutoff := now.Add(-ttl)
+	for key, b := range l.clients {
+		if !b.last.After(cutoff) {
+			delete(l.clients, key)
+		}
+	}
+	for key, st := range l.stats {
+		if !st.LastSeen.After(cutoff) {
+			delete(l.stats, key)
+		}
+	}
+}
+
+// Stats returns the counts of every remembered client, most throttled first
+func (l *RateLimiter) Stats() []ClientStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	stats := make([]ClientStats, 0, len(l.stats))
+	for _, st := range l.stats {
+		// Skip clients gone idle since the last sweep
+		if l.limits.IdleTTL > 0 && now.Sub(st.LastSeen) >= l.limits.IdleTTL {
+			continue
+		}
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Throttled != stats[j].Throttled {
+			return stats[i].Throttled > stats[j].Throttled
+		}
+		if stats[i].Hits != stats[j].Hits {
+			return stats[i].Hits > stats[j].Hits
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	return stats
+}
+
+// Allowance returns the fraction of the full limit key currently gets
+func (l *RateLimiter) Allowance(key string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.clients[key]; ok {
+		return b.allowance
+	}
+	if l.slowStart != nil {
+		return l.slowStart.Initial
+	}
+	return 1
+}
+
+// Middleware limits requests per client IP, answering 429 when exceeded
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return l.middleware(func(c *gin.Context) string { return c.ClientIP() })
+}
+
+func (l *RateLimiter) middleware(clientKey func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if allowed, wait := l.Check(clientKey(c)); !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DefaultRateLimitIdleTTL is how long RateLimit keeps the bucket of a
+// client that has stopped making requests
+const DefaultRateLimitIdleTTL = 10 * time.Minute
+
+// RateLimitOptions adjusts RateLimitWithOptions
+type RateLimitOptions struct {
+	// Key clients by the last X-Forwarded-For address, the one the proxy
+	// in front added, rather than c.ClientIP(). Only set this behind a
+	// proxy that always sets the header, or clients can pick their own.
+	TrustForwardedFor bool
+	// Evict buckets idle this long; zero uses DefaultRateLimitIdleTTL
+	IdleTTL time.Duration
+}
+
+// RateLimit allows each client IP rps requests per second on average and
+// bursts of up to burst, answering the rest with 429 and a Retry-After
+// header. Idle clients' buckets are swept away, so memory tracks only
+// recently active clients.
+func RateLimit(rps float64, burst int) gin.HandlerFunc {
+	return RateLimitWithOptions(rps, burst, RateLimitOptions{})
+}
+
+// RateLimitWithOptions is RateLimit with options
+func RateLimitWithOptions(rps float64, burst int, opts RateLimitOptions) gin.HandlerFunc {
+	return newRateLimit(rps, burst, opts).middleware(rateLimitKey(opts.TrustForwardedFor))
+}
+
+func newRateLimit(rps float64, burst int, opts RateLimitOptions) *RateLimiter {
+	if opts.IdleTTL <= 0 {
+		opts.IdleTTL = DefaultRateLimitIdleTTL
+	}
+	l := NewRateLimiter(rps, burst)
+	l.SetStatsLimits(StatsLimits{IdleTTL: opts.IdleTTL})
+	return l
+}
+
+func rateLimitKey(trustForwardedFor bool) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		if trustForwardedFor {
+			addrs := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+			if last := strings.TrimSpace(addrs[len(addrs)-1]); last != "" {
+				return last
+			}
+		}
+		return c.ClientIP()
+	}
+}
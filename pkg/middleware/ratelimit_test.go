@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(slowStart bool) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := NewRateLimiter(10, 10)
+	l.now = clock.now
+	if slowStart {
+		l.EnableSlowStart(SlowStart{Initial: 0.2, Step: 0.1})
+	}
+	return l, clock
+}
+
+// burst counts how many back-to-back requests key gets through
+func burst(l *RateLimiter, key string) int {
+	n := 0
+	for l.Allow(key) {
+		n++
+		if n > 100 {
+			break
+		}
+	}
+	return n
+}
+
+func TestRateLimiterFullBurstWithoutSlowStart(t *testing.T) {
+	l, _ := newTestLimiter(false)
+
+	if got := burst(l, "1.2.3.4"); got != 10 {
+		t.Errorf("new client burst = %d, want 10", got)
+	}
+}
+
+func TestSlowStartRampsUpNewClient(t *testing.T) {
+	l, clock := newTestLimiter(true)
+
+	if got := burst(l, "1.2.3.4"); got != 2 {
+		t.Fatalf("new client burst = %d, want 2", got)
+	}
+
+	// Well-behaved traffic earns a larger allowance. The throttled request
+	// above reset it, so start over from the initial allowance.
+	for i := 0; i < 8; i++ {
+		clock.advance(time.Second)
+		if !l.Allow("1.2.3.4") {
+			t.Fatalf("paced request %d was throttled", i)
+		}
+	}
+	if a := l.Allowance("1.2.3.4"); a < 0.999 {
+		t.Fatalf("allowance after good history = %.2f, want 1", a)
+	}
+
+	clock.advance(time.Second)
+	if got := burst(l, "1.2.3.4"); got != 10 {
+		t.Errorf("ramped client burst = %d, want 10", got)
+	}
+}
+
+func TestSlowStartCurtailsViolator(t *testing.T) {
+	l, clock := newTestLimiter(true)
+
+	for i := 0; i < 10; i++ {
+		clock.advance(time.Second)
+		l.Allow("5.6.7.8")
+	}
+	if a := l.Allowance("5.6.7.8"); a < 0.999 {
+		t.Fatalf("allowance = %.2f, want fully ramped", a)
+	}
+
+	// Exhausting the bucket is a violation and drops the allowance
+	clock.advance(time.Second)
+	burst(l, "5.6.7.8")
+	if a := l.Allowance("5.6.7.8"); a != 0.2 {
+		t.Errorf("allowance after violation = %.2f, want 0.2", a)
+	}
+
+	clock.advance(time.Second)
+	if got := burst(l, "5.6.7.8"); got != 2 {
+		t.Errorf("burst after violation = %d, want 2", got)
+	}
+}
+
+func TestSlowStartTracksClientsIndependently(t *testing.T) {
+	l, clock := newTestLimiter(true)
+
+	for i := 0; i < 10; i++ {
+		clock.advance(time.Second)
+		l.Allow("good")
+	}
+	burst(l, "bad")
+
+	if a := l.Allowance("good"); a < 0.999 {
+		t.Errorf("good client allowance = %.2f, want 1", a)
+	}
+	if a := l.Allowance("bad"); a != 0.2 {
+		t.Errorf("bad client allowance = %.2f, want 0.2", a)
+	}
+}
+
+func TestThrottledRequestsAreCounted(t *testing.T) {
+	l, _ := newTestLimiter(false)
+	allowed := RateLimitDecisions.Value("allowed")
+	throttled := RateLimitDecisions.Value("throttled")
+
+	for i := 0; i < 12; i++ {
+		l.Allow("1.2.3.4")
+	}
+
+	if got := RateLimitDecisions.Value("allowed") - allowed; got != 10 {
+		t.Errorf("exported allowed count grew by %d, want 10", got)
+	}
+	if got := RateLimitDecisions.Value("throttled") - throttled; got != 2 {
+		t.Errorf("exported throttled count grew by %d, want 2", got)
+	}
+	stats := l.Stats()
+	if len(stats) != 1 || stats[0].Key != "1.2.3.4" || stats[0].Hits != 10 || stats[0].Throttled != 2 {
+		t.Errorf("stats = %+v, want 10 hits and 2 throttled for 1.2.3.4", stats)
+	}
+}
+
+func TestIdleClientsExpire(t *testing.T) {
+	l, clock := newTestLimiter(false)
+	l.SetStatsLimits(StatsLimits{IdleTTL: time.Minute})
+
+	l.Allow("idle")
+	clock.advance(30 * time.Second)
+	l.Allow("active")
+	clock.advance(40 * time.Second)
+
+	stats := l.Stats()
+	if len(stats) != 1 || stats[0].Key != "active" {
+		t.Fatalf("stats = %+v, want only the active client", stats)
+	}
+
+	clock.advance(time.Minute)
+	l.Allow("new")
+	l.mu.Lock()
+	clients, tracked := len(l.clients), len(l.stats)
+	l.mu.Unlock()
+	if clients != 1 || tracked != 1 {
+		t.Errorf("remembered %d buckets and %d stats after idling, want 1 each", clients, tracked)
+	}
+}
+
+func TestClientStatsKeepOldFieldName(t *testing.T) {
+	seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	raw, err := json.Marshal(ClientStats{Key: "1.2.3.4", Hits: 3, LastSeen: seen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"last_seen", "lastseen"} {
+		if fields[name] != "2024-01-02T03:04:05Z" {
+			t.Errorf("%s = %v in %s", name, fields[name], raw)
+		}
+	}
+}
+
+func TestStatsOverflowIntoSharedEntry(t *testing.T) {
+	l, _ := newTestLimiter(false)
+	l.SetStatsLimits(StatsLimits{MaxTracked: 2})
+
+	for _, key := range []string{"a", "b", "c", "d", "a"} {
+		l.Allow(key)
+	}
+
+	counts := map[string]uint64{}
+	for _, st := range l.Stats() {
+		counts[st.Key] = st.Hits
+	}
+	want := map[string]uint64{"a": 2, "b": 1, OverflowKey: 2}
+	if len(counts) != len(want) {
+		t.Fatalf("stats = %v, want %v", counts, want)
+	}
+	for key, hits := range want {
+		if counts[key] != hits {
+			t.Errorf("%s hits = %d, want %d", key, counts[key], hits)
+		}
+	}
+}
+
+func newRateLimitRouter(l *RateLimiter, trustForwardedFor bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// c.ClientIP() takes the header only from configured proxies
+	router.SetTrustedProxies(nil)
+	router.POST("/login", l.middleware(rateLimitKey(trustForwardedFor)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func postLogin(router *gin.Engine, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitBurstThen429(t *testing.T) {
+	router := newRateLimitRouter(newRateLimit(0.5, 3, RateLimitOptions{}), false)
+
+	for i := 0; i < 3; i++ {
+		if w := postLogin(router, "203.0.113.7:1234", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst = %d, want 200", i, w.Code)
+		}
+	}
+	w := postLogin(router, "203.0.113.7:1234", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past the burst = %d, want 429", w.Code)
+	}
+	// One token every 2s
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	// Other clients have buckets of their own
+	if w := postLogin(router, "203.0.113.8:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("other client = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitForwardedForOnlyWhenTrusted(t *testing.T) {
+	// Untrusted, every request comes from the proxy's address
+	router := newRateLimitRouter(newRateLimit(0.5, 1, RateLimitOptions{}), false)
+	postLogin(router, "10.0.0.1:1234", "198.51.100.1")
+	if w := postLogin(router, "10.0.0.1:1234", "198.51.100.2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For got its own bucket: %d", w.Code)
+	}
+
+	// Trusted, the address the proxy added names the client
+	router = newRateLimitRouter(newRateLimit(0.5, 1, RateLimitOptions{TrustForwardedFor: true}), true)
+	postLogin(router, "10.0.0.1:1234", "198.51.100.1")
+	if w := postLogin(router, "10.0.0.1:1234", "203.0.113.9, 198.51.100.2"); w.Code != http.StatusOK {
+		t.Errorf("second forwarded client = %d, want 200", w.Code)
+	}
+	if w := postLogin(router, "10.0.0.1:1234", "198.51.100.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("repeat forwarded client = %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitReclaimsIdleBuckets(t *testing.T) {
+	l := newRateLimit(1, 5, RateLimitOptions{IdleTTL: time.Minute})
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l.now = clock.now
+	router := newRateLimitRouter(l, false)
+
+	for i := 0; i < 50; i++ {
+		postLogin(router, fmt.Sprintf("198.51.100.%d:1234", i), "")
+	}
+	if got := len(l.clients); got != 50 {
+		t.Fatalf("tracked %d clients, want 50", got)
+	}
+
+	// Only the client still active survives the next sweep
+	clock.advance(2 * time.Minute)
+	postLogin(router, "203.0.113.7:1234", "")
+	if got := len(l.clients); got != 1 {
+		t.Errorf("tracked %d clients after idling, want 1", got)
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID, in from a proxy or client and
+// back out on the response
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey holds the request ID in the gin context, and names it in
+// access logs
+const RequestIDKey = "request_id"
+
+// requestIDPattern is what an incoming ID must look like to be kept;
+// anything else, which could forge log entries, is replaced
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDContextKey struct{}
+
+// RequestID gives every request an ID: the X-Request-ID it came with, such
+// as one a load balancer assigned, or a new random one. The ID is set
+// under RequestIDKey, in the request's context for code without the gin
+// context, and in the X-Request-ID response header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDFrom returns the ID RequestID gave the request ctx belongs to,
+// or "" outside one
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
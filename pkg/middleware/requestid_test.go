@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRequestIDRouter(format string, out *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), LoggerWithOptions(LoggerOptions{Format: format, Fields: []string{"route"}, Output: out}))
+	router.GET("/sheets/:name", func(c *gin.Context) {
+		// The ID reaches code that only has the request context
+		if id := RequestIDFrom(c.Request.Context()); id != c.GetString(RequestIDKey) {
+			c.String(http.StatusInternalServerError, "context ID %q, gin ID %q", id, c.GetString(RequestIDKey))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestRequestIDGeneratedAndLoggedAsJSON(t *testing.T) {
+	var out bytes.Buffer
+	router := newRequestIDRouter(LogFormatJSON, &out)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sheets/budget?x=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	id := w.Header().Get(RequestIDHeader)
+	if len(id) != 32 {
+		t.Fatalf("X-Request-ID = %q, want a generated 32-character ID", id)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry is not one JSON object: %v\n%s", err, out.String())
+	}
+	want := map[string]interface{}{
+		"msg":        "request",
+		"level":      "INFO",
+		"method":     "GET",
+		"path":       "/sheets/budget?x=1",
+		"status":     float64(200),
+		"client_ip":  "192.0.2.1",
+		"request_id": id,
+		"route":      "/sheets/:name",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms = %v, want a number", entry["latency_ms"])
+	}
+}
+
+func TestRequestIDKeepsIncomingID(t *testing.T) {
+	var out bytes.Buffer
+	router := newRequestIDRouter(LogFormatText, &out)
+
+	req := httptest.NewRequest(http.MethodGet, "/sheets/budget", nil)
+	req.Header.Set(RequestIDHeader, "lb-7f3a")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "lb-7f3a" {
+		t.Errorf("X-Request-ID = %q, want the incoming lb-7f3a", got)
+	}
+	if !strings.Contains(out.String(), `request_id="lb-7f3a"`) {
+		t.Errorf("text log line lacks the request ID: %s", out.String())
+	}
+}
+
+func TestRequestIDReplacesUnsafeID(t *testing.T) {
+	var out bytes.Buffer
+	router := newRequestIDRouter(LogFormatJSON, &out)
+
+	req := httptest.NewRequest(http.MethodGet, "/sheets/budget", nil)
+	req.Header.Set(RequestIDHeader, `x" status=500`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got == `x" status=500` || len(got) != 32 {
+		t.Errorf("X-Request-ID = %q, want a fresh ID", got)
+	}
+}
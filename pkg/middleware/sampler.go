@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redacted replaces the value of every sensitive parameter in a sample
+const Redacted = "[redacted]"
+
+// UnmatchedRoute stands in for the path of requests no route matched,
+// whose raw path may carry anything
+const UnmatchedRoute = "(unmatched)"
+
+// DefaultSensitiveParams are the parameter names whose values samples never
+// keep, see NewSampler for how names are matched
+var DefaultSensitiveParams = []string{"password", "token", "secret", "key", "email", "owner", "code", "session", "t"}
+
+// RequestSample is the anonymized shape of one request. The route is the
+// matched template rather than the path, and no client address, user,
+// headers or body are kept.
+type RequestSample struct {
+	Time       time.Time         `json:"time"`
+	Method     string            `json:"method"`
+	Route      string            `json:"route"`
+	Status     int               `json:"status"`
+	DurationMS float64           `json:"duration_ms"`
+	Params     map[string]string `json:"params,omitempty"`
+}
+
+// Sampler records the shape of a random fraction of requests in a ring
+// buffer, for diagnosing intermittent problems without logging everything
+type Sampler struct {
+	mu        sync.Mutex
+	rate      float64
+	sensitive []string
+	samples   []RequestSample
+	next      int
+	full      bool
+	random    func() float64
+}
+
+// NewSampler samples the given fraction of requests, keeping the latest
+// size of them. Values of parameters named like any of sensitive, by
+// default DefaultSensitiveParams, are redacted; an exact match is required
+// for names of one or two letters, so "t" catches the reset token but not
+// "format".
+func NewSampler(rate float64, size int, sensitive []string) *Sampler {
+	if size < 1 {
+		size = 1
+	}
+	if len(sensitive) == 0 {
+		sensitive = DefaultSensitiveParams
+	}
+	lowered := make([]string, len(sensitive))
+	for i, name := range sensitive {
+		lowered[i] = strings.ToLower(name)
+	}
+	return &Sampler{
+		rate:      rate,
+		sensitive: lowered,
+		samples:   make([]RequestSample, size),
+		random:    rand.Float64,
+	}
+}
+
+// Middleware records the requests picked for sampling once they complete
+func (s *Sampler) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.random() >= s.rate {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		sample := RequestSample{
+			Time:       start.UTC(),
+			Method:     c.Request.Method,
+			Route:      route,
+			Status:     c.Writer.Status(),
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Params:     s.params(c),
+		}
+		s.add(sample)
+	}
+}
+
+// params collects the path, query and already parsed form parameters, with
+// sensitive values redacted. The body is never read here, so handlers
+// that don't parse a form contribute no form parameters.
+func (s *Sampler) params(c *gin.Context) map[string]string {
+	params := make(map[string]string)
+	for _, p := range c.Params {
+		params[p.Key] = s.redact(p.Key, p.Value)
+	}
+	add := func(values url.Values) {
+		for key, vals := range values {
+			if len(vals) > 0 {
+				params[key] = s.redact(key, vals[0])
+			}
+		}
+	}
+	add(c.Request.URL.Query())
+	add(c.Request.PostForm)
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+func (s *Sampler) redact(name, value string) string {
+	name = strings.ToLower(name)
+	for _, sensitive := range s.sensitive {
+		if name == sensitive || (len(sensitive) > 2 && strings.Contains(name, sensitive)) {
+			return Redacted
+		}
+	}
+	return value
+}
+
+func (s *Sampler) add(sample RequestSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Samples returns the buffered samples, newest first
+func (s *Sampler) Samples() []RequestSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := s.next
+	if s.full {
+		count = len(s.samples)
+	}
+	samples := make([]RequestSample, 0, count)
+	for i := 1; i <= count; i++ {
+		samples = append(samples, s.samples[(s.next-i+len(s.samples))%len(s.samples)])
+	}
+	return samples
+}
+
+// Rate returns the fraction of requests sampled
+func (s *Sampler) Rate() float64 {
+	return s.rate
+}
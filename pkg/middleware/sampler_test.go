@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSampledRouter(s *Sampler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(s.Middleware())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/users/:email/sheets/:name", func(c *gin.Context) {
+		c.PostForm("fname")
+		c.Status(http.StatusCreated)
+	})
+	return router
+}
+
+func TestSamplerCapturesConfiguredFraction(t *testing.T) {
+	const requests = 10000
+	s := NewSampler(0.1, requests, nil)
+	s.random = rand.New(rand.NewPCG(1, 2)).Float64
+	router := newSampledRouter(s)
+
+	for i := 0; i < requests; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+
+	got := len(s.Samples())
+	if got < requests*8/100 || got > requests*12/100 {
+		t.Errorf("sampled %d of %d requests, want about 10%%", got, requests)
+	}
+}
+
+func TestSamplerRedactsSensitiveParams(t *testing.T) {
+	s := NewSampler(1, 10, nil)
+	router := newSampledRouter(s)
+
+	form := "fname=budget&password=hunter2&api_key=abc&owner=bob@example.com"
+	req := httptest.NewRequest(http.MethodPost, "/users/alice@example.com/sheets/q3?t=resettoken&format=csv", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	samples := s.Samples()
+	if len(samples) != 1 {
+		t.Fatalf("got %d samples, want 1", len(samples))
+	}
+	sample := samples[0]
+	if sample.Route != "/users/:email/sheets/:name" || sample.Method != http.MethodPost || sample.Status != http.StatusCreated {
+		t.Errorf("sample = %+v, want the route template, method and status", sample)
+	}
+
+	want := map[string]string{
+		"email":    Redacted,
+		"name":     "q3",
+		"t":        Redacted,
+		"format":   "csv",
+		"fname":    "budget",
+		"password": Redacted,
+		"api_key":  Redacted,
+		"owner":    Redacted,
+	}
+	for key, value := range want {
+		if sample.Params[key] != value {
+			t.Errorf("param %s = %q, want %q", key, sample.Params[key], value)
+		}
+	}
+	for _, secret := range []string{"alice@example.com", "bob@example.com", "hunter2", "resettoken", "abc"} {
+		for key, value := range sample.Params {
+			if strings.Contains(value, secret) {
+				t.Errorf("param %s leaks %q", key, secret)
+			}
+		}
+	}
+}
+
+func TestSamplerKeepsLatestSamples(t *testing.T) {
+	s := NewSampler(1, 3, nil)
+	router := newSampledRouter(s)
+
+	for _, path := range []string{"/ping", "/missing/1", "/missing/2", "/ping?n=4"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	samples := s.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want the buffer's 3", len(samples))
+	}
+	if samples[0].Params["n"] != "4" {
+		t.Errorf("newest sample = %+v, want the last request first", samples[0])
+	}
+	// Unmatched paths are never recorded as they were requested
+	if samples[1].Route != UnmatchedRoute || samples[1].Status != http.StatusNotFound {
+		t.Errorf("unmatched sample = %+v", samples[1])
+	}
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutBody is sent with the 503 for requests that ran out of time
+var timeoutBody = []byte(`{"error":"Request timed out"}`)
+
+// timeoutBufferLimit is how much of a response Timeout holds back. Past it
+// the response goes out as it is written, so downloads and exports stream
+// rather than pile up in memory.
+const timeoutBufferLimit = 64 << 10
+
+// Timeout gives each request d to finish. The request's context carries
+// the deadline, so anything passed c.Request.Context() gives up when it
+// passes; the client then gets 503 right away, and whatever the handler
+// goes on to write is dropped. Responses are held back until the handler
+// returns so a 503 can still replace them, except that a handler which
+// flushes, or writes more than timeoutBufferLimit, commits to its response
+// and only has its context cancelled.
+// WebSocket upgrades are left alone. A d of zero or less disables it.
+func Timeout(d time.Duration) gin.HandlerFunc {
+	if d <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		if IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		tw := newTimeoutWriter(c.Writer)
+		c.Writer = tw
+		done := make(chan struct{})
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			select {
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					tw.timeout()
+				}
+			case <-done:
+			}
+		}()
+
+		defer func() {
+			close(done)
+			<-watched
+			// A handler that panicked leaves its response to Recovery
+			c.Writer = tw.ResponseWriter
+		}()
+		c.Next()
+		// The handler may have noticed the deadline before the watcher did
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			tw.timeout()
+		} else {
+			tw.finish()
+		}
+	}
+}
+
+// timeoutWriter holds a handler's response back until it finishes, so a
+// timeout can send 503 in its place. The handler writes to its own header
+// map, leaving the real one to the timeout.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu        sync.Mutex
+	header    http.Header
+	status    int
+	buf       bytes.Buffer
+	sent      bool // the handler asked for the headers to go out
+	committed bool // the handler's response went out as is
+	timedOut  bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		ResponseWriter: w,
+		header:         w.Header().Clone(),
+		status:         w.Status(),
+	}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+	} else if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	} else {
+		w.sent = true
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed || w.timedOut {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed || w.timedOut {
+		return w.ResponseWriter.Size()
+	}
+	if !w.sent && w.buf.Len() == 0 {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	return w.Size() != -1
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.committed && w.buf.Len()+len(data) > timeoutBufferLimit {
+		w.commit()
+	}
+	if w.committed {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what is held back and everything after it straight through,
+// so streamed responses aren't stalled; past this point a timeout can only
+// cancel the context
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.commit()
+	w.ResponseWriter.Flush()
+}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	w.committed = true
+	return w.ResponseWriter.Hijack()
+}
+
+// commit sends the held back headers and body; w.mu must be held
+func (w *timeoutWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	header := w.ResponseWriter.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range w.header {
+		header[name] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.sent {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// timeout answers 503 unless the handler's response is already on its way
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed || w.timedOut {
+		return
+	}
+	w.timedOut = true
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Retry-After", "1")
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(timeoutBody)
+	w.ResponseWriter.Flush()
+}
+
+// finish sends the handler's response once it returns in time
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.commit()
+	}
+}
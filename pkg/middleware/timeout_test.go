@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeoutCancelsSlowHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(20 * time.Millisecond))
+
+	cancelled := make(chan error, 1)
+	router.GET("/slow", func(c *gin.Context) {
+		// Stands in for a storage call that honours the context
+		select {
+		case <-c.Request.Context().Done():
+			cancelled <- c.Request.Context().Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+		c.Header("X-Late", "yes")
+		c.JSON(http.StatusOK, gin.H{"result": "ok"})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow request = %d, want 503", w.Code)
+	}
+	if body := w.Body.String(); body != `{"error":"Request timed out"}` {
+		t.Errorf("body = %q, want only the timeout error", body)
+	}
+	if w.Header().Get("X-Late") != "" {
+		t.Error("headers set after the timeout were sent")
+	}
+	if err := <-cancelled; err != context.DeadlineExceeded {
+		t.Errorf("handler's context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTimeoutPassesFastResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(time.Second))
+	router.POST("/save", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); !ok {
+			t.Error("request context has no deadline")
+		}
+		c.Header("X-Saved", "budget")
+		c.JSON(http.StatusCreated, gin.H{"result": "ok"})
+	})
+	router.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/save", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != `{"result":"ok"}` || w.Header().Get("X-Saved") != "budget" {
+		t.Errorf("got %d %q %v, want the handler's response", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("empty response = %d, want 204", w.Code)
+	}
+}
+
+func TestTimeoutAfterFlushOnlyCancels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(20 * time.Millisecond))
+	router.GET("/stream", func(c *gin.Context) {
+		c.String(http.StatusOK, "first,")
+		c.Writer.Flush()
+		<-c.Request.Context().Done()
+		c.String(http.StatusOK, "second")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "first,second" {
+		t.Errorf("got %d %q, want the streamed response untouched", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutStreamsLargeResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Timeout(20 * time.Millisecond))
+	chunk := strings.Repeat("x", timeoutBufferLimit/2)
+	router.GET("/download", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			c.Writer.WriteString(chunk)
+		}
+		<-c.Request.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 3*len(chunk) {
+		t.Errorf("got %d with %d bytes, want the response streamed past the buffer", w.Code, w.Body.Len())
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timingsKey is the context key holding the request's *Timings
+const timingsKey = "server_timing"
+
+// Timings accumulates named durations for a request's Server-Timing header
+type Timings struct {
+	mu      sync.Mutex
+	names   []string
+	totals  map[string]time.Duration
+	counts  map[string]int
+	started time.Time
+}
+
+// Add records d against name; repeated names are summed
+func (t *Timings) Add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.totals[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.totals[name] += d
+	t.counts[name]++
+}
+
+// header renders the Server-Timing value, with the time spent so far in
+// the handler first
+func (t *Timings) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := []string{fmt.Sprintf("handler;dur=%.3f", milliseconds(time.Since(t.started)))}
+	for _, name := range t.names {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.3f;desc=\"%d ops\"", name, milliseconds(t.totals[name]), t.counts[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// TimingsFrom returns the request's Timings, or nil when Server-Timing is
+// not being reported for it
+func TimingsFrom(c *gin.Context) *Timings {
+	if t, ok := c.Get(timingsKey); ok {
+		return t.(*Timings)
+	}
+	return nil
+}
+
+// ServerTiming adds a Server-Timing header reporting the handler's
+// duration and anything recorded with TimingsFrom(c).Add, for requests
+// allow accepts. The header is set just before the response is written.
+func ServerTiming(allow func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allow(c) {
+			c.Next()
+			return
+		}
+
+		t := &Timings{
+			totals:  make(map[string]time.Duration),
+			counts:  make(map[string]int),
+			started: time.Now(),
+		}
+		c.Set(timingsKey, t)
+		c.Writer = &timingWriter{ResponseWriter: c.Writer, timings: t}
+		c.Next()
+	}
+}
+
+// timingWriter sets the Server-Timing header when the response headers
+// are about to go out
+type timingWriter struct {
+	gin.ResponseWriter
+	timings *Timings
+	once    sync.Once
+}
+
+func (w *timingWriter) setHeader() {
+	w.once.Do(func() {
+		if !w.ResponseWriter.Written() {
+			w.Header().Set("Server-Timing", w.timings.header())
+		}
+	})
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
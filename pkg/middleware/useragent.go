@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseUserAgentPatterns compiles user-agent regular expressions, such as
+// "(?i)scrapy|python-requests"
+func ParseUserAgentPatterns(values []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, value := range values {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user-agent pattern %q: %w", value, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// BlockUserAgents answers 403 to requests whose User-Agent matches any of
+// patterns. Health checks are always let through, so probes from blocked
+// tooling can't take the instance out of rotation.
+func BlockUserAgents(patterns []*regexp.Regexp) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(patterns) == 0 || strings.HasPrefix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+		ua := c.Request.UserAgent()
+		for _, pattern := range patterns {
+			if pattern.MatchString(ua) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBlockUserAgents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	patterns, err := ParseUserAgentPatterns([]string{"(?i)badbot", "^curl/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(BlockUserAgents(patterns))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/save", ok)
+	router.GET("/health", ok)
+	router.GET("/health/ready", ok)
+
+	for _, tc := range []struct {
+		path, ua string
+		want     int
+	}{
+		{"/save", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0", http.StatusOK},
+		{"/save", "", http.StatusOK},
+		{"/save", "Mozilla/5.0 (compatible; BadBot/2.1)", http.StatusForbidden},
+		{"/save", "curl/8.5.0", http.StatusForbidden},
+		{"/health", "curl/8.5.0", http.StatusOK},
+		{"/health/ready", "BadBot", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("User-Agent", tc.ua)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("GET %s with User-Agent %q = %d, want %d", tc.path, tc.ua, w.Code, tc.want)
+		}
+	}
+}
+
+func TestParseUserAgentPatternsRejectsInvalid(t *testing.T) {
+	if _, err := ParseUserAgentPatterns([]string{"bot("}); err == nil {
+		t.Error("ParseUserAgentPatterns accepted an invalid regular expression")
+	}
+}
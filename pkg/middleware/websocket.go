@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// CloseTryAgainLater is the WebSocket close code (1013) upgrades refused
+// for being over a connection limit are closed with
+const CloseTryAgainLater = 1013
+
+// websocketGUID is appended to the client's key to accept a handshake
+// (RFC 6455 section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket connection gauges and refusals by the limit that was hit. The
+// gauges follow every WebSocketLimiter in the process.
+var (
+	WebSocketConnections = metrics.NewGauge(
+		"touchcalc_websocket_connections",
+		"Open WebSocket connections.",
+	)
+	WebSocketUsers = metrics.NewGauge(
+		"touchcalc_websocket_users",
+		"Users with at least one open WebSocket connection.",
+	)
+	WebSocketRefused = metrics.NewCounterVec(
+		"touchcalc_websocket_refused_total",
+		"WebSocket upgrades refused by the limit they hit.",
+		"limit",
+		"server", "user",
+	)
+)
+
+func init() {
+	metrics.Default.Register(WebSocketConnections)
+	metrics.Default.Register(WebSocketUsers)
+	metrics.Default.Register(WebSocketRefused)
+}
+
+// WebSocketLimiter caps the WebSocket connections open at once, across the
+// server and per user, so they can't exhaust file descriptors. A
+// connection counts for as long as the handler that upgraded it runs.
+type WebSocketLimiter struct {
+	maxTotal   int
+	maxPerUser int
+	identify   UserIdentity
+
+	mu      sync.Mutex
+	total   int
+	perUser map[string]int
+}
+
+// NewWebSocketLimiter allows maxTotal connections server-wide and
+// maxPerUser for each user identified by identify; anonymous connections
+// count only toward the server-wide cap. Zero or less disables either cap.
+func NewWebSocketLimiter(maxTotal, maxPerUser int, identify UserIdentity) *WebSocketLimiter {
+	return &WebSocketLimiter{
+		maxTotal:   maxTotal,
+		maxPerUser: maxPerUser,
+		identify:   identify,
+		perUser:    make(map[string]int),
+	}
+}
+
+// Open returns the number of connections open now
+func (l *WebSocketLimiter) Open() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// OpenFor returns the number of connections user has open now
+func (l *WebSocketLimiter) OpenFor(user string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.perUser[user]
+}
+
+// acquire takes a connection slot for user, reporting the limit that
+// refused it, or "" when it was granted
+func (l *WebSocketLimiter) acquire(user string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return "server"
+	}
+	if user != "" && l.maxPerUser > 0 && l.perUser[user] >= l.maxPerUser {
+		return "user"
+	}
+
+	l.total++
+	WebSocketConnections.Add(1)
+	if user != "" {
+		if l.perUser[user] == 0 {
+			WebSocketUsers.Add(1)
+		}
+		l.perUser[user]++
+	}
+	return ""
+}
+
+func (l *WebSocketLimiter) release(user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	WebSocketConnections.Add(-1)
+	if user != "" {
+		l.perUser[user]--
+		if l.perUser[user] <= 0 {
+			delete(l.perUser, user)
+			WebSocketUsers.Add(-1)
+		}
+	}
+}
+
+// Middleware counts WebSocket upgrades against the limits, completing the
+// handshake of refused ones only to close them with CloseTryAgainLater,
+// since browsers don't show scripts why a failed upgrade failed. Other
+// requests pass straight through.
+func (l *WebSocketLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		user := ""
+		if l.identify != nil {
+			user = l.identify(c)
+		}
+		if limit := l.acquire(user); limit != "" {
+			WebSocketRefused.Inc(limit)
+			reason := "too many connections"
+			if limit == "user" {
+				reason = "too many connections for this user"
+			}
+			refuseWebSocket(c, CloseTryAgainLater, reason)
+			return
+		}
+		defer l.release(user)
+		c.Next()
+	}
+}
+
+// IsWebSocketUpgrade reports whether r asks to switch to the WebSocket
+// protocol
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refuseWebSocket accepts the upgrade and immediately closes the
+// connection with code and reason. An upgrade without a key isn't a
+// handshake and gets a plain 400; when the connection can't be taken over
+// the client gets 503 instead.
+func refuseWebSocket(c *gin.Context, code int, reason string) {
+	key := c.GetHeader("Sec-WebSocket-Key")
+	if key == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Missing Sec-WebSocket-Key"})
+		return
+	}
+	conn, rw, err := c.Writer.Hijack()
+	if conn != nil {
+		defer conn.Close()
+	}
+	if err != nil {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many WebSocket connections"})
+		return
+	}
+	c.Abort()
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+
+	// An unmasked close frame; control frame payloads stop at 125 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	rw.Write([]byte{0x88, byte(len(payload))})
+	rw.Write(payload)
+	rw.Flush()
+}
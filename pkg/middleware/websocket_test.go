@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newWebSocketServer serves /ws behind limiter with a handler that accepts
+// the upgrade and holds the connection until release is closed, as a
+// collaboration socket would while the user is connected
+func newWebSocketServer(t *testing.T, limiter *WebSocketLimiter) (*httptest.Server, chan struct{}) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	router := gin.New()
+	router.GET("/ws", limiter.Middleware(), func(c *gin.Context) {
+		conn, rw, err := c.Writer.Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		<-release
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		server.Close()
+	})
+	return server, release
+}
+
+// dialWebSocket sends an upgrade as user and returns the connection and
+// the status line of the response
+func dialWebSocket(t *testing.T, server *httptest.Server, user string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nX-User: %s\r\n\r\n", user)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading response failed: %v", err)
+	}
+	// Skip the rest of the headers
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "\r\n" {
+			break
+		}
+	}
+	return conn, reader, strings.TrimSpace(status)
+}
+
+// readClose reads a close frame, returning its code and reason
+func readClose(t *testing.T, reader *bufio.Reader) (int, string) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("reading frame failed: %v", err)
+	}
+	if header[0] != 0x88 {
+		t.Fatalf("frame opcode byte = %#x, want a final close frame", header[0])
+	}
+	payload := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("reading close payload failed: %v", err)
+	}
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
+
+func identifyByHeader(c *gin.Context) string {
+	return c.GetHeader("X-User")
+}
+
+func TestWebSocketServerCapRefusesNextConnection(t *testing.T) {
+	limiter := NewWebSocketLimiter(2, 0, identifyByHeader)
+	server, release := newWebSocketServer(t, limiter)
+
+	for _, user := range []string{"alice@example.com", "bob@example.com"} {
+		if _, _, status := dialWebSocket(t, server, user); !strings.Contains(status, "101") {
+			t.Fatalf("connection within the cap: %q, want 101", status)
+		}
+	}
+	if got := limiter.Open(); got != 2 {
+		t.Errorf("Open() = %d, want 2", got)
+	}
+
+	refusedBefore := WebSocketRefused.Value("server")
+	_, reader, status := dialWebSocket(t, server, "carol@example.com")
+	if !strings.Contains(status, "101") {
+		t.Fatalf("refused upgrade: %q, want the handshake completed", status)
+	}
+	if code, reason := readClose(t, reader); code != CloseTryAgainLater || reason != "too many connections" {
+		t.Errorf("close = %d %q, want %d too many connections", code, reason, CloseTryAgainLater)
+	}
+	if got := WebSocketRefused.Value("server") - refusedBefore; got != 1 {
+		t.Errorf("refusals counted = %d, want 1", got)
+	}
+
+	// Closed connections free their slots
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for limiter.Open() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := limiter.Open(); got != 0 {
+		t.Errorf("Open() after release = %d, want 0", got)
+	}
+}
+
+func TestWebSocketPerUserCap(t *testing.T) {
+	limiter := NewWebSocketLimiter(0, 1, identifyByHeader)
+	server, _ := newWebSocketServer(t, limiter)
+
+	if _, _, status := dialWebSocket(t, server, "alice@example.com"); !strings.Contains(status, "101") {
+		t.Fatalf("first connection: %q, want 101", status)
+	}
+	_, reader, _ := dialWebSocket(t, server, "alice@example.com")
+	if code, reason := readClose(t, reader); code != CloseTryAgainLater || !strings.Contains(reason, "user") {
+		t.Errorf("second connection for the user closed with %d %q, want %d for the user", code, reason, CloseTryAgainLater)
+	}
+
+	// Other users aren't affected
+	if _, _, status := dialWebSocket(t, server, "bob@example.com"); !strings.Contains(status, "101") {
+		t.Errorf("another user's connection: %q, want 101", status)
+	}
+	if got := limiter.OpenFor("alice@example.com"); got != 1 {
+		t.Errorf("OpenFor(alice) = %d, want 1", got)
+	}
+}
+
+func TestWebSocketLimiterIgnoresPlainRequests(t *testing.T) {
+	limiter := NewWebSocketLimiter(1, 1, identifyByHeader)
+	limiter.acquire("")
+	defer limiter.release("")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/page", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("plain request at the cap = %d, want 200", w.Code)
+	}
+}
+
+func TestWebSocketRefusalWithoutKeyIsBadRequest(t *testing.T) {
+	limiter := NewWebSocketLimiter(1, 0, identifyByHeader)
+	limiter.acquire("")
+	defer limiter.release("")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("keyless upgrade at the cap = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// logRequest serves one request through LoggerWithFields and returns the
+// access log output
+func logRequest(t *testing.T, fields []string, handler gin.HandlerFunc, req *http.Request) string {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	saved := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	t.Cleanup(func() { gin.DefaultWriter = saved })
+
+	router := gin.New()
+	router.Use(middleware.LoggerWithFields(fields...))
+	router.GET("/sheets/:name", handler)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestAccessLogIncludesConfiguredFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sheets/budget", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+
+	line := logRequest(t, []string{"user", "tenant", "request_id", "route"}, func(c *gin.Context) {
+		c.Set("tenant", "acme")
+		c.Status(http.StatusOK)
+	}, req)
+
+	assert.Contains(t, line, `"GET /sheets/budget HTTP/1.1 200`)
+	assert.Contains(t, line, `user="alice@example.com"`)
+	assert.Contains(t, line, `tenant="acme"`)
+	assert.Contains(t, line, `request_id="req-42"`)
+	assert.Contains(t, line, `route="/sheets/:name"`)
+}
+
+func TestAccessLogHandlerFieldsOverrideDefaults(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sheets/budget", nil)
+	req.Header.Set("X-Request-ID", "from-header")
+
+	line := logRequest(t, []string{"request_id", "sheet"}, func(c *gin.Context) {
+		c.Set("request_id", "from-handler")
+		c.Set("sheet", "budget")
+		c.Status(http.StatusOK)
+	}, req)
+
+	assert.Contains(t, line, `request_id="from-handler"`)
+	assert.Contains(t, line, `sheet="budget"`)
+}
+
+func TestAccessLogOmitsUnconfiguredAndEmptyFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sheets/budget", nil)
+
+	line := logRequest(t, []string{"user", "tenant"}, func(c *gin.Context) {
+		c.Set("route_name", "sheet")
+		c.Status(http.StatusOK)
+	}, req)
+
+	assert.NotContains(t, line, "user=")
+	assert.NotContains(t, line, "tenant=")
+	assert.NotContains(t, line, "route_name=")
+}
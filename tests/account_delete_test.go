@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAccountDelete serves self-deletion for a confirmed alice with soft
+// delete on, returning a service sharing the storage to inspect it with
+func setupAccountDelete(t *testing.T) (*gin.Engine, *auth.Service) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+
+	// Configured as NewHandler would with SOFT_DELETE_USERS=true and
+	// DELETION_REASON_MAX_LENGTH=20
+	service := auth.NewService(handler.Storage)
+	service.SetSoftDelete(true)
+	service.SetDeletionReasonLimit(20)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	router.POST("/profile/delete", handler.Auth.HandleAccountDelete)
+
+	require.NoError(t, service.CreateUser("alice@example.com", "password123"))
+	require.NoError(t, service.ConfirmUser("alice@example.com"))
+	return router, service
+}
+
+func deleteAccount(router *gin.Engine, form url.Values) (int, string) {
+	w := sendAs(router, http.MethodPost, "/profile/delete", "alice@example.com", form.Encode())
+	return w.Code, w.Body.String()
+}
+
+func TestSelfDeletionRecordsReason(t *testing.T) {
+	router, service := setupAccountDelete(t)
+
+	code, body := deleteAccount(router, url.Values{"password": {"password123"}, "reason": {"switching tools"}})
+	require.Equal(t, http.StatusOK, code, body)
+
+	exists, _ := service.UserExists("alice@example.com")
+	assert.False(t, exists)
+	entries, err := service.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice@example.com", entries[0].Email)
+	assert.Equal(t, "switching tools", entries[0].Reason)
+
+	tombstone, err := service.GetTombstone("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "switching tools", tombstone.Reason)
+}
+
+func TestSelfDeletionNeedsPassword(t *testing.T) {
+	router, service := setupAccountDelete(t)
+
+	code, _ := deleteAccount(router, url.Values{"password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = deleteAccount(router, url.Values{"reason": {"no password"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	exists, _ := service.UserExists("alice@example.com")
+	assert.True(t, exists)
+}
+
+func TestSelfDeletionRejectsLongReason(t *testing.T) {
+	router, service := setupAccountDelete(t)
+
+	code, body := deleteAccount(router, url.Values{"password": {"password123"}, "reason": {strings.Repeat("x", 21)}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body, "too long")
+
+	exists, _ := service.UserExists("alice@example.com")
+	assert.True(t, exists)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAdmin guards /admin as setupRoutes does, with admin@example.com
+// granted the admin entitlement, user@example.com a plain user and admins
+// as ADMIN_USERS
+func setupAdmin(t *testing.T, allowCIDRs, denyCIDRs []string, admins ...string) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	require.NoError(t, router.SetTrustedProxies([]string{"10.0.0.1"}))
+
+	allow, err := middleware.ParseCIDRs(allowCIDRs)
+	require.NoError(t, err)
+	deny, err := middleware.ParseCIDRs(denyCIDRs)
+	require.NoError(t, err)
+
+	handler.Storage = storage.NewMemoryStorage()
+	service := auth.NewService(handler.Storage)
+	service.SetAdmins(admins)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	require.NoError(t, service.CreateUser("admin@example.com", "password123"))
+	require.NoError(t, service.SetEntitlements("admin@example.com", []string{auth.EntitlementAdmin}))
+	require.NoError(t, service.CreateUser("user@example.com", "password123"))
+
+	admin := router.Group("/admin",
+		middleware.IPFilter(allow, deny),
+		middleware.AuthRequired(handler.Auth.ValidSession),
+		middleware.RequireEntitlement(auth.EntitlementAdmin, handler.Auth.CheckEntitlement))
+	admin.GET("/settings/:key", handler.Admin.HandleGetSetting)
+	return router
+}
+
+func adminRequest(router *gin.Engine, remoteAddr, forwardedFor string) int {
+	return adminRequestAs(router, remoteAddr, forwardedFor, "admin@example.com")
+}
+
+func adminRequestAs(router *gin.Engine, remoteAddr, forwardedFor, user string) int {
+	req := httptest.NewRequest(http.MethodGet, "/admin/settings/maintenance_mode", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	if user != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAdminAllowsConfiguredNetwork(t *testing.T) {
+	router := setupAdmin(t, []string{"192.168.0.0/16", "127.0.0.1"}, nil)
+
+	assert.Equal(t, http.StatusOK, adminRequest(router, "192.168.1.20:5000", ""))
+	assert.Equal(t, http.StatusOK, adminRequest(router, "127.0.0.1:5000", ""))
+}
+
+func TestAdminDeniesOtherNetworks(t *testing.T) {
+	router := setupAdmin(t, []string{"192.168.0.0/16"}, nil)
+
+	assert.Equal(t, http.StatusForbidden, adminRequest(router, "203.0.113.7:5000", ""))
+}
+
+func TestAdminDenyListOverridesAllow(t *testing.T) {
+	router := setupAdmin(t, []string{"192.168.0.0/16"}, []string{"192.168.66.0/24"})
+
+	assert.Equal(t, http.StatusForbidden, adminRequest(router, "192.168.66.10:5000", ""))
+	assert.Equal(t, http.StatusOK, adminRequest(router, "192.168.1.10:5000", ""))
+}
+
+func TestAdminHonorsTrustedProxyOnly(t *testing.T) {
+	router := setupAdmin(t, []string{"192.168.0.0/16"}, nil)
+
+	// Forwarded through the trusted proxy: the real client IP decides
+	assert.Equal(t, http.StatusOK, adminRequest(router, "10.0.0.1:5000", "192.168.1.20"))
+	assert.Equal(t, http.StatusForbidden, adminRequest(router, "10.0.0.1:5000", "203.0.113.7"))
+
+	// A spoofed header from an untrusted peer is ignored
+	assert.Equal(t, http.StatusForbidden, adminRequest(router, "203.0.113.7:5000", "192.168.1.20"))
+}
+
+func TestAdminRequiresAdminUser(t *testing.T) {
+	router := setupAdmin(t, []string{"192.168.0.0/16"}, nil)
+
+	// A trusted network alone isn't enough
+	assert.Equal(t, http.StatusUnauthorized, adminRequestAs(router, "192.168.1.20:5000", "", ""))
+	assert.Equal(t, http.StatusForbidden, adminRequestAs(router, "192.168.1.20:5000", "", "user@example.com"))
+	assert.Equal(t, http.StatusUnauthorized, adminRequestAs(router, "192.168.1.20:5000", "", "nobody@example.com"))
+
+	// Nor is an admin session from elsewhere
+	assert.Equal(t, http.StatusForbidden, adminRequestAs(router, "203.0.113.7:5000", "", "admin@example.com"))
+
+	// Users named in ADMIN_USERS are admins without the entitlement
+	router = setupAdmin(t, []string{"192.168.0.0/16"}, nil, "User@Example.com")
+	assert.Equal(t, http.StatusOK, adminRequestAs(router, "192.168.1.20:5000", "", "user@example.com"))
+}
+
+func TestParseCIDRsRejectsGarbage(t *testing.T) {
+	_, err := middleware.ParseCIDRs([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
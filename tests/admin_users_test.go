@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAdminUsers(t *testing.T) (*gin.Engine, *auth.Service) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Storage = storage.NewMemoryStorage()
+	service := auth.NewService(handler.Storage)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	router.DELETE("/admin/users/:email", handler.Admin.HandleDeleteUser)
+	router.POST("/admin/users/:email/restore", handler.Admin.HandleRestoreUser)
+	router.POST("/admin/trash/purge", handler.Admin.HandlePurgeTrash)
+	require.NoError(t, service.CreateUser("user@example.com", "password123"))
+	return router, service
+}
+
+func TestAdminDeleteUserToTrashAndRestore(t *testing.T) {
+	router, service := setupAdminUsers(t)
+
+	w := serve(router, http.MethodDelete, "/admin/users/user@example.com?trash=true&reason=support+ticket", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"trashed":true`)
+	exists, _ := service.UserExists("user@example.com")
+	assert.False(t, exists)
+
+	w = serve(router, http.MethodPost, "/admin/users/user@example.com/restore", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	ok, err := service.AuthenticateUser("user@example.com", "password123")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestAdminHardDeleteCannotBeRestored(t *testing.T) {
+	router, _ := setupAdminUsers(t)
+
+	w := serve(router, http.MethodDelete, "/admin/users/user@example.com", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"trashed":false`)
+
+	w = serve(router, http.MethodPost, "/admin/users/user@example.com/restore", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(router, http.MethodDelete, "/admin/users/user@example.com", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminPurgeTrash(t *testing.T) {
+	router, _ := setupAdminUsers(t)
+
+	w := serve(router, http.MethodPost, "/admin/trash/purge", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(router, http.MethodDelete, "/admin/users/user@example.com?trash=true", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(router, http.MethodPost, "/admin/trash/purge?older_than=1h", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"purged":0`)
+
+	w = serve(router, http.MethodPost, "/admin/trash/purge?older_than=0s", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"purged":1`)
+	w = serve(router, http.MethodPost, "/admin/users/user@example.com/restore", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
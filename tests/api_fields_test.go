@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAPIFields(t *testing.T) *gin.Engine {
+	router, handler := testutils.SetupTestServer(t)
+	router.GET("/api/me", handler.Auth.HandleMe)
+	router.GET("/api/sheets", handler.WebApp.HandleSheetsList)
+
+	user := models.User{
+		Email:       "alice@example.com",
+		Confirmed:   true,
+		CreatedOn:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		TOTPEnabled: true,
+	}
+	userJSON, err := user.ToJSON()
+	require.NoError(t, err)
+	item, err := json.Marshal(map[string]string{"type": "file", "data": userJSON})
+	require.NoError(t, err)
+	require.NoError(t, handler.Storage.PutItem("home/users/alice@example.com", string(item)))
+
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com", `{"path":["home","alice@example.com"],"type":"dir","data":["budget",".trash","plan"]}`))
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/budget", `{"type":"file","data":"A1:1"}`))
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/plan", `{"type":"file","data":"A1:22"}`))
+	return router
+}
+
+// fieldNames returns the keys of a JSON object, sorted
+func fieldNames(t *testing.T, raw json.RawMessage) []string {
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(raw, &fields))
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAPIMeFieldNames(t *testing.T) {
+	router := setupAPIFields(t)
+
+	w := getAs(router, "/api/me", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"confirmed", "created_at", "email", "entitlements", "last_login_at", "mfa_enabled"}, fieldNames(t, resp.Data))
+	assert.JSONEq(t, `{
+		"email": "alice@example.com",
+		"confirmed": true,
+		"mfa_enabled": true,
+		"entitlements": [],
+		"created_at": "2024-01-02T03:04:05Z",
+		"last_login_at": null
+	}`, string(resp.Data))
+}
+
+func TestAPIMeRequiresLogin(t *testing.T) {
+	router := setupAPIFields(t)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/api/me", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, getAs(router, "/api/me", "nobody@example.com").Code)
+}
+
+func TestAPISheetsFieldNames(t *testing.T) {
+	router := setupAPIFields(t)
+
+	w := getAs(router, "/api/sheets", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2, "the trash directory is not a sheet")
+	for _, sheet := range resp.Data {
+		assert.Equal(t, []string{"name", "size_bytes"}, fieldNames(t, sheet))
+	}
+	assert.JSONEq(t, `{"name":"budget","size_bytes":4}`, string(resp.Data[0]))
+	assert.JSONEq(t, `{"name":"plan","size_bytes":5}`, string(resp.Data[1]))
+}
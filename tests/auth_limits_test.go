@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testMaxEmail    = 20
+	testMaxPassword = 16
+)
+
+func setupLimits() *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.MaxEmailLength = testMaxEmail
+	handler.Config.MaxPasswordLength = testMaxPassword
+	handler.Config.MaxFieldLength = 16
+
+	api := router.Group("/")
+	{
+		api.POST("/iauth", handler.Auth.HandleAuth)
+		api.POST("/login", handler.Auth.HandleLogin)
+		api.POST("/register", handler.Auth.HandleRegister)
+		api.POST("/pwreset", handler.Auth.HandlePasswordResetPost)
+	}
+	return router
+}
+
+// emailOfLength builds a syntactically valid address exactly n characters long
+func emailOfLength(n int) string {
+	const domain = "@example.com"
+	return strings.Repeat("a", n-len(domain)) + domain
+}
+
+func postJSON(router *gin.Engine, path string, body map[string]string) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthFieldLengthLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	okEmail := emailOfLength(testMaxEmail)
+	longEmail := emailOfLength(testMaxEmail + 1)
+	okPassword := strings.Repeat("p", testMaxPassword)
+	longPassword := strings.Repeat("p", testMaxPassword+1)
+
+	endpoints := []struct {
+		path     string
+		pwdField string
+		extra    map[string]string
+	}{
+		{"/login", "password", nil},
+		{"/register", "password", nil},
+		{"/pwreset", "password", nil},
+		{"/iauth", "pwd", map[string]string{"action": "login"}},
+	}
+
+	for _, ep := range endpoints {
+		cases := []struct {
+			name     string
+			email    string
+			password string
+			tooLong  string
+		}{
+			{"at limit", okEmail, okPassword, ""},
+			{"email over limit", longEmail, okPassword, "email"},
+			{"password over limit", okEmail, longPassword, "password"},
+		}
+
+		for _, tc := range cases {
+			t.Run(ep.path+" "+tc.name, func(t *testing.T) {
+				router := setupLimits()
+				body := map[string]string{"email": tc.email, ep.pwdField: tc.password}
+				for k, v := range ep.extra {
+					body[k] = v
+				}
+
+				w := postJSON(router, ep.path, body)
+				if tc.tooLong == "" {
+					assert.NotContains(t, w.Body.String(), "fieldtoolong")
+					return
+				}
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				var resp map[string]interface{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "fieldtoolong", resp["data"])
+				assert.Equal(t, tc.tooLong, resp["field"])
+			})
+		}
+	}
+}
+
+func TestAuthOtherFieldLengthLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupLimits()
+
+	w := postJSON(router, "/iauth", map[string]string{
+		"action": strings.Repeat("x", 17),
+		"email":  emailOfLength(testMaxEmail),
+		"pwd":    "secret",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"action"`)
+}
+
+func TestPasswordLimitIsBcrypts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.MaxPasswordLength = 72
+	handler.Storage = storage.NewMemoryStorage()
+	handler.Auth = handlers.NewAuthHandler(handler, auth.NewService(handler.Storage))
+	router.POST("/register", handler.Auth.HandleRegister)
+	router.POST("/pwreset", handler.Auth.HandlePasswordResetPost)
+
+	// 72 bytes is bcrypt's limit; one more is refused before hashing
+	w := postJSON(router, "/register", map[string]string{"email": "long@example.com", "password": strings.Repeat("p", 72)})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for _, path := range []string{"/register", "/pwreset"} {
+		w = postJSON(router, path, map[string]string{"email": "longer@example.com", "password": strings.Repeat("p", 73)})
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "fieldtoolong", path)
+
+		// Bytes, not characters: 37 two-byte characters are 74 bytes
+		w = postJSON(router, path, map[string]string{"email": "longer@example.com", "password": strings.Repeat("é", 37)})
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+
+	// With the configured check off, bcrypt's limit still applies
+	handler.Config.MaxPasswordLength = 0
+	w = postJSON(router, "/register", map[string]string{"email": "longest@example.com", "password": strings.Repeat("p", 100)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
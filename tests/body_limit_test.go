@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveBodyLimit(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.Use(middleware.MaxBodySize(64))
+	router.POST("/save", middleware.BodyLimit(1024), handler.WebApp.HandleSavePost)
+	router.POST("/login", handler.Auth.HandleLogin)
+
+	// The form is "data=...&fname=budget": 18 bytes besides the sheet
+	sheet := func(bodySize int) url.Values {
+		return url.Values{"fname": {"budget"}, "data": {strings.Repeat("x", bodySize-18)}}
+	}
+	w := postSheet(router, "/save", sheet(1024))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = postSheet(router, "/save", sheet(1025))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Without a Content-Length the body is cut off while the handler
+	// reads it, which still answers 413 rather than the handler's error
+	req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(sheet(1025).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+
+	// Routes without a limit of their own get the default
+	w = serve(router, http.MethodPost, "/login", url.Values{"email": {strings.Repeat("x", 100)}}.Encode())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"email": {strings.Repeat("x", 100)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+}
@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/counters"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSheetsAreCounted(t *testing.T) {
+	router, handler := testutils.SetupTestServer(t)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.GET("/admin/counters", handler.Admin.HandleCounters)
+
+	require.Equal(t, http.StatusOK, postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"A1:1"}}).Code)
+	// Saving over an existing sheet doesn't create one
+	require.Equal(t, http.StatusOK, postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"A1:2"}}).Code)
+	require.Equal(t, http.StatusOK, postSheet(router, "/save", url.Values{"fname": {"plan"}, "data": {"A1:1"}}).Code)
+
+	created, err := handler.Counters.Get(counters.SheetsCreated)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), created)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/counters", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"ok","counters":{"sheets_created":2,"pdfs_generated":0}}`, w.Body.String())
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDownloadLimit(t *testing.T, policy string) *gin.Engine {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Config.MaxDownloadSize = 10
+	handler.Config.OversizedDownloads = policy
+	router.POST("/downloadfile", handler.WebApp.HandleDownloadFile)
+
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/small", `{"type":"file","data":"0123456789"}`))
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/huge", `{"type":"file","data":"`+strings.Repeat("x", 25)+`"}`))
+	return router
+}
+
+func download(router *gin.Engine, fname string) *httptest.ResponseRecorder {
+	return postSheet(router, "/downloadfile", url.Values{"fname": {fname}})
+}
+
+func TestDownloadWithinLimitIsSentInFull(t *testing.T) {
+	router := setupDownloadLimit(t, handlers.OversizedRefuse)
+
+	w := download(router, "small")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+}
+
+func TestOversizedDownloadIsRefused(t *testing.T) {
+	router := setupDownloadLimit(t, handlers.OversizedRefuse)
+
+	w := download(router, "huge")
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), "file is 25 bytes, download limit is 10")
+}
+
+func TestOversizedDownloadIsTruncated(t *testing.T) {
+	router := setupDownloadLimit(t, handlers.OversizedTruncate)
+
+	w := download(router, "huge")
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 0-9/25", w.Header().Get("Content-Range"))
+	assert.Equal(t, "true", w.Header().Get("X-Download-Truncated"))
+	assert.Equal(t, strings.Repeat("x", 10), w.Body.String())
+}
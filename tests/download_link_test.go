@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/signedurl"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDownloadLinks(t *testing.T) (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Config.DownloadLinkSecret = "test-link-secret"
+	handler.Config.DownloadLinkTTL = time.Hour
+	router.POST("/api/downloadlinks", handler.WebApp.HandleDownloadLinkCreate)
+	router.GET("/d/:token", handler.WebApp.HandleDownloadLink)
+
+	require.NoError(t, handler.Storage.PutItem("home/users/alice@example.com", `{"type":"file","data":"{}"}`))
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/budget", `{"type":"file","data":"A1:42"}`))
+	return router, handler
+}
+
+// signLink asks for a link to alice's fname and returns its URL
+func signLink(t *testing.T, router *gin.Engine, fname string, once bool) string {
+	form := url.Values{"fname": {fname}}
+	if once {
+		form.Set("once", "true")
+	}
+	w := postSheet(router, "/api/downloadlinks", form)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var link struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Once      bool      `json:"once"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, once, link.Once)
+	return link.URL
+}
+
+func TestDownloadLinkWorksWithoutSession(t *testing.T) {
+	router, _ := setupDownloadLinks(t)
+	link := signLink(t, router, "budget", false)
+	require.True(t, strings.HasPrefix(link, "/d/"))
+
+	for i := 0; i < 2; i++ {
+		w := serve(router, http.MethodGet, link, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "A1:42", w.Body.String())
+		assert.Equal(t, `attachment; filename="budget"`, w.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestDownloadLinkRejectsTampering(t *testing.T) {
+	router, _ := setupDownloadLinks(t)
+	link := signLink(t, router, "budget", false)
+
+	tampered := link[:len(link)-1] + "A"
+	if tampered == link {
+		tampered = link[:len(link)-1] + "B"
+	}
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, tampered, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/d/garbage", "").Code)
+}
+
+func TestDownloadLinkExpires(t *testing.T) {
+	router, handler := setupDownloadLinks(t)
+	handler.Config.DownloadLinkTTL = time.Nanosecond
+	link := signLink(t, router, "budget", false)
+
+	w := serve(router, http.MethodGet, link, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "link has expired")
+}
+
+func TestOneTimeDownloadLinkCannotBeReused(t *testing.T) {
+	router, _ := setupDownloadLinks(t)
+	link := signLink(t, router, "budget", true)
+
+	w := serve(router, http.MethodGet, link, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "A1:42", w.Body.String())
+
+	w = serve(router, http.MethodGet, link, "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "link has already been used")
+}
+
+func TestDownloadLinkRequiresOwnFile(t *testing.T) {
+	router, _ := setupDownloadLinks(t)
+
+	w := postSheet(router, "/api/downloadlinks", url.Values{"fname": {"missing"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = postSheet(router, "/api/downloadlinks", url.Values{"fname": {"../bob@example.com/budget"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(router, http.MethodPost, "/api/downloadlinks", url.Values{"fname": {"budget"}}.Encode())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCollaboratorLinkStopsAfterRevoke(t *testing.T) {
+	router, handler := setupDownloadLinks(t)
+	budget := []string{"home", "alice@example.com", "budget"}
+	require.NoError(t, storage.Grant(handler.Storage, budget, "bob@example.com", storage.PermissionRead))
+
+	w := sendAs(router, http.MethodPost, "/api/downloadlinks", "bob@example.com",
+		url.Values{"fname": {"budget"}, "owner": {"alice@example.com"}}.Encode())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var link struct {
+		URL string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+
+	w = serve(router, http.MethodGet, link.URL, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "A1:42", w.Body.String())
+
+	// Revoking bob's access also revokes the links signed for bob
+	require.NoError(t, storage.Revoke(handler.Storage, budget, "bob@example.com"))
+	w = serve(router, http.MethodGet, link.URL, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotContains(t, w.Body.String(), "A1:42")
+}
+
+func TestDownloadLinkOnlyServesSheets(t *testing.T) {
+	router, handler := setupDownloadLinks(t)
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/securestore", `{"type":"file","data":"secret"}`))
+
+	// Even correctly signed, links to a user record or app storage, or
+	// into a home that isn't an account's, serve nothing
+	signer := signedurl.New(handler.Config.DownloadLinkSecret)
+	for _, target := range [][2]string{
+		{"users", "alice@example.com"},
+		{"alice@example.com", "securestore"},
+		{"bob@example.com", "budget"},
+	} {
+		token, _, err := signer.Sign(target[0], target[1], "", time.Hour, false)
+		require.NoError(t, err)
+		w := serve(router, http.MethodGet, "/d/"+token, "")
+		assert.Equal(t, http.StatusNotFound, w.Code, target)
+		assert.NotContains(t, w.Body.String(), "secret")
+	}
+
+	w := postSheet(router, "/api/downloadlinks", url.Values{"fname": {"securestore"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDownloadLinksNeedTheirOwnSecret(t *testing.T) {
+	router, handler := setupDownloadLinks(t)
+	link := signLink(t, router, "budget", false)
+	handler.Config.DownloadLinkSecret = ""
+
+	// The cookie secret is no stand-in, so existing links stop working
+	// and no new ones are signed
+	w := serve(router, http.MethodGet, link, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "download links are disabled")
+	w = postSheet(router, "/api/downloadlinks", url.Values{"fname": {"budget"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
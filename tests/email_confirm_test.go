@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupConfirmation serves registration and confirmation with
+// confirmation required, and returns the service behind them
+func setupConfirmation(t *testing.T) (*gin.Engine, *auth.Service) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Storage = storage.NewMemoryStorage()
+	service := auth.NewService(handler.Storage)
+	service.SetRequireConfirmation(true)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	router.POST("/register", handler.Auth.HandleRegister)
+	router.GET("/confirm", handler.Auth.HandleConfirm)
+	return router, service
+}
+
+func TestRegisterRequiresConfirmation(t *testing.T) {
+	router, service := setupConfirmation(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"new@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"confirmemail"`)
+	for _, cookie := range w.Result().Cookies() {
+		assert.NotEqual(t, "user", cookie.Name, "an unconfirmed registration should not be logged in")
+	}
+
+	ok, err := service.AuthenticateUser("new@example.com", "password123")
+	assert.False(t, ok)
+	assert.Error(t, err)
+
+	// The emailed link confirms the account, and following it again is fine
+	token, err := service.GenerateConfirmationToken("new@example.com")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		w = serve(router, http.MethodGet, "/confirm?t="+url.QueryEscape(token), "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	ok, err = service.AuthenticateUser("new@example.com", "password123")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestConfirmRejectsUnknownToken(t *testing.T) {
+	router, _ := setupConfirmation(t)
+
+	for _, path := range []string{"/confirm", "/confirm?t=made-up"} {
+		w := serve(router, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "not valid", path)
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupEmailPreview(t *testing.T) *gin.Engine {
+	router, handler := testutils.SetupTestServer(t)
+	router.GET("/admin/email/preview", handler.Admin.HandleEmailPreview)
+	return router
+}
+
+func previewEmail(router *gin.Engine, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/email/preview?"+query, nil))
+	return w
+}
+
+func TestEmailPreviewRendersConfirmation(t *testing.T) {
+	router := setupEmailPreview(t)
+
+	w := previewEmail(router, "template=confirm")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "Confirm your TouchCalc account", w.Header().Get("X-Email-Subject"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "user@example.com")
+	assert.Contains(t, body, `href="https://touchcalc.example.com/link?t=sample-token"`)
+	assert.NotContains(t, body, "{{")
+}
+
+func TestEmailPreviewRendersReset(t *testing.T) {
+	router := setupEmailPreview(t)
+
+	w := previewEmail(router, "template=reset&locale=fr")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "Reset Password", w.Header().Get("X-Email-Subject"))
+	assert.Contains(t, w.Body.String(), "user@example.com")
+	assert.Contains(t, w.Body.String(), "sample-token")
+}
+
+func TestEmailPreviewRejectsUnknownTemplate(t *testing.T) {
+	router := setupEmailPreview(t)
+
+	w := previewEmail(router, "template=welcome")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "confirm")
+
+	w = previewEmail(router, "template=reset&locale=../../etc")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dbFailure = "dial tcp 10.0.0.5:3306: connection refused"
+
+// brokenStorage fails every file read with a backend error
+type brokenStorage struct {
+	*testutils.MockStorage
+}
+
+func (b *brokenStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	return nil, errors.New(dbFailure)
+}
+
+func registerWithBrokenStorage(t *testing.T, environment string) (int, string) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.Environment = environment
+	handler.Storage = &brokenStorage{testutils.NewMockStorage()}
+	handler.Auth = handlers.NewAuthHandler(handler, auth.NewService(handler.Storage))
+	router.POST("/register", handler.Auth.HandleRegister)
+
+	body, _ := json.Marshal(map[string]string{"email": "user@example.com", "password": "secret"})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	message, _ := resp["message"].(string)
+	return w.Code, message
+}
+
+func TestInternalErrorMaskedInProduction(t *testing.T) {
+	code, message := registerWithBrokenStorage(t, "production")
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.NotContains(t, message, "connection refused")
+	assert.Regexp(t, regexp.MustCompile(`^internal error \(ref [0-9a-f]{12}\)$`), message)
+}
+
+func TestInternalErrorDetailedInDevelopment(t *testing.T) {
+	code, message := registerWithBrokenStorage(t, "development")
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, message, dbFailure)
+	assert.Contains(t, message, "(ref ")
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func setupExport(t *testing.T) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.GET("/export/csv", handler.WebApp.HandleExportCSV)
+	router.GET("/export/xlsx", handler.WebApp.HandleExportXLSX)
+
+	data := "version:1.5\ncell:A1:t:name\ncell:B1:t:note\ncell:A2:t:Smith, J.\ncell:B2:t:said \"ok\"\\nthen left\ncell:B3:v:42\nsheet:c:3:r:3\n"
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {data}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	book, _ := json.Marshal(gin.H{
+		"numsheets": 2,
+		"sheetArr": gin.H{
+			"sheet1": gin.H{"name": "Income", "sheetstr": gin.H{"savestr": "cell:A1:t:salary\ncell:B1:v:5000\n"}},
+			"sheet2": gin.H{"name": "Costs", "sheetstr": gin.H{"savestr": "cell:A1:t:rent\ncell:B1:v:1200\n"}},
+		},
+	})
+	w = postSheet(router, "/save", url.Values{"fname": {"book"}, "data": {string(book)}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return router
+}
+
+func TestExportCSV(t *testing.T) {
+	router := setupExport(t)
+
+	w := getAs(router, "/export/csv?fname=budget", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="budget.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "name,note,\r\n\"Smith, J.\",\"said \"\"ok\"\"\r\nthen left\",\r\n,42,\r\n", w.Body.String())
+}
+
+func TestExportCSVOfWorkbookIsFirstTab(t *testing.T) {
+	router := setupExport(t)
+
+	w := getAs(router, "/export/csv?fname=book", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "salary,5000\r\n", w.Body.String())
+}
+
+func TestExportXLSX(t *testing.T) {
+	router := setupExport(t)
+
+	w := getAs(router, "/export/xlsx?fname=book", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="book.xlsx"`, w.Header().Get("Content-Disposition"))
+
+	f, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, []string{"Income", "Costs"}, f.GetSheetList())
+
+	rows, err := f.GetRows("Costs")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"rent", "1200"}}, rows)
+	cellType, err := f.GetCellType("Costs", "A1")
+	require.NoError(t, err)
+	assert.Equal(t, excelize.CellTypeInlineString, cellType)
+	cellType, err = f.GetCellType("Costs", "B1")
+	require.NoError(t, err)
+	assert.Contains(t, []excelize.CellType{excelize.CellTypeUnset, excelize.CellTypeNumber}, cellType)
+}
+
+func TestExportErrors(t *testing.T) {
+	router := setupExport(t)
+
+	for _, format := range []string{"csv", "xlsx"} {
+		w := getAs(router, "/export/"+format+"?fname=nosuchsheet", "alice@example.com")
+		assert.Equal(t, http.StatusNotFound, w.Code, format)
+		w = getAs(router, "/export/"+format, "alice@example.com")
+		assert.Equal(t, http.StatusBadRequest, w.Code, format)
+		w = getAs(router, "/export/"+format+"?fname=budget", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, format)
+	}
+}
+
+func TestExportRefusesHugeSheet(t *testing.T) {
+	router := setupExport(t)
+	w := postSheet(router, "/save", url.Values{"fname": {"huge"}, "data": {"version:1.5\nsheet:c:2000000000:r:1\n"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for _, format := range []string{"csv", "xlsx"} {
+		w = getAs(router, "/export/"+format+"?fname=huge", "alice@example.com")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, format)
+		assert.Empty(t, w.Header().Get("Content-Disposition"), format)
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pooledStorage reports fixed pool, disk and ping results on top of the mock
+type pooledStorage struct {
+	*testutils.MockStorage
+	pool      storage.PoolStats
+	free      uint64
+	total     uint64
+	pingError error
+	hang      chan struct{}
+}
+
+func (p *pooledStorage) Ping(ctx context.Context) error {
+	if p.hang != nil {
+		// Simulate a backend that ignores its context entirely
+		<-p.hang
+	}
+	return p.pingError
+}
+
+func (p *pooledStorage) PoolStats() storage.PoolStats {
+	return p.pool
+}
+
+func (p *pooledStorage) DiskUsage() (uint64, uint64, error) {
+	return p.free, p.total, nil
+}
+
+func setupReady(store storage.Storage) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = store
+	router.GET("/health/ready", handler.Health.HandleReady)
+	return router
+}
+
+func getReady(t *testing.T, router *gin.Engine) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func healthyStorage() *pooledStorage {
+	return &pooledStorage{
+		MockStorage: testutils.NewMockStorage(),
+		pool:        storage.PoolStats{InUse: 3, Idle: 7, MaxOpen: 10},
+		free:        50,
+		total:       100,
+	}
+}
+
+func TestReadyWithHeadroom(t *testing.T) {
+	code, body := getReady(t, setupReady(healthyStorage()))
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body["status"])
+}
+
+func TestReadySaturatedPool(t *testing.T) {
+	store := healthyStorage()
+	store.pool = storage.PoolStats{InUse: 10, Idle: 0, MaxOpen: 10}
+
+	code, body := getReady(t, setupReady(store))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "degraded", body["status"])
+	assert.Contains(t, body["problems"], "connection pool saturated: 10/10 in use")
+}
+
+func TestReadyPoolThresholdIsConfigurable(t *testing.T) {
+	store := healthyStorage()
+	store.pool = storage.PoolStats{InUse: 8, Idle: 2, MaxOpen: 10}
+
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = store
+	router.GET("/health/ready", handler.Health.HandleReady)
+
+	code, _ := getReady(t, router)
+	assert.Equal(t, http.StatusOK, code)
+
+	handler.Config.HealthPoolSaturationPercent = 80
+	code, _ = getReady(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestReadyUnboundedPoolNeverSaturated(t *testing.T) {
+	store := healthyStorage()
+	store.pool = storage.PoolStats{InUse: 500, MaxOpen: 0}
+
+	code, _ := getReady(t, setupReady(store))
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadyLowDisk(t *testing.T) {
+	store := healthyStorage()
+	store.free = 5
+
+	code, body := getReady(t, setupReady(store))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body["problems"], "disk space low: 5% free")
+}
+
+func TestReadyStorageUnreachable(t *testing.T) {
+	store := healthyStorage()
+	store.pingError = errors.New("connection refused")
+
+	code, body := getReady(t, setupReady(store))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	checks := body["checks"].(map[string]interface{})
+	assert.Equal(t, "unreachable", checks["storage"])
+}
+
+func TestReadyTimesOutHungPing(t *testing.T) {
+	store := healthyStorage()
+	store.hang = make(chan struct{})
+	t.Cleanup(func() { close(store.hang) })
+
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = store
+	handler.Config.HealthCheckTimeout = 50 * time.Millisecond
+	router.GET("/health/ready", handler.Health.HandleReady)
+
+	start := time.Now()
+	code, body := getReady(t, router)
+	elapsed := time.Since(start)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Less(t, elapsed, time.Second, "hung ping should not stall the probe")
+	assert.Contains(t, body["problems"], "storage ping failed: timed out after 50ms")
+}
+
+func setupHealth(store storage.Storage) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = store
+	router.GET("/health", handler.Health.HandleHealth)
+	router.GET("/health/live", handler.Health.HandleLive)
+	return router
+}
+
+func getHealth(t *testing.T, router *gin.Engine, path string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func TestHealthChecksStorage(t *testing.T) {
+	code, body := getHealth(t, setupHealth(healthyStorage()), "/health")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", body["status"])
+
+	store := healthyStorage()
+	store.pingError = errors.New("connection refused")
+	code, body = getHealth(t, setupHealth(store), "/health")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy", body["status"])
+	assert.Equal(t, "storage", body["component"])
+	assert.Equal(t, "storage ping failed: connection refused", body["error"])
+}
+
+func TestHealthLiveIgnoresStorage(t *testing.T) {
+	store := healthyStorage()
+	store.pingError = errors.New("connection refused")
+
+	code, body := getHealth(t, setupHealth(store), "/health/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alive", body["status"])
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ambiguousUpload has no telling extension and sniffs as octet-stream
+var ambiguousUpload = []byte{0x00, 0x9f, 0x92, 0x96, 0xff, 0x01, 0x02}
+
+func setupImport(policy string) (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.ImportUnknownTypes = policy
+	router.POST("/import", handler.WebApp.HandleImportPost)
+	return router, handler
+}
+
+func postImport(t *testing.T, router *gin.Engine, fname string, content []byte, adjust ...func(*http.Request)) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("upload", fname)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	for _, fn := range adjust {
+		fn(req)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImportRejectsUnknownTypes(t *testing.T) {
+	router, handler := setupImport(handlers.ImportUnknownReject)
+
+	w := postImport(t, router, "mystery.bin", ambiguousUpload)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "importerror.html: Unsupported file type [rejected]", w.Body.String())
+	exists, _ := handler.Storage.ExistsItem("home/alice@example.com/mystery")
+	assert.False(t, exists, "a rejected import must not be stored")
+}
+
+func TestImportStoresUnknownTypesAsBinary(t *testing.T) {
+	router, handler := setupImport(handlers.ImportUnknownBinary)
+
+	w := postImport(t, router, "mystery.bin", ambiguousUpload)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "importcollabload.html [binary]", w.Body.String())
+
+	raw, err := handler.Storage.GetItem("home/alice@example.com/mystery")
+	require.NoError(t, err)
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(raw), &stored))
+	assert.Equal(t, "base64", stored["encoding"])
+	data, err := base64.StdEncoding.DecodeString(stored["data"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, ambiguousUpload, data, "binary imports are stored byte for byte")
+}
+
+func TestImportRefusesOversizedUpload(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/import", middleware.MaxBodySize(64), handler.WebApp.HandleImportPost)
+
+	w := postImport(t, router, "budget.msc", bytes.Repeat([]byte("x"), 100))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Without a Content-Length the limit trips while the form is parsed
+	w = postImport(t, router, "budget.msc", bytes.Repeat([]byte("x"), 100), func(req *http.Request) { req.ContentLength = -1 })
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "importerror.html: File too large, limit is 64 bytes", w.Body.String())
+}
+
+func TestImportKnownTypesIgnorePolicy(t *testing.T) {
+	router, _ := setupImport(handlers.ImportUnknownReject)
+
+	w := postImport(t, router, "budget.msc", []byte("version:1.5\ncell:A1:v:1\n"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "importcollabload.html [sheet]", w.Body.String())
+
+	// No telling extension, but the content is plainly text
+	w = postImport(t, router, "notes", []byte("a,b\n1,2\n"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "importcollabload.html [text]", w.Body.String())
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupLoginAlerts(t *testing.T) (*gin.Engine, *auth.Service) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Storage = storage.NewMemoryStorage()
+	service := auth.NewService(handler.Storage)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	router.POST("/profile/login-alerts", handler.Auth.HandleLoginAlerts)
+	require.NoError(t, service.CreateUser("alice@example.com", "password123"))
+	return router, service
+}
+
+func setLoginAlerts(router *gin.Engine, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/profile/login-alerts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginAlertsCanBeTurnedOffAndOn(t *testing.T) {
+	router, service := setupLoginAlerts(t)
+
+	w := setLoginAlerts(router, "alice@example.com", `{"enabled": false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"result":"ok","enabled":false}`, w.Body.String())
+	user, err := service.GetUser("alice@example.com")
+	require.NoError(t, err)
+	assert.True(t, user.LoginAlertsOff)
+
+	w = setLoginAlerts(router, "alice@example.com", `{"enabled": true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	user, err = service.GetUser("alice@example.com")
+	require.NoError(t, err)
+	assert.False(t, user.LoginAlertsOff)
+}
+
+func TestLoginAlertsNeedsSessionAndChoice(t *testing.T) {
+	router, _ := setupLoginAlerts(t)
+
+	assert.Equal(t, http.StatusUnauthorized, setLoginAlerts(router, "", `{"enabled": false}`).Code)
+	assert.Equal(t, http.StatusBadRequest, setLoginAlerts(router, "alice@example.com", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, setLoginAlerts(router, "alice@example.com", `{"enabled": "no"}`).Code)
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLoginRedirectRoutes(target string) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.LoginRedirectURL = target
+
+	router.GET("/login", handler.Auth.HandleLoginGet)
+	router.GET("/register", handler.Auth.HandleRegisterGet)
+	return router
+}
+
+func getAs(router *gin.Engine, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticatedLoginRedirects(t *testing.T) {
+	router := setupLoginRedirectRoutes("/browser")
+
+	for _, path := range []string{"/login", "/register"} {
+		w := getAs(router, path, "alice@example.com")
+		assert.Equal(t, http.StatusFound, w.Code, path)
+		assert.Equal(t, "/browser", w.Header().Get("Location"), path)
+	}
+}
+
+func TestAnonymousLoginShowsForm(t *testing.T) {
+	router := setupLoginRedirectRoutes("/browser")
+
+	w := getAs(router, "/login", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "login.html")
+
+	w = getAs(router, "/register", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "register.html")
+}
+
+func TestLoginRedirectDisabled(t *testing.T) {
+	router := setupLoginRedirectRoutes("")
+
+	w := getAs(router, "/login", "alice@example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "login.html")
+}
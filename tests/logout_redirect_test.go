@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLogout(allowlist ...string) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.LogoutRedirectAllowlist = allowlist
+	router.GET("/logout", handler.Auth.HandleLogout)
+	router.POST("/logout", handler.Auth.HandleLogout)
+	return router
+}
+
+func logoutTo(router *gin.Engine, next string) string {
+	path := "/logout"
+	if next != "" {
+		path += "?next=" + url.QueryEscape(next)
+	}
+	w := serve(router, http.MethodGet, path, "")
+	if w.Code != http.StatusFound {
+		return ""
+	}
+	return w.Header().Get("Location")
+}
+
+func TestLogoutRedirectsToLocalTarget(t *testing.T) {
+	router := setupLogout()
+
+	assert.Equal(t, "/browser?tab=recent", logoutTo(router, "/browser?tab=recent"))
+
+	w := serve(router, http.MethodPost, "/logout", "next=%2Fsave")
+	assert.Equal(t, "/save", w.Header().Get("Location"))
+}
+
+func TestLogoutRejectsExternalTarget(t *testing.T) {
+	router := setupLogout("https://docs.example.com/goodbye")
+
+	for _, next := range []string{
+		"https://evil.example.net/",
+		"//evil.example.net/",
+		`/\evil.example.net`,
+		"/\t/evil.example.net",
+		"https://docs.example.com.evil.net/goodbye",
+		"https://docs.example.com/goodbyes",
+		"https://user@docs.example.com/goodbye",
+		"javascript:alert(1)",
+	} {
+		assert.Equal(t, "/login", logoutTo(router, next), "next=%s", next)
+	}
+
+	assert.Equal(t, "https://docs.example.com/goodbye/page", logoutTo(router, "https://docs.example.com/goodbye/page"))
+}
+
+func TestLogoutDefaultsToLogin(t *testing.T) {
+	router := setupLogout()
+
+	assert.Equal(t, "/login", logoutTo(router, ""))
+}
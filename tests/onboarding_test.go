@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOnboarding(t *testing.T, starterSheet bool) (*gin.Engine, func(path string) bool) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.StarterSheet = starterSheet
+	router.GET("/save", handler.WebApp.HandleSaveGet)
+
+	require.NoError(t, handler.Storage.PutItem("home/veteran@example.com",
+		`{"path":["home","veteran@example.com"],"type":"dir","data":["securestore","budget"]}`))
+	require.NoError(t, handler.Storage.PutItem("home/emptied@example.com",
+		`{"path":["home","emptied@example.com"],"type":"dir","data":["securestore",".trash"]}`))
+	exists := func(path string) bool {
+		ok, _ := handler.Storage.ExistsItem(path)
+		return ok
+	}
+	return router, exists
+}
+
+func TestNewUserGetsOnboarding(t *testing.T) {
+	router, exists := setupOnboarding(t, true)
+
+	w := getAs(router, "/save", "newbie@example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "allusersheets.html (onboarding)", w.Body.String())
+	assert.True(t, exists("home/newbie@example.com/default"), "starter sheet should be created")
+}
+
+func TestOnboardingWithoutStarterSheet(t *testing.T) {
+	router, exists := setupOnboarding(t, false)
+
+	w := getAs(router, "/save", "newbie@example.com")
+	assert.Equal(t, "allusersheets.html (onboarding)", w.Body.String())
+	assert.False(t, exists("home/newbie@example.com/default"))
+}
+
+func TestUserWithNoSheetsLeftGetsOnboarding(t *testing.T) {
+	router, _ := setupOnboarding(t, true)
+
+	w := getAs(router, "/save", "emptied@example.com")
+	assert.Equal(t, "allusersheets.html (onboarding)", w.Body.String())
+}
+
+func TestUserWithSheetsSkipsOnboarding(t *testing.T) {
+	router, _ := setupOnboarding(t, true)
+
+	w := getAs(router, "/save", "veteran@example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "allusersheets.html", w.Body.String())
+}
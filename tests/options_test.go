@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsListsRouteMethods(t *testing.T) {
+	router := setupMethodRoutes()
+
+	w := serve(router, http.MethodOptions, "/save", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestOptionsMatchesParameterisedRoutes(t *testing.T) {
+	router := setupMethodRoutes()
+	router.PATCH("/save/:id", func(c *gin.Context) {})
+
+	w := serve(router, http.MethodOptions, "/save/budget", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "PATCH, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestOptionsPreflightGetsRouteMethods(t *testing.T) {
+	router := setupMethodRoutes()
+
+	req := httptest.NewRequest(http.MethodOptions, "/lostpw", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestOptionsUnknownPathIsNotFound(t *testing.T) {
+	router := setupMethodRoutes()
+
+	w := serve(router, http.MethodOptions, "/nowhere", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Allow"))
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPasswordReset serves the reset routes for alice and returns a
+// service sharing their storage, to issue tokens with
+func setupPasswordReset(t *testing.T) (*gin.Engine, *handlers.Handler, *auth.Service) {
+	router, handler := testutils.SetupTestServer(t)
+	router.GET("/pwreset", handler.Auth.HandlePasswordResetGet)
+	router.POST("/pwreset", handler.Auth.HandlePasswordResetPost)
+
+	user, err := models.NewUser("alice@example.com", "oldpassword")
+	require.NoError(t, err)
+	userJSON, err := user.ToJSON()
+	require.NoError(t, err)
+	item, err := json.Marshal(map[string]string{"type": "file", "data": userJSON})
+	require.NoError(t, err)
+	require.NoError(t, handler.Storage.PutItem("home/users/alice@example.com", string(item)))
+
+	return router, handler, auth.NewService(handler.Storage)
+}
+
+func resetForm(token, password string) string {
+	return url.Values{"token": {token}, "email": {"mallory@example.com"}, "password": {password}}.Encode()
+}
+
+// storedUser reads alice back; the mock keeps updated records as written
+func storedUser(t *testing.T, handler *handlers.Handler) *models.User {
+	raw, err := handler.Storage.GetItem("home/users/alice@example.com")
+	require.NoError(t, err)
+	item, err := models.StorageItemFromJSON(raw)
+	if err == nil {
+		if data, ok := item.Data.(string); ok {
+			raw = data
+		}
+	}
+	user, err := models.UserFromJSON(raw)
+	require.NoError(t, err)
+	return user
+}
+
+func TestPasswordResetWithToken(t *testing.T) {
+	router, handler, service := setupPasswordReset(t)
+	token, err := service.GeneratePasswordResetToken("alice@example.com")
+	require.NoError(t, err)
+
+	w := serve(router, http.MethodGet, "/pwreset?t="+url.QueryEscape(token), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pwreset.html", w.Body.String())
+
+	// The token's owner is reset, whatever address is submitted with it
+	w = serve(router, http.MethodPost, "/pwreset", resetForm(token, "newpassword"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pwreset-ok.html", w.Body.String())
+	assert.True(t, storedUser(t, handler).Authenticate("newpassword"))
+
+	// The token is single use
+	w = serve(router, http.MethodPost, "/pwreset", resetForm(token, "thirdpassword"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "pwreset-invalid.html", w.Body.String())
+	assert.True(t, storedUser(t, handler).Authenticate("newpassword"))
+}
+
+func TestPasswordResetRequiresToken(t *testing.T) {
+	router, handler, _ := setupPasswordReset(t)
+
+	for _, token := range []string{"", "guessed"} {
+		w := serve(router, http.MethodPost, "/pwreset", resetForm(token, "newpassword"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "token %q", token)
+	}
+	w := serve(router, http.MethodGet, "/pwreset?t=guessed", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, storedUser(t, handler).Authenticate("oldpassword"))
+}
+
+func TestPasswordResetExpiredToken(t *testing.T) {
+	router, handler, service := setupPasswordReset(t)
+	service.SetResetTokenTTL(time.Nanosecond)
+	token, err := service.GeneratePasswordResetToken("alice@example.com")
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	w := serve(router, http.MethodGet, "/pwreset?t="+url.QueryEscape(token), "")
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	w = serve(router, http.MethodPost, "/pwreset", resetForm(token, "newpassword"))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "pwreset-invalid.html: This reset link has expired, please request a new one", w.Body.String())
+	assert.True(t, storedUser(t, handler).Authenticate("oldpassword"))
+}
+
+func TestLostPasswordNeedsCanonicalHostInProduction(t *testing.T) {
+	router, handler, _ := setupPasswordReset(t)
+	router.POST("/lostpw", handler.Auth.HandleLostPasswordPost)
+	handler.Config.Environment = "production"
+
+	// The request's Host can't be trusted to build the emailed link
+	w := serve(router, http.MethodPost, "/lostpw", url.Values{"email": {"alice@example.com"}}.Encode())
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	handler.Config.CanonicalHost = "calc.example.com"
+	w = serve(router, http.MethodPost, "/lostpw", url.Values{"email": {"alice@example.com"}}.Encode())
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubPDFEngine returns fixed output instead of running a renderer
+type stubPDFEngine struct {
+	out []byte
+	err error
+}
+
+func (s stubPDFEngine) Render(ctx context.Context, html string) ([]byte, error) {
+	return s.out, s.err
+}
+
+func setupPDFReady(engine stubPDFEngine, required bool) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = healthyStorage()
+	handler.Config.PDFSelfTestRequired = required
+	handler.PDF = engine
+	router.GET("/health/ready", handler.Health.HandleReady)
+
+	// The outcome is asserted through readiness
+	_ = handler.CheckPDFEngine(context.Background())
+	return router
+}
+
+func TestReadyAfterPDFSelfTestPasses(t *testing.T) {
+	router := setupPDFReady(stubPDFEngine{out: []byte("%PDF-1.4\n...")}, true)
+
+	code, body := getReady(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["checks"].(map[string]interface{})["pdf"])
+}
+
+func TestReadyFailsWhenRequiredPDFSelfTestFails(t *testing.T) {
+	router := setupPDFReady(stubPDFEngine{err: errors.New("wkhtmltopdf: executable file not found")}, true)
+
+	code, body := getReady(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "failed", body["checks"].(map[string]interface{})["pdf"])
+	assert.Contains(t, body["problems"], "pdf engine self-test failed: wkhtmltopdf: executable file not found")
+}
+
+func TestReadyIgnoresOptionalPDFSelfTestFailure(t *testing.T) {
+	router := setupPDFReady(stubPDFEngine{out: []byte("<html>not a pdf</html>")}, false)
+
+	code, body := getReady(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "failed", body["checks"].(map[string]interface{})["pdf"])
+}
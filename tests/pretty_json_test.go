@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPrettyJSON(byDefault bool) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	api := router.Group("/", middleware.PrettyJSON(byDefault))
+	api.POST("/save/validate", handler.WebApp.HandleSaveValidate)
+	return router
+}
+
+func validateSheet(router *gin.Engine, path string) string {
+	return postSheet(router, path, url.Values{"fname": {"budget"}, "data": {"A1:1"}}).Body.String()
+}
+
+func TestJSONIsCompactByDefault(t *testing.T) {
+	router := setupPrettyJSON(false)
+
+	body := validateSheet(router, "/save/validate")
+	assert.JSONEq(t, `{"result":"ok","data":"valid"}`, body)
+	assert.NotContains(t, body, "\n")
+}
+
+func TestPrettyQueryIndentsJSON(t *testing.T) {
+	router := setupPrettyJSON(false)
+
+	body := validateSheet(router, "/save/validate?pretty=1")
+	assert.JSONEq(t, `{"result":"ok","data":"valid"}`, body)
+	assert.True(t, strings.HasPrefix(body, "{\n    \""), "want indented JSON, got %q", body)
+}
+
+func TestPrettyByDefaultCanBeTurnedOff(t *testing.T) {
+	router := setupPrettyJSON(true)
+
+	assert.Contains(t, validateSheet(router, "/save/validate"), "\n")
+	assert.NotContains(t, validateSheet(router, "/save/validate?pretty=0"), "\n")
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminRateLimitStatsListThrottledClients(t *testing.T) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Limiter = middleware.NewRateLimiter(1, 2)
+
+	router.GET("/ping", handler.Limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin/ratelimit", handler.Admin.HandleRateLimitStats)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ratelimit", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Enabled bool                     `json:"enabled"`
+		Clients []middleware.ClientStats `json:"clients"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Enabled)
+	require.Len(t, body.Clients, 1)
+	assert.Equal(t, "203.0.113.7", body.Clients[0].Key)
+	assert.Equal(t, uint64(2), body.Clients[0].Hits)
+	assert.Equal(t, uint64(1), body.Clients[0].Throttled)
+}
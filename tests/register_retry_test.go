@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRegisterRetry serves registration with idempotent creates on
+func setupRegisterRetry(t *testing.T) (*gin.Engine, *auth.Service, storage.Storage) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Storage = storage.NewMemoryStorage()
+	service := auth.NewService(handler.Storage)
+	service.SetIdempotentCreate(true)
+	handler.Auth = handlers.NewAuthHandler(handler, service)
+	router.POST("/register", handler.Auth.HandleRegister)
+	return router, service, handler.Storage
+}
+
+func register(router *gin.Engine, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) bool {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "user" && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterRetrySucceedsWithSamePassword(t *testing.T) {
+	router, _, _ := setupRegisterRetry(t)
+
+	require.Equal(t, http.StatusOK, register(router, "retry@example.com", "password123").Code)
+	w := register(router, "retry@example.com", "password123")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = register(router, "retry@example.com", "otherpassword")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.False(t, sessionCookie(w))
+}
+
+func TestRegisterRetryStillNeedsSecondFactor(t *testing.T) {
+	router, service, store := setupRegisterRetry(t)
+	require.NoError(t, service.CreateUser("mfa@example.com", "password123"))
+	user, err := service.GetUser("mfa@example.com")
+	require.NoError(t, err)
+	user.TOTPEnabled = true
+	userJSON, err := user.ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFile(context.Background(), []string{"home", auth.UserDir, "mfa@example.com"}, userJSON))
+
+	w := register(router, "mfa@example.com", "password123")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"mfarequired"`)
+	assert.False(t, sessionCookie(w), "the password alone must not sign in to a TOTP account")
+}
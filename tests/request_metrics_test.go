@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/metrics"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMetricsRoutes() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Metrics())
+	router.GET("/browser/:param1/dropbox", func(c *gin.Context) {
+		c.String(http.StatusOK, "synced")
+	})
+	router.GET("/metrics", gin.WrapH(metrics.Default))
+	return router
+}
+
+// scrapeSample returns the value of the sample matching series in the
+// /metrics exposition, or 0 when it isn't there yet
+func scrapeSample(t *testing.T, router *gin.Engine, series string) float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	match := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(series) + ` (\S+)$`).FindStringSubmatch(w.Body.String())
+	if match == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	require.NoError(t, err)
+	return value
+}
+
+func TestMetricsCountRequestsByRouteTemplate(t *testing.T) {
+	router := setupMetricsRoutes()
+	ok := `touchcalc_http_requests_total{method="GET",route="/browser/:param1/dropbox",status="200"}`
+	missing := `touchcalc_http_requests_total{method="GET",route="unmatched",status="404"}`
+	latency := `touchcalc_http_request_duration_seconds_count{method="GET",route="/browser/:param1/dropbox",status="200"}`
+	okBefore, missingBefore, latencyBefore := scrapeSample(t, router, ok), scrapeSample(t, router, missing), scrapeSample(t, router, latency)
+
+	for _, path := range []string{"/browser/alice/dropbox", "/browser/bob/dropbox", "/browser/carol/dropbox"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/no/such/page", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Equal(t, 3.0, scrapeSample(t, router, ok)-okBefore)
+	assert.Equal(t, 1.0, scrapeSample(t, router, missing)-missingBefore)
+	assert.Equal(t, 3.0, scrapeSample(t, router, latency)-latencyBefore)
+	// Raw paths never become labels
+	assert.Zero(t, scrapeSample(t, router, `touchcalc_http_requests_total{method="GET",route="/browser/alice/dropbox",status="200"}`))
+	// Only the scrape itself is in flight
+	assert.Equal(t, 1.0, scrapeSample(t, router, "touchcalc_http_requests_in_flight"))
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type samplesBody struct {
+	Enabled bool                       `json:"enabled"`
+	Samples []middleware.RequestSample `json:"samples"`
+}
+
+func TestAdminRequestSamples(t *testing.T) {
+	router, handler := testutils.SetupTestServer(t)
+	handler.Sampler = middleware.NewSampler(1, 10, nil)
+
+	router.GET("/pwreset-check", handler.Sampler.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin/samples", handler.Admin.HandleRequestSamples)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pwreset-check?t=secret-token", nil))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/samples", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret-token")
+
+	var body samplesBody
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Enabled)
+	require.Len(t, body.Samples, 1)
+	assert.Equal(t, "/pwreset-check", body.Samples[0].Route)
+	assert.Equal(t, middleware.Redacted, body.Samples[0].Params["t"])
+}
+
+func TestAdminRequestSamplesDisabled(t *testing.T) {
+	router, handler := testutils.SetupTestServer(t)
+	router.GET("/admin/samples", handler.Admin.HandleRequestSamples)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/samples", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body samplesBody
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.False(t, body.Enabled)
+	assert.Empty(t, body.Samples)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupProtectedRoutes guards sheet routes with RequireAuth as setupRoutes
+// does, with sessions identified by signed tokens, and returns the store
+// holding alice's account
+func setupProtectedRoutes(t *testing.T) (*gin.Engine, storage.Storage) {
+	auth.SetTokenSecret("test-jwt-secret", time.Hour)
+	middleware.UseSessionTokens(auth.ParseToken)
+	t.Cleanup(func() {
+		auth.SetTokenSecret("", 0)
+		middleware.UseSessionTokens(nil)
+	})
+
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+	require.NoError(t, auth.NewService(handler.Storage).CreateUser("alice@example.com", "password123"))
+	signedIn := middleware.RequireAuth(handler.Auth.ValidSession)
+	router.POST("/save/validate", signedIn, handler.WebApp.HandleSaveValidate)
+	router.GET("/import", signedIn, handler.WebApp.HandleImportGet)
+	router.GET("/api/sheets", signedIn, handler.WebApp.HandleSheetsList)
+	return router, handler.Storage
+}
+
+func validateWithToken(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	form := url.Values{"fname": {"budget"}, "data": {"A1:1"}}
+	req := httptest.NewRequest(http.MethodPost, "/save/validate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: middleware.SessionTokenCookie, Value: token})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestProtectedRouteWithSession(t *testing.T) {
+	router, _ := setupProtectedRoutes(t)
+	token, err := auth.IssueToken("alice@example.com", 0)
+	require.NoError(t, err)
+
+	w := validateWithToken(router, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"ok","data":"valid"}`, w.Body.String())
+}
+
+func TestProtectedRouteWithoutSession(t *testing.T) {
+	router, _ := setupProtectedRoutes(t)
+
+	w := validateWithToken(router, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"result":"fail","data":"usererror"}`, w.Body.String())
+
+	// A token that doesn't verify is no session at all
+	w = validateWithToken(router, "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Pages send the browser to log in instead
+	w = serve(router, http.MethodGet, "/import", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+}
+
+func TestProtectedRouteWithRevokedSession(t *testing.T) {
+	router, store := setupProtectedRoutes(t)
+	token, err := auth.IssueToken("alice@example.com", 0)
+	require.NoError(t, err)
+
+	// A password change elsewhere logs out sessions issued before it
+	service := auth.NewService(store)
+	service.SetRevokeSessionsOnPasswordChange(true)
+	require.NoError(t, service.UpdatePassword("alice@example.com", "newpassword456"))
+
+	w := validateWithToken(router, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"result":"fail","data":"usererror"}`, w.Body.String())
+}
+
+func TestProtectedRouteTrustsOnlyTheSignedVersion(t *testing.T) {
+	router, store := setupProtectedRoutes(t)
+	service := auth.NewService(store)
+	service.SetRevokeSessionsOnPasswordChange(true)
+	stale, err := auth.IssueToken("alice@example.com", 0)
+	require.NoError(t, err)
+	require.NoError(t, service.UpdatePassword("alice@example.com", "newpassword456"))
+
+	// The version cookie is unsigned, so claiming the current version in it
+	// doesn't revive a revoked token
+	form := url.Values{"fname": {"budget"}, "data": {"A1:1"}}
+	req := httptest.NewRequest(http.MethodPost, "/save/validate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: middleware.SessionTokenCookie, Value: stale})
+	req.AddCookie(&http.Cookie{Name: middleware.SessionVersionCookie, Value: "1"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	current, err := auth.IssueToken("alice@example.com", 1)
+	require.NoError(t, err)
+	w = validateWithToken(router, current)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAPIRefusesRevokedSession(t *testing.T) {
+	router, store := setupProtectedRoutes(t)
+	token, err := auth.IssueToken("alice@example.com", 0)
+	require.NoError(t, err)
+	sheets := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/sheets", nil)
+		req.Header.Set("Accept", "application/json")
+		req.AddCookie(&http.Cookie{Name: middleware.SessionTokenCookie, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, sheets(token))
+
+	service := auth.NewService(store)
+	service.SetRevokeSessionsOnPasswordChange(true)
+	require.NoError(t, service.UpdatePassword("alice@example.com", "newpassword456"))
+	assert.Equal(t, http.StatusUnauthorized, sheets(token))
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMethodRoutes() *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	router.HandleMethodNotAllowed = true
+
+	api := router.Group("/")
+	{
+		api.GET("/save", handler.WebApp.HandleSaveGet)
+		api.POST("/save", handler.WebApp.HandleSavePost)
+		api.GET("/lostpw", handler.Auth.HandleLostPasswordGet)
+		api.POST("/lostpw", handler.Auth.HandleLostPasswordPost)
+	}
+	return router
+}
+
+func serve(router *gin.Engine, method, path, form string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form))
+	if form != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSaveGetAndPostUseSeparateHandlers(t *testing.T) {
+	router := setupMethodRoutes()
+
+	// Anonymous GET renders nothing and redirects to the login page
+	w := serve(router, http.MethodGet, "/save", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+
+	// Anonymous POST is an API call and gets a JSON failure instead
+	w = serve(router, http.MethodPost, "/save", "fname=sheet1&data=x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"usererror"`)
+}
+
+func TestLostPasswordGetAndPostUseSeparateHandlers(t *testing.T) {
+	router := setupMethodRoutes()
+
+	w := serve(router, http.MethodGet, "/lostpw", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "lostpassword.html", w.Body.String())
+
+	w = serve(router, http.MethodPost, "/lostpw", "email=nobody@example.com")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "lostpassword-baduser.html", w.Body.String())
+}
+
+func TestUnsupportedMethodsReturn405(t *testing.T) {
+	router := setupMethodRoutes()
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		for _, path := range []string{"/save", "/lostpw"} {
+			w := serve(router, method, path, "")
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "%s %s", method, path)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interleavingStorage runs another writer's save right after the sheet is
+// first read, as if it landed from another instance mid-request
+type interleavingStorage struct {
+	storage.Storage
+	other func()
+}
+
+func (s *interleavingStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
+	item, err := s.Storage.GetFile(ctx, path)
+	if other := s.other; other != nil && path[len(path)-1] == "budget" {
+		s.other = nil
+		other()
+	}
+	return item, err
+}
+
+func setupSaveConflict(t *testing.T) (*gin.Engine, *handlers.Handler, *interleavingStorage, string) {
+	router, handler := testutils.SetupTestServer(nil)
+	store := &interleavingStorage{Storage: handler.Storage}
+	handler.Storage = store
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"version:1.5\ncell:A1:v:1\n"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return router, handler, store, saveResponse(t, w)["hash"]
+}
+
+func saveResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestSaveStaleTabConflicts(t *testing.T) {
+	router, handler, _, loaded := setupSaveConflict(t)
+
+	// Two tabs loaded the same sheet; the first saves
+	first := "version:1.5\ncell:A1:v:first\n"
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {first}, "hash": {loaded}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	saved := saveResponse(t, w)["hash"]
+
+	// The second still holds the old hash and must not clobber it
+	w = postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"version:1.5\ncell:A1:v:second\n"}, "hash": {loaded}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "versionconflict", saveResponse(t, w)["data"])
+	assert.Equal(t, saved, saveResponse(t, w)["hash"])
+	assert.Equal(t, first, storedSheet(t, handler))
+
+	// Once caught up, with the hash as an If-Match header, it saves
+	req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(url.Values{"fname": {"budget"}, "data": {"version:1.5\ncell:A1:v:merged\n"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("If-Match", `"`+saved+`"`)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "version:1.5\ncell:A1:v:merged\n", storedSheet(t, handler))
+}
+
+func TestSaveLosesRaceToConcurrentWriter(t *testing.T) {
+	router, handler, store, loaded := setupSaveConflict(t)
+
+	// Another save lands after this request checked the hash but before
+	// it writes
+	other := "version:1.5\ncell:A1:v:other\n"
+	store.other = func() {
+		raw, _ := json.Marshal(map[string]interface{}{"user": "alice@example.com", "fname": "budget", "data": other})
+		require.NoError(t, store.Storage.UpdateFile(context.Background(), []string{"home", "alice@example.com", "budget"}, string(raw)))
+	}
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"version:1.5\ncell:A1:v:stale\n"}, "hash": {loaded}})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Equal(t, other, storedSheet(t, handler))
+}
+
+func TestSaveWithoutHashOverwrites(t *testing.T) {
+	router, handler, _, _ := setupSaveConflict(t)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"version:1.5\ncell:A1:v:blind\n"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "version:1.5\ncell:A1:v:blind\n", storedSheet(t, handler))
+}
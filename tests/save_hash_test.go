@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveReturnsHashOfStoredContent(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	sheet := "socialcalc:version:1.0\ncell:A1:t:Hello"
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {sheet}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Result  string `json:"result"`
+		Hash    string `json:"hash"`
+		Version string `json:"version"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "ok", resp.Result)
+	assert.NotEmpty(t, resp.Version)
+	assert.Equal(t, `"`+resp.Hash+`"`, w.Header().Get("ETag"))
+
+	// Recompute over what actually landed in storage
+	raw, err := handler.Storage.GetItem("home/alice@example.com/budget")
+	require.NoError(t, err)
+	var stored struct {
+		Data string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(raw), &stored))
+	sum := sha256.Sum256([]byte(stored.Data))
+	assert.Equal(t, hex.EncodeToString(sum[:]), resp.Hash)
+}
+
+func TestSaveVersionChangesOnEachSave(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	var versions []string
+	for _, sheet := range []string{"v1", "v2"} {
+		w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {sheet}})
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		versions = append(versions, resp["version"])
+	}
+	assert.NotEqual(t, versions[0], versions[1])
+}
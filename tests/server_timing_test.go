@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupServerTiming(enabled bool) *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+	if enabled {
+		router.Use(middleware.ServerTiming(func(c *gin.Context) bool { return true }))
+	}
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	return router
+}
+
+func TestServerTimingReportsHandlerAndStorage(t *testing.T) {
+	router := setupServerTiming(true)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"A1:1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	header := w.Header().Get("Server-Timing")
+	assert.Regexp(t, regexp.MustCompile(`^handler;dur=\d+\.\d{3}`), header)
+	assert.Regexp(t, regexp.MustCompile(`storage;dur=\d+\.\d{3};desc="\d+ ops"`), header)
+}
+
+func TestServerTimingAbsentWhenDisabled(t *testing.T) {
+	router := setupServerTiming(false)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"A1:1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Server-Timing"))
+}
+
+func TestServerTimingRespectsAllow(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.Use(middleware.ServerTiming(func(c *gin.Context) bool { return false }))
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"A1:1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Server-Timing"))
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessionGraceRoutes() *gin.Engine {
+	router, handler := testutils.SetupTestServer(nil)
+
+	router.GET("/login", handler.Auth.HandleLoginGet)
+	router.GET("/reauth", handler.Auth.HandleReauthGet)
+	profile := router.Group("/profile",
+		middleware.SessionGrace(5*time.Minute, "/reauth"),
+		middleware.AuthRequired(func(c *gin.Context, user string, version int) bool { return true }))
+	profile.GET("/sheets", func(c *gin.Context) { c.String(http.StatusOK, "sheets") })
+	profile.POST("/mfa/enroll", func(c *gin.Context) { c.String(http.StatusOK, "enrolled") })
+	return router
+}
+
+func sessionRequest(router *gin.Engine, method, path string, expires time.Time) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	req.AddCookie(&http.Cookie{Name: middleware.SessionExpiresCookie, Value: strconv.FormatInt(expires.Unix(), 10)})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLiveSessionPassesGrace(t *testing.T) {
+	router := setupSessionGraceRoutes()
+
+	w := sessionRequest(router, http.MethodGet, "/profile/sheets", time.Now().Add(time.Hour))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sheets", w.Body.String())
+}
+
+func TestExpiredSessionWithinGraceRedirectsToReauth(t *testing.T) {
+	router := setupSessionGraceRoutes()
+
+	w := sessionRequest(router, http.MethodGet, "/profile/sheets?tab=2", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/reauth?next=%2Fprofile%2Fsheets%3Ftab%3D2", w.Header().Get("Location"))
+
+	// Non-GET requests can't follow a redirect, so they get the prompt URL
+	w = sessionRequest(router, http.MethodPost, "/profile/mfa/enroll", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"reauth":"/reauth?next=%2Fprofile%2Fmfa%2Fenroll"`)
+}
+
+func TestExpiredSessionPastGraceIsCleared(t *testing.T) {
+	router := setupSessionGraceRoutes()
+
+	w := sessionRequest(router, http.MethodGet, "/profile/sheets", time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session expired")
+	assert.Contains(t, w.Header().Values("Set-Cookie"), "user=; Path=/; Max-Age=0; HttpOnly")
+}
+
+func TestReauthPromptKeepsNext(t *testing.T) {
+	router := setupSessionGraceRoutes()
+
+	w := getAs(router, "/reauth?next=%2Fprofile%2Fsheets", "alice@example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "login.html")
+
+	// Without a session there is nothing to re-authenticate; fall back to
+	// the normal login form, still carrying next
+	w = getAs(router, "/reauth?next=%2Fprofile%2Fsheets", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login?next=%2Fprofile%2Fsheets", w.Header().Get("Location"))
+
+	// Off-site destinations are dropped
+	w = getAs(router, "/reauth?next=%2F%2Fevil.example", "")
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+}
+
+func TestLoginRedirectStaysLocal(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+	router.POST("/login", handler.Auth.HandleLogin)
+	service := auth.NewService(handler.Storage)
+	require.NoError(t, service.CreateUser("alice@example.com", "password123"))
+	require.NoError(t, service.ConfirmUser("alice@example.com"))
+
+	loginTo := func(next string) string {
+		form := url.Values{"email": {"alice@example.com"}, "password": {"password123"}, "next": {next}}
+		w := serve(router, http.MethodPost, "/login", form.Encode())
+		require.Equal(t, http.StatusFound, w.Code, "next=%q: %s", next, w.Body.String())
+		return w.Header().Get("Location")
+	}
+
+	assert.Equal(t, "/profile/sheets?tab=2", loginTo("/profile/sheets?tab=2"))
+	// Browsers strip tabs and newlines and read a backslash as a slash,
+	// so each of these would land on another site
+	for _, next := range []string{
+		"//evil.example",
+		`/\evil.example`,
+		`\\evil.example`,
+		"/\t/evil.example",
+		"/\r/evil.example",
+		"/\n/evil.example",
+		"/\x00/evil.example",
+		"https://evil.example/",
+	} {
+		assert.Equal(t, "/browser", loginTo(next), "next=%q", next)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSessionTokens turns session tokens on, as NewHandler does when
+// JWT_SECRET is set, and registers a user to log in as
+func setupSessionTokens(t *testing.T) *gin.Engine {
+	auth.SetTokenSecret("test-jwt-secret", time.Hour)
+	middleware.UseSessionTokens(auth.ParseToken)
+	t.Cleanup(func() {
+		auth.SetTokenSecret("", 0)
+		middleware.UseSessionTokens(nil)
+	})
+
+	// The user record round-trips through the store as a real backend's
+	// would
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+	router.POST("/login", handler.Auth.HandleLogin)
+	router.GET("/api/me", handler.Auth.HandleMe)
+	service := auth.NewService(handler.Storage)
+	require.NoError(t, service.CreateUser("alice@example.com", "password123"))
+	require.NoError(t, service.ConfirmUser("alice@example.com"))
+	return router
+}
+
+func meWithCookie(router *gin.Engine, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginIssuesSessionToken(t *testing.T) {
+	router := setupSessionTokens(t)
+
+	w := serve(router, http.MethodPost, "/login", url.Values{"email": {"alice@example.com"}, "password": {"password123"}}.Encode())
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+
+	var token *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == middleware.SessionTokenCookie {
+			token = cookie
+		}
+		assert.NotEqual(t, "user", cookie.Name, "the plain user cookie must not be set")
+	}
+	require.NotNil(t, token, "login should set a session token cookie")
+	assert.True(t, token.HttpOnly)
+
+	w = meWithCookie(router, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "alice@example.com")
+}
+
+func TestForgedSessionIsRejected(t *testing.T) {
+	router := setupSessionTokens(t)
+
+	// Naming a user in a plain cookie no longer logs in as them
+	w := meWithCookie(router, &http.Cookie{Name: "user", Value: "alice@example.com"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token, err := auth.IssueToken("alice@example.com", 0)
+	require.NoError(t, err)
+	w = meWithCookie(router, &http.Cookie{Name: middleware.SessionTokenCookie, Value: token + "x"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	aclOwner  = "alice@example.com"
+	aclReader = "bob@example.com"
+	aclEditor = "carol@example.com"
+	aclOther  = "dave@example.com"
+)
+
+// setupSheetACL registers four users and gives the owner a sheet named
+// budget
+func setupSheetACL(t *testing.T) (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.PATCH("/save/:id", handler.WebApp.HandleSavePatch)
+	router.POST("/usersheet", handler.WebApp.HandleUserSheet)
+	router.POST("/downloadfile", handler.WebApp.HandleDownloadFile)
+	router.POST("/api/sheets/delete", handler.WebApp.HandleSheetsDelete)
+	router.GET("/api/sheets/:name/collaborators", handler.WebApp.HandleCollaboratorsList)
+	router.POST("/api/sheets/:name/collaborators", handler.WebApp.HandleCollaboratorAdd)
+	router.DELETE("/api/sheets/:name/collaborators/:email", handler.WebApp.HandleCollaboratorRemove)
+
+	service := auth.NewService(handler.Storage)
+	for _, email := range []string{aclOwner, aclReader, aclEditor, aclOther} {
+		require.NoError(t, service.CreateUser(email, "password123"))
+	}
+	w := sendAs(router, http.MethodPost, "/save", aclOwner, url.Values{"fname": {"budget"}, "data": {"A1:1"}}.Encode())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return router, handler
+}
+
+// sendAs makes a request as user, with body sent as a form unless it
+// looks like JSON
+func sendAs(router *gin.Engine, method, path, user, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if strings.HasPrefix(body, "{") {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func share(t *testing.T, router *gin.Engine, email, permission string) {
+	t.Helper()
+	w := sendAs(router, http.MethodPost, "/api/sheets/budget/collaborators", aclOwner,
+		`{"email":"`+email+`","permission":"`+permission+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func downloadAs(router *gin.Engine, user string) *httptest.ResponseRecorder {
+	return sendAs(router, http.MethodPost, "/downloadfile", user, url.Values{"fname": {"budget"}, "owner": {aclOwner}}.Encode())
+}
+
+func saveAs(router *gin.Engine, user, data string) *httptest.ResponseRecorder {
+	return sendAs(router, http.MethodPost, "/save", user, url.Values{"fname": {"budget"}, "owner": {aclOwner}, "data": {data}}.Encode())
+}
+
+func TestReadCollaboratorCanOnlyRead(t *testing.T) {
+	router, _ := setupSheetACL(t)
+	share(t, router, aclReader, "read")
+
+	w := downloadAs(router, aclReader)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "A1:1", w.Body.String())
+
+	w = sendAs(router, http.MethodPost, "/usersheet", aclReader, url.Values{"pagename": {"budget"}, "owner": {aclOwner}}.Encode())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "importcollabload.html", w.Body.String())
+
+	w = saveAs(router, aclReader, "A1:2")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendAs(router, http.MethodPatch, "/save/budget?owner="+aclOwner, aclReader, `{"ops":[{"op":"set","cell":"A1","value":"2"}]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, "A1:1", downloadAs(router, aclOwner).Body.String(), "the sheet must be unchanged")
+}
+
+func TestEditCollaboratorCanSave(t *testing.T) {
+	router, handler := setupSheetACL(t)
+	share(t, router, aclEditor, "edit")
+
+	w := saveAs(router, aclEditor, "A1:2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "A1:2", downloadAs(router, aclOwner).Body.String())
+
+	// The edit lands in the owner's sheet, not a copy of the editor's own
+	exists, _ := handler.Storage.ExistsItem("home/" + aclEditor + "/budget")
+	assert.False(t, exists)
+
+	// Editors can't create sheets in the owner's home
+	w = sendAs(router, http.MethodPost, "/save", aclEditor, url.Values{"fname": {"other"}, "owner": {aclOwner}, "data": {"A1:1"}}.Encode())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestNonCollaboratorIsDenied(t *testing.T) {
+	router, _ := setupSheetACL(t)
+	share(t, router, aclReader, "read")
+
+	assert.Equal(t, http.StatusForbidden, downloadAs(router, aclOther).Code)
+	assert.Equal(t, http.StatusForbidden, saveAs(router, aclOther, "A1:2").Code)
+
+	w := sendAs(router, http.MethodPost, "/usersheet", aclOther, url.Values{"pagename": {"budget"}, "owner": {aclOwner}}.Encode())
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/save", w.Header().Get("Location"))
+}
+
+func TestOnlyOwnerManagesAndDeletes(t *testing.T) {
+	router, handler := setupSheetACL(t)
+	share(t, router, aclEditor, "edit")
+
+	// The collaborator endpoints only address the caller's own sheets
+	w := sendAs(router, http.MethodPost, "/api/sheets/budget/collaborators", aclEditor, `{"email":"`+aclOther+`","permission":"edit"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	sendAs(router, http.MethodPost, "/usersheet", aclEditor, url.Values{"pagename": {"budget"}, "owner": {aclOwner}, "delete": {"yes"}}.Encode())
+	exists, _ := handler.Storage.ExistsItem("home/" + aclOwner + "/budget")
+	assert.True(t, exists, "an editor must not delete the owner's sheet")
+}
+
+func TestRevokeCollaborator(t *testing.T) {
+	router, _ := setupSheetACL(t)
+	share(t, router, aclReader, "read")
+	share(t, router, aclEditor, "edit")
+
+	w := sendAs(router, http.MethodGet, "/api/sheets/budget/collaborators", aclOwner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"ok","collaborators":{"bob@example.com":"read","carol@example.com":"edit"}}`, w.Body.String())
+
+	w = sendAs(router, http.MethodDelete, "/api/sheets/budget/collaborators/"+aclReader, aclOwner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusForbidden, downloadAs(router, aclReader).Code)
+	assert.Equal(t, http.StatusOK, downloadAs(router, aclEditor).Code)
+}
+
+func TestAddCollaboratorValidation(t *testing.T) {
+	router, _ := setupSheetACL(t)
+
+	cases := []struct {
+		name, path, body string
+		want             int
+	}{
+		{"unknown user", "/api/sheets/budget/collaborators", `{"email":"nobody@example.com","permission":"read"}`, http.StatusNotFound},
+		{"bad permission", "/api/sheets/budget/collaborators", `{"email":"bob@example.com","permission":"owner"}`, http.StatusBadRequest},
+		{"owner", "/api/sheets/budget/collaborators", `{"email":"Alice@Example.com","permission":"read"}`, http.StatusBadRequest},
+		{"missing sheet", "/api/sheets/missing/collaborators", `{"email":"bob@example.com","permission":"read"}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		w := sendAs(router, http.MethodPost, tc.path, aclOwner, tc.body)
+		assert.Equal(t, tc.want, w.Code, tc.name)
+	}
+}
+
+func TestDeletedSheetIsNoLongerShared(t *testing.T) {
+	router, _ := setupSheetACL(t)
+	share(t, router, aclReader, "read")
+
+	w := sendAs(router, http.MethodPost, "/api/sheets/delete", aclOwner, `{"ids":["budget"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// A new sheet under the old name starts out private
+	w = sendAs(router, http.MethodPost, "/save", aclOwner, url.Values{"fname": {"budget"}, "data": {"A1:new"}}.Encode())
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusForbidden, downloadAs(router, aclReader).Code)
+}
+
+func TestRestoredSheetIsSharedAgain(t *testing.T) {
+	router, handler := setupSheetACL(t)
+	handler.Trash = storage.NewTrash(".trash", time.Hour)
+	router.POST("/api/trash/:id/restore", handler.WebApp.HandleTrashRestore)
+	share(t, router, aclReader, "read")
+
+	code, resp := bulkDelete(t, router, "budget")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "deleted", resp.Results[0].Result)
+	assert.Equal(t, http.StatusForbidden, downloadAs(router, aclReader).Code)
+
+	w := sendAs(router, http.MethodPost, "/api/trash/"+resp.Results[0].TrashID+"/restore", aclOwner, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	acl, err := storage.GetACL(handler.Storage, []string{"home", aclOwner, "budget"})
+	require.NoError(t, err)
+	assert.Equal(t, storage.ACL{aclReader: storage.PermissionRead}, acl)
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkDeleteResponse struct {
+	Result  string `json:"result"`
+	Data    string `json:"data"`
+	Deleted int    `json:"deleted"`
+	Results []struct {
+		ID         string `json:"id"`
+		Result     string `json:"result"`
+		TrashID    string `json:"trash_id"`
+		OldTrashID string `json:"trashid"`
+	} `json:"results"`
+}
+
+func setupBulkDelete(t *testing.T, maxBatch int) (*gin.Engine, func(path string) bool) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.MaxBulkDelete = maxBatch
+	router.POST("/api/sheets/delete", handler.WebApp.HandleSheetsDelete)
+
+	for _, path := range []string{
+		"home/alice@example.com/q1", "home/alice@example.com/q2",
+		"home/alice@example.com/q3", "home/bob@example.com/payroll",
+	} {
+		require.NoError(t, handler.Storage.PutItem(path, `{"type":"file","data":"x"}`))
+	}
+	exists := func(path string) bool {
+		ok, _ := handler.Storage.ExistsItem(path)
+		return ok
+	}
+	return router, exists
+}
+
+func bulkDelete(t *testing.T, router *gin.Engine, ids ...string) (int, bulkDeleteResponse) {
+	body, _ := json.Marshal(map[string][]string{"ids": ids})
+	req := httptest.NewRequest(http.MethodPost, "/api/sheets/delete", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp bulkDeleteResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestBulkDeleteOwnedSheets(t *testing.T) {
+	router, exists := setupBulkDelete(t, 10)
+
+	code, resp := bulkDelete(t, router, "q1", "alice@example.com/q2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, resp.Deleted)
+	require.Len(t, resp.Results, 2)
+	for _, r := range resp.Results {
+		assert.Equal(t, "deleted", r.Result, r.ID)
+	}
+
+	assert.False(t, exists("home/alice@example.com/q1"))
+	assert.False(t, exists("home/alice@example.com/q2"))
+	assert.True(t, exists("home/alice@example.com/q3"))
+}
+
+func TestBulkDeleteRejectsOtherUsersSheet(t *testing.T) {
+	router, exists := setupBulkDelete(t, 10)
+
+	code, resp := bulkDelete(t, router, "q1", "bob@example.com/payroll", "missing")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, resp.Deleted)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, "deleted", resp.Results[0].Result)
+	assert.Equal(t, "forbidden", resp.Results[1].Result)
+	assert.Equal(t, "notfound", resp.Results[2].Result)
+
+	assert.False(t, exists("home/alice@example.com/q1"))
+	assert.True(t, exists("home/bob@example.com/payroll"), "another user's sheet must survive")
+}
+
+func TestBulkDeleteOverLimit(t *testing.T) {
+	router, exists := setupBulkDelete(t, 2)
+
+	code, resp := bulkDelete(t, router, "q1", "q2", "q3")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "fail", resp.Result)
+	assert.Contains(t, resp.Data, "limit is 2")
+
+	assert.True(t, exists("home/alice@example.com/q1"), "nothing is deleted from a rejected batch")
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSheetNames(allowDuplicates bool) (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+	handler.Config.AllowDuplicateSheetNames = allowDuplicates
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.POST("/save/validate", handler.WebApp.HandleSaveValidate)
+	return router, handler
+}
+
+func TestDuplicateSheetNameRejected(t *testing.T) {
+	router, handler := setupSheetNames(false)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"Budget"}, "data": {"A1:1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, name := range []string{"budget", "BUDGET", " Budget "} {
+		w = postSheet(router, "/save", url.Values{"fname": {name}, "data": {"A1:2"}})
+		assert.Equal(t, http.StatusConflict, w.Code, name)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "fail", resp["result"])
+		assert.Equal(t, "Budget", resp["existing"])
+
+		_, err := handler.Storage.GetFile(context.Background(), []string{"home", "alice@example.com", name})
+		assert.ErrorIs(t, err, storage.ErrNotFound, "colliding sheet %q must not be saved", name)
+	}
+
+	// Validation reports the collision before a save is tried
+	w = postSheet(router, "/save/validate", url.Values{"fname": {"budget"}, "data": {"A1:2"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Saving over the sheet itself, and unrelated names, still work
+	w = postSheet(router, "/save", url.Values{"fname": {"Budget"}, "data": {"A1:3"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postSheet(router, "/save", url.Values{"fname": {"Budget 2026"}, "data": {"A1:3"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDuplicateSheetNamesAllowed(t *testing.T) {
+	router, handler := setupSheetNames(true)
+
+	for _, name := range []string{"Budget", "budget"} {
+		w := postSheet(router, "/save", url.Values{"fname": {name}, "data": {"A1:1"}})
+		require.Equal(t, http.StatusOK, w.Code, name)
+	}
+	names, err := handler.Storage.List([]string{"home", "alice@example.com"})
+	require.NoError(t, err)
+	assert.Contains(t, names, "Budget")
+	assert.Contains(t, names, "budget")
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const patchBaseSheet = "version:1.5\ncell:A1:v:1\ncell:B2:t:keep me\ncell:D4:t:remove me\nsheet:c:4:r:4\n"
+
+func setupSheetPatch(t *testing.T) (*gin.Engine, *handlers.Handler, string) {
+	router, handler := testutils.SetupTestServer(nil)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.PATCH("/save/:id", handler.WebApp.HandleSavePatch)
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {patchBaseSheet}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return router, handler, resp["hash"]
+}
+
+func patchSheet(router *gin.Engine, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPatch, "/save/budget", bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func storedSheet(t *testing.T, handler *handlers.Handler) string {
+	raw, err := handler.Storage.GetItem("home/alice@example.com/budget")
+	require.NoError(t, err)
+	var stored struct {
+		Data string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(raw), &stored))
+	return stored.Data
+}
+
+func TestPatchChangesOnlyTargetedCells(t *testing.T) {
+	router, handler, hash := setupSheetPatch(t)
+
+	w := patchSheet(router, gin.H{
+		"hash": hash,
+		"ops": []gin.H{
+			{"op": "set", "cell": "A1", "value": "42"},
+			{"op": "set", "cell": "C3", "value": "a:b"},
+			{"op": "clear", "cell": "D4"},
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp["version"])
+	assert.NotEqual(t, hash, resp["hash"])
+	assert.Equal(t, `"`+resp["hash"]+`"`, w.Header().Get("ETag"))
+
+	want := "version:1.5\ncell:A1:v:42\ncell:B2:t:keep me\ncell:C3:t:a\\cb\nsheet:c:4:r:4\n"
+	assert.Equal(t, want, storedSheet(t, handler))
+}
+
+func TestPatchRejectsStaleHash(t *testing.T) {
+	router, handler, hash := setupSheetPatch(t)
+
+	first := patchSheet(router, gin.H{"hash": hash, "ops": []gin.H{{"op": "set", "cell": "A1", "value": "2"}}})
+	require.Equal(t, http.StatusOK, first.Code)
+
+	// A second client still holding the old hash must not clobber it
+	w := patchSheet(router, gin.H{"hash": hash, "ops": []gin.H{{"op": "set", "cell": "A1", "value": "3"}}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, storedSheet(t, handler), "cell:A1:v:2\n")
+}
+
+func TestPatchValidatesEachOperation(t *testing.T) {
+	router, handler, _ := setupSheetPatch(t)
+
+	w := patchSheet(router, gin.H{"ops": []gin.H{
+		{"op": "set", "cell": "A1", "value": "5"},
+		{"op": "rename", "cell": "A2"},
+		{"op": "set", "cell": "1A", "value": "x"},
+	}})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Errors []struct {
+			Index int `json:"index"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Errors, 2)
+	assert.Equal(t, 1, resp.Errors[0].Index)
+	assert.Equal(t, 2, resp.Errors[1].Index)
+	assert.True(t, strings.Contains(storedSheet(t, handler), "cell:A1:v:1\n"), "invalid patch must not be applied")
+}
+
+func TestPatchMissingSheet(t *testing.T) {
+	router, _, _ := setupSheetPatch(t)
+
+	payload, _ := json.Marshal(gin.H{"ops": []gin.H{{"op": "clear", "cell": "A1"}}})
+	req := httptest.NewRequest(http.MethodPatch, "/save/nosuchsheet", bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPatchRefusesDirectories(t *testing.T) {
+	router, handler, _ := setupSheetPatch(t)
+	dirs := map[string]string{
+		"securestore": `{"path":["home","alice@example.com","securestore"],"type":"dir","data":["app"]}`,
+		"reports":     `{"path":["home","alice@example.com","reports"],"type":"dir","data":[]}`,
+	}
+	for name, item := range dirs {
+		require.NoError(t, handler.Storage.PutItem("home/alice@example.com/"+name, item))
+	}
+
+	for name, item := range dirs {
+		payload, _ := json.Marshal(gin.H{"ops": []gin.H{{"op": "set", "cell": "A1", "value": "1"}}})
+		req := httptest.NewRequest(http.MethodPatch, "/save/"+name, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, name)
+		stored, err := handler.Storage.GetItem("home/alice@example.com/" + name)
+		require.NoError(t, err)
+		assert.Equal(t, item, stored, "%s must be left alone", name)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSheetValidation() (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Config.MaxSheetSize = 64
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.POST("/save/validate", handler.WebApp.HandleSaveValidate)
+	return router, handler
+}
+
+func postSheet(router *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestValidateSheetOK(t *testing.T) {
+	router, handler := setupSheetValidation()
+
+	w := postSheet(router, "/save/validate", url.Values{"fname": {"budget"}, "data": {"A1:1"}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":"ok","data":"valid"}`, w.Body.String())
+
+	exists, _ := handler.Storage.ExistsItem("home/alice@example.com/budget")
+	assert.False(t, exists, "validation must not save the sheet")
+}
+
+func TestValidateSheetReportsFieldErrors(t *testing.T) {
+	router, handler := setupSheetValidation()
+
+	w := postSheet(router, "/save/validate", url.Values{
+		"fname": {"../budget"},
+		"data":  {strings.Repeat("x", 65)},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Result string `json:"result"`
+		Errors []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "fail", resp.Result)
+	require.Len(t, resp.Errors, 2)
+	assert.Equal(t, "fname", resp.Errors[0].Field)
+	assert.Equal(t, "data", resp.Errors[1].Field)
+	assert.Equal(t, "sheet is 65 bytes, limit is 64", resp.Errors[1].Message)
+
+	exists, _ := handler.Storage.ExistsItem("home/alice@example.com/../budget")
+	assert.False(t, exists, "validation must not save the sheet")
+}
+
+func TestSaveUsesSameValidator(t *testing.T) {
+	router, _ := setupSheetValidation()
+
+	form := url.Values{"fname": {"budget"}, "data": {strings.Repeat("x", 65)}}
+	validate := postSheet(router, "/save/validate", form)
+	save := postSheet(router, "/save", form)
+
+	assert.Equal(t, http.StatusBadRequest, save.Code)
+	assert.JSONEq(t, validate.Body.String(), save.Body.String())
+
+	// The long-standing missing filename message is unchanged
+	w := postSheet(router, "/save", url.Values{"data": {"A1:1"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"data":"missing filename"`)
+}
+
+func TestSaveRefusesReservedNames(t *testing.T) {
+	router, handler := setupSheetValidation()
+	dir := `{"path":["home","alice@example.com","securestore"],"type":"dir","data":["app"]}`
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/securestore", dir))
+
+	form := url.Values{"fname": {"securestore"}, "data": {"A1:1"}}
+	w := postSheet(router, "/save/validate", form)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reserved")
+
+	w = postSheet(router, "/save", form)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	stored, err := handler.Storage.GetItem("home/alice@example.com/securestore")
+	require.NoError(t, err)
+	assert.Equal(t, dir, stored, "the app directory must be left alone")
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// greetingRouter renders a page expecting name and greeting, while the
+// handler only provides name
+func greetingRouter(t *testing.T, strict bool) *gin.Engine {
+	dir := t.TempDir()
+	page := `<p>{{.greeting}} {{.name}}</p>`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "greet.html"), []byte(page), 0o644))
+	pattern := filepath.Join(dir, "*")
+
+	router := gin.New()
+	if strict {
+		r, err := handlers.StrictTemplates(pattern, template.FuncMap{})
+		require.NoError(t, err)
+		router.HTMLRender = r
+	} else {
+		router.LoadHTMLGlob(pattern)
+	}
+	router.GET("/greet", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "greet.html", gin.H{"name": "alice"})
+	})
+	return router
+}
+
+func TestStrictTemplatesFailOnMissingKey(t *testing.T) {
+	w := serve(greetingRouter(t, true), http.MethodGet, "/greet", "")
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `map has no entry for key "greeting"`)
+	assert.NotContains(t, w.Body.String(), "<p>", "no part of the failed page should be sent")
+}
+
+func TestLenientTemplatesRenderMissingKeyEmpty(t *testing.T) {
+	w := serve(greetingRouter(t, false), http.MethodGet, "/greet", "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<p> alice</p>", w.Body.String())
+}
+
+func TestStrictTemplatesRenderCompleteData(t *testing.T) {
+	router := greetingRouter(t, true)
+	router.GET("/hello", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "greet.html", gin.H{"name": "alice", "greeting": "hello"})
+	})
+
+	w := serve(router, http.MethodGet, "/hello", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<p>hello alice</p>", w.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+}
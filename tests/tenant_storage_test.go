@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantHosts serves each test tenant on a host of its own
+var tenantHosts = map[string]string{
+	"acme.example.com":    "acme",
+	"globex.example.com":  "globex",
+	"initech.example.com": "initech",
+}
+
+func saveOnHost(router *gin.Engine, host string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = host
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTenantsRouteToTheirOwnStorage(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	acme, globex := testutils.NewMockStorage(), testutils.NewMockStorage()
+	handler.Tenants = storage.NewTenantResolver(handler.Storage)
+	handler.Tenants.Register("acme", acme)
+	handler.Tenants.Register("globex", globex)
+
+	router.Use(middleware.Tenant(tenantHosts, handler.Tenants.Known))
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	require.Equal(t, http.StatusOK, saveOnHost(router, "acme.example.com", url.Values{"fname": {"budget"}, "data": {"acme figures"}}).Code)
+	require.Equal(t, http.StatusOK, saveOnHost(router, "GLOBEX.example.com:8080", url.Values{"fname": {"budget"}, "data": {"globex figures"}}).Code)
+
+	const path = "home/alice@example.com/budget"
+	acmeRaw, err := acme.GetItem(path)
+	require.NoError(t, err)
+	assert.Contains(t, acmeRaw, "acme figures")
+	assert.NotContains(t, acmeRaw, "globex")
+
+	globexRaw, err := globex.GetItem(path)
+	require.NoError(t, err)
+	assert.Contains(t, globexRaw, "globex figures")
+	assert.NotContains(t, globexRaw, "acme")
+
+	exists, _ := handler.Storage.ExistsItem(path)
+	assert.False(t, exists, "tenant data must not reach the shared backend")
+}
+
+func TestOtherHostsUseSharedStorage(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	acme := testutils.NewMockStorage()
+	handler.Tenants = storage.NewTenantResolver(handler.Storage)
+	handler.Tenants.Register("acme", acme)
+
+	router.Use(middleware.Tenant(tenantHosts, handler.Tenants.Known))
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	for _, host := range []string{"example.com", "other.example.com"} {
+		require.Equal(t, http.StatusOK, saveOnHost(router, host, url.Values{"fname": {"sheet-" + host}, "data": {"x"}}).Code)
+		exists, _ := handler.Storage.ExistsItem("home/alice@example.com/sheet-" + host)
+		assert.True(t, exists, "host %q should default to the shared backend", host)
+	}
+}
+
+func TestTenantIsNotChosenByTheClient(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	acme := testutils.NewMockStorage()
+	handler.Tenants = storage.NewTenantResolver(handler.Storage)
+	handler.Tenants.Register("acme", acme)
+
+	router.Use(middleware.Tenant(tenantHosts, handler.Tenants.Known))
+	router.POST("/save", handler.WebApp.HandleSavePost)
+
+	// A header naming a tenant is ignored
+	req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(url.Values{"fname": {"budget"}, "data": {"x"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	exists, _ := acme.ExistsItem("home/alice@example.com/budget")
+	assert.False(t, exists)
+
+	// A host listed for a tenant without a backend is refused, not
+	// served from the shared one
+	w := saveOnHost(router, "initech.example.com", url.Values{"fname": {"budget"}, "data": {"x"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
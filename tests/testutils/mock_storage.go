@@ -1,10 +1,12 @@
 package testutils
 
 import (
-	"errors"
+	"context"
+	"sort"
 	"strings"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
 )
 
 type MockStorage struct {
@@ -19,43 +21,83 @@ func (m *MockStorage) pathToString(path []string) string {
 	return strings.Join(path, "/")
 }
 
-func (m *MockStorage) CreateDir(path []string) error {
+func (m *MockStorage) CreateDir(ctx context.Context, path []string) error {
 	spath := m.pathToString(path)
 	m.data[spath] = `{"path":["` + strings.Join(path, `","`) + `"],"type":"dir","data":[]}`
 	return nil
 }
 
-func (m *MockStorage) DeleteDir(path []string) error {
-	delete(m.data, m.pathToString(path))
+func (m *MockStorage) DeleteDir(path []string, recursive bool) error {
+	spath := m.pathToString(path)
+	if _, found := m.data[spath]; !found {
+		return storage.ErrNotFound
+	}
+	for key := range m.data {
+		if strings.HasPrefix(key, spath+"/") {
+			if !recursive {
+				return storage.ErrDirNotEmpty
+			}
+			delete(m.data, key)
+		}
+	}
+	delete(m.data, spath)
 	return nil
 }
 
-func (m *MockStorage) CreateFile(path []string, data string) error {
+func (m *MockStorage) List(path []string) ([]string, error) {
+	spath := m.pathToString(path)
+	if _, found := m.data[spath]; !found {
+		return nil, storage.ErrNotFound
+	}
+	seen := make(map[string]bool)
+	names := []string{}
+	for key := range m.data {
+		rest, ok := strings.CutPrefix(key, spath+"/")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MockStorage) CreateFile(ctx context.Context, path []string, data string) error {
 	spath := m.pathToString(path)
 	m.data[spath] = data
 	return nil
 }
 
-func (m *MockStorage) GetFile(path []string) (*models.StorageItem, error) {
+func (m *MockStorage) GetFile(ctx context.Context, path []string) (*models.StorageItem, error) {
 	spath := m.pathToString(path)
 	data, found := m.data[spath]
 	if !found {
-		return nil, errors.New("item not found")
+		return nil, storage.ErrNotFound
 	}
 	return models.StorageItemFromJSON(data)
 }
 
-func (m *MockStorage) UpdateFile(path []string, data string) error {
+func (m *MockStorage) UpdateFile(ctx context.Context, path []string, data string) error {
 	spath := m.pathToString(path)
 	m.data[spath] = data
 	return nil
 }
 
-func (m *MockStorage) DeleteFile(path []string) error {
+func (m *MockStorage) DeleteFile(ctx context.Context, path []string) error {
 	delete(m.data, m.pathToString(path))
 	return nil
 }
 
+func (m *MockStorage) Append(path []string, data []byte) error {
+	spath := m.pathToString(path)
+	m.data[spath] += string(data)
+	return nil
+}
+
 func (m *MockStorage) PutItem(path string, data string, bucket ...string) error {
 	m.data[path] = data
 	return nil
@@ -64,7 +106,7 @@ func (m *MockStorage) PutItem(path string, data string, bucket ...string) error
 func (m *MockStorage) GetItem(path string, bucket ...string) (string, error) {
 	v, ok := m.data[path]
 	if !ok {
-		return "", errors.New("item not found")
+		return "", storage.ErrNotFound
 	}
 	return v, nil
 }
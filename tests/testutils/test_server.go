@@ -1,15 +1,22 @@
 package testutils
 
 import (
+	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/counters"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/settings"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
 	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func SetupTestServer(t *testing.T) (*gin.Engine, *handlers.Handler) {
@@ -18,10 +25,19 @@ func SetupTestServer(t *testing.T) (*gin.Engine, *handlers.Handler) {
 		Port:           "8080",
 		CookieSecret:   "testsecret",
 		StorageBackend: "mock",
+
+		HealthPoolSaturationPercent: 100,
+		HealthMinDiskFreePercent:    10,
+
+		AllowDuplicateSheetNames: true,
 	}
 
+	// Cheap hashes keep the many registrations in the suite fast
+	models.SetPasswordHashCost(bcrypt.MinCost)
+
 	router := gin.Default()
-	router.Use(middleware.CORS(), middleware.Logger(), middleware.Recovery())
+	router.Use(middleware.CORSWithMethods(middleware.RouteMethods(router)), middleware.Logger(), middleware.Recovery())
+	router.SetHTMLTemplate(stubTemplates())
 
 	// Use mock storage
 	h := &handlers.Handler{
@@ -29,13 +45,37 @@ func SetupTestServer(t *testing.T) (*gin.Engine, *handlers.Handler) {
 		Storage: NewMockStorage(),
 	}
 
-	h.Auth = handlers.NewAuthHandler(h, nil)
+	h.Settings = settings.NewService(h.Storage)
+	h.Changes = storage.NewChangeLog(0, 0)
+	h.Counters = counters.New(h.Storage)
+	h.Auth = handlers.NewAuthHandler(h, auth.NewService(h.Storage))
 	h.WebApp = handlers.NewWebAppHandler(h)
 	h.App = handlers.NewAppHandler(h)
+	h.Health = handlers.NewHealthHandler(h)
+	h.Admin = handlers.NewAdminHandler(h)
 
 	return router, h
 }
 
+// templateNames lists every page the handlers render
+var templateNames = []string{
+	"allusersheets.html", "amazonwebapp.html", "htmltopdf.html", "importcollab.html",
+	"importcollabload.html", "importerror.html", "landing-page.html", "login.html",
+	"lostpassword-baduser.html", "lostpassword-sentemail.html", "lostpassword.html",
+	"pwreset-invalid.html", "pwreset-ok.html", "pwreset.html", "register.html",
+}
+
+// stubTemplates stands in for web/templates so handlers that render HTML can
+// be exercised; each page just prints its name, any error message, whether
+// the onboarding flow was requested and how an import was treated
+func stubTemplates() *template.Template {
+	root := template.New("stub")
+	for _, name := range templateNames {
+		template.Must(root.New(name).Parse(name + "{{with .error}}: {{.}}{{end}}{{if .onboarding}} (onboarding){{end}}{{with .importtype}} [{{.}}]{{end}}"))
+	}
+	return root
+}
+
 func PerformRequest(r http.Handler, method, path string, body http.HandlerFunc) *httptest.ResponseRecorder {
 	req := httptest.NewRequest(method, path, nil)
 	w := httptest.NewRecorder()
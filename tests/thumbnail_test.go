@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/thumbnail"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupThumbnails() (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Storage = storage.NewMemoryStorage()
+	handler.Config.ThumbnailMaxAge = 5 * time.Minute
+	handler.Thumbnails = thumbnail.NewGenerator(120, 80, 1, 8)
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.GET("/api/sheets/:name/thumbnail", handler.WebApp.HandleSheetThumbnail)
+	return router, handler
+}
+
+func TestSaveProducesThumbnail(t *testing.T) {
+	router, handler := setupThumbnails()
+
+	w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {"cell:A1:t:Rent\ncell:B1:v:1200\n"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	handler.Thumbnails.Wait()
+
+	w = getAs(router, "/api/sheets/budget/thumbnail", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Empty(t, w.Header().Get("X-Thumbnail-Status"))
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 120, img.Bounds().Dx())
+
+	// Revalidation with the ETag skips the body
+	req := httptest.NewRequest(http.MethodGet, "/api/sheets/budget/thumbnail", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "alice@example.com"})
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestThumbnailPlaceholderWhilePending(t *testing.T) {
+	router, handler := setupThumbnails()
+	// Saved before thumbnails were on, so it has none yet
+	require.NoError(t, handler.Storage.CreateFile(context.Background(), []string{"home", "alice@example.com", "old"}, `{"data":"cell:A1:v:1"}`))
+
+	w := getAs(router, "/api/sheets/old/thumbnail", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pending", w.Header().Get("X-Thumbnail-Status"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	_, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+
+	// Asking queued the preview
+	handler.Thumbnails.Wait()
+	w = getAs(router, "/api/sheets/old/thumbnail", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Thumbnail-Status"))
+}
+
+func TestThumbnailErrors(t *testing.T) {
+	router, handler := setupThumbnails()
+
+	assert.Equal(t, http.StatusUnauthorized, getAs(router, "/api/sheets/budget/thumbnail", "").Code)
+	assert.Equal(t, http.StatusNotFound, getAs(router, "/api/sheets/missing/thumbnail", "alice@example.com").Code)
+
+	// Other users' sheets need a grant
+	require.NoError(t, handler.Storage.CreateFile(context.Background(), []string{"home", "bob@example.com", "plans"}, `{"data":"cell:A1:v:1"}`))
+	assert.Equal(t, http.StatusForbidden, getAs(router, "/api/sheets/plans/thumbnail?owner=bob@example.com", "alice@example.com").Code)
+
+	handler.Thumbnails = nil
+	assert.Equal(t, http.StatusNotFound, getAs(router, "/api/sheets/plans/thumbnail", "bob@example.com").Code)
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type trashListResponse struct {
+	Result  string `json:"result"`
+	Entries []struct {
+		ID           string    `json:"id"`
+		Name         string    `json:"name"`
+		DeletedAt    time.Time `json:"deleted_at"`
+		OldDeletedAt time.Time `json:"deletedat"`
+	} `json:"entries"`
+}
+
+func setupTrash(t *testing.T) (*gin.Engine, func(path string) bool) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Trash = storage.NewTrash(".trash", time.Hour)
+	router.POST("/api/sheets/delete", handler.WebApp.HandleSheetsDelete)
+	router.GET("/api/trash", handler.WebApp.HandleTrashList)
+	router.POST("/api/trash/:id/restore", handler.WebApp.HandleTrashRestore)
+
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/q1", `{"type":"file","data":"x"}`))
+	exists := func(path string) bool {
+		ok, _ := handler.Storage.ExistsItem(path)
+		return ok
+	}
+	return router, exists
+}
+
+func postAs(router *gin.Engine, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func listTrash(t *testing.T, router *gin.Engine, user string) trashListResponse {
+	w := getAs(router, "/api/trash", user)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp trashListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestDeletedSheetMovesToTrashAndRestores(t *testing.T) {
+	router, exists := setupTrash(t)
+
+	code, resp := bulkDelete(t, router, "q1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "deleted", resp.Results[0].Result)
+	assert.False(t, exists("home/alice@example.com/q1"))
+
+	trash := listTrash(t, router, "alice@example.com")
+	require.Len(t, trash.Entries, 1)
+	assert.Equal(t, "q1", trash.Entries[0].Name)
+	id := trash.Entries[0].ID
+	assert.True(t, exists("home/alice@example.com/.trash/"+id))
+
+	// Fields renamed to snake_case are still sent under their old names
+	assert.Equal(t, id, resp.Results[0].TrashID)
+	assert.Equal(t, id, resp.Results[0].OldTrashID)
+	assert.False(t, trash.Entries[0].DeletedAt.IsZero())
+	assert.Equal(t, trash.Entries[0].DeletedAt, trash.Entries[0].OldDeletedAt)
+
+	w := postAs(router, "/api/trash/"+id+"/restore", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, exists("home/alice@example.com/q1"))
+	assert.False(t, exists("home/alice@example.com/.trash/"+id))
+	assert.Empty(t, listTrash(t, router, "alice@example.com").Entries)
+}
+
+func TestTrashRestoreIsOwnerOnly(t *testing.T) {
+	router, exists := setupTrash(t)
+
+	_, resp := bulkDelete(t, router, "q1")
+	require.Equal(t, "deleted", resp.Results[0].Result)
+	id := listTrash(t, router, "alice@example.com").Entries[0].ID
+
+	assert.Empty(t, listTrash(t, router, "bob@example.com").Entries)
+	w := postAs(router, "/api/trash/"+id+"/restore", "bob@example.com")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, exists("home/bob@example.com/q1"))
+	assert.False(t, exists("home/alice@example.com/q1"))
+
+	w = postAs(router, "/api/trash/"+id+"/restore", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTrashEmptiesAfterRetention(t *testing.T) {
+	router, handler := testutils.SetupTestServer(nil)
+	handler.Trash = storage.NewTrash(".trash", time.Hour)
+	router.GET("/api/trash", handler.WebApp.HandleTrashList)
+
+	// An entry deleted at the Unix epoch is long past the retention period
+	oldID := "00000000000000000001-old"
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/.trash",
+		`{"path":["home","alice@example.com",".trash"],"type":"dir","data":["`+oldID+`"]}`))
+	require.NoError(t, handler.Storage.PutItem("home/alice@example.com/.trash/"+oldID,
+		`{"type":"file","data":"x"}`))
+
+	assert.Empty(t, listTrash(t, router, "alice@example.com").Entries)
+	kept, _ := handler.Storage.ExistsItem("home/alice@example.com/.trash/" + oldID)
+	assert.False(t, kept, "expired entry should be emptied")
+}
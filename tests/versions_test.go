@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionsResponse struct {
+	Result   string                 `json:"result"`
+	Versions []handlers.VersionInfo `json:"versions"`
+}
+
+func setupVersions(t *testing.T) (*gin.Engine, *handlers.Handler) {
+	router, handler := testutils.SetupTestServer(nil)
+	// Versions are found through directory listings, which the mock
+	// storage doesn't keep
+	handler.Storage = storage.NewMemoryStorage()
+	router.POST("/save", handler.WebApp.HandleSavePost)
+	router.GET("/api/sheets/:name/versions", handler.WebApp.HandleVersionsList)
+	router.POST("/api/sheets/:name/versions/:id/restore", handler.WebApp.HandleVersionRestore)
+
+	for _, data := range []string{"version:1.5\ncell:A1:v:1\n", "version:1.5\ncell:A1:v:22\n", "version:1.5\ncell:A1:v:333\n"} {
+		w := postSheet(router, "/save", url.Values{"fname": {"budget"}, "data": {data}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	return router, handler
+}
+
+func listVersions(t *testing.T, router *gin.Engine, user string) versionsResponse {
+	w := getAs(router, "/api/sheets/budget/versions", user)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp versionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestListVersionsNewestFirst(t *testing.T) {
+	router, _ := setupVersions(t)
+
+	versions := listVersions(t, router, "alice@example.com").Versions
+	require.Len(t, versions, 3)
+	assert.Equal(t, len("version:1.5\ncell:A1:v:333\n"), versions[0].Size)
+	assert.Equal(t, len("version:1.5\ncell:A1:v:1\n"), versions[2].Size)
+	assert.False(t, versions[0].Time.Before(versions[1].Time), "versions should be newest first")
+	assert.False(t, versions[2].Time.IsZero())
+}
+
+func TestRestoreOlderVersion(t *testing.T) {
+	router, handler := setupVersions(t)
+	oldest := listVersions(t, router, "alice@example.com").Versions[2]
+
+	w := postAs(router, "/api/sheets/budget/versions/"+oldest.ID+"/restore", "alice@example.com")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	item, err := handler.Storage.GetFile(context.Background(), []string{"home", "alice@example.com", "budget"})
+	require.NoError(t, err)
+	var stored struct {
+		Data string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &stored))
+	assert.Equal(t, "version:1.5\ncell:A1:v:1\n", stored.Data)
+
+	// The restore is a version of its own, so it can be undone too
+	versions := listVersions(t, router, "alice@example.com").Versions
+	require.Len(t, versions, 4)
+	assert.Equal(t, oldest.Size, versions[0].Size)
+	assert.NotEqual(t, oldest.ID, versions[0].ID)
+}
+
+func TestRestoreUnknownVersion(t *testing.T) {
+	router, _ := setupVersions(t)
+
+	w := postAs(router, "/api/sheets/budget/versions/00000000000000000001/restore", "alice@example.com")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = postAs(router, "/api/sheets/budget/versions/..%2Fbudget/restore", "alice@example.com")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestVersionsNeedAccessToTheSheet(t *testing.T) {
+	router, _ := setupVersions(t)
+
+	w := getAs(router, "/api/sheets/budget/versions", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = getAs(router, "/api/sheets/budget/versions?owner=alice@example.com", "mallory@example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}